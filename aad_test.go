@@ -0,0 +1,85 @@
+package celo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestWithAAD(t *testing.T) {
+	plaintext := randomPlaintext(2*testChunkSize + 10)
+	blob, err := EncryptBytes([]byte("secret"), plaintext, WithAAD([]byte("tenant-1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DecryptBytes([]byte("secret"), blob, WithAAD([]byte("tenant-1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("decrypted content differs")
+	}
+
+	// The content is read one chunk at a time with the same additional data.
+	d := NewDecrypter()
+	d.Config(WithAAD([]byte("tenant-1")))
+	pr, err := d.OpenAt([]byte("secret"), bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = io.ReadAll(pr); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("OpenAt: got %d bytes, %v", len(got), err)
+	}
+
+	for _, opts := range [][]Option{nil, {WithAAD([]byte("tenant-2"))}, {WithAAD([]byte("tenant-"))}} {
+		if _, err = DecryptBytes([]byte("secret"), blob, opts...); !errors.Is(errors.Ciphertext, err) {
+			t.Errorf("got error %v, want kind Ciphertext", err)
+		}
+	}
+
+	// Files encrypted without additional data require none.
+	blob, err = EncryptBytes([]byte("secret"), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecryptBytes([]byte("secret"), blob, WithAAD([]byte("tenant-1"))); !errors.Is(errors.Ciphertext, err) {
+		t.Errorf("got error %v, want kind Ciphertext", err)
+	}
+}
+
+func TestWithAADFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain")
+	plaintext := randomPlaintext(3*testChunkSize + 1)
+	if err := os.WriteFile(name, plaintext, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	e.Config(WithAAD([]byte("record 42")))
+	encryptedName, err := e.EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewDecrypter().DecryptFile([]byte("secret"), encryptedName, false, false); !errors.Is(errors.Ciphertext, err) {
+		t.Errorf("got error %v, want kind Ciphertext", err)
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Error("decrypted file created without the additional data")
+	}
+
+	d := NewDecrypter()
+	d.Config(WithAAD([]byte("record 42")))
+	if _, err = d.DecryptFile([]byte("secret"), encryptedName, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(name); !bytes.Equal(got, plaintext) {
+		t.Error("decrypted file content differs")
+	}
+}
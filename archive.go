@@ -0,0 +1,430 @@
+package celo
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// archiveEntry a directory or regular file of an archive.
+type archiveEntry struct {
+	// name path of the file on disk.
+	name string
+	// header tar header of the file, its name is relative to the archived
+	// directory.
+	header *tar.Header
+}
+
+// EncryptDir encrypts the directory with the specified name into a single
+// file: a tar archive of its directories and regular files, with their paths
+// relative to dir and their permissions. Other files, e.g. symbolic links,
+// are skipped. The metadata of the file flags it as an archive (See
+// Info.Archive and Decrypter.DecryptDir).
+// It returns the name of the encrypted file, the name of the directory with
+// the extension. If it exists, overwrite has to be true in order to replace
+// it (See OnCollision).
+// The archive is streamed through the cipher, nothing is written to disk but
+// the encrypted file, which is created atomically as EncryptFile does.
+func (e *Encrypter) EncryptDir(secretPhrase []byte, dir string, overwrite bool) (encryptedName string, err error) {
+	return e.EncryptDirContext(context.Background(), secretPhrase, dir, overwrite)
+}
+
+// EncryptDirContext is like EncryptDir but it stops as soon as ctx is done,
+// returning an error of kind errors.Canceled.
+func (e *Encrypter) EncryptDirContext(ctx context.Context, secretPhrase []byte, dir string, overwrite bool) (encryptedName string, err error) {
+	op := errors.Op("archive.EncryptDir")
+	var n int64
+	defer func() { e.fileDone(true, n, err) }()
+
+	if err = checkContext(ctx, op); err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", errors.E(errors.Open, op, errors.Entity(dir), err)
+	}
+	if !fi.IsDir() {
+		return "", errors.E(errors.Invalid, op, errors.Entity(dir), errors.Errorf("not a directory"))
+	}
+
+	entries, err := archiveEntries(dir)
+	if err != nil {
+		return "", errors.E(op, errors.Entity(dir), err)
+	}
+
+	// The size of the archive is required upfront to encrypt it.
+	cw := &countingWriter{w: io.Discard}
+	if err = writeArchive(ctx, cw, dir, entries, false); err != nil {
+		return "", errors.E(op, errors.Entity(dir), err)
+	}
+	size := cw.n
+	e.log(slog.LevelDebug, "file opened", "file", dir, "size", size)
+
+	if encryptedName, err = e.outputName(e.encryptedName(filepath.Clean(dir))); err != nil {
+		return "", err
+	}
+	if encryptedName, overwrite, err = e.collide(op, encryptedName, overwrite); err != nil {
+		return "", err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(writeArchive(ctx, pw, dir, entries, true))
+	}()
+
+	e.archive = true
+	n, err = e.encryptTo(ctx, secretPhrase, pr, dir, size, encryptedName, overwrite)
+	e.archive = false
+
+	// The archive isn't read anymore if the encryption failed.
+	pr.Close()
+	<-done
+	if err != nil {
+		return "", errors.E(op, errors.Entity(dir), err)
+	}
+	e.log(slog.LevelInfo, "file encrypted", "file", dir, "output", encryptedName, "bytes", n)
+
+	return encryptedName, nil
+}
+
+// archiveEntries returns the directories and regular files of dir, dir
+// excluded, in lexical order.
+func archiveEntries(dir string) ([]archiveEntry, error) {
+	op := errors.Op("archive.archiveEntries")
+	var entries []archiveEntry
+
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.E(errors.Open, op, errors.Entity(name), err)
+		}
+		if name == dir || !(d.IsDir() || d.Type().IsRegular()) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return errors.E(errors.Open, op, errors.Entity(name), err)
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return errors.E(errors.Internal, op, err)
+		}
+
+		h := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(fi.Mode().Perm()),
+			ModTime: fi.ModTime(),
+		}
+		if d.IsDir() {
+			h.Typeflag = tar.TypeDir
+			h.Name += "/"
+		} else {
+			h.Typeflag = tar.TypeReg
+			h.Size = fi.Size()
+		}
+		entries = append(entries, archiveEntry{name: name, header: h})
+		return nil
+	})
+
+	return entries, err
+}
+
+// writeArchive writes the tar archive of the entries of dir to w. The content
+// of the files is only read if content is true, zeros are written otherwise,
+// which results in an archive of the same size.
+// It returns an error of kind errors.Plaintext if a file changed size since
+// its entry was listed.
+func writeArchive(ctx context.Context, w io.Writer, dir string, entries []archiveEntry, content bool) error {
+	op := errors.Op("archive.writeArchive")
+	tw := tar.NewWriter(w)
+
+	for _, entry := range entries {
+		if err := checkContext(ctx, op); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(entry.header); err != nil {
+			return errors.E(errors.Encode, op, errors.Entity(entry.name), err)
+		}
+		if entry.header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if !content {
+			if _, err := io.CopyN(tw, zeroReader{}, entry.header.Size); err != nil {
+				return errors.E(errors.Encode, op, errors.Entity(entry.name), err)
+			}
+			continue
+		}
+
+		if err := copyArchiveFile(tw, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.E(errors.Encode, op, err)
+	}
+	return nil
+}
+
+// copyArchiveFile writes the content of the file of entry to tw.
+func copyArchiveFile(tw *tar.Writer, entry archiveEntry) error {
+	op := errors.Op("archive.copyArchiveFile")
+
+	f, err := os.Open(entry.name)
+	if err != nil {
+		return errors.E(errors.Open, op, errors.Entity(entry.name), err)
+	}
+	defer f.Close()
+
+	if _, err = io.CopyN(tw, f, entry.header.Size); err == io.EOF {
+		return errors.E(errors.Plaintext, op, errors.Entity(entry.name), errors.Errorf("the file shrank while it was archived"))
+	}
+	if err != nil {
+		return errors.E(errors.Encode, op, errors.Entity(entry.name), err)
+	}
+	if extra, _ := f.Read(make([]byte, 1)); extra > 0 {
+		return errors.E(errors.Plaintext, op, errors.Entity(entry.name), errors.Errorf("the file grew while it was archived"))
+	}
+	return nil
+}
+
+// DecryptDir decrypts the archive with the specified name (See EncryptDir) and
+// extracts its entries into the directory dir, or into a directory named
+// after the file without the extension if dir is empty (See WithOutputDir).
+// If dir exists, overwrite has to be true in order to replace it (See
+// OnCollision).
+// It returns the name of the directory the archive was extracted into.
+// The entries are extracted into a temporary directory next to dir, which only
+// becomes dir once the whole file was authenticated, so a corrupt or forged
+// archive never leaves files behind. The directory is only accessible by its
+// owner, the entries keep their permissions and modification times.
+// Entries whose path isn't local to the archive, such as ../../.bashrc, make
+// the extraction fail with an error of kind errors.Invalid unless
+// SkipUnsafePaths is used. Entries other than directories and regular files,
+// e.g. symbolic links, are skipped.
+// It returns an error of kind errors.Incompatible if the file isn't an
+// archive.
+func (d *Decrypter) DecryptDir(secretPhrase []byte, name, dir string, overwrite, removeSource bool) (string, error) {
+	return d.DecryptDirContext(context.Background(), secretPhrase, name, dir, overwrite, removeSource)
+}
+
+// DecryptDirContext is like DecryptDir but it stops as soon as ctx is done,
+// returning an error of kind errors.Canceled.
+func (d *Decrypter) DecryptDirContext(ctx context.Context, secretPhrase []byte, name, dir string, overwrite, removeSource bool) (_ string, err error) {
+	op := errors.Op("archive.DecryptDir")
+	var n int64
+	defer func() { d.fileDone(false, n, err) }()
+
+	if err = checkContext(ctx, op); err != nil {
+		return "", err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return "", errors.E(errors.Open, op, err)
+	}
+	defer f.Close()
+
+	size := fileSize(f)
+	d.log(slog.LevelDebug, "file opened", "file", name, "size", size)
+
+	m, _, err := DecodeMetadata(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return "", errors.E(op, errors.Entity(name), err)
+	}
+	if !m.hasFlag(flagArchive) {
+		return "", errors.E(errors.Incompatible, op, errors.Entity(name), errors.Errorf("the file isn't an archive"))
+	}
+
+	if dir == "" {
+		if dir, err = d.outputName(d.decryptedName(name)); err != nil {
+			return "", err
+		}
+	}
+	if dir, overwrite, err = d.collide(op, dir, overwrite); err != nil {
+		return "", err
+	}
+	if !overwrite && exists(dir) {
+		return "", errors.E(errors.Exist, op, errors.Entity(dir))
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".*.tmp")
+	if err != nil {
+		return "", errors.E(errors.Create, op, err)
+	}
+	// Once extracted, the temporary directory is renamed to dir.
+	defer os.RemoveAll(tmp)
+
+	// Archives are always chunked, they are extracted as they are decrypted.
+	if n, err = d.extractTo(ctx, secretPhrase, f, size, name, tmp); err != nil {
+		return "", errors.E(op, errors.Entity(name), err)
+	}
+
+	if overwrite {
+		if err = os.RemoveAll(dir); err != nil {
+			return "", errors.E(errors.Create, op, errors.Entity(dir), err)
+		}
+	} else if exists(dir) {
+		// dir was created while the archive was extracted.
+		return "", errors.E(errors.Exist, op, errors.Entity(dir))
+	}
+	if err = os.Rename(tmp, dir); err != nil {
+		return "", errors.E(errors.Create, op, errors.Entity(dir), err)
+	}
+	d.log(slog.LevelInfo, "file decrypted", "file", name, "output", dir, "bytes", n)
+
+	if removeSource {
+		d.removeSource(name)
+	}
+
+	return dir, nil
+}
+
+// extractTo decrypts the archive f of the given size one chunk
+// at a time and extracts it into dir as it is decrypted. Entries are extracted
+// before the file is authenticated, dir must be discarded if an error is
+// returned.
+// It returns the size of the archive.
+func (d *Decrypter) extractTo(ctx context.Context, secretPhrase []byte, f *os.File, size int64, name, dir string) (n int64, err error) {
+	pr, pw := io.Pipe()
+	src := &sourceReader{r: pr}
+
+	var xerr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if xerr = d.extractArchive(ctx, src, dir); xerr == nil {
+			// Whatever follows the end of the archive is read too, the whole
+			// file has to be authenticated.
+			_, xerr = io.Copy(io.Discard, src)
+		}
+		pr.CloseWithError(xerr)
+	}()
+
+	n, err = d.decryptTo(ctx, secretPhrase, f, size, name, pw)
+	pw.CloseWithError(err)
+	<-done
+
+	// The decryption fails to write once the extraction failed, the error of
+	// the extraction is the cause unless it was caused by the decryption.
+	if xerr != nil && src.err == nil {
+		return 0, xerr
+	}
+	return n, err
+}
+
+// sourceReader records the errors of reading the plaintext of an archive, so
+// they can be told apart from the errors of extracting it.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// extractArchive extracts the tar archive read from r into the empty
+// directory dir (See DecryptDir).
+func (d *Decrypter) extractArchive(ctx context.Context, r io.Reader, dir string) error {
+	op := errors.Op("archive.extractArchive")
+	tr := tar.NewReader(r)
+	// Directories get their permissions once their entries were extracted,
+	// they could be read-only.
+	var dirs []*tar.Header
+
+	for {
+		if err := checkContext(ctx, op); err != nil {
+			return err
+		}
+
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.E(errors.Decode, op, err)
+		}
+
+		rel := filepath.FromSlash(strings.TrimSuffix(h.Name, "/"))
+		if !filepath.IsLocal(rel) {
+			if !d.skipUnsafePaths {
+				return errors.E(errors.Invalid, op, errors.Entity(h.Name), errors.Errorf("unsafe path in archive"))
+			}
+			d.log(slog.LevelWarn, "unsafe entry skipped", "entry", h.Name)
+			continue
+		}
+		target := filepath.Join(dir, rel)
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, 0700); err != nil {
+				return errors.E(errors.Create, op, errors.Entity(h.Name), err)
+			}
+			dirs = append(dirs, h)
+		case tar.TypeReg:
+			if err = extractFile(tr, h, target); err != nil {
+				return err
+			}
+		default:
+			d.log(slog.LevelDebug, "entry skipped", "entry", h.Name, "type", string(h.Typeflag))
+		}
+	}
+
+	// Nested directories first, the permissions of their parents could
+	// prevent changing them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		h := dirs[i]
+		target := filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(h.Name, "/")))
+		if err := os.Chmod(target, os.FileMode(h.Mode).Perm()); err != nil {
+			return errors.E(errors.Create, op, errors.Entity(h.Name), err)
+		}
+		os.Chtimes(target, h.ModTime, h.ModTime)
+	}
+
+	return nil
+}
+
+// extractFile writes the content of the regular file entry h, read from tr,
+// to the new file target.
+func extractFile(tr *tar.Reader, h *tar.Header, target string) error {
+	op := errors.Op("archive.extractFile")
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return errors.E(errors.Create, op, errors.Entity(h.Name), err)
+	}
+	// Entries can't replace each other.
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.E(errors.Create, op, errors.Entity(h.Name), err)
+	}
+
+	if _, err = io.Copy(f, tr); err != nil {
+		f.Close()
+		return errors.E(errors.Decode, op, errors.Entity(h.Name), err)
+	}
+	if err = f.Chmod(os.FileMode(h.Mode).Perm()); err != nil {
+		f.Close()
+		return errors.E(errors.Create, op, errors.Entity(h.Name), err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.E(errors.Create, op, errors.Entity(h.Name), err)
+	}
+	os.Chtimes(target, h.ModTime, h.ModTime)
+
+	return nil
+}
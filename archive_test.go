@@ -0,0 +1,397 @@
+package celo
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// writeTree creates the files of tree, by their slash separated path relative
+// to dir, with permissions 0640. Names that end with / are directories.
+func writeTree(t *testing.T, dir string, tree map[string]string) {
+	t.Helper()
+	for name, content := range tree {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if content == "/" {
+			if err := os.MkdirAll(name, 0750); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.WriteFile(name, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEncryptDir(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "photos")
+	writeTree(t, dir, map[string]string{
+		"a.txt":         "attack at dawn",
+		"2024/b.jpg":    string(randomPlaintext(2*testChunkSize + 5)),
+		"2024/empty":    "",
+		"2025/":         "/",
+		"2024/nested/c": "c",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedName, err := NewEncrypter().EncryptDir([]byte("secret"), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := dir + "." + Extension; encryptedName != want {
+		t.Errorf("encrypted to %s, want %s", encryptedName, want)
+	}
+
+	b, err := os.ReadFile(encryptedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := Inspect(bytes.NewReader(b)); err != nil || !info.Archive {
+		t.Errorf("archive flag not set: %v", err)
+	}
+	plaintext, err := DecryptBytes([]byte("secret"), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(plaintext))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(tr)
+		got[h.Name] = string(content)
+
+		want := int64(0640)
+		if h.Typeflag == tar.TypeDir {
+			want = 0755
+			if h.Name == "2025/" {
+				want = 0750
+			}
+		}
+		if h.Mode != want {
+			t.Errorf("%s: mode %o, want %o", h.Name, h.Mode, want)
+		}
+	}
+
+	want := map[string]string{
+		"2024/":         "",
+		"2024/b.jpg":    string(randomPlaintext(2*testChunkSize + 5)),
+		"2024/empty":    "",
+		"2024/nested/":  "",
+		"2024/nested/c": "c",
+		"2025/":         "",
+		"a.txt":         "attack at dawn",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got entries %v", keys(got))
+	}
+	for name, content := range want {
+		if c, ok := got[name]; !ok || c != content {
+			t.Errorf("%s: got %d bytes (%v), want %d", name, len(c), ok, len(content))
+		}
+	}
+}
+
+func TestEncryptDirErrors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "docs")
+	writeTree(t, dir, map[string]string{"a.txt": "attack at dawn"})
+
+	e := NewEncrypter()
+	if _, err := e.EncryptDir([]byte("secret"), filepath.Join(dir, "a.txt"), false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("file: got error %v, want kind Invalid", err)
+	}
+	if _, err := e.EncryptDir([]byte("secret"), filepath.Join(dir, "missing"), false); !errors.Is(errors.Open, err) {
+		t.Errorf("missing: got error %v, want kind Open", err)
+	}
+
+	if err := os.WriteFile(dir+"."+Extension, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.EncryptDir([]byte("secret"), dir, false); !errors.Is(errors.Exist, err) {
+		t.Errorf("existing: got error %v, want kind Exist", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.EncryptDirContext(ctx, []byte("secret"), dir, true); !errors.Is(errors.Canceled, err) {
+		t.Errorf("canceled: got error %v, want kind Canceled", err)
+	}
+	if b, _ := os.ReadFile(dir + "." + Extension); string(b) != "existing" {
+		t.Error("existing file modified")
+	}
+
+	// Files encrypted afterwards aren't archives.
+	name, err := e.EncryptFile([]byte("secret"), filepath.Join(dir, "a.txt"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(name)
+	if info, _ := Inspect(bytes.NewReader(b)); info.Archive {
+		t.Error("file flagged as an archive")
+	}
+}
+
+// encryptArchive encrypts the tar archive written by write into the file
+// name, flagged as an archive.
+func encryptArchive(t *testing.T, name string, write func(tw *tar.Writer)) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write(tw)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	e.archive = true
+	b, err := encryptBytes(e, []byte("secret"), buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(name, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tempDirs returns the temporary directories left in dir.
+func tempDirs(t *testing.T, dir string) []string {
+	t.Helper()
+	m, err := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDecryptDir(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "photos")
+	tree := map[string]string{
+		"a.txt":         "attack at dawn",
+		"2024/b.jpg":    string(randomPlaintext(3*testChunkSize + 7)),
+		"2024/empty":    "",
+		"2025/":         "/",
+		"2024/nested/c": "c",
+	}
+	writeTree(t, dir, tree)
+	if err := os.Chmod(filepath.Join(dir, "a.txt"), 0400); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "2024", "nested"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	// The extracted tree is removed by t.TempDir.
+	defer os.Chmod(filepath.Join(dir, "2024", "nested"), 0755)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "2024", "empty"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := NewEncrypter().EncryptDir([]byte("secret"), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecrypter()
+	if _, err = d.DecryptDir([]byte("secret"), name, "", false, false); !errors.Is(errors.Exist, err) {
+		t.Errorf("existing: got error %v, want kind Exist", err)
+	}
+
+	out := filepath.Join(parent, "restored")
+	extracted, err := d.DecryptDir([]byte("secret"), name, out, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extracted != out {
+		t.Errorf("extracted into %s, want %s", extracted, out)
+	}
+	defer os.Chmod(filepath.Join(out, "2024", "nested"), 0755)
+
+	for rel, content := range tree {
+		if content == "/" {
+			if fi, err := os.Stat(filepath.Join(out, rel)); err != nil || !fi.IsDir() {
+				t.Errorf("%s: not a directory: %v", rel, err)
+			}
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(rel)))
+		if err != nil || string(b) != content {
+			t.Errorf("%s: got %d bytes, want %d: %v", rel, len(b), len(content), err)
+		}
+	}
+
+	modes := map[string]os.FileMode{".": 0700, "a.txt": 0400, "2024/b.jpg": 0640, "2024/nested": 0555}
+	for rel, want := range modes {
+		fi, err := os.Stat(filepath.Join(out, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("%s: mode %v, want %v", rel, fi.Mode().Perm(), want)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(out, "2024", "empty")); err != nil || !fi.ModTime().Equal(modTime) {
+		t.Errorf("modification time not kept: %v", err)
+	}
+
+	// The existing directory is replaced.
+	os.Chmod(filepath.Join(out, "2024", "nested"), 0755)
+	if err = os.WriteFile(filepath.Join(out, "stale"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.DecryptDir([]byte("secret"), name, out, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(out, "stale")); !os.IsNotExist(err) {
+		t.Error("directory not replaced")
+	}
+	if exists(name) {
+		t.Error("source not removed")
+	}
+	if m := tempDirs(t, parent); len(m) > 0 {
+		t.Errorf("temporary directories left: %v", m)
+	}
+}
+
+func TestDecryptDirDefaultName(t *testing.T) {
+	parent := t.TempDir()
+	name := filepath.Join(parent, "docs."+Extension)
+	encryptArchive(t, name, func(tw *tar.Writer) {
+		tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0600, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("data"))
+	})
+
+	out := filepath.Join(parent, "out")
+	d := NewDecrypter()
+	if err := d.Config(WithOutputDir(out)); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := d.DecryptDir([]byte("secret"), name, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(out, "docs"); dir != want {
+		t.Errorf("extracted into %s, want %s", dir, want)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(b) != "data" {
+		t.Errorf("got %q, %v", b, err)
+	}
+}
+
+func TestDecryptDirUnsafePaths(t *testing.T) {
+	parent := t.TempDir()
+	name := filepath.Join(parent, "evil."+Extension)
+	encryptArchive(t, name, func(tw *tar.Writer) {
+		tw.WriteHeader(&tar.Header{Name: "ok.txt", Mode: 0600, Size: 2, Typeflag: tar.TypeReg})
+		tw.Write([]byte("ok"))
+		tw.WriteHeader(&tar.Header{Name: "../escaped", Mode: 0600, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("evil"))
+		tw.WriteHeader(&tar.Header{Name: "/absolute", Mode: 0600, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("evil"))
+		tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	})
+
+	out := filepath.Join(parent, "out", "evil")
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecrypter()
+	if _, err := d.DecryptDir([]byte("secret"), name, out, false, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got error %v, want kind Invalid", err)
+	}
+	if exists(out) || len(tempDirs(t, filepath.Dir(out))) > 0 {
+		t.Error("files extracted from an unsafe archive")
+	}
+
+	if err := d.Config(SkipUnsafePaths(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DecryptDir([]byte("secret"), name, out, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(out, "ok.txt")); err != nil || string(b) != "ok" {
+		t.Errorf("got %q, %v", b, err)
+	}
+	for _, escaped := range []string{filepath.Join(parent, "out", "escaped"), filepath.Join(out, "absolute"), filepath.Join(out, "link")} {
+		if _, err := os.Lstat(escaped); !os.IsNotExist(err) {
+			t.Errorf("%s extracted", escaped)
+		}
+	}
+}
+
+func TestDecryptDirErrors(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "docs")
+	writeTree(t, dir, map[string]string{"a.txt": string(randomPlaintext(2 * testChunkSize))})
+	name, err := NewEncrypter().EncryptDir([]byte("secret"), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(parent, "out")
+
+	d := NewDecrypter()
+	if _, err = d.DecryptDir([]byte("wrong"), name, out, false, false); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got error %v, want kind WrongPassphrase", err)
+	}
+
+	// A corrupt chunk is detected after the first one was extracted.
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-100] ^= 1
+	corrupt := filepath.Join(parent, "corrupt."+Extension)
+	if err = os.WriteFile(corrupt, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.DecryptDir([]byte("secret"), corrupt, out, false, false); !stderrors.Is(err, &errors.Error{Kind: errors.Ciphertext}) {
+		t.Errorf("corrupt: got error %v, want kind Ciphertext", err)
+	}
+	if exists(out) || len(tempDirs(t, parent)) > 0 {
+		t.Error("files extracted from a corrupt archive")
+	}
+
+	plain, err := NewEncrypter().EncryptFile([]byte("secret"), filepath.Join(dir, "a.txt"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.DecryptDir([]byte("secret"), plain, out, false, false); !errors.Is(errors.Incompatible, err) {
+		t.Errorf("file: got error %v, want kind Incompatible", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = d.DecryptDirContext(ctx, []byte("secret"), name, out, false, false); !errors.Is(errors.Canceled, err) {
+		t.Errorf("canceled: got error %v, want kind Canceled", err)
+	}
+}
+
+// keys returns the keys of m.
+func keys(m map[string]string) []string {
+	var k []string
+	for name := range m {
+		k = append(k, name)
+	}
+	return k
+}
@@ -0,0 +1,144 @@
+package celo
+
+import (
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// FileResult is the result of processing one of the files of a batch.
+type FileResult struct {
+	// Source name of the processed file.
+	Source string
+	// Output name of the file written, empty if Err isn't nil.
+	Output string
+	// Err reason why the file couldn't be processed.
+	Err error
+	// Bytes number of bytes written to Output.
+	Bytes int64
+	// Duration time spent processing the file.
+	Duration time.Duration
+	// Skipped whether the file was skipped because its output already exists
+	// (See CollisionSkip). Err is nil and nothing was written.
+	Skipped bool
+	// PlaintextSHA256 SHA-256 of the plaintext of the file encrypted, nil
+	// unless DigestPlaintext is used.
+	PlaintextSHA256 []byte
+}
+
+// splitResults returns the outputs of the successful results and the errors of
+// the rest, as returned by methods like EncryptMultipleFiles.
+func splitResults(results []FileResult) (outputs []string, errs []error) {
+	errs = []error{}
+	outputs = []string{}
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+		case r.Err != nil:
+			errs = append(errs, r.Err)
+		default:
+			outputs = append(outputs, r.Output)
+		}
+	}
+	return outputs, errs
+}
+
+// batch processes the files of a batch, calling process for the result of each
+// file with the worker w that processes it. The Source of the result is set,
+// process sets the rest of the values except Duration; the error it returns is
+// recorded as Err, and Output and Bytes are cleared.
+// Up to c.workers files are processed concurrently: worker 0 is the instance
+// itself and addWorker is called to create each of the others, once progress
+// reporting is serialized.
+// It returns the result of each file, in the order of the files.
+func (c *celo) batch(sources []string, addWorker func(), process func(w int, r *FileResult) error) []FileResult {
+	n := len(sources)
+	results := make([]FileResult, n)
+
+	run := func(w, i int) {
+		r := &results[i]
+		r.Source = sources[i]
+
+		start := time.Now()
+		if r.Err = process(w, r); r.Err != nil {
+			r.Output, r.Bytes = "", 0
+			// Skipped files aren't failures.
+			if stderrors.Is(r.Err, &errors.Error{Kind: errors.Skipped}) {
+				r.Err, r.Skipped = nil, true
+			}
+		}
+		r.Duration = time.Since(start)
+	}
+
+	workers := c.workers
+	if workers > n {
+		workers = n
+	}
+
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			c.batchProgress(i, n)
+			run(0, i)
+			c.batchFileDone(results[i])
+		}
+		c.batchProgress(n, n)
+		return results
+	}
+
+	// Workers share the ProgressFunc, calls are serialized so it doesn't need
+	// to be safe for concurrent use.
+	if progress := c.progress; progress != nil {
+		var mu sync.Mutex
+		c.progress = func(entity string, done, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress(entity, done, total)
+		}
+		defer func() { c.progress = progress }()
+	}
+
+	for w := 1; w < workers; w++ {
+		addWorker()
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	jobs := make(chan int)
+
+	c.batchProgress(0, n)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range jobs {
+				run(w, i)
+
+				mu.Lock()
+				done++
+				c.batchProgress(done, n)
+				c.batchFileDone(results[i])
+				mu.Unlock()
+			}
+		}(w)
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// batchFileDone reports the result of a file of a batch (See OnFileDone).
+func (c *celo) batchFileDone(r FileResult) {
+	if c.onFileDone != nil {
+		c.onFileDone(r)
+	}
+}
@@ -0,0 +1,184 @@
+package celo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestWithWorkers(t *testing.T) {
+	dir := t.TempDir()
+
+	var names []string
+	for i := 0; i < 10; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file%d", i))
+		names = append(names, name)
+		if i == 3 {
+			// Missing file.
+			continue
+		}
+		if err := os.WriteFile(name, randomPlaintext(i*1000), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var events []progressEvent
+	progress := SetProgress(func(entity string, done, total int64) {
+		// Calls are serialized, TryLock fails if they overlap.
+		if !mu.TryLock() {
+			t.Error("concurrent calls to the ProgressFunc")
+			return
+		}
+		defer mu.Unlock()
+		events = append(events, progressEvent{entity, done, total})
+	})
+
+	e := NewEncrypter()
+	if err := e.Config(WithWorkers(4), progress); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, errs := e.EncryptMultipleFiles([]byte("secret"), names, false, false)
+
+	if len(errs) != 1 || !errors.Is(errors.Encrypt, errs[0]) || errs[0].(*errors.Error).Entity != errors.Entity(names[3]) {
+		t.Fatalf("got errors %v, want an error for %s", errs, names[3])
+	}
+	want := append(append([]string(nil), names[:3]...), names[4:]...)
+	for i := range want {
+		want[i] += "." + Extension
+	}
+	if fmt.Sprint(encrypted) != fmt.Sprint(want) {
+		t.Errorf("got files %v, want %v", encrypted, want)
+	}
+	checkProgress(t, events, encrypted)
+
+	d := NewDecrypter()
+	if err := d.Config(WithWorkers(3)); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, errs := d.DecryptMultipleFiles([]byte("secret"), encrypted, true, false)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for i, name := range decrypted {
+		if name != want[i][:len(want[i])-len(Extension)-1] {
+			t.Errorf("got file %s, want %s without extension", name, want[i])
+		}
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		fmt.Sscanf(filepath.Base(name), "file%d", &n)
+		if !bytes.Equal(got, randomPlaintext(n*1000)) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+
+	if err := NewEncrypter().Config(WithWorkers(0)); !errors.Is(errors.Invalid, err) {
+		t.Errorf("0 workers: got error %v, want kind Invalid", err)
+	}
+}
+
+func TestFileResults(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a"), filepath.Join(dir, "missing"), filepath.Join(dir, "b")}
+	for _, name := range []string{names[0], names[2]} {
+		if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := NewEncrypter().EncryptFiles([]byte("secret"), names, false, false)
+	if len(results) != len(names) {
+		t.Fatalf("got %d results, want %d", len(results), len(names))
+	}
+	for i, r := range results {
+		if r.Source != names[i] {
+			t.Errorf("%d: got source %s, want %s", i, r.Source, names[i])
+		}
+		if r.Duration <= 0 {
+			t.Errorf("%s: duration %v", r.Source, r.Duration)
+		}
+	}
+
+	if r := results[1]; !errors.Is(errors.Encrypt, r.Err) || r.Output != "" || r.Bytes != 0 {
+		t.Errorf("missing file: got %+v, want an error of kind Encrypt", r)
+	}
+	for _, r := range []FileResult{results[0], results[2]} {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		fi, err := os.Stat(r.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Output != r.Source+"."+Extension || r.Bytes != fi.Size() {
+			t.Errorf("got output %s of %d bytes, want %s.%s of %d bytes", r.Output, r.Bytes, r.Source, Extension, fi.Size())
+		}
+	}
+
+	encrypted := []string{results[0].Output, results[2].Output}
+	results = NewDecrypter().DecryptFiles([]byte("other"), encrypted, true, false)
+	for _, r := range results {
+		if !errors.Is(errors.Decrypt, r.Err) || !errors.Is(errors.WrongPassphrase, r.Err.(*errors.Error).Err) {
+			t.Errorf("%s: got error %v, want kind WrongPassphrase", r.Source, r.Err)
+		}
+	}
+
+	results = NewDecrypter().DecryptFiles([]byte("secret"), encrypted, true, false)
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.Source != encrypted[i] || r.Output != names[i*2] || r.Bytes != int64(len("attack at dawn")) {
+			t.Errorf("got %+v", r)
+		}
+	}
+}
+
+func TestOnFileDone(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "missing")}
+	for i := 0; i < 6; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file%d", i))
+		names = append(names, name)
+		if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, workers := range []int{1, 3} {
+		var mu sync.Mutex
+		done := map[string]FileResult{}
+		onDone := OnFileDone(func(r FileResult) {
+			// Calls are serialized, TryLock fails if they overlap.
+			if !mu.TryLock() {
+				t.Error("concurrent calls to the OnFileDone function")
+				return
+			}
+			defer mu.Unlock()
+			done[r.Source] = r
+		})
+
+		e := NewEncrypter()
+		if err := e.Config(WithWorkers(workers), onDone); err != nil {
+			t.Fatal(err)
+		}
+		results := e.EncryptFiles([]byte("secret"), names, true, false)
+
+		if len(done) != len(names) {
+			t.Fatalf("%d workers: got %d files done, want %d", workers, len(done), len(names))
+		}
+		for _, r := range results {
+			if got := done[r.Source]; got.Output != r.Output || (got.Err == nil) != (r.Err == nil) {
+				t.Errorf("%d workers: %s: got %+v, want %+v", workers, r.Source, got, r)
+			}
+		}
+	}
+}
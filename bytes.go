@@ -0,0 +1,52 @@
+package celo
+
+import (
+	"bytes"
+)
+
+// EncryptBytes encrypts plaintext with the key generated from phrase and returns
+// the encoded file: a self-describing blob with the metadata, the recipients
+// section and the ciphertext, that can be stored anywhere, e.g. a config value
+// or a database column, and decrypted with DecryptBytes.
+// Options configure the Encrypter used, e.g. SetPadding or AddRecipient.
+func EncryptBytes(phrase, plaintext []byte, opts ...Option) ([]byte, error) {
+	e := NewEncrypter()
+	defer e.Wipe()
+	if err := e.Config(opts...); err != nil {
+		return nil, err
+	}
+	return encryptBytes(e, phrase, plaintext)
+}
+
+// DecryptBytes decrypts a blob returned by EncryptBytes, or the content of any
+// file encrypted by Celo, with the key generated from phrase.
+// Options configure the Decrypter used, e.g. VerifyWith.
+func DecryptBytes(phrase, blob []byte, opts ...Option) ([]byte, error) {
+	d := NewDecrypter()
+	defer d.Wipe()
+	if err := d.Config(opts...); err != nil {
+		return nil, err
+	}
+	return decryptBytes(d, phrase, blob)
+}
+
+// encryptBytes encrypts plaintext with e and returns the encoded file.
+func encryptBytes(e *Encrypter, phrase, plaintext []byte) ([]byte, error) {
+	if _, err := e.Encrypt(phrase, plaintext); err != nil {
+		return nil, err
+	}
+
+	b := bytes.NewBuffer(make([]byte, 0, e.encodedSize()))
+	if _, err := e.Write(b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decryptBytes decodes the encoded file blob with d and decrypts it.
+func decryptBytes(d *Decrypter, phrase, blob []byte) ([]byte, error) {
+	if _, err := d.Read(bytes.NewReader(blob)); err != nil {
+		return nil, err
+	}
+	return d.Decrypt(phrase)
+}
@@ -1,8 +1,15 @@
 package celo
 
 import (
+	"context"
+	"crypto/hmac"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
 )
 
 // Default Celo configuration values.
@@ -19,13 +26,35 @@ const (
 	// AES GCM.
 	NonceSize = 12
 
+	// Aes128BlockSize block size of the AES 128 cipher, the smallest supported
+	// by Celo.
+	Aes128BlockSize = 16
+
+	// MinSaltSize and MaxSaltSize boundaries of the salt size.
+	MinSaltSize = 16
+	MaxSaltSize = 64
+
+	// MinNonceSize and MaxNonceSize boundaries of the nonce size.
+	MinNonceSize = NonceSize
+	MaxNonceSize = 32
+
 	// Extension extension used when creating encrypted files by Celo.
 	//  - secrets.txt -> secrets.txt.celo
 	Extension = "celo"
 
+	// EncryptedFileMode permissions of the files created by EncryptFile.
+	EncryptedFileMode os.FileMode = 0644
+
+	// DecryptedFileMode permissions of the files created by DecryptFile, only
+	// the owner can read the plaintext.
+	DecryptedFileMode os.FileMode = 0600
+
 	// Version current version of Celo. Version value will be attached to the
 	// file signature if a file is created. (See Encrypter.Encode).
-	Version = 1
+	//  - 1: Initial format.
+	//  - 2: Reserved bytes of the file signature contain the padding scheme
+	//       and format flags such as envelope encryption.
+	Version = 2
 )
 
 // Supported versions.
@@ -35,7 +64,7 @@ const (
 	MinVersion byte = 1
 	// MaxVersion maximum encrypted file version supported by the decoder of the
 	// running version of Celo.
-	MaxVersion byte = 1
+	MaxVersion byte = 2
 )
 
 // Option type for a functional configuration approach.
@@ -49,6 +78,361 @@ func SetExtension(ext string) Option {
 	}
 }
 
+// SetPadding sets the padding scheme applied to the plaintext before
+// encryption. Decrypter ignores it since the scheme is read from the file
+// signature.
+func SetPadding(p Padding) Option {
+	return func(c *celo) error {
+		if !p.IsValid() {
+			return errors.E(errors.Padding, errors.Op("celo.SetPadding"))
+		}
+		c.padding = p
+		return nil
+	}
+}
+
+// SetSaltSize sets the size of the salt used to generate keys from phrases.
+// Decrypter ignores it since the size is read from the file signature.
+// It returns an error if the size isn't between MinSaltSize and MaxSaltSize.
+func SetSaltSize(size int) Option {
+	return func(c *celo) error {
+		if size < MinSaltSize || size > MaxSaltSize {
+			return errors.E(errors.SaltSize, errors.Op("celo.SetSaltSize"),
+				errors.Errorf("%d isn't between %d and %d", size, MinSaltSize, MaxSaltSize))
+		}
+		c.saltSize = size
+		return nil
+	}
+}
+
+// SetNonceSize sets the size of the AES GCM nonces.
+// Decrypter ignores it since the size is read from the file signature.
+// It returns an error if the size isn't between MinNonceSize and MaxNonceSize.
+func SetNonceSize(size int) Option {
+	return func(c *celo) error {
+		if size < MinNonceSize || size > MaxNonceSize {
+			return errors.E(errors.NonceSize, errors.Op("celo.SetNonceSize"),
+				errors.Errorf("%d isn't between %d and %d", size, MinNonceSize, MaxNonceSize))
+		}
+		c.nonceSize = size
+		return nil
+	}
+}
+
+// SetBlockSize sets the size of the AES keys, Aes128BlockSize or
+// Aes256BlockSize.
+// Decrypter ignores it since the size is read from the file signature.
+func SetBlockSize(size int) Option {
+	return func(c *celo) error {
+		if size != Aes128BlockSize && size != Aes256BlockSize {
+			return errors.E(errors.BlockSize, errors.Op("celo.SetBlockSize"),
+				errors.Errorf("%d isn't %d or %d", size, Aes128BlockSize, Aes256BlockSize))
+		}
+		c.blockSize = size
+		return nil
+	}
+}
+
+// AddRecipient wraps the data key of encrypted files for r in addition to the
+// secret phrase, so they can be decrypted by any of them.
+// Decrypter ignores it.
+func AddRecipient(r Recipient) Option {
+	return func(c *celo) error {
+		if r == nil {
+			return errors.E(errors.Invalid, errors.Op("celo.AddRecipient"))
+		}
+		c.recipients = append(c.recipients, r)
+		return nil
+	}
+}
+
+// AddIdentity tries id to unwrap the data key of encrypted files in addition to
+// the secret phrase.
+// Encrypter ignores it.
+func AddIdentity(id Identity) Option {
+	return func(c *celo) error {
+		if id == nil {
+			return errors.E(errors.Invalid, errors.Op("celo.AddIdentity"))
+		}
+		c.identities = append(c.identities, id)
+		return nil
+	}
+}
+
+// SignWith signs encrypted files with k, so recipients can verify who produced
+// them.
+// Decrypter ignores it.
+func SignWith(k *SigningKey) Option {
+	return func(c *celo) error {
+		if k == nil {
+			return errors.E(errors.Invalid, errors.Op("celo.SignWith"))
+		}
+		c.signingKey = k
+		return nil
+	}
+}
+
+// VerifyWith requires decrypted files to be signed by k.
+// Signatures are always verified, but without this option any signer is
+// accepted.
+// Encrypter ignores it.
+func VerifyWith(k *VerifyingKey) Option {
+	return func(c *celo) error {
+		if k == nil {
+			return errors.E(errors.Invalid, errors.Op("celo.VerifyWith"))
+		}
+		c.verifyingKey = k
+		return nil
+	}
+}
+
+// SetProgress calls f while files are read and written, and between the files
+// of batch methods (See ProgressFunc).
+func SetProgress(f ProgressFunc) Option {
+	return func(c *celo) error {
+		c.progress = f
+		return nil
+	}
+}
+
+// LimitRate limits the throughput of the files read and written by the
+// instance, its clones and workers combined, to bytesPerSecond, so large
+// operations don't saturate shared disks or network file systems.
+// 0 removes the limit, the default. It returns an error if bytesPerSecond is
+// negative.
+func LimitRate(bytesPerSecond int64) Option {
+	return func(c *celo) error {
+		if bytesPerSecond < 0 {
+			return errors.E(errors.Invalid, errors.Op("celo.LimitRate"),
+				errors.Errorf("rate of %d bytes per second", bytesPerSecond))
+		}
+		c.limiter = nil
+		if bytesPerSecond > 0 {
+			c.limiter = newRateLimiter(bytesPerSecond)
+		}
+		return nil
+	}
+}
+
+// PreserveKey reuses the key generated from the secret phrase, along with its
+// salt, for every file encrypted with the same phrase, so batches of files
+// don't run the key derivation for each file. Encrypted files share the salt,
+// but every file still gets its own random data key.
+// Decrypter ignores it since it reuses keys whenever the phrase and salt match.
+func PreserveKey(preserve bool) Option {
+	return func(c *celo) error {
+		c.preserveKey = preserve
+		return nil
+	}
+}
+
+// WithKeyCache shares the keys generated from secret phrases through k, so
+// instances that share it don't run the key derivation again for the same
+// phrase and salt: a Decrypter reuses the keys generated by any of them, and
+// an Encrypter with PreserveKey reuses the last key generated for the same
+// phrase. Keys are only cached while they don't expire (See NewKeyCache).
+// Wipe doesn't clear k, Clear does. A nil k disables the cache.
+func WithKeyCache(k *KeyCache) Option {
+	return func(c *celo) error {
+		c.keys = k
+		c.sharedKeys = true
+		return nil
+	}
+}
+
+// WithLogger records what the instance does in l: files opened, keys derived,
+// files written and sources removed. Nothing is recorded by default.
+// Secret phrases, keys and plaintexts are never recorded.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *celo) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// KeyDeriver derives a key of size bytes from a secret phrase and a salt with
+// the parameters p, as KDFParams.KeyContext does, e.g. by asking an agent that
+// caches the keys. It must return the same key KDFParams.Key would, otherwise
+// files can't be decrypted without it.
+type KeyDeriver func(ctx context.Context, secretPhrase, salt []byte, p KDFParams, size uint32) ([]byte, error)
+
+// WithKeyDeriver derives the keys of secret phrases with f instead of
+// KDFParams.KeyContext. A nil f restores the default.
+// Keys are still cached by the instance (See WithKeyCache), f is only called
+// when a key isn't cached.
+func WithKeyDeriver(f KeyDeriver) Option {
+	return func(c *celo) error {
+		c.deriveKey = f
+		return nil
+	}
+}
+
+// SetKDFParams derives the keys of the phrase stanzas of the files encrypted
+// with the argon2id parameters p instead of the DefaultKDFParams. The
+// parameters are recorded in the files, so they don't need to be known to
+// decrypt them. Decrypter ignores it.
+// It returns an error of kind errors.Invalid if p is out of bounds (See
+// KDFParams.Validate).
+func SetKDFParams(p KDFParams) Option {
+	return func(c *celo) error {
+		if err := p.Validate(); err != nil {
+			return errors.E(errors.Op("celo.SetKDFParams"), err)
+		}
+		c.kdf = p
+		return nil
+	}
+}
+
+// WithMetrics reports the files processed, the key derivations and the time
+// spent by the cipher to m (See Metrics).
+func WithMetrics(m Metrics) Option {
+	return func(c *celo) error {
+		c.metrics = m
+		return nil
+	}
+}
+
+// PreserveTimes makes EncryptFile, DecryptFile and their batch counterparts
+// give the file created the modification time of its source, so backup and
+// sync tools don't see the files as modified. Since encrypted files keep the
+// time of their plaintext, decrypting them restores it.
+func PreserveTimes(on bool) Option {
+	return func(c *celo) error {
+		c.preserveTimes = on
+		return nil
+	}
+}
+
+// DigestPlaintext makes EncryptFile and its batch counterparts compute the
+// SHA-256 of the plaintext of each file as it is encrypted (See
+// Encrypter.PlaintextSHA256 and FileResult.PlaintextSHA256), e.g. to record
+// it in a manifest. Decrypter ignores it.
+func DigestPlaintext(on bool) Option {
+	return func(c *celo) error {
+		c.digestPlaintext = on
+		return nil
+	}
+}
+
+// OnFileDone calls f with the result of each file of a batch, such as
+// EncryptFiles or DecryptFiles, as soon as it is processed, e.g. to record
+// the files done by a batch that might be interrupted. Calls are serialized
+// but they don't follow the order of the files when WithWorkers is used.
+func OnFileDone(f func(FileResult)) Option {
+	return func(c *celo) error {
+		c.onFileDone = f
+		return nil
+	}
+}
+
+// OnCollision sets what to do when a file created by EncryptFile or
+// DecryptFile already exists and overwrite is false, CollisionFail by default
+// (See Collision).
+func OnCollision(c Collision) Option {
+	return func(cc *celo) error {
+		if !c.IsValid() {
+			return errors.E(errors.Invalid, errors.Op("celo.OnCollision"),
+				errors.Errorf("unknown collision strategy %d", c))
+		}
+		cc.collision = c
+		return nil
+	}
+}
+
+// WithAAD binds the encrypted files to aad, additional data that is
+// authenticated along with the content but isn't stored in the file, e.g. a
+// record ID or a tenant name. A file encrypted with aad can only be decrypted
+// with the same aad, decryption fails with an error of kind errors.Ciphertext
+// otherwise. Files of version 1 don't support it, aad is ignored to decrypt
+// them.
+func WithAAD(aad []byte) Option {
+	return func(c *celo) error {
+		c.aad = append([]byte(nil), aad...)
+		return nil
+	}
+}
+
+// WithOutputDir writes the files created by EncryptFile and DecryptFile, and
+// their batch counterparts, to dir instead of the directory of their source.
+// The directory is created if it doesn't exist.
+func WithOutputDir(dir string) Option {
+	return func(c *celo) error {
+		c.outputDir = dir
+		return nil
+	}
+}
+
+// ShredSource makes the source files removed by EncryptFile, DecryptFile,
+// DecryptDir and their batch counterparts be overwritten with random data
+// passes times and truncated before they are removed (See file.Shred), as a
+// best effort on file systems that don't copy on write. 0 removes them
+// without overwriting them, as by default.
+// It returns an error if passes is negative.
+func ShredSource(passes int) Option {
+	return func(c *celo) error {
+		if passes < 0 {
+			return errors.E(errors.Invalid, errors.Op("celo.ShredSource"),
+				errors.Errorf("%d shred passes", passes))
+		}
+		c.shredPasses = passes
+		return nil
+	}
+}
+
+// SkipLocks makes EncryptFile, DecryptFile and their batch counterparts
+// process files without locking them. By default the source is locked while
+// it is processed, exclusively if it is removed afterwards, and an existing
+// output isn't replaced while another process holds a lock on it (See
+// file.Lock), so concurrent celo processes can't modify or remove a file that
+// is being processed; these operations fail with an error of kind
+// errors.Locked instead.
+func SkipLocks(skip bool) Option {
+	return func(c *celo) error {
+		c.skipLocks = skip
+		return nil
+	}
+}
+
+// SkipUnsafePaths makes DecryptDir skip the entries of an archive whose path
+// isn't local to it, e.g. ../../.bashrc or an absolute path, instead of
+// failing with an error of kind errors.Invalid. They are never extracted.
+func SkipUnsafePaths(skip bool) Option {
+	return func(c *celo) error {
+		c.skipUnsafePaths = skip
+		return nil
+	}
+}
+
+// SetFileMode sets the permissions of the files created by EncryptFile and
+// DecryptFile. Encrypted files are created with EncryptedFileMode and decrypted
+// files with DecryptedFileMode by default.
+// It returns an error if mode has bits other than the permission bits.
+func SetFileMode(mode os.FileMode) Option {
+	return func(c *celo) error {
+		if mode&^os.ModePerm != 0 {
+			return errors.E(errors.Invalid, errors.Op("celo.SetFileMode"),
+				errors.Errorf("%v isn't a permission mode", mode))
+		}
+		c.fileMode = mode
+		return nil
+	}
+}
+
+// WithWorkers sets the number of files processed concurrently by batch methods
+// such as EncryptMultipleFiles, 1 by default. Each worker uses its own clone of
+// the instance and results keep the order of the files.
+// It returns an error if n is lower than 1.
+func WithWorkers(n int) Option {
+	return func(c *celo) error {
+		if n < 1 {
+			return errors.E(errors.Invalid, errors.Op("celo.WithWorkers"),
+				errors.Errorf("%d workers", n))
+		}
+		c.workers = n
+		return nil
+	}
+}
+
 // celo base struct that contains principal components to the functionality of
 // celo. This is later extended by Encrypter and Decrypter.
 type celo struct {
@@ -66,15 +450,116 @@ type celo struct {
 	nonce      []byte
 	ciphertext []byte
 
+	// stanzas the data key wrapped for each recipient of the file.
+	stanzas []*Stanza
+
+	// trailer checksum of the payload (See TrailerSize).
+	trailer []byte
+
 	// cipher is a cipher that can be (not necessarily) used to encrypt multiple
 	// files with the same key.
 	cipher *Cipher
 
+	// keyDigest identifies the phrase and salt the key of cipher was generated
+	// from (See keyMatches).
+	keyDigest []byte
+
+	// keys generated from phrases by Decrypter, shared by its clones, or by
+	// any instance when it was set with WithKeyCache.
+	keys *KeyCache
+
+	// sharedKeys flag that indicates if keys was set with WithKeyCache, Wipe
+	// doesn't clear it.
+	sharedKeys bool
+
 	// ext is the extension to be attached to encrypted files.
 	ext string
 
-	// preserveKey flag that indicates if the the key will be reused for to
-	// encrypt / decrypt multiple files.
+	// padding scheme applied to the plaintext before encryption.
+	padding Padding
+
+	// fileMode permissions of the files created by EncryptFile and
+	// DecryptFile.
+	fileMode os.FileMode
+
+	// collision strategy applied when an output file already exists.
+	collision Collision
+
+	// outputDir directory of the files created by EncryptFile and DecryptFile,
+	// the directory of the source if it is empty.
+	outputDir string
+
+	// shredPasses number of times removed sources are overwritten before
+	// they are removed (See ShredSource).
+	shredPasses int
+
+	// skipLocks whether files are processed without locking them (See
+	// SkipLocks).
+	skipLocks bool
+
+	// skipUnsafePaths whether archive entries with unsafe paths are skipped
+	// instead of failing the extraction (See SkipUnsafePaths).
+	skipUnsafePaths bool
+
+	// aad additional data authenticated along with the payload (See WithAAD).
+	aad []byte
+
+	// recipients that the data key is wrapped for in addition to the secret
+	// phrase.
+	recipients []Recipient
+
+	// identities used to unwrap the data key in addition to the secret phrase.
+	identities []Identity
+
+	// signingKey signs encrypted files when it isn't nil.
+	signingKey *SigningKey
+
+	// verifyingKey when it isn't nil, decrypted files must be signed by it.
+	verifyingKey *VerifyingKey
+
+	// progress reports the progress of file operations when it isn't nil.
+	progress ProgressFunc
+
+	// limiter limits the throughput of file operations when it isn't nil,
+	// shared by clones (See LimitRate).
+	limiter *rateLimiter
+
+	// logger records the events of file operations when it isn't nil.
+	logger *slog.Logger
+
+	// metrics receives the measurements of file operations when it isn't nil.
+	metrics Metrics
+
+	// preserveTimes whether the files created get the modification time of
+	// their source (See PreserveTimes).
+	preserveTimes bool
+
+	// digestPlaintext whether the SHA-256 of the plaintext of the files
+	// encrypted is computed (See DigestPlaintext).
+	digestPlaintext bool
+
+	// plaintextSum SHA-256 of the plaintext of the last file encrypted when
+	// digestPlaintext is on.
+	plaintextSum []byte
+
+	// onFileDone is called with the result of each file of a batch when it
+	// isn't nil (See OnFileDone).
+	onFileDone func(FileResult)
+
+	// deriveKey derives the keys of secret phrases when it isn't nil,
+	// KDFParams.KeyContext does otherwise.
+	deriveKey KeyDeriver
+
+	// kdf parameters of the key derivation of the secret phrase: the ones
+	// set with SetKDFParams when encrypting, the ones recorded in the phrase
+	// stanza being unwrapped when decrypting.
+	kdf KDFParams
+
+	// workers number of files processed concurrently by batch methods.
+	workers int
+
+	// preserveKey flag that indicates if the the key will be reused to encrypt
+	// multiple files with the same phrase (See PreserveKey).
 	preserveKey bool
 
 	// flag that states whether the instance has been initialized and it is ready
@@ -82,6 +567,15 @@ type celo struct {
 	initialized bool
 }
 
+// generateKey derives the key of secretPhrase and salt with the key derivation
+// parameters of the instance for its cipher (See WithKeyDeriver).
+func (c *celo) generateKey(ctx context.Context, secretPhrase, salt []byte) ([]byte, error) {
+	if c.deriveKey != nil {
+		return c.deriveKey(ctx, secretPhrase, salt, c.kdf, uint32(c.blockSize))
+	}
+	return c.kdf.KeyContext(ctx, secretPhrase, salt, uint32(c.blockSize))
+}
+
 // Nonce nonce used at encryption.
 func (c *celo) Nonce() []byte {
 	return c.nonce
@@ -112,27 +606,165 @@ func (c *celo) IsReady() bool {
 	return c.initialized
 }
 
-// Wipe dereference stored values.
+// clone returns a copy of c that shares its configuration and the key
+// generated from the secret phrase (salt and cipher), but not the values of the
+// last file encrypted or decoded.
+// The cipher is safe to share since AES GCM doesn't keep state between
+// operations.
+func (c *celo) clone() celo {
+	cc := *c
+
+	cc.nonce = nil
+	cc.ciphertext = nil
+	cc.stanzas = nil
+	cc.trailer = nil
+	cc.plaintextSum = nil
+	cc.initialized = false
+
+	// Wipe zeroes these values, they can't share the backing arrays.
+	cc.salt = append([]byte(nil), c.salt...)
+	cc.keyDigest = append([]byte(nil), c.keyDigest...)
+
+	// Options append to these lists, they can't share the backing arrays.
+	cc.recipients = append([]Recipient(nil), c.recipients...)
+	cc.identities = append([]Identity(nil), c.identities...)
+
+	return cc
+}
+
+// setCipher references cipher, created with the key generated from the secret
+// phrase and the salt of the instance with its key derivation parameters.
+func (c *celo) setCipher(cipher *Cipher, secretPhrase []byte) {
+	c.cipher = cipher
+	c.keyDigest = keyDigest(secretPhrase, c.salt, c.kdf)
+}
+
+// keyMatches reports whether the cipher of the instance was created with the
+// key generated from the secret phrase and the salt of the instance with its
+// key derivation parameters, so it can be reused instead of generating the key
+// again.
+func (c *celo) keyMatches(secretPhrase []byte) bool {
+	return c.cipher != nil && hmac.Equal(c.keyDigest, keyDigest(secretPhrase, c.salt, c.kdf))
+}
+
+// Wipe zeroes and dereference stored values.
 // It sets the instance as not initialized. (Not ready).
+// The key referenced by the cipher can't be zeroed, it is released along with
+// the cipher.
 func (c *celo) Wipe() {
+	ZeroBytes(c.salt, c.nonce, c.keyDigest)
+
 	c.nonce = nil
 	c.ciphertext = nil
+	c.stanzas = nil
+	c.trailer = nil
+	c.plaintextSum = nil
 
 	// A new salt will be generated if the same instance requires it. This means
 	// that the generated key will be totally different.
 	c.salt = nil
 	// Since salt will change, cipher is no longer valid.
 	c.cipher = nil
+	c.keyDigest = nil
+	// Clones share the keys, they are forgotten by all of them. A cache set
+	// with WithKeyCache is cleared by its owner.
+	if !c.sharedKeys {
+		c.keys.Clear()
+	}
 
 	// Mark the celo instance as not initialized so that values are regenerated.
 	c.initialized = false
 }
 
+// additionalData returns the additional data authenticated along with the
+// payload of a file with the metadata m: the file signature followed by the
+// data passed to WithAAD.
+func (c *celo) additionalData(m *Metadata) []byte {
+	return append(m.Bytes(), c.aad...)
+}
+
+// outputName returns the name of the file created from a source, placed in
+// the output directory if one was set (See WithOutputDir). The directory is
+// created if it doesn't exist.
+func (c *celo) outputName(name string) (string, error) {
+	if c.outputDir == "" {
+		return name, nil
+	}
+
+	if err := os.MkdirAll(c.outputDir, 0755); err != nil {
+		return "", errors.E(errors.Create, errors.Op("celo.outputName"), err)
+	}
+
+	return c.outputPath(name), nil
+}
+
+// outputPath is outputName without creating the output directory.
+func (c *celo) outputPath(name string) string {
+	if c.outputDir == "" {
+		return name
+	}
+	return filepath.Join(c.outputDir, filepath.Base(name))
+}
+
+// checkOutput returns an error of kind errors.Invalid if the output file is
+// the source itself, it would be replaced.
+func checkOutput(op errors.Op, source *os.File, output string) error {
+	sfi, err := source.Stat()
+	if err != nil {
+		return nil
+	}
+	if ofi, err := os.Stat(output); err == nil && os.SameFile(sfi, ofi) {
+		return errors.E(errors.Invalid, op, errors.Errorf("the output file is the source file"))
+	}
+	return nil
+}
+
+// lockFiles locks the source file, exclusively if it is removed afterwards,
+// and the output file exclusively if it exists, unless SkipLocks was used
+// (See file.Lock). The output stays locked until it is replaced, so no other
+// process locks or writes it between the check and the commit.
+// It returns the function that releases both locks.
+func (c *celo) lockFiles(op errors.Op, source *os.File, output string, removeSource bool) (unlock func(), err error) {
+	if c.skipLocks {
+		return func() {}, nil
+	}
+
+	release, err := file.Lock(source, removeSource)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	releaseOutput, err := file.LockName(output)
+	if err != nil {
+		release()
+		return nil, errors.E(op, err)
+	}
+	return func() {
+		releaseOutput()
+		release()
+	}, nil
+}
+
+// ZeroBytes overwrites the content of every slice with zeros, so secrets such
+// as phrases and keys don't linger in memory once they aren't needed.
+func ZeroBytes(bs ...[]byte) {
+	for _, b := range bs {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+}
+
 // GetEncryptedFileName returns the potential file name after being encrypted.
 func (c *celo) GetEncryptedFileName(f *os.File) string {
+	return c.encryptedName(f.Name())
+}
+
+// encryptedName returns the potential name of the file name after being
+// encrypted.
+func (c *celo) encryptedName(name string) string {
 	if c.ext == "" {
 		// No extension, return the original file name.
-		return f.Name()
+		return name
 	}
 
 	ext := c.ext
@@ -142,14 +774,20 @@ func (c *celo) GetEncryptedFileName(f *os.File) string {
 		ext = "." + ext
 	}
 
-	return f.Name() + ext
+	return name + ext
 }
 
 // GetDecryptedFileName returns the potential file name after being decrypted.
 func (c *celo) GetDecryptedFileName(f *os.File) string {
+	return c.decryptedName(f.Name())
+}
+
+// decryptedName returns the potential name of the file name after being
+// decrypted.
+func (c *celo) decryptedName(name string) string {
 	if c.ext == "" {
 		// No extension, return the original file name.
-		return f.Name()
+		return name
 	}
 
 	ext := c.ext
@@ -159,8 +797,6 @@ func (c *celo) GetDecryptedFileName(f *os.File) string {
 		ext = "." + ext
 	}
 
-	name := f.Name()
-
 	if strings.HasSuffix(name, ext) && name != ext {
 		// Remove the extension only if the file name contains it and if it does
 		// not represent the whole name of the file.
@@ -171,8 +807,21 @@ func (c *celo) GetDecryptedFileName(f *os.File) string {
 }
 
 // Config applies custom configurations.
-func (c *celo) Config(opts ...Option) {
+// It stops and returns the error of the first option that fails, the options
+// that precede it are already applied.
+func (c *celo) Config(opts ...Option) error {
 	for _, opt := range opts {
-		opt(c)
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkContext returns an error of kind errors.Canceled if ctx is done.
+func checkContext(ctx context.Context, op errors.Op) error {
+	if err := ctx.Err(); err != nil {
+		return errors.E(errors.Canceled, op, err)
 	}
+	return nil
 }
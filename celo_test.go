@@ -0,0 +1,30 @@
+package celo
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sealFile encrypts plaintext with e and returns the encoded file.
+func sealFile(t *testing.T, e *Encrypter, secretPhrase, plaintext []byte) []byte {
+	t.Helper()
+
+	if _, err := e.Encrypt(secretPhrase, plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	b := new(bytes.Buffer)
+	if _, err := e.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+// openFile decodes the encoded file with d and decrypts it.
+func openFile(d *Decrypter, secretPhrase, file []byte) ([]byte, error) {
+	if _, err := d.Read(bytes.NewReader(file)); err != nil {
+		return nil, err
+	}
+	return d.Decrypt(secretPhrase)
+}
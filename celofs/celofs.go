@@ -0,0 +1,213 @@
+// Package celofs implements a read-only fs.FS over a directory of files
+// encrypted by celo, so encrypted assets can be served or parsed by any
+// fs.FS consumer (http.FS, template.ParseFS, etc.).
+//
+// Encrypted files are listed without their extension and decrypted when they
+// are opened:
+//  assets/index.html.celo  <- fsys.Open("index.html")
+// Files without the extension are hidden.
+package celofs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// ext suffix of the encrypted files.
+const ext = "." + celo.Extension
+
+// FS is a read-only fs.FS of the decrypted content of a directory.
+// It is safe for concurrent use.
+type FS struct {
+	dir    string
+	phrase []byte
+}
+
+// New returns an fs.FS over the directory dir that decrypts files with the
+// secret phrase. The phrase is copied.
+func New(dir string, phrase []byte) fs.FS {
+	return &FS{dir: dir, phrase: append([]byte(nil), phrase...)}
+}
+
+// Open opens the named file. Files are decrypted completely in memory, an
+// error is returned if the file can't be decrypted.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	fi, err := os.Stat(fsys.path(name))
+	if err == nil && fi.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dir{info: &fileInfo{FileInfo: fi, name: path.Base(name)}, entries: entries}, nil
+	}
+
+	plaintext, info, err := fsys.decrypt(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{Reader: bytes.NewReader(plaintext), info: info}, nil
+}
+
+// ReadDir reads the named directory and returns a list of directory entries
+// sorted by file name. Encrypted files are listed without their extension.
+// Calling Info on the entry of a file decrypts it to get its size.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entries, err := os.ReadDir(fsys.path(name))
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	dirs := map[string]bool{}
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs[e.Name()] = true
+		}
+	}
+
+	list := []fs.DirEntry{}
+	for _, e := range entries {
+		base := strings.TrimSuffix(e.Name(), ext)
+		switch {
+		case e.IsDir():
+			list = append(list, e)
+		case !e.Type().IsRegular(), base == e.Name(), base == "", dirs[base]:
+			// Not an encrypted file, or shadowed by a directory with the same
+			// name.
+		default:
+			list = append(list, &dirEntry{fsys: fsys, name: path.Join(name, base)})
+		}
+	}
+
+	// Trimming the extension can change the order of the names.
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+
+	return list, nil
+}
+
+// path returns the path of the OS file system of the named file.
+func (fsys *FS) path(name string) string {
+	return filepath.Join(fsys.dir, filepath.FromSlash(name))
+}
+
+// decrypt decrypts the named file.
+func (fsys *FS) decrypt(name string) (plaintext []byte, info fs.FileInfo, err error) {
+	f, err := os.Open(fsys.path(name) + ext)
+	if err != nil {
+		return nil, nil, pathError("open", name, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, pathError("open", name, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	d := celo.NewDecrypter()
+	if _, err = d.Read(f); err == nil {
+		plaintext, err = d.Decrypt(fsys.phrase)
+	}
+	if err != nil {
+		return nil, nil, pathError("open", name, err)
+	}
+
+	return plaintext, &fileInfo{FileInfo: fi, name: path.Base(name), size: int64(len(plaintext))}, nil
+}
+
+// pathError returns err as an error of the named file, replacing the path of
+// the OS file system.
+func pathError(op, name string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// fileInfo describes a file of an FS by its name and decrypted size.
+type fileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+
+func (fi *fileInfo) Size() int64 {
+	if fi.IsDir() {
+		return fi.FileInfo.Size()
+	}
+	return fi.size
+}
+
+// dirEntry is the entry of an encrypted file.
+type dirEntry struct {
+	fsys *FS
+	name string
+}
+
+func (e *dirEntry) Name() string      { return path.Base(e.name) }
+func (e *dirEntry) IsDir() bool       { return false }
+func (e *dirEntry) Type() fs.FileMode { return 0 }
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	_, info, err := e.fsys.decrypt(e.name)
+	return info, err
+}
+
+// file is an open decrypted file.
+type file struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is an open directory.
+type dir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.E(errors.IsDir, errors.Op("celofs.Read"))}
+}
+
+// ReadDir returns the next n entries of the directory (See fs.ReadDirFile).
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,103 @@
+package celofs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// encryptTo writes plaintext encrypted with phrase to the file name.
+func encryptTo(t *testing.T, phrase []byte, name, plaintext string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(plaintext), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := celo.NewEncrypter().EncryptFile(phrase, name, false, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	phrase := []byte("secret")
+
+	encryptTo(t, phrase, filepath.Join(dir, "notes.txt"), "attack at dawn")
+	encryptTo(t, phrase, filepath.Join(dir, "a-b.txt"), "sorted")
+	encryptTo(t, phrase, filepath.Join(dir, "docs", "draft.txt"), "book draft")
+	encryptTo(t, phrase, filepath.Join(dir, "docs", "empty"), "")
+	if err := os.WriteFile(filepath.Join(dir, "plain.txt"), []byte("hidden"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := New(dir, phrase)
+	if err := fstest.TestFS(fsys, "notes.txt", "a-b.txt", "docs/draft.txt", "docs/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fs.ReadFile(fsys, "docs/draft.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "book draft" {
+		t.Errorf("got %q, want %q", b, "book draft")
+	}
+
+	// Only encrypted files are listed.
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"a-b.txt", "docs", "notes.txt"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("got entries %v, want %v", names, want)
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	dir := t.TempDir()
+	encryptTo(t, []byte("secret"), filepath.Join(dir, "notes.txt"), "attack at dawn")
+	if err := os.WriteFile(filepath.Join(dir, "plain.txt"), []byte("hidden"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := New(dir, []byte("secret"))
+	for _, name := range []string{"missing.txt", "plain.txt", "notes.txt.celo"} {
+		if _, err := fsys.Open(name); !os.IsNotExist(err) {
+			t.Errorf("%s: got error %v, want not exist", name, err)
+		}
+	}
+	if _, err := fsys.Open("../notes.txt"); err == nil {
+		t.Error("invalid path: opened")
+	}
+
+	// The file can't be decrypted with another phrase.
+	_, err := New(dir, []byte("other")).Open("notes.txt")
+	pe, ok := err.(*fs.PathError)
+	if !ok || pe.Path != "notes.txt" || !errors.Is(errors.WrongPassphrase, pe.Err) {
+		t.Errorf("wrong phrase: got error %v, want kind WrongPassphrase", err)
+	}
+
+	// Reading a directory fails.
+	d, err := fsys.Open(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err = d.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("read directory: got error %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Service of celo daemon, which encrypts, decrypts and inspects files for
+// long-running services over gRPC.
+//
+// Generated code: daemon.pb.go and daemon_grpc.pb.go, with protoc-gen-go and
+// protoc-gen-go-grpc (See generate.go).
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: daemon.proto
+
+package celopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Daemon_CreateSession_FullMethodName = "/celo.v1.Daemon/CreateSession"
+	Daemon_CloseSession_FullMethodName  = "/celo.v1.Daemon/CloseSession"
+	Daemon_Encrypt_FullMethodName       = "/celo.v1.Daemon/Encrypt"
+	Daemon_Decrypt_FullMethodName       = "/celo.v1.Daemon/Decrypt"
+	Daemon_Inspect_FullMethodName       = "/celo.v1.Daemon/Inspect"
+)
+
+// DaemonClient is the client API for Daemon service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Daemon encrypts, decrypts and inspects the files streamed to it.
+//
+// Calls are authenticated with the token of the daemon, sent as the
+// "authorization: Bearer TOKEN" metadata. Encrypt and Decrypt use the phrase
+// of a session, created with CreateSession: the keys derived from it are
+// kept by the session, so the files that share a key aren't derived again.
+type DaemonClient interface {
+	// CreateSession starts a session with a phrase, or the one the daemon was
+	// started with.
+	CreateSession(ctx context.Context, in *CreateSessionRequest, opts ...grpc.CallOption) (*Session, error)
+	// CloseSession ends a session, forgetting its phrase and its keys.
+	CloseSession(ctx context.Context, in *CloseSessionRequest, opts ...grpc.CallOption) (*CloseSessionResponse, error)
+	// Encrypt encrypts the content streamed by the client and streams the
+	// encrypted file back as it is encrypted. The first message names the
+	// session and the options.
+	Encrypt(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EncryptRequest, Chunk], error)
+	// Decrypt decrypts the encrypted file streamed by the client and streams
+	// its content back, each part once it was authenticated. The first
+	// message names the session.
+	Decrypt(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[DecryptRequest, Chunk], error)
+	// Inspect returns the details of the encrypted file streamed by the
+	// client, such as its format version. No session is required.
+	Inspect(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Chunk, FileInfo], error)
+}
+
+type daemonClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDaemonClient(cc grpc.ClientConnInterface) DaemonClient {
+	return &daemonClient{cc}
+}
+
+func (c *daemonClient) CreateSession(ctx context.Context, in *CreateSessionRequest, opts ...grpc.CallOption) (*Session, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Session)
+	err := c.cc.Invoke(ctx, Daemon_CreateSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) CloseSession(ctx context.Context, in *CloseSessionRequest, opts ...grpc.CallOption) (*CloseSessionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CloseSessionResponse)
+	err := c.cc.Invoke(ctx, Daemon_CloseSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) Encrypt(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EncryptRequest, Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Daemon_ServiceDesc.Streams[0], Daemon_Encrypt_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EncryptRequest, Chunk]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_EncryptClient = grpc.BidiStreamingClient[EncryptRequest, Chunk]
+
+func (c *daemonClient) Decrypt(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[DecryptRequest, Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Daemon_ServiceDesc.Streams[1], Daemon_Decrypt_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DecryptRequest, Chunk]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_DecryptClient = grpc.BidiStreamingClient[DecryptRequest, Chunk]
+
+func (c *daemonClient) Inspect(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Chunk, FileInfo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Daemon_ServiceDesc.Streams[2], Daemon_Inspect_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Chunk, FileInfo]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_InspectClient = grpc.ClientStreamingClient[Chunk, FileInfo]
+
+// DaemonServer is the server API for Daemon service.
+// All implementations must embed UnimplementedDaemonServer
+// for forward compatibility.
+//
+// Daemon encrypts, decrypts and inspects the files streamed to it.
+//
+// Calls are authenticated with the token of the daemon, sent as the
+// "authorization: Bearer TOKEN" metadata. Encrypt and Decrypt use the phrase
+// of a session, created with CreateSession: the keys derived from it are
+// kept by the session, so the files that share a key aren't derived again.
+type DaemonServer interface {
+	// CreateSession starts a session with a phrase, or the one the daemon was
+	// started with.
+	CreateSession(context.Context, *CreateSessionRequest) (*Session, error)
+	// CloseSession ends a session, forgetting its phrase and its keys.
+	CloseSession(context.Context, *CloseSessionRequest) (*CloseSessionResponse, error)
+	// Encrypt encrypts the content streamed by the client and streams the
+	// encrypted file back as it is encrypted. The first message names the
+	// session and the options.
+	Encrypt(grpc.BidiStreamingServer[EncryptRequest, Chunk]) error
+	// Decrypt decrypts the encrypted file streamed by the client and streams
+	// its content back, each part once it was authenticated. The first
+	// message names the session.
+	Decrypt(grpc.BidiStreamingServer[DecryptRequest, Chunk]) error
+	// Inspect returns the details of the encrypted file streamed by the
+	// client, such as its format version. No session is required.
+	Inspect(grpc.ClientStreamingServer[Chunk, FileInfo]) error
+	mustEmbedUnimplementedDaemonServer()
+}
+
+// UnimplementedDaemonServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDaemonServer struct{}
+
+func (UnimplementedDaemonServer) CreateSession(context.Context, *CreateSessionRequest) (*Session, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSession not implemented")
+}
+func (UnimplementedDaemonServer) CloseSession(context.Context, *CloseSessionRequest) (*CloseSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseSession not implemented")
+}
+func (UnimplementedDaemonServer) Encrypt(grpc.BidiStreamingServer[EncryptRequest, Chunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Encrypt not implemented")
+}
+func (UnimplementedDaemonServer) Decrypt(grpc.BidiStreamingServer[DecryptRequest, Chunk]) error {
+	return status.Errorf(codes.Unimplemented, "method Decrypt not implemented")
+}
+func (UnimplementedDaemonServer) Inspect(grpc.ClientStreamingServer[Chunk, FileInfo]) error {
+	return status.Errorf(codes.Unimplemented, "method Inspect not implemented")
+}
+func (UnimplementedDaemonServer) mustEmbedUnimplementedDaemonServer() {}
+func (UnimplementedDaemonServer) testEmbeddedByValue()                {}
+
+// UnsafeDaemonServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DaemonServer will
+// result in compilation errors.
+type UnsafeDaemonServer interface {
+	mustEmbedUnimplementedDaemonServer()
+}
+
+func RegisterDaemonServer(s grpc.ServiceRegistrar, srv DaemonServer) {
+	// If the following call pancis, it indicates UnimplementedDaemonServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Daemon_ServiceDesc, srv)
+}
+
+func _Daemon_CreateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).CreateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Daemon_CreateSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).CreateSession(ctx, req.(*CreateSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_CloseSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).CloseSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Daemon_CloseSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).CloseSession(ctx, req.(*CloseSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_Encrypt_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DaemonServer).Encrypt(&grpc.GenericServerStream[EncryptRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_EncryptServer = grpc.BidiStreamingServer[EncryptRequest, Chunk]
+
+func _Daemon_Decrypt_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DaemonServer).Decrypt(&grpc.GenericServerStream[DecryptRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_DecryptServer = grpc.BidiStreamingServer[DecryptRequest, Chunk]
+
+func _Daemon_Inspect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DaemonServer).Inspect(&grpc.GenericServerStream[Chunk, FileInfo]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_InspectServer = grpc.ClientStreamingServer[Chunk, FileInfo]
+
+// Daemon_ServiceDesc is the grpc.ServiceDesc for Daemon service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Daemon_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "celo.v1.Daemon",
+	HandlerType: (*DaemonServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSession",
+			Handler:    _Daemon_CreateSession_Handler,
+		},
+		{
+			MethodName: "CloseSession",
+			Handler:    _Daemon_CloseSession_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Encrypt",
+			Handler:       _Daemon_Encrypt_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Decrypt",
+			Handler:       _Daemon_Decrypt_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Inspect",
+			Handler:       _Daemon_Inspect_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "daemon.proto",
+}
@@ -0,0 +1,10 @@
+// Package celopb is the gRPC service of celo daemon, defined by
+// daemon.proto, for its clients:
+//
+//	conn, err := grpc.NewClient("127.0.0.1:7700", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	client := celopb.NewDaemonClient(conn)
+//
+// The code is generated by protoc-gen-go and protoc-gen-go-grpc.
+package celopb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative daemon.proto
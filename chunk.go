@@ -0,0 +1,351 @@
+package celo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Chunked payload. The plaintext is split in chunks of the same size (except
+// the last one) that are encrypted independently, so any range of the
+// plaintext can be decrypted without decrypting everything before it.
+//  nonce | ciphertext (chunk size + tag)    <- chunk 0
+//  nonce | ciphertext (chunk size + tag)    <- chunk 1
+//  ...
+//  nonce | ciphertext (<= chunk size + tag) <- last chunk
+//
+// The index of each chunk and whether it is the last one are authenticated
+// along with the file signature, which prevents chunks from being reordered,
+// removed or the payload from being truncated.
+//
+// The nonce of each chunk is derived from a random prefix, generated once per
+// payload, and the chunk index (See chunkNonce). Every payload is encrypted
+// with its own random data key, so nonces are never reused with the same key.
+// Decoders read the nonces from the payload, files with random nonces are
+// still supported.
+const (
+	// ChunkSizeLog2 default size of the plaintext chunks as a power of 2
+	// (64 KiB).
+	ChunkSizeLog2 = 16
+
+	// minChunkSizeLog2 and maxChunkSizeLog2 boundaries of the chunk size.
+	minChunkSizeLog2 = 10
+	maxChunkSizeLog2 = 24
+
+	// TagSize size of the authentication tag appended to each chunk by AES GCM.
+	TagSize = 16
+)
+
+// chunkAdditionalData additional data authenticated along with the chunk i.
+//  file signature | chunk index (8 bytes, big endian) | last (1 byte)
+func chunkAdditionalData(ad []byte, i int64, last bool) []byte {
+	b := make([]byte, 0, len(ad)+9)
+	b = append(b, ad...)
+	b = binary.BigEndian.AppendUint64(b, uint64(i))
+	if last {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// chunkNoncePrefix returns the random prefix of the nonces of a payload
+// encrypted with c.
+func chunkNoncePrefix(c *Cipher) ([]byte, error) {
+	prefix := make([]byte, c.NonceSize()-8)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, errors.E(errors.Encrypt, errors.Op("chunk.chunkNoncePrefix"), err)
+	}
+	return prefix, nil
+}
+
+// chunkNonce nonce of the chunk i of a payload with the nonce prefix.
+//  prefix (nonce size - 8 bytes) | chunk index (8 bytes, big endian)
+func chunkNonce(prefix []byte, i int64) []byte {
+	b := make([]byte, 0, len(prefix)+8)
+	b = append(b, prefix...)
+	return binary.BigEndian.AppendUint64(b, uint64(i))
+}
+
+// sealChunks encrypts the plaintext in chunks of chunkSize bytes.
+// An empty plaintext results in a single empty chunk, so the last chunk is
+// always present.
+// It returns an error if ctx is done before every chunk is encrypted.
+func sealChunks(ctx context.Context, c *Cipher, plaintext, ad []byte, chunkSize int) ([]byte, error) {
+	chunks := (len(plaintext) + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	prefix, err := chunkNoncePrefix(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(plaintext)+chunks*(c.NonceSize()+TagSize))
+
+	for i := 0; i < chunks; i++ {
+		if err := checkContext(ctx, errors.Op("chunk.sealChunks")); err != nil {
+			return nil, err
+		}
+
+		start := i * chunkSize
+		end := start + chunkSize
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+
+		nonce := chunkNonce(prefix, int64(i))
+		sealed = append(sealed, nonce...)
+		sealed = append(sealed, c.seal(nonce, plaintext[start:end], chunkAdditionalData(ad, int64(i), i == chunks-1))...)
+	}
+
+	return sealed, nil
+}
+
+// sealedSize returns the size of the payload sealed by sealChunks for a
+// plaintext of n bytes.
+func sealedSize(n int64, chunkSize, nonceSize int) int64 {
+	chunks := (n + int64(chunkSize) - 1) / int64(chunkSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+	return n + chunks*int64(nonceSize+TagSize)
+}
+
+// sealChunksTo is sealChunks for a plaintext of n bytes read from r. The sealed
+// chunks are written to w as soon as they are encrypted, so only one chunk is
+// kept in memory.
+// It returns an error of kind errors.Plaintext if r has less than n bytes.
+func sealChunksTo(ctx context.Context, c *Cipher, r io.Reader, n int64, ad []byte, chunkSize int, w io.Writer) error {
+	op := errors.Op("chunk.sealChunksTo")
+
+	chunks := (n + int64(chunkSize) - 1) / int64(chunkSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	prefix, err := chunkNoncePrefix(c)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	defer ZeroBytes(buf)
+
+	for i := int64(0); i < chunks; i++ {
+		size := int64(chunkSize)
+		if i == chunks-1 {
+			size = n - i*int64(chunkSize)
+		}
+
+		if _, err := io.ReadFull(r, buf[:size]); err != nil {
+			return errors.E(errors.Plaintext, op, err)
+		}
+
+		// Reading might take a while (e.g. a network file system).
+		if err := checkContext(ctx, op); err != nil {
+			return err
+		}
+
+		nonce := chunkNonce(prefix, i)
+		ciphertext := c.seal(nonce, buf[:size], chunkAdditionalData(ad, i, i == chunks-1))
+
+		if _, err = w.Write(nonce); err == nil {
+			_, err = w.Write(ciphertext)
+		}
+		if err != nil {
+			return errors.E(errors.Encode, op, err)
+		}
+	}
+
+	return nil
+}
+
+// sealStreamTo is sealChunksTo for a plaintext of unknown size read from r
+// until io.EOF. One chunk is read ahead to know which one is the last.
+// It returns the size of the plaintext.
+func sealStreamTo(ctx context.Context, c *Cipher, r io.Reader, ad []byte, chunkSize int, w io.Writer) (n int64, err error) {
+	op := errors.Op("chunk.sealStreamTo")
+
+	prefix, err := chunkNoncePrefix(c)
+	if err != nil {
+		return 0, err
+	}
+
+	buf, next := make([]byte, chunkSize), make([]byte, chunkSize)
+	defer ZeroBytes(buf)
+	defer ZeroBytes(next)
+
+	// readChunk reads a chunk to b and reports whether r had less than a full
+	// chunk left, which makes it the last one.
+	readChunk := func(b []byte) (int, bool, error) {
+		size, err := io.ReadFull(r, b)
+		switch err {
+		case nil:
+			return size, false, nil
+		case io.EOF, io.ErrUnexpectedEOF:
+			return size, true, nil
+		}
+		return size, false, errors.E(errors.Plaintext, op, err)
+	}
+
+	size, short, err := readChunk(buf)
+	for i := int64(0); err == nil; i++ {
+		// A full chunk is the last one only if nothing follows it.
+		last := short
+		var nextSize int
+		var nextShort bool
+		if !short {
+			if nextSize, nextShort, err = readChunk(next); err != nil {
+				break
+			}
+			last = nextSize == 0
+		}
+
+		// Reading might take a while (e.g. a network connection).
+		if err = checkContext(ctx, op); err != nil {
+			break
+		}
+
+		nonce := chunkNonce(prefix, i)
+		ciphertext := c.seal(nonce, buf[:size], chunkAdditionalData(ad, i, last))
+		n += int64(size)
+
+		if _, err = w.Write(nonce); err == nil {
+			_, err = w.Write(ciphertext)
+		}
+		if err != nil {
+			return n, errors.E(errors.Encode, op, err)
+		}
+
+		if last {
+			return n, nil
+		}
+		buf, next, size, short = next, buf, nextSize, nextShort
+	}
+
+	return n, err
+}
+
+// openChunk decrypts the sealed chunk i (nonce | ciphertext).
+func openChunk(c *Cipher, sealed, ad []byte, i int64, last bool) ([]byte, error) {
+	if len(sealed) < c.NonceSize()+TagSize {
+		return nil, errors.E(errors.Ciphertext, errors.Op("chunk.openChunk"), errors.Errorf("chunk %d is truncated", i))
+	}
+
+	plaintext, err := c.Decrypt(sealed[:c.NonceSize()], sealed[c.NonceSize():], chunkAdditionalData(ad, i, last))
+	if err != nil {
+		// The data key was already authenticated when it was unwrapped, the
+		// chunk is corrupt.
+		return nil, errors.E(errors.Ciphertext, errors.Op("chunk.openChunk"), errors.Errorf("chunk %d failed authentication", i))
+	}
+
+	return plaintext, nil
+}
+
+// openChunks decrypts a payload sealed by sealChunks.
+// It returns an error if ctx is done before every chunk is decrypted.
+func openChunks(ctx context.Context, c *Cipher, sealed, ad []byte, chunkSize int) ([]byte, error) {
+	layout := newChunkLayout(int64(len(sealed)), chunkSize, c.NonceSize())
+	plaintext := make([]byte, 0, layout.maxPlaintextSize())
+
+	for i := int64(0); i < layout.chunks; i++ {
+		if err := checkContext(ctx, errors.Op("chunk.openChunks")); err != nil {
+			return nil, err
+		}
+
+		start, end := layout.bounds(i)
+		chunk, err := openChunk(c, sealed[start:end], ad, i, i == layout.chunks-1)
+		if err != nil {
+			return nil, err
+		}
+		plaintext = append(plaintext, chunk...)
+	}
+
+	return plaintext, nil
+}
+
+// openChunksTo is openChunks for a sealed payload of n bytes read from r. The
+// plaintext of each chunk is written to w as soon as it is authenticated, so
+// only one chunk is kept in memory.
+// It returns an error of kind errors.Ciphertext if r has less than n bytes.
+func openChunksTo(ctx context.Context, c *Cipher, r io.Reader, n int64, ad []byte, chunkSize int, w io.Writer) error {
+	op := errors.Op("chunk.openChunksTo")
+
+	layout := newChunkLayout(n, chunkSize, c.NonceSize())
+	buf := make([]byte, layout.sealedSize)
+
+	for i := int64(0); i < layout.chunks; i++ {
+		start, end := layout.bounds(i)
+		if _, err := io.ReadFull(r, buf[:end-start]); err != nil {
+			return errors.E(errors.Ciphertext, op, err)
+		}
+
+		if err := checkContext(ctx, op); err != nil {
+			return err
+		}
+
+		chunk, err := openChunk(c, buf[:end-start], ad, i, i == layout.chunks-1)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(chunk)
+		ZeroBytes(chunk)
+		if err != nil {
+			return errors.E(errors.Create, op, err)
+		}
+	}
+
+	return nil
+}
+
+// chunkLayout locates the chunks of a sealed payload.
+type chunkLayout struct {
+	// size of the sealed payload.
+	size int64
+	// chunkSize size of the plaintext of each chunk.
+	chunkSize int64
+	// sealedSize size of each sealed chunk, except the last one.
+	sealedSize int64
+	// chunks number of chunks.
+	chunks int64
+}
+
+func newChunkLayout(size int64, chunkSize, nonceSize int) chunkLayout {
+	l := chunkLayout{
+		size:       size,
+		chunkSize:  int64(chunkSize),
+		sealedSize: int64(nonceSize + chunkSize + TagSize),
+	}
+
+	l.chunks = (size + l.sealedSize - 1) / l.sealedSize
+	if l.chunks == 0 {
+		// The last chunk is always present, decrypting it will fail.
+		l.chunks = 1
+	}
+
+	return l
+}
+
+// bounds returns the offsets of the sealed chunk i within the payload.
+func (l chunkLayout) bounds(i int64) (start, end int64) {
+	start = i * l.sealedSize
+	end = start + l.sealedSize
+	if end > l.size {
+		end = l.size
+	}
+	return start, end
+}
+
+// maxPlaintextSize size of the plaintext if the payload isn't corrupt.
+func (l chunkLayout) maxPlaintextSize() int64 {
+	overhead := l.chunks * (l.sealedSize - l.chunkSize)
+	if overhead > l.size {
+		return 0
+	}
+	return l.size - overhead
+}
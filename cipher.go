@@ -28,7 +28,7 @@ func NewCipher(blockSize, nonceSize int, key []byte) (*Cipher, error) {
 	}
 
 	// GCM Mode that provides integrity checks (Authentication) by default.
-	aead, err := cipher.NewGCM(block)
+	aead, err := cipher.NewGCMWithNonceSize(block, nonceSize)
 	if err != nil {
 		return nil, errors.E(errors.Cipher, op, err)
 	}
@@ -65,10 +65,17 @@ func (c *Cipher) Encrypt(plaintext, additionalData []byte) (nonce, ciphertext []
 	return nonce, ciphertext, nil
 }
 
-// Decrypt decrypts the ciphertext using the passed nonce.
+// seal encrypts plaintext with the given nonce, which must never be reused
+// with the same key.
+func (c *Cipher) seal(nonce, plaintext, additionalData []byte) []byte {
+	return c.aead.Seal(nil, nonce, plaintext, additionalData)
+}
+
+// Decrypt decrypts the ciphertext using the passed nonce and authenticates the
+// additionalData passed to Encrypt.
 // It returns plaintext or an error.
-func (c *Cipher) Decrypt(nonce, ciphertext []byte) (plaintext []byte, err error) {
-	plaintext, err = c.aead.Open(nil, nonce, ciphertext, nil)
+func (c *Cipher) Decrypt(nonce, ciphertext, additionalData []byte) (plaintext []byte, err error) {
+	plaintext, err = c.aead.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		// Unable to decrypt or authenticate.
 		return nil, errors.E(errors.Decrypt, errors.Op("cipher.Decrypt"), err)
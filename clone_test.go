@@ -0,0 +1,72 @@
+package celo
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Run with -race to detect state shared between clones.
+func TestClone(t *testing.T) {
+	phrase := []byte("secret")
+	files := make([][]byte, 4)
+	plaintexts := make([][]byte, len(files))
+
+	e := NewEncrypter()
+	if err := e.Config(SetPadding(PaddingBlock)); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*len(files))
+
+	for i := range files {
+		plaintexts[i] = []byte(fmt.Sprintf("plaintext %d", i))
+
+		wg.Add(1)
+		go func(i int, e *Encrypter) {
+			defer wg.Done()
+
+			if _, err := e.Encrypt(phrase, plaintexts[i]); err != nil {
+				errs <- err
+				return
+			}
+			b := new(bytes.Buffer)
+			if _, err := e.Write(b); err != nil {
+				errs <- err
+				return
+			}
+			files[i] = b.Bytes()
+		}(i, e.Clone())
+	}
+	wg.Wait()
+
+	// The clones of a Decrypter share the key of the file it decrypted.
+	d := NewDecrypter()
+	if _, err := openFile(d, phrase, files[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range files {
+		wg.Add(1)
+		go func(i int, d *Decrypter) {
+			defer wg.Done()
+
+			got, err := openFile(d, phrase, files[i])
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(got, plaintexts[i]) {
+				errs <- fmt.Errorf("file %d: got %q, want %q", i, got, plaintexts[i])
+			}
+		}(i, d.Clone())
+	}
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,132 @@
+//go:build js && wasm
+
+// Command celo-wasm exposes the encryption of byte arrays to JavaScript, so
+// browser tools can produce and consume .celo files client-side.
+//
+// Build it and copy the loader of the Go version used (misc/wasm instead of
+// lib/wasm before Go 1.24):
+//  GOOS=js GOARCH=wasm go build -o celo.wasm ./cmd/celo-wasm
+//  cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Tests run with Node.js:
+//  PATH="$PATH:$(go env GOROOT)/lib/wasm" GOOS=js GOARCH=wasm go test ./cmd/celo-wasm
+//
+// Once the module is running, a global celo object is defined:
+//  const go = new Go();
+//  const { instance } = await WebAssembly.instantiateStreaming(fetch("celo.wasm"), go.importObject);
+//  go.run(instance);
+//  const blob = await celo.encrypt("secret", new TextEncoder().encode("attack at dawn"));
+//  const plaintext = await celo.decrypt("secret", blob);
+// Phrases are strings or Uint8Arrays, contents are Uint8Arrays. Both functions
+// return a Promise, rejected with an Error if the operation fails.
+package main
+
+import (
+	"bytes"
+	"syscall/js"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func main() {
+	js.Global().Set("celo", js.ValueOf(map[string]interface{}{
+		"version": celo.Version,
+		"encrypt": promiseFunc(celo.EncryptBytes),
+		"decrypt": promiseFunc(celo.DecryptBytes),
+		"isCelo":  js.FuncOf(isCelo),
+	}))
+
+	// The functions must be available as long as the page is.
+	select {}
+}
+
+// promiseFunc wraps fn as a JavaScript function that takes a phrase and a
+// Uint8Array and returns a Promise of a Uint8Array. fn runs in its own
+// goroutine, key generation would block the event loop otherwise.
+func promiseFunc(fn func(phrase, b []byte, opts ...celo.Option) ([]byte, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return newPromise(func() (interface{}, error) {
+			if len(args) != 2 {
+				return nil, errors.E(errors.Invalid, errors.Errorf("a phrase and a Uint8Array are required"))
+			}
+
+			phrase, err := phraseBytes(args[0])
+			if err != nil {
+				return nil, err
+			}
+			defer celo.ZeroBytes(phrase)
+
+			b, err := bytesOf(args[1])
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := fn(phrase, b)
+			if err != nil {
+				return nil, err
+			}
+			return uint8Array(out), nil
+		})
+	})
+}
+
+// isCelo reports whether the Uint8Array starts with the signature of a .celo
+// file.
+func isCelo(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return false
+	}
+	b, err := bytesOf(args[0])
+	if err != nil {
+		return false
+	}
+	ok, _, _ := celo.Sniff(bytes.NewReader(b))
+	return ok
+}
+
+// newPromise returns a Promise resolved with the result of fn, or rejected with
+// its error.
+func newPromise(fn func() (interface{}, error)) js.Value {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resolve, reject := args[0], args[1]
+		go func() {
+			defer executor.Release()
+
+			v, err := fn()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(v)
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+// phraseBytes returns the phrase passed as a string or a Uint8Array.
+func phraseBytes(v js.Value) ([]byte, error) {
+	if v.Type() == js.TypeString {
+		return []byte(v.String()), nil
+	}
+	return bytesOf(v)
+}
+
+// bytesOf copies the content of the Uint8Array v.
+func bytesOf(v js.Value) ([]byte, error) {
+	if !v.InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, errors.E(errors.Invalid, errors.Errorf("a Uint8Array is required"))
+	}
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b, nil
+}
+
+// uint8Array copies b to a new Uint8Array.
+func uint8Array(b []byte) js.Value {
+	v := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(v, b)
+	return v
+}
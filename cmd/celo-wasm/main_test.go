@@ -0,0 +1,65 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+	"testing"
+
+	"github.com/rrivera/celo"
+)
+
+// await waits for the Promise p and returns its value, or the message of its
+// error.
+func await(p js.Value) (v js.Value, err string) {
+	done := make(chan struct{})
+	onResolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		v = args[0]
+		close(done)
+		return nil
+	})
+	defer onResolve.Release()
+	onReject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err = args[0].Get("message").String()
+		close(done)
+		return nil
+	})
+	defer onReject.Release()
+
+	p.Call("then", onResolve, onReject)
+	<-done
+	return v, err
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	encrypt, decrypt := promiseFunc(celo.EncryptBytes), promiseFunc(celo.DecryptBytes)
+	defer encrypt.Release()
+	defer decrypt.Release()
+
+	plaintext := uint8Array([]byte("attack at dawn"))
+	blob, err := await(encrypt.Invoke("secret", plaintext))
+	if err != "" {
+		t.Fatal(err)
+	}
+	if !isCelo(js.Undefined(), []js.Value{blob}).(bool) {
+		t.Error("encrypted blob isn't a .celo file")
+	}
+
+	got, err := await(decrypt.Invoke(uint8Array([]byte("secret")), blob))
+	if err != "" {
+		t.Fatal(err)
+	}
+	if b, _ := bytesOf(got); string(b) != "attack at dawn" {
+		t.Errorf("got %q", b)
+	}
+
+	if _, err = await(decrypt.Invoke("wrong", blob)); err == "" {
+		t.Error("decrypted with the wrong phrase")
+	}
+	if _, err = await(encrypt.Invoke("secret", "attack at dawn")); err == "" {
+		t.Error("string content accepted")
+	}
+	if _, err = await(encrypt.Invoke("secret")); err == "" {
+		t.Error("missing content accepted")
+	}
+}
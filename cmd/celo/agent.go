@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// agentSocketEnv environment variable with the socket of the running agent.
+// Commands use the agent only when it is set, as ssh with SSH_AUTH_SOCK.
+const agentSocketEnv = "CELO_AGENT_SOCK"
+
+const (
+	agentSocketDefault = ""
+	agentSocketUsage   = "`path` of the socket the agent listens on. $" + agentSocketEnv + " if empty, or agent.sock\n\tin a private directory if it isn't set either."
+
+	agentTimeoutDefault = 15 * time.Minute
+	agentTimeoutUsage   = "How long the phrase and the keys are kept after they are added, e.g. 1h30m.\n\t0 keeps them until the agent stops."
+
+	agentForgetUsage = "Make the running agent forget the phrase and the keys instead of starting one."
+
+	agentKeepPhraseUsage = "Keep the phrase typed by commands and hand it to the next ones, so it is asked once.\n\tAny process of the user that can reach the socket can read it. Only the keys are kept\n\tby default."
+)
+
+// Limits of the keys derived by the agent.
+const (
+	// maxAgentKeys keys kept, the oldest one is forgotten first.
+	maxAgentKeys = 256
+	// maxAgentKeySize and maxAgentSaltSize in bytes.
+	maxAgentKeySize  = 64
+	maxAgentSaltSize = 1024
+	// agentIOTimeout time a request and its response have to be sent.
+	agentIOTimeout = time.Minute
+)
+
+var (
+	// Path of the socket of the agent.
+	agentSocket string
+	// How long secrets are kept by the agent.
+	agentTimeout time.Duration
+	// Make the running agent forget its secrets.
+	agentForget bool
+	// Keep the phrase and hand it to commands.
+	agentKeepPhrase bool
+)
+
+var agentCommand = flag.NewFlagSet("agent", flag.ContinueOnError)
+
+func initAgentFlags() {
+	agentCommand.StringVar(&agentSocket, "socket", agentSocketDefault, agentSocketUsage)
+	agentCommand.DurationVar(&agentTimeout, "timeout", agentTimeoutDefault, agentTimeoutUsage)
+	agentCommand.BoolVar(&agentForget, "forget", false, agentForgetUsage)
+	agentCommand.BoolVar(&agentKeepPhrase, "keep-phrase", false, agentKeepPhraseUsage)
+	agentCommand.BoolVar(&quiet, "q", false, quietUsage)
+}
+
+// Operations of the requests to the agent.
+const (
+	// agentGetPhrase returns the phrase of the agent, if it keeps phrases.
+	agentGetPhrase = "phrase"
+	// agentAddPhrase replaces the phrase of the agent, if it keeps phrases.
+	agentAddPhrase = "add"
+	// agentDeriveKey returns the key of a phrase and salt.
+	agentDeriveKey = "derive"
+	// agentForgetAll forgets the phrase and the keys.
+	agentForgetAll = "forget"
+	// agentPing only checks that the agent answers.
+	agentPing = "ping"
+)
+
+// agentRequest a request to the agent, one per connection. Both the request
+// and the response are a line of JSON.
+type agentRequest struct {
+	Op     string `json:"op"`
+	Phrase []byte `json:"phrase,omitempty"`
+	Salt   []byte `json:"salt,omitempty"`
+	Size   uint32 `json:"size,omitempty"`
+	// Time, Memory (KiB) and Threads parameters of the key derivation,
+	// celo.DefaultKDFParams if they are missing.
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// kdf returns the key derivation parameters of the request.
+func (r *agentRequest) kdf() celo.KDFParams {
+	if r.Time == 0 && r.Memory == 0 && r.Threads == 0 {
+		return celo.DefaultKDFParams()
+	}
+	return celo.KDFParams{Time: r.Time, Memory: r.Memory, Threads: r.Threads}
+}
+
+// agentResponse the response of the agent to a request.
+type agentResponse struct {
+	Phrase []byte      `json:"phrase,omitempty"`
+	Key    []byte      `json:"key,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Kind   errors.Kind `json:"kind,omitempty"`
+}
+
+// wipe zeroes the secrets of the request.
+func (r *agentRequest) wipe() {
+	celo.ZeroBytes(r.Phrase)
+}
+
+// wipe zeroes the secrets of the response.
+func (r *agentResponse) wipe() {
+	celo.ZeroBytes(r.Phrase, r.Key)
+}
+
+// agentSecret a phrase or a key kept by the agent, in memory that isn't
+// swapped to disk when the OS allows it (See lockMemory).
+type agentSecret struct {
+	b     []byte
+	added time.Time
+}
+
+// newAgentSecret keeps a copy of b, added at now.
+func newAgentSecret(b []byte, now time.Time) *agentSecret {
+	s := &agentSecret{b: make([]byte, len(b)), added: now}
+	lockMemory(s.b)
+	copy(s.b, b)
+	return s
+}
+
+// release zeroes the secret and unlocks its memory.
+func (s *agentSecret) release() {
+	celo.ZeroBytes(s.b)
+	unlockMemory(s.b)
+}
+
+// keyAgent keeps a secret phrase and the keys derived from phrases for a
+// while, so commands don't ask for the phrase nor derive its keys every time.
+// It is safe for concurrent use.
+type keyAgent struct {
+	mu sync.Mutex
+	// timeout how long secrets are kept, forever if it is 0.
+	timeout time.Duration
+	// keepPhrase whether the phrase is kept and handed to clients.
+	keepPhrase bool
+	phrase     *agentSecret
+	// keys by their digest (See digest).
+	keys map[string]*agentSecret
+	// secret key of the digests of keys.
+	secret []byte
+	now    func() time.Time
+}
+
+// newKeyAgent creates an agent that keeps secrets for timeout. The phrase is
+// only kept if keepPhrase is true.
+func newKeyAgent(timeout time.Duration, keepPhrase bool) (*keyAgent, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.E(errors.Other, errors.Op("main.newKeyAgent"), err)
+	}
+	return &keyAgent{
+		timeout:    timeout,
+		keepPhrase: keepPhrase,
+		keys:       map[string]*agentSecret{},
+		secret:     secret,
+		now:        time.Now,
+	}, nil
+}
+
+// digest identifies the key of size bytes derived from phrase and salt with
+// the parameters p without keeping the phrase.
+func (a *keyAgent) digest(phrase, salt []byte, p celo.KDFParams, size uint32) string {
+	h := hmac.New(sha256.New, a.secret)
+	binary.Write(h, binary.BigEndian, size)
+	binary.Write(h, binary.BigEndian, p)
+	binary.Write(h, binary.BigEndian, uint32(len(salt)))
+	h.Write(salt)
+	h.Write(phrase)
+	return string(h.Sum(nil))
+}
+
+// expire forgets the secrets kept for longer than the timeout. The caller must
+// hold a.mu.
+func (a *keyAgent) expire() {
+	if a.timeout <= 0 {
+		return
+	}
+	expired := func(s *agentSecret) bool { return !a.now().Before(s.added.Add(a.timeout)) }
+
+	if a.phrase != nil && expired(a.phrase) {
+		a.phrase.release()
+		a.phrase = nil
+	}
+	for d, k := range a.keys {
+		if expired(k) {
+			k.release()
+			delete(a.keys, d)
+		}
+	}
+}
+
+// forget forgets the phrase and every key.
+func (a *keyAgent) forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.phrase != nil {
+		a.phrase.release()
+		a.phrase = nil
+	}
+	for d, k := range a.keys {
+		k.release()
+		delete(a.keys, d)
+	}
+}
+
+// answer returns the response to req.
+func (a *keyAgent) answer(req *agentRequest) (res *agentResponse) {
+	fail := func(err error) *agentResponse {
+		return &agentResponse{Error: err.Error(), Kind: errorKind(err)}
+	}
+
+	if (req.Op == agentGetPhrase || req.Op == agentAddPhrase) && !a.keepPhrase {
+		return fail(errors.E(errors.Permissions, errors.Errorf("the agent doesn't keep the phrase, start it with -keep-phrase")))
+	}
+
+	switch req.Op {
+	case agentGetPhrase:
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.expire()
+		if a.phrase == nil {
+			return fail(errors.E(errors.NotExist, errors.Errorf("the agent has no phrase")))
+		}
+		return &agentResponse{Phrase: append([]byte(nil), a.phrase.b...)}
+
+	case agentAddPhrase:
+		if len(req.Phrase) == 0 {
+			return fail(errors.E(errors.PhraseIsEmpty))
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.phrase != nil {
+			a.phrase.release()
+		}
+		a.phrase = newAgentSecret(req.Phrase, a.now())
+		return &agentResponse{}
+
+	case agentDeriveKey:
+		switch {
+		case len(req.Phrase) == 0:
+			return fail(errors.E(errors.PhraseIsEmpty))
+		case req.Size == 0 || req.Size > maxAgentKeySize || len(req.Salt) == 0 || len(req.Salt) > maxAgentSaltSize:
+			return fail(errors.E(errors.Invalid, errors.Errorf("invalid key size %d or salt size %d", req.Size, len(req.Salt))))
+		}
+		p := req.kdf()
+		if err := p.Validate(); err != nil {
+			return fail(err)
+		}
+		return &agentResponse{Key: a.deriveKey(req.Phrase, req.Salt, p, req.Size)}
+
+	case agentForgetAll:
+		a.forget()
+		return &agentResponse{}
+
+	case agentPing:
+		return &agentResponse{}
+	}
+
+	return fail(errors.E(errors.Invalid, errors.Errorf("unknown operation %q", req.Op)))
+}
+
+// deriveKey returns a copy of the key of size bytes derived from phrase and
+// salt with the parameters p, which is kept for next time.
+func (a *keyAgent) deriveKey(phrase, salt []byte, p celo.KDFParams, size uint32) []byte {
+	d := a.digest(phrase, salt, p, size)
+
+	a.mu.Lock()
+	a.expire()
+	k, ok := a.keys[d]
+	if ok {
+		defer a.mu.Unlock()
+		return append([]byte(nil), k.b...)
+	}
+	a.mu.Unlock()
+
+	// Other requests are answered while the key is derived.
+	key := p.Key(phrase, salt, size)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok = a.keys[d]; !ok {
+		if len(a.keys) >= maxAgentKeys {
+			a.forgetOldestKey()
+		}
+		a.keys[d] = newAgentSecret(key, a.now())
+	}
+	return key
+}
+
+// forgetOldestKey forgets the key added first. The caller must hold a.mu.
+func (a *keyAgent) forgetOldestKey() {
+	var oldest string
+	for d, k := range a.keys {
+		if oldest == "" || k.added.Before(a.keys[oldest].added) {
+			oldest = d
+		}
+	}
+	if oldest != "" {
+		a.keys[oldest].release()
+		delete(a.keys, oldest)
+	}
+}
+
+// serve answers the requests of the connections accepted by l until it is
+// closed.
+func (a *keyAgent) serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if stderrors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return errors.E(errors.Other, errors.Op("main.serve"), err)
+		}
+		go a.handle(conn)
+	}
+}
+
+// handle answers the request of conn.
+func (a *keyAgent) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentIOTimeout))
+
+	var req agentRequest
+	defer req.wipe()
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	res := a.answer(&req)
+	defer res.wipe()
+	json.NewEncoder(conn).Encode(res)
+}
+
+// callAgent sends req to the agent listening on socket and returns its
+// response. Errors of the agent are returned with their kind, it returns an
+// error of kind errors.PhraseOther if the agent can't be reached.
+func callAgent(ctx context.Context, socket string, req *agentRequest) (*agentResponse, error) {
+	op := errors.Op("main.callAgent")
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, errors.E(errors.PhraseOther, op, errors.Errorf("agent: %v", err))
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(agentIOTimeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+
+	res := new(agentResponse)
+	if err = json.NewEncoder(conn).Encode(req); err == nil {
+		err = json.NewDecoder(conn).Decode(res)
+	}
+	if err != nil {
+		res.wipe()
+		return nil, errors.E(errors.PhraseOther, op, errors.Errorf("agent: %v", err))
+	}
+	if res.Error != "" {
+		return nil, errors.E(res.Kind, op, errors.Errorf("agent: %s", res.Error))
+	}
+	return res, nil
+}
+
+// agentPhrase is a PhraseProvider that gets the phrase from the agent
+// listening on socket. If the agent doesn't have one, it is asked to ask with
+// confirmation and added to the agent. Agents that don't keep the phrase only
+// keep its keys, the phrase is asked every time.
+type agentPhrase struct {
+	socket string
+	ask    celo.PhraseProvider
+}
+
+// Phrase returns the phrase of the agent, or asks for it. If the agent can't
+// be reached, the phrase is asked without it.
+func (p agentPhrase) Phrase(confirm bool) ([]byte, error) {
+	res, err := callAgent(context.Background(), p.socket, &agentRequest{Op: agentGetPhrase})
+	switch {
+	case err == nil:
+		return res.Phrase, nil
+	case errors.Is(errors.PhraseOther, err):
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Warning: %v, the phrase isn't kept.\n", err)
+		}
+		return p.ask.Phrase(confirm)
+	case errors.Is(errors.Permissions, err):
+		return p.ask.Phrase(confirm)
+	case !errors.Is(errors.NotExist, err):
+		return nil, err
+	}
+
+	// A phrase that is going to be reused is always confirmed.
+	phrase, err := p.ask.Phrase(true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = callAgent(context.Background(), p.socket, &agentRequest{Op: agentAddPhrase, Phrase: phrase}); err != nil {
+		celo.ZeroBytes(phrase)
+		return nil, err
+	}
+	return phrase, nil
+}
+
+// Interactive reports whether the phrase can be asked again, never: the agent
+// would return the same phrase. It is still a prompt, the phrase isn't needed
+// when identities or recipients are used instead.
+func (p agentPhrase) Interactive() bool {
+	return false
+}
+
+// agentKeyDeriver returns a celo.KeyDeriver that derives the keys with the
+// agent listening on socket, so they are derived once while the agent keeps
+// them. Keys are derived by celo when the agent can't be reached.
+func agentKeyDeriver(socket string) celo.KeyDeriver {
+	return func(ctx context.Context, phrase, salt []byte, p celo.KDFParams, size uint32) ([]byte, error) {
+		req := &agentRequest{Op: agentDeriveKey, Phrase: phrase, Salt: salt, Size: size, Time: p.Time, Memory: p.Memory, Threads: p.Threads}
+		res, err := callAgent(ctx, socket, req)
+		if err != nil || len(res.Key) != int(size) {
+			return p.KeyContext(ctx, phrase, salt, size)
+		}
+		return res.Key, nil
+	}
+}
+
+// withAgent returns p getting the phrase from the running agent, if
+// $CELO_AGENT_SOCK is set and p asks for the phrase (See agentPhrase).
+func withAgent(p celo.PhraseProvider) celo.PhraseProvider {
+	socket := os.Getenv(agentSocketEnv)
+	if socket == "" {
+		return p
+	}
+	switch p.(type) {
+	case celo.TerminalPhrase, celo.PinentryPhrase:
+		return agentPhrase{socket: socket, ask: p}
+	}
+	return p
+}
+
+// agentOption returns the option deriving keys with the running agent, if
+// $CELO_AGENT_SOCK is set (See agentKeyDeriver).
+func agentOption() celo.Option {
+	socket := os.Getenv(agentSocketEnv)
+	if socket == "" {
+		return celo.WithKeyDeriver(nil)
+	}
+	return celo.WithKeyDeriver(agentKeyDeriver(socket))
+}
+
+// defaultAgentSocket returns the socket of the agent in a directory only the
+// user can access: $XDG_RUNTIME_DIR, or celo-UID in the temporary directory.
+// It returns an error of kind errors.Permissions if others can access the
+// directory.
+func defaultAgentSocket() (string, error) {
+	op := errors.Op("main.defaultAgentSocket")
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("celo-%d", os.Getuid()))
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return "", errors.E(errors.Create, op, errors.Entity(dir), err)
+		}
+	}
+
+	if err := checkPrivateDir(dir); err != nil {
+		return "", errors.E(op, err)
+	}
+	return filepath.Join(dir, "celo-agent.sock"), nil
+}
+
+// checkPrivateDir returns an error of kind errors.Permissions if dir isn't a
+// directory only the user can access.
+func checkPrivateDir(dir string) error {
+	op := errors.Op("main.checkPrivateDir")
+
+	fi, err := os.Lstat(dir)
+	switch {
+	case err != nil:
+		return errors.E(errors.Open, op, errors.Entity(dir), err)
+	case !fi.IsDir():
+		return errors.E(errors.Permissions, op, errors.Entity(dir), errors.Errorf("not a directory"))
+	case runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0:
+		return errors.E(errors.Permissions, op, errors.Entity(dir), errors.Errorf("others can access the directory (%v)", fi.Mode().Perm()))
+	}
+	return nil
+}
+
+// listenAgent listens on socket, removing the socket of an agent that is no
+// longer running. Only the user can connect: the directory of the socket must
+// be private (See checkPrivateDir) and the socket is only accessible by the
+// user. It returns an error of kind errors.Exist if an agent is running.
+func listenAgent(socket string) (net.Listener, error) {
+	op := errors.Op("main.listenAgent")
+
+	if err := checkPrivateDir(filepath.Dir(socket)); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, errors.E(errors.Exist, op, errors.Entity(socket), errors.Errorf("an agent is already running"))
+	}
+	if fi, err := os.Lstat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(socket)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, errors.E(errors.Create, op, errors.Entity(socket), err)
+	}
+	if runtime.GOOS != "windows" {
+		if err = os.Chmod(socket, 0600); err != nil {
+			l.Close()
+			return nil, errors.E(errors.Permissions, op, errors.Entity(socket), err)
+		}
+	}
+	return l, nil
+}
+
+func agent(args []string) (err error) {
+
+	initAgentFlags()
+	if err = parseFlags(agentCommand, args); err != nil {
+		return err
+	}
+
+	socket := agentSocket
+	if socket == "" {
+		socket = os.Getenv(agentSocketEnv)
+	}
+
+	if agentForget {
+		if socket == "" {
+			return errors.E(errors.Invalid, errors.Errorf("-forget requires -socket or $%s", agentSocketEnv))
+		}
+		_, err = callAgent(context.Background(), socket, &agentRequest{Op: agentForgetAll})
+		return err
+	}
+
+	if agentTimeout < 0 {
+		return errors.E(errors.Invalid, errors.Errorf("-timeout can't be negative, got %v", agentTimeout))
+	}
+	if socket == "" {
+		if socket, err = defaultAgentSocket(); err != nil {
+			return err
+		}
+	}
+
+	a, err := newKeyAgent(agentTimeout, agentKeepPhrase)
+	if err != nil {
+		return err
+	}
+	defer a.forget()
+
+	l, err := listenAgent(socket)
+	if err != nil {
+		return err
+	}
+
+	// Commands find the agent through the environment, the line can be
+	// evaluated by the shell as the one of ssh-agent.
+	fmt.Printf("%s=%s; export %s;\n", agentSocketEnv, socket, agentSocketEnv)
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Agent listening on %s, stop it with Ctrl+C.\n", socket)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-stop
+		// Closing the listener removes the socket.
+		l.Close()
+	}()
+
+	// Secrets are forgotten as soon as they expire, not only when the next
+	// request comes.
+	if agentTimeout > 0 {
+		tick := time.NewTicker(time.Second)
+		defer tick.Stop()
+		go func() {
+			for range tick.C {
+				a.mu.Lock()
+				a.expire()
+				a.mu.Unlock()
+			}
+		}()
+	}
+
+	return a.serve(l)
+}
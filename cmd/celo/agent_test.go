@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestKeyAgent(t *testing.T) {
+	a, err := newKeyAgent(time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	call := func(req agentRequest) (*agentResponse, error) {
+		res := a.answer(&req)
+		if res.Error != "" {
+			return nil, errors.E(res.Kind, errors.Errorf("%s", res.Error))
+		}
+		return res, nil
+	}
+
+	if _, err := call(agentRequest{Op: agentGetPhrase}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("no phrase: got %v, want kind NotExist", err)
+	}
+	if _, err := call(agentRequest{Op: agentAddPhrase, Phrase: []byte("secret")}); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := call(agentRequest{Op: agentGetPhrase}); err != nil || string(res.Phrase) != "secret" {
+		t.Errorf("got phrase %+v, %v", res, err)
+	}
+
+	// Keys are the ones of celo, derived once.
+	salt := []byte("0123456789abcdef")
+	want := celo.GenerateKey([]byte("secret"), salt, 32)
+	for i := 0; i < 2; i++ {
+		res, err := call(agentRequest{Op: agentDeriveKey, Phrase: []byte("secret"), Salt: salt, Size: 32})
+		if err != nil || !bytes.Equal(res.Key, want) {
+			t.Fatalf("%d: got key %+v, %v", i, res, err)
+		}
+	}
+	if len(a.keys) != 1 {
+		t.Errorf("got %d keys, want 1", len(a.keys))
+	}
+
+	// Secrets are forgotten once they expire.
+	now = now.Add(time.Minute)
+	if _, err := call(agentRequest{Op: agentGetPhrase}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("expired phrase: got %v, want kind NotExist", err)
+	}
+	if len(a.keys) != 0 {
+		t.Errorf("got %d keys after they expired", len(a.keys))
+	}
+
+	for _, req := range []agentRequest{
+		{Op: agentDeriveKey, Phrase: []byte("secret"), Salt: salt, Size: maxAgentKeySize + 1},
+		{Op: agentDeriveKey, Phrase: []byte("secret"), Size: 32},
+		{Op: "sign"},
+	} {
+		if _, err := call(req); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%+v: got %v, want kind Invalid", req, err)
+		}
+	}
+	if _, err := call(agentRequest{Op: agentAddPhrase}); !errors.Is(errors.PhraseIsEmpty, err) {
+		t.Errorf("empty phrase: got %v, want kind PhraseIsEmpty", err)
+	}
+
+	call(agentRequest{Op: agentAddPhrase, Phrase: []byte("secret")})
+	call(agentRequest{Op: agentForgetAll})
+	if _, err := call(agentRequest{Op: agentGetPhrase}); !errors.Is(errors.NotExist, err) {
+		t.Errorf("forgotten phrase: got %v, want kind NotExist", err)
+	}
+
+	// Without -keep-phrase the phrase is never handed out, keys still are.
+	a.keepPhrase = false
+	for _, op := range []string{agentAddPhrase, agentGetPhrase} {
+		if _, err := call(agentRequest{Op: op, Phrase: []byte("secret")}); !errors.Is(errors.Permissions, err) {
+			t.Errorf("%s without -keep-phrase: got %v, want kind Permissions", op, err)
+		}
+	}
+	if _, err := call(agentRequest{Op: agentDeriveKey, Phrase: []byte("secret"), Salt: salt, Size: 32}); err != nil {
+		t.Errorf("key without -keep-phrase: %v", err)
+	}
+}
+
+func TestKeyAgentMaxKeys(t *testing.T) {
+	a, err := newKeyAgent(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a.now = func() time.Time { now = now.Add(time.Second); return now }
+
+	first := newAgentSecret([]byte("first"), a.now())
+	a.keys["first"] = first
+	for i := 1; i < maxAgentKeys; i++ {
+		a.keys[string(rune(i))] = newAgentSecret([]byte("key"), a.now())
+	}
+	a.deriveKey([]byte("secret"), []byte("0123456789abcdef"), celo.DefaultKDFParams(), 16)
+	if _, ok := a.keys["first"]; ok || len(a.keys) != maxAgentKeys {
+		t.Errorf("got %d keys, the oldest kept: %v", len(a.keys), ok)
+	}
+	if !bytes.Equal(first.b, make([]byte, len("first"))) {
+		t.Error("forgotten key wasn't zeroed")
+	}
+}
+
+// startAgent runs an agent on a socket in a temporary directory.
+func startAgent(t *testing.T, keepPhrase bool) string {
+	t.Helper()
+	// The path of a socket can't be long.
+	dir, err := os.MkdirTemp("", "celo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "agent.sock")
+
+	l, err := listenAgent(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newKeyAgent(time.Minute, keepPhrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- a.serve(l) }()
+	t.Cleanup(func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		os.RemoveAll(dir)
+	})
+	return socket
+}
+
+func TestAgentPhrase(t *testing.T) {
+	socket := startAgent(t, true)
+
+	if _, err := listenAgent(socket); !errors.Is(errors.Exist, err) {
+		t.Errorf("second agent: got %v, want kind Exist", err)
+	}
+
+	// The phrase is asked with confirmation the first time only.
+	asked, confirmed := 0, 0
+	p := agentPhrase{socket: socket, ask: celo.PhraseFunc(func(confirm bool) ([]byte, error) {
+		asked++
+		if confirm {
+			confirmed++
+		}
+		return []byte("otter-quilt-lemon-pylon"), nil
+	})}
+	for i := 0; i < 2; i++ {
+		phrase, err := p.Phrase(false)
+		if err != nil || string(phrase) != "otter-quilt-lemon-pylon" {
+			t.Fatalf("got phrase %q, %v", phrase, err)
+		}
+	}
+	if asked != 1 || confirmed != 1 {
+		t.Errorf("phrase asked %d times, confirmed %d, want 1", asked, confirmed)
+	}
+
+	// The phrase is asked as usual if the agent isn't running.
+	t.Cleanup(func() { quiet = false })
+	quiet = true
+	p.socket = filepath.Join(t.TempDir(), "missing.sock")
+	if _, err := p.Phrase(false); err != nil || asked != 2 || confirmed != 1 {
+		t.Errorf("no agent: got %v, asked %d times, confirmed %d", err, asked, confirmed)
+	}
+
+	// An agent that doesn't keep the phrase lets it be asked every time.
+	p.socket = startAgent(t, false)
+	for i := 0; i < 2; i++ {
+		if _, err := p.Phrase(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if asked != 4 || confirmed != 1 {
+		t.Errorf("phrase not kept: asked %d times, confirmed %d, want 4 and 1", asked, confirmed)
+	}
+}
+
+func TestAgentKeyDeriver(t *testing.T) {
+	socket := startAgent(t, false)
+	salt := []byte("0123456789abcdef")
+	want := celo.GenerateKey([]byte("secret"), salt, 32)
+
+	for _, s := range []string{socket, filepath.Join(t.TempDir(), "missing.sock")} {
+		key, err := agentKeyDeriver(s)(context.Background(), []byte("secret"), salt, celo.DefaultKDFParams(), 32)
+		if err != nil || !bytes.Equal(key, want) {
+			t.Errorf("%s: got key %x, %v", s, key, err)
+		}
+	}
+
+	// Keys are derived with the parameters of the request.
+	p := celo.KDFParams{Time: 2, Memory: celo.MinKDFMemory, Threads: 1}
+	if key, err := agentKeyDeriver(socket)(context.Background(), []byte("secret"), salt, p, 32); err != nil || !bytes.Equal(key, p.Key([]byte("secret"), salt, 32)) {
+		t.Errorf("%v: got key %x, %v", p, key, err)
+	}
+
+	// Files are encrypted and decrypted with the keys of the agent.
+	t.Setenv(agentSocketEnv, socket)
+	blob, err := celo.EncryptBytes([]byte("secret"), []byte("attack at dawn"), agentOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := celo.DecryptBytes([]byte("secret"), blob); err != nil || string(plaintext) != "attack at dawn" {
+		t.Errorf("got %q, %v", plaintext, err)
+	}
+}
+
+func TestWithAgent(t *testing.T) {
+	t.Setenv(agentSocketEnv, "")
+	if p := withAgent(celo.TerminalPhrase{}); p != (celo.TerminalPhrase{}) {
+		t.Errorf("without agent: got %#v", p)
+	}
+
+	t.Setenv(agentSocketEnv, "agent.sock")
+	if p, ok := withAgent(celo.TerminalPhrase{}).(agentPhrase); !ok || p.socket != "agent.sock" {
+		t.Errorf("typed phrase: got %#v", p)
+	}
+	// Phrases given on purpose aren't kept.
+	if p := withAgent(celo.EnvPhrase("CELO_PHRASE")); p != celo.EnvPhrase("CELO_PHRASE") {
+		t.Errorf("environment phrase: got %#v", p)
+	}
+	if p, ok := ttyPhrase(withAgent(celo.TerminalPhrase{})).(agentPhrase); !ok || !p.ask.(celo.TerminalPhrase).TTY {
+		t.Errorf("tty phrase: got %#v", p)
+	}
+}
+
+func TestDefaultAgentSocket(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if socket, err := defaultAgentSocket(); err != nil || socket != filepath.Join(dir, "celo-agent.sock") {
+		t.Errorf("got %q, %v", socket, err)
+	}
+
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := defaultAgentSocket(); !errors.Is(errors.Permissions, err) {
+		t.Errorf("shared directory: got %v, want kind Permissions", err)
+	}
+}
+
+func TestListenAgent(t *testing.T) {
+	socket := startAgent(t, false)
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("got socket mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	// Sockets given with -socket or $CELO_AGENT_SOCK are checked as well.
+	dir, err := os.MkdirTemp("", "celo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = listenAgent(filepath.Join(dir, "agent.sock")); runtime.GOOS != "windows" && !errors.Is(errors.Permissions, err) {
+		t.Errorf("shared directory: got %v, want kind Permissions", err)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	benchSizeDefault = 64
+	benchSizeUsage   = "`MiB` of data encrypted to measure the throughput of each cipher."
+
+	benchTargetDefault = time.Second
+	benchTargetUsage   = "Longest `duration` a key derivation should take to be recommended, such as 500ms."
+
+	// benchChunkSize size of the chunks sealed by the ciphers, as celo
+	// seals the chunks of large files (See celo.ChunkSizeLog2).
+	benchChunkSize = 1 << celo.ChunkSizeLog2
+)
+
+var (
+	// MiB encrypted by each cipher.
+	benchSize int
+	// Longest time a recommended key derivation takes.
+	benchTarget time.Duration
+)
+
+var benchCommand = flag.NewFlagSet("bench", flag.ContinueOnError)
+
+func initBenchFlags() {
+	benchCommand.IntVar(&benchSize, "size", benchSizeDefault, benchSizeUsage)
+	benchCommand.DurationVar(&benchTarget, "target", benchTargetDefault, benchTargetUsage)
+}
+
+// benchArgon2Params the key derivations measured, from the cheapest to the
+// most expensive. The first one is celo.DefaultKDFParams.
+var benchArgon2Params = []celo.KDFParams{
+	{Time: 1, Memory: 64 * 1024, Threads: 4},
+	{Time: 2, Memory: 64 * 1024, Threads: 4},
+	{Time: 3, Memory: 64 * 1024, Threads: 4},
+	{Time: 1, Memory: 256 * 1024, Threads: 4},
+	{Time: 2, Memory: 256 * 1024, Threads: 4},
+	{Time: 1, Memory: 1024 * 1024, Threads: 4},
+}
+
+// kdfResult time spent deriving a key with params.
+type kdfResult struct {
+	params  celo.KDFParams
+	elapsed time.Duration
+}
+
+// aeadResult throughput of a cipher, in bytes per second.
+type aeadResult struct {
+	name       string
+	throughput float64
+}
+
+// benchArgon2 returns the time spent deriving a 32 bytes key with p.
+func benchArgon2(p celo.KDFParams) time.Duration {
+	start := time.Now()
+	p.Key([]byte("celo bench"), make([]byte, 32), 32)
+	return time.Since(start)
+}
+
+// benchAEAD returns the throughput of aead sealing size bytes in chunks of
+// benchChunkSize.
+func benchAEAD(aead cipher.AEAD, size int) float64 {
+	chunk := make([]byte, benchChunkSize)
+	nonce := make([]byte, aead.NonceSize())
+	dst := make([]byte, 0, benchChunkSize+aead.Overhead())
+
+	start := time.Now()
+	for n := 0; n < size; n += benchChunkSize {
+		// Each chunk has its own nonce, as in celo files.
+		nonce[0]++
+		dst = aead.Seal(dst[:0], nonce, chunk, nil)
+	}
+	elapsed := time.Since(start)
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return float64(size) / elapsed.Seconds()
+}
+
+// benchCiphers returns the ciphers measured and their names. Their key is
+// all zeros, nothing they encrypt is kept.
+func benchCiphers() ([]string, []cipher.AEAD, error) {
+	key := make([]byte, 32)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, errors.E(errors.Cipher, err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, errors.E(errors.Cipher, err)
+	}
+	chacha, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, nil, errors.E(errors.Cipher, err)
+	}
+	return []string{"AES-256-GCM", "ChaCha20-Poly1305"}, []cipher.AEAD{gcm, chacha}, nil
+}
+
+// recommend returns the fastest cipher and the most expensive key derivation
+// that takes at most target, the cheapest one if none does.
+func recommend(kdfs []kdfResult, aeads []aeadResult, target time.Duration) (kdf celo.KDFParams, aead string) {
+	if len(kdfs) > 0 {
+		kdf = kdfs[0].params
+	}
+	for _, r := range kdfs {
+		if r.elapsed <= target {
+			kdf = r.params
+		}
+	}
+
+	var best float64
+	for _, r := range aeads {
+		if r.throughput > best {
+			best, aead = r.throughput, r.name
+		}
+	}
+	return kdf, aead
+}
+
+// formatBench table of the results and the recommended configuration.
+func formatBench(kdfs []kdfResult, aeads []aeadResult, target time.Duration) string {
+	b := new(bytes.Buffer)
+
+	fmt.Fprintln(b, "Key derivation")
+	for i, r := range kdfs {
+		current := ""
+		if i == 0 {
+			current = " (default)"
+		}
+		fmt.Fprintf(b, "  %-47s %10s\n", r.params.String()+current, r.elapsed.Round(time.Millisecond))
+	}
+
+	fmt.Fprintln(b, "\nCipher")
+	for _, r := range aeads {
+		fmt.Fprintf(b, "  %-47s %10s/s\n", r.name, formatBytes(int64(r.throughput)))
+	}
+
+	kdf, aead := recommend(kdfs, aeads, target)
+	fmt.Fprintf(b, "\nRecommended: %s, %s (key derivation up to %s)\n", aead, kdf, target)
+	// The parameters are recorded in the files, the cipher is fixed.
+	fmt.Fprintf(b, "Encrypt with these parameters using -kdf-time %d -kdf-memory %d -kdf-threads %d, or the\n", kdf.Time, kdf.Memory/1024, kdf.Threads)
+	fmt.Fprintln(b, "kdf-time, kdf-memory and kdf-threads keys of the configuration file. The cipher is always AES-256-GCM.")
+
+	return b.String()
+}
+
+func bench(args []string) (err error) {
+
+	initBenchFlags()
+	if err = parseFlags(benchCommand, args); err != nil {
+		return err
+	}
+
+	switch {
+	case benchSize < 1:
+		return errors.E(errors.Invalid, errors.Errorf("-size must be at least 1, got %d", benchSize))
+	case benchTarget <= 0:
+		return errors.E(errors.Invalid, errors.Errorf("-target must be greater than 0, got %s", benchTarget))
+	}
+
+	kdfs := make([]kdfResult, len(benchArgon2Params))
+	for i, p := range benchArgon2Params {
+		fmt.Fprintf(os.Stderr, "Measuring %s...\n", p)
+		kdfs[i] = kdfResult{params: p, elapsed: benchArgon2(p)}
+	}
+
+	names, ciphers, err := benchCiphers()
+	if err != nil {
+		return err
+	}
+	aeads := make([]aeadResult, len(ciphers))
+	for i, c := range ciphers {
+		fmt.Fprintf(os.Stderr, "Measuring %s...\n", names[i])
+		aeads[i] = aeadResult{name: names[i], throughput: benchAEAD(c, benchSize*1024*1024)}
+	}
+
+	fmt.Fprint(os.Stdout, formatBench(kdfs, aeads, benchTarget))
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+)
+
+func TestRecommend(t *testing.T) {
+	kdfs := []kdfResult{
+		{benchArgon2Params[0], 50 * time.Millisecond},
+		{benchArgon2Params[1], 100 * time.Millisecond},
+		{benchArgon2Params[2], 2 * time.Second},
+	}
+	aeads := []aeadResult{{"AES-256-GCM", 100}, {"ChaCha20-Poly1305", 200}}
+
+	kdf, aead := recommend(kdfs, aeads, time.Second)
+	if kdf != benchArgon2Params[1] || aead != "ChaCha20-Poly1305" {
+		t.Errorf("got %s, %s, want %s, ChaCha20-Poly1305", kdf, aead, benchArgon2Params[1])
+	}
+
+	// The cheapest key derivation is recommended if none is fast enough.
+	if kdf, _ := recommend(kdfs, aeads, time.Millisecond); kdf != benchArgon2Params[0] {
+		t.Errorf("got %s, want %s", kdf, benchArgon2Params[0])
+	}
+}
+
+func TestBenchArgon2Params(t *testing.T) {
+	// The first parameters are the defaults.
+	if got := benchArgon2Params[0]; got != celo.DefaultKDFParams() {
+		t.Errorf("got %s, want %s", got, celo.DefaultKDFParams())
+	}
+}
+
+func TestBenchCiphers(t *testing.T) {
+	names, ciphers, err := benchCiphers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(ciphers) {
+		t.Fatalf("got %d names for %d ciphers", len(names), len(ciphers))
+	}
+	for i, c := range ciphers {
+		if got := benchAEAD(c, 4*benchChunkSize); got <= 0 {
+			t.Errorf("%s: got a throughput of %f", names[i], got)
+		}
+	}
+}
+
+func TestFormatBench(t *testing.T) {
+	kdfs := []kdfResult{{benchArgon2Params[0], 61 * time.Millisecond}}
+	aeads := []aeadResult{{"AES-256-GCM", 2 * 1024 * 1024 * 1024}}
+
+	got := formatBench(kdfs, aeads, time.Second)
+	for _, want := range []string{
+		benchArgon2Params[0].String() + " (default)",
+		"61ms\n",
+		"2.0 GiB/s\n",
+		"Recommended: AES-256-GCM, " + benchArgon2Params[0].String(),
+		"-kdf-time 1 -kdf-memory 64 -kdf-threads 4",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q doesn't contain %q", got, want)
+		}
+	}
+}
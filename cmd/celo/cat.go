@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+const catExcludeUsage = "Exclude `file name or glob pattern` from the files written to Stdout.\n\tUseful when a glob is used as the source selector. Can be repeated."
+
+var (
+	// Exclude file names or glob patterns.
+	catExclude stringList
+)
+
+var catCommand = flag.NewFlagSet("cat", flag.ContinueOnError)
+
+func initCatFlags() {
+	catCommand.Var(&catExclude, "exclude", catExcludeUsage)
+	catCommand.Var(&include, "include", includeUsage)
+	catCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	catCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	catCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	catCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	catCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	catCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	catCommand.Var(&identities, "identity", identityUsage)
+	catCommand.StringVar(&verifyKey, "verify-key", "", verifyKeyUsage)
+}
+
+// catFile decrypts the file name, or Stdin if it is -, and writes its content
+// to w once it was authenticated, so nothing of a file that fails is written.
+func catFile(d *celo.Decrypter, secret []byte, name string, w io.Writer) error {
+	if name == stdioSource {
+		return decryptStdio(d, secret, os.Stdin, w)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	if err = decryptStdio(d, secret, f, w); err != nil {
+		return errors.E(errors.Entity(name), err)
+	}
+	return nil
+}
+
+func cat(src []string, args []string) (err error) {
+
+	initCatFlags()
+	if err = parseFlags(catCommand, args); err != nil {
+		return err
+	}
+	setupColors()
+
+	var matches []string
+
+	if isStdio(src) {
+		matches = src
+	} else if matches, err = matchSources(src, catExclude); err != nil {
+		return err
+	}
+
+	// Stdout only carries the decrypted content, there is no summary.
+	if len(matches) == 0 {
+		return errors.E(errors.NotExist, errors.Errorf("no files match %v", src))
+	}
+
+	var secret []byte
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	// Stdout carries the data and Stdin might too.
+	phrase = ttyPhrase(withAgent(phrase))
+	// A typed phrase isn't required if identities are used.
+	t, typed := phrase.(prompt)
+	prompted := typed && len(identities) == 0
+	if !typed || prompted {
+		if secret, err = phrase.Phrase(false); err != nil {
+			return err
+		}
+	}
+	// The phrase is replaced when it is asked again.
+	defer func() { celo.ZeroBytes(secret) }()
+	retry := prompted && t.Interactive()
+
+	d := celo.NewDecrypter()
+	defer d.Wipe()
+
+	if err = d.Config(celo.WithLogger(logger()), agentOption()); err != nil {
+		return err
+	}
+
+	if verifyKey != "" {
+		k, err := readVerifyingKey(verifyKey)
+		if err != nil {
+			return err
+		}
+		if err := d.Config(celo.VerifyWith(k)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range identities {
+		ids, err := readIdentities(name)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := d.Config(celo.AddIdentity(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The files are written in order and the first one that fails stops the
+	// execution. Nothing of the file that failed is written.
+	for _, name := range matches {
+		err = catFile(d, secret, name, os.Stdout)
+
+		// A typed phrase might have a typo, ask for it again. Stdin can't be
+		// read twice.
+		for attempt := 1; retry && name != stdioSource && retryPhrase(attempt) && errors.Is(errors.WrongPassphrase, err); attempt++ {
+			fmt.Fprintln(os.Stderr, errors.WrongPassphrase.String()+", try again.")
+
+			celo.ZeroBytes(secret)
+			if secret, err = phrase.Phrase(false); err != nil {
+				return err
+			}
+			err = catFile(d, secret, name, os.Stdout)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestCatFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.env.celo")
+
+	e := celo.NewEncrypter()
+	var encrypted bytes.Buffer
+	if err := encryptStdio(e, []byte("secret"), bytes.NewReader([]byte("PASSWORD=hunter2\n")), &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, encrypted.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := celo.NewDecrypter()
+	var out bytes.Buffer
+	// Files are concatenated.
+	for i := 0; i < 2; i++ {
+		if err := catFile(d, []byte("secret"), name, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := out.String(); got != "PASSWORD=hunter2\nPASSWORD=hunter2\n" {
+		t.Errorf("got %q", got)
+	}
+
+	out.Reset()
+	if err := catFile(d, []byte("wrong"), name, &out); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+	if out.Len() > 0 {
+		t.Error("content written with a wrong phrase")
+	}
+
+	if err := catFile(d, []byte("secret"), name+".missing", &out); !errors.Is(errors.Open, err) {
+		t.Errorf("got error %v, want kind Open", err)
+	}
+}
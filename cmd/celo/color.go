@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+)
+
+const noColorUsage = "Don't color the summaries. Colors are also disabled when the NO_COLOR environment variable\n\tis set or when Stdout isn't a terminal."
+
+var (
+	// Don't color the summaries.
+	noColor bool
+	// Whether the summaries are colored, see setupColors.
+	colored bool
+)
+
+// color is an ANSI escape sequence that colors the text that follows.
+type color string
+
+// Colors of the summaries.
+const (
+	colorReset color = "\x1b[0m"
+	// colorOK lines of files processed successfully.
+	colorOK color = "\x1b[32m"
+	// colorFailed lines of files that failed.
+	colorFailed color = "\x1b[31m"
+	// colorSkipped lines of files skipped.
+	colorSkipped color = "\x1b[33m"
+	// colorFile file names.
+	colorFile color = "\x1b[1m"
+)
+
+// setupColors colors the summaries when Stdout is a terminal, unless
+// --no-color is used or the NO_COLOR environment variable is set (See
+// https://no-color.org).
+func setupColors() {
+	colored = !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// paint returns s in the color c when the summaries are colored, s otherwise.
+func (c color) paint(s string) string {
+	if !colored || s == "" {
+		return s
+	}
+	return string(c) + s + string(colorReset)
+}
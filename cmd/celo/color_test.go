@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetupColors(t *testing.T) {
+	t.Cleanup(func() { noColor, colored = false, false })
+
+	// Stdout isn't a terminal while testing.
+	t.Setenv("NO_COLOR", "")
+	setupColors()
+	if colored {
+		t.Error("colored when Stdout isn't a terminal")
+	}
+
+	colored = true
+	t.Setenv("NO_COLOR", "1")
+	setupColors()
+	if colored {
+		t.Error("colored with NO_COLOR")
+	}
+
+	colored = true
+	noColor = true
+	t.Setenv("NO_COLOR", "")
+	setupColors()
+	if colored {
+		t.Error("colored with --no-color")
+	}
+}
+
+func TestPaint(t *testing.T) {
+	t.Cleanup(func() { colored = false })
+
+	if got := colorOK.paint("a.txt"); got != "a.txt" {
+		t.Errorf("without colors: got %q", got)
+	}
+
+	colored = true
+	if got := colorOK.paint("a.txt"); got != "\x1b[32ma.txt\x1b[0m" {
+		t.Errorf("with colors: got %q", got)
+	}
+	if got := colorOK.paint(""); got != "" {
+		t.Errorf("empty string: got %q", got)
+	}
+}
+
+func TestFormatColors(t *testing.T) {
+	t.Cleanup(func() { colored = false })
+
+	plain := formatEncryptedFiles([]string{"a.txt.celo"}, []error{errors.New("failed")})
+	if strings.Contains(plain, "\x1b[") {
+		t.Errorf("colors without a terminal: %q", plain)
+	}
+
+	colored = true
+	got := formatEncryptedFiles([]string{"a.txt.celo"}, []error{errors.New("failed")})
+	for _, want := range []string{
+		colorOK.paint("1 file(s) encrypted."),
+		colorFailed.paint("(1 failed)"),
+		colorFile.paint("a.txt.celo"),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary %q doesn't contain %q", got, want)
+		}
+	}
+
+	// Nothing failed, nothing to highlight.
+	if got := formatEncryptedFiles(nil, nil); got != "0 file(s) encrypted. (0 failed)\n" {
+		t.Errorf("empty summary: got %q", got)
+	}
+
+	if got := formatSkippedFiles(2); got != colorSkipped.paint("2 file(s) skipped, the output already exists.")+"\n" {
+		t.Errorf("skipped files: got %q", got)
+	}
+
+	// Results are padded before being colored, so they stay aligned.
+	got = formatVerifiedFiles([]string{"a.celo", "b.celo"}, []string{verifyIntact, verifyTruncated})
+	for _, want := range []string{
+		colorOK.paint("OK            ") + " " + colorFile.paint("a.celo"),
+		colorFailed.paint("TRUNCATED     ") + " " + colorFile.paint("b.celo"),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("verify summary %q doesn't contain %q", got, want)
+		}
+	}
+}
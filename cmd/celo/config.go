@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// configEnv names the environment variable with the path of the configuration
+// file, used instead of the default one.
+const configEnv = "CELO_CONFIG"
+
+const (
+	profileDefault = ""
+	profileUsage   = "Use the flag values of the `profile` in the configuration file (" + configEnv + " or\n\t~/.config/celo/config.toml, a subset of TOML) along with its defaults. Flags used still win.\n\tDefaults to $CELO_PROFILE."
+)
+
+// Name of the profile of the configuration file used.
+var profile string
+
+// configAliases friendlier names accepted in the configuration file for the
+// flags.
+var configAliases = map[string]string{
+	"extension":      "ext",
+	"excludes":       "exclude",
+	"includes":       "include",
+	"overwrite":      "ow",
+	"workers":        "j",
+	"jobs":           "j",
+	"remove-source":  "rm-source",
+	"no-confirm":     "nc",
+	"argon2-time":    "kdf-time",
+	"argon2-memory":  "kdf-memory",
+	"argon2-threads": "kdf-threads",
+}
+
+// configValue value of a key of the configuration file, or of an environment
+// variable, as the values given to its flag, and where it is defined, such as
+// config.toml:3 or $CELO_EXT.
+type configValue struct {
+	values []string
+	source string
+}
+
+// configTable values of the flags by name.
+type configTable map[string]configValue
+
+// config file of the celo command, in TOML:
+//
+//	ext = "secret"
+//	exclude = ["*.log", "tmp/*"]
+//
+//	[profile.work]
+//	keychain = "work"
+//	workers = 4
+//
+// Its keys are flag names or their aliases, with the values the flags would
+// be given. The keys at the top are the defaults of every command, the ones
+// of a [profile.NAME] table are used instead with -profile NAME.
+//
+// Only the subset of TOML flag values need is supported, one key = value per
+// line:
+//   - bare keys: letters, digits, - and _, which is read as -.
+//   - [profile.NAME] tables, with NAME a bare key.
+//   - "basic" strings, with the escapes of TOML, and 'literal' strings.
+//   - decimal integers, with optional _ separators, true and false.
+//   - arrays of those values on a single line.
+//   - comments from # to the end of the line.
+//
+// Anything else, such as quoted or dotted keys, other tables, inline tables,
+// multi-line strings or arrays, floats and dates, is an error naming the
+// line.
+type config struct {
+	name     string
+	defaults configTable
+	profiles map[string]configTable
+}
+
+// configPath returns the path of the configuration file: the one of
+// $CELO_CONFIG, or celo/config.toml in the configuration directory of the
+// user.
+func configPath() (string, error) {
+	if p := os.Getenv(configEnv); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.E(errors.Open, errors.Op("main.configPath"), err)
+	}
+	return filepath.Join(dir, "celo", "config.toml"), nil
+}
+
+// loadConfig reads the configuration file. It returns an empty configuration
+// if there isn't one.
+func loadConfig() (*config, error) {
+	op := errors.Op("main.loadConfig")
+
+	name, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	switch {
+	case os.IsNotExist(err):
+		return &config{name: name}, nil
+	case err != nil:
+		return nil, errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	c, err := parseConfig(name, f)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return c, nil
+}
+
+// parseConfig parses the configuration file name read from r. It returns an
+// error of kind errors.Invalid if it is malformed.
+func parseConfig(name string, r io.Reader) (*config, error) {
+	c := &config{name: name, defaults: configTable{}, profiles: map[string]configTable{}}
+	invalid := func(line int, format string, args ...interface{}) error {
+		return errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("line %d: "+format, append([]interface{}{line}, args...)...))
+	}
+
+	table := c.defaults
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+			continue
+
+		case strings.HasPrefix(text, "[["):
+			return nil, invalid(line, "arrays of tables aren't supported, only [profile.NAME] tables can be used")
+
+		case strings.HasPrefix(text, "["):
+			end := strings.Index(text, "]")
+			if end < 0 || !isConfigComment(text[end+1:]) {
+				return nil, invalid(line, "malformed table %s", text)
+			}
+			p, ok := strings.CutPrefix(strings.TrimSpace(text[1:end]), "profile.")
+			if !ok || !isConfigKey(p) {
+				return nil, invalid(line, "unsupported table %s, only [profile.NAME] tables can be used", text[:end+1])
+			}
+			if _, ok := c.profiles[p]; ok {
+				return nil, invalid(line, "profile %q defined twice", p)
+			}
+			table = configTable{}
+			c.profiles[p] = table
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		switch {
+		case ok && strings.ContainsAny(key, `."'`):
+			return nil, invalid(line, "unsupported key %s, only bare keys (letters, digits, - and _) can be used", key)
+		case !ok || !isConfigKey(key):
+			return nil, invalid(line, "expected key = value, got %s", text)
+		}
+		if alias, ok := configAliases[key]; ok {
+			key = alias
+		}
+		if _, ok := table[key]; ok {
+			return nil, invalid(line, "%s defined twice", key)
+		}
+
+		values, rest, err := parseConfigValue(strings.TrimSpace(value))
+		if err == nil && !isConfigComment(rest) {
+			err = errors.Errorf("unexpected %s after the value", strings.TrimSpace(rest))
+		}
+		if err != nil {
+			return nil, invalid(line, "%s: %v", key, err)
+		}
+		table[key] = configValue{values: values, source: fmt.Sprintf("%s:%d", name, line)}
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	return c, nil
+}
+
+// isConfigKey reports whether s is a bare key: letters, digits, - and _.
+func isConfigKey(s string) bool {
+	return s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") == ""
+}
+
+// isConfigComment reports whether s, what follows a value, is empty or a
+// comment.
+func isConfigComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// parseConfigValue parses the value at the start of s, a scalar or an array
+// of them, and returns its values and what follows it.
+func parseConfigValue(s string) ([]string, string, error) {
+	if !strings.HasPrefix(s, "[") {
+		v, rest, err := parseConfigScalar(s)
+		if err != nil {
+			return nil, "", err
+		}
+		return []string{v}, rest, nil
+	}
+
+	var values []string
+	s = strings.TrimSpace(s[1:])
+	for !strings.HasPrefix(s, "]") {
+		if strings.HasPrefix(s, "[") {
+			return nil, "", errors.Errorf("nested arrays aren't supported")
+		}
+		v, rest, err := parseConfigScalar(s)
+		if err != nil {
+			return nil, "", err
+		}
+		values = append(values, v)
+
+		s = strings.TrimSpace(rest)
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = strings.TrimSpace(s[1:])
+		case !strings.HasPrefix(s, "]"):
+			return nil, "", errors.Errorf("arrays must be on a single line, with their values separated by commas")
+		}
+	}
+	return values, s[1:], nil
+}
+
+// parseConfigScalar parses the string, integer or boolean at the start of s
+// and returns it as a flag value and what follows it.
+func parseConfigScalar(s string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return "", "", errors.Errorf("multi-line strings aren't supported")
+
+	case strings.HasPrefix(s, "{"):
+		return "", "", errors.Errorf("inline tables aren't supported")
+
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", errors.Errorf("malformed string %s", s[:i+1])
+				}
+				return v, s[i+1:], nil
+			}
+		}
+		return "", "", errors.Errorf("unterminated string %s", s)
+
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", "", errors.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
+	}
+	v := s[:end]
+	if v == "true" || v == "false" {
+		return v, s[end:], nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(v, "_", ""), 10, 64); err == nil {
+		return strconv.FormatInt(n, 10), s[end:], nil
+	}
+	if v == "" {
+		return "", "", errors.Errorf("missing value")
+	}
+	return "", "", errors.Errorf("unsupported value %s, only strings, integers, booleans and arrays of them can be used", v)
+}
+
+// table returns the values of the flags of the profile, along with the
+// defaults it doesn't replace. It returns an error of kind errors.Invalid if
+// the profile isn't defined.
+func (c *config) table(profile string) (configTable, error) {
+	values := configTable{}
+	for k, v := range c.defaults {
+		values[k] = v
+	}
+	if profile == "" {
+		return values, nil
+	}
+	p, ok := c.profiles[profile]
+	if !ok {
+		return nil, errors.E(errors.Invalid, errors.Entity(c.name), errors.Errorf("profile %q isn't defined", profile))
+	}
+	for k, v := range p {
+		values[k] = v
+	}
+	return values, nil
+}
+
+// usedFlags returns the names of the flags of fs used in the command line.
+func usedFlags(fs *flag.FlagSet) map[string]bool {
+	used := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { used[f.Name] = true })
+	return used
+}
+
+// setFlags sets the flags of fs that weren't used to their values. Values of
+// flags fs doesn't have are ignored, so the configuration file serves every
+// command.
+// It returns an error of kind errors.Invalid if a value is invalid for its
+// flag.
+func setFlags(fs *flag.FlagSet, values configTable, used map[string]bool) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f := fs.Lookup(k)
+		if f == nil || used[k] {
+			continue
+		}
+		v := values[k]
+		if _, ok := f.Value.(*stringList); !ok && len(v.values) != 1 {
+			return errors.E(errors.Invalid, errors.Entity(v.source), errors.Errorf("%s takes a single value", k))
+		}
+		for _, s := range v.values {
+			if err := fs.Set(k, s); err != nil {
+				return errors.E(errors.Invalid, errors.Entity(v.source), errors.Errorf("invalid value %q for %s: %v", s, k, err))
+			}
+		}
+	}
+	return nil
+}
+
+// applyConfig sets the flags of fs that weren't used to the values of the
+// environment variables (See envTable), or else of the configuration file,
+// with the -profile used.
+func applyConfig(fs *flag.FlagSet) error {
+	used := usedFlags(fs)
+	env := envTable(fs)
+	// $CELO_PROFILE selects the profile.
+	if v, ok := env["profile"]; ok && !used["profile"] {
+		profile = v.values[0]
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	values, err := c.table(profile)
+	if err != nil {
+		return err
+	}
+	for k, v := range env {
+		values[k] = v
+	}
+	return setFlags(fs, values, used)
+}
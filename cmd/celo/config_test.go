@@ -0,0 +1,248 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+const testConfig = `
+# Defaults of every command.
+extension = "secret"
+excludes = ["*.log", 'tmp/*'] # literal strings aren't unescaped
+min_strength = 2
+
+[profile.work]
+keychain = "work"
+workers = 4
+ow = true
+exclude = []
+`
+
+// configFlags returns a FlagSet with some of the flags of the commands, and
+// their values.
+func configFlags() (*flag.FlagSet, *string, *stringList, *int, *bool, *int, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		ext      string
+		excludes stringList
+		jobs     int
+		ow       bool
+		min      int
+		keychain string
+	)
+	fs.StringVar(&ext, "ext", extensionDefault, "")
+	fs.Var(&excludes, "exclude", "")
+	fs.IntVar(&jobs, "j", jobsDefault, "")
+	fs.BoolVar(&ow, "ow", false, "")
+	fs.IntVar(&min, "min-strength", 0, "")
+	fs.StringVar(&keychain, "keychain", "", "")
+	return fs, &ext, &excludes, &jobs, &ow, &min, &keychain
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := parseConfig("config.toml", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+
+	wantDefaults := map[string][]string{"ext": {"secret"}, "exclude": {"*.log", "tmp/*"}, "min-strength": {"2"}}
+	for k, want := range wantDefaults {
+		if got := c.defaults[k].values; !reflect.DeepEqual(got, want) {
+			t.Errorf("defaults[%s] = %q, want %q", k, got, want)
+		}
+	}
+	if len(c.defaults) != len(wantDefaults) {
+		t.Errorf("defaults = %v, want %v", c.defaults, wantDefaults)
+	}
+
+	work := c.profiles["work"]
+	if got := work["j"].values; !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("work j = %q, want 4", got)
+	}
+	if got := work["j"].source; got != "config.toml:9" {
+		t.Errorf("work j source = %s, want config.toml:9", got)
+	}
+	if v, ok := work["exclude"]; !ok || len(v.values) != 0 {
+		t.Errorf("work exclude = %v, %t, want an empty array", v, ok)
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	// Error messages expected for the syntax of TOML that isn't supported.
+	tests := map[string]string{
+		"ext":                            "",
+		"ext = ":                         "",
+		"ext = secret":                   "",
+		`ext = "secret`:                  "",
+		`ext = "a" "b"`:                  "",
+		"j = 1.5":                        "only strings, integers",
+		"since = 2024-01-02":             "only strings, integers",
+		`exclude = ["a"`:                 "single line",
+		`exclude = ["a" "b"]`:            "single line",
+		`exclude = [["a"]]`:              "nested arrays",
+		"ext = 'a'\next = 'b'":           "defined twice",
+		"[work]":                         "only [profile.NAME]",
+		"[profile.work":                  "",
+		"[profile.work]\n[profile.work]": "defined twice",
+		"[[profile.work]]":               "arrays of tables",
+		`profile.work.ext = "a"`:         "bare keys",
+		`"ext" = "a"`:                    "bare keys",
+		`ext = """a"""`:                  "multi-line strings",
+		"ext = '''a'''":                  "multi-line strings",
+		`keychain = { name = "work" }`:   "inline tables",
+	}
+
+	for s, want := range tests {
+		_, err := parseConfig("config.toml", strings.NewReader(s))
+		if !errors.Is(errors.Invalid, err) || !strings.Contains(fmt.Sprint(err), want) {
+			t.Errorf("parseConfig(%q): got error %v, want kind Invalid with %q", s, err, want)
+		}
+	}
+}
+
+// applyTestConfig sets the flags of fs that weren't used to the values of c
+// with profile.
+func applyTestConfig(c *config, fs *flag.FlagSet, profile string) error {
+	values, err := c.table(profile)
+	if err != nil {
+		return err
+	}
+	return setFlags(fs, values, usedFlags(fs))
+}
+
+func TestConfigApply(t *testing.T) {
+	c, err := parseConfig("config.toml", strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+
+	// Defaults.
+	fs, ext, excludes, jobs, ow, min, keychain := configFlags()
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyTestConfig(c, fs, ""); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if *ext != "secret" || !reflect.DeepEqual(*excludes, stringList{"*.log", "tmp/*"}) || *min != 2 || *jobs != jobsDefault || *ow || *keychain != "" {
+		t.Errorf("defaults: got ext %q, exclude %q, min-strength %d, j %d, ow %t, keychain %q", *ext, *excludes, *min, *jobs, *ow, *keychain)
+	}
+
+	// The profile replaces the defaults it defines, flags win over both.
+	fs, ext, excludes, jobs, ow, min, keychain = configFlags()
+	if err := fs.Parse([]string{"-ext", "enc", "-j", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyTestConfig(c, fs, "work"); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if *ext != "enc" || len(*excludes) != 0 || *min != 2 || *jobs != 2 || !*ow || *keychain != "work" {
+		t.Errorf("work: got ext %q, exclude %q, min-strength %d, j %d, ow %t, keychain %q", *ext, *excludes, *min, *jobs, *ow, *keychain)
+	}
+
+	// Excludes used replace the ones of the file.
+	fs, _, excludes, _, _, _, _ = configFlags()
+	if err := fs.Parse([]string{"-exclude", "*.bak"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyTestConfig(c, fs, ""); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if !reflect.DeepEqual(*excludes, stringList{"*.bak"}) {
+		t.Errorf("exclude = %q, want [*.bak]", *excludes)
+	}
+
+	// Keys of flags the command doesn't have are ignored.
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := applyTestConfig(c, fs, "work"); err != nil {
+		t.Errorf("apply without the flags: %v", err)
+	}
+}
+
+func TestConfigKDFParams(t *testing.T) {
+	defer func(time, memory, threads uint) { kdfTime, kdfMemory, kdfThreads = time, memory, threads }(kdfTime, kdfMemory, kdfThreads)
+
+	c, err := parseConfig("config.toml", strings.NewReader("[profile.slow]\nkdf-time = 3\nargon2_memory = 256\n"))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.UintVar(&kdfTime, "kdf-time", kdfTimeDefault, "")
+	fs.UintVar(&kdfMemory, "kdf-memory", kdfMemoryDefault, "")
+	fs.UintVar(&kdfThreads, "kdf-threads", kdfThreadsDefault, "")
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyTestConfig(c, fs, "slow"); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if kdfTime != 3 || kdfMemory != 256 || kdfThreads != kdfThreadsDefault {
+		t.Errorf("got kdf-time %d, kdf-memory %d, kdf-threads %d", kdfTime, kdfMemory, kdfThreads)
+	}
+	if _, err := kdfOption(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigApplyInvalid(t *testing.T) {
+	tests := []struct {
+		config, profile string
+	}{
+		{testConfig, "home"},
+		{"j = 'many'", ""},
+		{"ow = 'maybe'", ""},
+		{"ext = ['a', 'b']", ""},
+		{"[profile.work]\nj = true", "work"},
+	}
+
+	for _, tt := range tests {
+		c, err := parseConfig("config.toml", strings.NewReader(tt.config))
+		if err != nil {
+			t.Fatalf("parseConfig(%q): %v", tt.config, err)
+		}
+		fs, _, _, _, _, _, _ := configFlags()
+		if err := applyTestConfig(c, fs, tt.profile); !errors.Is(errors.Invalid, err) {
+			t.Errorf("apply(%q, %q): got error %v, want kind Invalid", tt.config, tt.profile, err)
+		}
+	}
+}
+
+func TestParseFlagsConfig(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.toml")
+	writeFile(t, name, testConfig)
+	t.Setenv(configEnv, name)
+
+	fs, ext, _, jobs, _, _, _ := configFlags()
+	if err := parseFlags(fs, []string{"-profile", "work", "-ext", "enc"}); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *ext != "enc" || *jobs != 4 {
+		t.Errorf("got ext %q, j %d, want enc, 4", *ext, *jobs)
+	}
+
+	fs, _, _, _, _, _, _ = configFlags()
+	if err := parseFlags(fs, []string{"-profile", "home"}); !errors.Is(errors.Invalid, err) {
+		t.Errorf("parseFlags with an undefined profile: got error %v, want kind Invalid", err)
+	}
+
+	// Without a configuration file only -profile fails.
+	t.Setenv(configEnv, filepath.Join(dir, "missing.toml"))
+	fs, ext, _, _, _, _, _ = configFlags()
+	if err := parseFlags(fs, nil); err != nil || *ext != extensionDefault {
+		t.Errorf("parseFlags without a file: got ext %q, error %v", *ext, err)
+	}
+	fs, _, _, _, _, _, _ = configFlags()
+	if err := parseFlags(fs, []string{"-profile", "work"}); !errors.Is(errors.Invalid, err) {
+		t.Errorf("parseFlags -profile without a file: got error %v, want kind Invalid", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"golang.org/x/term"
+)
+
+const yesUsage = "Don't ask for confirmation before overwriting existing files and removing the sources of a glob\n\tpattern or of several files. Required when there isn't a terminal to ask in, e.g. in scripts."
+
+// Assume the confirmation of destructive operations.
+var yes bool
+
+// openConfirmInput opens where the answer to a confirmation is read: Stdin
+// if it is a terminal, the controlling terminal otherwise.
+var openConfirmInput = func() (io.ReadCloser, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return openTTY()
+}
+
+// isDestructive reports whether processing the matches of src overwrites
+// existing files and removes the sources of a glob pattern or of several
+// files, where a wrong pattern can cost many files.
+func isDestructive(src, matches []string, onCollision celo.Collision) bool {
+	if !removeSource || (!overwrite && onCollision != celo.CollisionOverwrite) {
+		return false
+	}
+	if len(matches) > 1 {
+		return true
+	}
+	for _, s := range src {
+		if strings.ContainsAny(s, `*?[`) && s != filepath.Clean(matches[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// confirmDestructive asks for the confirmation of a destructive operation
+// (See isDestructive) on the matches, verb describes it, e.g. "Encrypt".
+// Nothing is asked with -yes.
+// It returns an error of kind errors.Canceled if it isn't confirmed, or of
+// kind errors.Invalid if there isn't a terminal to ask in.
+func confirmDestructive(verb string, src, matches []string, onCollision celo.Collision) error {
+	if yes || !isDestructive(src, matches, onCollision) {
+		return nil
+	}
+
+	in, err := openConfirmInput()
+	if err != nil {
+		return errors.E(errors.Invalid, errors.Errorf("-rm-source with -ow on several files must be confirmed, use -yes when there isn't a terminal"))
+	}
+	defer in.Close()
+
+	question := fmt.Sprintf("%s %d file(s), overwriting existing files and removing the sources?", verb, len(matches))
+	return confirm(in, os.Stderr, question)
+}
+
+// confirm writes question to w and reads the answer from r. It returns an
+// error of kind errors.Canceled unless the answer is y or yes.
+func confirm(r io.Reader, w io.Writer, question string) error {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(w)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.E(errors.Canceled, errors.Errorf("not confirmed"))
+}
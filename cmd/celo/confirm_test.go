@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := map[string]bool{
+		"y\n":      true,
+		" YES\r\n": true,
+		"yes":      true,
+		"n\n":      false,
+		"\n":       false,
+		"":         false,
+		"sure\n":   false,
+	}
+	for answer, want := range tests {
+		var w bytes.Buffer
+		err := confirm(strings.NewReader(answer), &w, "Encrypt 2 file(s)?")
+		if got := err == nil; got != want {
+			t.Errorf("answer %q: got error %v", answer, err)
+		}
+		if err != nil && !errors.Is(errors.Canceled, err) {
+			t.Errorf("answer %q: got error %v, want kind Canceled", answer, err)
+		}
+		if !strings.HasPrefix(w.String(), "Encrypt 2 file(s)? [y/N] ") {
+			t.Errorf("answer %q: asked %q", answer, w.String())
+		}
+	}
+}
+
+func TestIsDestructive(t *testing.T) {
+	t.Cleanup(func() { overwrite, removeSource = overwriteDefault, removeSourceDefault })
+
+	tests := []struct {
+		overwrite, remove bool
+		collision         celo.Collision
+		src, matches      []string
+		want              bool
+	}{
+		{true, true, celo.CollisionFail, []string{"a.txt", "b.txt"}, []string{"a.txt", "b.txt"}, true},
+		{true, true, celo.CollisionFail, []string{"*.txt"}, []string{"a.txt"}, true},
+		{false, true, celo.CollisionOverwrite, []string{"*.txt"}, []string{"a.txt", "b.txt"}, true},
+		{true, true, celo.CollisionFail, []string{"a.txt"}, []string{"a.txt"}, false},
+		// A file whose name looks like a pattern.
+		{true, true, celo.CollisionFail, []string{"a[1].txt"}, []string{"a[1].txt"}, false},
+		{true, false, celo.CollisionFail, []string{"*.txt"}, []string{"a.txt", "b.txt"}, false},
+		{false, true, celo.CollisionRename, []string{"*.txt"}, []string{"a.txt", "b.txt"}, false},
+	}
+	for _, tt := range tests {
+		overwrite, removeSource = tt.overwrite, tt.remove
+		if got := isDestructive(tt.src, tt.matches, tt.collision); got != tt.want {
+			t.Errorf("-ow %t -rm-source %t -on-collision %s %q: got %t, want %t", tt.overwrite, tt.remove, tt.collision, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmDestructive(t *testing.T) {
+	original := openConfirmInput
+	t.Cleanup(func() {
+		openConfirmInput = original
+		overwrite, removeSource, yes = overwriteDefault, removeSourceDefault, false
+	})
+	answer := func(s string) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(s)), nil }
+	}
+	src, matches := []string{"*.txt"}, []string{"a.txt", "b.txt"}
+	overwrite, removeSource = true, true
+
+	openConfirmInput = answer("y\n")
+	if err := confirmDestructive("Encrypt", src, matches, celo.CollisionFail); err != nil {
+		t.Errorf("confirmed: %v", err)
+	}
+	openConfirmInput = answer("n\n")
+	if err := confirmDestructive("Encrypt", src, matches, celo.CollisionFail); !errors.Is(errors.Canceled, err) {
+		t.Errorf("not confirmed: got error %v, want kind Canceled", err)
+	}
+
+	openConfirmInput = func() (io.ReadCloser, error) { return nil, os.ErrNotExist }
+	if err := confirmDestructive("Encrypt", src, matches, celo.CollisionFail); !errors.Is(errors.Invalid, err) {
+		t.Errorf("without a terminal: got error %v, want kind Invalid", err)
+	}
+	// -yes doesn't ask.
+	yes = true
+	if err := confirmDestructive("Encrypt", src, matches, celo.CollisionFail); err != nil {
+		t.Errorf("-yes: %v", err)
+	}
+}
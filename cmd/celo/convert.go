@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+const (
+	convertExcludeUsage = "Exclude `file name or glob pattern` from the conversion.\n\tUseful when a glob is used as the source selector. Can be repeated."
+
+	toVersionDefault = celo.Version
+	toVersionUsage   = "Format `version` the files are converted to. Only the current version is supported.\n\tFiles in this version or newer only get a new stanza for the phrase if it wasn't derived\n\twith -kdf-time, -kdf-memory and -kdf-threads, they are left as they are otherwise."
+)
+
+var (
+	// Exclude file names or glob patterns.
+	convertExclude stringList
+	// Format version the files are converted to.
+	toVersion int
+)
+
+var convertCommand = flag.NewFlagSet("convert", flag.ContinueOnError)
+
+func initConvertFlags() {
+	convertCommand.IntVar(&toVersion, "to-version", toVersionDefault, toVersionUsage)
+	convertCommand.Var(&convertExclude, "exclude", convertExcludeUsage)
+	convertCommand.UintVar(&kdfTime, "kdf-time", kdfTimeDefault, kdfTimeUsage)
+	convertCommand.UintVar(&kdfMemory, "kdf-memory", kdfMemoryDefault, kdfMemoryUsage)
+	convertCommand.UintVar(&kdfThreads, "kdf-threads", kdfThreadsDefault, kdfThreadsUsage)
+	convertCommand.Var(&include, "include", includeUsage)
+	convertCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	convertCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	convertCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	convertCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	convertCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	convertCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	convertCommand.BoolVar(&jsonOutput, "json", false, jsonUsage)
+	convertCommand.BoolVar(&quiet, "q", false, quietUsage)
+	convertCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	convertCommand.BoolVar(&debug, "vv", false, debugUsage)
+	convertCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+	convertCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// checkToVersion returns an error of kind errors.Invalid if files can't be
+// converted to -to-version, before the phrase is asked.
+func checkToVersion() error {
+	if toVersion != celo.Version {
+		return errors.E(errors.Invalid, errors.Errorf("-to-version %d: files can only be converted to version %d", toVersion, celo.Version))
+	}
+	return nil
+}
+
+// convertFile converts the file name to -to-version and the -kdf-* parameters
+// (See celo.ConvertFile).
+// It returns an error of kind errors.Skipped if the file is already up to
+// date, and of kind errors.Metadata if it wasn't encrypted by Celo.
+func convertFile(secret []byte, name string, opts ...celo.Option) (string, error) {
+	_, ok, err := sniffFile(name)
+	switch {
+	case err != nil:
+		return "", err
+	case !ok:
+		return "", errors.E(errors.Metadata, errors.Entity(name), errors.Errorf("not encrypted by celo"))
+	}
+
+	if err = celo.ConvertFile(secret, name, byte(toVersion), opts...); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func convert(src []string, args []string) (err error) {
+
+	initConvertFlags()
+	if err = parseFlags(convertCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	if err = checkToVersion(); err != nil {
+		return err
+	}
+	kdf, err := kdfOption()
+	if err != nil {
+		return err
+	}
+	setupColors()
+
+	matches, err := matchSources(src, convertExclude)
+	if err != nil {
+		return err
+	}
+
+	// Print to Stdout the final list of files that are going to be converted.
+	if !jsonOutput {
+		fmt.Fprintln(summaries(), formatGlobMatches(matches))
+	}
+
+	if len(matches) == 0 {
+		return newJSONReport("convert").print(os.Stdout)
+	}
+
+	// The phrase is asked once, every file is expected to be encrypted with
+	// it.
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	phrase = withAgent(phrase)
+	secret, err := phrase.Phrase(false)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(secret)
+
+	opts := []celo.Option{celo.WithLogger(logger()), agentOption(), kdf}
+
+	rep := newJSONReport("convert")
+	results := make([]celo.FileResult, len(matches))
+	var first error
+	failed := 0
+	for i, name := range matches {
+		results[i] = fileResult(name, func() (string, error) { return convertFile(secret, name, opts...) })
+		if results[i].Err != nil {
+			if first == nil {
+				first = results[i].Err
+			}
+			failed++
+		}
+	}
+	rep.add(results...)
+
+	if rep != nil {
+		if err = rep.print(os.Stdout); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(summaries(), formatConvertedFiles(results))
+	}
+
+	if failed > 0 {
+		// The exit code tells why the first file failed (See exitCode).
+		return errors.E(errorKind(first), errors.Errorf("%d file(s) couldn't be converted", failed))
+	}
+
+	return nil
+}
+
+// formatConvertedFiles summary of the conversion of each file.
+func formatConvertedFiles(results []celo.FileResult) string {
+	converted, errs, skipped := splitResults(results)
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%d file(s) converted to version %d. (%d up to date, %d failed)\n\n", len(converted), toVersion, skipped, len(errs))
+
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(b, "  %s %s\n", colorSkipped.paint("UP TO DATE"), colorFile.paint(r.Source))
+		case r.Err != nil:
+			fmt.Fprintf(b, "  %s %s: %s\n", colorFailed.paint("FAILED    "), colorFile.paint(r.Source), errorKind(r.Err))
+		default:
+			fmt.Fprintf(b, "  %s %s\n", colorOK.paint("CONVERTED "), colorFile.paint(r.Source))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// writeVersion1 writes plaintext encrypted with phrase in the format of
+// version 1 (metadata | salt | nonce | ciphertext) to dir.
+func writeVersion1(t *testing.T, dir string, phrase, plaintext []byte) string {
+	t.Helper()
+
+	m, err := celo.NewMetadata(1, celo.SaltSize, celo.Aes256BlockSize, celo.NonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := make([]byte, celo.SaltSize)
+	if _, err = rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	c, err := celo.NewCipher(celo.Aes256BlockSize, celo.NonceSize, celo.GenerateKey(phrase, salt, celo.Aes256BlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, ciphertext, err := c.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, "v1.celo")
+	if err = os.WriteFile(name, bytes.Join([][]byte{m.Bytes(), salt, nonce, ciphertext}, nil), 0640); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestConvertFile(t *testing.T) {
+	t.Cleanup(func() { toVersion = 0 })
+	toVersion = celo.Version
+
+	dir := t.TempDir()
+	v1 := writeVersion1(t, dir, []byte("secret"), []byte("attack at dawn"))
+
+	if _, err := convertFile([]byte("wrong"), v1); err == nil {
+		t.Error("wrong phrase: converted")
+	}
+	if lf, _, _ := sniffFile(v1); lf.version != 1 {
+		t.Errorf("file modified after a failed conversion: version %d", lf.version)
+	}
+
+	out, err := convertFile([]byte("secret"), v1)
+	if err != nil || out != v1 {
+		t.Fatalf("got %q, %v", out, err)
+	}
+	if lf, _, _ := sniffFile(v1); lf.version != celo.Version {
+		t.Errorf("converted to version %d, want %d", lf.version, celo.Version)
+	}
+	d := celo.NewDecrypter()
+	if got, err := d.DecryptFile([]byte("secret"), v1, false, false); err != nil {
+		t.Errorf("converted file: %v", err)
+	} else if b, _ := os.ReadFile(got); string(b) != "attack at dawn" {
+		t.Errorf("converted file content %q", b)
+	}
+
+	// Files in the current version are skipped.
+	if _, err = convertFile([]byte("secret"), v1); !errors.Is(errors.Skipped, err) {
+		t.Errorf("current version: got %v, want kind Skipped", err)
+	}
+
+	plain := filepath.Join(dir, "plain.txt")
+	if err = os.WriteFile(plain, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = convertFile([]byte("secret"), plain); exitCode(err) != exitNotCelo {
+		t.Errorf("plain file: got %v, want exit code %d", err, exitNotCelo)
+	}
+}
+
+func TestCheckToVersion(t *testing.T) {
+	t.Cleanup(func() { toVersion = 0 })
+
+	toVersion = celo.Version
+	if err := checkToVersion(); err != nil {
+		t.Errorf("version %d: got %v", toVersion, err)
+	}
+	for _, v := range []int{1, celo.Version + 1, -1} {
+		toVersion = v
+		if err := checkToVersion(); !errors.Is(errors.Invalid, err) {
+			t.Errorf("version %d: got %v, want kind Invalid", v, err)
+		}
+	}
+}
+
+func TestFormatConvertedFiles(t *testing.T) {
+	t.Cleanup(func() { toVersion = 0 })
+	toVersion = celo.Version
+
+	got := formatConvertedFiles([]celo.FileResult{
+		{Source: "a.celo", Output: "a.celo"},
+		{Source: "b.celo", Skipped: true},
+		{Source: "c.celo", Err: errors.E(errors.Metadata, errors.Errorf("invalid"))},
+	})
+	for _, want := range []string{
+		"1 file(s) converted to version 2. (1 up to date, 1 failed)\n",
+		"  CONVERTED  a.celo\n",
+		"  UP TO DATE b.celo\n",
+		"  FAILED     c.celo: " + errors.Metadata.String() + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary %q doesn't contain %q", got, want)
+		}
+	}
+}
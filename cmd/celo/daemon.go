@@ -0,0 +1,545 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/celopb"
+	"github.com/rrivera/celo/errors"
+)
+
+// daemonTokenEnv environment variable with the token of the calls to the
+// daemon. A random one is generated if it isn't set.
+const daemonTokenEnv = "CELO_DAEMON_TOKEN"
+
+// daemonKindMetadata trailer of the calls that failed with the code of the
+// kind of their error (See errors.Kind).
+const daemonKindMetadata = "celo-kind-code"
+
+const (
+	daemonListenDefault = "127.0.0.1:7700"
+	daemonListenUsage   = "`address` the daemon listens on. Only loopback addresses, such as 127.0.0.1, [::1]\n\tor localhost, are accepted: calls and phrases aren't encrypted in transit."
+
+	daemonIdleTimeoutDefault = 15 * time.Minute
+	daemonIdleTimeoutUsage   = "Close the sessions that weren't used for `duration`, forgetting their phrase and keys,\n\tunless they ask for another timeout."
+)
+
+// Limits of the gRPC server.
+const (
+	// daemonChunkSize maximum size of the data of the messages sent.
+	daemonChunkSize = 64 << 10
+	// daemonSweepInterval how often idle sessions are closed.
+	daemonSweepInterval = time.Minute
+	// daemonShutdownTimeout time the calls in flight have to finish once
+	// the daemon is stopped.
+	daemonShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// Address the daemon listens on.
+	daemonListen string
+	// Time sessions are kept without being used.
+	daemonIdleTimeout time.Duration
+	// File the token is written to.
+	daemonTokenFile string
+)
+
+var daemonCommand = flag.NewFlagSet("daemon", flag.ContinueOnError)
+
+func initDaemonFlags() {
+	daemonCommand.StringVar(&daemonListen, "listen", daemonListenDefault, daemonListenUsage)
+	daemonCommand.DurationVar(&daemonIdleTimeout, "idle-timeout", daemonIdleTimeoutDefault, daemonIdleTimeoutUsage)
+	daemonCommand.StringVar(&daemonTokenFile, "token-file", "", serveTokenFileUsage)
+	daemonCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	daemonCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	daemonCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	daemonCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	daemonCommand.BoolVar(&noConfirm, "nc", noConfirmDefault, noConfirmUsage)
+	daemonCommand.IntVar(&minStrength, "min-strength", minStrengthDefault, minStrengthUsage)
+	daemonCommand.BoolVar(&quiet, "q", false, quietUsage)
+	daemonCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	daemonCommand.BoolVar(&debug, "vv", false, debugUsage)
+	daemonCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+}
+
+// daemonServer implements the Daemon service: sessions, and encrypting,
+// decrypting and inspecting the files streamed to it. It is safe for
+// concurrent use.
+type daemonServer struct {
+	celopb.UnimplementedDaemonServer
+
+	// secret phrase of the sessions created without their own.
+	secret []byte
+	// token calls are authenticated with.
+	token string
+	// idleTimeout default time sessions are kept without being used.
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*daemonSession
+	// now returns the current time.
+	now func() time.Time
+}
+
+// daemonSession phrase, and the keys derived from it, of the calls that name
+// the session.
+type daemonSession struct {
+	secret []byte
+	keys   *celo.KeyCache
+	// reuseKey encrypts every file with the key derived the first time.
+	reuseKey bool
+	idle     time.Duration
+	// expires time when the session is closed unless it is used, and active
+	// number of calls using it, which keep it open. Both are guarded by the
+	// mutex of the server.
+	expires time.Time
+	active  int
+}
+
+// newDaemonServer creates a daemonServer with the phrase secret, which
+// sessions can be created with, and token.
+func newDaemonServer(secret []byte, token string, idleTimeout time.Duration) *daemonServer {
+	return &daemonServer{
+		secret:      secret,
+		token:       token,
+		idleTimeout: idleTimeout,
+		sessions:    map[string]*daemonSession{},
+		now:         time.Now,
+	}
+}
+
+// grpcServer returns a gRPC server of s that authenticates the calls.
+func (s *daemonServer) grpcServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.UnaryInterceptor(s.unary), grpc.StreamInterceptor(s.stream))
+	celopb.RegisterDaemonServer(srv, s)
+	return srv
+}
+
+// authorize returns an error with the code Unauthenticated unless the call
+// has the token of the server in its authorization metadata.
+func (s *daemonServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if auth, ok := strings.CutPrefix(v, "Bearer "); ok && subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// unary authenticates the unary calls and reports their errors with a status.
+func (s *daemonServer) unary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	res, err := handler(ctx, req)
+	if err != nil {
+		return nil, daemonStatus(ctx, err)
+	}
+	return res, nil
+}
+
+// stream authenticates the streaming calls and reports their errors with a
+// status.
+func (s *daemonServer) stream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context()); err != nil {
+		return err
+	}
+	if err := handler(srv, ss); err != nil {
+		return daemonStatus(ss.Context(), err)
+	}
+	return nil
+}
+
+// CreateSession creates a session with the phrase of the request, or of the
+// server. It returns an error of kind errors.PhraseIsEmpty if neither has one.
+func (s *daemonServer) CreateSession(_ context.Context, req *celopb.CreateSessionRequest) (*celopb.Session, error) {
+	op := errors.Op("main.CreateSession")
+
+	if req.IdleTimeoutSeconds < 0 {
+		return nil, errors.E(errors.Invalid, op, errors.Errorf("the idle timeout can't be negative, got %d", req.IdleTimeoutSeconds))
+	}
+	idle := time.Duration(req.IdleTimeoutSeconds) * time.Second
+	if idle == 0 {
+		idle = s.idleTimeout
+	}
+
+	var secret []byte
+	switch {
+	case len(req.Phrase) > 0:
+		secret = append([]byte(nil), req.Phrase...)
+		celo.ZeroBytes(req.Phrase)
+	case len(s.secret) > 0:
+		secret = append([]byte(nil), s.secret...)
+	default:
+		return nil, errors.E(errors.PhraseIsEmpty, op, errors.Errorf("the request has no phrase and the daemon none"))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		celo.ZeroBytes(secret)
+		return nil, errors.E(errors.Internal, op, errors.Errorf("unable to generate a session: %v", err))
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked()
+	s.sessions[id] = &daemonSession{
+		secret:   secret,
+		keys:     celo.NewKeyCache(0, 0),
+		reuseKey: req.ReuseKey,
+		idle:     idle,
+		expires:  s.now().Add(idle),
+	}
+	return &celopb.Session{Id: id, IdleTimeoutSeconds: int64(idle / time.Second)}, nil
+}
+
+// CloseSession closes a session, zeroing its phrase and forgetting its keys.
+// Calls in flight finish with the phrase they started with.
+func (s *daemonServer) CloseSession(_ context.Context, req *celopb.CloseSessionRequest) (*celopb.CloseSessionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[req.SessionId]
+	if !ok {
+		return nil, errors.E(errors.NotExist, errors.Op("main.CloseSession"), errors.Errorf("no session %q", req.SessionId))
+	}
+	s.closeLocked(req.SessionId, sess)
+	return &celopb.CloseSessionResponse{}, nil
+}
+
+// closeLocked closes the session id. s.mu must be held.
+func (s *daemonServer) closeLocked(id string, sess *daemonSession) {
+	celo.ZeroBytes(sess.secret)
+	sess.keys.Clear()
+	delete(s.sessions, id)
+}
+
+// expireLocked closes the sessions that weren't used for their idle timeout.
+// s.mu must be held.
+func (s *daemonServer) expireLocked() {
+	now := s.now()
+	for id, sess := range s.sessions {
+		if sess.active == 0 && !now.Before(sess.expires) {
+			s.closeLocked(id, sess)
+		}
+	}
+}
+
+// expire closes the sessions that weren't used for their idle timeout.
+func (s *daemonServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked()
+}
+
+// closeAll closes every session.
+func (s *daemonServer) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, sess := range s.sessions {
+		s.closeLocked(id, sess)
+	}
+}
+
+// acquire returns the session id, which is kept open until release is called,
+// and a copy of its phrase, zeroed by release. It returns an error of kind
+// errors.NotExist if there is no such session, or it expired.
+func (s *daemonServer) acquire(id string) (sess *daemonSession, secret []byte, release func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, nil, nil, errors.E(errors.NotExist, errors.Op("main.acquire"), errors.Errorf("no session %q, it might have expired", id))
+	}
+	sess.active++
+	secret = append([]byte(nil), sess.secret...)
+
+	return sess, secret, func() {
+		celo.ZeroBytes(secret)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sess.active--
+		sess.expires = s.now().Add(sess.idle)
+	}, nil
+}
+
+// firstMessage returns the error of the streams whose first message couldn't
+// be received.
+func firstMessage(err error) error {
+	if err == io.EOF {
+		return errors.E(errors.Invalid, errors.Errorf("the first message must name the session"))
+	}
+	return err
+}
+
+// Encrypt encrypts the content streamed by the client with the phrase of the
+// session named by the first message, and streams the encrypted file back.
+func (s *daemonServer) Encrypt(stream celopb.Daemon_EncryptServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return firstMessage(err)
+	}
+	padding := celo.PaddingNone
+	if first.Padding != "" {
+		if padding, err = parsePadding(first.Padding); err != nil {
+			return err
+		}
+	}
+
+	sess, secret, release, err := s.acquire(first.SessionId)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	e := celo.NewEncrypter()
+	defer e.Wipe()
+	err = e.Config(celo.SetPadding(padding), celo.PreserveKey(sess.reuseKey), celo.WithKeyCache(sess.keys), celo.WithLogger(logger()), agentOption())
+	if err != nil {
+		return err
+	}
+
+	r := &daemonReader{data: first.Data, recv: func() ([]byte, error) {
+		m, err := stream.Recv()
+		return m.GetData(), err
+	}}
+	_, err = e.EncryptStreamContext(stream.Context(), secret, r, daemonWriter(stream.Send))
+	return err
+}
+
+// Decrypt decrypts the encrypted file streamed by the client with the phrase
+// of the session named by the first message, and streams its content back,
+// each chunk once it was authenticated. The client must discard what it
+// received if the call fails.
+func (s *daemonServer) Decrypt(stream celopb.Daemon_DecryptServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return firstMessage(err)
+	}
+
+	sess, secret, release, err := s.acquire(first.SessionId)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	d := celo.NewDecrypter()
+	defer d.Wipe()
+	if err = d.Config(celo.WithKeyCache(sess.keys), celo.WithLogger(logger()), agentOption()); err != nil {
+		return err
+	}
+
+	r := &daemonReader{data: first.Data, recv: func() ([]byte, error) {
+		m, err := stream.Recv()
+		return m.GetData(), err
+	}}
+	_, err = d.DecryptStreamContext(stream.Context(), secret, r, daemonWriter(stream.Send))
+	return err
+}
+
+// Inspect returns the details of the encrypted file streamed by the client.
+// No session is required.
+func (s *daemonServer) Inspect(stream celopb.Daemon_InspectServer) error {
+	info, err := celo.Inspect(&daemonReader{recv: func() ([]byte, error) {
+		m, err := stream.Recv()
+		return m.GetData(), err
+	}})
+	if err != nil {
+		return err
+	}
+
+	res := &celopb.FileInfo{
+		Version:     int32(info.Version),
+		Cipher:      info.Cipher,
+		Kdf:         info.KDF,
+		Padding:     info.Padding.String(),
+		Envelope:    info.Envelope,
+		ChunkSize:   int32(info.ChunkSize),
+		Signed:      info.Signed,
+		Trailer:     info.Trailer,
+		Archive:     info.Archive,
+		HeaderSize:  int32(info.HeaderSize),
+		PayloadSize: info.PayloadSize,
+		Size:        info.Size,
+	}
+	for _, t := range info.Recipients {
+		res.Recipients = append(res.Recipients, t.String())
+	}
+	return stream.SendAndClose(res)
+}
+
+// daemonReader reads the data of the messages of a stream, starting with
+// data, until the client closes its side of it.
+type daemonReader struct {
+	data []byte
+	// recv returns the data of the next message.
+	recv func() ([]byte, error)
+	err  error
+}
+
+func (r *daemonReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.data, r.err = r.recv()
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// daemonWriter writes by sending Chunk messages of up to daemonChunkSize
+// bytes.
+type daemonWriter func(*celopb.Chunk) error
+
+func (send daemonWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		end := min(len(p), n+daemonChunkSize)
+		if err := send(&celopb.Chunk{Data: p[n:end]}); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return n, nil
+}
+
+// daemonStatus returns err as the status of the call, with the kind of err in
+// its celo-kind-code trailer.
+func daemonStatus(ctx context.Context, err error) error {
+	if _, ok := status.FromError(err); ok {
+		// Already a status, e.g. of a stream that broke.
+		return err
+	}
+
+	kind := errorKind(err)
+	grpc.SetTrailer(ctx, metadata.Pairs(daemonKindMetadata, fmt.Sprint(uint16(kind))))
+
+	code := status.Code(err)
+	switch kind {
+	case errors.Invalid, errors.Padding, errors.PhraseIsEmpty:
+		code = codes.InvalidArgument
+	case errors.WrongPassphrase, errors.Ciphertext, errors.Signature, errors.Sign, errors.Truncated,
+		errors.Metadata, errors.Incompatible, errors.Decode, errors.Nonce, errors.NonceSize,
+		errors.Salt, errors.SaltSize, errors.BlockSize:
+		code = codes.FailedPrecondition
+	case errors.NotExist:
+		code = codes.NotFound
+	case errors.Canceled:
+		code = codes.Canceled
+	default:
+		if code == codes.Unknown {
+			code = codes.Internal
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+func daemon(args []string) (err error) {
+
+	initDaemonFlags()
+	if err = parseFlags(daemonCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	if err = checkLoopback(daemonListen); err != nil {
+		return err
+	}
+	if daemonIdleTimeout <= 0 {
+		return errors.E(errors.Invalid, errors.Errorf("-idle-timeout must be positive, got %v", daemonIdleTimeout))
+	}
+	min, err := checkMinStrength()
+	if err != nil {
+		return err
+	}
+
+	token, generated, err := serveToken(os.Getenv, daemonTokenEnv)
+	if err != nil {
+		return err
+	}
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	// Stdout carries the token.
+	secret, err := strongPhrase(ttyPhrase(withAgent(phrase)), min).Phrase(!noConfirm)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(secret)
+	if err = checkPhraseStrength(secret, min); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", daemonListen)
+	if err != nil {
+		return errors.E(errors.Create, errors.Entity(daemonListen), err)
+	}
+
+	switch {
+	case daemonTokenFile != "":
+		if err = writeServeToken(daemonTokenFile, token); err != nil {
+			l.Close()
+			return err
+		}
+	case generated:
+		fmt.Printf("%s=%s; export %s;\n", daemonTokenEnv, token, daemonTokenEnv)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Daemon listening on %s, stop it with Ctrl+C.\n", l.Addr())
+	}
+
+	s := newDaemonServer(secret, token, daemonIdleTimeout)
+	defer s.closeAll()
+	srv := s.grpcServer()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		sweep := time.NewTicker(daemonSweepInterval)
+		defer sweep.Stop()
+		for {
+			select {
+			case <-sweep.C:
+				s.expire()
+			case <-stop:
+				// The calls in flight are answered first.
+				t := time.AfterFunc(daemonShutdownTimeout, srv.Stop)
+				srv.GracefulStop()
+				t.Stop()
+				return
+			}
+		}
+	}()
+
+	if err = srv.Serve(l); err != nil {
+		return errors.E(errors.Other, errors.Op("main.daemon"), err)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/celopb"
+)
+
+// newTestDaemon returns a daemon with the phrase "secret" and the token
+// "t0k3n", and a client connected to it.
+func newTestDaemon(t *testing.T) (*daemonServer, celopb.DaemonClient) {
+	t.Helper()
+	s := newDaemonServer([]byte("secret"), "t0k3n", time.Minute)
+	srv := s.grpcServer()
+	l := bufconn.Listen(1 << 20)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, celopb.NewDaemonClient(conn)
+}
+
+// withToken returns a context whose calls are authenticated with token.
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// daemonEncrypt encrypts data with the session id, sent in two messages.
+func daemonEncrypt(t *testing.T, c celopb.DaemonClient, id string, data []byte) ([]byte, error) {
+	t.Helper()
+	stream, err := c.Encrypt(withToken("t0k3n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(data) / 2
+	if err = stream.Send(&celopb.EncryptRequest{SessionId: id, Padding: "padme", Data: data[:half]}); err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&celopb.EncryptRequest{Data: data[half:]}); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	return recvChunks(stream)
+}
+
+// daemonDecrypt decrypts blob with the session id.
+func daemonDecrypt(t *testing.T, c celopb.DaemonClient, id string, blob []byte) ([]byte, error) {
+	t.Helper()
+	stream, err := c.Decrypt(withToken("t0k3n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stream.Send(&celopb.DecryptRequest{SessionId: id, Data: blob}); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	return recvChunks(stream)
+}
+
+// recvChunks returns the data of the chunks received until the end of the
+// stream.
+func recvChunks(stream interface{ Recv() (*celopb.Chunk, error) }) ([]byte, error) {
+	var b []byte
+	for {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return b, err
+		}
+		b = append(b, c.Data...)
+	}
+}
+
+func TestDaemonServer(t *testing.T) {
+	s, c := newTestDaemon(t)
+
+	if _, err := c.CreateSession(withToken("wrong"), &celopb.CreateSessionRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong token: got %v, want code Unauthenticated", err)
+	}
+	if _, err := c.CreateSession(context.Background(), &celopb.CreateSessionRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: got %v, want code Unauthenticated", err)
+	}
+
+	sess, err := c.CreateSession(withToken("t0k3n"), &celopb.CreateSessionRequest{ReuseKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.IdleTimeoutSeconds != 60 {
+		t.Errorf("got idle timeout %ds, want the one of the daemon", sess.IdleTimeoutSeconds)
+	}
+
+	// Larger than a chunk, so the file is streamed back in several messages.
+	content := bytes.Repeat([]byte("attack at dawn "), 10000)
+	blob, err := daemonEncrypt(t, c, sess.Id, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := celo.DecryptBytes([]byte("secret"), blob); err != nil || !bytes.Equal(plaintext, content) {
+		t.Fatalf("decrypted %d bytes, %v", len(plaintext), err)
+	}
+	plaintext, err := daemonDecrypt(t, c, sess.Id, blob)
+	if err != nil || !bytes.Equal(plaintext, content) {
+		t.Errorf("decrypted %d bytes, %v", len(plaintext), err)
+	}
+
+	// The key of the session is derived once.
+	if _, err = daemonEncrypt(t, c, sess.Id, []byte("retreat")); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.sessions[sess.Id].keys.Len(); n != 1 {
+		t.Errorf("session has %d keys, want 1", n)
+	}
+
+	info, err := inspectBlob(c, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Padding != "padme" || info.Size != int64(len(blob)) {
+		t.Errorf("got %+v", info)
+	}
+	if _, err = inspectBlob(c, []byte("not a celo file")); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("inspect garbage: got %v, want code FailedPrecondition", err)
+	}
+
+	// A damaged file fails, even once part of its content was streamed back.
+	damaged := append([]byte(nil), blob...)
+	damaged[len(damaged)-celo.TrailerSize-1] ^= 1
+	if _, err = daemonDecrypt(t, c, sess.Id, damaged); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("damaged file: got %v, want code FailedPrecondition", err)
+	}
+
+	// Sessions of other phrases can't decrypt the file.
+	other, err := c.CreateSession(withToken("t0k3n"), &celopb.CreateSessionRequest{Phrase: []byte("other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = daemonDecrypt(t, c, other.Id, blob)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("wrong phrase: got %v, want code FailedPrecondition", err)
+	}
+
+	if _, err = c.CloseSession(withToken("t0k3n"), &celopb.CloseSessionRequest{SessionId: sess.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = daemonDecrypt(t, c, sess.Id, blob); status.Code(err) != codes.NotFound {
+		t.Errorf("closed session: got %v, want code NotFound", err)
+	}
+	if _, err = c.CloseSession(withToken("t0k3n"), &celopb.CloseSessionRequest{SessionId: sess.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("closing a closed session: got %v, want code NotFound", err)
+	}
+
+	stream, err := c.Encrypt(withToken("t0k3n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&celopb.EncryptRequest{SessionId: other.Id, Padding: "nope"})
+	stream.CloseSend()
+	if _, err = recvChunks(stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unknown padding: got %v, want code InvalidArgument", err)
+	}
+	if kind := stream.Trailer().Get(daemonKindMetadata); len(kind) != 1 || kind[0] == "0" {
+		t.Errorf("got kind %q in the trailer", kind)
+	}
+}
+
+// inspectBlob streams blob to Inspect.
+func inspectBlob(c celopb.DaemonClient, blob []byte) (*celopb.FileInfo, error) {
+	stream, err := c.Inspect(withToken("t0k3n"))
+	if err != nil {
+		return nil, err
+	}
+	if err = stream.Send(&celopb.Chunk{Data: blob}); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestDaemonSessionExpiry(t *testing.T) {
+	s := newDaemonServer(nil, "t0k3n", time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if _, err := s.CreateSession(ctx, &celopb.CreateSessionRequest{}); err == nil {
+		t.Error("created a session without a phrase")
+	}
+	if _, err := s.CreateSession(ctx, &celopb.CreateSessionRequest{Phrase: []byte("secret"), IdleTimeoutSeconds: -1}); err == nil {
+		t.Error("created a session with a negative timeout")
+	}
+
+	short, err := s.CreateSession(ctx, &celopb.CreateSessionRequest{Phrase: []byte("secret"), IdleTimeoutSeconds: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := s.CreateSession(ctx, &celopb.CreateSessionRequest{Phrase: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := s.sessions[short.Id].secret
+
+	// Sessions in use don't expire.
+	_, _, release, err := s.acquire(short.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	s.expire()
+	if _, ok := s.sessions[short.Id]; !ok {
+		t.Fatal("session in use expired")
+	}
+	release()
+
+	now = now.Add(10 * time.Second)
+	s.expire()
+	if _, ok := s.sessions[short.Id]; ok {
+		t.Error("idle session didn't expire")
+	}
+	if !bytes.Equal(secret, make([]byte, len(secret))) {
+		t.Errorf("phrase of the expired session wasn't zeroed: %q", secret)
+	}
+	if _, ok := s.sessions[long.Id]; !ok {
+		t.Error("session expired before its timeout")
+	}
+
+	s.closeAll()
+	if len(s.sessions) != 0 {
+		t.Errorf("%d sessions left open", len(s.sessions))
+	}
+}
@@ -1,111 +1,442 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/rrivera/celo"
 	"github.com/rrivera/celo/errors"
-	"github.com/rrivera/celo/file"
 )
 
 const (
 	decryptIntro = ``
 
-	decryptInputDefault   = "./*.celo"
-	decryptInputUsage     = "`file name or glob pattern` decrypt.\n\tIf a glob is passed, it will decrypt all files that match the pattern."
-	decryptExcludeDefault = ""
-	decryptExcludeUsage   = "Exclude `file name or glob pattern` from decryption.\n\tUseful when a glob is used as the source selector."
+	decryptInputDefault = "./*.celo"
+	decryptInputUsage   = "`file name or glob pattern` decrypt.\n\tIf a glob is passed, it will decrypt all files that match the pattern."
+	decryptExcludeUsage = "Exclude `file name or glob pattern` from decryption.\n\tUseful when a glob is used as the source selector. Can be repeated."
+
+	decryptExtensionUsage = "The `file extension` of the encrypted files, removed from their name when they are decrypted,\n\tsuch as secret for files encrypted with -ext secret."
+
+	verifyKeyUsage = "Require the files to be signed by the Ed25519 `public key` (or file containing it).\n\tSignatures are always verified, but without this flag any signer is accepted."
+
+	extractToUsage  = "Extract the archive into `directory` instead of a directory named after the file.\n\tRequires a single archive (see encrypt -archive)."
+	skipUnsafeUsage = "Skip the entries of archives with paths outside of the archive, such as ../.bashrc,\n\tinstead of failing. They are never extracted."
+
+	identityUsage = "Decrypt using the X25519 identities of `file` (see celo keygen).\n\tThe Secret Phrase is only used if -phrase-env is present. Can be repeated."
 )
 
 var (
-	// Exclude file name or glob pattern.
-	decryptExclude string
+	// Exclude file names or glob patterns.
+	decryptExclude stringList
+	// Files containing X25519 identities.
+	identities stringList
+	// Key (or file containing it) that must have signed the files.
+	verifyKey string
+	// Directory an archive is extracted into.
+	extractTo string
+	// Skip archive entries with unsafe paths.
+	skipUnsafe bool
 )
 
-var decryptCommand = flag.NewFlagSet("decrypt", flag.ExitOnError)
+var decryptCommand = flag.NewFlagSet("decrypt", flag.ContinueOnError)
 
 func initDecryptFlags() {
-	decryptCommand.StringVar(&decryptExclude, "exclude", decryptExcludeDefault, decryptExcludeUsage)
-	decryptCommand.BoolVar(&removeSource, "rm-source", removeSource, removeSourceUsage)
+	decryptCommand.Var(&decryptExclude, "exclude", decryptExcludeUsage)
+	decryptCommand.Var(sourceRemoval{&removeSource, &shredSource}, "rm-source", removeSourceUsage)
+	decryptCommand.IntVar(&shredPasses, "shred-passes", shredPassesDefault, shredPassesUsage)
 	decryptCommand.BoolVar(&overwrite, "ow", overwriteDefault, overwriteUsage)
+	decryptCommand.BoolVar(&yes, "yes", false, yesUsage)
+	decryptCommand.BoolVar(&preserveTimes, "preserve-times", preserveTimesDefault, preserveTimesUsage)
+	decryptCommand.BoolVar(&noLock, "no-lock", noLockDefault, noLockUsage)
+	decryptCommand.StringVar(&extension, "ext", extensionDefault, decryptExtensionUsage)
+	decryptCommand.StringVar(&fileMode, "mode", fileModeDefault, fileModeUsage)
+	decryptCommand.StringVar(&collision, "on-collision", collisionDefault, collisionUsage)
+	decryptCommand.BoolVar(&quiet, "q", false, quietUsage)
+	decryptCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	decryptCommand.BoolVar(&debug, "vv", false, debugUsage)
+	decryptCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+	decryptCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
 	decryptCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	decryptCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	decryptCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	decryptCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	decryptCommand.Var(&identities, "identity", identityUsage)
+	decryptCommand.StringVar(&verifyKey, "verify-key", "", verifyKeyUsage)
+	decryptCommand.StringVar(&extractTo, "extract-to", "", extractToUsage)
+	decryptCommand.BoolVar(&skipUnsafe, "skip-unsafe", false, skipUnsafeUsage)
+	decryptCommand.StringVar(&output, "o", outputDefault, outputUsage)
+	decryptCommand.StringVar(&outputDir, "output-dir", outputDirDefault, outputDirUsage)
+	decryptCommand.BoolVar(&dryRun, "dry-run", dryRunDefault, dryRunUsage)
+	decryptCommand.Var(&include, "include", includeUsage)
+	decryptCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	decryptCommand.StringVar(&newerThan, "newer-than", newerThanDefault, newerThanUsage)
+	decryptCommand.StringVar(&since, "since", sinceDefault, sinceUsage)
+	decryptCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	decryptCommand.BoolVar(&showProgress, "progress", false, progressUsage)
+	decryptCommand.BoolVar(&jsonOutput, "json", false, jsonUsage)
+	decryptCommand.IntVar(&jobs, "j", jobsDefault, jobsUsage)
+	decryptCommand.IntVar(&retries, "retries", retriesDefault, retriesUsage)
+	decryptCommand.StringVar(&limitRate, "limit-rate", limitRateDefault, limitRateUsage)
+	decryptCommand.BoolVar(&resume, "resume", false, resumeUsage)
+}
+
+// splitArchives splits the files to decrypt into archives (see encrypt
+// -archive), which are extracted, and regular encrypted files.
+func splitArchives(matches []string) (archives, files []string) {
+	for _, name := range matches {
+		if isArchive(name) {
+			archives = append(archives, name)
+		} else {
+			files = append(files, name)
+		}
+	}
+	return archives, files
+}
+
+// isArchive reports whether the file name is an archive. Files that can't be
+// inspected aren't, their error is reported when they are decrypted.
+func isArchive(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := celo.Inspect(f)
+	return err == nil && info.Archive
+}
+
+// decryptArchives extracts each archive into a directory, dir if it isn't
+// empty. As with files, errors only stop the execution when a single file is
+// decrypted. The results are added to rep instead of printed if it isn't nil.
+func decryptArchives(d *celo.Decrypter, secret []byte, archives []string, dir string, single bool, rep *jsonReport) error {
+	var results []celo.FileResult
+
+	for _, name := range archives {
+		r := fileResult(name, func() (string, error) { return d.DecryptDir(secret, name, dir, overwrite, removeSource) })
+		rep.add(r)
+		if r.Err != nil && single {
+			return r.Err
+		}
+		results = append(results, r)
+	}
+	if rep != nil {
+		return nil
+	}
+
+	decrypted, errs, skipped := splitResults(results)
+	fmt.Fprintf(summaries(), formatDecryptedFiles(decrypted, errs))
+	fmt.Fprint(summaries(), formatSkippedFiles(skipped))
+
+	return nil
+}
+
+// readVerifyingKey parses the verifying key s, or reads it from the file s.
+func readVerifyingKey(s string) (*celo.VerifyingKey, error) {
+	if k, err := celo.ParseVerifyingKey(s); err == nil {
+		return k, nil
+	}
+
+	b, err := os.ReadFile(s)
+	if err != nil {
+		return nil, errors.E(errors.Key, errors.Errorf("%s isn't a public key or a readable file", s))
+	}
+
+	// Key files list the public key as a comment, public key files only
+	// contain the key.
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "# public key:"))
+		if k, err := celo.ParseVerifyingKey(line); err == nil {
+			return k, nil
+		}
+	}
+	return nil, errors.E(errors.Key, errors.Entity(s), errors.Errorf("no public key found"))
+}
+
+// readIdentities reads the X25519 identities of the file name.
+func readIdentities(name string) ([]*celo.X25519Identity, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	ids, err := celo.ReadX25519Identities(f)
+	if err != nil {
+		return nil, errors.E(errors.Entity(name), err)
+	}
+	return ids, nil
 }
 
 func decrypt(src []string, args []string) (err error) {
 
 	initDecryptFlags()
-	decryptCommand.Parse(args)
-	if !decryptCommand.Parsed() {
-		return errInvalidFlags
+	if err = parseFlags(decryptCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	if err = checkRetries(); err != nil {
+		return err
+	}
+	setupColors()
+
+	onCollision, err := parseCollision(collision)
+	if err != nil {
+		return err
+	}
+
+	stdio := isStdio(src)
+	if stdio && (removeSource || extractTo != "" || filesFrom != "") {
+		return errors.E(errors.Invalid, errors.Errorf("-rm-source, -extract-to and -files-from can't be used when reading from Stdin"))
+	}
+	if err = checkJSON(stdio); err != nil {
+		return err
+	}
+	remoteIO := hasRemote(src) || isRemote(output)
+	err = checkRemote(src, map[string]bool{
+		"-rm-source": removeSource, "-extract-to": extractTo != "", "-files-from": filesFrom != "",
+		"-dry-run": dryRun, "-resume": resume, "-on-collision": collision != collisionDefault,
+	})
+	if err != nil {
+		return err
 	}
 
 	var matches []string
 
-	// Unix systems automatically convert globs in a list of files unless the
-	// argument is wrapped in "". However, we still want to exclude by pattern,
-	// and verify that only files are listed.
-	for _, pattern := range src {
-		m, err := file.Glob(pattern, decryptExclude)
-		if err != nil {
+	if stdio || hasRemote(src) {
+		// Stdin is the only source, Stdout only carries the decrypted
+		// content. Archives are written as they are, e.g. to be piped to tar.
+		// Objects are too.
+		matches = src
+	} else {
+		if matches, err = matchSources(src, decryptExclude); err != nil {
 			return err
 		}
 
-		if len(m) == 0 {
-			continue
+		// Print to Stdout the final list of files that are going to be
+		// decrypted.
+		if !jsonOutput {
+			fmt.Fprintln(summaries(), formatGlobMatches(matches))
 		}
+	}
+
+	if len(matches) == 0 {
+		return newJSONReport("decrypt").print(os.Stdout)
+	}
+
+	var archives, files []string
+	if !stdio && !remoteIO {
+		archives, files = splitArchives(matches)
+	}
+	if extractTo != "" && (len(archives) != 1 || len(files) > 0) {
+		return errors.E(errors.Invalid, errors.Errorf("-extract-to requires a single archive"))
+	}
+	if len(archives) > 0 && output != "" {
+		return errors.E(errors.Invalid, errors.Errorf("-o can't be used for archives, use -extract-to"))
+	}
+	if err = checkOutput(len(matches), stdio); err != nil {
+		return err
+	}
+	dirOption, err := outputDirOption(stdio)
+	if err != nil {
+		return err
+	}
+	workers, err := workersOption()
+	if err != nil {
+		return err
+	}
+	shred, err := shredOption()
+	if err != nil {
+		return err
+	}
+	rate, err := rateOption()
+	if err != nil {
+		return err
+	}
 
-		// concatenate matches
-		matches = append(matches, m...)
+	d := celo.NewDecrypter()
+	defer d.Wipe()
+
+	if err = d.Config(celo.SetExtension(extension), celo.OnCollision(onCollision), celo.PreserveTimes(preserveTimes), celo.SkipLocks(noLock), celo.WithLogger(logger()), celo.SkipUnsafePaths(skipUnsafe), agentOption(), workers, shred, rate); err != nil {
+		return err
 	}
 
-	// Print to Stdout the final list of files that are going to be decrypted.
-	fmt.Fprintln(os.Stdout, formatGlobMatches(matches))
+	if dirOption != nil {
+		if err = d.Config(dirOption); err != nil {
+			return err
+		}
+	}
 
-	if len(matches) == 0 {
+	if fileMode != "" {
+		mode, err := parseFileMode(fileMode)
+		if err != nil {
+			return err
+		}
+		if err = d.Config(celo.SetFileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		fmt.Fprint(os.Stdout, formatDryRun("decrypted", planDecrypt(d, matches, stdio), removeSource))
 		return nil
 	}
+	if err = confirmDestructive("Decrypt", src, matches, onCollision); err != nil {
+		return err
+	}
 
 	var secret []byte
 
-	if phraseEnv != "" {
-		// Handle Secret Phrase stored in environment variables
-		if os.Getenv(phraseEnv) != "" {
-			secret = []byte(os.Getenv(phraseEnv))
-		} else {
-			err = errors.E(errors.Internal, errors.Errorf("Environment Variable %s is empty", phraseEnv))
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	phrase = withAgent(phrase)
+	if stdio {
+		phrase = ttyPhrase(phrase)
+	}
+	// A typed phrase isn't required if identities are used.
+	t, typed := phrase.(prompt)
+	prompted := typed && len(identities) == 0
+	if !typed || prompted {
+		if secret, err = phrase.Phrase(false); err != nil {
+			return err
+		}
+	}
+	// The phrase is replaced when it is asked again, unless it was piped.
+	defer func() { celo.ZeroBytes(secret) }()
+	retry := prompted && t.Interactive()
+
+	if verifyKey != "" {
+		k, err := readVerifyingKey(verifyKey)
+		if err != nil {
+			return err
+		}
+		if err := d.Config(celo.VerifyWith(k)); err != nil {
+			return err
 		}
-	} else {
-		// Handle phrase read.
-		secret, err = celo.ReadPhrase(true)
 	}
-	// handle either phraseEnv or phrase read errors.
+
+	for _, name := range identities {
+		ids, err := readIdentities(name)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := d.Config(celo.AddIdentity(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	bar, err := startProgress(d)
 	if err != nil {
 		return err
 	}
+	defer bar.Close()
 
-	d := celo.NewDecrypter()
+	if stdio {
+		return decryptStdio(d, secret, os.Stdin, os.Stdout)
+	}
 
-	if len(matches) == 1 {
+	// With -json, the report replaces the summaries, even if the operation
+	// fails.
+	rep := newJSONReport("decrypt")
+	defer func() {
+		if perr := rep.print(os.Stdout); err == nil {
+			err = perr
+		}
+	}()
+
+	if len(archives) > 0 {
+		if err = decryptArchives(d, secret, archives, extractTo, len(matches) == 1, rep); err != nil {
+			return err
+		}
+		if matches = files; len(matches) == 0 {
+			return nil
+		}
+	}
+
+	if len(matches) == 1 && len(archives) == 0 {
 		// Error handling is stricter when decrypting a single file.
-		decryptedFile, err := d.DecryptFile(secret, matches[0], overwrite, removeSource)
+		perm, err := remoteFileMode(celo.DecryptedFileMode)
 		if err != nil {
-			// If decryption fails, the error will stop execution and it will be
-			// printed to Stderr with an Exit Code 1.
 			return err
 		}
+		decryptFile := func() (string, error) {
+			switch {
+			case remoteIO:
+				out := remoteOutput(matches[0], d.OutputName)
+				return out, transferRemote(context.Background(), matches[0], out, overwrite, perm, func(r io.Reader, w io.Writer) error {
+					_, err := d.DecryptStream(secret, r, w)
+					return err
+				})
+			case output == "":
+				return d.DecryptFile(secret, matches[0], overwrite, removeSource)
+			}
+			return output, d.DecryptFileTo(secret, matches[0], output, overwrite, removeSource)
+		}
+		r := fileResult(matches[0], decryptFile)
+
+		// A typed phrase might have a typo, ask for it again.
+		for attempt := 1; retry && retryPhrase(attempt) && errors.Is(errors.WrongPassphrase, r.Err); attempt++ {
+			bar.Close()
+			fmt.Fprintln(os.Stderr, errors.WrongPassphrase.String()+", try again.")
 
-		// Print summary only when the file was decrypted successfully.
-		fmt.Fprintf(os.Stdout, formatEncryptedFiles([]string{decryptedFile}, nil))
+			celo.ZeroBytes(secret)
+			if secret, err = phrase.Phrase(false); err != nil {
+				return err
+			}
+			r = fileResult(matches[0], decryptFile)
+		}
+		rep.add(r)
+
+		switch {
+		case r.Err != nil:
+			// If decryption fails, the error will stop execution and it will be
+			// printed to Stderr with an Exit Code 1.
+			return r.Err
+		case rep != nil:
+		case r.Skipped:
+			fmt.Fprint(summaries(), formatSkippedFiles(1))
+		default:
+			// Print summary only when the file was decrypted successfully.
+			fmt.Fprintf(summaries(), formatEncryptedFiles([]string{r.Output}, nil))
+		}
 		return nil
 	}
 
+	// The files decrypted are journaled, so an interrupted run can be
+	// resumed with -resume. Archives aren't.
+	j, matches, err := startJournal("decrypt", src, matches, d.OutputName)
+	if err != nil {
+		return err
+	}
+	if err = d.Config(celo.OnFileDone(j.record)); err != nil {
+		return err
+	}
+
 	// When Decrypting multiple files, error handling is disabled and the
 	// program will finish with Exit Code 0.
-	decrypted, errs := d.DecryptMultipleFiles(secret, matches, overwrite, removeSource)
+	results := d.DecryptFiles(secret, matches, overwrite, removeSource)
+	if err = j.finish(); err != nil {
+		return err
+	}
+	if rep != nil {
+		rep.add(results...)
+		return nil
+	}
+
 	// A summary will be printed regarding decrypting errors, however, the
 	// summary string contains the number of failed decryption attempts.
-	fmt.Fprintf(os.Stdout, formatDecryptedFiles(decrypted, errs))
+	decrypted, errs, skipped := splitResults(results)
+	fmt.Fprintf(summaries(), formatDecryptedFiles(decrypted, errs))
+	fmt.Fprint(summaries(), formatSkippedFiles(skipped))
 	return nil
 }
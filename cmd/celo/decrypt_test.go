@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestDecryptArchives(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "docs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := celo.NewEncrypter()
+	archiveName, err := e.EncryptDir([]byte("secret"), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName, err := e.EncryptFile([]byte("secret"), filepath.Join(dir, "a.txt"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archives, files := splitArchives([]string{archiveName, fileName, filepath.Join(parent, "missing")})
+	if len(archives) != 1 || archives[0] != archiveName || len(files) != 2 {
+		t.Errorf("got archives %v, files %v", archives, files)
+	}
+
+	d := celo.NewDecrypter()
+	out := filepath.Join(parent, "out")
+	if err = decryptArchives(d, []byte("secret"), archives, out, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(out, "a.txt")); err != nil || string(b) != "attack at dawn" {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	// A single archive reports its error, a batch doesn't.
+	if err = decryptArchives(d, []byte("secret"), archives, out, true, nil); !errors.Is(errors.Exist, err) {
+		t.Errorf("got error %v, want kind Exist", err)
+	}
+	if err = decryptArchives(d, []byte("secret"), archives, out, false, nil); err != nil {
+		t.Errorf("batch: got error %v", err)
+	}
+}
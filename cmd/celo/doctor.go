@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+	"golang.org/x/term"
+)
+
+var doctorCommand = flag.NewFlagSet("doctor", flag.ContinueOnError)
+
+func initDoctorFlags() {
+	doctorCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	doctorCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	doctorCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// Levels of the findings of doctor.
+const (
+	doctorOK   = "OK"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+)
+
+// finding result of one of the checks of doctor. Warnings and failures tell
+// what to do about them.
+type finding struct {
+	level string
+	check string
+	msg   string
+}
+
+// doctorAgentTimeout time the agent has to answer doctor.
+const doctorAgentTimeout = 2 * time.Second
+
+// checkTerminal reports whether the phrase can be typed without echoing it:
+// Stdin is a terminal or there is a controlling terminal.
+func checkTerminal() finding {
+	const check = "Terminal"
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return finding{doctorOK, check, "Stdin is a terminal, phrases are typed without echo."}
+	}
+	tty, err := openTTY()
+	if err != nil {
+		return finding{doctorWarn, check, "there is no terminal to type phrases in, use -phrase-env, -phrase-file, -keychain or -pinentry."}
+	}
+	tty.Close()
+	return finding{doctorOK, check, "Stdin isn't a terminal, phrases are typed in the controlling terminal without echo."}
+}
+
+// checkEntropy reports whether the random number generator of the OS, which
+// salts, nonces and keys come from, can be read.
+func checkEntropy() finding {
+	const check = "Entropy"
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		return finding{doctorFail, check, fmt.Sprintf("the random number generator of the OS can't be read: %v.", err)}
+	}
+	if bytes.Equal(b, make([]byte, len(b))) {
+		return finding{doctorFail, check, "the random number generator of the OS only returns zeros."}
+	}
+	return finding{doctorOK, check, "the random number generator of the OS can be read."}
+}
+
+// checkWritable reports whether files can be created in dir, as outputs are:
+// through a temporary file in the same directory.
+func checkWritable(dir string) finding {
+	check := "Directory " + dir
+	fi, err := os.Stat(dir)
+	switch {
+	case err != nil:
+		return finding{doctorFail, check, fmt.Sprintf("it can't be read: %v.", err)}
+	case !fi.IsDir():
+		return finding{doctorFail, check, "it isn't a directory."}
+	}
+
+	f, err := file.CreateTemp(filepath.Join(dir, "celo-doctor"))
+	if err != nil {
+		return finding{doctorFail, check, "files can't be created in it, check its permissions or use -output-dir."}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return finding{doctorOK, check, "files can be created in it."}
+}
+
+// checkConfig reports whether the configuration file, if there is one, can
+// be used. err is the error of parsing the flags with it.
+func checkConfig(err error) finding {
+	const check = "Configuration"
+	if err != nil {
+		return finding{doctorFail, check, fmt.Sprintf("%v. Fix it or set %s to another file.", err, configEnv)}
+	}
+	c, err := loadConfig()
+	switch {
+	case err != nil:
+		return finding{doctorFail, check, err.Error()}
+	case c.defaults == nil:
+		return finding{doctorOK, check, fmt.Sprintf("there is no configuration file (%s), flag defaults are used.", c.name)}
+	}
+	return finding{doctorOK, check, fmt.Sprintf("%s is valid.", c.name)}
+}
+
+// checkKeychain reports whether the phrase stored with name in the keychain
+// of the OS can be read.
+func checkKeychain(name string) finding {
+	check := fmt.Sprintf("Keychain %q", name)
+	phrase, err := celo.KeychainGet(name)
+	switch {
+	case err == nil:
+		celo.ZeroBytes(phrase)
+		return finding{doctorOK, check, "the phrase is stored."}
+	case errors.Is(errors.NotExist, err):
+		return finding{doctorWarn, check, "there is no phrase stored, it is asked with confirmation and stored the next time it is used."}
+	}
+	return finding{doctorFail, check, fmt.Sprintf("%v. Check that the keychain of the OS is unlocked, or install secret-tool.", err)}
+}
+
+// checkPinentry reports whether the pinentry program can be found.
+func checkPinentry() finding {
+	const check = "Pinentry"
+	path, err := exec.LookPath(celo.PinentryProgram)
+	if err != nil {
+		return finding{doctorFail, check, fmt.Sprintf("%s isn't in PATH, install it (e.g. with GnuPG) or don't use -pinentry.", celo.PinentryProgram)}
+	}
+	return finding{doctorOK, check, path + " is used."}
+}
+
+// checkAgent reports whether the agent listening on socket answers.
+func checkAgent(socket string) finding {
+	const check = "Agent"
+	ctx, cancel := context.WithTimeout(context.Background(), doctorAgentTimeout)
+	defer cancel()
+	if _, err := callAgent(ctx, socket, &agentRequest{Op: agentPing}); err != nil {
+		return finding{doctorFail, check, fmt.Sprintf("%v. Start it with eval $(celo agent) or unset $%s.", err, agentSocketEnv)}
+	}
+	return finding{doctorOK, check, "the agent listening on " + socket + " answers."}
+}
+
+// diagnose runs the checks of the environment, creating files in dirs.
+// configErr is the error of parsing the flags with the configuration file.
+func diagnose(dirs []string, configErr error) []finding {
+	findings := []finding{checkTerminal(), checkEntropy(), checkConfig(configErr)}
+	for _, dir := range dirs {
+		findings = append(findings, checkWritable(dir))
+	}
+	if keychain != "" {
+		findings = append(findings, checkKeychain(keychain))
+	}
+	if usePinentry {
+		findings = append(findings, checkPinentry())
+	}
+	if socket := os.Getenv(agentSocketEnv); socket != "" {
+		findings = append(findings, checkAgent(socket))
+	}
+	return findings
+}
+
+// formatFindings findings of doctor, one per line, and the number of
+// failures.
+func formatFindings(findings []finding) (string, int) {
+	colors := map[string]color{doctorOK: colorOK, doctorWarn: colorSkipped, doctorFail: colorFailed}
+
+	b := new(bytes.Buffer)
+	failed := 0
+	for _, f := range findings {
+		if f.level == doctorFail {
+			failed++
+		}
+		// The levels are padded after they are colored.
+		pad := strings.Repeat(" ", len(doctorWarn)+2-len(f.level))
+		fmt.Fprintf(b, "  %s%s%s: %s\n", colors[f.level].paint(f.level), pad, f.check, f.msg)
+	}
+	return b.String(), failed
+}
+
+func doctor(args []string) (err error) {
+
+	// Directories come before the flags.
+	dirs, found := extractSources(args)
+
+	initDoctorFlags()
+	// An invalid configuration file is one of the findings.
+	configErr := parseFlags(doctorCommand, args[found:])
+	if configErr == flag.ErrHelp || configErr == errInvalidFlags {
+		return configErr
+	}
+	setupColors()
+
+	dirs = append(dirs, doctorCommand.Args()...)
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	report, failed := formatFindings(diagnose(dirs, configErr))
+	fmt.Fprint(os.Stdout, report)
+
+	if failed > 0 {
+		return errors.E(errors.Other, errors.Errorf("%d problem(s) found", failed))
+	}
+
+	return nil
+}
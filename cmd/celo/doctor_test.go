@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(name, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		dir   string
+		level string
+	}{
+		{dir, doctorOK},
+		{name, doctorFail},
+		{filepath.Join(dir, "missing"), doctorFail},
+	} {
+		if got := checkWritable(tt.dir); got.level != tt.level {
+			t.Errorf("%s: got %v, want %s", tt.dir, got, tt.level)
+		}
+	}
+
+	// The temporary file is removed.
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left in the directory, want 1", len(entries))
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.toml")
+	t.Setenv(configEnv, name)
+
+	if got := checkConfig(nil); got.level != doctorOK || !strings.Contains(got.msg, "no configuration file") {
+		t.Errorf("no file: got %v", got)
+	}
+
+	if err := os.WriteFile(name, []byte("ext = \"secret\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkConfig(nil); got.level != doctorOK || got.msg != name+" is valid." {
+		t.Errorf("valid file: got %v", got)
+	}
+
+	if err := os.WriteFile(name, []byte("ext\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkConfig(nil); got.level != doctorFail {
+		t.Errorf("invalid file: got %v", got)
+	}
+}
+
+func TestCheckAgent(t *testing.T) {
+	socket := startAgent(t, false)
+	if got := checkAgent(socket); got.level != doctorOK {
+		t.Errorf("running agent: got %v", got)
+	}
+	if got := checkAgent(filepath.Join(t.TempDir(), "missing.sock")); got.level != doctorFail {
+		t.Errorf("no agent: got %v", got)
+	}
+}
+
+func TestCheckEntropy(t *testing.T) {
+	if got := checkEntropy(); got.level != doctorOK {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestFormatFindings(t *testing.T) {
+	got, failed := formatFindings([]finding{
+		{doctorOK, "Entropy", "fine."},
+		{doctorWarn, "Terminal", "none."},
+		{doctorFail, "Directory .", "read only."},
+	})
+	want := "  OK    Entropy: fine.\n  WARN  Terminal: none.\n  FAIL  Directory .: read only.\n"
+	if got != want || failed != 1 {
+		t.Errorf("got %q and %d failures, want %q and 1", got, failed, want)
+	}
+}
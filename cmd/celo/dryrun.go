@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/rrivera/celo"
+)
+
+// plannedFile what an operation would do with a source (See -dry-run).
+type plannedFile struct {
+	source string
+	// output name of the file that would be created.
+	output string
+	// replace whether an existing file would be replaced.
+	replace bool
+	// err why the source wouldn't be processed, e.g. its output exists.
+	err error
+}
+
+// resolver resolves the name of the files created as an operation would,
+// implemented by celo.Encrypter and celo.Decrypter.
+type resolver interface {
+	ResolveCollision(name string, overwrite bool) (string, bool, error)
+}
+
+// planFiles returns what processing each source would do. outputName returns
+// the name of the file created from a source before collisions are resolved.
+func planFiles(r resolver, sources []string, outputName func(string) string) []plannedFile {
+	planned := make([]plannedFile, len(sources))
+	for i, source := range sources {
+		p := plannedFile{source: source, output: outputName(source)}
+		if resolved, replace, err := r.ResolveCollision(p.output, overwrite); err != nil {
+			p.err = err
+		} else {
+			p.output, p.replace = resolved, replace
+		}
+		planned[i] = p
+	}
+	return planned
+}
+
+// stdioPlan plan of reading from Stdin, nothing is created.
+var stdioPlan = []plannedFile{{source: "Stdin", output: "Stdout"}}
+
+// planEncrypt returns what encrypting the matches would do.
+func planEncrypt(e *celo.Encrypter, matches []string, stdio bool) []plannedFile {
+	switch {
+	case stdio:
+		return stdioPlan
+	case output != "":
+		return planFiles(e, matches, func(string) string { return output })
+	case archive:
+		return planFiles(e, matches, func(dir string) string { return e.OutputName(filepath.Clean(dir)) })
+	}
+	return planFiles(e, matches, e.OutputName)
+}
+
+// planDecrypt returns what decrypting the matches would do.
+func planDecrypt(d *celo.Decrypter, matches []string, stdio bool) []plannedFile {
+	switch {
+	case stdio:
+		return stdioPlan
+	case output != "":
+		return planFiles(d, matches, func(string) string { return output })
+	case extractTo != "":
+		return planFiles(d, matches, func(string) string { return extractTo })
+	}
+	return planFiles(d, matches, d.OutputName)
+}
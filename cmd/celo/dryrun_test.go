@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+)
+
+func TestPlanEncrypt(t *testing.T) {
+	t.Cleanup(func() { overwrite, output = overwriteDefault, outputDefault })
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, name := range []string{a, b, b + "." + celo.Extension} {
+		if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := celo.NewEncrypter()
+	planned := planEncrypt(e, []string{a, b}, false)
+	if p := planned[0]; p.output != a+"."+celo.Extension || p.replace || p.err != nil {
+		t.Errorf("new file: got %+v", p)
+	}
+	if p := planned[1]; p.output != b+"."+celo.Extension || p.err == nil {
+		t.Errorf("existing file: got %+v", p)
+	}
+
+	report := formatDryRun("encrypted", planned, true)
+	for _, want := range []string{"1 file(s) would be encrypted, 1 skipped or failing.", a + " -> " + a + ".celo (source removed)", b + " fails"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report %q doesn't contain %q", report, want)
+		}
+	}
+
+	overwrite = true
+	if p := planEncrypt(e, []string{b}, false)[0]; !p.replace || p.err != nil {
+		t.Errorf("overwrite: got %+v", p)
+	}
+
+	output = filepath.Join(dir, "custom.bin")
+	if p := planEncrypt(e, []string{a}, false)[0]; p.output != output {
+		t.Errorf("-o: got %+v", p)
+	}
+
+	if p := planEncrypt(e, []string{"-"}, true); len(p) != 1 || p[0].source != "Stdin" {
+		t.Errorf("stdin: got %+v", p)
+	}
+
+	// Nothing was created.
+	if m, _ := filepath.Glob(filepath.Join(dir, "*")); len(m) != 3 {
+		t.Errorf("got files %v", m)
+	}
+}
+
+func TestPlanDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt."+celo.Extension)
+
+	d := celo.NewDecrypter()
+	if err := d.Config(celo.OnCollision(celo.CollisionSkip)); err != nil {
+		t.Fatal(err)
+	}
+	if p := planDecrypt(d, []string{name}, false)[0]; p.output != filepath.Join(dir, "a.txt") || p.err != nil {
+		t.Errorf("got %+v", p)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	planned := planDecrypt(d, []string{name}, false)
+	if report := formatDryRun("decrypted", planned, false); !strings.Contains(report, "skipped") {
+		t.Errorf("got report %q", report)
+	}
+
+	// -ext names the files encrypted with a custom extension.
+	if err := d.Config(celo.SetExtension("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if p := planDecrypt(d, []string{filepath.Join(dir, "b.txt.secret")}, false)[0]; p.output != filepath.Join(dir, "b.txt") || p.err != nil {
+		t.Errorf("-ext secret: got %+v", p)
+	}
+}
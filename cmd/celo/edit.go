@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+const (
+	editorUsage          = "`command` that edits the decrypted file, its name is appended to it.\n\tDefaults to $VISUAL, $EDITOR or vi (notepad on Windows)."
+	editShredPassesUsage = "Overwrite the temporary decrypted file `N` times before it is removed."
+)
+
+var (
+	// Command that edits the decrypted file.
+	editor string
+)
+
+var editCommand = flag.NewFlagSet("edit", flag.ContinueOnError)
+
+func initEditFlags() {
+	editCommand.StringVar(&editor, "editor", "", editorUsage)
+	editCommand.IntVar(&shredPasses, "shred-passes", shredPassesDefault, editShredPassesUsage)
+	editCommand.StringVar(&extension, "ext", extensionDefault, decryptExtensionUsage)
+	editCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	editCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	editCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	editCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	editCommand.BoolVar(&quiet, "q", false, quietUsage)
+	editCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// editorCommand returns the command that edits files: -editor, $VISUAL,
+// $EDITOR or the default editor of the OS, split in its arguments.
+func editorCommand(getenv func(string) string) []string {
+	for _, c := range []string{editor, getenv("VISUAL"), getenv("EDITOR")} {
+		if args := strings.Fields(c); len(args) > 0 {
+			return args
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// runEditor opens the file name with the editor command and waits for it to
+// exit.
+func runEditor(command []string, name string) error {
+	cmd := exec.Command(command[0], append(command[1:], name)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.E(errors.Other, errors.Errorf("editor %s failed: %v", command[0], err))
+	}
+	return nil
+}
+
+// checkEditable returns an error of kind errors.Invalid if the file name,
+// described by info, can't be encrypted again as it was: only files encrypted
+// with a phrase can, and signatures can't be kept.
+func checkEditable(name string, info celo.Info) error {
+	switch {
+	case info.KDF == "":
+		return errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("only files encrypted with a phrase can be edited"))
+	case info.Signed:
+		return errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("signed files can't be edited, their signature would be lost"))
+	case info.Archive:
+		return errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("archives can't be edited"))
+	}
+	return nil
+}
+
+// editFile decrypts the file name with secret into a temporary file only its
+// owner can read, edits it with run and, if its content changed, encrypts it
+// again with the same phrase and padding, replacing name atomically. The
+// temporary file is shredded afterwards, whatever happens. It reports
+// whether name was modified.
+func editFile(secret []byte, name string, run func(string) error) (modified bool, err error) {
+	encrypted, err := os.ReadFile(name)
+	if err != nil {
+		return false, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false, errors.E(errors.Open, errors.Entity(name), err)
+	}
+
+	info, err := celo.Inspect(bytes.NewReader(encrypted))
+	if err != nil {
+		return false, errors.E(errors.Entity(name), err)
+	}
+	if err = checkEditable(name, info); err != nil {
+		return false, err
+	}
+
+	plaintext, err := celo.DecryptBytes(secret, encrypted, agentOption())
+	if err != nil {
+		return false, errors.E(errors.Entity(name), err)
+	}
+	defer celo.ZeroBytes(plaintext)
+
+	// The directory is only accessible by its owner. The file keeps the name
+	// of the decrypted file, so editors recognize its type.
+	dir, err := os.MkdirTemp("", "celo-edit-*")
+	if err != nil {
+		return false, errors.E(errors.Create, err)
+	}
+	defer os.RemoveAll(dir)
+
+	temp := filepath.Join(dir, strings.TrimSuffix(filepath.Base(name), "."+extension))
+	if err = os.WriteFile(temp, plaintext, 0600); err != nil {
+		return false, errors.E(errors.Create, errors.Entity(temp), err)
+	}
+	defer file.Shred(temp, shredPasses)
+
+	if err = run(temp); err != nil {
+		return false, errors.E(errors.Entity(name), err)
+	}
+
+	edited, err := os.ReadFile(temp)
+	if err != nil {
+		return false, errors.E(errors.Open, errors.Entity(temp), err)
+	}
+	defer celo.ZeroBytes(edited)
+	if bytes.Equal(edited, plaintext) {
+		return false, nil
+	}
+
+	reencrypted, err := celo.EncryptBytes(secret, edited, celo.SetPadding(info.Padding), agentOption())
+	if err != nil {
+		return false, errors.E(errors.Entity(name), err)
+	}
+
+	err = file.WriteAtomic(name, true, fi.Mode().Perm(), func(f *os.File) error {
+		if _, err := f.Write(reencrypted); err != nil {
+			return errors.E(errors.Create, errors.Entity(name), err)
+		}
+		return nil
+	})
+	return err == nil, err
+}
+
+func edit(src []string, args []string) (err error) {
+
+	initEditFlags()
+	if err = parseFlags(editCommand, args); err != nil {
+		return err
+	}
+	setupColors()
+
+	if shredPasses < 1 {
+		return errors.E(errors.Invalid, errors.Errorf("-shred-passes must be at least 1, got %d", shredPasses))
+	}
+
+	matches, err := matchSources(src, nil)
+	if err != nil {
+		return err
+	}
+	if len(matches) != 1 {
+		return errors.E(errors.Invalid, errors.Errorf("edit requires a single file, %d match %v", len(matches), src))
+	}
+	name := matches[0]
+	command := editorCommand(os.Getenv)
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	phrase = withAgent(phrase)
+	secret, err := phrase.Phrase(false)
+	if err != nil {
+		return err
+	}
+	// The phrase is replaced when it is asked again.
+	defer func() { celo.ZeroBytes(secret) }()
+	t, typed := phrase.(prompt)
+	retry := typed && t.Interactive()
+
+	run := func(temp string) error { return runEditor(command, temp) }
+	modified, err := editFile(secret, name, run)
+
+	// A typed phrase might have a typo, ask for it again.
+	for attempt := 1; retry && retryPhrase(attempt) && errors.Is(errors.WrongPassphrase, err); attempt++ {
+		fmt.Fprintln(os.Stderr, errors.WrongPassphrase.String()+", try again.")
+
+		celo.ZeroBytes(secret)
+		if secret, err = phrase.Phrase(false); err != nil {
+			return err
+		}
+		modified, err = editFile(secret, name, run)
+	}
+	if err != nil {
+		return err
+	}
+
+	if modified {
+		fmt.Fprintf(summaries(), "%s encrypted again.\n", colorFile.paint(name))
+	} else {
+		fmt.Fprintf(summaries(), "No changes, %s wasn't modified.\n", colorFile.paint(name))
+	}
+
+	return nil
+}
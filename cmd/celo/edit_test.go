@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEditorCommand(t *testing.T) {
+	env := map[string]string{"EDITOR": "code --wait"}
+	getenv := func(k string) string { return env[k] }
+
+	if got := editorCommand(getenv); len(got) != 2 || got[0] != "code" || got[1] != "--wait" {
+		t.Errorf("got %q", got)
+	}
+	env["VISUAL"] = "nano"
+	if got := editorCommand(getenv); len(got) != 1 || got[0] != "nano" {
+		t.Errorf("got %q", got)
+	}
+
+	editor = "emacs -nw"
+	t.Cleanup(func() { editor = "" })
+	if got := editorCommand(getenv); len(got) != 2 || got[0] != "emacs" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	extension, shredPasses = extensionDefault, 1
+	name := filepath.Join(t.TempDir(), "secrets.yaml.celo")
+	secret := []byte("secret")
+
+	blob, err := celo.EncryptBytes(secret, []byte("token: a\n"), celo.SetPadding(celo.PaddingPadme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(name, blob, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var temp string
+	modified, err := editFile(secret, name, func(n string) error {
+		temp = n
+		if filepath.Base(n) != "secrets.yaml" {
+			t.Errorf("temporary file %s", n)
+		}
+		if fi, err := os.Stat(n); err != nil || fi.Mode().Perm()&0077 != 0 {
+			t.Errorf("temporary file %v, %v", fi, err)
+		}
+		return os.WriteFile(n, []byte("token: b\n"), 0600)
+	})
+	if err != nil || !modified {
+		t.Fatalf("got %t, %v", modified, err)
+	}
+	if _, err = os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("temporary file wasn't removed: %v", err)
+	}
+
+	b, _ := os.ReadFile(name)
+	if plaintext, err := celo.DecryptBytes(secret, b); err != nil || string(plaintext) != "token: b\n" {
+		t.Errorf("got %q, %v", plaintext, err)
+	}
+
+	// Files that aren't changed aren't encrypted again.
+	if modified, err = editFile(secret, name, func(string) error { return nil }); err != nil || modified {
+		t.Errorf("got %t, %v", modified, err)
+	}
+	if after, _ := os.ReadFile(name); string(after) != string(b) {
+		t.Error("unchanged file was encrypted again")
+	}
+
+	// The file isn't modified if the editor fails.
+	modified, err = editFile(secret, name, func(n string) error {
+		os.WriteFile(n, []byte("token: c\n"), 0600)
+		return errors.E(errors.Other, errors.Errorf("editor failed"))
+	})
+	if err == nil || modified {
+		t.Errorf("got %t, %v", modified, err)
+	}
+	if after, _ := os.ReadFile(name); string(after) != string(b) {
+		t.Error("file modified by a failed editor")
+	}
+
+	if _, err = editFile([]byte("wrong"), name, func(string) error { return nil }); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/rrivera/celo"
 	"github.com/rrivera/celo/errors"
-	"github.com/rrivera/celo/file"
 )
 
 const (
@@ -16,13 +17,28 @@ const (
 	encryptInputDefault   = "./*"
 	encryptInputUsage     = "`file name or glob pattern` encrypt.\n\tIf a glob is passed, it will encrypt all files that match the pattern."
 	encryptExcludeDefault = "*.celo"
-	encryptExcludeUsage   = "Exclude `file name or glob pattern` from encryption.\n\tUseful when a glob is used as the source selector."
+	encryptExcludeUsage   = "Exclude `file name or glob pattern` from encryption.\n\tUseful when a glob is used as the source selector. Can be repeated.\n\tFiles with the *.celo pattern are excluded unless -exclude is used."
 
 	noConfirmDefault = false
 	noConfirmUsage   = "Skip Secret Phrase confirmation. Only ask for the Secret Phrase once."
 
 	extensionDefault = "celo"
 	extensionUsage   = "Define a custom `file extension` for encrypted files."
+
+	addRecipientUsage = "Name of an `environment variable` containing the Secret Phrase of an additional recipient.\n\tThe file can be decrypted with any of the phrases. Use \"-\" to be asked for the phrase.\n\tCan be repeated."
+
+	recipientUsage = "Encrypt for the X25519 `public key` of a recipient (see celo keygen).\n\tThe Secret Phrase is only used if -phrase-env is present. Can be repeated."
+
+	signKeyUsage = "Sign the encrypted files with the Ed25519 key of `file` (see celo keygen -type ed25519)."
+
+	reuseKeyDefault = false
+	reuseKeyUsage   = "Generate the key from the Secret Phrase once and reuse it for every file.\n\tFaster for many files, at the cost of encrypted files sharing the same salt."
+
+	archiveDefault = false
+	archiveUsage   = "Encrypt each source directory into a single archive, such as photos.celo for photos,\n\tkeeping the relative paths and permissions of its files. Sources must be directories."
+
+	paddingDefault = "none"
+	paddingUsage   = "Pad the content with the given `scheme` so the encrypted file doesn't leak its exact size.\n\tSupported schemes: none, block, padme."
 )
 
 var (
@@ -30,105 +46,459 @@ var (
 	noConfirm bool
 	// Override default extension attached to encrypted files.
 	extension string
-	// Exclude file name or glob pattern
-	encryptExclude string
+	// Exclude file names or glob patterns, encryptExcludeDefault if empty.
+	encryptExclude stringList
+	// Padding scheme applied to the content before encryption.
+	padding string
+	// Environment variables containing the phrases of additional recipients.
+	addRecipients stringList
+	// X25519 public keys of recipients.
+	recipients stringList
+	// File containing the key used to sign encrypted files.
+	signKey string
+	// Reuse the key generated from the phrase for every file.
+	reuseKey bool
+	// Encrypt directories into archives.
+	archive bool
 )
 
-var encryptCommand = flag.NewFlagSet("encrypt", flag.ExitOnError)
+var encryptCommand = flag.NewFlagSet("encrypt", flag.ContinueOnError)
 
 func initEncryptFlags() {
-	encryptCommand.StringVar(&encryptExclude, "exclude", encryptExcludeDefault, encryptExcludeUsage)
-	encryptCommand.BoolVar(&removeSource, "rm-source", removeSourceDefault, removeSourceUsage)
+	encryptCommand.Var(&encryptExclude, "exclude", encryptExcludeUsage)
+	encryptCommand.Var(sourceRemoval{&removeSource, &shredSource}, "rm-source", removeSourceUsage)
+	encryptCommand.IntVar(&shredPasses, "shred-passes", shredPassesDefault, shredPassesUsage)
 	encryptCommand.BoolVar(&overwrite, "ow", overwriteDefault, overwriteUsage)
+	encryptCommand.BoolVar(&yes, "yes", false, yesUsage)
+	encryptCommand.BoolVar(&preserveTimes, "preserve-times", preserveTimesDefault, preserveTimesUsage)
+	encryptCommand.BoolVar(&noLock, "no-lock", noLockDefault, noLockUsage)
+	encryptCommand.StringVar(&fileMode, "mode", fileModeDefault, fileModeUsage)
+	encryptCommand.StringVar(&collision, "on-collision", collisionDefault, collisionUsage)
+	encryptCommand.BoolVar(&quiet, "q", false, quietUsage)
+	encryptCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	encryptCommand.BoolVar(&debug, "vv", false, debugUsage)
+	encryptCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+	encryptCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
 	encryptCommand.StringVar(&extension, "ext", extensionDefault, extensionUsage)
 	encryptCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	encryptCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	encryptCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	encryptCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
 	encryptCommand.BoolVar(&noConfirm, "nc", noConfirmDefault, noConfirmUsage)
+	encryptCommand.IntVar(&minStrength, "min-strength", minStrengthDefault, minStrengthUsage)
+	encryptCommand.IntVar(&retries, "retries", retriesDefault, retriesUsage)
+	encryptCommand.StringVar(&padding, "pad", paddingDefault, paddingUsage)
+	encryptCommand.Var(&addRecipients, "add-recipient", addRecipientUsage)
+	encryptCommand.Var(&recipients, "recipient", recipientUsage)
+	encryptCommand.StringVar(&signKey, "sign-key", "", signKeyUsage)
+	encryptCommand.BoolVar(&reuseKey, "reuse-key", reuseKeyDefault, reuseKeyUsage)
+	encryptCommand.BoolVar(&archive, "archive", archiveDefault, archiveUsage)
+	encryptCommand.StringVar(&output, "o", outputDefault, outputUsage)
+	encryptCommand.StringVar(&outputDir, "output-dir", outputDirDefault, outputDirUsage)
+	encryptCommand.BoolVar(&dryRun, "dry-run", dryRunDefault, dryRunUsage)
+	encryptCommand.Var(&include, "include", includeUsage)
+	encryptCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	encryptCommand.StringVar(&newerThan, "newer-than", newerThanDefault, newerThanUsage)
+	encryptCommand.StringVar(&since, "since", sinceDefault, sinceUsage)
+	encryptCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	encryptCommand.BoolVar(&showProgress, "progress", false, progressUsage)
+	encryptCommand.BoolVar(&jsonOutput, "json", false, jsonUsage)
+	encryptCommand.IntVar(&jobs, "j", jobsDefault, jobsUsage)
+	encryptCommand.StringVar(&limitRate, "limit-rate", limitRateDefault, limitRateUsage)
+	encryptCommand.UintVar(&kdfTime, "kdf-time", kdfTimeDefault, kdfTimeUsage)
+	encryptCommand.UintVar(&kdfMemory, "kdf-memory", kdfMemoryDefault, kdfMemoryUsage)
+	encryptCommand.UintVar(&kdfThreads, "kdf-threads", kdfThreadsDefault, kdfThreadsUsage)
+	encryptCommand.BoolVar(&resume, "resume", false, resumeUsage)
+	encryptCommand.StringVar(&manifestName, "manifest", "", manifestUsage)
+}
+
+// readSigningKey reads the signing key of the file name.
+func readSigningKey(name string) (*celo.SigningKey, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	k, err := celo.ReadSigningKey(f)
+	if err != nil {
+		return nil, errors.E(errors.Entity(name), err)
+	}
+	return k, nil
+}
+
+// readRecipientPhrase returns the phrase of an additional recipient stored in
+// the environment variable name, or asks for it if name is "-".
+func readRecipientPhrase(name string) ([]byte, error) {
+	if name == "-" {
+		return celo.TerminalPhrase{Label: "Additional recipient", Retries: uint32(retries)}.Phrase(true)
+	}
+	return celo.EnvPhrase(name).Phrase(false)
+}
+
+// parsePadding returns the padding scheme with the given name.
+func parsePadding(name string) (celo.Padding, error) {
+	for _, p := range []celo.Padding{celo.PaddingNone, celo.PaddingBlock, celo.PaddingPadme} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return celo.PaddingNone, errors.E(errors.Padding, errors.Errorf("Unknown padding scheme %s", name))
+}
+
+// archiveSources returns the sources of -archive, which must be directories.
+func archiveSources(src []string) ([]string, error) {
+	for _, name := range src {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, errors.E(errors.Open, errors.Entity(name), err)
+		}
+		if !fi.IsDir() {
+			return nil, errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("-archive requires directories"))
+		}
+	}
+	return src, nil
+}
+
+// encryptArchives encrypts each directory of dirs into an archive. As with
+// files, errors only stop the execution when a single directory is encrypted.
+// The results are added to rep instead of printed if it isn't nil.
+func encryptArchives(e *celo.Encrypter, secret []byte, dirs []string, rep *jsonReport) error {
+	var results []celo.FileResult
+
+	for _, dir := range dirs {
+		r := fileResult(dir, func() (string, error) { return e.EncryptDir(secret, dir, overwrite) })
+		rep.add(r)
+		if r.Err != nil && len(dirs) == 1 {
+			return r.Err
+		}
+		results = append(results, r)
+	}
+	if rep != nil {
+		return nil
+	}
+
+	encrypted, errs, skipped := splitResults(results)
+	fmt.Fprintf(summaries(), formatEncryptedFiles(encrypted, errs))
+	fmt.Fprint(summaries(), formatSkippedFiles(skipped))
+
+	return nil
 }
 
 func encrypt(src []string, args []string) (err error) {
 
 	initEncryptFlags()
-	encryptCommand.Parse(args)
-	if !encryptCommand.Parsed() {
-		return errInvalidFlags
+	if err = parseFlags(encryptCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	min, err := checkMinStrength()
+	if err != nil {
+		return err
+	}
+	if err = checkRetries(); err != nil {
+		return err
+	}
+	setupColors()
+
+	pad, err := parsePadding(padding)
+	if err != nil {
+		return err
+	}
+
+	onCollision, err := parseCollision(collision)
+	if err != nil {
+		return err
+	}
+
+	if archive && removeSource {
+		// Directories are never removed.
+		return errors.E(errors.Invalid, errors.Errorf("-rm-source can't be used along with -archive"))
+	}
+
+	stdio := isStdio(src)
+	if stdio && (archive || removeSource || filesFrom != "" || manifestName != "") {
+		return errors.E(errors.Invalid, errors.Errorf("-archive, -rm-source, -files-from and -manifest can't be used when reading from Stdin"))
+	}
+	if archive && (filesFrom != "" || manifestName != "") {
+		return errors.E(errors.Invalid, errors.Errorf("-files-from and -manifest can't be used along with -archive"))
+	}
+	if err = checkJSON(stdio); err != nil {
+		return err
+	}
+	remoteIO := hasRemote(src) || isRemote(output)
+	err = checkRemote(src, map[string]bool{
+		"-archive": archive, "-rm-source": removeSource, "-files-from": filesFrom != "", "-manifest": manifestName != "",
+		"-dry-run": dryRun, "-resume": resume, "-on-collision": collision != collisionDefault,
+	})
+	if err != nil {
+		return err
 	}
 
 	matches := []string{}
 
-	// Unix systems automatically convert globs in a list of files unless the
-	// argument is wrapped in "". However, we still want to exclude by pattern,
-	// and verify that only files are listed.
-	for _, pattern := range src {
-		m, err := file.Glob(pattern, encryptExclude)
-		if err != nil {
+	switch {
+	case stdio:
+		// Stdin is the only source, Stdout only carries the encrypted file.
+		matches = src
+	case hasRemote(src):
+		// The object is read as it is, there is nothing to match.
+		matches = src
+	case archive:
+		if matches, err = archiveSources(src); err != nil {
+			return err
+		}
+	default:
+		excludes := encryptExclude
+		if len(excludes) == 0 {
+			excludes = stringList{encryptExcludeDefault}
+		}
+		if matches, err = matchSources(src, excludes); err != nil {
 			return err
 		}
 
-		if len(m) == 0 {
-			continue
+		// Print to Stdout the final list of files that are going to be
+		// encrypted.
+		if !jsonOutput {
+			fmt.Fprintln(summaries(), formatGlobMatches(matches))
 		}
+	}
 
-		// concatenate matches
-		matches = append(matches, m...)
+	if len(matches) == 0 {
+		return newJSONReport("encrypt").print(os.Stdout)
 	}
 
-	// Print to Stdout the final list of files that are going to be encrypted.
-	fmt.Fprintln(os.Stdout, formatGlobMatches(matches))
+	files := len(matches)
+	if archive {
+		// Directories aren't files.
+		files = 0
+	}
+	if err = checkOutput(files, stdio); err != nil {
+		return err
+	}
+	dirOption, err := outputDirOption(stdio)
+	if err != nil {
+		return err
+	}
+	workers, err := workersOption()
+	if err != nil {
+		return err
+	}
+	shred, err := shredOption()
+	if err != nil {
+		return err
+	}
+	rate, err := rateOption()
+	if err != nil {
+		return err
+	}
+	kdf, err := kdfOption()
+	if err != nil {
+		return err
+	}
 
-	if len(matches) == 0 {
+	e := celo.NewEncrypter()
+	defer e.Wipe()
+
+	if extension != "" {
+		// replace default extension
+		if err = e.Config(celo.SetExtension(extension)); err != nil {
+			return err
+		}
+	}
+
+	if err = e.Config(celo.SetPadding(pad), celo.PreserveKey(reuseKey), celo.OnCollision(onCollision), celo.PreserveTimes(preserveTimes), celo.SkipLocks(noLock), celo.WithLogger(logger()), agentOption(), workers, shred, rate, kdf); err != nil {
+		return err
+	}
+
+	if dirOption != nil {
+		if err = e.Config(dirOption); err != nil {
+			return err
+		}
+	}
+
+	if fileMode != "" {
+		mode, err := parseFileMode(fileMode)
+		if err != nil {
+			return err
+		}
+		if err = e.Config(celo.SetFileMode(mode)); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		fmt.Fprint(os.Stdout, formatDryRun("encrypted", planEncrypt(e, matches, stdio), removeSource))
 		return nil
 	}
+	if err = confirmDestructive("Encrypt", src, matches, onCollision); err != nil {
+		return err
+	}
 
 	var secret []byte
 
-	if phraseEnv != "" {
-		// Handle Secret Phrase stored in environment variables
-		if os.Getenv(phraseEnv) != "" {
-			secret = []byte(os.Getenv(phraseEnv))
-		} else {
-			err = errors.E(errors.Internal, errors.Errorf("Environment Variable %s is empty", phraseEnv))
-		}
-	} else {
-		// Handle phrase read.
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	phrase = strongPhrase(withAgent(phrase), min)
+	if stdio {
+		phrase = ttyPhrase(phrase)
+	}
+	// A typed phrase isn't required if only X25519 recipients are used.
+	if _, typed := phrase.(prompt); !typed || len(recipients) == 0 {
 		// noConfirm flag decides whether to ask form phrase confirmation or not.
-		if noConfirm {
-			secret, err = celo.ReadPhrase(true)
-		} else {
-			secret, err = celo.ReadAndConfirmPhrase(3)
+		if secret, err = phrase.Phrase(!noConfirm); err != nil {
+			return err
+		}
+	}
+	defer celo.ZeroBytes(secret)
+	if err = checkPhraseStrength(secret, min); err != nil {
+		return err
+	}
+
+	for _, name := range addRecipients {
+		phrase, err := readRecipientPhrase(name)
+		if err != nil {
+			return err
+		}
+		r, err := celo.NewPhraseRecipient(phrase)
+		if err != nil {
+			return err
+		}
+		if err := e.Config(celo.AddRecipient(r)); err != nil {
+			return err
 		}
 	}
-	// handle either phraseEnv or phrase read errors.
+
+	if signKey != "" {
+		k, err := readSigningKey(signKey)
+		if err != nil {
+			return err
+		}
+		if err := e.Config(celo.SignWith(k)); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range recipients {
+		r, err := celo.ParseX25519Recipient(key)
+		if err != nil {
+			return err
+		}
+		if err := e.Config(celo.AddRecipient(r)); err != nil {
+			return err
+		}
+	}
+
+	bar, err := startProgress(e)
 	if err != nil {
 		return err
 	}
+	defer bar.Close()
 
-	e := celo.NewEncrypter()
+	if stdio {
+		return encryptStdio(e, secret, os.Stdin, os.Stdout)
+	}
 
-	if extension != "" {
-		// replace default extension
-		e.Config(celo.SetExtension(extension))
+	// With -json, the report replaces the summaries, even if the operation
+	// fails.
+	rep := newJSONReport("encrypt")
+	defer func() {
+		if perr := rep.print(os.Stdout); err == nil {
+			err = perr
+		}
+	}()
+
+	if archive {
+		return encryptArchives(e, secret, matches, rep)
 	}
 
+	// The manifest is written even if the operation fails, with the files
+	// encrypted.
+	m, err := newManifest(manifestName)
+	if err != nil {
+		return err
+	}
+	if err = e.Config(celo.DigestPlaintext(m != nil)); err != nil {
+		return err
+	}
+	defer func() {
+		if merr := m.write(); err == nil {
+			err = merr
+		}
+	}()
+
 	if len(matches) == 1 {
 		// Error handling is stricter when encrypting a single file.
-		encryptedFile, err := e.EncryptFile(secret, matches[0], overwrite, removeSource)
+		perm, err := remoteFileMode(celo.EncryptedFileMode)
 		if err != nil {
-			// If encryption fails, the error will stop execution and it will be
-			// printed to Stderr with an Exit Code 1.
 			return err
 		}
+		r := fileResult(matches[0], func() (string, error) {
+			switch {
+			case remoteIO:
+				out := remoteOutput(matches[0], e.OutputName)
+				return out, transferRemote(context.Background(), matches[0], out, overwrite, perm, func(r io.Reader, w io.Writer) error {
+					_, err := e.EncryptStream(secret, r, w)
+					return err
+				})
+			case output == "":
+				return e.EncryptFile(secret, matches[0], overwrite, removeSource)
+			}
+			return output, e.EncryptFileTo(secret, matches[0], output, overwrite, removeSource)
+		})
+		r.PlaintextSHA256 = e.PlaintextSHA256()
+		rep.add(r)
+		m.add(r)
 
-		// Print summary only when the file was encrypted successfully.
-		fmt.Fprintf(os.Stdout, formatEncryptedFiles([]string{encryptedFile}, nil))
+		switch {
+		case r.Err != nil:
+			// If encryption fails, the error will stop execution and it will be
+			// printed to Stderr with an Exit Code 1.
+			return r.Err
+		case rep != nil:
+		case r.Skipped:
+			fmt.Fprint(summaries(), formatSkippedFiles(1))
+		default:
+			// Print summary only when the file was encrypted successfully.
+			fmt.Fprintf(summaries(), formatEncryptedFiles([]string{r.Output}, nil))
+		}
 		return nil
 	}
 
+	// The files encrypted are journaled, so an interrupted run can be
+	// resumed with -resume.
+	j, matches, err := startJournal("encrypt", src, matches, e.OutputName)
+	if err != nil {
+		return err
+	}
+	done := func(r celo.FileResult) {
+		j.record(r)
+		m.add(r)
+	}
+	if err = e.Config(celo.OnFileDone(done)); err != nil {
+		return err
+	}
+
 	// When Encrypting multiple files, error handling is disabled and the
 	// program will finish with Exit Code 0.
-	encrypted, errs := e.EncryptMultipleFiles(secret, matches, overwrite, removeSource)
+	results := e.EncryptFiles(secret, matches, overwrite, removeSource)
+	if err = j.finish(); err != nil {
+		return err
+	}
+	if rep != nil {
+		rep.add(results...)
+		return nil
+	}
+
 	// A summary will be printed regarding encrypting errors, however, the
 	// summary string contains the number of failed encryption attempts.
-	fmt.Fprintf(os.Stdout, formatEncryptedFiles(encrypted, errs))
+	encrypted, errs, skipped := splitResults(results)
+	fmt.Fprintf(summaries(), formatEncryptedFiles(encrypted, errs))
+	fmt.Fprint(summaries(), formatSkippedFiles(skipped))
 
 	return nil
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestArchiveSources(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if src, err := archiveSources([]string{dir}); err != nil || len(src) != 1 {
+		t.Errorf("got %v, %v", src, err)
+	}
+	if _, err := archiveSources([]string{dir, name}); !errors.Is(errors.Invalid, err) {
+		t.Errorf("file: got error %v, want kind Invalid", err)
+	}
+	if _, err := archiveSources([]string{filepath.Join(dir, "missing")}); !errors.Is(errors.Open, err) {
+		t.Errorf("missing: got error %v, want kind Open", err)
+	}
+}
+
+func TestEncryptArchives(t *testing.T) {
+	parent := t.TempDir()
+	a, b := filepath.Join(parent, "a"), filepath.Join(parent, "b")
+	for _, dir := range []string{a, b} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := celo.NewEncrypter()
+	if err := encryptArchives(e, []byte("secret"), []string{a, b}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{a, b} {
+		if ok, err := celo.IsCeloFile(dir + "." + celo.Extension); !ok || err != nil {
+			t.Errorf("%s not encrypted: %v", dir, err)
+		}
+	}
+
+	// A single directory reports its error, a batch doesn't.
+	if err := encryptArchives(e, []byte("secret"), []string{a}, nil); !errors.Is(errors.Exist, err) {
+		t.Errorf("got error %v, want kind Exist", err)
+	}
+	if err := encryptArchives(e, []byte("secret"), []string{a, b}, nil); err != nil {
+		t.Errorf("batch: got error %v", err)
+	}
+
+	// With -json, the results are added to the report.
+	rep := &jsonReport{Files: []jsonFile{}}
+	if err := encryptArchives(e, []byte("secret"), []string{a}, rep); !errors.Is(errors.Exist, err) {
+		t.Errorf("got error %v, want kind Exist", err)
+	}
+	if rep.Failed != 1 || rep.Files[0].Source != a || rep.Files[0].Kind != errors.Exist.String() {
+		t.Errorf("got report %+v", rep)
+	}
+}
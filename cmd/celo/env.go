@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix prefix of the environment variables with the values of the flags.
+const envPrefix = "CELO_"
+
+// envName returns the environment variable of the flag or alias name, e.g.
+// CELO_MIN_STRENGTH for min-strength.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// envTable returns the values of the flags of fs given by environment
+// variables: CELO_ and the name of the flag, or of one of its aliases (See
+// configAliases), in upper case with _ instead of -, such as CELO_EXT,
+// CELO_OVERWRITE or CELO_WORKERS. The variable of the flag name is used
+// before the ones of its aliases. Flags that can be repeated, such as
+// -exclude, take a comma-separated list. Empty variables are ignored.
+func envTable(fs *flag.FlagSet) configTable {
+	aliases := map[string][]string{}
+	for alias, name := range configAliases {
+		aliases[name] = append(aliases[name], alias)
+	}
+
+	values := configTable{}
+	fs.VisitAll(func(f *flag.Flag) {
+		names := aliases[f.Name]
+		sort.Strings(names)
+		for _, name := range append([]string{f.Name}, names...) {
+			env := envName(name)
+			v := os.Getenv(env)
+			if v == "" {
+				continue
+			}
+
+			var list []string
+			if _, ok := f.Value.(*stringList); ok {
+				for _, s := range strings.Split(v, ",") {
+					if s = strings.TrimSpace(s); s != "" {
+						list = append(list, s)
+					}
+				}
+			} else {
+				list = []string{v}
+			}
+			values[f.Name] = configValue{values: list, source: "$" + env}
+			return
+		}
+	})
+	return values
+}
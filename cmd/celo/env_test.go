@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"ext":          "CELO_EXT",
+		"min-strength": "CELO_MIN_STRENGTH",
+		"overwrite":    "CELO_OVERWRITE",
+	}
+	for name, want := range tests {
+		if got := envName(name); got != want {
+			t.Errorf("envName(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestEnvTable(t *testing.T) {
+	t.Setenv("CELO_EXT", "secret")
+	t.Setenv("CELO_OVERWRITE", "1")
+	t.Setenv("CELO_EXCLUDE", "*.log, tmp/*,")
+	t.Setenv("CELO_WORKERS", "8")
+	t.Setenv("CELO_J", "4")
+	t.Setenv("CELO_KEYCHAIN", "")
+
+	fs, _, _, _, _, _, _ := configFlags()
+	want := configTable{
+		"ext":     {values: []string{"secret"}, source: "$CELO_EXT"},
+		"ow":      {values: []string{"1"}, source: "$CELO_OVERWRITE"},
+		"exclude": {values: []string{"*.log", "tmp/*"}, source: "$CELO_EXCLUDE"},
+		// The variable of the flag name wins over the ones of its aliases.
+		"j": {values: []string{"4"}, source: "$CELO_J"},
+	}
+	if got := envTable(fs); !reflect.DeepEqual(got, want) {
+		t.Errorf("envTable = %v, want %v", got, want)
+	}
+}
+
+func TestParseFlagsEnv(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.toml")
+	writeFile(t, name, testConfig)
+	t.Setenv(configEnv, name)
+	t.Setenv("CELO_PROFILE", "work")
+	t.Setenv("CELO_EXT", "env")
+	t.Setenv("CELO_WORKERS", "8")
+	t.Setenv("CELO_EXCLUDE", "*.tmp")
+
+	// Flags win over the environment, which wins over the configuration file.
+	fs, ext, excludes, jobs, ow, min, keychain := configFlags()
+	if err := parseFlags(fs, []string{"-ext", "flag"}); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if *ext != "flag" || *jobs != 8 || !reflect.DeepEqual(*excludes, stringList{"*.tmp"}) || !*ow || *min != 2 || *keychain != "work" {
+		t.Errorf("got ext %q, j %d, exclude %q, ow %t, min-strength %d, keychain %q", *ext, *jobs, *excludes, *ow, *min, *keychain)
+	}
+
+	// -profile wins over $CELO_PROFILE.
+	fs, _, _, _, _, _, _ = configFlags()
+	if err := parseFlags(fs, []string{"-profile", "home"}); !errors.Is(errors.Invalid, err) {
+		t.Errorf("parseFlags -profile home: got error %v, want kind Invalid", err)
+	}
+
+	t.Setenv("CELO_WORKERS", "many")
+	fs, _, _, _, _, _, _ = configFlags()
+	if err := parseFlags(fs, nil); !errors.Is(errors.Invalid, err) {
+		t.Errorf("parseFlags with CELO_WORKERS=many: got error %v, want kind Invalid", err)
+	}
+}
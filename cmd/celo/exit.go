@@ -0,0 +1,66 @@
+package main
+
+import (
+	stderrors "errors"
+	"flag"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Exit codes of the process, so scripts can tell failures apart without
+// parsing Stderr. Documented in the README, don't change their values.
+const (
+	exitOK = 0
+	// exitFailure any other error.
+	exitFailure = 1
+	// exitWrongPhrase the phrase (or identity) doesn't decrypt the file.
+	exitWrongPhrase = 2
+	// exitExist the file to create already exists.
+	exitExist = 3
+	// exitNotCelo the file isn't a celo file, or its version isn't supported.
+	exitNotCelo = 4
+	// exitCorrupt the file is corrupt or truncated.
+	exitCorrupt = 5
+	// exitSignature the signature of the file is missing or invalid.
+	exitSignature = 6
+	// exitUsage invalid flags or combination of flags.
+	exitUsage = 7
+	// exitOpen a file doesn't exist or can't be read.
+	exitOpen = 8
+)
+
+// exitCodes maps the kinds of errors to exit codes.
+var exitCodes = map[errors.Kind]int{
+	errors.WrongPassphrase: exitWrongPhrase,
+	errors.Exist:           exitExist,
+	errors.Signature:       exitNotCelo,
+	errors.Metadata:        exitNotCelo,
+	errors.Incompatible:    exitNotCelo,
+	errors.Ciphertext:      exitCorrupt,
+	errors.Truncated:       exitCorrupt,
+	errors.Sign:            exitSignature,
+	errors.Invalid:         exitUsage,
+	errors.Pattern:         exitUsage,
+	errors.Open:            exitOpen,
+	errors.NotExist:        exitOpen,
+}
+
+// exitCode returns the exit code of err: the code of the first kind of the
+// chain of errors that has one, exitFailure if none does.
+func exitCode(err error) int {
+	if err == nil || err == flag.ErrHelp {
+		return exitOK
+	}
+
+	for err != nil {
+		var e *errors.Error
+		if !stderrors.As(err, &e) {
+			break
+		}
+		if code, ok := exitCodes[e.Kind]; ok {
+			return code
+		}
+		err = e.Err
+	}
+	return exitFailure
+}
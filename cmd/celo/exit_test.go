@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{flag.ErrHelp, exitOK},
+		{errors.E(errors.Op("decrypter.unwrapPhrase"), errors.WrongPassphrase), exitWrongPhrase},
+		{errors.E(errors.Exist, errors.Entity("a.txt.celo")), exitExist},
+		{errors.E(errors.Op("metadata.DecodeMetadata"), errors.Metadata), exitNotCelo},
+		{errors.E(errors.Incompatible), exitNotCelo},
+		{errors.E(errors.Truncated), exitCorrupt},
+		{errors.E(errors.Sign), exitSignature},
+		{errInvalidFlags, exitUsage},
+		{errors.E(errors.NotExist, errors.Entity("missing")), exitOpen},
+		// Kinds without a code of their own use the code of the error they
+		// wrap.
+		{errors.E(errors.Decrypt, errors.E(errors.Ciphertext, errors.Errorf("checksum mismatch"))), exitCorrupt},
+		{errors.E(errors.Key, errors.Errorf("no public key found")), exitFailure},
+		{fmt.Errorf("wrapped: %w", errors.E(errors.Exist)), exitExist},
+		{io.ErrUnexpectedEOF, exitFailure},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Bool("ow", false, "")
+
+	if err := parseFlags(fs, []string{"-ow"}); err != nil {
+		t.Errorf("valid flags: got %v", err)
+	}
+	if err := parseFlags(fs, []string{"-help"}); err != flag.ErrHelp {
+		t.Errorf("-help: got %v, want flag.ErrHelp", err)
+	}
+	if err := parseFlags(fs, []string{"-unknown"}); exitCode(err) != exitUsage {
+		t.Errorf("unknown flag: got %v, exit code %d", err, exitCode(err))
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// stringList is a flag.Value that collects every occurrence of a repeatable
+// flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sourceRemoval is the flag.Value of -rm-source: true (or used alone) removes
+// the sources, shred shreds them before.
+type sourceRemoval struct {
+	remove, shred *bool
+}
+
+func (r sourceRemoval) IsBoolFlag() bool { return true }
+
+func (r sourceRemoval) String() string {
+	switch {
+	case r.shred != nil && *r.shred:
+		return "shred"
+	case r.remove != nil && *r.remove:
+		return "true"
+	}
+	return "false"
+}
+
+func (r sourceRemoval) Set(value string) error {
+	if value == "shred" {
+		*r.remove, *r.shred = true, true
+		return nil
+	}
+	remove, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.Errorf("must be true, false or shred")
+	}
+	*r.remove, *r.shred = remove, false
+	return nil
+}
+
+// shredOption returns the option that shreds the sources removed with
+// -rm-source=shred -shred-passes times. It returns an error of kind
+// errors.Invalid if -shred-passes is lower than 1.
+func shredOption() (celo.Option, error) {
+	switch {
+	case !shredSource:
+		return celo.ShredSource(0), nil
+	case shredPasses < 1:
+		return nil, errors.E(errors.Invalid, errors.Errorf("-shred-passes must be 1 or greater"))
+	}
+	return celo.ShredSource(shredPasses), nil
+}
+
+// parseRate returns the number of bytes per second of rate, a number followed
+// by an optional unit K, M or G (binary units, so 1K is 1024 bytes), e.g. 10M
+// or 1.5G, 0 for no limit. It returns an error of kind errors.Invalid if rate
+// is negative or lower than a byte per second.
+func parseRate(rate string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(rate)), "B")
+	unit := 1.0
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || (n > 0 && n*unit < 1) || n*unit > 1<<62 {
+		return 0, errors.E(errors.Invalid, errors.Errorf("invalid rate %q, expected bytes per second such as 512K, 10M or 1G", rate))
+	}
+	return int64(n * unit), nil
+}
+
+// rateOption returns the option that limits the throughput to -limit-rate,
+// unlimited if it isn't used or is 0. It returns an error of kind errors.Invalid if
+// -limit-rate isn't a valid rate.
+func rateOption() (celo.Option, error) {
+	if limitRate == "" {
+		return celo.LimitRate(0), nil
+	}
+	n, err := parseRate(limitRate)
+	if err != nil {
+		return nil, err
+	}
+	return celo.LimitRate(n), nil
+}
+
+// kdfOption returns the option that derives the keys of new phrase stanzas
+// with -kdf-time, -kdf-memory and -kdf-threads. It returns an error of kind
+// errors.Invalid if they are out of bounds (See celo.KDFParams.Validate).
+func kdfOption() (celo.Option, error) {
+	if kdfThreads > math.MaxUint8 {
+		return nil, errors.E(errors.Invalid, errors.Errorf("-kdf-threads must be between 1 and %d", math.MaxUint8))
+	}
+	p := celo.KDFParams{
+		Time:    uint32(min(kdfTime, math.MaxUint32)),
+		Memory:  uint32(min(kdfMemory, math.MaxUint32/1024) * 1024),
+		Threads: uint8(kdfThreads),
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return celo.SetKDFParams(p), nil
+}
+
+// sinceLayouts layouts of -since, dates without a time zone are local.
+var sinceLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// modifiedAfter returns the time files must be modified after to be
+// processed: now minus -newer-than, -since, or the zero time if neither is
+// used. It returns an error of kind errors.Invalid if both are used or if
+// their value isn't valid.
+func modifiedAfter(now time.Time) (time.Time, error) {
+	switch {
+	case newerThan != "" && since != "":
+		return time.Time{}, errors.E(errors.Invalid, errors.Errorf("-newer-than can't be used along with -since"))
+	case newerThan != "":
+		d, err := parseAge(newerThan)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	case since != "":
+		for _, layout := range sinceLayouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(since), time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, errors.E(errors.Invalid, errors.Errorf("invalid date %q, expected 2024-01-01, \"2024-01-01 08:00\" or 2024-01-01T08:00:00Z", since))
+	}
+	return time.Time{}, nil
+}
+
+// parseAge parses a positive duration such as 24h or 90m, or a number of days
+// such as 7d.
+// It returns an error of kind errors.Invalid if age isn't valid.
+func parseAge(age string) (time.Duration, error) {
+	s := strings.TrimSpace(age)
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n float64
+		if n, err = strconv.ParseFloat(days, 64); err == nil {
+			d = time.Duration(n * float64(24*time.Hour))
+		}
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, errors.E(errors.Invalid, errors.Errorf("invalid duration %q, expected a positive duration such as 24h, 90m or 7d", age))
+	}
+	return d, nil
+}
+
+// parseCollision returns the collision strategy with the given name.
+func parseCollision(name string) (celo.Collision, error) {
+	for _, c := range []celo.Collision{celo.CollisionFail, celo.CollisionOverwrite, celo.CollisionRename, celo.CollisionSkip} {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return celo.CollisionFail, errors.E(errors.Invalid, errors.Errorf("Unknown collision strategy %s", name))
+}
+
+// parseFileMode parses the permissions s, in octal.
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, errors.E(errors.Invalid, errors.Errorf("%s isn't a permission mode such as 0600", s))
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		s    string
+		want os.FileMode
+	}{
+		{"0600", 0600},
+		{"640", 0640},
+		{"0", 0},
+		{"0777", 0777},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFileMode(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseFileMode(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "0800", "rw-------", "01777", "-1"} {
+		if _, err := parseFileMode(s); !errors.Is(errors.Invalid, err) {
+			t.Errorf("parseFileMode(%q): got error %v, want kind Invalid", s, err)
+		}
+	}
+}
+
+func TestParseCollision(t *testing.T) {
+	for _, c := range []celo.Collision{celo.CollisionFail, celo.CollisionOverwrite, celo.CollisionRename, celo.CollisionSkip} {
+		if got, err := parseCollision(c.String()); err != nil || got != c {
+			t.Errorf("parseCollision(%q) = %v, %v, want %v", c.String(), got, err, c)
+		}
+	}
+	if _, err := parseCollision("replace"); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got error %v, want kind Invalid", err)
+	}
+
+	if s := formatSkippedFiles(0); s != "" {
+		t.Errorf("formatSkippedFiles(0) = %q, want an empty string", s)
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	t.Cleanup(func() { output = outputDefault })
+
+	output = ""
+	if err := checkOutput(3, true); err != nil {
+		t.Errorf("without -o: got error %v", err)
+	}
+
+	output = "out.celo"
+	if err := checkOutput(1, false); err != nil {
+		t.Errorf("single file: got error %v", err)
+	}
+	if err := checkOutput(2, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("multiple files: got error %v, want kind Invalid", err)
+	}
+	if err := checkOutput(1, true); !errors.Is(errors.Invalid, err) {
+		t.Errorf("stdin: got error %v, want kind Invalid", err)
+	}
+}
+
+func TestOutputDirOption(t *testing.T) {
+	t.Cleanup(func() { output, outputDir = outputDefault, outputDirDefault })
+
+	if opt, err := outputDirOption(false); opt != nil || err != nil {
+		t.Errorf("without -output-dir: got %v, %v", opt, err)
+	}
+
+	dir := t.TempDir() + "/out"
+	outputDir = dir
+	opt, err := outputDirOption(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := celo.NewEncrypter()
+	if err = e.Config(opt); err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir() + "/a.txt"
+	if err = os.WriteFile(src, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	name, err := e.EncryptFile([]byte("secret"), src, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != dir+"/a.txt."+celo.Extension {
+		t.Errorf("encrypted to %s", name)
+	}
+	if _, err = os.Stat(src); err != nil {
+		t.Error("source not left in place")
+	}
+
+	if _, err = outputDirOption(true); !errors.Is(errors.Invalid, err) {
+		t.Errorf("stdin: got error %v, want kind Invalid", err)
+	}
+	output = "out.celo"
+	if _, err = outputDirOption(false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-o: got error %v, want kind Invalid", err)
+	}
+}
+
+func TestMatchSources(t *testing.T) {
+	t.Cleanup(func() { include = nil })
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.txt", "d.md.celo"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pattern := filepath.Join(dir, "*")
+
+	include = stringList{"*.md"}
+	got, err := matchSources([]string{pattern}, []string{"*.celo", "b.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || filepath.Base(got[0]) != "a.md" {
+		t.Errorf("got %v, want a.md", got)
+	}
+
+	include = nil
+	if got, err = matchSources([]string{pattern}, []string{"*.celo"}); err != nil || len(got) != 3 {
+		t.Errorf("without -include: got %v, %v", got, err)
+	}
+}
+
+func TestMatchSourcesHidden(t *testing.T) {
+	t.Cleanup(func() { hidden = hiddenDefault })
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", ".env", ".git/config"} {
+		writeFile(t, filepath.Join(dir, name), "data")
+	}
+
+	// Hidden files are only matched explicitly.
+	got, err := matchSources([]string{filepath.Join(dir, "*")}, []string{"*.celo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a.md")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, pattern := range []string{".env", ".*", filepath.Join(".git", "*")} {
+		if got, err = matchSources([]string{filepath.Join(dir, pattern)}, []string{"*.celo"}); err != nil || len(got) != 1 {
+			t.Errorf("%s: got %q, %v, want 1 file", pattern, got, err)
+		}
+	}
+
+	hidden = true
+	if got, err = matchSources([]string{filepath.Join(dir, "*")}, []string{"*.celo"}); err != nil || len(got) != 2 {
+		t.Errorf("-hidden: got %q, %v, want a.md and .env", got, err)
+	}
+}
+
+func TestModifiedAfter(t *testing.T) {
+	t.Cleanup(func() { newerThan, since = newerThanDefault, sinceDefault })
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+
+	for _, tc := range []struct {
+		newerThan, since string
+		want             time.Time
+	}{
+		{"", "", time.Time{}},
+		{"24h", "", now.Add(-24 * time.Hour)},
+		{"90m", "", now.Add(-90 * time.Minute)},
+		{"7d", "", now.Add(-7 * 24 * time.Hour)},
+		{"", "2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"", "2024-01-01 08:30", time.Date(2024, 1, 1, 8, 30, 0, 0, time.Local)},
+		{"", "2024-01-01T08:30:00Z", time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC)},
+	} {
+		newerThan, since = tc.newerThan, tc.since
+		if got, err := modifiedAfter(now); err != nil || !got.Equal(tc.want) {
+			t.Errorf("-newer-than %q -since %q: got %v, %v, want %v", tc.newerThan, tc.since, got, err, tc.want)
+		}
+	}
+
+	for _, tc := range [][2]string{{"24h", "2024-01-01"}, {"-1h", ""}, {"0", ""}, {"yesterday", ""}, {"d", ""}, {"", "01/01/2024"}, {"", "2024-13-01"}} {
+		newerThan, since = tc[0], tc[1]
+		if _, err := modifiedAfter(now); !errors.Is(errors.Invalid, err) {
+			t.Errorf("-newer-than %q -since %q: got %v, want kind Invalid", tc[0], tc[1], err)
+		}
+	}
+
+	// Sources and listed files modified before are skipped.
+	dir := t.TempDir()
+	old, recent := filepath.Join(dir, "old.txt"), filepath.Join(dir, "recent.txt")
+	for _, name := range []string{old, recent} {
+		writeFile(t, name, "data")
+	}
+	if err := os.Chtimes(old, time.Now(), time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	newerThan, since = "24h", ""
+	got, err := matchSources([]string{filepath.Join(dir, "*")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{recent}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	newerThan = "bad"
+	if _, err = matchSources([]string{filepath.Join(dir, "*")}, nil); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-newer-than bad: got %v, want kind Invalid", err)
+	}
+}
+
+func TestParseFileList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"a.txt\nb c.txt\r\n\nd.txt", []string{"a.txt", "b c.txt", "d.txt"}},
+		{"./a.txt\x00./new\nline.txt\x00", []string{"./a.txt", "./new\nline.txt"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseFileList(strings.NewReader(tt.list))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFileList(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestFilesFrom(t *testing.T) {
+	t.Cleanup(func() { filesFrom, include = filesFromDefault, nil })
+
+	dir := t.TempDir()
+	// Names are taken literally, not as patterns.
+	names := []string{filepath.Join(dir, "a[1].md"), filepath.Join(dir, "b.md.celo"), filepath.Join(dir, "c.txt")}
+	list := filepath.Join(dir, "list")
+	if err := os.WriteFile(list, []byte(strings.Join(names, "\x00")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	filesFrom = list
+	got, err := matchSources(nil, []string{"*.celo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{names[0], names[2]}) {
+		t.Errorf("got %q", got)
+	}
+
+	include = stringList{"*.txt"}
+	if got, err = matchSources(nil, nil); err != nil || !reflect.DeepEqual(got, []string{names[2]}) {
+		t.Errorf("with -include: got %q, %v", got, err)
+	}
+
+	filesFrom = filepath.Join(dir, "missing")
+	if _, err = matchSources(nil, nil); !errors.Is(errors.Open, err) {
+		t.Errorf("missing list: got error %v, want kind Open", err)
+	}
+}
+
+func TestParseArgsFilesFrom(t *testing.T) {
+	original := os.Args
+	t.Cleanup(func() { os.Args = original })
+
+	for _, args := range [][]string{
+		{"celo", "encrypt", "-files-from", "list.txt"},
+		{"celo", "--files-from=list.txt", "-no-confirm"},
+	} {
+		os.Args = args
+		cmd, src, flags, err := parseArgs()
+		if err != nil || cmd != "encrypt" || len(src) != 0 || len(flags) == 0 {
+			t.Errorf("%q: got %s %v %v, %v", args, cmd, src, flags, err)
+		}
+	}
+
+	os.Args = []string{"celo", "encrypt", "-no-confirm"}
+	if _, _, _, err := parseArgs(); err == nil {
+		t.Error("missing source: no error")
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	t.Cleanup(func() { quiet, verbose, debug = false, false, false })
+
+	if logger() != nil || summaries() != os.Stdout || checkVerbosity() != nil {
+		t.Fatal("default verbosity: want no logger and summaries on Stdout")
+	}
+
+	verbose = true
+	l := logger()
+	if l == nil || !l.Enabled(context.Background(), slog.LevelInfo) || l.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("-v: want a logger at info level")
+	}
+
+	debug = true
+	if l := logger(); l == nil || !l.Enabled(context.Background(), slog.LevelDebug) {
+		t.Errorf("-vv: want a logger at debug level")
+	}
+
+	quiet = true
+	if err := checkVerbosity(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-q -vv: got %v, want kind Invalid", err)
+	}
+
+	verbose, debug = false, false
+	if err := checkVerbosity(); err != nil {
+		t.Errorf("-q: got %v", err)
+	}
+	if summaries() != io.Discard {
+		t.Errorf("-q: summaries are printed")
+	}
+}
+
+func TestWorkersOption(t *testing.T) {
+	t.Cleanup(func() { jobs = jobsDefault })
+
+	for _, n := range []int{1, 4, 0} {
+		jobs = n
+		opt, err := workersOption()
+		if err != nil {
+			t.Fatalf("-j %d: got %v", n, err)
+		}
+		if err := celo.NewEncrypter().Config(opt); err != nil {
+			t.Errorf("-j %d: got %v", n, err)
+		}
+	}
+
+	jobs = -1
+	if _, err := workersOption(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-j -1: got %v, want kind Invalid", err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for rate, want := range map[string]int64{
+		"100":  100,
+		"512K": 512 << 10,
+		"10M":  10 << 20,
+		"10m":  10 << 20,
+		"10MB": 10 << 20,
+		"1.5G": 3 << 29,
+		" 2K ": 2 << 10,
+		"0.5K": 512,
+	} {
+		if got, err := parseRate(rate); err != nil || got != want {
+			t.Errorf("%q: got %d, %v, want %d", rate, got, err, want)
+		}
+	}
+	for _, rate := range []string{"", "-1M", "M", "10X", "ten", "0.1"} {
+		if _, err := parseRate(rate); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%q: got %v, want kind Invalid", rate, err)
+		}
+	}
+
+	t.Cleanup(func() { limitRate = limitRateDefault })
+	for _, rate := range []string{"", "0", "10M"} {
+		limitRate = rate
+		opt, err := rateOption()
+		if err != nil {
+			t.Fatalf("-limit-rate %q: got %v", rate, err)
+		}
+		if err := celo.NewDecrypter().Config(opt); err != nil {
+			t.Errorf("-limit-rate %q: got %v", rate, err)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	t.Cleanup(func() { retries = retriesDefault })
+
+	retries = -1
+	if err := checkRetries(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-retries -1: got %v, want kind Invalid", err)
+	}
+
+	for _, tc := range []struct {
+		retries, attempt int
+		retry            bool
+	}{
+		{3, 1, true},
+		{3, 2, true},
+		{3, 3, false},
+		{1, 1, false},
+		{0, 1, true},
+		{0, 1000, true},
+	} {
+		retries = tc.retries
+		if err := checkRetries(); err != nil {
+			t.Errorf("-retries %d: got %v", tc.retries, err)
+		}
+		if got := retryPhrase(tc.attempt); got != tc.retry {
+			t.Errorf("-retries %d, attempt %d: got retry %v", tc.retries, tc.attempt, got)
+		}
+	}
+
+	// Typed phrases are asked -retries times, 0 for unlimited.
+	retries = 0
+	if p := typedPhrase("").(celo.TerminalPhrase); p.Retries != 0 {
+		t.Errorf("-retries 0: got %d retries", p.Retries)
+	}
+	retries = 5
+	if p := typedPhrase("").(celo.TerminalPhrase); p.Retries != 5 {
+		t.Errorf("-retries 5: got %d retries", p.Retries)
+	}
+}
+
+func TestMinStrength(t *testing.T) {
+	t.Cleanup(func() { minStrength = minStrengthDefault })
+
+	for _, n := range []int{-1, int(celo.MaxStrength) + 1} {
+		minStrength = n
+		if _, err := checkMinStrength(); !errors.Is(errors.Invalid, err) {
+			t.Errorf("-min-strength %d: got %v, want kind Invalid", n, err)
+		}
+	}
+	minStrength = 3
+	min, err := checkMinStrength()
+	if err != nil || min != celo.StrengthSafelyUnguessable {
+		t.Fatalf("-min-strength 3: got %v, %v", min, err)
+	}
+
+	// Only typed phrases can be asked again.
+	if p := strongPhrase(celo.TerminalPhrase{}, min); p.(celo.TerminalPhrase).MinStrength != min {
+		t.Errorf("terminal phrase: got %+v", p)
+	}
+	if p := strongPhrase(celo.EnvPhrase("CELO_PHRASE"), min); p != celo.EnvPhrase("CELO_PHRASE") {
+		t.Errorf("environment phrase: got %+v", p)
+	}
+
+	if err = checkPhraseStrength([]byte("password"), min); !errors.Is(errors.PhraseIsWeak, err) {
+		t.Errorf("weak phrase: got %v, want kind PhraseIsWeak", err)
+	}
+	if err = checkPhraseStrength([]byte("otter-quilt-lemon-pylon"), min); err != nil {
+		t.Errorf("strong phrase: got %v", err)
+	}
+	// Weak phrases are only warned about without a minimum.
+	if err = checkPhraseStrength([]byte("password"), 0); err != nil {
+		t.Errorf("no minimum: got %v", err)
+	}
+	// Public keys only.
+	if err = checkPhraseStrength(nil, min); err != nil {
+		t.Errorf("no phrase: got %v", err)
+	}
+}
+
+func TestKeychainPhraseProvider(t *testing.T) {
+	t.Cleanup(func() { keychain, usePinentry = keychainDefault, pinentryDefault })
+
+	keychain = "work"
+	for _, src := range [][2]string{{"CELO_PHRASE", ""}, {"", "phrase.txt"}} {
+		if _, err := phraseProvider(src[0], src[1], ""); !errors.Is(errors.Invalid, err) {
+			t.Errorf("-keychain with %q: got %v, want kind Invalid", src, err)
+		}
+	}
+
+	// Phrases missing from the keychain are asked as usual.
+	usePinentry = true
+	p, err := phraseProvider("", "", "label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := p.(celo.KeychainPhrase)
+	if !ok || k.Name != "work" || k.Ask != (celo.PinentryPhrase{Description: "label", Retries: phraseAttempts}) {
+		t.Errorf("got provider %+v", p)
+	}
+	if _, ok = p.(prompt); ok {
+		t.Error("keychain phrases are asked again")
+	}
+
+	min := celo.StrengthSafelyUnguessable
+	if p = strongPhrase(p, min); p.(celo.KeychainPhrase).Ask.(celo.PinentryPhrase).MinStrength != min {
+		t.Errorf("strong phrase: got %+v", p)
+	}
+}
+
+func TestSourceRemoval(t *testing.T) {
+	tests := []struct {
+		args          []string
+		remove, shred bool
+	}{
+		{nil, false, false},
+		{[]string{"-rm-source"}, true, false},
+		{[]string{"-rm-source=true"}, true, false},
+		{[]string{"-rm-source=shred"}, true, true},
+		{[]string{"-rm-source=shred", "-rm-source=false"}, false, false},
+	}
+
+	for _, tt := range tests {
+		var remove, shred bool
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Var(sourceRemoval{&remove, &shred}, "rm-source", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if remove != tt.remove || shred != tt.shred {
+			t.Errorf("%q: got remove %t, shred %t, want %t, %t", tt.args, remove, shred, tt.remove, tt.shred)
+		}
+	}
+
+	var remove, shred bool
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(sourceRemoval{&remove, &shred}, "rm-source", "")
+	if err := fs.Parse([]string{"-rm-source=wipe"}); err == nil {
+		t.Error("-rm-source=wipe: got no error")
+	}
+}
+
+func TestShredOption(t *testing.T) {
+	defer func(shred bool, passes int) { shredSource, shredPasses = shred, passes }(shredSource, shredPasses)
+
+	shredSource, shredPasses = true, 0
+	if _, err := shredOption(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-shred-passes 0: got error %v, want kind Invalid", err)
+	}
+
+	// Passes are ignored if the sources aren't shredded.
+	shredSource = false
+	if opt, err := shredOption(); err != nil || opt == nil {
+		t.Errorf("without shred: got %v, %v", opt, err)
+	}
+
+	shredSource, shredPasses = true, 2
+	if opt, err := shredOption(); err != nil || celo.NewEncrypter().Config(opt) != nil {
+		t.Errorf("-shred-passes 2: got error %v", err)
+	}
+}
+
+func TestKDFOption(t *testing.T) {
+	defer func(time, memory, threads uint) { kdfTime, kdfMemory, kdfThreads = time, memory, threads }(kdfTime, kdfMemory, kdfThreads)
+
+	for _, p := range [][3]uint{
+		{0, 64, 4},
+		{1, 4, 4},
+		{1, 1 << 32, 4},
+		{1, 64, 0},
+		{1, 64, 256},
+	} {
+		kdfTime, kdfMemory, kdfThreads = p[0], p[1], p[2]
+		if _, err := kdfOption(); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%v: got error %v, want kind Invalid", p, err)
+		}
+	}
+
+	kdfTime, kdfMemory, kdfThreads = kdfTimeDefault, kdfMemoryDefault, kdfThreadsDefault
+	if opt, err := kdfOption(); err != nil || celo.NewEncrypter().Config(opt) != nil {
+		t.Errorf("defaults: got error %v", err)
+	}
+}
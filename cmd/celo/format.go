@@ -3,6 +3,10 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"strings"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
 )
 
 func formatGlobMatches(matches []string) string {
@@ -15,36 +19,97 @@ func formatGlobMatches(matches []string) string {
 	b.WriteString(totalMatches)
 
 	for _, m := range matches {
-		b.WriteString("  " + m + "\n")
+		b.WriteString("  " + colorFile.paint(m) + "\n")
 	}
 
 	return b.String()
 }
 
 func formatEncryptedFiles(encrypted []string, errors []error) string {
-	success := len(encrypted)
-	failed := len(errors)
-	summary := fmt.Sprintf("%d file(s) encrypted. (%d failed)\n", success, failed)
+	return formatProcessedFiles("encrypted", "Encrypted", encrypted, errors)
+}
 
-	if success == 0 {
-		return summary
+func formatDecryptedFiles(decrypted []string, errors []error) string {
+	return formatProcessedFiles("decrypted", "Decrypted", decrypted, errors)
+}
+
+func formatRekeyedFiles(rekeyed []string, errors []error) string {
+	return formatProcessedFiles("rekeyed", "Rekeyed", rekeyed, errors)
+}
+
+// splitResults returns the outputs of the files processed successfully, the
+// errors of the ones that failed and the number of files skipped.
+func splitResults(results []celo.FileResult) (outputs []string, errs []error, skipped int) {
+	outputs, errs = []string{}, []error{}
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			skipped++
+		case r.Err != nil:
+			errs = append(errs, r.Err)
+		default:
+			outputs = append(outputs, r.Output)
+		}
 	}
+	return outputs, errs, skipped
+}
+
+// formatSkippedFiles summary of the files skipped because their output
+// already exists, empty if n is 0.
+func formatSkippedFiles(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return colorSkipped.paint(fmt.Sprintf("%d file(s) skipped, the output already exists.", n)) + "\n"
+}
 
+// formatDryRun report of what an operation would do with each file, see
+// -dry-run.
+func formatDryRun(action string, planned []plannedFile, removeSource bool) string {
 	b := new(bytes.Buffer)
-	b.WriteString(summary)
-	b.WriteString("\nEncrypted Files:\n")
+	processed := 0
 
-	for _, e := range encrypted {
-		b.WriteString("  " + e + "\n")
+	for _, p := range planned {
+		switch {
+		case errors.Is(errors.Skipped, p.err):
+			fmt.Fprintf(b, "  %s %s, %s already exists\n", colorFile.paint(p.source), colorSkipped.paint("skipped"), p.output)
+		case errors.Is(errors.Exist, p.err):
+			fmt.Fprintf(b, "  %s %s, %s already exists\n", colorFile.paint(p.source), colorFailed.paint("fails"), p.output)
+		case p.err != nil:
+			fmt.Fprintf(b, "  %s %s: %v\n", colorFile.paint(p.source), colorFailed.paint("fails"), p.err)
+		default:
+			processed++
+			var notes []string
+			if p.replace {
+				notes = append(notes, "overwritten")
+			}
+			if removeSource {
+				notes = append(notes, "source removed")
+			}
+			fmt.Fprintf(b, "  %s -> %s", colorFile.paint(p.source), colorOK.paint(p.output))
+			if len(notes) > 0 {
+				fmt.Fprintf(b, " (%s)", strings.Join(notes, ", "))
+			}
+			b.WriteString("\n")
+		}
 	}
 
-	return b.String()
+	summary := fmt.Sprintf("Dry run, no file was modified. %d file(s) would be %s, %d skipped or failing.\n", processed, action, len(planned)-processed)
+	return summary + b.String()
 }
 
-func formatDecryptedFiles(encrypted []string, errors []error) string {
-	success := len(encrypted)
+// formatProcessedFiles summary of a batch operation.
+func formatProcessedFiles(action, title string, processed []string, errors []error) string {
+	success := len(processed)
 	failed := len(errors)
-	summary := fmt.Sprintf("%d file(s) decrypted. (%d failed)\n", success, failed)
+	done, errs := fmt.Sprintf("%d file(s) %s.", success, action), fmt.Sprintf("(%d failed)", failed)
+	if success > 0 {
+		done = colorOK.paint(done)
+	}
+	if failed > 0 {
+		errs = colorFailed.paint(errs)
+	}
+	summary := done + " " + errs + "\n"
 
 	if success == 0 {
 		return summary
@@ -52,10 +117,10 @@ func formatDecryptedFiles(encrypted []string, errors []error) string {
 
 	b := new(bytes.Buffer)
 	b.WriteString(summary)
-	b.WriteString("\nDecrypted Files:\n")
+	b.WriteString("\n" + title + " Files:\n")
 
-	for _, e := range encrypted {
-		b.WriteString("  " + e + "\n")
+	for _, p := range processed {
+		b.WriteString("  " + colorFile.paint(p) + "\n")
 	}
 
 	return b.String()
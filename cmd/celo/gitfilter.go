@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// Modes of git-filter.
+const (
+	// gitFilterClean encrypts the working tree file read from Stdin before
+	// it is stored in the repository.
+	gitFilterClean = "clean"
+	// gitFilterSmudge decrypts the file stored in the repository before it is
+	// written to the working tree.
+	gitFilterSmudge = "smudge"
+)
+
+var gitFilterCommand = flag.NewFlagSet("git-filter", flag.ContinueOnError)
+
+func initGitFilterFlags() {
+	gitFilterCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	gitFilterCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	gitFilterCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	gitFilterCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+}
+
+// gitIndexBlob returns the content of the file path in the index of the git
+// repository of the working directory.
+var gitIndexBlob = func(path string) ([]byte, error) {
+	b, err := exec.Command("git", "cat-file", "blob", ":"+path).Output()
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Entity(path), err)
+	}
+	return b, nil
+}
+
+// isEncrypted reports whether b was encrypted by celo.
+func isEncrypted(b []byte) bool {
+	ok, _, _ := celo.Sniff(bytes.NewReader(b))
+	return ok
+}
+
+// cleanFile returns plaintext, the content of the file path, encrypted with
+// the phrase of p. Git runs the filter whenever it checks the working tree, so the blob
+// in the index is returned as it is if it still decrypts to plaintext,
+// otherwise the file would always be modified: encrypting the same plaintext
+// twice doesn't give the same file.
+// Empty and already encrypted files are returned as they are, without asking
+// for the phrase.
+func cleanFile(p celo.PhraseProvider, path string, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 || isEncrypted(plaintext) {
+		return plaintext, nil
+	}
+
+	secret, err := p.Phrase(false)
+	if err != nil {
+		return nil, err
+	}
+	defer celo.ZeroBytes(secret)
+
+	if path != "" {
+		if blob, err := gitIndexBlob(path); err == nil && isEncrypted(blob) {
+			staged, err := celo.DecryptBytes(secret, blob, agentOption())
+			same := err == nil && bytes.Equal(staged, plaintext)
+			celo.ZeroBytes(staged)
+			if same {
+				return blob, nil
+			}
+		}
+	}
+
+	return celo.EncryptBytes(secret, plaintext, agentOption())
+}
+
+// smudgeFile returns the plaintext of blob decrypted with the phrase of p.
+// Files that weren't encrypted by celo, e.g. committed before the filter was
+// set up, are returned as they are, without asking for the phrase.
+func smudgeFile(p celo.PhraseProvider, blob []byte) ([]byte, error) {
+	if !isEncrypted(blob) {
+		return blob, nil
+	}
+
+	secret, err := p.Phrase(false)
+	if err != nil {
+		return nil, err
+	}
+	defer celo.ZeroBytes(secret)
+
+	return celo.DecryptBytes(secret, blob, agentOption())
+}
+
+// gitFilterMode returns the mode of git-filter, the first of args. It returns
+// an error of kind errors.Invalid if it isn't clean or smudge.
+func gitFilterMode(args []string) (string, error) {
+	if len(args) == 0 || (args[0] != gitFilterClean && args[0] != gitFilterSmudge) {
+		return "", errors.E(errors.Invalid, errors.Errorf("git-filter requires a mode: %s or %s", gitFilterClean, gitFilterSmudge))
+	}
+	return args[0], nil
+}
+
+func gitFilter(args []string) (err error) {
+
+	initGitFilterFlags()
+	if len(args) > 0 && hasHelpFlag(args[:1]) {
+		return parseFlags(gitFilterCommand, args[:1])
+	}
+	mode, err := gitFilterMode(args)
+	if err != nil {
+		return err
+	}
+	if err = parseFlags(gitFilterCommand, args[1:]); err != nil {
+		return err
+	}
+	if gitFilterCommand.NArg() > 1 {
+		return errors.E(errors.Invalid, errors.Errorf("git-filter takes a single file path, got %q", gitFilterCommand.Args()))
+	}
+	// The path of the file in the repository, %f in the git configuration.
+	path := gitFilterCommand.Arg(0)
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, path)
+	if err != nil {
+		return err
+	}
+	// Stdin and Stdout carry the file.
+	phrase = ttyPhrase(withAgent(phrase))
+
+	in, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return errors.E(errors.Open, errors.Entity(stdioSource), err)
+	}
+
+	var out []byte
+	if mode == gitFilterClean {
+		out, err = cleanFile(phrase, path, in)
+	} else {
+		out, err = smudgeFile(phrase, in)
+		defer celo.ZeroBytes(out)
+	}
+	if err != nil {
+		return errors.E(errors.Entity(path), err)
+	}
+
+	if _, err = os.Stdout.Write(out); err != nil {
+		return errors.E(errors.Create, errors.Entity(stdioSource), err)
+	}
+	return nil
+}
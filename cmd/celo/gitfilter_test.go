@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// noPhrase is a PhraseProvider that fails the test if the phrase is asked.
+func noPhrase(t *testing.T) celo.PhraseProvider {
+	return celo.PhraseFunc(func(bool) ([]byte, error) {
+		t.Error("phrase asked")
+		return nil, errors.E(errors.PhraseOther)
+	})
+}
+
+// stageBlob makes gitIndexBlob return blob as the staged file.
+func stageBlob(t *testing.T, blob []byte) {
+	original := gitIndexBlob
+	t.Cleanup(func() { gitIndexBlob = original })
+	gitIndexBlob = func(string) ([]byte, error) {
+		if blob == nil {
+			return nil, errors.E(errors.Open)
+		}
+		return blob, nil
+	}
+}
+
+func TestGitFilter(t *testing.T) {
+	stageBlob(t, nil)
+	phrase := celo.PhraseFunc(func(bool) ([]byte, error) { return []byte("secret"), nil })
+	plaintext := []byte("API_KEY=1234\n")
+
+	blob, err := cleanFile(phrase, "secrets.env", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(blob) {
+		t.Fatal("clean didn't encrypt the file")
+	}
+	got, err := smudgeFile(phrase, blob)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("smudge: got %q, %v", got, err)
+	}
+
+	// The staged blob is kept while the file doesn't change.
+	stageBlob(t, blob)
+	if again, err := cleanFile(phrase, "secrets.env", plaintext); err != nil || !bytes.Equal(again, blob) {
+		t.Errorf("unchanged file: got a new blob, %v", err)
+	}
+	changed, err := cleanFile(phrase, "secrets.env", []byte("API_KEY=5678\n"))
+	if err != nil || bytes.Equal(changed, blob) || !isEncrypted(changed) {
+		t.Errorf("changed file: got the staged blob, %v", err)
+	}
+	// Without the path, the staged blob is unknown.
+	if fresh, err := cleanFile(phrase, "", plaintext); err != nil || bytes.Equal(fresh, blob) {
+		t.Errorf("no path: got the staged blob, %v", err)
+	}
+
+	wrong := celo.PhraseFunc(func(bool) ([]byte, error) { return []byte("wrong"), nil })
+	if _, err = smudgeFile(wrong, blob); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got %v, want kind WrongPassphrase", err)
+	}
+	// A staged blob that the phrase doesn't decrypt is replaced.
+	if other, err := cleanFile(wrong, "secrets.env", plaintext); err != nil || bytes.Equal(other, blob) {
+		t.Errorf("wrong phrase: got the staged blob, %v", err)
+	}
+}
+
+func TestGitFilterPassThrough(t *testing.T) {
+	stageBlob(t, nil)
+	blob, err := celo.EncryptBytes([]byte("secret"), []byte("API_KEY=1234\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that are empty, already encrypted or not encrypted by celo don't
+	// need the phrase.
+	for _, tt := range []struct {
+		name   string
+		filter func([]byte) ([]byte, error)
+		in     []byte
+	}{
+		{"clean empty", func(b []byte) ([]byte, error) { return cleanFile(noPhrase(t), "a", b) }, nil},
+		{"clean encrypted", func(b []byte) ([]byte, error) { return cleanFile(noPhrase(t), "a", b) }, blob},
+		{"smudge plaintext", func(b []byte) ([]byte, error) { return smudgeFile(noPhrase(t), b) }, []byte("API_KEY=1234\n")},
+	} {
+		if out, err := tt.filter(tt.in); err != nil || !bytes.Equal(out, tt.in) {
+			t.Errorf("%s: got %q, %v", tt.name, out, err)
+		}
+	}
+}
+
+func TestGitFilterMode(t *testing.T) {
+	for _, args := range [][]string{nil, {"encrypt"}, {"-phrase-env", "CELO_PHRASE", "clean"}} {
+		if _, err := gitFilterMode(args); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%q: got %v, want kind Invalid", args, err)
+		}
+	}
+	if mode, err := gitFilterMode([]string{"smudge", "a"}); err != nil || mode != gitFilterSmudge {
+		t.Errorf("smudge: got %q, %v", mode, err)
+	}
+}
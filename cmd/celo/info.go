@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+const (
+	infoExcludeUsage = "Exclude `file name or glob pattern` from the files inspected.\n\tUseful when a glob is used as the source selector. Can be repeated."
+)
+
+var (
+	// Exclude file names or glob patterns.
+	infoExclude stringList
+)
+
+var infoCommand = flag.NewFlagSet("info", flag.ContinueOnError)
+
+func initInfoFlags() {
+	infoCommand.Var(&infoExclude, "exclude", infoExcludeUsage)
+	infoCommand.Var(&include, "include", includeUsage)
+	infoCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	infoCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	infoCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// inspectFile returns the details of the encrypted file name.
+func inspectFile(name string) (celo.Info, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return celo.Info{}, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	info, err := celo.Inspect(f)
+	if err != nil {
+		return info, errors.E(errors.Op("main.inspectFile"), errors.Entity(name), err)
+	}
+	return info, nil
+}
+
+func info(src []string, args []string) (err error) {
+
+	initInfoFlags()
+	if err = parseFlags(infoCommand, args); err != nil {
+		return err
+	}
+	setupColors()
+
+	matches, err := matchSources(src, infoExclude)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Fprint(os.Stdout, formatGlobMatches(matches))
+		return nil
+	}
+
+	var first error
+	failed := 0
+	for i, name := range matches {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+
+		info, err := inspectFile(name)
+		if err == nil || errors.Is(errors.Truncated, err) {
+			// The header of truncated files was decoded, the details are
+			// still useful.
+			fmt.Fprint(os.Stdout, formatInfo(name, info))
+		} else {
+			fmt.Fprintln(os.Stdout, colorFile.paint(name))
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "  %s\n", colorFailed.paint(err.Error()))
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		// The exit code tells why the first file failed (See exitCode).
+		return errors.E(errorKind(first), errors.Errorf("%d file(s) couldn't be inspected", failed))
+	}
+
+	return nil
+}
+
+// formatInfo details of the encrypted file name.
+func formatInfo(name string, info celo.Info) string {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	recipients := "phrase"
+	if info.Envelope {
+		types := make([]string, len(info.Recipients))
+		for i, t := range info.Recipients {
+			types[i] = t.String()
+		}
+		recipients = strings.Join(types, ", ")
+	}
+
+	kdf := info.KDF
+	if kdf == "" {
+		kdf = "none, public keys only"
+	}
+
+	chunks := "not chunked"
+	if info.ChunkSize > 0 {
+		chunks = formatBytes(int64(info.ChunkSize))
+	}
+
+	b := new(bytes.Buffer)
+	fmt.Fprintln(b, colorFile.paint(name))
+	for _, field := range [][2]string{
+		{"Version", fmt.Sprint(info.Version)},
+		{"Cipher", info.Cipher},
+		{"KDF", kdf},
+		{"Salt size", fmt.Sprintf("%d bytes", info.SaltSize)},
+		{"Nonce size", fmt.Sprintf("%d bytes", info.NonceSize)},
+		{"Recipients", recipients},
+		{"Padding", info.Padding.String()},
+		{"Chunk size", chunks},
+		{"Signed", yesNo(info.Signed)},
+		{"Trailer", yesNo(info.Trailer)},
+		{"Archive", yesNo(info.Archive)},
+		{"Header size", formatBytes(int64(info.HeaderSize))},
+		{"Payload size", formatBytes(info.PayloadSize)},
+		{"Size", formatBytes(info.Size)},
+	} {
+		fmt.Fprintf(b, "  %-13s %s\n", field[0]+":", field[1])
+	}
+	return b.String()
+}
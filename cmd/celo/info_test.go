@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestInspectFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fileName, err := celo.NewEncrypter().EncryptFile([]byte("secret"), name, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := inspectFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := formatInfo(fileName, info)
+	for _, want := range []string{
+		fileName + "\n",
+		"  Version:      2\n",
+		"  Cipher:       AES-256-GCM\n",
+		"  KDF:          " + info.KDF + "\n",
+		"  Recipients:   phrase\n",
+		"  Signed:       no\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("details %q don't contain %q", got, want)
+		}
+	}
+	if info.KDF == "" {
+		t.Error("files encrypted with a phrase have a KDF")
+	}
+
+	// Files without a phrase stanza can't be opened with a phrase.
+	if got := formatInfo(fileName, celo.Info{Envelope: true}); !strings.Contains(got, "  KDF:          none, public keys only\n") {
+		t.Errorf("no KDF: got %q", got)
+	}
+
+	// Truncated files still have their header decoded.
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.celo")
+	if err = os.WriteFile(truncated, b[:len(b)-20], 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err = inspectFile(truncated)
+	if !errors.Is(errors.Truncated, err) || exitCode(err) != exitCorrupt {
+		t.Errorf("truncated: got %v, want kind Truncated", err)
+	}
+	if info.Version == 0 || info.Cipher == "" {
+		t.Errorf("truncated: got no details %+v", info)
+	}
+}
+
+func TestInspectFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(plain, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := inspectFile(plain); exitCode(err) != exitNotCelo {
+		t.Errorf("plain file: got %v (exit code %d), want exit code %d", err, exitCode(err), exitNotCelo)
+	}
+	if _, err := inspectFile(filepath.Join(dir, "missing.celo")); exitCode(err) != exitOpen {
+		t.Errorf("missing file: got %v (exit code %d), want exit code %d", err, exitCode(err), exitOpen)
+	}
+}
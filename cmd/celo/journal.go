@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+const resumeUsage = "Resume an interrupted run of the same command, in the same directory and with the same sources:\n\tthe files it processed are skipped and the partial outputs it left are removed."
+
+// Resume an interrupted batch.
+var resume bool
+
+// journalEntry line of a journal, a file processed.
+type journalEntry struct {
+	Source string `json:"source"`
+	Output string `json:"output"`
+}
+
+// journal records the files processed by a batch as they are done, so an
+// interrupted run can be resumed (See -resume). It is removed once the batch
+// finishes.
+type journal struct {
+	name string
+	mu   sync.Mutex
+	f    *os.File
+	// done absolute names of the sources processed by the interrupted run.
+	done map[string]bool
+	// cut whether the last line of the journal was cut by the interruption.
+	cut bool
+	// err first error writing the journal.
+	err error
+}
+
+// journalPath returns the name of the journal of the command run with the
+// sources src in the working directory, in the cache directory of the user.
+func journalPath(command string, src []string) (string, error) {
+	op := errors.Op("main.journalPath")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", errors.E(errors.Open, op, err)
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.E(errors.Open, op, err)
+	}
+
+	h := sha256.New()
+	for _, s := range append([]string{command, wd, outputDir, filesFrom}, src...) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(cache, "celo", "journals", hex.EncodeToString(h.Sum(nil)[:16])+".jsonl"), nil
+}
+
+// openJournal creates the journal name, or reads the files it records and
+// appends to it if resume is true and it exists.
+func openJournal(name string, resume bool) (*journal, error) {
+	op := errors.Op("main.openJournal")
+	j := &journal{name: name, done: map[string]bool{}}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if err := j.read(); err != nil {
+			return nil, errors.E(op, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, errors.E(errors.Create, op, errors.Entity(name), err)
+	}
+	f, err := os.OpenFile(name, flags, 0600)
+	if err == nil && j.cut {
+		// The next line starts after the one that was cut.
+		if _, err = f.WriteString("\n"); err != nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return nil, errors.E(errors.Create, op, errors.Entity(name), err)
+	}
+	j.f = f
+	return j, nil
+}
+
+// read reads the files processed recorded by the journal, if it exists. A
+// last line cut by the interruption is ignored.
+func (j *journal) read() error {
+	f, err := os.Open(j.name)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return errors.E(errors.Open, errors.Entity(j.name), err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		var e journalEntry
+		if json.Unmarshal(line, &e) == nil && e.Source != "" {
+			j.done[e.Source] = true
+		}
+		switch {
+		case err == io.EOF:
+			j.cut = len(line) > 0
+			return nil
+		case err != nil:
+			return errors.E(errors.Open, errors.Entity(j.name), err)
+		}
+	}
+}
+
+// pending returns the files of names that the interrupted run didn't process.
+func (j *journal) pending(names []string) []string {
+	var pending []string
+	for _, name := range names {
+		if !j.done[absPath(name)] {
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+// record records the file of r if it was processed. It is synced to the disk
+// right away, the run can be interrupted at any time.
+func (j *journal) record(r celo.FileResult) {
+	if r.Err != nil || r.Skipped {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return
+	}
+
+	b, err := json.Marshal(journalEntry{Source: absPath(r.Source), Output: absPath(r.Output)})
+	if err == nil {
+		_, err = j.f.Write(append(b, '\n'))
+	}
+	if err == nil {
+		err = j.f.Sync()
+	}
+	if err != nil {
+		j.err = errors.E(errors.Create, errors.Entity(j.name), err)
+	}
+}
+
+// finish removes the journal, the batch wasn't interrupted. It returns the
+// first error writing it.
+func (j *journal) finish() error {
+	j.f.Close()
+	os.Remove(j.name)
+	return j.err
+}
+
+// absPath returns the absolute name of the file name, or name if it can't be
+// found.
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
+
+// removePartialOutputs removes the temporary files left by an interrupted
+// run when it was writing the output of one of the sources (See
+// file.CreateTemp), outputName returns the name of the output of a source.
+func removePartialOutputs(sources []string, outputName func(string) string) {
+	for _, src := range sources {
+		dir, base := filepath.Split(outputName(src))
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if n := e.Name(); strings.HasPrefix(n, "."+base+".") && strings.HasSuffix(n, ".tmp") && !e.IsDir() {
+				os.Remove(filepath.Join(dir, n))
+			}
+		}
+	}
+}
+
+// startJournal opens the journal of the batch of the command on the matches
+// of src. With -resume, it returns the matches that the interrupted run
+// didn't process, once their partial outputs are removed, and prints how
+// many were skipped.
+func startJournal(command string, src, matches []string, outputName func(string) string) (*journal, []string, error) {
+	name, err := journalPath(command, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	j, err := openJournal(name, resume)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !resume {
+		return j, matches, nil
+	}
+
+	pending := j.pending(matches)
+	removePartialOutputs(pending, outputName)
+	if skipped := len(matches) - len(pending); skipped > 0 && !jsonOutput {
+		fmt.Fprintf(summaries(), "%d file(s) already processed by the interrupted run, skipped.\n", skipped)
+	}
+	return j, pending, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestJournalPath(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	a, err := journalPath("encrypt", []string{"*.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := journalPath("encrypt", []string{"*.txt"}); b != a {
+		t.Errorf("got %s and %s for the same run", a, b)
+	}
+	for _, other := range [][]string{{"decrypt", "*.txt"}, {"encrypt", "*.md"}, {"encrypt", "*.txt", "*.md"}} {
+		if b, _ := journalPath(other[0], other[1:]); b == a {
+			t.Errorf("%q: got the journal of encrypt *.txt", other)
+		}
+	}
+}
+
+func TestJournalResume(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "journals", "j.jsonl")
+	sources := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c"), filepath.Join(dir, "d")}
+
+	j, err := openJournal(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.record(celo.FileResult{Source: sources[0], Output: sources[0] + ".celo"})
+	j.record(celo.FileResult{Source: sources[1], Err: errors.E(errors.Encrypt)})
+	j.record(celo.FileResult{Source: sources[2], Skipped: true})
+	j.record(celo.FileResult{Source: sources[3], Output: sources[3] + ".celo"})
+	// The run is interrupted while a line is written.
+	j.f.WriteString(`{"source":"` + sources[1])
+	j.f.Close()
+
+	if j, err = openJournal(name, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := j.pending(sources), sources[1:3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("pending = %q, want %q", got, want)
+	}
+	j.record(celo.FileResult{Source: sources[1], Output: sources[1] + ".celo"})
+	j.f.Close()
+
+	if j, err = openJournal(name, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := j.pending(sources), sources[2:3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("pending after the second run = %q, want %q", got, want)
+	}
+	if err = j.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("the journal wasn't removed: %v", err)
+	}
+
+	// Without -resume the journal starts over.
+	if j, err = openJournal(name, false); err != nil {
+		t.Fatal(err)
+	}
+	defer j.finish()
+	if got := j.pending(sources); !reflect.DeepEqual(got, sources) {
+		t.Errorf("pending without -resume = %q, want every source", got)
+	}
+}
+
+func TestJournalRecordError(t *testing.T) {
+	j, err := openJournal(filepath.Join(t.TempDir(), "j.jsonl"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.f.Close()
+	j.record(celo.FileResult{Source: "a", Output: "a.celo"})
+	if err = j.finish(); !errors.Is(errors.Create, err) {
+		t.Errorf("got error %v, want kind Create", err)
+	}
+}
+
+func TestRemovePartialOutputs(t *testing.T) {
+	dir := t.TempDir()
+	partial := filepath.Join(dir, ".a.txt.celo.123456.tmp")
+	others := []string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, ".b.txt.celo.123456.tmp"),
+		filepath.Join(dir, ".a.txt.celo.bak"),
+	}
+	for _, name := range append([]string{partial}, others...) {
+		writeFile(t, name, "data")
+	}
+
+	removePartialOutputs([]string{filepath.Join(dir, "a.txt")}, func(name string) string { return name + ".celo" })
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("the partial output wasn't removed: %v", err)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestStartJournal(t *testing.T) {
+	defer func(r bool) { resume = r }(resume)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	var sources []string
+	for _, n := range []string{"a", "b", "c"} {
+		name := filepath.Join(dir, n)
+		writeFile(t, name, "attack at dawn")
+		sources = append(sources, name)
+	}
+	src := []string{filepath.Join(dir, "*")}
+
+	// The first run is interrupted after encrypting a, while writing b.
+	resume = false
+	j, matches, err := startJournal("encrypt", src, sources, func(name string) string { return name + ".celo" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := celo.NewEncrypter()
+	if err = e.Config(celo.OnFileDone(j.record)); err != nil {
+		t.Fatal(err)
+	}
+	if r := e.EncryptFiles([]byte("secret"), matches[:1], false, false); r[0].Err != nil {
+		t.Fatal(r[0].Err)
+	}
+	j.f.Close()
+	partial := filepath.Join(dir, ".b.celo.42.tmp")
+	writeFile(t, partial, "partial")
+
+	resume = true
+	j, matches, err = startJournal("encrypt", src, sources, e.OutputName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matches, sources[1:]) {
+		t.Errorf("got matches %q, want %q", matches, sources[1:])
+	}
+	if _, err = os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("the partial output wasn't removed: %v", err)
+	}
+	if err = e.Config(celo.OnFileDone(j.record)); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range e.EncryptFiles([]byte("secret"), matches, false, false) {
+		if r.Err != nil {
+			t.Error(r.Err)
+		}
+	}
+	if err = j.finish(); err != nil {
+		t.Fatal(err)
+	}
+}
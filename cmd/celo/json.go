@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+const jsonUsage = "Print a JSON report to Stdout instead of the summaries: the status, output, error kind,\n\tbytes written and duration of each file. Can't be used when writing to Stdout."
+
+// Print a JSON report instead of the summaries.
+var jsonOutput bool
+
+// reportSink receives the reports instead of Stdout if it isn't nil, so the
+// report of each step of a plan is collected (See run).
+var reportSink func(*jsonReport)
+
+// File statuses of a JSON report.
+const (
+	statusOK      = "ok"
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+)
+
+// jsonReport is the result of a command printed with -json.
+type jsonReport struct {
+	Command   string     `json:"command"`
+	Files     []jsonFile `json:"files"`
+	Processed int        `json:"processed"`
+	Skipped   int        `json:"skipped"`
+	Failed    int        `json:"failed"`
+	// Duration of the whole operation in milliseconds.
+	Duration float64 `json:"duration_ms"`
+
+	start time.Time
+}
+
+// jsonFile is the result of processing a file.
+type jsonFile struct {
+	Source string `json:"source"`
+	Output string `json:"output,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Kind and KindCode of the error (See errors.Kind).
+	Kind     string `json:"kind,omitempty"`
+	KindCode uint16 `json:"kind_code,omitempty"`
+	// Bytes written to Output.
+	Bytes int64 `json:"bytes"`
+	// Duration of the operation in milliseconds.
+	Duration float64 `json:"duration_ms"`
+}
+
+// newJSONReport starts the report of command, nil if -json isn't used.
+func newJSONReport(command string) *jsonReport {
+	if !jsonOutput {
+		return nil
+	}
+	return &jsonReport{Command: command, Files: []jsonFile{}, start: time.Now()}
+}
+
+// add records the results of the files processed. It is a no-op on a nil
+// report.
+func (r *jsonReport) add(results ...celo.FileResult) {
+	if r == nil {
+		return
+	}
+	for _, res := range results {
+		f := jsonFile{Source: res.Source, Output: res.Output, Bytes: res.Bytes, Duration: milliseconds(res.Duration)}
+		switch {
+		case res.Skipped:
+			f.Status = statusSkipped
+			r.Skipped++
+		case res.Err != nil:
+			kind := errorKind(res.Err)
+			f.Status, f.Error, f.Kind, f.KindCode = statusFailed, res.Err.Error(), kind.String(), uint16(kind)
+			r.Failed++
+		default:
+			f.Status = statusOK
+			r.Processed++
+		}
+		r.Files = append(r.Files, f)
+	}
+}
+
+// print writes the report as JSON to w. It is a no-op on a nil report.
+func (r *jsonReport) print(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.Duration = milliseconds(time.Since(r.start))
+	if reportSink != nil {
+		reportSink(r)
+		return nil
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return errors.E(errors.Encode, errors.Errorf("unable to write the JSON report: %v", err))
+	}
+	return nil
+}
+
+// checkJSON returns an error of kind errors.Invalid if -json is used when
+// Stdout carries the output or along with -dry-run.
+func checkJSON(stdio bool) error {
+	switch {
+	case !jsonOutput:
+		return nil
+	case stdio:
+		return errors.E(errors.Invalid, errors.Errorf("-json can't be used when reading from Stdin, Stdout carries the output"))
+	case dryRun:
+		return errors.E(errors.Invalid, errors.Errorf("-json can't be used along with -dry-run"))
+	}
+	return nil
+}
+
+// fileResult calls process for the file source and returns its result: the
+// name of the output, its size and the time spent.
+func fileResult(source string, process func() (string, error)) celo.FileResult {
+	start := time.Now()
+	output, err := process()
+
+	r := celo.FileResult{Source: source, Duration: time.Since(start)}
+	switch {
+	case errors.Is(errors.Skipped, err):
+		r.Skipped = true
+	case err != nil:
+		r.Err = err
+	default:
+		r.Output = output
+		if fi, err := os.Stat(output); err == nil && fi.Mode().IsRegular() {
+			r.Bytes = fi.Size()
+		}
+	}
+	return r
+}
+
+// errorKind returns the kind of err. Batch methods wrap the errors of each file
+// with the kinds errors.Encrypt or errors.Decrypt, the kind of the wrapped error
+// is more specific.
+func errorKind(err error) errors.Kind {
+	var e *errors.Error
+	if !stderrors.As(err, &e) {
+		return errors.Other
+	}
+	if e.Kind == errors.Encrypt || e.Kind == errors.Decrypt {
+		if inner := errorKind(e.Err); inner != errors.Other {
+			return inner
+		}
+	}
+	return e.Kind
+}
+
+// milliseconds returns d in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestJSONReport(t *testing.T) {
+	t.Cleanup(func() { jsonOutput = false })
+
+	if rep := newJSONReport("encrypt"); rep != nil {
+		t.Fatalf("without -json: got %+v", rep)
+	}
+	// A nil report is a no-op.
+	var rep *jsonReport
+	rep.add(celo.FileResult{Source: "a.txt"})
+	var buf bytes.Buffer
+	if err := rep.print(&buf); err != nil || buf.Len() != 0 {
+		t.Fatalf("nil report: got %q, %v", buf.String(), err)
+	}
+
+	jsonOutput = true
+	rep = newJSONReport("encrypt")
+	exist := errors.E(errors.Exist, errors.Entity("b.txt.celo"), errors.Errorf("File already exist"))
+	rep.add(
+		celo.FileResult{Source: "a.txt", Output: "a.txt.celo", Bytes: 206, Duration: 1500 * time.Microsecond},
+		celo.FileResult{Source: "b.txt", Err: errors.E(errors.Encrypt, errors.Op("encrypter.EncryptMultipleFiles"), exist)},
+		celo.FileResult{Source: "c.txt", Skipped: true},
+	)
+	if err := rep.print(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if got.Command != "encrypt" || got.Processed != 1 || got.Failed != 1 || got.Skipped != 1 || len(got.Files) != 3 {
+		t.Fatalf("got %+v", got)
+	}
+	if f := got.Files[0]; f.Status != statusOK || f.Output != "a.txt.celo" || f.Bytes != 206 || f.Duration != 1.5 || f.Error != "" {
+		t.Errorf("processed file: got %+v", f)
+	}
+	// The kind of the batch error is the one of the error it wraps.
+	if f := got.Files[1]; f.Status != statusFailed || f.Kind != errors.Exist.String() || f.KindCode != uint16(errors.Exist) || f.Error == "" {
+		t.Errorf("failed file: got %+v", f)
+	}
+	if f := got.Files[2]; f.Status != statusSkipped || f.Output != "" {
+		t.Errorf("skipped file: got %+v", f)
+	}
+
+	// Files is never null, so scripts can iterate over it.
+	buf.Reset()
+	if err := newJSONReport("verify").print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"files": []`)) {
+		t.Errorf("empty report: got %s", buf.String())
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want errors.Kind
+	}{
+		{errors.E(errors.WrongPassphrase, errors.Errorf("wrong")), errors.WrongPassphrase},
+		{errors.E(errors.Decrypt, errors.E(errors.Truncated, errors.Errorf("short"))), errors.Truncated},
+		// Nothing more specific is wrapped.
+		{errors.E(errors.Decrypt, errors.Errorf("failed")), errors.Decrypt},
+		{os.ErrNotExist, errors.Other},
+	} {
+		if got := errorKind(tc.err); got != tc.want {
+			t.Errorf("errorKind(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	t.Cleanup(func() { jsonOutput, dryRun = false, dryRunDefault })
+
+	if err := checkJSON(true); err != nil {
+		t.Errorf("without -json: got %v", err)
+	}
+
+	jsonOutput = true
+	if err := checkJSON(false); err != nil {
+		t.Errorf("files: got %v", err)
+	}
+	if err := checkJSON(true); !errors.Is(errors.Invalid, err) {
+		t.Errorf("Stdin: got %v, want kind Invalid", err)
+	}
+	dryRun = true
+	if err := checkJSON(false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-dry-run: got %v, want kind Invalid", err)
+	}
+}
+
+func TestFileResult(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := fileResult("src", func() (string, error) { return name, nil })
+	if r.Source != "src" || r.Output != name || r.Bytes != 14 || r.Err != nil || r.Skipped {
+		t.Errorf("processed: got %+v", r)
+	}
+
+	r = fileResult("src", func() (string, error) { return name, errors.E(errors.Exist, errors.Errorf("exists")) })
+	if r.Output != "" || r.Bytes != 0 || !errors.Is(errors.Exist, r.Err) {
+		t.Errorf("failed: got %+v", r)
+	}
+
+	r = fileResult("src", func() (string, error) { return name, errors.E(errors.Skipped, errors.Errorf("skipped")) })
+	if !r.Skipped || r.Err != nil || r.Output != "" {
+		t.Errorf("skipped: got %+v", r)
+	}
+
+	// Directories, such as extracted archives, have no size.
+	r = fileResult("src", func() (string, error) { return filepath.Dir(name), nil })
+	if r.Output == "" || r.Bytes != 0 {
+		t.Errorf("directory: got %+v", r)
+	}
+}
+
+func TestRekeyResults(t *testing.T) {
+	errB := errors.E(errors.Decrypt, errors.Entity("b"), errors.Errorf("failed"))
+	results := rekeyResults([]string{"a", "b", "c"}, []string{"a", "c"}, []error{errB})
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if r := results[0]; r.Source != "a" || r.Output != "a" || r.Err != nil {
+		t.Errorf("a: got %+v", r)
+	}
+	if r := results[1]; r.Source != "b" || r.Output != "" || r.Err != errB {
+		t.Errorf("b: got %+v", r)
+	}
+	if r := results[2]; r.Source != "c" || r.Output != "c" || r.Err != nil {
+		t.Errorf("c: got %+v", r)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+const (
+	keygenOutputDefault = ""
+	keygenOutputUsage   = "Write the key to `file` instead of Stdout.\n\tThe file is created with 0600 permissions unless -mode is used."
+
+	keygenTypeDefault = "x25519"
+	keygenTypeUsage   = "`type` of key to generate.\n\tx25519: identity to decrypt files encrypted for its public key (encrypt -recipient).\n\ted25519: key to sign encrypted files (encrypt -sign-key).\n\tsecret: random key to use instead of a Secret Phrase (-phrase-file)."
+
+	keygenModeUsage = "Permissions `mode` (octal) of the key file created with -o, such as 0400."
+
+	keygenArmorDefault = false
+	keygenArmorUsage   = "Encode secret keys in base64, so they can be printed or copied as text.\n\tThe other types of keys are always text."
+
+	// keygenSecretSize size in bytes of the secret keys, the size of the
+	// keys derived from phrases.
+	keygenSecretSize = 32
+	// keygenFileMode permissions of the key files by default.
+	keygenFileMode os.FileMode = 0600
+)
+
+var (
+	// File name where the key is written.
+	keygenOutput string
+	// Type of key to generate.
+	keygenType string
+	// Encode secret keys in base64.
+	keygenArmor bool
+)
+
+var keygenCommand = flag.NewFlagSet("keygen", flag.ContinueOnError)
+
+func initKeygenFlags() {
+	keygenCommand.StringVar(&keygenOutput, "o", keygenOutputDefault, keygenOutputUsage)
+	keygenCommand.BoolVar(&overwrite, "ow", overwriteDefault, overwriteUsage)
+	keygenCommand.StringVar(&keygenType, "type", keygenTypeDefault, keygenTypeUsage)
+	keygenCommand.StringVar(&fileMode, "mode", fileModeDefault, keygenModeUsage)
+	keygenCommand.BoolVar(&keygenArmor, "armor", keygenArmorDefault, keygenArmorUsage)
+}
+
+// secretKey random key used as a Secret Phrase. Its textual encoding is
+// base64.
+type secretKey []byte
+
+func (k secretKey) String() string {
+	return base64.StdEncoding.EncodeToString(k)
+}
+
+// generateKey generates a key of the given type.
+// It returns the textual encoding of the private and public keys. Secret keys
+// don't have a public key.
+func generateKey(keyType string) (private, public fmt.Stringer, err error) {
+	switch keyType {
+	case "secret":
+		k := make(secretKey, keygenSecretSize)
+		if _, err := rand.Read(k); err != nil {
+			return nil, nil, errors.E(errors.Key, err)
+		}
+		return k, nil, nil
+	case "x25519":
+		id, err := celo.GenerateX25519Identity()
+		if err != nil {
+			return nil, nil, err
+		}
+		return id, id.Recipient(), nil
+	case "ed25519":
+		k, err := celo.GenerateSigningKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		return k, k.Public(), nil
+	}
+	return nil, nil, errors.E(errors.Key, errors.Errorf("Unknown key type %s", keyType))
+}
+
+// checkKeygenFlags returns the permissions of the key file, or an error of
+// kind errors.Invalid if the flags of keygen can't be used together.
+func checkKeygenFlags() (os.FileMode, error) {
+	if keygenArmor && keygenType != "secret" {
+		return 0, errors.E(errors.Invalid, errors.Errorf("-armor only applies to secret keys, %s keys are always text", keygenType))
+	}
+	// A terminal would mangle the raw bytes.
+	if keygenType == "secret" && !keygenArmor && keygenOutput == "" && isTerminal(os.Stdout) {
+		return 0, errors.E(errors.Invalid, errors.Errorf("Secret keys are binary, use -o or -armor to print them"))
+	}
+
+	if fileMode == "" {
+		return keygenFileMode, nil
+	}
+	if keygenOutput == "" {
+		return 0, errors.E(errors.Invalid, errors.Errorf("-mode requires -o"))
+	}
+	return parseFileMode(fileMode)
+}
+
+// writeKey writes the private key to w. Identities and signing keys are
+// preceded by comments with the time they were created and their public key.
+// Secret keys are written as they are, the whole file is the phrase (See
+// celo.FilePhrase), in base64 if armor is true.
+func writeKey(w io.Writer, private, public fmt.Stringer, armor bool) error {
+	var err error
+	if k, ok := private.(secretKey); ok {
+		if armor {
+			_, err = fmt.Fprintf(w, "%s\n", k)
+		} else {
+			_, err = w.Write(k)
+		}
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), public, private)
+	return err
+}
+
+func keygen(args []string) (err error) {
+
+	initKeygenFlags()
+	if err = parseFlags(keygenCommand, args); err != nil {
+		return err
+	}
+	mode, err := checkKeygenFlags()
+	if err != nil {
+		return err
+	}
+
+	private, public, err := generateKey(keygenType)
+	if err != nil {
+		return err
+	}
+
+	if keygenOutput == "" {
+		return writeKey(os.Stdout, private, public, keygenArmor)
+	}
+
+	f, _, err := file.Create(keygenOutput, overwrite)
+	if err != nil {
+		return err
+	}
+
+	// The key is a secret, it shouldn't be readable by other users unless
+	// -mode says otherwise.
+	if err = f.Chmod(mode); err == nil {
+		err = writeKey(f, private, public, keygenArmor)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.E(errors.Create, errors.Entity(keygenOutput), err)
+	}
+
+	if public != nil {
+		// The public key is the only value that can be shared.
+		fmt.Fprintf(os.Stdout, "Public key: %s\n", public)
+	}
+
+	return nil
+}
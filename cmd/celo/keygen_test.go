@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, keyType := range []string{"x25519", "ed25519"} {
+		private, public, err := generateKey(keyType)
+		if err != nil || private == nil || public == nil {
+			t.Errorf("%s: got %v, %v, %v", keyType, private, public, err)
+		}
+	}
+
+	private, public, err := generateKey("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := private.(secretKey)
+	if !ok || len(k) != keygenSecretSize || public != nil {
+		t.Errorf("secret: got %v, %v", private, public)
+	}
+	if other, _, _ := generateKey("secret"); bytes.Equal(other.(secretKey), k) {
+		t.Error("secret: the same key was generated twice")
+	}
+
+	if _, _, err = generateKey("rsa"); !errors.Is(errors.Key, err) {
+		t.Errorf("unknown type: got %v, want kind Key", err)
+	}
+}
+
+func TestWriteKey(t *testing.T) {
+	k := secretKey(bytes.Repeat([]byte{0xff}, keygenSecretSize))
+
+	var buf bytes.Buffer
+	if err := writeKey(&buf, k, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), k) {
+		t.Errorf("raw: got %q", buf.Bytes())
+	}
+
+	buf.Reset()
+	if err := writeKey(&buf, k, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != base64.StdEncoding.EncodeToString(k)+"\n" {
+		t.Errorf("armored: got %q", got)
+	}
+
+	private, public, err := generateKey("x25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = writeKey(&buf, private, public, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "# public key: "+public.String()+"\n") || !strings.HasSuffix(got, private.String()+"\n") {
+		t.Errorf("identity: got %q", got)
+	}
+}
+
+// Secret keys are used as phrases, both raw and armored.
+func TestSecretKeyPhrase(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, armor := range []bool{false, true} {
+		private, _, err := generateKey("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err = writeKey(&buf, private, nil, armor); err != nil {
+			t.Fatal(err)
+		}
+		keyFile := filepath.Join(dir, "key")
+		if err = os.WriteFile(keyFile, buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		secret, err := celo.FilePhrase(keyFile).Phrase(false)
+		if err != nil {
+			t.Fatalf("armor %v: %v", armor, err)
+		}
+		encrypted, err := celo.NewEncrypter().EncryptFile(secret, name, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = celo.NewDecrypter().VerifyFile(secret, encrypted); err != nil {
+			t.Errorf("armor %v: %v", armor, err)
+		}
+	}
+}
+
+func TestCheckKeygenFlags(t *testing.T) {
+	t.Cleanup(func() {
+		keygenType, keygenArmor, keygenOutput, fileMode = keygenTypeDefault, keygenArmorDefault, keygenOutputDefault, fileModeDefault
+	})
+
+	keygenType, keygenOutput = "secret", "key"
+	if mode, err := checkKeygenFlags(); err != nil || mode != keygenFileMode {
+		t.Errorf("defaults: got %v, %v", mode, err)
+	}
+	fileMode = "0400"
+	if mode, err := checkKeygenFlags(); err != nil || mode != 0400 {
+		t.Errorf("-mode 0400: got %v, %v", mode, err)
+	}
+	fileMode = "0999"
+	if _, err := checkKeygenFlags(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-mode 0999: got %v, want kind Invalid", err)
+	}
+
+	fileMode, keygenOutput = "0400", ""
+	if _, err := checkKeygenFlags(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-mode without -o: got %v, want kind Invalid", err)
+	}
+
+	fileMode, keygenType, keygenArmor = "", "x25519", true
+	if _, err := checkKeygenFlags(); !errors.Is(errors.Invalid, err) {
+		t.Errorf("-armor with x25519: got %v, want kind Invalid", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+const (
+	listExcludeUsage = "Exclude `file name or glob pattern` from the files scanned. Can be repeated."
+
+	// listTimeLayout layout of the modification times.
+	listTimeLayout = "2006-01-02 15:04"
+)
+
+var (
+	// Exclude file names or glob patterns.
+	listExclude stringList
+)
+
+var listCommand = flag.NewFlagSet("list", flag.ContinueOnError)
+
+func initListFlags() {
+	listCommand.Var(&listExclude, "exclude", listExcludeUsage)
+	listCommand.Var(&include, "include", includeUsage)
+	listCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	listCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	listCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// listedFile a file encrypted by Celo found by list.
+type listedFile struct {
+	name    string
+	size    int64
+	version byte
+	modTime time.Time
+}
+
+// scanSources returns the regular files matching the sources: every file
+// inside a directory, recursively, or the files matching a file name or glob
+// pattern (See matchSources). The hidden files and directories inside a
+// directory are skipped unless -hidden is used.
+func scanSources(src []string, excludes []string) ([]string, error) {
+	var patterns, names []string
+	for _, s := range src {
+		if fi, err := os.Stat(s); err != nil || !fi.IsDir() {
+			patterns = append(patterns, s)
+			continue
+		}
+
+		err := filepath.WalkDir(s, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name != s && !hidden && file.IsHidden(name) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.E(errors.Open, errors.Op("main.scanSources"), errors.Entity(s), err)
+		}
+	}
+
+	names, err := file.Exclude(names, excludes...)
+	if err != nil {
+		return nil, err
+	}
+	if names, err = file.Include(names, include...); err != nil {
+		return nil, err
+	}
+
+	matches, err := matchSources(patterns, excludes)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, matches...), nil
+}
+
+// sniffFile returns the details of the file name if it was encrypted by
+// Celo, identified by its signature rather than its extension (See
+// celo.Sniff). ok is false otherwise.
+func sniffFile(name string) (lf listedFile, ok bool, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return lf, false, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	ok, version, err := celo.Sniff(f)
+	if err != nil || !ok {
+		return lf, false, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return lf, false, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	return listedFile{name, fi.Size(), version, fi.ModTime()}, true, nil
+}
+
+func list(src []string, args []string) (err error) {
+
+	initListFlags()
+	if err = parseFlags(listCommand, args); err != nil {
+		return err
+	}
+	setupColors()
+
+	names, err := scanSources(src, listExclude)
+	if err != nil {
+		return err
+	}
+
+	var files []listedFile
+	var first error
+	failed := 0
+	for _, name := range names {
+		lf, ok, err := sniffFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n  %s\n", name, err)
+			if first == nil {
+				first = err
+			}
+			failed++
+			continue
+		}
+		if ok {
+			files = append(files, lf)
+		}
+	}
+
+	fmt.Fprint(os.Stdout, formatListedFiles(files, len(names)))
+
+	if failed > 0 {
+		// The exit code tells why the first file failed (See exitCode).
+		return errors.E(errorKind(first), errors.Errorf("%d file(s) couldn't be read", failed))
+	}
+
+	return nil
+}
+
+// formatListedFiles a table of the files encrypted by Celo found among the
+// scanned ones.
+func formatListedFiles(files []listedFile, scanned int) string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%d celo file(s) found. (%d scanned)\n", len(files), scanned)
+	if len(files) == 0 {
+		return b.String()
+	}
+
+	fmt.Fprintln(b)
+	// Names are last, so the padding of the other columns isn't thrown off
+	// by their colors.
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "SIZE\tVERSION\tMODIFIED\t  NAME")
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%d\t%s\t  %s\n", formatBytes(f.size), f.version, f.modTime.Format(listTimeLayout), colorFile.paint(f.name))
+	}
+	w.Flush()
+	return b.String()
+}
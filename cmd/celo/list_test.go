@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestScanSources(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.md"} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Directories are scanned recursively.
+	got, err := scanSources([]string{dir}, []string{"*.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("directory: got %v, want %v", got, want)
+	}
+
+	got, err = scanSources([]string{filepath.Join(dir, "sub", "*")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("pattern: got %v, want 2 files", got)
+	}
+
+	if _, err = scanSources([]string{dir}, []string{"[a"}); !errors.Is(errors.Pattern, err) {
+		t.Errorf("malformed exclude: got %v, want kind Pattern", err)
+	}
+}
+
+func TestScanSourcesHidden(t *testing.T) {
+	t.Cleanup(func() { hidden = hiddenDefault })
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", ".env", ".git/config", "sub/.b.txt"} {
+		writeFile(t, filepath.Join(dir, name), "attack at dawn")
+	}
+
+	// Hidden files and directories inside the directories are skipped, not
+	// the directory scanned.
+	got, err := scanSources([]string{dir, filepath.Join(dir, ".git")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, ".git", "config")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	hidden = true
+	if got, err = scanSources([]string{dir}, nil); err != nil || len(got) != 4 {
+		t.Errorf("-hidden: got %q, %v, want 4 files", got, err)
+	}
+}
+
+func TestSniffFile(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(plain, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := celo.NewEncrypter().EncryptFile([]byte("secret"), plain, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files are identified by their content, not their extension.
+	renamed := filepath.Join(dir, "renamed.bin")
+	if err = os.Rename(encrypted, renamed); err != nil {
+		t.Fatal(err)
+	}
+	lf, ok, err := sniffFile(renamed)
+	if err != nil || !ok {
+		t.Fatalf("encrypted file: got %v, %v", ok, err)
+	}
+	if lf.name != renamed || lf.version != 2 || lf.size == 0 || lf.modTime.IsZero() {
+		t.Errorf("encrypted file: got %+v", lf)
+	}
+
+	if _, ok, err = sniffFile(plain); ok || err != nil {
+		t.Errorf("plain file: got %v, %v", ok, err)
+	}
+
+	if _, _, err = sniffFile(filepath.Join(dir, "missing")); exitCode(err) != exitOpen {
+		t.Errorf("missing file: got %v, want exit code %d", err, exitOpen)
+	}
+}
+
+func TestFormatListedFiles(t *testing.T) {
+	if got := formatListedFiles(nil, 3); got != "0 celo file(s) found. (3 scanned)\n" {
+		t.Errorf("no files: got %q", got)
+	}
+
+	modTime := time.Date(2026, 1, 2, 15, 4, 0, 0, time.UTC)
+	got := formatListedFiles([]listedFile{
+		{"a.celo", 207, 2, modTime},
+		{"docs/b.celo", 3 << 20, 1, modTime},
+	}, 5)
+	want := `2 celo file(s) found. (5 scanned)
+
+     SIZE  VERSION          MODIFIED  NAME
+    207 B        2  2026-01-02 15:04  a.celo
+  3.0 MiB        1  2026-01-02 15:04  docs/b.celo
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
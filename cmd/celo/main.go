@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
 	"strings"
+	"time"
 
+	"github.com/rrivera/celo"
 	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
 )
 
 const intro = `
@@ -21,11 +28,101 @@ It can be used to encrypt or decrypt one or multiple files at once.
   encrypt <FILE|PATTERN> [ARG...]
 	Encrypts file(s) using a Secret Phrase. 
 	A phrase will be asked (from Stdin) unless -phrase-env flag is present.
+	With - as FILE, Stdin is encrypted to Stdout and the phrase is asked
+	in the terminal: celo encrypt - < secret.txt > secret.txt.celo
 
   d (shorthand)
   decrypt <FILE|PATTERN> [ARG...]
 	Decrypts file(s) using the exact same Secret Phrase used to encrypt. 
 	A phrase will be asked (from Stdin) unless -phrase-env flag is present.
+	With - as FILE, Stdin is decrypted to Stdout.
+
+  rekey <FILE|PATTERN> [ARG...]
+	Re-encrypts file(s) with a new Secret Phrase.
+	Both phrases will be asked (from Stdin) unless -phrase-env and
+	-new-phrase-env flags are present.
+
+  verify <FILE|PATTERN> [ARG...]
+	Checks that file(s) are intact and can be decrypted with the Secret
+	Phrase, without writing anything to disk.
+	A phrase will be asked (from Stdin) unless -phrase-env flag is present.
+
+  cat <FILE|PATTERN> [ARG...]
+	Decrypts file(s) to Stdout, one after the other, without writing
+	anything to disk: celo cat db.env.celo | docker compose --env-file
+	/dev/stdin up. The phrase is asked in the terminal.
+
+  edit <FILE> [ARG...]
+	Decrypts a file to a temporary file, opens it with $EDITOR and
+	encrypts it again if it was modified. The temporary file is shredded.
+
+  run <PLAN> [ARG...]
+	Runs the steps of a YAML plan file, each an encrypt, decrypt or verify
+	command with its own sources and flags. If a step fails, the files
+	written by the previous ones are removed.
+
+  convert <FILE|PATTERN> [ARG...]
+	Migrates file(s) in an older format to the current one, in place.
+	A phrase will be asked (from Stdin) unless -phrase-env flag is present.
+
+  info <FILE|PATTERN> [ARG...]
+	Prints the details of encrypted file(s), such as the format version,
+	the cipher and the key derivation, without asking for a phrase.
+
+  list <DIR|PATTERN> [ARG...]
+	Lists the files encrypted by celo, identified by their content rather
+	than their extension, with their size, format version and modification
+	time. Directories are scanned recursively. No phrase is required.
+
+  git-filter <clean|smudge> [ARG...] [PATH]
+	Encrypts (clean) or decrypts (smudge) a file from Stdin to Stdout, as
+	a git filter, so files selected in .gitattributes are stored encrypted
+	in the repository and decrypted in the working tree.
+
+  watch <DIR> [ARG...]
+	Encrypts the files of DIR, and of its subdirectories, as they are
+	created or modified, until it is stopped with Ctrl+C. The phrase is
+	asked once.
+
+  passgen [ARG...]
+	Generates a random Secret Phrase of common words, such as
+	"otter-quilt-lemon-pylon-brisk-cedar", and prints its entropy.
+
+  keygen [ARG...]
+	Generates an X25519 identity. Files encrypted for its public key
+	(encrypt -recipient) can be decrypted with it (decrypt -identity).
+
+  agent [ARG...]
+	Keeps the keys derived from the Secret Phrase for a while, and the
+	phrase with -keep-phrase, for commands run with $CELO_AGENT_SOCK set.
+
+  serve [ARG...]
+	Serves an HTTP API on 127.0.0.1:7600 to encrypt, decrypt and inspect
+	the files sent to it, so other programs can use celo without running
+	it. Requests are authenticated with $CELO_SERVE_TOKEN.
+
+  daemon [ARG...]
+	Serves the gRPC service of celo on 127.0.0.1:7700: sessions, and
+	encrypting, decrypting and inspecting the files streamed to it, so
+	long-running services derive the key of a session once. Calls are
+	authenticated with $CELO_DAEMON_TOKEN.
+
+  bench [ARG...]
+	Measures the key derivation time of several argon2id parameters and
+	the throughput of AES-256-GCM and ChaCha20-Poly1305 on this machine,
+	and prints the recommended configuration.
+
+  selftest [ARG...]
+	Runs known-answer tests of the key derivation and the cipher, and
+	decrypts files of every format version, to validate a build or a
+	platform before trusting it with data.
+
+  doctor [DIR...] [ARG...]
+	Checks the environment: a terminal to type the phrase in, the random
+	number generator, that files can be created in DIR (the current
+	directory by default), the configuration file, and the keychain,
+	pinentry and agent when they are used. Problems are reported with
+	what to do about them.
 
   --
 
@@ -39,20 +136,117 @@ It can be used to encrypt or decrypt one or multiple files at once.
 var (
 	// Name of the Environment Variable that contains the phrase
 	phraseEnv string
+	// Name of the file that contains the phrase
+	phraseFile string
 	// Remove input source file after a successful operation.
 	removeSource bool
+	// Overwrite the removed sources with random data first.
+	shredSource bool
+	// Number of times the removed sources are overwritten.
+	shredPasses int
 	// Overwrite the content of an existing file.
 	overwrite bool
+	// Give the outputs the modification time of their sources.
+	preserveTimes bool
+	// Process files without locking them.
+	noLock bool
+	// Permissions of the files created, in octal.
+	fileMode string
+	// What to do when a file created already exists.
+	collision string
+	// Only print errors.
+	quiet bool
+	// Log what is done to each file to Stderr.
+	verbose bool
+	// Log debug information to Stderr as well.
+	debug bool
+	// Name of the file created from a single source.
+	output string
+	// Directory of the files created, the one of their source if empty.
+	outputDir string
+	// Report what would be done without doing it.
+	dryRun bool
+	// Only process files matching these file names or glob patterns.
+	include stringList
+	// Include hidden files and directories in glob matches and walks.
+	hidden bool
+	// Only process files modified in this duration, such as 24h.
+	newerThan string
+	// Only process files modified after this date, such as 2024-01-01.
+	since string
+	// File listing the names of the files to process, - for Stdin.
+	filesFrom string
+	// Number of files processed concurrently, 0 for one per CPU.
+	jobs int
+	// Maximum throughput of reads and writes, such as 10M, unlimited if empty.
+	limitRate string
+	// Parameters of the argon2id key derivation of new phrase stanzas, memory
+	// in MiB.
+	kdfTime, kdfMemory, kdfThreads uint
+	// Minimum strength of new phrases, 0 for any.
+	minStrength int
+	// Ask for typed phrases with pinentry.
+	usePinentry bool
+	// Name of the phrase in the keychain of the OS.
+	keychain string
+	// Number of times a typed phrase is asked, 0 for unlimited. Commands
+	// without -retries use the default.
+	retries = retriesDefault
+)
+
+// Defaults of -kdf-time, -kdf-memory and -kdf-threads, the parameters of
+// celo.DefaultKDFParams.
+var (
+	kdfTimeDefault    = uint(celo.DefaultKDFParams().Time)
+	kdfMemoryDefault  = uint(celo.DefaultKDFParams().Memory / 1024)
+	kdfThreadsDefault = uint(celo.DefaultKDFParams().Threads)
 )
 
 // default error for flags parse error
-var errInvalidFlags = errors.E(errors.Errorf("Invalid Flags"))
+var errInvalidFlags = errors.E(errors.Invalid, errors.Errorf("Invalid Flags"))
+
+// parseFlags parses the flags of the command fs, along with -profile,
+// -cpuprofile and -memprofile, and sets the flags that weren't used to the
+// values of the configuration file. The CPU profile is started, main stops it.
+// It returns flag.ErrHelp if -help is used and errInvalidFlags if a flag is
+// invalid, fs reports it.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if fs.Lookup("profile") == nil {
+		fs.StringVar(&profile, "profile", profileDefault, profileUsage)
+	}
+	if fs.Lookup("cpuprofile") == nil {
+		fs.StringVar(&cpuProfile, "cpuprofile", "", cpuProfileUsage)
+		fs.StringVar(&memProfile, "memprofile", "", memProfileUsage)
+	}
+	err := fs.Parse(args)
+	switch {
+	case err == flag.ErrHelp:
+		return err
+	case err != nil:
+		return errInvalidFlags
+	}
+	if err = applyConfig(fs); err != nil {
+		return err
+	}
+	return startProfiles()
+}
 
 // Flags default and usage values
 const (
 	removeSourceDefault = false
 	removeSourceUsage   = `Remove the source file when the operation finishes successfully.
-	If an error occurs the source won't be removed.`
+	If an error occurs the source won't be removed. With -rm-source=shred, it is overwritten
+	with random data and truncated first, a best effort that file systems which copy on
+	write (btrfs, ZFS, APFS) and SSDs can defeat.`
+
+	shredPassesDefault = 3
+	shredPassesUsage   = "Overwrite the sources removed with -rm-source=shred `N` times."
+
+	preserveTimesDefault = false
+	preserveTimesUsage   = "Give the files created the modification time of their sources, so backup tools and\n\tsync jobs don't see them as modified."
+
+	noLockDefault = false
+	noLockUsage   = "Don't lock the files processed. By default sources are locked, and outputs in use by another\n\tprocess aren't replaced, so concurrent celo processes can't modify or remove them meanwhile.\n\tUseful on file systems where locks hang or always fail."
 
 	overwriteDefault = false
 	overwriteUsage   = "Overwrite existing file if one with the same name exist."
@@ -63,8 +257,340 @@ const (
 	If the value of the variable is empty an error will be thrown.
 	Ex: -phrase-env CELO_PHRASE
 	`
+
+	quietUsage = "Only print errors: the list of matching files and the summaries aren't printed."
+
+	verboseUsage = "Log what is done to each file (written, source removed) to Stderr."
+
+	debugUsage = "Log what is done to each file and debug information, such as the files opened and\n\tthe time spent deriving keys, to Stderr."
+
+	verboseAliasUsage = "Same as -vv."
+
+	collisionDefault = "fail"
+	collisionUsage   = "What to do when the file to create already exists and -ow isn't used: `strategy` fail,\n\toverwrite, rename (add a numeric suffix such as secrets-1.txt) or skip."
+
+	fileModeDefault = ""
+	fileModeUsage   = "Permissions `mode` (octal) of the files created, such as 0640.\n\tEncrypted files are created with 0644 and decrypted files with 0600 by default."
+
+	outputDefault = ""
+	outputUsage   = "Create the output `file` with this exact name instead of deriving it from the source.\n\tRequires a single source file."
+
+	outputDirDefault = ""
+	outputDirUsage   = "Create the output files in `directory` instead of next to their source, which is left in place.\n\tThe directory is created if it doesn't exist."
+
+	includeUsage = "Only process the files that match `file name or glob pattern`, e.g. *.md.\n\tApplied after -exclude. Can be repeated, files matching any pattern are included."
+
+	newerThanDefault = ""
+	newerThanUsage   = "Only process the files modified in the last `duration`, e.g. 24h, 90m or 7d, for incremental\n\truns. Can't be used along with -since."
+
+	sinceDefault = ""
+	sinceUsage   = "Only process the files modified after `date`, e.g. 2024-01-01, \"2024-01-01 08:00\" (local time)\n\tor 2024-01-01T08:00:00Z. Can't be used along with -newer-than."
+
+	hiddenDefault = false
+	hiddenUsage   = "Include hidden files and directories, whose name starts with a dot, in the matches of glob\n\tpatterns and in the directories scanned. They must be matched explicitly otherwise, e.g. .env or .config/*."
+
+	filesFromDefault = ""
+	filesFromUsage   = "Also process the files listed in `file`, one name per line or NUL-delimited (find -print0).\n\tNames aren't glob patterns, -exclude and -include apply. Use - to read the list from Stdin."
+
+	pinentryDefault = false
+	pinentryUsage   = "Ask for the Secret Phrase with pinentry, the dialog of GnuPG, instead of the terminal.\n\tThe program is found in PATH."
+
+	keychainDefault = ""
+	keychainUsage   = "Use the Secret Phrase stored with `name` in the keychain of the OS (macOS Keychain,\n\tWindows Credential Manager or Secret Service). If there isn't one, it is asked\n\twith confirmation and stored."
+
+	minStrengthDefault = 0
+	minStrengthUsage   = "Refuse new phrases weaker than `score`, from 0 (any) to 4 (very hard to guess).\n\tTyped phrases are asked again. Without it, trivially guessable phrases are only warned about."
+
+	retriesDefault = phraseAttempts
+	retriesUsage   = "Ask up to `N` times for a typed phrase that is empty, too weak or doesn't match its\n\tconfirmation, or that is wrong when decrypting a single file. 0 asks until it is right."
+
+	jobsDefault = 1
+	jobsUsage   = "Process up to `N` files concurrently when multiple files are processed.\n\t0 uses as many workers as CPUs."
+
+	limitRateDefault = ""
+	limitRateUsage   = "Limit the throughput of reads and writes combined to `rate` bytes per second, e.g. 512K, 10M or 1G\n\t(binary units), so jobs on network file systems or shared hosts don't saturate them.\n\t0 removes the limit."
+
+	kdfTimeUsage    = "Number of `passes` of the argon2id key derivation of the Secret Phrase. Slower derivations\n\tmake guessing the phrase slower. The parameters are recorded in the encrypted files."
+	kdfMemoryUsage  = "`MiB` of memory used by the argon2id key derivation of the Secret Phrase."
+	kdfThreadsUsage = "Number of `threads` of the argon2id key derivation of the Secret Phrase."
+
+	dryRunDefault = false
+	dryRunUsage   = "Report what would be done with each file (created, overwritten, skipped or removed)\n\twithout modifying any file or asking for the Secret Phrase."
+
+	phraseFileDefault = ""
+	phraseFileUsage   = `Name of the ` + "`file`" + ` containing the Secret Phrase.
+	A single trailing line break is ignored. Can't be used along with "phrase-env".
+	`
 )
 
+// logger returns the logger of the library: at debug level with -vv (or
+// -verbose), at info level with -v, nil otherwise.
+func logger() *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case debug:
+		level = slog.LevelDebug
+	case !verbose:
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// checkVerbosity returns an error of kind errors.Invalid if -q is used along
+// with -v or -vv.
+func checkVerbosity() error {
+	if quiet && (verbose || debug) {
+		return errors.E(errors.Invalid, errors.Errorf("-q can't be used along with -v or -vv"))
+	}
+	return nil
+}
+
+// summaries returns where the list of matching files and the summaries are
+// printed: Stdout, or nowhere with -q.
+func summaries() io.Writer {
+	if quiet {
+		return io.Discard
+	}
+	return os.Stdout
+}
+
+// matchSources returns the files matching the sources, file names or glob
+// patterns, except the ones that match any of excludes. If -include is used,
+// only the files that match one of its patterns are returned. Hidden files
+// are only matched explicitly, unless -hidden is used (See file.ExcludeHidden).
+// With -newer-than or -since, only the files modified after the time they
+// give are returned.
+// Unix systems automatically convert globs in a list of files unless the
+// argument is wrapped in "". However, we still want to exclude by pattern,
+// and verify that only files are listed.
+func matchSources(src []string, excludes []string) ([]string, error) {
+	var matches []string
+
+	after, err := modifiedAfter(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range src {
+		m, err := file.Glob(pattern, excludes...)
+		if err != nil {
+			return nil, err
+		}
+		if !hidden {
+			m = file.ExcludeHidden(pattern, m)
+		}
+		if m, err = file.Include(m, include...); err != nil {
+			return nil, err
+		}
+
+		// concatenate matches
+		matches = append(matches, file.ModifiedAfter(m, after)...)
+	}
+
+	if filesFrom == "" {
+		return matches, nil
+	}
+
+	listed, err := readFileList(filesFrom)
+	if err != nil {
+		return nil, err
+	}
+	if listed, err = file.Exclude(listed, excludes...); err != nil {
+		return nil, err
+	}
+	if listed, err = file.Include(listed, include...); err != nil {
+		return nil, err
+	}
+
+	return append(matches, file.ModifiedAfter(listed, after)...), nil
+}
+
+// readFileList reads the names of the files listed in the file name, or in
+// Stdin if name is - (See parseFileList).
+func readFileList(name string) ([]string, error) {
+	if name == stdioSource {
+		return parseFileList(os.Stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	return parseFileList(f)
+}
+
+// parseFileList parses a list of file names delimited by NUL characters, as
+// find -print0 writes them, or by line breaks if there isn't any. Empty names
+// are ignored.
+func parseFileList(r io.Reader) ([]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Errorf("unable to read the list of files: %v", err))
+	}
+
+	sep := "\n"
+	if bytes.IndexByte(b, 0) >= 0 {
+		sep = "\x00"
+	}
+
+	var names []string
+	for _, name := range strings.Split(string(b), sep) {
+		if sep == "\n" {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// checkOutput returns an error of kind errors.Invalid if -o is used for
+// anything but a single source file, files is the number of source files.
+func checkOutput(files int, stdio bool) error {
+	switch {
+	case output == "":
+		return nil
+	case stdio:
+		return errors.E(errors.Invalid, errors.Errorf("-o can't be used when reading from Stdin, redirect Stdout instead"))
+	case files != 1:
+		return errors.E(errors.Invalid, errors.Errorf("-o requires a single source file"))
+	}
+	return nil
+}
+
+// outputDirOption returns the option that creates the output files in
+// -output-dir, nil if it isn't used.
+// It returns an error of kind errors.Invalid if it is used along with -o or
+// when reading from Stdin, there is a single output.
+func outputDirOption(stdio bool) (celo.Option, error) {
+	switch {
+	case outputDir == "":
+		return nil, nil
+	case output != "":
+		return nil, errors.E(errors.Invalid, errors.Errorf("-output-dir can't be used along with -o"))
+	case stdio:
+		return nil, errors.E(errors.Invalid, errors.Errorf("-output-dir can't be used when reading from Stdin"))
+	}
+	return celo.WithOutputDir(outputDir), nil
+}
+
+// workersOption returns the option that processes -j files concurrently. It
+// returns an error of kind errors.Invalid if -j is negative.
+func workersOption() (celo.Option, error) {
+	switch {
+	case jobs < 0:
+		return nil, errors.E(errors.Invalid, errors.Errorf("-j must be 0 or greater"))
+	case jobs == 0:
+		return celo.WithWorkers(runtime.NumCPU()), nil
+	}
+	return celo.WithWorkers(jobs), nil
+}
+
+// phraseAttempts number of times a typed phrase is asked when it doesn't match
+// its confirmation, or when decrypting a single file with a wrong phrase,
+// unless -retries is used.
+const phraseAttempts = 3
+
+// checkRetries returns an error of kind errors.Invalid if -retries is
+// negative.
+func checkRetries() error {
+	if retries < 0 {
+		return errors.E(errors.Invalid, errors.Errorf("-retries must be 0 or greater"))
+	}
+	return nil
+}
+
+// retryPhrase reports whether a wrong phrase is asked again after attempt
+// attempts (See -retries).
+func retryPhrase(attempt int) bool {
+	return retries == 0 || attempt < retries
+}
+
+// prompt is a PhraseProvider that asks the user for the phrase.
+type prompt interface {
+	celo.PhraseProvider
+	// Interactive reports whether the phrase can be asked again.
+	Interactive() bool
+}
+
+// phraseProvider returns the provider of the Secret Phrase stored in the
+// environment variable env, in the file name or in the keychain with the name
+// -keychain. Otherwise, the phrase is asked in the terminal, or with pinentry
+// if -pinentry is used, printing label first.
+func phraseProvider(env, name string, label string) (celo.PhraseProvider, error) {
+	switch {
+	case env != "" && name != "", keychain != "" && (env != "" || name != ""):
+		return nil, errors.E(errors.Invalid, errors.Errorf("Only one of -phrase-env, -phrase-file and -keychain can be used"))
+	case env != "":
+		return celo.EnvPhrase(env), nil
+	case name != "":
+		return celo.FilePhrase(name), nil
+	case keychain != "":
+		// The phrase is asked as usual the first time.
+		return celo.KeychainPhrase{Name: keychain, Ask: typedPhrase(label)}, nil
+	}
+	return typedPhrase(label), nil
+}
+
+// typedPhrase returns the provider of a phrase asked in the terminal, or with
+// pinentry if -pinentry is used, printing label first.
+func typedPhrase(label string) celo.PhraseProvider {
+	if usePinentry {
+		return celo.PinentryPhrase{Description: label, Retries: uint32(retries)}
+	}
+	// Stdin carries the list of files, the phrase is typed in the terminal.
+	return celo.TerminalPhrase{Label: label, Retries: uint32(retries), TTY: filesFrom == stdioSource}
+}
+
+// checkMinStrength returns -min-strength as a celo.Strength, or an error of
+// kind errors.Invalid if it is out of range.
+func checkMinStrength() (celo.Strength, error) {
+	if minStrength < 0 || minStrength > int(celo.MaxStrength) {
+		return 0, errors.E(errors.Invalid, errors.Errorf("-min-strength must be between 0 and %d, got %d", celo.MaxStrength, minStrength))
+	}
+	return celo.Strength(minStrength), nil
+}
+
+// strongPhrase returns p asking again for typed phrases weaker than min (See
+// celo.TerminalPhrase and celo.PinentryPhrase).
+func strongPhrase(p celo.PhraseProvider, min celo.Strength) celo.PhraseProvider {
+	switch t := p.(type) {
+	case celo.TerminalPhrase:
+		t.MinStrength = min
+		return t
+	case celo.PinentryPhrase:
+		t.MinStrength = min
+		return t
+	case celo.KeychainPhrase:
+		t.Ask = strongPhrase(t.Ask, min)
+		return t
+	case agentPhrase:
+		t.ask = strongPhrase(t.ask, min)
+		return t
+	}
+	return p
+}
+
+// checkPhraseStrength returns an error of kind errors.PhraseIsWeak if the new
+// phrase is weaker than min. Without a minimum, trivially guessable phrases
+// are only warned about on Stderr.
+func checkPhraseStrength(phrase []byte, min celo.Strength) error {
+	if len(phrase) == 0 {
+		// Only public keys are used.
+		return nil
+	}
+	if min > 0 {
+		return celo.CheckStrength(phrase, min)
+	}
+	if !quiet && celo.EstimateStrength(phrase) == celo.StrengthTooGuessable {
+		fmt.Fprintln(os.Stderr, "Warning: the phrase is trivially guessable, see -min-strength.")
+	}
+	return nil
+}
+
 func main() {
 	var err error
 
@@ -78,19 +604,64 @@ func main() {
 	cmd, src, args, err := parseArgs()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 
 	switch cmd {
+	case "bench":
+		err = bench(args)
+	case "cat":
+		err = cat(src, args)
+	case "convert":
+		err = convert(src, args)
 	case "decrypt":
 		err = decrypt(src, args)
+	case "doctor":
+		err = doctor(args)
+	case "edit":
+		err = edit(src, args)
 	case "encrypt":
 		err = encrypt(src, args)
+	case "git-filter":
+		err = gitFilter(args)
+	case "info":
+		err = info(src, args)
+	case "agent":
+		err = agent(args)
+	case "keygen":
+		err = keygen(args)
+	case "list":
+		err = list(src, args)
+	case "passgen":
+		err = passgen(args)
+	case "rekey":
+		err = rekey(src, args)
+	case "run":
+		err = run(src, args)
+	case "selftest":
+		err = selftest(args)
+	case "serve":
+		err = serve(args)
+	case "daemon":
+		err = daemon(args)
+	case "verify":
+		err = verify(src, args)
+	case "watch":
+		err = watch(src, args)
+	}
+
+	// The profiles cover the whole run, failed or not.
+	if perr := stopProfiles(); err == nil {
+		err = perr
 	}
 
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		// The usage and invalid flags were already printed.
+		if err != flag.ErrHelp && err != errInvalidFlags {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		// Scripts can tell failures apart by the exit code (See exitCode).
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -119,7 +690,10 @@ func parseArgs() (cmd string, src []string, args []string, err error) {
 	}
 
 	switch os.Args[1] {
-	case "decrypt":
+	case "agent", "bench", "daemon", "doctor", "git-filter", "keygen", "passgen", "selftest", "serve":
+		// These commands don't take an input source.
+		return os.Args[1], nil, os.Args[2:], nil
+	case "decrypt", "rekey", "verify", "cat", "edit", "run", "convert", "info", "list", "watch":
 		fallthrough
 	case "encrypt":
 
@@ -138,8 +712,9 @@ func parseArgs() (cmd string, src []string, args []string, err error) {
 			return "", nil, nil, err
 		}
 
-		// Make sure that the third parameter is not a flag.
-		if isFlag(os.Args[2]) {
+		// Make sure that the third parameter is not a flag, unless the files
+		// are listed with -files-from.
+		if isFlag(os.Args[2]) && !hasFilesFromFlag(os.Args[2:]) {
 			// If the third argument is a flag, the input source is missing.
 			return "", nil, nil, err
 		}
@@ -161,8 +736,9 @@ func parseArgs() (cmd string, src []string, args []string, err error) {
 			return "", nil, os.Args[1:], nil
 		}
 
-		// The first argument has to be the input source.
-		if isFlag(os.Args[1]) {
+		// The first argument has to be the input source, unless the files
+		// are listed with -files-from.
+		if isFlag(os.Args[1]) && !hasFilesFromFlag(os.Args[1:]) {
 			return "", nil, nil, err
 		}
 
@@ -194,8 +770,21 @@ func extractSources(args []string) (files []string, found int) {
 	return files, found
 }
 
+// isFlag reports whether arg is a flag, - is the Stdin source.
 func isFlag(arg string) bool {
-	return strings.HasPrefix(arg, "-")
+	return arg != stdioSource && strings.HasPrefix(arg, "-")
+}
+
+// hasFilesFromFlag reports whether -files-from is present, the sources can
+// be omitted.
+func hasFilesFromFlag(args []string) bool {
+	for _, a := range args {
+		name := strings.TrimLeft(a, "-")
+		if isFlag(a) && (name == "files-from" || strings.HasPrefix(name, "files-from=")) {
+			return true
+		}
+	}
+	return false
 }
 
 func hasHelpFlag(args []string) bool {
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+const manifestUsage = "Write to `file` a JSON manifest of the files encrypted: the source, the output, the SHA-256\n\tof the plaintext, the size of the encrypted file and when it was encrypted.\n\tWith -resume, the files of the manifest of the interrupted run are kept."
+
+// manifestVersion version of the format of the manifests.
+const manifestVersion = 1
+
+// Name of the manifest written.
+var manifestName string
+
+// manifest records the files encrypted by a command (See -manifest), so the
+// encrypted set can later be checked for completeness and integrity.
+type manifest struct {
+	Version int            `json:"version"`
+	Created time.Time      `json:"created"`
+	Files   []manifestFile `json:"files"`
+
+	name string
+	mu   sync.Mutex
+}
+
+// manifestFile is a file encrypted.
+type manifestFile struct {
+	Source string `json:"source"`
+	Output string `json:"output"`
+	// PlaintextSHA256 hex encoded SHA-256 of the content of Source.
+	PlaintextSHA256 string `json:"plaintext_sha256"`
+	// CiphertextSize size of Output in bytes.
+	CiphertextSize int64     `json:"ciphertext_size"`
+	Encrypted      time.Time `json:"encrypted"`
+}
+
+// newManifest starts the manifest name, nil if -manifest isn't used. With
+// -resume, the files of the manifest written by the interrupted run are kept.
+func newManifest(name string) (*manifest, error) {
+	if name == "" {
+		return nil, nil
+	}
+	m := &manifest{Version: manifestVersion, Created: time.Now().UTC(), Files: []manifestFile{}, name: name}
+	if !resume {
+		return m, nil
+	}
+
+	b, err := os.ReadFile(name)
+	switch {
+	case os.IsNotExist(err):
+		return m, nil
+	case err != nil:
+		return nil, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	var prev manifest
+	if err = json.Unmarshal(b, &prev); err != nil || prev.Version != manifestVersion {
+		return nil, errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("not a manifest of version %d", manifestVersion))
+	}
+	m.Created, m.Files = prev.Created, append(m.Files, prev.Files...)
+	return m, nil
+}
+
+// add records the files of results that were encrypted. It is a no-op on a
+// nil manifest.
+func (m *manifest) add(results ...celo.FileResult) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range results {
+		if r.Err != nil || r.Skipped {
+			continue
+		}
+		m.Files = append(m.Files, manifestFile{
+			Source:          r.Source,
+			Output:          r.Output,
+			PlaintextSHA256: hex.EncodeToString(r.PlaintextSHA256),
+			CiphertextSize:  r.Bytes,
+			Encrypted:       time.Now().UTC(),
+		})
+	}
+}
+
+// write writes the manifest, replacing the file if it exists. It is a no-op
+// on a nil manifest.
+func (m *manifest) write() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.E(errors.Encode, errors.Entity(m.name), err)
+	}
+	return file.WriteAtomic(m.name, true, 0644, func(f *os.File) error {
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			return errors.E(errors.Create, errors.Entity(m.name), err)
+		}
+		return nil
+	})
+}
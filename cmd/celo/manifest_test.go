@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// readManifest reads the manifest name.
+func readManifest(t *testing.T, name string) *manifest {
+	t.Helper()
+	m := new(manifest)
+	if err := json.Unmarshal(readFile(t, name), m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestManifest(t *testing.T) {
+	defer func(r bool) { resume = r }(resume)
+	resume = false
+
+	if m, err := newManifest(""); m != nil || err != nil {
+		t.Fatalf("without -manifest: got %v, %v", m, err)
+	}
+	// A nil manifest is a no-op.
+	var none *manifest
+	none.add(celo.FileResult{Source: "a"})
+	if err := none.write(); err != nil {
+		t.Errorf("nil manifest: %v", err)
+	}
+
+	dir := t.TempDir()
+	var sources []string
+	for _, n := range []string{"a", "b"} {
+		name := filepath.Join(dir, n)
+		writeFile(t, name, "attack at dawn "+n)
+		sources = append(sources, name)
+	}
+
+	name := filepath.Join(dir, "manifest.json")
+	m, err := newManifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := celo.NewEncrypter()
+	if err = e.Config(celo.DigestPlaintext(true)); err != nil {
+		t.Fatal(err)
+	}
+	results := e.EncryptFiles([]byte("secret"), append(sources, filepath.Join(dir, "missing")), false, false)
+	m.add(results...)
+	if err = m.write(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readManifest(t, name)
+	if got.Version != manifestVersion || len(got.Files) != 2 {
+		t.Fatalf("got version %d, %d files, want version %d, 2 files", got.Version, len(got.Files), manifestVersion)
+	}
+	for i, f := range got.Files {
+		sum := sha256.Sum256([]byte("attack at dawn " + filepath.Base(sources[i])))
+		fi, err := os.Stat(f.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Source != sources[i] || f.Output != sources[i]+".celo" || f.PlaintextSHA256 != hex.EncodeToString(sum[:]) || f.CiphertextSize != fi.Size() || f.Encrypted.IsZero() {
+			t.Errorf("got %+v", f)
+		}
+	}
+
+	// A resumed run keeps the files of the manifest.
+	resume = true
+	if m, err = newManifest(name); err != nil {
+		t.Fatal(err)
+	}
+	m.add(celo.FileResult{Source: "c", Output: "c.celo", PlaintextSHA256: []byte{1}})
+	if err = m.write(); err != nil {
+		t.Fatal(err)
+	}
+	if got = readManifest(t, name); len(got.Files) != 3 || got.Files[2].Source != "c" {
+		t.Errorf("got files %+v, want the 2 files and c", got.Files)
+	}
+
+	writeFile(t, name, `{"version": 99}`)
+	if _, err = newManifest(name); !errors.Is(errors.Invalid, err) {
+		t.Errorf("unknown version: got error %v, want kind Invalid", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+// lockMemory does nothing, the OS doesn't support locking memory.
+func lockMemory(b []byte) {}
+
+// unlockMemory does nothing, the OS doesn't support locking memory.
+func unlockMemory(b []byte) {}
@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+// lockMemory keeps the memory of b from being swapped to disk. It is best
+// effort: the limit of locked memory of the user might be reached.
+func lockMemory(b []byte) {
+	if len(b) > 0 {
+		syscall.Mlock(b)
+	}
+}
+
+// unlockMemory undoes lockMemory.
+func unlockMemory(b []byte) {
+	if len(b) > 0 {
+		syscall.Munlock(b)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+)
+
+const (
+	passgenWordsDefault = 6
+	passgenWordsUsage   = "Number of `words` of the phrase. Each one adds about 10.3 bits of entropy."
+
+	passgenSeparatorDefault = "-"
+	passgenSeparatorUsage   = "`separator` between the words of the phrase."
+)
+
+var (
+	// Number of words of the generated phrase.
+	passgenWords int
+	// Separator between the words.
+	passgenSeparator string
+)
+
+// wordlist of short, common English words the phrases are made of, one per
+// line. Its 1296 words are as many as the combinations of four dice, as in
+// Diceware.
+//
+//go:embed wordlist.txt
+var wordlist string
+
+// words of the wordlist.
+var words = strings.Fields(wordlist)
+
+var passgenCommand = flag.NewFlagSet("passgen", flag.ContinueOnError)
+
+func initPassgenFlags() {
+	passgenCommand.IntVar(&passgenWords, "words", passgenWordsDefault, passgenWordsUsage)
+	passgenCommand.StringVar(&passgenSeparator, "sep", passgenSeparatorDefault, passgenSeparatorUsage)
+}
+
+// generatePhrase returns a phrase of n words picked at random from the
+// wordlist, joined by sep.
+func generatePhrase(n int, sep string) (string, error) {
+	if n < 1 {
+		return "", errors.E(errors.Invalid, errors.Errorf("-words must be at least 1, got %d", n))
+	}
+
+	max := big.NewInt(int64(len(words)))
+	picked := make([]string, n)
+	for i := range picked {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.E(errors.Other, errors.Op("main.generatePhrase"), err)
+		}
+		picked[i] = words[j.Int64()]
+	}
+	return strings.Join(picked, sep), nil
+}
+
+// phraseEntropy bits of entropy of a phrase of n words picked at random from
+// the wordlist.
+func phraseEntropy(n int) float64 {
+	return float64(n) * math.Log2(float64(len(words)))
+}
+
+func passgen(args []string) (err error) {
+
+	initPassgenFlags()
+	if err = parseFlags(passgenCommand, args); err != nil {
+		return err
+	}
+
+	phrase, err := generatePhrase(passgenWords, passgenSeparator)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, phrase)
+	// Stdout only has the phrase, so it can be redirected to a file.
+	fmt.Fprintf(os.Stderr, "Entropy: %.1f bits (%d words from a list of %d)\n", phraseEntropy(passgenWords), passgenWords, len(words))
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestWordlist(t *testing.T) {
+	if len(words) != 1296 {
+		t.Errorf("got %d words, want 1296", len(words))
+	}
+
+	seen := map[string]bool{}
+	for _, w := range words {
+		if seen[w] {
+			t.Errorf("duplicated word %q", w)
+		}
+		seen[w] = true
+		if strings.Trim(w, "abcdefghijklmnopqrstuvwxyz") != "" {
+			t.Errorf("word %q isn't lowercase ASCII", w)
+		}
+	}
+}
+
+func TestGeneratePhrase(t *testing.T) {
+	phrase, err := generatePhrase(6, "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	picked := strings.Split(phrase, "-")
+	if len(picked) != 6 {
+		t.Fatalf("got %q, want 6 words", phrase)
+	}
+	for _, w := range picked {
+		if !strings.Contains("\n"+wordlist, "\n"+w+"\n") {
+			t.Errorf("word %q isn't in the wordlist", w)
+		}
+	}
+
+	if other, _ := generatePhrase(6, "-"); other == phrase {
+		t.Errorf("the same phrase %q was generated twice", phrase)
+	}
+	if phrase, _ = generatePhrase(3, " "); len(strings.Fields(phrase)) != 3 {
+		t.Errorf("separator: got %q", phrase)
+	}
+
+	for _, n := range []int{0, -1} {
+		if _, err = generatePhrase(n, "-"); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%d words: got %v, want kind Invalid", n, err)
+		}
+	}
+}
+
+func TestPhraseEntropy(t *testing.T) {
+	if got := phraseEntropy(6); math.Abs(got-62.04) > 0.01 {
+		t.Errorf("6 words: got %.2f bits, want 62.04", got)
+	}
+	if got := phraseEntropy(0); got != 0 {
+		t.Errorf("0 words: got %.2f bits", got)
+	}
+}
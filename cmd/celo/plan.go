@@ -0,0 +1,331 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// planCommand command a plan can run: its flag set, replaced before each
+// step so its flags are defined again with their defaults, the function that
+// defines them and the function that runs it.
+type planCommand struct {
+	flags **flag.FlagSet
+	init  func()
+	run   func(src []string, args []string) error
+}
+
+// planCommands commands a plan can run. Their -json report tells what each
+// step wrote, so it can be rolled back.
+var planCommands = map[string]planCommand{
+	"encrypt": {&encryptCommand, initEncryptFlags, encrypt},
+	"decrypt": {&decryptCommand, initDecryptFlags, decrypt},
+	"verify":  {&verifyCommand, initVerifyFlags, verify},
+}
+
+// planForbidden flags a step can't use: what they do couldn't be rolled back,
+// or they would change how the step is run.
+var planForbidden = map[string]string{
+	"ow":        "existing files can't be restored",
+	"rm-source": "removed sources can't be restored",
+	"resume":    "steps can't be resumed",
+	"dry-run":   "plans can't be dry run",
+	"json":      "the report of each step is part of the report of the plan",
+	"manifest":  "an existing manifest would be replaced and can't be restored",
+}
+
+// planStep operation of a plan: a command, its sources and the values of its
+// flags, as in the configuration file.
+type planStep struct {
+	// where the step is defined, such as plan.yaml:3.
+	where   string
+	command string
+	sources []string
+	flags   configTable
+	// args of the command, set by checkPlanStep.
+	args []string
+}
+
+func (s *planStep) String() string {
+	return fmt.Sprintf("%s %s", s.command, strings.Join(s.sources, " "))
+}
+
+// readPlan reads the plan file name (See parsePlan).
+func readPlan(name string) ([]*planStep, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	return parsePlan(name, f)
+}
+
+// parsePlan parses the plan file name read from r, a YAML document with a
+// list of steps:
+//
+//	# release.yaml
+//	- command: encrypt
+//	  sources: ["dist/*.tar.gz", "dist/*.zip"]
+//	  output-dir: release
+//	  pad: padme
+//	- command: verify
+//	  sources:
+//	    - release/*.celo
+//
+// Besides command and sources, the keys of each step are the flags of the
+// command or their aliases (See configAliases), with the values they would be
+// given. Any YAML can be used, with anchors, aliases and merge keys, as long
+// as each step is a mapping whose values are scalars or lists of them.
+// It returns an error of kind errors.Invalid if the plan is malformed.
+func parsePlan(name string, r io.Reader) ([]*planStep, error) {
+	invalid := func(line int, format string, args ...interface{}) error {
+		return errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("line %d: "+format, append([]interface{}{line}, args...)...))
+	}
+
+	var doc yaml.Node
+	dec := yaml.NewDecoder(r)
+	switch err := dec.Decode(&doc); {
+	case err == io.EOF:
+		return nil, errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("the plan has no steps"))
+	case err != nil:
+		return nil, errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("%s", strings.TrimPrefix(err.Error(), "yaml: ")))
+	}
+	var next yaml.Node
+	if err := dec.Decode(&next); err != io.EOF {
+		return nil, invalid(next.Line, "the plan must be a single YAML document")
+	}
+
+	list := planNode(doc.Content[0])
+	if list.Kind != yaml.SequenceNode {
+		return nil, invalid(list.Line, "expected a list of steps, got %s", planKind(list))
+	}
+	if len(list.Content) == 0 {
+		return nil, errors.E(errors.Invalid, errors.Entity(name), errors.Errorf("the plan has no steps"))
+	}
+
+	steps := make([]*planStep, 0, len(list.Content))
+	for _, item := range list.Content {
+		item = planNode(item)
+		if item.Kind != yaml.MappingNode {
+			return nil, invalid(item.Line, "expected a step, a mapping of keys to values, got %s", planKind(item))
+		}
+		step := &planStep{where: fmt.Sprintf("%s:%d", name, item.Line), flags: configTable{}}
+
+		pairs, err := planPairs(item)
+		if err != nil {
+			return nil, errors.E(errors.Invalid, errors.Entity(name), err)
+		}
+		for _, kv := range pairs {
+			k, v := kv[0], kv[1]
+			if k.Kind != yaml.ScalarNode || k.Tag != "!!str" {
+				return nil, invalid(k.Line, "expected a flag name as key, got %s", planKind(k))
+			}
+			key := strings.ReplaceAll(k.Value, "_", "-")
+			if !isConfigKey(key) {
+				return nil, invalid(k.Line, "expected a flag name as key, got %q", k.Value)
+			}
+			if alias, ok := configAliases[key]; ok {
+				key = alias
+			}
+			if _, ok := step.flags[key]; ok {
+				return nil, invalid(k.Line, "%s defined twice", key)
+			}
+
+			values, err := planValues(v)
+			if err != nil {
+				return nil, invalid(v.Line, "%s: %v", key, err)
+			}
+			step.flags[key] = configValue{values: values, source: fmt.Sprintf("%s:%d", name, k.Line)}
+		}
+
+		command := step.flags["command"]
+		if len(command.values) != 1 {
+			return nil, errors.E(errors.Invalid, errors.Entity(step.where), errors.Errorf("the step requires a single command"))
+		}
+		step.command = command.values[0]
+		step.sources = step.flags["sources"].values
+		delete(step.flags, "command")
+		delete(step.flags, "sources")
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// planNode returns the node n refers to if it is an alias, or n itself.
+func planNode(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// planPairs returns the keys and values of the mapping n, along with the
+// ones of the mappings merged with << that n doesn't define.
+func planPairs(n *yaml.Node) ([][2]*yaml.Node, error) {
+	var pairs, merged [][2]*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := planNode(n.Content[i]), planNode(n.Content[i+1])
+		if k.Tag != "!!merge" {
+			pairs = append(pairs, [2]*yaml.Node{k, v})
+			continue
+		}
+
+		sources := []*yaml.Node{v}
+		if v.Kind == yaml.SequenceNode {
+			sources = v.Content
+		}
+		for _, m := range sources {
+			m = planNode(m)
+			if m.Kind != yaml.MappingNode {
+				return nil, errors.Errorf("line %d: only mappings can be merged, got %s", m.Line, planKind(m))
+			}
+			p, err := planPairs(m)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, p...)
+		}
+	}
+
+	defined := map[string]bool{}
+	for _, kv := range pairs {
+		defined[kv[0].Value] = true
+	}
+	for _, kv := range merged {
+		if !defined[kv[0].Value] {
+			defined[kv[0].Value] = true
+			pairs = append(pairs, kv)
+		}
+	}
+	return pairs, nil
+}
+
+// planValues returns the values of a flag given by n, a scalar or a list of
+// them, as given to the flag.
+func planValues(n *yaml.Node) ([]string, error) {
+	if n.Kind != yaml.SequenceNode {
+		v, err := planScalar(n)
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+
+	values := []string{}
+	for _, item := range n.Content {
+		v, err := planScalar(planNode(item))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// planScalar returns the value of the scalar n as given to a flag.
+func planScalar(n *yaml.Node) (string, error) {
+	switch {
+	case n.Kind != yaml.ScalarNode:
+		return "", errors.Errorf("expected a value or a list of values, got %s", planKind(n))
+	case n.Tag == "!!null":
+		return "", errors.Errorf("missing value")
+	case n.Tag == "!!binary" || !strings.HasPrefix(n.Tag, "!!"):
+		return "", errors.Errorf("unsupported tag %s", n.Tag)
+	}
+	return n.Value, nil
+}
+
+// planKind describes the kind of the node n in error messages.
+func planKind(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return "nothing"
+		}
+		return fmt.Sprintf("%q", n.Value)
+	}
+	return "a YAML document"
+}
+
+// checkPlanStep checks the step before anything is run: its command can be
+// part of a plan, its flags are valid and nothing it does is irreversible. It sets the args of the step: its flags, the ones that
+// protect existing files and -json.
+// It returns an error of kind errors.Invalid if the step can't be run.
+func checkPlanStep(step *planStep) error {
+	invalid := func(format string, args ...interface{}) error {
+		return errors.E(errors.Invalid, errors.Entity(step.where), errors.Errorf(format, args...))
+	}
+
+	c, ok := planCommands[step.command]
+	if !ok {
+		return invalid("plans can't run %s, only encrypt, decrypt and verify", step.command)
+	}
+
+	if len(step.sources) == 0 {
+		return invalid("the step has no sources")
+	}
+	for _, src := range step.sources {
+		// Sources might be written by the previous steps, they are matched
+		// when the step runs.
+		if src == stdioSource {
+			return invalid("sources can't be read from Stdin")
+		}
+	}
+
+	*c.flags = flag.NewFlagSet(step.command, flag.ContinueOnError)
+	c.init()
+	fs := *c.flags
+
+	keys := make([]string, 0, len(step.flags))
+	for k := range step.flags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, k := range keys {
+		v := step.flags[k]
+		if reason, ok := planForbidden[k]; ok {
+			return invalid("%s can't be used in a plan, %s", k, reason)
+		}
+		if fs.Lookup(k) == nil {
+			return invalid("%s has no flag -%s", step.command, k)
+		}
+		if k == "on-collision" && len(v.values) == 1 && v.values[0] == "overwrite" {
+			return invalid("on-collision can't be overwrite in a plan, existing files can't be restored")
+		}
+		if k == "o" && len(v.values) == 1 && isRemote(v.values[0]) {
+			return invalid("o can't be a URL in a plan, remote objects can't be removed by the roll back")
+		}
+		for _, s := range v.values {
+			args = append(args, "-"+k+"="+s)
+		}
+	}
+	// The configuration file can't make a step overwrite or remove files.
+	for _, pinned := range []string{"-ow=false", "-rm-source=false", "-on-collision=fail"} {
+		k, _, _ := strings.Cut(pinned[1:], "=")
+		if _, set := step.flags[k]; !set && fs.Lookup(k) != nil {
+			args = append(args, pinned)
+		}
+	}
+	args = append(args, "-json")
+
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return invalid("%v", err)
+	}
+
+	step.args = args
+	return nil
+}
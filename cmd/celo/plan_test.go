@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+const testPlan = `
+# release.yaml
+- command: encrypt
+  sources: ["dist/*.tar.gz", 'dist/*.zip']
+  output_dir: release # release/
+  pad: padme
+  workers: 2
+- command: verify
+  sources:
+    - release/*.celo
+    - "release/notes.txt.celo"
+-
+  command: decrypt
+  sources: [release/a.celo]
+`
+
+func TestParsePlan(t *testing.T) {
+	steps, err := parsePlan("release.yaml", strings.NewReader(testPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps", len(steps))
+	}
+
+	s := steps[0]
+	if s.where != "release.yaml:3" || s.command != "encrypt" || !reflect.DeepEqual(s.sources, []string{"dist/*.tar.gz", "dist/*.zip"}) {
+		t.Errorf("got %s %s %v", s.where, s.command, s.sources)
+	}
+	want := map[string][]string{"output-dir": {"release"}, "pad": {"padme"}, "j": {"2"}}
+	if len(s.flags) != len(want) {
+		t.Errorf("got flags %v", s.flags)
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(s.flags[k].values, v) {
+			t.Errorf("%s: got %v, want %v", k, s.flags[k].values, v)
+		}
+	}
+
+	if got := steps[1].sources; !reflect.DeepEqual(got, []string{"release/*.celo", "release/notes.txt.celo"}) {
+		t.Errorf("got sources %v", got)
+	}
+	if steps[2].command != "decrypt" || len(steps[2].sources) != 1 {
+		t.Errorf("got %s %v", steps[2].command, steps[2].sources)
+	}
+}
+
+func TestParsePlanYAML(t *testing.T) {
+	// Anchors, aliases, merge keys and multi-line strings are YAML too.
+	plan := `
+defaults: &defaults
+  phrase-env: RELEASE_PHRASE
+  pad: padme
+steps:
+`
+	if _, err := parsePlan("plan.yaml", strings.NewReader(plan)); !errors.Is(errors.Invalid, err) {
+		t.Errorf("mapping at the top: got %v, want kind Invalid", err)
+	}
+
+	plan = `
+- &encrypt
+  command: encrypt
+  sources: &dist [dist/*.zip]
+  phrase_env: RELEASE_PHRASE
+- <<: *encrypt
+  pad: padme
+  aad: >-
+    release
+    notes
+- {command: verify, sources: *dist}
+`
+	steps, err := parsePlan("plan.yaml", strings.NewReader(plan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps", len(steps))
+	}
+	s := steps[1]
+	if s.where != "plan.yaml:6" || s.command != "encrypt" || !reflect.DeepEqual(s.sources, []string{"dist/*.zip"}) {
+		t.Errorf("got %s %s %v", s.where, s.command, s.sources)
+	}
+	want := map[string][]string{"phrase-env": {"RELEASE_PHRASE"}, "pad": {"padme"}, "aad": {"release notes"}}
+	if len(s.flags) != len(want) {
+		t.Errorf("got flags %v", s.flags)
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(s.flags[k].values, v) {
+			t.Errorf("%s: got %v, want %v", k, s.flags[k].values, v)
+		}
+	}
+	if steps[2].command != "verify" || !reflect.DeepEqual(steps[2].sources, []string{"dist/*.zip"}) {
+		t.Errorf("got %s %v", steps[2].command, steps[2].sources)
+	}
+}
+
+func TestParsePlanErrors(t *testing.T) {
+	// Error messages expected, "" for the ones of the YAML parser.
+	for plan, want := range map[string]string{
+		"":                                      "no steps",
+		"[]":                                    "no steps",
+		"command: encrypt\n":                    "expected a list of steps",
+		"- command: encrypt\n   sources: [a]\n": "",
+		"- command: encrypt\n\tsources: [a]\n":  "",
+		"- sources: [a]\n":                      "single command",
+		"- command: encrypt\n  command: decrypt\n":     "defined twice",
+		"- command: encrypt\n  sources: [a, b\n":       "",
+		"- command: encrypt\n  sources: \"a\n":         "",
+		"- command encrypt\n":                          "expected a step",
+		"- command: encrypt\n  sources: [[a]]\n":       "line 2: sources: expected a value",
+		"- command: encrypt\n  pad: {a: b}\n":          "line 2: pad: expected a value",
+		"- command: encrypt\n  pad:\n":                 "line 2: pad: missing value",
+		"- command: encrypt\n  pad: !!binary YQ==\n":   "unsupported tag",
+		"- command: encrypt\n  [a]: b\n":               "expected a flag name",
+		"- command: encrypt\n  <<: [a]\n":              "only mappings can be merged",
+		"- command: encrypt\n---\n- command: verify\n": "single YAML document",
+	} {
+		_, err := parsePlan("plan.yaml", strings.NewReader(plan))
+		if !errors.Is(errors.Invalid, err) || !strings.Contains(fmt.Sprint(err), want) {
+			t.Errorf("%q: got error %v, want kind Invalid with %q", plan, err, want)
+		}
+	}
+}
+
+func TestCheckPlanStep(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	src := []string{filepath.Join(dir, "*.txt")}
+
+	step := &planStep{where: "plan.yaml:1", command: "encrypt", sources: src, flags: configTable{"pad": {values: []string{"padme"}}}}
+	if err := checkPlanStep(step); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-pad=padme", "-ow=false", "-rm-source=false", "-on-collision=fail", "-json"}
+	if !reflect.DeepEqual(step.args, want) {
+		t.Errorf("got args %q, want %q", step.args, want)
+	}
+
+	for _, step := range []*planStep{
+		{command: "rekey", sources: src},
+		{command: "encrypt"},
+		{command: "encrypt", sources: []string{"-"}},
+		{command: "encrypt", sources: src, flags: configTable{"ow": {values: []string{"true"}}}},
+		{command: "encrypt", sources: src, flags: configTable{"rm-source": {values: []string{"shred"}}}},
+		{command: "encrypt", sources: src, flags: configTable{"on-collision": {values: []string{"overwrite"}}}},
+		{command: "encrypt", sources: src, flags: configTable{"manifest": {values: []string{"m.json"}}}},
+		{command: "encrypt", sources: src, flags: configTable{"o": {values: []string{"s3://backups/a.txt.celo"}}}},
+		{command: "encrypt", sources: src, flags: configTable{"no-such-flag": {values: []string{"1"}}}},
+		{command: "encrypt", sources: src, flags: configTable{"j": {values: []string{"many"}}}},
+	} {
+		if err := checkPlanStep(step); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%s %v: got error %v, want kind Invalid", step, step.flags, err)
+		}
+	}
+}
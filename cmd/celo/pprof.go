@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/rrivera/celo/errors"
+)
+
+const (
+	cpuProfileUsage = "Write a pprof CPU profile of the run to `file`, to report performance problems.\n\tInspect it with go tool pprof."
+	memProfileUsage = "Write a pprof heap profile to `file` when the run finishes, to report memory problems.\n\tInspect it with go tool pprof."
+)
+
+var (
+	// File where the CPU profile is written.
+	cpuProfile string
+	// File where the heap profile is written.
+	memProfile string
+	// cpuProfileFile open CPU profile, nil if it isn't being written.
+	cpuProfileFile *os.File
+)
+
+// startProfiles starts writing the CPU profile to -cpuprofile, if it is used.
+func startProfiles() error {
+	if cpuProfile == "" || cpuProfileFile != nil {
+		return nil
+	}
+
+	f, err := os.Create(cpuProfile)
+	if err != nil {
+		return errors.E(errors.Create, errors.Entity(cpuProfile), err)
+	}
+	if err = pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return errors.E(errors.Other, errors.Entity(cpuProfile), err)
+	}
+	cpuProfileFile = f
+	return nil
+}
+
+// stopProfiles stops the CPU profile started by startProfiles and writes the
+// heap profile to -memprofile, if it is used.
+func stopProfiles() error {
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		err := cpuProfileFile.Close()
+		cpuProfileFile = nil
+		if err != nil {
+			return errors.E(errors.Create, errors.Entity(cpuProfile), err)
+		}
+	}
+
+	if memProfile == "" {
+		return nil
+	}
+
+	f, err := os.Create(memProfile)
+	if err != nil {
+		return errors.E(errors.Create, errors.Entity(memProfile), err)
+	}
+	defer f.Close()
+
+	// Only memory still in use is of interest, collect the rest first.
+	runtime.GC()
+	if err = pprof.WriteHeapProfile(f); err != nil {
+		return errors.E(errors.Create, errors.Entity(memProfile), err)
+	}
+	return f.Close()
+}
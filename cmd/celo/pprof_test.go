@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	cpu, mem := filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+	t.Setenv(configEnv, filepath.Join(dir, "none.toml"))
+	t.Cleanup(func() { cpuProfile, memProfile = "", "" })
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := parseFlags(fs, []string{"-cpuprofile", cpu, "-memprofile", mem}); err != nil {
+		t.Fatal(err)
+	}
+	if cpuProfileFile == nil {
+		t.Fatal("the CPU profile wasn't started")
+	}
+	if err := stopProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	if cpuProfileFile != nil {
+		t.Error("the CPU profile wasn't stopped")
+	}
+
+	for _, name := range []string{cpu, mem} {
+		if fi, err := os.Stat(name); err != nil || fi.Size() == 0 {
+			t.Errorf("%s: profile not written (%v)", name, err)
+		}
+	}
+}
+
+func TestProfilesUnused(t *testing.T) {
+	if err := startProfiles(); err != nil || cpuProfileFile != nil {
+		t.Errorf("got %v, a CPU profile was started without -cpuprofile", err)
+	}
+	if err := stopProfiles(); err != nil {
+		t.Error(err)
+	}
+}
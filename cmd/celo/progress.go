@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rrivera/celo"
+	"golang.org/x/term"
+)
+
+const (
+	progressUsage = "Show the progress of each file: bytes processed, throughput, ETA and file name.\n\tA progress bar is drawn on terminals (Stderr), a line is logged every few seconds otherwise."
+
+	// progressRefresh minimum time between two renders of the progress bar.
+	progressRefresh = 100 * time.Millisecond
+	// progressLogInterval time between two progress lines when Stderr isn't a
+	// terminal.
+	progressLogInterval = 5 * time.Second
+	// progressBarWidth number of cells of the bar.
+	progressBarWidth = 10
+)
+
+// Show the progress of the files processed.
+var showProgress bool
+
+// progress renders the progress reported by the library (See
+// celo.ProgressFunc): a progress bar on terminals, periodic lines otherwise.
+// It is safe for concurrent use, batches can process files concurrently.
+type progress struct {
+	mu  sync.Mutex
+	w   io.Writer
+	tty bool
+	// width of the terminal, lines are truncated to it.
+	width int
+	now   func() time.Time
+
+	// last time the progress was rendered.
+	last time.Time
+	// files being read or written. The source and the destination of a file
+	// are reported alternately.
+	entities map[string]*entityProgress
+	// files processed out of the files of the batch, if it is a batch.
+	files, batch int64
+	// drawn whether the bar is on screen.
+	drawn bool
+}
+
+// entityProgress is the progress of a file being read or written.
+type entityProgress struct {
+	start       time.Time
+	done, total int64
+	// logged whether a line was logged for the file.
+	logged bool
+}
+
+// configurer is implemented by celo.Encrypter and celo.Decrypter.
+type configurer interface {
+	Config(opts ...celo.Option) error
+}
+
+// startProgress reports the progress of c to Stderr if -progress is used,
+// otherwise it returns nil. Close must be called before writing to the
+// terminal.
+func startProgress(c configurer) (*progress, error) {
+	if !showProgress {
+		return nil, nil
+	}
+	p := newProgress()
+	if err := c.Config(celo.SetProgress(p.report)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newProgress creates a progress that renders to Stderr.
+func newProgress() *progress {
+	p := &progress{w: os.Stderr, width: 80, now: time.Now, entities: make(map[string]*entityProgress)}
+	if fd := int(os.Stderr.Fd()); term.IsTerminal(fd) {
+		p.tty = true
+		if w, _, err := term.GetSize(fd); err == nil && w > 0 {
+			p.width = w
+		}
+	}
+	return p
+}
+
+// report is the celo.ProgressFunc of p.
+func (p *progress) report(entity string, done, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entity == "" {
+		// A file of the batch finished.
+		p.files, p.batch = done, total
+		return
+	}
+
+	now := p.now()
+	e, ok := p.entities[entity]
+	if !ok || done < e.done {
+		// A new file, or another pass over the same file.
+		e = &entityProgress{start: now}
+		p.entities[entity] = e
+	}
+	e.done, e.total = done, total
+
+	if total > 0 && done >= total {
+		delete(p.entities, entity)
+		if p.tty {
+			// Summaries follow a finished file, don't leave the bar behind.
+			p.clear()
+		} else if e.logged {
+			p.render(entity, e, now)
+		}
+		return
+	}
+
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressRefresh
+	}
+	if now.Sub(p.last) < interval {
+		return
+	}
+	p.last = now
+	p.render(entity, e, now)
+}
+
+// render writes the progress of entity. The caller must hold p.mu.
+func (p *progress) render(entity string, e *entityProgress, now time.Time) {
+	e.logged = true
+
+	var rate float64
+	if elapsed := now.Sub(e.start).Seconds(); elapsed > 0 {
+		rate = float64(e.done) / elapsed
+	}
+
+	// Sizes of streams aren't known.
+	size, pct, eta := "?", "  ?%", "-"
+	if e.total > 0 {
+		size, pct = formatBytes(e.total), fmt.Sprintf("%3d%%", percent(e.done, e.total))
+		if rate > 0 {
+			eta = time.Duration(float64(e.total-e.done) / rate * float64(time.Second)).Round(time.Second).String()
+		}
+	}
+
+	stats := fmt.Sprintf("%s/%s %s/s ETA %s", formatBytes(e.done), size, formatBytes(int64(rate)), eta)
+	if p.batch > 0 {
+		stats = fmt.Sprintf("[%d/%d] %s", p.files, p.batch, stats)
+	}
+
+	if !p.tty {
+		fmt.Fprintf(p.w, "%s: %s %s\n", entity, strings.TrimSpace(pct), stats)
+		return
+	}
+
+	var filled int
+	if e.total > 0 {
+		filled = int(percent(e.done, e.total)) * progressBarWidth / 100
+	}
+	bar := "[" + strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled) + "]"
+	line := fmt.Sprintf("%s %s %s ", bar, pct, stats)
+
+	// Keep the end of the file name if the line doesn't fit in the terminal.
+	name, room := []rune(entity), p.width-1-len(line)
+	if len(name) > room {
+		if room > 3 {
+			name = append([]rune("..."), name[len(name)-room+3:]...)
+		} else {
+			name = nil
+		}
+	}
+	line += string(name)
+	if r := []rune(line); len(r) > p.width-1 {
+		line = string(r[:p.width-1])
+	}
+
+	// Clear the previous line before drawing.
+	fmt.Fprint(p.w, "\r\x1b[2K"+line)
+	p.drawn = true
+}
+
+// clear erases the progress bar. The caller must hold p.mu.
+func (p *progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\x1b[2K")
+		p.drawn = false
+	}
+}
+
+// Close erases the progress bar, so the output that follows isn't written over
+// it. It is a no-op on a nil progress.
+func (p *progress) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+}
+
+// percent returns done out of total as a percentage, at most 100.
+func percent(done, total int64) int64 {
+	if total <= 0 || done >= total {
+		return 100
+	}
+	return done * 100 / total
+}
+
+// formatBytes formats n bytes with binary units, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
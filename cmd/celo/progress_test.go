@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+)
+
+// fakeProgress returns a progress writing to a buffer, with a clock advanced
+// by tick.
+func fakeProgress(tty bool) (p *progress, out *bytes.Buffer, tick func(time.Duration)) {
+	out = new(bytes.Buffer)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p = &progress{w: out, tty: tty, width: 80, now: func() time.Time { return now }, entities: make(map[string]*entityProgress)}
+	return p, out, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestProgressTerminal(t *testing.T) {
+	p, out, tick := fakeProgress(true)
+
+	p.report("big.bin", 0, 4<<20)
+	tick(time.Second)
+	p.report("big.bin", 1<<20, 4<<20)
+	line := out.String()
+	for _, want := range []string{"\r", "[==        ]  25%", "1.0 MiB/4.0 MiB", "1.0 MiB/s", "ETA 3s", "big.bin"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("bar %q doesn't contain %q", line, want)
+		}
+	}
+
+	// Reports within the refresh interval aren't rendered.
+	out.Reset()
+	p.report("big.bin", 2<<20, 4<<20)
+	if out.Len() != 0 {
+		t.Errorf("rendered before the refresh interval: %q", out.String())
+	}
+
+	// A finished file clears the bar.
+	p.report("big.bin", 4<<20, 4<<20)
+	if got := out.String(); got != "\r\x1b[2K" {
+		t.Errorf("finished file: got %q", got)
+	}
+	out.Reset()
+	p.Close()
+	if out.Len() != 0 {
+		t.Errorf("Close after clear: got %q", out.String())
+	}
+
+	// Batches show the files processed. The throughput is measured per file,
+	// the source and the destination are reported alternately.
+	p.report("", 1, 2)
+	p.report("small.bin", 0, 2<<20)
+	p.report("small.bin.celo", 0, 4<<20)
+	tick(time.Second)
+	p.report("small.bin", 1<<20, 2<<20)
+	p.report("small.bin.celo", 2<<20, 4<<20)
+	out.Reset()
+	tick(time.Second)
+	p.report("small.bin", 3<<19, 2<<20)
+	for _, want := range []string{"[1/2]", " 75%", "768.0 KiB/s", "small.bin"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("batch bar %q doesn't contain %q", out.String(), want)
+		}
+	}
+
+	out.Reset()
+	p.Close()
+	if got := out.String(); got != "\r\x1b[2K" {
+		t.Errorf("Close: got %q", got)
+	}
+}
+
+func TestProgressTruncate(t *testing.T) {
+	p, out, tick := fakeProgress(true)
+	p.width = 40
+
+	tick(time.Second)
+	p.report(strings.Repeat("x", 100)+"end", 1, 2)
+	if got := strings.TrimPrefix(out.String(), "\r\x1b[2K"); len(got) > 39 {
+		t.Errorf("got a line of %d characters, want at most 39: %q", len(got), got)
+	}
+
+	p.width = 80
+	out.Reset()
+	tick(time.Second)
+	p.report(strings.Repeat("x", 100)+"end", 1, 2)
+	got := strings.TrimPrefix(out.String(), "\r\x1b[2K")
+	if len(got) != 79 || !strings.HasSuffix(got, "xx"+"end") || !strings.Contains(got, "...x") {
+		t.Errorf("the end of the file name isn't kept: %q", got)
+	}
+}
+
+func TestProgressLog(t *testing.T) {
+	p, out, tick := fakeProgress(false)
+
+	p.report("big.bin", 0, 4<<20)
+	p.report("small.bin", 0, 1<<10)
+	tick(time.Second)
+	p.report("big.bin", 1<<20, 4<<20)
+	// Files finished before being logged aren't logged.
+	p.report("small.bin", 1<<10, 1<<10)
+	tick(time.Second)
+	p.report("big.bin", 2<<20, 4<<20)
+	tick(progressLogInterval)
+	p.report("big.bin", 3<<20, 4<<20)
+	p.report("big.bin", 4<<20, 4<<20)
+	p.Close()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), out.String())
+	}
+	if want := "big.bin: 0% 0 B/4.0 MiB 0 B/s ETA -"; lines[0] != want {
+		t.Errorf("got %q, want %q", lines[0], want)
+	}
+	if want := "big.bin: 75% 3.0 MiB/4.0 MiB 438.9 KiB/s ETA 2s"; lines[1] != want {
+		t.Errorf("got %q, want %q", lines[1], want)
+	}
+	if !strings.HasPrefix(lines[2], "big.bin: 100% 4.0 MiB/4.0 MiB") {
+		t.Errorf("finished file: got %q", lines[2])
+	}
+	if strings.Contains(out.String(), "\r") {
+		t.Errorf("terminal control characters in the log: %q", out.String())
+	}
+}
+
+func TestProgressUnknownSize(t *testing.T) {
+	p, out, tick := fakeProgress(false)
+
+	p.report("Stdin", 256, 0)
+	out.Reset()
+	tick(progressLogInterval)
+	p.report("Stdin", 5<<10+256, 0)
+	if want := "Stdin: ?% 5.2 KiB/? 1.0 KiB/s ETA -\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestStartProgress(t *testing.T) {
+	t.Cleanup(func() { showProgress = false })
+
+	e := celo.NewEncrypter()
+	defer e.Wipe()
+	if p, err := startProgress(e); p != nil || err != nil {
+		t.Fatalf("without -progress: got %v, %v", p, err)
+	}
+	// Close is safe without -progress.
+	var p *progress
+	p.Close()
+
+	showProgress = true
+	p, err := startProgress(e)
+	if err != nil || p == nil {
+		t.Fatalf("got %v, %v", p, err)
+	}
+
+	var buf bytes.Buffer
+	p.w, p.tty = &buf, false
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.EncryptFile([]byte("secret"), name, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), name+"."+celo.Extension+": 100%") {
+		t.Errorf("progress of the encryption not reported: %q", buf.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1024:          "1.0 KiB",
+		1536:          "1.5 KiB",
+		5 << 20:       "5.0 MiB",
+		3 << 30:       "3.0 GiB",
+		1<<40 + 1<<39: "1.5 TiB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
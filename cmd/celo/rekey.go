@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/messages"
+)
+
+const (
+	rekeyExcludeUsage = "Exclude `file name or glob pattern` from rekeying.\n\tUseful when a glob is used as the source selector. Can be repeated."
+
+	newPhraseEnvDefault = ""
+	newPhraseEnvUsage   = "Name of the `environment variable` containing the new Secret Phrase.\n\tIf the value of the variable is empty an error will be thrown."
+
+	rekeySignKeyUsage = "Sign the rekeyed files with the Ed25519 key of `file`.\n\tRequired to rekey signed files, the signature doesn't survive the new phrase."
+
+	newPhraseFileDefault = ""
+	newPhraseFileUsage   = "Name of the `file` containing the new Secret Phrase.\n\tCan't be used along with \"new-phrase-env\"."
+)
+
+var (
+	// Exclude file names or glob patterns.
+	rekeyExclude stringList
+	// Name of the Environment Variable that contains the new phrase.
+	newPhraseEnv string
+	// Name of the file that contains the new phrase.
+	newPhraseFile string
+)
+
+var rekeyCommand = flag.NewFlagSet("rekey", flag.ContinueOnError)
+
+func initRekeyFlags() {
+	rekeyCommand.Var(&rekeyExclude, "exclude", rekeyExcludeUsage)
+	rekeyCommand.Var(&include, "include", includeUsage)
+	rekeyCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	rekeyCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	rekeyCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	rekeyCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	rekeyCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	rekeyCommand.StringVar(&newPhraseEnv, "new-phrase-env", newPhraseEnvDefault, newPhraseEnvUsage)
+	rekeyCommand.StringVar(&newPhraseFile, "new-phrase-file", newPhraseFileDefault, newPhraseFileUsage)
+	rekeyCommand.IntVar(&minStrength, "min-strength", minStrengthDefault, minStrengthUsage)
+	rekeyCommand.StringVar(&signKey, "sign-key", "", rekeySignKeyUsage)
+	rekeyCommand.BoolVar(&jsonOutput, "json", false, jsonUsage)
+	rekeyCommand.BoolVar(&quiet, "q", false, quietUsage)
+	rekeyCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	rekeyCommand.BoolVar(&debug, "vv", false, debugUsage)
+	rekeyCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+	rekeyCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// rekeyResults returns the result of each file of names, rekeyed lists the
+// files rekeyed and errs has an error for each of the others, in order (See
+// celo.RekeyMultipleFiles). The time spent on each file isn't known.
+func rekeyResults(names, rekeyed []string, errs []error) []celo.FileResult {
+	results := make([]celo.FileResult, len(names))
+	for i, name := range names {
+		results[i].Source = name
+		if len(rekeyed) > 0 && rekeyed[0] == name {
+			results[i].Output, rekeyed = name, rekeyed[1:]
+			if fi, err := os.Stat(name); err == nil {
+				results[i].Bytes = fi.Size()
+			}
+		} else if len(errs) > 0 {
+			results[i].Err, errs = errs[0], errs[1:]
+		}
+	}
+	return results
+}
+
+func rekey(src []string, args []string) (err error) {
+
+	initRekeyFlags()
+	if err = parseFlags(rekeyCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	min, err := checkMinStrength()
+	if err != nil {
+		return err
+	}
+	setupColors()
+
+	matches, err := matchSources(src, rekeyExclude)
+	if err != nil {
+		return err
+	}
+
+	// Print to Stdout the final list of files that are going to be rekeyed.
+	if !jsonOutput {
+		fmt.Fprintln(summaries(), formatGlobMatches(matches))
+	}
+
+	if len(matches) == 0 {
+		return newJSONReport("rekey").print(os.Stdout)
+	}
+
+	oldPhrase, err := phraseProvider(phraseEnv, phraseFile, messages.PhraseCurrent.String())
+	if err != nil {
+		return err
+	}
+	oldSecret, err := oldPhrase.Phrase(false)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(oldSecret)
+
+	newPhrase, err := phraseProvider(newPhraseEnv, newPhraseFile, messages.PhraseNew.String())
+	if err != nil {
+		return err
+	}
+	newSecret, err := strongPhrase(newPhrase, min).Phrase(true)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(newSecret)
+	if err = checkPhraseStrength(newSecret, min); err != nil {
+		return err
+	}
+
+	// The old phrase is never kept by the agent, it is about to be replaced.
+	opts := []celo.Option{celo.WithLogger(logger()), agentOption()}
+	if signKey != "" {
+		k, err := readSigningKey(signKey)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, celo.SignWith(k))
+	}
+
+	// With -json, the report replaces the summaries, even if the operation
+	// fails.
+	rep := newJSONReport("rekey")
+	defer func() {
+		if perr := rep.print(os.Stdout); err == nil {
+			err = perr
+		}
+	}()
+
+	if len(matches) == 1 {
+		// Error handling is stricter when rekeying a single file.
+		r := fileResult(matches[0], func() (string, error) {
+			return matches[0], celo.RekeyFile(oldSecret, newSecret, matches[0], opts...)
+		})
+		rep.add(r)
+		if r.Err != nil {
+			return r.Err
+		}
+
+		if rep == nil {
+			fmt.Fprintf(summaries(), formatRekeyedFiles(matches, nil))
+		}
+		return nil
+	}
+
+	rekeyed, errs := celo.RekeyMultipleFiles(oldSecret, newSecret, matches, opts...)
+	if rep != nil {
+		rep.add(rekeyResults(matches, rekeyed, errs)...)
+		return nil
+	}
+	fmt.Fprintf(summaries(), formatRekeyedFiles(rekeyed, errs))
+	return nil
+}
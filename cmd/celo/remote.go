@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+	"github.com/rrivera/celo/remote"
+)
+
+// isRemote reports whether name is the URL of a remote: sources and outputs
+// whose name starts with a scheme registered in the package remote, followed
+// by ://, are read and written by its Remote instead of the file system.
+func isRemote(name string) bool {
+	_, _, ok := remote.Parse(name)
+	return ok
+}
+
+// hasRemote reports whether any of the sources is the URL of a remote.
+func hasRemote(src []string) bool {
+	for _, s := range src {
+		if isRemote(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRemote returns an error of kind errors.Invalid if a URL of a remote is
+// used with the sources src or as -o with anything but a single source file,
+// or along with any of the flags used, by their name, or if -o is the URL of
+// a remote that can't be written.
+func checkRemote(src []string, used map[string]bool) error {
+	if !hasRemote(src) && !isRemote(output) {
+		return nil
+	}
+	if len(src) != 1 || isStdio(src) {
+		return errors.E(errors.Invalid, errors.Errorf("URLs require a single source file, got %v", src))
+	}
+	if u, r, ok := remote.Parse(output); ok {
+		if _, ok := r.(*remote.HTTP); ok {
+			return errors.E(errors.Invalid, errors.Errorf("%s URLs can only be read, -o can't be one", u.Scheme))
+		}
+	}
+	var names []string
+	for name, ok := range used {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return errors.E(errors.Invalid, errors.Errorf("%s can't be used along with URLs", strings.Join(names, ", ")))
+	}
+	return nil
+}
+
+// remoteFileMode returns the permissions of the files written by
+// transferRemote: -mode if it is used, perm otherwise.
+func remoteFileMode(perm os.FileMode) (os.FileMode, error) {
+	if fileMode == "" {
+		return perm, nil
+	}
+	return parseFileMode(fileMode)
+}
+
+// remoteOutput returns the output of the source name: -o if it is used, or
+// the output name derives from the last element of the path of the URL name.
+func remoteOutput(name string, outputName func(string) string) string {
+	if output != "" {
+		return output
+	}
+	if u, _, ok := remote.Parse(name); ok {
+		return outputName(path.Base(u.Path))
+	}
+	return outputName(name)
+}
+
+// transferRemote reads the source name, a file or the URL of a remote,
+// processes its content with process and writes the result to out, a file
+// or the URL of a remote, created with perm. The result is streamed, it isn't
+// kept in memory: it is written to a temporary file that replaces out, or to
+// the remote, as it is processed. Nothing is written unless process succeeds,
+// even if it fails after writing part of the result.
+// If out exists, overwrite has to be true.
+func transferRemote(ctx context.Context, name, out string, overwrite bool, perm os.FileMode, process func(r io.Reader, w io.Writer) error) error {
+	op := errors.Op("main.transferRemote")
+
+	if err := checkRemoteOutput(ctx, out, overwrite); err != nil {
+		return err
+	}
+
+	var src io.ReadCloser
+	if u, r, ok := remote.Parse(name); ok {
+		rc, err := r.Open(ctx, u)
+		if err != nil {
+			return errors.E(op, errors.Entity(name), err)
+		}
+		src = rc
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return errors.E(errors.Open, op, errors.Entity(name), err)
+		}
+		src = f
+	}
+	defer src.Close()
+
+	u, r, ok := remote.Parse(out)
+	if !ok {
+		var perr error
+		err := file.WriteAtomic(out, overwrite, perm, func(f *os.File) error {
+			perr = process(src, f)
+			return perr
+		})
+		switch {
+		case perr != nil:
+			return errors.E(op, errors.Entity(name), perr)
+		case err != nil:
+			return errors.E(op, errors.Entity(out), err)
+		}
+		return nil
+	}
+
+	// The remote reads the result as it is processed, a failure of process
+	// is the error it reads, so it doesn't write anything.
+	pr, pw := io.Pipe()
+	processed := make(chan error, 1)
+	go func() {
+		err := process(src, pw)
+		processed <- err
+		pw.CloseWithError(err)
+	}()
+	err := r.Create(ctx, u, pr, perm)
+	select {
+	case perr := <-processed:
+		if perr != nil {
+			return errors.E(op, errors.Entity(name), perr)
+		}
+	default:
+		// The remote failed before reading everything, process is stopped.
+		pr.Close()
+		<-processed
+		if err == nil {
+			err = errors.E(errors.Create, errors.Errorf("the remote didn't read the whole content"))
+		}
+	}
+	if err != nil {
+		return errors.E(op, errors.Entity(out), err)
+	}
+	return nil
+}
+
+// checkRemoteOutput returns an error of kind errors.Exist if out is the URL
+// of an object that exists and overwrite is false. Files are checked when
+// they are written.
+func checkRemoteOutput(ctx context.Context, out string, overwrite bool) error {
+	u, r, ok := remote.Parse(out)
+	if !ok || overwrite {
+		return nil
+	}
+	exists, err := r.Exists(ctx, u)
+	if err != nil {
+		return errors.E(errors.Entity(out), err)
+	}
+	if exists {
+		return errors.E(errors.Exist, errors.Entity(out), errors.Errorf("the object already exists, use -ow to replace it"))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/remote"
+)
+
+// memRemote keeps its objects in memory, by their URL.
+type memRemote struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	perms   map[string]os.FileMode
+	// read is closed once Create read anything, if it isn't nil.
+	read chan struct{}
+	// fail makes Create fail once it read anything.
+	fail bool
+}
+
+func (m *memRemote) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[u.String()]
+	if !ok {
+		return nil, errors.E(errors.NotExist)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memRemote) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[u.String()]
+	return ok, nil
+}
+
+func (m *memRemote) Create(ctx context.Context, u *url.URL, r io.Reader, perm os.FileMode) error {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return errors.E(errors.Create, err)
+	}
+	if m.read != nil {
+		close(m.read)
+	}
+	if m.fail {
+		return errors.E(errors.Create, errors.Errorf("the storage is full"))
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return errors.E(errors.Create, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[u.String()] = append(b, rest...)
+	m.perms[u.String()] = perm
+	return nil
+}
+
+func TestCheckRemote(t *testing.T) {
+	defer func(o string) { output = o }(output)
+
+	for _, tc := range []struct {
+		src    []string
+		output string
+		used   map[string]bool
+		ok     bool
+	}{
+		{[]string{"a.txt", "b.txt"}, "", nil, true},
+		{[]string{"s3://backups/a.txt"}, "", map[string]bool{"-rm-source": false}, true},
+		{[]string{"a.txt"}, "s3://backups/a.txt.celo", nil, true},
+		{[]string{"s3://backups/a.txt", "b.txt"}, "", nil, false},
+		{[]string{"-"}, "s3://backups/a.txt.celo", nil, false},
+		{[]string{"s3://backups/a.txt"}, "", map[string]bool{"-rm-source": true}, false},
+		{[]string{"https://example.com/a.txt.celo"}, "a.txt", nil, true},
+		{[]string{"a.txt"}, "https://example.com/a.txt.celo", nil, false},
+	} {
+		output = tc.output
+		err := checkRemote(tc.src, tc.used)
+		if (err == nil) != tc.ok || (err != nil && !errors.Is(errors.Invalid, err)) {
+			t.Errorf("%v -o %q %v: got %v, want ok %v", tc.src, tc.output, tc.used, err, tc.ok)
+		}
+	}
+}
+
+func TestRemoteOutput(t *testing.T) {
+	defer func(o string) { output = o }(output)
+	ext := func(name string) string { return name + ".celo" }
+
+	output = ""
+	if got := remoteOutput("s3://backups/2024/report.pdf", ext); got != "report.pdf.celo" {
+		t.Errorf("got %s", got)
+	}
+	if got := remoteOutput("report.pdf", ext); got != "report.pdf.celo" {
+		t.Errorf("got %s", got)
+	}
+	output = "s3://backups/r.celo"
+	if got := remoteOutput("report.pdf", ext); got != output {
+		t.Errorf("got %s, want -o", got)
+	}
+
+	for name, ok := range map[string]bool{"s3://backups/a": true, "ssh://me@host/a": true, "https://example.com/a": true, "s3:a": false, "gs://backups/a": false, "a.txt": false, "s3://": false} {
+		if isRemote(name) != ok {
+			t.Errorf("isRemote(%s) = %v", name, !ok)
+		}
+	}
+}
+
+func TestTransferRemote(t *testing.T) {
+	m := &memRemote{objects: map[string][]byte{}, perms: map[string]os.FileMode{}}
+	remote.Register("mem", m)
+	defer remote.Register("mem", nil)
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "report.pdf")
+	writeFile(t, name, "the report")
+	secret := []byte("secret")
+	ctx := context.Background()
+
+	encrypt := func(r io.Reader, w io.Writer) error {
+		_, err := celo.NewEncrypter().EncryptStream(secret, r, w)
+		return err
+	}
+	decrypt := func(r io.Reader, w io.Writer) error {
+		_, err := celo.NewDecrypter().DecryptStream(secret, r, w)
+		return err
+	}
+
+	obj := "mem://backups/report.pdf.celo"
+	if err := transferRemote(ctx, name, obj, false, 0640, encrypt); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := celo.DecryptBytes(secret, m.objects[obj]); err != nil || string(got) != "the report" {
+		t.Errorf("object decrypts to %q, %v", got, err)
+	}
+	if m.perms[obj] != 0640 {
+		t.Errorf("got permissions %v, want 0640", m.perms[obj])
+	}
+
+	// Objects aren't replaced without -ow.
+	if err := transferRemote(ctx, name, obj, false, 0600, encrypt); !errors.Is(errors.Exist, err) {
+		t.Errorf("existing object: got %v, want kind Exist", err)
+	}
+
+	out := filepath.Join(dir, "copy.pdf")
+	if err := transferRemote(ctx, obj, out, false, 0600, decrypt); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readFile(t, out)); got != "the report" {
+		t.Errorf("got %q", got)
+	}
+	if err := transferRemote(ctx, "mem://backups/missing.celo", filepath.Join(dir, "missing"), false, 0600, decrypt); !errors.Is(errors.NotExist, err) {
+		t.Errorf("missing object: got %v, want kind NotExist", err)
+	}
+
+	// The result is read by the remote as it is processed.
+	m.read = make(chan struct{})
+	err := transferRemote(ctx, name, "mem://backups/streamed", false, 0600, func(r io.Reader, w io.Writer) error {
+		if _, err := io.WriteString(w, "first part"); err != nil {
+			return err
+		}
+		select {
+		case <-m.read:
+		case <-time.After(10 * time.Second):
+			return errors.Errorf("the remote didn't read the first part")
+		}
+		_, err := io.WriteString(w, ", second part")
+		return err
+	})
+	if err != nil || string(m.objects["mem://backups/streamed"]) != "first part, second part" {
+		t.Errorf("got %q, %v", m.objects["mem://backups/streamed"], err)
+	}
+	m.read = nil
+
+	// Nothing is written if the process fails, its error is returned.
+	wrong := func(r io.Reader, w io.Writer) error {
+		_, err := celo.NewDecrypter().DecryptStream([]byte("wrong"), r, w)
+		return err
+	}
+	if err := transferRemote(ctx, obj, "mem://backups/copy.pdf", false, 0600, wrong); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got %v, want kind WrongPassphrase", err)
+	}
+	if _, ok := m.objects["mem://backups/copy.pdf"]; ok {
+		t.Error("the object was written by a failed process")
+	}
+	// Nor if it fails once part of the content was decrypted.
+	big := filepath.Join(dir, "big.bin")
+	writeFile(t, big, strings.Repeat("the report ", 20000))
+	if err := transferRemote(ctx, big, "mem://backups/big.celo", false, 0600, encrypt); err != nil {
+		t.Fatal(err)
+	}
+	blob := m.objects["mem://backups/big.celo"]
+	blob[len(blob)-celo.TrailerSize-1] ^= 1
+	if err := transferRemote(ctx, "mem://backups/big.celo", "mem://backups/big.bin", false, 0600, decrypt); !errors.Is(errors.Ciphertext, err) {
+		t.Errorf("damaged object: got %v, want kind Ciphertext", err)
+	}
+	if _, ok := m.objects["mem://backups/big.bin"]; ok {
+		t.Error("the object was written by a failed process")
+	}
+
+	if err := transferRemote(ctx, obj, out, true, 0600, wrong); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got %v, want kind WrongPassphrase", err)
+	}
+	if got := string(readFile(t, out)); got != "the report" {
+		t.Errorf("the output was modified by a failed process: %q", got)
+	}
+
+	// The process is stopped if the remote fails.
+	m.fail = true
+	if err := transferRemote(ctx, name, "mem://backups/full", false, 0600, encrypt); !errors.Is(errors.Create, err) {
+		t.Errorf("full storage: got %v, want kind Create", err)
+	}
+}
+
+func TestTransferRemoteHTTP(t *testing.T) {
+	secret := []byte("secret")
+	content := bytes.Repeat([]byte("the report "), 20000)
+	blob, err := celo.EncryptBytes(secret, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := append([]byte(nil), blob...)
+	damaged[len(damaged)-celo.TrailerSize-1] ^= 1
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := blob
+		if r.URL.Path == "/damaged.celo" {
+			b = damaged
+		}
+		http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader(b))
+	}))
+	defer srv.Close()
+
+	decrypt := func(r io.Reader, w io.Writer) error {
+		_, err := celo.NewDecrypter().DecryptStream(secret, r, w)
+		return err
+	}
+
+	// The download is decrypted one chunk at a time.
+	dir := t.TempDir()
+	out := filepath.Join(dir, "report.pdf")
+	if err = transferRemote(context.Background(), srv.URL+"/report.pdf.celo", out, false, 0600, decrypt); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, out); !bytes.Equal(got, content) {
+		t.Errorf("got %d bytes, want %d", len(got), len(content))
+	}
+
+	// Nothing is written if the end of the download fails authentication.
+	out = filepath.Join(dir, "damaged.pdf")
+	if err = transferRemote(context.Background(), srv.URL+"/damaged.celo", out, false, 0600, decrypt); !errors.Is(errors.Ciphertext, err) {
+		t.Errorf("damaged file: got %v, want kind Ciphertext", err)
+	}
+	if _, err = os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("the output of a damaged file was written: %v", err)
+	}
+}
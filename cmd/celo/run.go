@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Statuses of the steps of a plan.
+const (
+	stepOK         = "OK"
+	stepFailed     = "FAILED"
+	stepRolledBack = "ROLLED BACK"
+	stepNotRun     = "NOT RUN"
+)
+
+var runCommand = flag.NewFlagSet("run", flag.ContinueOnError)
+
+func initRunFlags() {
+	runCommand.BoolVar(&jsonOutput, "json", false, jsonUsage)
+	runCommand.BoolVar(&quiet, "q", false, quietUsage)
+	runCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// stepResult result of a step of a plan: its status, why it failed and the
+// report of the files it processed.
+type stepResult struct {
+	step   *planStep
+	status string
+	err    error
+	report *jsonReport
+}
+
+// runStep runs the command of the step, which was checked by checkPlanStep,
+// and returns the report of the files it processed. A step fails if any of
+// its files does, or if none matches its sources.
+func runStep(step *planStep) (rep *jsonReport, err error) {
+	reportSink = func(r *jsonReport) { rep = r }
+	defer func() { reportSink = nil }()
+
+	c := planCommands[step.command]
+	*c.flags = flag.NewFlagSet(step.command, flag.ContinueOnError)
+	err = c.run(step.sources, step.args)
+
+	if err == nil && (rep == nil || len(rep.Files) == 0) {
+		return rep, errors.E(errors.NotExist, errors.Errorf("no files match %s", strings.Join(step.sources, " ")))
+	}
+	if err == nil && rep.Failed > 0 {
+		for _, f := range rep.Files {
+			if f.Status == statusFailed {
+				err = errors.E(errors.Kind(f.KindCode), errors.Errorf("%d file(s) failed, the first one %s: %s", rep.Failed, f.Source, f.Error))
+				break
+			}
+		}
+	}
+	return rep, err
+}
+
+// rollBack removes the outputs written by the steps, the last one first. The
+// steps that were rolled back are marked as such. It returns the errors of
+// the outputs that couldn't be removed.
+func rollBack(results []*stepResult) []error {
+	var errs []error
+	for i := len(results) - 1; i >= 0; i-- {
+		r := results[i]
+		if r.report == nil {
+			continue
+		}
+		for j := len(r.report.Files) - 1; j >= 0; j-- {
+			f := r.report.Files[j]
+			if f.Status != statusOK || f.Output == "" {
+				continue
+			}
+			// Steps can't write remote objects (See checkPlanStep), they
+			// aren't paths.
+			if isRemote(f.Output) {
+				errs = append(errs, errors.E(errors.Invalid, errors.Entity(f.Output), errors.Errorf("remote objects can't be removed")))
+				continue
+			}
+			// Outputs didn't exist before the plan, steps can't overwrite
+			// files. Archives are extracted into directories.
+			if err := os.RemoveAll(f.Output); err != nil {
+				errs = append(errs, errors.E(errors.Create, errors.Entity(f.Output), err))
+			}
+		}
+		if r.status == stepOK {
+			r.status = stepRolledBack
+		}
+	}
+	return errs
+}
+
+// runPlan checks every step of the plan and runs them in order. If a step
+// fails, the ones after it aren't run and what the previous ones wrote is
+// removed. It returns the result of each step and the errors of the roll
+// back.
+func runPlan(steps []*planStep) ([]*stepResult, []error, error) {
+	for _, step := range steps {
+		if err := checkPlanStep(step); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	results := make([]*stepResult, len(steps))
+	for i, step := range steps {
+		results[i] = &stepResult{step: step, status: stepNotRun}
+	}
+
+	for _, r := range results {
+		r.report, r.err = runStep(r.step)
+		if r.err == nil {
+			r.status = stepOK
+			continue
+		}
+		r.status = stepFailed
+		return results, rollBack(results), nil
+	}
+	return results, nil, nil
+}
+
+// jsonPlan is the report of a plan printed with -json.
+type jsonPlan struct {
+	Command    string     `json:"command"`
+	Plan       string     `json:"plan"`
+	Steps      []jsonStep `json:"steps"`
+	RolledBack bool       `json:"rolled_back"`
+	// NotRemoved outputs that couldn't be removed by the roll back.
+	NotRemoved []string `json:"not_removed,omitempty"`
+	// Duration of the whole plan in milliseconds.
+	Duration float64 `json:"duration_ms"`
+}
+
+// jsonStep is the result of a step of a plan.
+type jsonStep struct {
+	Command string     `json:"command"`
+	Sources []string   `json:"sources"`
+	Where   string     `json:"where"`
+	Status  string     `json:"status"`
+	Error   string     `json:"error,omitempty"`
+	Files   []jsonFile `json:"files"`
+}
+
+// printPlanJSON writes the report of the plan name as JSON to w.
+func printPlanJSON(w io.Writer, name string, results []*stepResult, rolledBack bool, rollbackErrs []error, start time.Time) error {
+	p := jsonPlan{Command: "run", Plan: name, Steps: []jsonStep{}, RolledBack: rolledBack, Duration: milliseconds(time.Since(start))}
+	for _, err := range rollbackErrs {
+		p.NotRemoved = append(p.NotRemoved, err.Error())
+	}
+	for _, r := range results {
+		s := jsonStep{Command: r.step.command, Sources: r.step.sources, Where: r.step.where, Status: strings.ToLower(strings.ReplaceAll(r.status, " ", "_")), Files: []jsonFile{}}
+		if r.err != nil {
+			s.Error = r.err.Error()
+		}
+		if r.report != nil {
+			s.Files = r.report.Files
+		}
+		p.Steps = append(p.Steps, s)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return errors.E(errors.Encode, errors.Errorf("unable to write the JSON report: %v", err))
+	}
+	return nil
+}
+
+// formatPlan summary of the steps of the plan name, and the outputs that
+// couldn't be removed when it was rolled back.
+func formatPlan(name string, results []*stepResult, rollbackErrs []error) string {
+	colors := map[string]color{stepOK: colorOK, stepFailed: colorFailed, stepRolledBack: colorSkipped, stepNotRun: colorSkipped}
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.status]++
+	}
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%s: %d step(s). (%d done, %d failed, %d rolled back, %d not run)\n\n", name, len(results),
+		counts[stepOK], counts[stepFailed], counts[stepRolledBack], counts[stepNotRun])
+
+	for i, r := range results {
+		fmt.Fprintf(b, "  %d. %s %s", i+1, colors[r.status].paint(fmt.Sprintf("%-12s", r.status)), colorFile.paint(r.step.String()))
+		switch {
+		case r.err != nil:
+			fmt.Fprintf(b, ": %v\n", r.err)
+		case r.report != nil:
+			fmt.Fprintf(b, " (%d file(s))\n", r.report.Processed)
+		default:
+			fmt.Fprintln(b)
+		}
+	}
+
+	if len(rollbackErrs) > 0 {
+		fmt.Fprintln(b)
+	}
+	for _, err := range rollbackErrs {
+		fmt.Fprintf(b, "%s %v\n", colorFailed.paint("Not removed:"), err)
+	}
+	return b.String()
+}
+
+func run(src []string, args []string) (err error) {
+
+	initRunFlags()
+	if err = parseFlags(runCommand, args); err != nil {
+		return err
+	}
+	setupColors()
+
+	if len(src) != 1 {
+		return errors.E(errors.Invalid, errors.Errorf("run requires a single plan file"))
+	}
+	name := src[0]
+
+	steps, err := readPlan(name)
+	if err != nil {
+		return err
+	}
+
+	// The steps define the flags of their commands again, the ones of run
+	// are restored once they finish.
+	planJSON, planQuiet, planNoColor, planMemProfile := jsonOutput, quiet, noColor, memProfile
+	start := time.Now()
+	results, rollbackErrs, err := runPlan(steps)
+	jsonOutput, quiet, noColor, memProfile = planJSON, planQuiet, planNoColor, planMemProfile
+	setupColors()
+	if err != nil {
+		return err
+	}
+
+	var failed *stepResult
+	for _, r := range results {
+		if r.status == stepFailed {
+			failed = r
+		}
+	}
+
+	if jsonOutput {
+		if err = printPlanJSON(os.Stdout, name, results, failed != nil, rollbackErrs, start); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(summaries(), formatPlan(name, results, rollbackErrs))
+	}
+
+	if failed != nil {
+		// The exit code tells why the step failed (See exitCode).
+		return errors.E(errorKind(failed.err), errors.Errorf("%s failed, the plan was rolled back", failed.step.where))
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestRunPlan(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(configEnv, filepath.Join(dir, "config.toml"))
+	t.Setenv("PLAN_PHRASE", "plan phrase")
+	t.Cleanup(func() { jsonOutput, quiet = false, false })
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// c.txt.celo was encrypted with another phrase.
+	other, err := celo.EncryptBytes([]byte("other phrase"), []byte("c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "c.txt.celo"), other, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	step := func(command string, sources ...string) *planStep {
+		for i, s := range sources {
+			sources[i] = filepath.Join(dir, s)
+		}
+		return &planStep{where: "plan.yaml:1", command: command, sources: sources, flags: configTable{"phrase-env": {values: []string{"PLAN_PHRASE"}}}}
+	}
+
+	results, errs, err := runPlan([]*planStep{step("encrypt", "a.txt"), step("encrypt", "b.txt"), step("verify", "*.celo"), step("encrypt", "a.txt")})
+	if err != nil || len(errs) > 0 {
+		t.Fatal(err, errs)
+	}
+	// The verification fails, the encrypted files are removed.
+	for i, want := range []string{stepRolledBack, stepRolledBack, stepFailed, stepNotRun} {
+		if results[i].status != want {
+			t.Errorf("step %d: got %s, want %s (%v)", i+1, results[i].status, want, results[i].err)
+		}
+	}
+	if !errors.Is(errors.WrongPassphrase, results[2].err) && !errors.Is(errors.Decrypt, results[2].err) {
+		t.Errorf("got error %v", results[2].err)
+	}
+	for _, name := range []string{"a.txt.celo", "b.txt.celo"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't rolled back: %v", name, err)
+		}
+	}
+
+	results, errs, err = runPlan([]*planStep{step("encrypt", "a.txt"), step("verify", "a.txt.celo")})
+	if err != nil || len(errs) > 0 {
+		t.Fatal(err, errs)
+	}
+	for i, r := range results {
+		if r.status != stepOK || r.report == nil || r.report.Processed != 1 {
+			t.Errorf("step %d: got %s, %+v, %v", i+1, r.status, r.report, r.err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt.celo")); err != nil {
+		t.Error(err)
+	}
+
+	// A step fails if its sources match no files.
+	if results, _, _ = runPlan([]*planStep{step("encrypt", "b.txt"), step("encrypt", "*.missing")}); !errors.Is(errors.NotExist, results[1].err) {
+		t.Errorf("got error %v, want kind NotExist", results[1].err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt.celo")); !os.IsNotExist(err) {
+		t.Errorf("b.txt.celo wasn't rolled back: %v", err)
+	}
+
+	// Nothing runs if a step is invalid.
+	invalid := step("encrypt", "a.txt")
+	invalid.flags["ow"] = configValue{values: []string{"true"}}
+	if _, _, err = runPlan([]*planStep{step("encrypt", "b.txt"), invalid}); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got error %v, want kind Invalid", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt.celo")); !os.IsNotExist(err) {
+		t.Errorf("b.txt.celo was created: %v", err)
+	}
+}
+
+func TestFormatPlan(t *testing.T) {
+	results := []*stepResult{
+		{step: &planStep{command: "encrypt", sources: []string{"a.txt"}}, status: stepRolledBack, report: &jsonReport{Processed: 1}},
+		{step: &planStep{command: "verify", sources: []string{"*.celo"}}, status: stepFailed, err: errors.E(errors.Ciphertext)},
+		{step: &planStep{command: "decrypt", sources: []string{"b.celo"}}, status: stepNotRun},
+	}
+
+	got := formatPlan("plan.yaml", results, []error{errors.E(errors.Create, errors.Entity("a.txt.celo"))})
+	for _, want := range []string{
+		"plan.yaml: 3 step(s). (0 done, 1 failed, 1 rolled back, 1 not run)\n",
+		"  1. ROLLED BACK  encrypt a.txt (1 file(s))\n",
+		"  2. FAILED       verify *.celo: ",
+		"  3. NOT RUN      decrypt b.celo\n",
+		"Not removed: a.txt.celo",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q doesn't contain %q", got, want)
+		}
+	}
+
+	b := new(bytes.Buffer)
+	if err := printPlanJSON(b, "plan.yaml", results, true, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var p jsonPlan
+	if err := json.Unmarshal(b.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.RolledBack || len(p.Steps) != 3 || p.Steps[0].Status != "rolled_back" || p.Steps[1].Error == "" {
+		t.Errorf("got %+v", p)
+	}
+}
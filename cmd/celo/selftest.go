@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+var selftestCommand = flag.NewFlagSet("selftest", flag.ContinueOnError)
+
+func initSelftestFlags() {
+	selftestCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// formatSelfTest result of each check of celo.SelfTest and the number of
+// checks that failed.
+func formatSelfTest(results []celo.SelfTestResult) (string, int) {
+	b := new(bytes.Buffer)
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(b, "  %s  %s: %v\n", colorFailed.paint("FAIL"), r.Name, r.Err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(b, "  %s    %s\n", colorOK.paint("OK"), r.Name)
+	}
+	return b.String(), failed
+}
+
+func selftest(args []string) (err error) {
+
+	initSelftestFlags()
+	if err = parseFlags(selftestCommand, args); err != nil {
+		return err
+	}
+	setupColors()
+
+	report, failed := formatSelfTest(celo.SelfTest())
+	fmt.Fprint(os.Stdout, report)
+
+	if failed > 0 {
+		return errors.E(errors.Internal, errors.Errorf("%d check(s) failed, this build of celo can't be trusted with data", failed))
+	}
+	fmt.Fprintln(os.Stdout, "All checks passed.")
+
+	return nil
+}
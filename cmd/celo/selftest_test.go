@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestFormatSelfTest(t *testing.T) {
+	got, failed := formatSelfTest([]celo.SelfTestResult{
+		{Name: "cipher"},
+		{Name: "format", Err: errors.Errorf("decrypted %q", "x")},
+	})
+	if failed != 1 {
+		t.Errorf("got %d failed checks, want 1", failed)
+	}
+	want := "  OK    cipher\n  FAIL  format: decrypted \"x\"\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, failed := formatSelfTest(celo.SelfTest()); failed != 0 {
+		t.Errorf("%d check(s) of this build failed", failed)
+	}
+}
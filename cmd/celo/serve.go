@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// serveTokenEnv environment variable with the token of the requests to the
+// API. A random one is generated if it isn't set.
+const serveTokenEnv = "CELO_SERVE_TOKEN"
+
+// servePhraseHeader header of the requests that use their own phrase instead
+// of the one the server was started with.
+const servePhraseHeader = "Celo-Phrase"
+
+const (
+	serveListenDefault = "127.0.0.1:7600"
+	serveListenUsage   = "`address` the API listens on. Only loopback addresses, such as 127.0.0.1, [::1]\n\tor localhost, are accepted: requests and phrases aren't encrypted in transit."
+
+	serveMaxSizeDefault = 64
+	serveMaxSizeUsage   = "Refuse request bodies larger than `MiB` mebibytes. 0 accepts any size."
+
+	serveTokenFileUsage = "Write the token of the requests to `file`, only readable by its owner, instead of printing\n\tit to Stdout."
+)
+
+// Limits of the HTTP server.
+const (
+	// serveHeaderTimeout time the headers of a request have to be sent.
+	serveHeaderTimeout = 10 * time.Second
+	// serveShutdownTimeout time the requests in flight have to finish once
+	// the server is stopped.
+	serveShutdownTimeout = 30 * time.Second
+)
+
+var (
+	// Address the API listens on.
+	serveListen string
+	// Maximum size of request bodies in MiB.
+	serveMaxSize int64
+	// File the token is written to.
+	serveTokenFile string
+)
+
+var serveCommand = flag.NewFlagSet("serve", flag.ContinueOnError)
+
+func initServeFlags() {
+	serveCommand.StringVar(&serveListen, "listen", serveListenDefault, serveListenUsage)
+	serveCommand.Int64Var(&serveMaxSize, "max-size", serveMaxSizeDefault, serveMaxSizeUsage)
+	serveCommand.StringVar(&serveTokenFile, "token-file", "", serveTokenFileUsage)
+	serveCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	serveCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	serveCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	serveCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	serveCommand.BoolVar(&noConfirm, "nc", noConfirmDefault, noConfirmUsage)
+	serveCommand.IntVar(&minStrength, "min-strength", minStrengthDefault, minStrengthUsage)
+	serveCommand.BoolVar(&quiet, "q", false, quietUsage)
+	serveCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	serveCommand.BoolVar(&debug, "vv", false, debugUsage)
+	serveCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+}
+
+// checkLoopback returns an error of kind errors.Invalid if addr isn't a
+// host:port whose host is a loopback address or localhost.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.E(errors.Invalid, errors.Errorf("invalid address %s: %v", addr, err))
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return errors.E(errors.Invalid, errors.Errorf("%s isn't a loopback address, the API can only listen on this machine", addr))
+	}
+	return nil
+}
+
+// serveToken returns the token in the environment variable env, such as
+// $CELO_SERVE_TOKEN, or a random token if it isn't set, and reports whether it
+// was generated.
+func serveToken(getenv func(string) string, env string) (string, bool, error) {
+	if t := getenv(env); t != "" {
+		return t, false, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, errors.E(errors.Internal, errors.Errorf("unable to generate a token: %v", err))
+	}
+	return hex.EncodeToString(b), true, nil
+}
+
+// writeServeToken writes token to the file name, which only its owner can
+// read.
+func writeServeToken(name, token string) error {
+	if err := os.WriteFile(name, []byte(token+"\n"), 0600); err != nil {
+		return errors.E(errors.Create, errors.Entity(name), err)
+	}
+	// The file might have existed with other permissions.
+	if err := os.Chmod(name, 0600); err != nil {
+		return errors.E(errors.Permissions, errors.Entity(name), err)
+	}
+	return nil
+}
+
+// apiServer answers the requests to the API: encrypting, decrypting and
+// inspecting the files sent as their body. It is safe for concurrent use.
+type apiServer struct {
+	// secret phrase used by the requests without their own.
+	secret []byte
+	// token requests are authenticated with.
+	token string
+	// maxSize of the bodies in bytes, any size if it is 0.
+	maxSize int64
+}
+
+// handler returns the handler of the endpoints of the API.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/encrypt", s.endpoint(s.encrypt))
+	mux.HandleFunc("/v1/decrypt", s.endpoint(s.decrypt))
+	mux.HandleFunc("/v1/inspect", s.endpoint(s.inspect))
+	return mux
+}
+
+// endpoint returns a handler running h for the POST requests with the token
+// of the server, and limiting the size of their body.
+func (s *apiServer) endpoint(h func(w *apiWriter, r *http.Request) error) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		w := &apiWriter{ResponseWriter: rw}
+
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="celo"`)
+			writeAPIError(rw, http.StatusUnauthorized, errors.E(errors.Permissions, errors.Errorf("missing or invalid token")))
+			return
+		}
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			writeAPIError(rw, http.StatusMethodNotAllowed, errors.E(errors.Invalid, errors.Errorf("%s requires POST, got %s", r.URL.Path, r.Method)))
+			return
+		}
+		if s.maxSize > 0 {
+			r.Body = http.MaxBytesReader(rw, r.Body, s.maxSize)
+		}
+
+		err := h(w, r)
+		switch {
+		case err == nil:
+		case w.wrote:
+			// The status was sent, the client only learns that the response
+			// is incomplete.
+			panic(http.ErrAbortHandler)
+		default:
+			writeAPIError(rw, apiStatus(err), err)
+		}
+	}
+}
+
+// phrase returns a copy of the phrase of the request, in its Celo-Phrase
+// header, or of the server. It returns an error of kind errors.PhraseIsEmpty
+// if neither has one.
+func (s *apiServer) phrase(r *http.Request) ([]byte, error) {
+	if p := r.Header.Get(servePhraseHeader); p != "" {
+		return []byte(p), nil
+	}
+	if len(s.secret) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, errors.Errorf("the request has no %s header and the server no phrase", servePhraseHeader))
+	}
+	return append([]byte(nil), s.secret...), nil
+}
+
+// encrypt encrypts the body of the request and writes the encrypted file. The
+// padding scheme can be set with the pad parameter, e.g. ?pad=padme.
+func (s *apiServer) encrypt(w *apiWriter, r *http.Request) error {
+	padding := celo.PaddingNone
+	if name := r.URL.Query().Get("pad"); name != "" {
+		p, err := parsePadding(name)
+		if err != nil {
+			return err
+		}
+		padding = p
+	}
+
+	secret, err := s.phrase(r)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(secret)
+
+	e := celo.NewEncrypter()
+	defer e.Wipe()
+	if err = e.Config(celo.SetPadding(padding), celo.WithLogger(logger()), agentOption()); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = e.EncryptStreamContext(r.Context(), secret, r.Body, w)
+	return err
+}
+
+// decrypt decrypts the encrypted file sent as the body of the request and
+// writes its content, each chunk once it was authenticated. The response is
+// aborted if the rest of the file fails authentication.
+func (s *apiServer) decrypt(w *apiWriter, r *http.Request) error {
+	secret, err := s.phrase(r)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(secret)
+
+	d := celo.NewDecrypter()
+	defer d.Wipe()
+	if err = d.Config(celo.WithLogger(logger()), agentOption()); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = d.DecryptStreamContext(r.Context(), secret, r.Body, w)
+	return err
+}
+
+// apiInfo details of an encrypted file returned by /v1/inspect (See
+// celo.Info).
+type apiInfo struct {
+	Version     int      `json:"version"`
+	Cipher      string   `json:"cipher"`
+	KDF         string   `json:"kdf,omitempty"`
+	Padding     string   `json:"padding"`
+	Envelope    bool     `json:"envelope"`
+	Recipients  []string `json:"recipients,omitempty"`
+	ChunkSize   int      `json:"chunk_size"`
+	Signed      bool     `json:"signed"`
+	Trailer     bool     `json:"trailer"`
+	Archive     bool     `json:"archive"`
+	HeaderSize  int      `json:"header_size"`
+	PayloadSize int64    `json:"payload_size"`
+	Size        int64    `json:"size"`
+}
+
+// inspect writes the details of the encrypted file sent as the body of the
+// request as JSON. No phrase is required.
+func (s *apiServer) inspect(w *apiWriter, r *http.Request) error {
+	info, err := celo.Inspect(r.Body)
+	if err != nil {
+		return err
+	}
+
+	res := apiInfo{
+		Version:     info.Version,
+		Cipher:      info.Cipher,
+		KDF:         info.KDF,
+		Padding:     info.Padding.String(),
+		Envelope:    info.Envelope,
+		ChunkSize:   info.ChunkSize,
+		Signed:      info.Signed,
+		Trailer:     info.Trailer,
+		Archive:     info.Archive,
+		HeaderSize:  info.HeaderSize,
+		PayloadSize: info.PayloadSize,
+		Size:        info.Size,
+	}
+	for _, t := range info.Recipients {
+		res.Recipients = append(res.Recipients, t.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+// apiWriter records whether the response was started, after which errors
+// can't be reported with a status.
+type apiWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *apiWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// apiError body of the responses of the requests that failed.
+type apiError struct {
+	Error string `json:"error"`
+	// Kind and KindCode of the error (See errors.Kind).
+	Kind     string `json:"kind"`
+	KindCode uint16 `json:"kind_code"`
+}
+
+// writeAPIError responds with status and err as JSON.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	kind := errorKind(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: err.Error(), Kind: kind.String(), KindCode: uint16(kind)})
+}
+
+// apiStatus returns the HTTP status of the responses of the requests that
+// failed with err.
+func apiStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	switch errorKind(err) {
+	case errors.Invalid, errors.Padding, errors.PhraseIsEmpty:
+		return http.StatusBadRequest
+	case errors.WrongPassphrase, errors.Ciphertext, errors.Signature, errors.Sign, errors.Truncated,
+		errors.Metadata, errors.Incompatible, errors.Decode, errors.Nonce, errors.NonceSize,
+		errors.Salt, errors.SaltSize, errors.BlockSize:
+		return http.StatusUnprocessableEntity
+	case errors.Canceled:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func serve(args []string) (err error) {
+
+	initServeFlags()
+	if err = parseFlags(serveCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	if err = checkLoopback(serveListen); err != nil {
+		return err
+	}
+	if serveMaxSize < 0 {
+		return errors.E(errors.Invalid, errors.Errorf("-max-size can't be negative, got %d", serveMaxSize))
+	}
+	min, err := checkMinStrength()
+	if err != nil {
+		return err
+	}
+
+	token, generated, err := serveToken(os.Getenv, serveTokenEnv)
+	if err != nil {
+		return err
+	}
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	// Stdout carries the token.
+	secret, err := strongPhrase(ttyPhrase(withAgent(phrase)), min).Phrase(!noConfirm)
+	if err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(secret)
+	if err = checkPhraseStrength(secret, min); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", serveListen)
+	if err != nil {
+		return errors.E(errors.Create, errors.Entity(serveListen), err)
+	}
+
+	switch {
+	case serveTokenFile != "":
+		if err = writeServeToken(serveTokenFile, token); err != nil {
+			l.Close()
+			return err
+		}
+	case generated:
+		// Clients find the token through the environment, the line can be
+		// evaluated by the shell as the one of agent.
+		fmt.Printf("%s=%s; export %s;\n", serveTokenEnv, token, serveTokenEnv)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "API listening on http://%s, stop it with Ctrl+C.\n", l.Addr())
+	}
+
+	a := &apiServer{secret: secret, token: token, maxSize: serveMaxSize << 20}
+	srv := &http.Server{Handler: a.handler(), ReadHeaderTimeout: serveHeaderTimeout}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	shutdown := make(chan error, 1)
+	go func() {
+		<-stop
+		// The requests in flight are answered first.
+		ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	if err = srv.Serve(l); !stderrors.Is(err, http.ErrServerClosed) {
+		return errors.E(errors.Other, errors.Op("main.serve"), err)
+	}
+	if err = <-shutdown; err != nil {
+		return errors.E(errors.Canceled, errors.Op("main.serve"), err)
+	}
+	return nil
+}
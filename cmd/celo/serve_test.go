@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:7600": true,
+		"[::1]:7600":     true,
+		"localhost:0":    true,
+		"0.0.0.0:7600":   false,
+		":7600":          false,
+		"10.0.0.2:7600":  false,
+		"example.com:80": false,
+		"127.0.0.1":      false,
+	} {
+		if err := checkLoopback(addr); (err == nil) != ok {
+			t.Errorf("%s: got %v, want ok %v", addr, err, ok)
+		} else if err != nil && !errors.Is(errors.Invalid, err) {
+			t.Errorf("%s: got %v, want kind Invalid", addr, err)
+		}
+	}
+}
+
+func TestServeToken(t *testing.T) {
+	token, generated, err := serveToken(func(string) string { return "" }, serveTokenEnv)
+	if err != nil || !generated || len(token) != 64 {
+		t.Errorf("got token %q, %v, %v", token, generated, err)
+	}
+	if other, _, _ := serveToken(func(string) string { return "" }, serveTokenEnv); other == token {
+		t.Error("generated the same token twice")
+	}
+
+	token, generated, err = serveToken(func(k string) string { return map[string]string{serveTokenEnv: "t0k3n"}[k] }, serveTokenEnv)
+	if err != nil || generated || token != "t0k3n" {
+		t.Errorf("got token %q, %v, %v, want the one of $%s", token, generated, err, serveTokenEnv)
+	}
+
+	name := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(name, nil, 0644)
+	if err = writeServeToken(name, token); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "t0k3n\n" {
+		t.Errorf("got token file %q", b)
+	}
+	if fi, _ := os.Stat(name); fi.Mode().Perm()&0077 != 0 {
+		t.Errorf("others can read the token file (%v)", fi.Mode().Perm())
+	}
+}
+
+func TestAPIServer(t *testing.T) {
+	a := &apiServer{secret: []byte("secret"), token: "t0k3n", maxSize: 1 << 20}
+	srv := httptest.NewServer(a.handler())
+	defer srv.Close()
+
+	post := func(path string, body []byte, header ...string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer t0k3n")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res, b
+	}
+	apiErr := func(b []byte) apiError {
+		var e apiError
+		if err := json.Unmarshal(b, &e); err != nil {
+			t.Errorf("error body %q: %v", b, err)
+		}
+		return e
+	}
+
+	plaintext := []byte("the content of the file")
+	res, encrypted := post("/v1/encrypt?pad=padme", plaintext)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("encrypt: got %s %q", res.Status, encrypted)
+	}
+	if got, err := celo.DecryptBytes([]byte("secret"), encrypted); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("encrypted file decrypts to %q, %v", got, err)
+	}
+
+	res, decrypted := post("/v1/decrypt", encrypted)
+	if res.StatusCode != http.StatusOK || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("decrypt: got %s %q, want %q", res.Status, decrypted, plaintext)
+	}
+
+	res, b := post("/v1/inspect", encrypted)
+	var info apiInfo
+	if err := json.Unmarshal(b, &info); res.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("inspect: got %s %q, %v", res.Status, b, err)
+	}
+	if info.Padding != celo.PaddingPadme.String() || info.Size != int64(len(encrypted)) {
+		t.Errorf("inspect: got %+v", info)
+	}
+
+	// The phrase of a request replaces the one of the server.
+	res, encrypted = post("/v1/encrypt", plaintext, servePhraseHeader, "other")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("encrypt with %s: got %s %q", servePhraseHeader, res.Status, encrypted)
+	}
+	res, b = post("/v1/decrypt", encrypted)
+	if e := apiErr(b); res.StatusCode != http.StatusUnprocessableEntity || e.Kind != errors.WrongPassphrase.String() {
+		t.Errorf("decrypt with the wrong phrase: got %s %+v", res.Status, e)
+	}
+	if res, b = post("/v1/decrypt", encrypted, servePhraseHeader, "other"); !bytes.Equal(b, plaintext) {
+		t.Errorf("decrypt with %s: got %s %q", servePhraseHeader, res.Status, b)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		body   []byte
+		status int
+	}{
+		{"/v1/encrypt?pad=none-of-them", plaintext, http.StatusBadRequest},
+		{"/v1/decrypt", plaintext, http.StatusUnprocessableEntity},
+		{"/v1/inspect", nil, http.StatusUnprocessableEntity},
+		{"/v1/encrypt", make([]byte, 2<<20), http.StatusRequestEntityTooLarge},
+	} {
+		res, b := post(tc.path, tc.body)
+		if e := apiErr(b); res.StatusCode != tc.status || e.Error == "" {
+			t.Errorf("%s: got %s %+v, want status %d", tc.path, res.Status, e, tc.status)
+		}
+	}
+
+	// Requests without the token, or that aren't POST, are refused.
+	for _, tc := range []struct {
+		method, auth string
+		status       int
+	}{
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodPost, "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodPost, "t0k3n", http.StatusUnauthorized},
+		{http.MethodGet, "Bearer t0k3n", http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(tc.method, srv.URL+"/v1/decrypt", strings.NewReader(""))
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Errorf("%s %q: got %s, want %d", tc.method, tc.auth, res.Status, tc.status)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"golang.org/x/term"
+)
+
+// stdioSource source that reads the data from Stdin and writes the result to
+// Stdout, e.g. celo encrypt - < secret.txt > secret.txt.celo
+const stdioSource = "-"
+
+// isStdio reports whether the data is read from Stdin and written to Stdout
+// instead of files.
+func isStdio(src []string) bool {
+	return len(src) == 1 && src[0] == stdioSource
+}
+
+// ttyPhrase makes p ask for the phrase in the controlling terminal if it is
+// typed, Stdin and Stdout carry the data.
+func ttyPhrase(p celo.PhraseProvider) celo.PhraseProvider {
+	switch t := p.(type) {
+	case celo.TerminalPhrase:
+		t.TTY = true
+		return t
+	case celo.KeychainPhrase:
+		t.Ask = ttyPhrase(t.Ask)
+		return t
+	case agentPhrase:
+		t.ask = ttyPhrase(t.ask)
+		return t
+	}
+	return p
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// encryptStdio encrypts everything read from r and writes the encrypted file
+// to w. Encrypted data isn't written to a terminal.
+func encryptStdio(e *celo.Encrypter, secret []byte, r io.Reader, w io.Writer) error {
+	if isTerminal(w) {
+		return errors.E(errors.Invalid, errors.Errorf("refusing to write encrypted data to a terminal, redirect Stdout"))
+	}
+	_, err := e.EncryptStream(secret, r, w)
+	return err
+}
+
+// decryptStdio decrypts the encrypted file read from r and writes its content
+// to w once it was authenticated.
+func decryptStdio(d *celo.Decrypter, secret []byte, r io.Reader, w io.Writer) error {
+	_, err := d.DecryptStream(secret, r, w)
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestStdio(t *testing.T) {
+	if !isStdio([]string{"-"}) || isStdio([]string{"-", "a.txt"}) || isStdio([]string{"a.txt"}) {
+		t.Error("isStdio doesn't match a single -")
+	}
+
+	e := celo.NewEncrypter()
+	var encrypted bytes.Buffer
+	if err := encryptStdio(e, []byte("secret"), bytes.NewReader([]byte("attack at dawn")), &encrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	d := celo.NewDecrypter()
+	var decrypted bytes.Buffer
+	if err := decryptStdio(d, []byte("secret"), bytes.NewReader(encrypted.Bytes()), &decrypted); err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.String() != "attack at dawn" {
+		t.Errorf("got %q", decrypted.String())
+	}
+
+	decrypted.Reset()
+	if err := decryptStdio(d, []byte("wrong"), bytes.NewReader(encrypted.Bytes()), &decrypted); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+	if decrypted.Len() > 0 {
+		t.Error("content written with a wrong phrase")
+	}
+}
+
+func TestTTYPhrase(t *testing.T) {
+	if p, ok := ttyPhrase(celo.TerminalPhrase{Retries: 3}).(celo.TerminalPhrase); !ok || !p.TTY || p.Retries != 3 {
+		t.Errorf("got %#v", p)
+	}
+	if p := ttyPhrase(celo.EnvPhrase("CELO_PHRASE")); p != celo.EnvPhrase("CELO_PHRASE") {
+		t.Errorf("got %#v", p)
+	}
+	// Phrases missing from the keychain are typed in the terminal too.
+	if p, ok := ttyPhrase(celo.KeychainPhrase{Name: "work", Ask: celo.TerminalPhrase{}}).(celo.KeychainPhrase); !ok || !p.Ask.(celo.TerminalPhrase).TTY {
+		t.Errorf("got %#v", p)
+	}
+}
+
+func TestParseArgsStdio(t *testing.T) {
+	original := os.Args
+	t.Cleanup(func() { os.Args = original })
+
+	os.Args = []string{"celo", "d", "-", "-phrase-env", "CELO_PHRASE"}
+	cmd, src, args, err := parseArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd != "decrypt" || len(src) != 1 || src[0] != "-" || len(args) != 2 {
+		t.Errorf("got %s %v %v", cmd, src, args)
+	}
+
+	os.Args = []string{"celo", "-", "-no-confirm"}
+	if cmd, src, _, err = parseArgs(); err != nil || cmd != "encrypt" || !isStdio(src) {
+		t.Errorf("got %s %v, %v", cmd, src, err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// openTTY opens the controlling terminal for reading.
+func openTTY() (*os.File, error) {
+	return os.Open("/dev/tty")
+}
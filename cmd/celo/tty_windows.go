@@ -0,0 +1,9 @@
+package main
+
+import "os"
+
+// openTTY opens the input of the console of the process, Windows doesn't have
+// a controlling terminal.
+func openTTY() (*os.File, error) {
+	return os.Open("CONIN$")
+}
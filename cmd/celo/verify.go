@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+const (
+	verifyExcludeUsage = "Exclude `file name or glob pattern` from verification.\n\tUseful when a glob is used as the source selector. Can be repeated."
+	verifyWhereUsage   = "Report which chunks of corrupted and truncated files failed authentication, and how much\n\tof their content is intact. Can't be used with -json."
+)
+
+// Verification results.
+const (
+	verifyIntact      = "OK"
+	verifyCorrupted   = "CORRUPTED"
+	verifyWrongPhrase = "WRONG PHRASE"
+	verifyBadSigner   = "BAD SIGNATURE"
+	verifyTruncated   = "TRUNCATED"
+	verifyUnreadable  = "UNREADABLE"
+)
+
+var (
+	// Exclude file names or glob patterns.
+	verifyExclude stringList
+	// Locate the damage of corrupted and truncated files.
+	verifyWhere bool
+)
+
+var verifyCommand = flag.NewFlagSet("verify", flag.ContinueOnError)
+
+func initVerifyFlags() {
+	verifyCommand.Var(&verifyExclude, "exclude", verifyExcludeUsage)
+	verifyCommand.BoolVar(&verifyWhere, "where", false, verifyWhereUsage)
+	verifyCommand.Var(&include, "include", includeUsage)
+	verifyCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	verifyCommand.StringVar(&filesFrom, "files-from", filesFromDefault, filesFromUsage)
+	verifyCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	verifyCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	verifyCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	verifyCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	verifyCommand.Var(&identities, "identity", identityUsage)
+	verifyCommand.StringVar(&verifyKey, "verify-key", "", verifyKeyUsage)
+	verifyCommand.BoolVar(&jsonOutput, "json", false, jsonUsage)
+	verifyCommand.BoolVar(&quiet, "q", false, quietUsage)
+	verifyCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	verifyCommand.BoolVar(&debug, "vv", false, debugUsage)
+	verifyCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+	verifyCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// verifyResult classifies the error returned by Decrypter.VerifyFile.
+func verifyResult(err error) string {
+	switch {
+	case err == nil:
+		return verifyIntact
+	case errors.Is(errors.WrongPassphrase, err), errors.Is(errors.Decrypt, err):
+		// Files that don't use envelope encryption can't tell a wrong phrase
+		// from a corrupt ciphertext, a wrong phrase is more likely.
+		return verifyWrongPhrase
+	case errors.Is(errors.Sign, err):
+		return verifyBadSigner
+	case errors.Is(errors.Truncated, err):
+		return verifyTruncated
+	case errors.Is(errors.Open, err):
+		return verifyUnreadable
+	}
+	return verifyCorrupted
+}
+
+func verify(src []string, args []string) (err error) {
+
+	initVerifyFlags()
+	if err = parseFlags(verifyCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	if verifyWhere && jsonOutput {
+		return errors.E(errors.Invalid, errors.Errorf("-where can't be used with -json"))
+	}
+	setupColors()
+
+	matches, err := matchSources(src, verifyExclude)
+	if err != nil {
+		return err
+	}
+
+	// Print to Stdout the final list of files that are going to be verified.
+	if !jsonOutput {
+		fmt.Fprintln(summaries(), formatGlobMatches(matches))
+	}
+
+	if len(matches) == 0 {
+		return newJSONReport("verify").print(os.Stdout)
+	}
+
+	var secret []byte
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	phrase = withAgent(phrase)
+	// A typed phrase isn't required if identities are used.
+	if _, typed := phrase.(prompt); !typed || len(identities) == 0 {
+		if secret, err = phrase.Phrase(false); err != nil {
+			return err
+		}
+	}
+	defer celo.ZeroBytes(secret)
+
+	d := celo.NewDecrypter()
+	defer d.Wipe()
+
+	if err = d.Config(celo.WithLogger(logger()), agentOption()); err != nil {
+		return err
+	}
+
+	if verifyKey != "" {
+		k, err := readVerifyingKey(verifyKey)
+		if err != nil {
+			return err
+		}
+		if err := d.Config(celo.VerifyWith(k)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range identities {
+		ids, err := readIdentities(name)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := d.Config(celo.AddIdentity(id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	rep := newJSONReport("verify")
+	results := make([]string, len(matches))
+	failed := 0
+	for i, name := range matches {
+		r := fileResult(name, func() (string, error) { return "", d.VerifyFile(secret, name) })
+		rep.add(r)
+		results[i] = verifyResult(r.Err)
+		if results[i] != verifyIntact {
+			failed++
+		}
+	}
+
+	if rep != nil {
+		if err = rep.print(os.Stdout); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(summaries(), formatVerifiedFiles(matches, results))
+	}
+
+	if verifyWhere {
+		for i, name := range matches {
+			if results[i] != verifyCorrupted && results[i] != verifyTruncated {
+				continue
+			}
+			r, err := d.LocateDamage(secret, name)
+			fmt.Fprint(summaries(), formatDamage(name, r, err))
+		}
+	}
+
+	if failed > 0 {
+		// Scripts rely on the exit code to detect damaged files.
+		return errors.E(verifyFailureKind(results), errors.Errorf("%d file(s) failed verification", failed))
+	}
+
+	return nil
+}
+
+// verifyFailureKind returns the kind of error of a failed verification, which
+// decides the exit code (See exitCode): the kind of the most severe result.
+func verifyFailureKind(results []string) errors.Kind {
+	found := map[string]bool{}
+	for _, r := range results {
+		found[r] = true
+	}
+
+	switch {
+	case found[verifyCorrupted], found[verifyTruncated]:
+		return errors.Ciphertext
+	case found[verifyBadSigner]:
+		return errors.Sign
+	case found[verifyWrongPhrase]:
+		return errors.WrongPassphrase
+	case found[verifyUnreadable]:
+		return errors.Open
+	}
+	return errors.Decrypt
+}
+
+// formatVerifiedFiles summary of the verification of each file.
+func formatVerifiedFiles(names, results []string) string {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r]++
+	}
+
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%d file(s) verified. (%d intact, %d corrupted, %d truncated, %d wrong phrase, %d bad signature, %d unreadable)\n\n",
+		len(names), counts[verifyIntact], counts[verifyCorrupted], counts[verifyTruncated], counts[verifyWrongPhrase],
+		counts[verifyBadSigner], counts[verifyUnreadable])
+
+	for i, name := range names {
+		c := colorOK
+		if results[i] != verifyIntact {
+			c = colorFailed
+		}
+		fmt.Fprintf(b, "  %s %s\n", c.paint(fmt.Sprintf("%-14s", results[i])), colorFile.paint(name))
+	}
+
+	return b.String()
+}
+
+// formatDamage where the file name is damaged, as reported by
+// celo.Decrypter.LocateDamage: the ranges of chunks that failed authentication
+// in the file and in its content, and how much of it is intact. err is the
+// reason the damage couldn't be located.
+func formatDamage(name string, r *celo.DamageReport, err error) string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "\n%s\n", colorFile.paint(name))
+	if err != nil {
+		fmt.Fprintf(b, "  The damage can't be located: %v\n", err)
+		return b.String()
+	}
+
+	for _, d := range r.Damaged {
+		chunks := fmt.Sprintf("chunk %d", d.FirstChunk)
+		if d.LastChunk > d.FirstChunk {
+			chunks = fmt.Sprintf("chunks %d-%d", d.FirstChunk, d.LastChunk)
+		}
+		fmt.Fprintf(b, "  %s %s: bytes %d-%d of the file, %d-%d of the content\n", colorFailed.paint("DAMAGED  "), chunks,
+			d.Offset, d.Offset+d.Size-1, d.PlaintextOffset, d.PlaintextOffset+d.PlaintextSize-1)
+	}
+	if r.Truncated {
+		fmt.Fprintf(b, "  %s chunks after chunk %d are missing\n", colorFailed.paint("TRUNCATED"), r.Chunks-1)
+	}
+
+	intact := r.IntactChunks()
+	fmt.Fprintf(b, "  %d of %d chunk(s) intact, up to %s of content can be recovered\n", intact, r.Chunks,
+		formatBytes(intact*int64(r.ChunkSize)))
+	return b.String()
+}
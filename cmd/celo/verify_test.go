@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+func TestVerifyResult(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, verifyIntact},
+		{errors.E(errors.WrongPassphrase), verifyWrongPhrase},
+		{errors.E(errors.Decrypt), verifyWrongPhrase},
+		{errors.E(errors.Op("decrypter.VerifyFile"), errors.E(errors.Sign)), verifyBadSigner},
+		{errors.E(errors.Truncated), verifyTruncated},
+		{errors.E(errors.Open), verifyUnreadable},
+		{errors.E(errors.Ciphertext), verifyCorrupted},
+		{errors.Errorf("unknown"), verifyCorrupted},
+	}
+
+	for _, tt := range tests {
+		if got := verifyResult(tt.err); got != tt.want {
+			t.Errorf("verifyResult(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFormatVerifiedFiles(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+	results := []string{
+		verifyIntact, verifyIntact, verifyCorrupted, verifyTruncated,
+		verifyWrongPhrase, verifyBadSigner, verifyUnreadable,
+	}
+
+	summary := strings.SplitN(formatVerifiedFiles(names, results), "\n", 2)[0]
+	want := "7 file(s) verified. (2 intact, 1 corrupted, 1 truncated, 1 wrong phrase, 1 bad signature, 1 unreadable)"
+	if summary != want {
+		t.Errorf("got summary %q, want %q", summary, want)
+	}
+}
+
+func TestVerifyFailureKind(t *testing.T) {
+	tests := []struct {
+		results []string
+		want    errors.Kind
+	}{
+		{[]string{verifyIntact, verifyWrongPhrase, verifyTruncated}, errors.Ciphertext},
+		{[]string{verifyBadSigner, verifyWrongPhrase, verifyUnreadable}, errors.Sign},
+		{[]string{verifyUnreadable, verifyWrongPhrase}, errors.WrongPassphrase},
+		{[]string{verifyUnreadable}, errors.Open},
+	}
+
+	for _, tt := range tests {
+		if got := verifyFailureKind(tt.results); got != tt.want {
+			t.Errorf("verifyFailureKind(%v) = %v, want %v", tt.results, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDamage(t *testing.T) {
+	r := &celo.DamageReport{
+		Chunks:    6,
+		ChunkSize: 1024,
+		Damaged: []celo.DamagedRange{
+			{FirstChunk: 1, LastChunk: 2, Offset: 1100, Size: 2080, PlaintextOffset: 1024, PlaintextSize: 2048},
+			{FirstChunk: 4, LastChunk: 4, Offset: 4220, Size: 1040, PlaintextOffset: 4096, PlaintextSize: 1024},
+		},
+		Truncated: true,
+	}
+
+	got := formatDamage("a.celo", r, nil)
+	for _, want := range []string{
+		"chunks 1-2: bytes 1100-3179 of the file, 1024-3071 of the content\n",
+		"chunk 4: bytes 4220-5259 of the file, 4096-5119 of the content\n",
+		"chunks after chunk 5 are missing\n",
+		"3 of 6 chunk(s) intact, up to 3.0 KiB of content can be recovered\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q doesn't contain %q", got, want)
+		}
+	}
+
+	got = formatDamage("a.celo", nil, errors.E(errors.Incompatible, errors.Errorf("the payload of the file isn't chunked")))
+	if !strings.Contains(got, "The damage can't be located") {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+const (
+	watchPatternUsage = "Only encrypt files whose name matches the glob `pattern`, e.g. '*.md'. Can be repeated.\n\tEvery file is encrypted if it isn't used."
+
+	watchIntervalDefault = 2 * time.Second
+	watchIntervalUsage   = "How often the directory is scanned for new or modified files with -poll, or when the\n\tsystem can't notify changes, e.g. 500ms."
+
+	watchPollDefault = false
+	watchPollUsage   = "Scan the directory every -interval instead of waiting for the system to notify changes,\n\te.g. on network file systems, whose changes made by other hosts aren't notified."
+)
+
+// watchSettle time a file must stay unchanged after a change was notified
+// before it is encrypted.
+const watchSettle = 500 * time.Millisecond
+
+var (
+	// Glob patterns of the names of the files encrypted.
+	watchPatterns stringList
+	// Time between scans of the directory when it is polled.
+	watchInterval time.Duration
+	// Poll the directory instead of waiting for change notifications.
+	watchPoll bool
+)
+
+var watchCommand = flag.NewFlagSet("watch", flag.ContinueOnError)
+
+func initWatchFlags() {
+	watchCommand.Var(&watchPatterns, "pattern", watchPatternUsage)
+	watchCommand.BoolVar(&hidden, "hidden", hiddenDefault, hiddenUsage)
+	watchCommand.DurationVar(&watchInterval, "interval", watchIntervalDefault, watchIntervalUsage)
+	watchCommand.BoolVar(&watchPoll, "poll", watchPollDefault, watchPollUsage)
+	watchCommand.Var(sourceRemoval{&removeSource, &shredSource}, "rm-source", removeSourceUsage)
+	watchCommand.IntVar(&shredPasses, "shred-passes", shredPassesDefault, shredPassesUsage)
+	watchCommand.StringVar(&extension, "ext", extensionDefault, extensionUsage)
+	watchCommand.StringVar(&phraseEnv, "phrase-env", phraseEnvDefault, phraseEnvUsage)
+	watchCommand.StringVar(&phraseFile, "phrase-file", phraseFileDefault, phraseFileUsage)
+	watchCommand.BoolVar(&usePinentry, "pinentry", pinentryDefault, pinentryUsage)
+	watchCommand.StringVar(&keychain, "keychain", keychainDefault, keychainUsage)
+	watchCommand.BoolVar(&noConfirm, "nc", noConfirmDefault, noConfirmUsage)
+	watchCommand.IntVar(&minStrength, "min-strength", minStrengthDefault, minStrengthUsage)
+	watchCommand.BoolVar(&reuseKey, "reuse-key", reuseKeyDefault, reuseKeyUsage)
+	watchCommand.BoolVar(&quiet, "q", false, quietUsage)
+	watchCommand.BoolVar(&verbose, "v", false, verboseUsage)
+	watchCommand.BoolVar(&debug, "vv", false, debugUsage)
+	watchCommand.BoolVar(&debug, "verbose", false, verboseAliasUsage)
+	watchCommand.BoolVar(&noColor, "no-color", false, noColorUsage)
+}
+
+// watchedFile size and modification time of a file seen by a scan.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher encrypts the files of a directory as they are created or modified.
+// The directory is scanned when the system notifies a change in it, or
+// periodically if it can't: a file is encrypted once it hasn't changed since
+// the previous scan, so files that are still being written are left alone,
+// and again whenever it changes.
+type watcher struct {
+	dir string
+	// patterns the names of the files must match, any if it is empty.
+	patterns []string
+	// ext extension of encrypted files, with its dot.
+	ext string
+	// hidden whether hidden files and directories are encrypted.
+	hidden bool
+	// encrypt encrypts the file name, returning the name of the encrypted
+	// file.
+	encrypt func(name string) (string, error)
+	// last files seen by the previous scan.
+	last map[string]watchedFile
+	// handled files encrypted, or that couldn't be, as they were. They aren't
+	// encrypted again until they change.
+	handled map[string]watchedFile
+	// pending number of files the last scan found new or modified, which are
+	// encrypted by the next scan if they don't change in between.
+	pending int
+}
+
+// newWatcher creates a watcher of dir. It returns an error of kind
+// errors.Pattern if a pattern is malformed.
+func newWatcher(dir string, patterns []string, ext string, encrypt func(string) (string, error)) (*watcher, error) {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, errors.E(errors.Pattern, errors.Entity(p), err)
+		}
+	}
+	return &watcher{
+		dir:      dir,
+		patterns: patterns,
+		ext:      "." + strings.TrimPrefix(ext, "."),
+		encrypt:  encrypt,
+		last:     map[string]watchedFile{},
+		handled:  map[string]watchedFile{},
+	}, nil
+}
+
+// matches reports whether the file name is encrypted by the watcher.
+// Encrypted files never are, hidden files only with -hidden.
+func (w *watcher) matches(name string) bool {
+	base := filepath.Base(name)
+	if (!w.hidden && file.IsHidden(base)) || strings.HasSuffix(base, w.ext) {
+		return false
+	}
+	if len(w.patterns) == 0 {
+		return true
+	}
+	for _, p := range w.patterns {
+		if ok, _ := filepath.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// encrypted reports whether the file name, as seen by the scan, was encrypted
+// after it was last modified.
+func (w *watcher) encrypted(name string, f watchedFile) bool {
+	fi, err := os.Stat(name + w.ext)
+	return err == nil && !fi.ModTime().Before(f.modTime)
+}
+
+// scan walks the directory, hidden directories aside unless -hidden is used,
+// and encrypts the files that are ready. It returns the result of each file it encrypted.
+// It returns an error if the directory can't be read.
+func (w *watcher) scan() ([]celo.FileResult, error) {
+	seen := map[string]watchedFile{}
+	var ready []string
+	pending := 0
+
+	err := filepath.WalkDir(w.dir, func(name string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil && name == w.dir:
+			return err
+		case err != nil:
+			// Files removed during the walk, or that can't be read.
+			return nil
+		case d.IsDir() && name != w.dir && !w.hidden && file.IsHidden(name):
+			return filepath.SkipDir
+		case !d.Type().IsRegular() || !w.matches(name):
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		f := watchedFile{size: fi.Size(), modTime: fi.ModTime()}
+		seen[name] = f
+
+		switch {
+		case w.last[name] != f:
+			// Seen for the first time or still being written.
+			if w.handled[name] != f && !w.encrypted(name, f) {
+				pending++
+			}
+		case w.handled[name] == f:
+		case w.encrypted(name, f):
+			// Encrypted before the watcher started.
+		default:
+			ready = append(ready, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Op("main.scan"), errors.Entity(w.dir), err)
+	}
+	w.last = seen
+	w.pending = pending
+	for name := range w.handled {
+		if _, ok := seen[name]; !ok {
+			delete(w.handled, name)
+		}
+	}
+
+	results := make([]celo.FileResult, 0, len(ready))
+	for _, name := range ready {
+		results = append(results, fileResult(name, func() (string, error) { return w.encrypt(name) }))
+		w.handled[name] = seen[name]
+	}
+	return results, nil
+}
+
+// watchSource returns the directory of src, the only source of watch.
+func watchSource(src []string) (string, error) {
+	if len(src) != 1 {
+		return "", errors.E(errors.Invalid, errors.Errorf("watch requires a single directory, got %d sources", len(src)))
+	}
+	fi, err := os.Stat(src[0])
+	if err != nil {
+		return "", errors.E(errors.Open, errors.Entity(src[0]), err)
+	}
+	if !fi.IsDir() {
+		return "", errors.E(errors.Invalid, errors.Entity(src[0]), errors.Errorf("not a directory"))
+	}
+	return src[0], nil
+}
+
+func watch(src []string, args []string) (err error) {
+
+	initWatchFlags()
+	if err = parseFlags(watchCommand, args); err != nil {
+		return err
+	}
+	if err = checkVerbosity(); err != nil {
+		return err
+	}
+	min, err := checkMinStrength()
+	if err != nil {
+		return err
+	}
+	if watchInterval <= 0 {
+		return errors.E(errors.Invalid, errors.Errorf("-interval must be positive, got %v", watchInterval))
+	}
+	shred, err := shredOption()
+	if err != nil {
+		return err
+	}
+	setupColors()
+
+	dir, err := watchSource(src)
+	if err != nil {
+		return err
+	}
+
+	e := celo.NewEncrypter()
+	defer e.Wipe()
+	if err = e.Config(celo.SetExtension(extension), celo.PreserveKey(reuseKey), celo.WithLogger(logger()), agentOption(), shred); err != nil {
+		return err
+	}
+
+	var secret []byte
+	w, err := newWatcher(dir, watchPatterns, extension, func(name string) (string, error) {
+		// Files modified after they were encrypted are encrypted again.
+		return e.EncryptFile(secret, name, true, removeSource)
+	})
+	if err != nil {
+		return err
+	}
+	w.hidden = hidden
+
+	phrase, err := phraseProvider(phraseEnv, phraseFile, "")
+	if err != nil {
+		return err
+	}
+	if secret, err = strongPhrase(withAgent(phrase), min).Phrase(!noConfirm); err != nil {
+		return err
+	}
+	defer celo.ZeroBytes(secret)
+	if err = checkPhraseStrength(secret, min); err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Watching %s, stop it with Ctrl+C.\n", dir)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-stop
+		close(done)
+	}()
+	report := func(results []celo.FileResult) { fmt.Fprint(summaries(), formatWatchedFiles(results)) }
+	if watchPoll {
+		return w.poll(done, watchInterval, report)
+	}
+	return w.watch(done, watchInterval, report)
+}
+
+// watch scans the directory whenever the system notifies a change in it,
+// reporting the files encrypted by each scan, until done is closed. Scans
+// wait until there were no changes for watchSettle. If changes can't be
+// notified, e.g. because the limit of watches of the system was reached, the
+// directory is polled every interval instead.
+func (w *watcher) watch(done <-chan struct{}, interval time.Duration, report func([]celo.FileResult)) error {
+	n, err := fsnotify.NewWatcher()
+	if err != nil {
+		return w.pollInstead(done, interval, report, err)
+	}
+	defer n.Close()
+	if err = w.watchTree(n, w.dir); err != nil {
+		return w.pollInstead(done, interval, report, err)
+	}
+
+	// The files present are scanned as if they had just changed.
+	settle := time.NewTimer(0)
+	defer settle.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+
+		case ev, ok := <-n.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) {
+				// New directories are watched too.
+				if fi, err := os.Lstat(ev.Name); err == nil && fi.IsDir() {
+					w.watchTree(n, ev.Name)
+				}
+			}
+			resetTimer(settle, watchSettle)
+
+		case err, ok := <-n.Errors:
+			if !ok {
+				return nil
+			}
+			// Events were lost because the queue overflowed: the scan
+			// finds the changes anyway.
+			if err == fsnotify.ErrEventOverflow {
+				resetTimer(settle, watchSettle)
+				continue
+			}
+			return errors.E(errors.Open, errors.Op("main.watch"), errors.Entity(w.dir), err)
+
+		case <-settle.C:
+			results, err := w.scan()
+			if err != nil {
+				return err
+			}
+			report(results)
+			if w.pending > 0 {
+				// They are encrypted if they don't change until then.
+				settle.Reset(watchSettle)
+			}
+		}
+	}
+}
+
+// watchTree watches the directory dir and its subdirectories, hidden ones
+// aside unless -hidden is used. Directories removed during the walk are
+// ignored.
+func (w *watcher) watchTree(n *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil && name == dir:
+			return err
+		case err != nil || !d.IsDir():
+			return nil
+		case name != w.dir && !w.hidden && file.IsHidden(name):
+			return filepath.SkipDir
+		}
+		if err := n.Add(name); err != nil && name == dir {
+			return err
+		}
+		return nil
+	})
+}
+
+// pollInstead polls the directory because changes can't be notified, for the
+// reason err.
+func (w *watcher) pollInstead(done <-chan struct{}, interval time.Duration, report func([]celo.FileResult), err error) error {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Changes can't be notified (%v), scanning every %v.\n", err, interval)
+	}
+	return w.poll(done, interval, report)
+}
+
+// poll scans the directory every interval, reporting the files encrypted by
+// each scan, until done is closed.
+func (w *watcher) poll(done <-chan struct{}, interval time.Duration, report func([]celo.FileResult)) error {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		results, err := w.scan()
+		if err != nil {
+			return err
+		}
+		report(results)
+
+		select {
+		case <-done:
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// resetTimer stops t, draining its channel, and resets it to fire after d.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// formatWatchedFiles a line for each file encrypted by a scan.
+func formatWatchedFiles(results []celo.FileResult) string {
+	b := new(bytes.Buffer)
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(b, "  %s %s: %s\n", colorFailed.paint("FAILED   "), colorFile.paint(r.Source), errorKind(r.Err))
+			continue
+		}
+		fmt.Fprintf(b, "  %s %s\n", colorOK.paint("ENCRYPTED"), colorFile.paint(r.Output))
+	}
+	return b.String()
+}
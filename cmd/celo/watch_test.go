@@ -0,0 +1,239 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo"
+	"github.com/rrivera/celo/errors"
+)
+
+// writeFile writes content to the file name, creating its directory.
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// newTestWatcher returns a watcher of dir encrypting the files matching
+// patterns with the phrase "secret", and removing them if rm is true.
+func newTestWatcher(t *testing.T, dir string, rm bool, patterns ...string) *watcher {
+	t.Helper()
+	e := celo.NewEncrypter()
+	if err := e.Config(celo.PreserveKey(true)); err != nil {
+		t.Fatal(err)
+	}
+	w, err := newWatcher(dir, patterns, "celo", func(name string) (string, error) {
+		return e.EncryptFile([]byte("secret"), name, true, rm)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// scanNames scans w and returns the sources of the files it encrypted, or
+// failed to encrypt, relative to dir.
+func scanNames(t *testing.T, w *watcher) (encrypted, failed []string) {
+	t.Helper()
+	results, err := w.scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		name, _ := filepath.Rel(w.dir, r.Source)
+		if r.Err != nil {
+			failed = append(failed, name)
+		} else {
+			encrypted = append(encrypted, name)
+		}
+	}
+	sort.Strings(encrypted)
+	return encrypted, failed
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.txt", ".hidden.md", "sub/c.md", ".git/d.md", "e.md.celo"} {
+		writeFile(t, filepath.Join(dir, name), "content of "+name)
+	}
+	w := newTestWatcher(t, dir, false, "*.md")
+
+	// Files are encrypted once they didn't change between two scans.
+	if encrypted, _ := scanNames(t, w); len(encrypted) != 0 {
+		t.Errorf("first scan: encrypted %q", encrypted)
+	}
+	encrypted, _ := scanNames(t, w)
+	if len(encrypted) != 2 || encrypted[0] != "a.md" || encrypted[1] != filepath.Join("sub", "c.md") {
+		t.Errorf("second scan: encrypted %q, want a.md and sub/c.md", encrypted)
+	}
+	if encrypted, _ = scanNames(t, w); len(encrypted) != 0 {
+		t.Errorf("third scan: encrypted %q again", encrypted)
+	}
+
+	// Modified files are encrypted again once they are written.
+	a := filepath.Join(dir, "a.md")
+	writeFile(t, a, "new content")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(a, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted, _ = scanNames(t, w); len(encrypted) != 0 {
+		t.Errorf("modified file encrypted while it changes: %q", encrypted)
+	}
+	if encrypted, _ = scanNames(t, w); len(encrypted) != 1 || encrypted[0] != "a.md" {
+		t.Errorf("modified file: encrypted %q, want a.md", encrypted)
+	}
+	plaintext, err := celo.DecryptBytes([]byte("secret"), readFile(t, a+".celo"))
+	if err != nil || string(plaintext) != "new content" {
+		t.Errorf("got %q, %v", plaintext, err)
+	}
+	// Even if it seems to be modified after it was encrypted.
+	if encrypted, _ = scanNames(t, w); len(encrypted) != 0 {
+		t.Errorf("file modified in the future encrypted again: %q", encrypted)
+	}
+
+	// Files encrypted before the watcher started aren't encrypted again.
+	w = newTestWatcher(t, dir, false, "*.md")
+	scanNames(t, w)
+	if encrypted, _ = scanNames(t, w); len(encrypted) != 1 || encrypted[0] != "a.md" {
+		t.Errorf("new watcher: encrypted %q, want only a.md modified in the future", encrypted)
+	}
+}
+
+func TestWatcherHidden(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", ".hidden.md", ".git/d.md"} {
+		writeFile(t, filepath.Join(dir, name), "content of "+name)
+	}
+	w := newTestWatcher(t, dir, false)
+	w.hidden = true
+
+	scanNames(t, w)
+	encrypted, _ := scanNames(t, w)
+	if want := []string{".git/d.md", ".hidden.md", "a.md"}; strings.Join(encrypted, ",") != filepath.FromSlash(strings.Join(want, ",")) {
+		t.Errorf("encrypted %q, want %q", encrypted, want)
+	}
+}
+
+func TestWatcherRemoveSource(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "content")
+	w := newTestWatcher(t, dir, true)
+
+	scanNames(t, w)
+	if encrypted, _ := scanNames(t, w); len(encrypted) != 1 {
+		t.Fatalf("encrypted %q", encrypted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.md")); !os.IsNotExist(err) {
+		t.Errorf("source wasn't removed: %v", err)
+	}
+}
+
+func TestWatcherFailures(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "content")
+
+	calls := 0
+	w, err := newWatcher(dir, nil, "celo", func(string) (string, error) {
+		calls++
+		return "", errors.E(errors.Create)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that can't be encrypted aren't tried again until they change.
+	scanNames(t, w)
+	if _, failed := scanNames(t, w); len(failed) != 1 {
+		t.Errorf("failed %q, want a.md", failed)
+	}
+	scanNames(t, w)
+	if calls != 1 {
+		t.Errorf("encryption tried %d times, want 1", calls)
+	}
+
+	if _, err = newWatcher(dir, []string{"[a-"}, "celo", nil); !errors.Is(errors.Pattern, err) {
+		t.Errorf("malformed pattern: got %v, want kind Pattern", err)
+	}
+
+	w.dir = filepath.Join(dir, "missing")
+	if _, err = w.scan(); !errors.Is(errors.Open, err) {
+		t.Errorf("missing directory: got %v, want kind Open", err)
+	}
+}
+
+func TestWatcherNotify(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "present")
+	w := newTestWatcher(t, dir, false, "*.md")
+
+	encrypted := make(chan string, 10)
+	done := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		// Polling once an hour, only notified changes get encrypted.
+		errc <- w.watch(done, time.Hour, func(results []celo.FileResult) {
+			for _, r := range results {
+				name, _ := filepath.Rel(dir, r.Source)
+				encrypted <- name
+			}
+		})
+	}()
+
+	wait := func(want string) {
+		t.Helper()
+		select {
+		case got := <-encrypted:
+			if got != want {
+				t.Errorf("encrypted %s, want %s", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s wasn't encrypted", want)
+		}
+	}
+	wait("a.md")
+	// Files of new directories are encrypted too.
+	writeFile(t, filepath.Join(dir, "sub", "b.md"), "created")
+	wait(filepath.Join("sub", "b.md"))
+
+	close(done)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchSource(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.md")
+	writeFile(t, file, "content")
+
+	if got, err := watchSource([]string{dir}); err != nil || got != dir {
+		t.Errorf("got %q, %v", got, err)
+	}
+	for _, src := range [][]string{{file}, {dir, dir}} {
+		if _, err := watchSource(src); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%q: got %v, want kind Invalid", src, err)
+		}
+	}
+	if _, err := watchSource([]string{filepath.Join(dir, "missing")}); !errors.Is(errors.Open, err) {
+		t.Errorf("missing directory: got %v, want kind Open", err)
+	}
+}
@@ -0,0 +1,112 @@
+package celo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Collision identifies what EncryptFile, DecryptFile and their batch
+// counterparts do when the file they create already exists and overwrite is
+// false.
+type Collision byte
+
+// Supported collision strategies.
+const (
+	// CollisionFail the file isn't processed, an error of kind errors.Exist
+	// is returned.
+	CollisionFail Collision = iota
+	// CollisionOverwrite the existing file is replaced, as if overwrite was
+	// true.
+	CollisionOverwrite
+	// CollisionRename the file is created with a numeric suffix before its
+	// extension, the first one that doesn't exist: secrets-1.txt,
+	// secrets-2.txt...
+	CollisionRename
+	// CollisionSkip the file isn't processed, an error of kind errors.Skipped
+	// is returned. Batch methods don't report skipped files as failures (See
+	// FileResult.Skipped).
+	CollisionSkip
+)
+
+// maxRenames maximum suffix tried by CollisionRename.
+const maxRenames = 1000
+
+var collisionNames = map[Collision]string{
+	CollisionFail:      "fail",
+	CollisionOverwrite: "overwrite",
+	CollisionRename:    "rename",
+	CollisionSkip:      "skip",
+}
+
+// String returns the name of the collision strategy.
+func (c Collision) String() string {
+	name, ok := collisionNames[c]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// IsValid reports whether the collision strategy is supported.
+func (c Collision) IsValid() bool {
+	_, ok := collisionNames[c]
+	return ok
+}
+
+// collide applies the collision strategy to the output file name. It returns
+// the name of the file to create and whether it can be overwritten.
+// It returns an error of kind errors.Skipped if the file must be skipped.
+func (c *celo) collide(op errors.Op, name string, overwrite bool) (string, bool, error) {
+	if overwrite || !exists(name) {
+		return name, overwrite, nil
+	}
+
+	switch c.collision {
+	case CollisionOverwrite:
+		return name, true, nil
+	case CollisionSkip:
+		return "", false, errors.E(errors.Skipped, op, errors.Errorf("%s already exists", name))
+	case CollisionRename:
+		ext := filepath.Ext(name)
+		base := name[:len(name)-len(ext)]
+		for i := 1; i <= maxRenames; i++ {
+			if renamed := base + "-" + strconv.Itoa(i) + ext; !exists(renamed) {
+				return renamed, false, nil
+			}
+		}
+		return "", false, errors.E(errors.Exist, op, errors.Errorf("no free name for %s", name))
+	}
+
+	// file.WriteAtomic returns the error.
+	return name, false, nil
+}
+
+// ResolveCollision returns the name of the file to create in place of name,
+// and whether it replaces an existing file, applying the collision strategy
+// as EncryptFile and DecryptFile do (See OnCollision). Nothing is created, so
+// operations can be planned or previewed.
+// It returns an error of kind errors.Skipped or errors.Exist if the file
+// wouldn't be created because it exists.
+func (c *celo) ResolveCollision(name string, overwrite bool) (resolved string, replace bool, err error) {
+	op := errors.Op("collision.ResolveCollision")
+
+	if name, overwrite, err = c.collide(op, name, overwrite); err != nil {
+		return "", false, err
+	}
+	if !exists(name) {
+		return name, false, nil
+	}
+	if !overwrite {
+		return "", false, errors.E(errors.Exist, op, errors.Entity(name))
+	}
+	return name, true, nil
+}
+
+// exists reports whether a file with the specified name exists.
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
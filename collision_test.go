@@ -0,0 +1,184 @@
+package celo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestCollision(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain.txt")
+	encryptedName := name + "." + Extension
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encryptedName, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypter := func(c Collision) *Encrypter {
+		e := NewEncrypter()
+		if err := e.Config(OnCollision(c)); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	if _, err := encrypter(CollisionFail).EncryptFile([]byte("secret"), name, false, false); !errors.Is(errors.Exist, err) {
+		t.Errorf("fail: got error %v, want kind Exist", err)
+	}
+
+	if _, err := encrypter(CollisionSkip).EncryptFile([]byte("secret"), name, false, true); !errors.Is(errors.Skipped, err) {
+		t.Errorf("skip: got error %v, want kind Skipped", err)
+	}
+	if b, _ := os.ReadFile(encryptedName); string(b) != "existing" {
+		t.Error("skip: existing file modified")
+	}
+	if _, err := os.Stat(name); err != nil {
+		t.Error("skip: source removed")
+	}
+
+	for i, want := range []string{"plain.txt-1.celo", "plain.txt-2.celo"} {
+		got, err := encrypter(CollisionRename).EncryptFile([]byte("secret"), name, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != filepath.Join(dir, want) {
+			t.Errorf("rename %d: got %s, want %s", i, got, want)
+		}
+	}
+
+	// The decrypted file is renamed before its extension.
+	d := NewDecrypter()
+	d.Config(OnCollision(CollisionRename))
+	decryptedName, err := d.DecryptFile([]byte("secret"), filepath.Join(dir, "plain.txt-1.celo"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "plain.txt-1"); decryptedName != want {
+		t.Errorf("rename: got %s, want %s", decryptedName, want)
+	}
+	decryptedName, err = d.DecryptFile([]byte("secret"), filepath.Join(dir, "plain.txt-1.celo"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "plain-1.txt-1"); decryptedName != want {
+		t.Errorf("rename: got %s, want %s", decryptedName, want)
+	}
+
+	if _, err = encrypter(CollisionOverwrite).EncryptFile([]byte("secret"), name, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readSealed(t, NewDecrypter(), []byte("secret"), encryptedName); err != nil {
+		t.Errorf("overwrite: %v", err)
+	}
+
+	if err = NewEncrypter().Config(OnCollision(Collision(42))); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got error %v, want kind Invalid", err)
+	}
+}
+
+func TestCollisionSkipBatch(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, name := range names {
+		if err := os.WriteFile(name, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(names[0]+"."+Extension, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	e.Config(OnCollision(CollisionSkip))
+	results := e.EncryptFiles([]byte("secret"), names, false, false)
+	if r := results[0]; !r.Skipped || r.Err != nil || r.Output != "" {
+		t.Errorf("existing output: got %+v, want a skipped file", r)
+	}
+	if r := results[1]; r.Skipped || r.Err != nil || r.Output == "" {
+		t.Errorf("got %+v, want an encrypted file", r)
+	}
+
+	encrypted, errs := e.EncryptMultipleFiles([]byte("secret"), names, false, false)
+	if len(encrypted) != 0 || len(errs) != 0 {
+		t.Errorf("got %d files and %d errors, want 0 and 0", len(encrypted), len(errs))
+	}
+}
+
+func TestResolveCollision(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "plain.txt."+Extension)
+	if err := os.WriteFile(existing, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "other.txt."+Extension)
+
+	tests := []struct {
+		c         Collision
+		name      string
+		overwrite bool
+		want      string
+		replace   bool
+		kind      errors.Kind
+	}{
+		{CollisionFail, missing, false, missing, false, errors.Other},
+		{CollisionFail, existing, false, "", false, errors.Exist},
+		{CollisionFail, existing, true, existing, true, errors.Other},
+		{CollisionOverwrite, existing, false, existing, true, errors.Other},
+		{CollisionSkip, existing, false, "", false, errors.Skipped},
+		{CollisionRename, existing, false, filepath.Join(dir, "plain.txt-1.celo"), false, errors.Other},
+	}
+
+	for _, tt := range tests {
+		e := NewEncrypter()
+		if err := e.Config(OnCollision(tt.c)); err != nil {
+			t.Fatal(err)
+		}
+		got, replace, err := e.ResolveCollision(tt.name, tt.overwrite)
+		if tt.kind != errors.Other {
+			if !errors.Is(tt.kind, err) {
+				t.Errorf("%s %s: got error %v, want kind %v", tt.c, tt.name, err, tt.kind)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || replace != tt.replace {
+			t.Errorf("%s %s: got %s, %v, %v, want %s, %v", tt.c, tt.name, got, replace, err, tt.want, tt.replace)
+		}
+	}
+
+	// Nothing was created.
+	if m, _ := filepath.Glob(filepath.Join(dir, "*")); len(m) != 1 {
+		t.Errorf("got files %v", m)
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	e, d := NewEncrypter(), NewDecrypter()
+	if got := e.OutputName("docs/a.txt"); got != "docs/a.txt."+Extension {
+		t.Errorf("encrypt: got %s", got)
+	}
+	if got := d.OutputName("docs/a.txt." + Extension); got != "docs/a.txt" {
+		t.Errorf("decrypt: got %s", got)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	if err := e.Config(WithOutputDir(out)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Config(WithOutputDir(out)); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.OutputName("docs/a.txt"); got != filepath.Join(out, "a.txt."+Extension) {
+		t.Errorf("encrypt with output dir: got %s", got)
+	}
+	if got := d.OutputName("docs/a.txt." + Extension); got != filepath.Join(out, "a.txt") {
+		t.Errorf("decrypt with output dir: got %s", got)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("output directory created")
+	}
+}
@@ -0,0 +1,162 @@
+package celo
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEncryptFileContextCanceled(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(name, randomPlaintext(1000), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceled once the file has been read, before it is encrypted.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := NewEncrypter()
+	e.Config(SetProgress(func(entity string, done, total int64) {
+		if done == total {
+			cancel()
+		}
+	}))
+
+	_, err := e.EncryptFileContext(ctx, []byte("secret"), name, false, true)
+	if !errors.Is(errors.Canceled, err) || !stderrors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want kind Canceled", err)
+	}
+	if _, err = os.Stat(name + "." + Extension); !os.IsNotExist(err) {
+		t.Error("encrypted file created after cancellation")
+	}
+	if _, err = os.Stat(name); err != nil {
+		t.Error("source removed after cancellation")
+	}
+
+	names, errs := e.EncryptMultipleFilesContext(ctx, []byte("secret"), []string{name, name}, false, false)
+	if len(names) != 0 || len(errs) != 2 {
+		t.Fatalf("got %d files and %d errors, want 0 and 2", len(names), len(errs))
+	}
+	for _, err = range errs {
+		if !stderrors.Is(err, &errors.Error{Kind: errors.Canceled}) {
+			t.Errorf("got error %v, want an error of kind Canceled", err)
+		}
+	}
+}
+
+func TestDecryptFileContextCanceled(t *testing.T) {
+	name := writeSealed(t, NewEncrypter(), []byte("secret"), randomPlaintext(1000))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewDecrypter().DecryptFileContext(ctx, []byte("secret"), name, true, true)
+	if !errors.Is(errors.Canceled, err) {
+		t.Errorf("got error %v, want kind Canceled", err)
+	}
+	if _, err = os.Stat(name); err != nil {
+		t.Error("source removed after cancellation")
+	}
+}
+
+func TestGenerateKeyContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	_, err := GenerateKeyContext(ctx, []byte("secret"), make([]byte, SaltSize), Aes256BlockSize)
+	if !errors.Is(errors.Canceled, err) || !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want kind Canceled", err)
+	}
+
+	key, err := GenerateKeyContext(context.Background(), []byte("secret"), make([]byte, SaltSize), Aes256BlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != string(GenerateKey([]byte("secret"), make([]byte, SaltSize), Aes256BlockSize)) {
+		t.Error("GenerateKeyContext and GenerateKey keys differ")
+	}
+}
+
+// An interrupted operation must keep the existing output as is and not leave
+// temporary files behind.
+func TestFileContextCanceledKeepsOutput(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain")
+	plaintext := randomPlaintext(4*testChunkSize + 10)
+	if err := os.WriteFile(name, plaintext, 0600); err != nil {
+		t.Fatal(err)
+	}
+	encryptedName, err := NewEncrypter().EncryptFile([]byte("secret"), name, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := os.ReadFile(encryptedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceled halfway through the file.
+	cancelHalfway := func(cancel context.CancelFunc) Option {
+		return SetProgress(func(entity string, done, total int64) {
+			if done > total/2 {
+				cancel()
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := NewEncrypter()
+	e.Config(cancelHalfway(cancel))
+	if _, err = e.EncryptFileContext(ctx, []byte("secret"), name, true, false); !errors.Is(errors.Canceled, err) {
+		t.Errorf("EncryptFile: got error %v, want kind Canceled", err)
+	}
+	if b, _ := os.ReadFile(encryptedName); !bytes.Equal(b, encrypted) {
+		t.Error("EncryptFile: existing encrypted file modified")
+	}
+
+	if err = os.WriteFile(name, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	d := NewDecrypter()
+	d.Config(cancelHalfway(cancel))
+	if _, err = d.DecryptFileContext(ctx, []byte("secret"), encryptedName, true, false); !errors.Is(errors.Canceled, err) {
+		t.Errorf("DecryptFile: got error %v, want kind Canceled", err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "existing" {
+		t.Error("DecryptFile: existing decrypted file modified")
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files in the directory, want 2", len(entries))
+	}
+}
+
+func TestFileModes(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plain")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedName, err := NewEncrypter().EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(encryptedName); fi.Mode().Perm() != EncryptedFileMode {
+		t.Errorf("encrypted file mode %v, want %v", fi.Mode().Perm(), EncryptedFileMode)
+	}
+
+	if _, err = NewDecrypter().DecryptFile([]byte("secret"), encryptedName, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(name); fi.Mode().Perm() != DecryptedFileMode {
+		t.Errorf("decrypted file mode %v, want %v", fi.Mode().Perm(), DecryptedFileMode)
+	}
+}
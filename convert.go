@@ -0,0 +1,137 @@
+package celo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+// ConvertFile decrypts the file with the specified name using phrase and
+// encrypts it again in the format of targetVersion, e.g. to migrate files of
+// version 1 to the current format.
+// Options are applied to both the Decrypter and the Encrypter used, e.g.
+// SetBlockSize or SetPadding to change the configuration of the new file.
+// Only the current Version can be encoded, an error of kind
+// errors.Incompatible is returned for any other targetVersion.
+// Files that are already in targetVersion or newer are converted only if the
+// stanza of phrase doesn't use the parameters of SetKDFParams (the
+// DefaultKDFParams if it isn't used): only that stanza is replaced, as
+// RekeyFile does. Otherwise they aren't modified and an error of kind
+// errors.Skipped is returned.
+// The file is replaced atomically, if any step fails it isn't modified.
+func ConvertFile(phrase []byte, name string, targetVersion byte, opts ...Option) error {
+	op := errors.Op("convert.ConvertFile")
+
+	if targetVersion != Version {
+		return errors.E(errors.Incompatible, op, errors.Entity(name), errors.Errorf("files can only be converted to version %d", Version))
+	}
+
+	d := NewDecrypter()
+	defer d.Wipe()
+	if err := d.Config(opts...); err != nil {
+		return err
+	}
+
+	e := NewEncrypter()
+	defer e.Wipe()
+	if err := e.Config(opts...); err != nil {
+		return err
+	}
+
+	source, err := os.Open(name)
+	if err != nil {
+		return errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+	defer source.Close()
+
+	fi, err := source.Stat()
+	if err != nil {
+		return errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+
+	m, _, err := DecodeMetadata(source)
+	if err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+	upgrade := m.Version() < targetVersion
+	if !upgrade {
+		// Checking the stanzas doesn't require the phrase.
+		ok, err := usesKDFParams(source, m, e.kdf)
+		if err != nil {
+			return errors.E(op, errors.Entity(name), err)
+		}
+		if ok {
+			return errors.E(errors.Skipped, op, errors.Entity(name), errors.Errorf("already in version %d", m.Version()))
+		}
+	}
+
+	if _, err = source.Seek(0, io.SeekStart); err != nil {
+		return errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+	if _, err = d.Read(source); err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+
+	// The whole file is decrypted to authenticate it before it is replaced.
+	plaintext, err := d.Decrypt(phrase)
+	if err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+	defer ZeroBytes(plaintext)
+
+	w := e
+	if upgrade {
+		if _, err = e.Encrypt(phrase, plaintext); err != nil {
+			return errors.E(op, errors.Entity(name), err)
+		}
+	} else {
+		// The key of the stanza of phrase was derived while decrypting.
+		i, dataKey, err := d.unwrapPhrase(context.Background(), phrase)
+		if err != nil {
+			return errors.E(op, errors.Entity(name), err)
+		}
+		ZeroBytes(dataKey)
+		if d.stanzas[i].Type == StanzaPhraseKDF && d.kdf == e.kdf {
+			return errors.E(errors.Skipped, op, errors.Entity(name), errors.Errorf("already in version %d", m.Version()))
+		}
+		if w, err = rekeyEnvelope(d, e, phrase, phrase); err != nil {
+			return errors.E(op, errors.Entity(name), err)
+		}
+	}
+
+	return file.WriteAtomic(name, true, fi.Mode().Perm(), func(f *os.File) error {
+		_, err := w.Write(f)
+		return err
+	})
+}
+
+// usesKDFParams reports whether every phrase stanza of the file with the
+// metadata m, read from r, records the key derivation parameters p. Files
+// without envelope encryption or without phrase stanzas always do since they
+// can't be converted.
+func usesKDFParams(r io.Reader, m *Metadata, p KDFParams) (bool, error) {
+	if !m.hasFlag(flagEnvelope) {
+		return true, nil
+	}
+
+	stanzas, _, err := readStanzas(r)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range stanzas {
+		if !s.Type.isPhrase() {
+			continue
+		}
+		ps, err := parsePhrase(s, m)
+		if err != nil {
+			return false, err
+		}
+		if s.Type != StanzaPhraseKDF || ps.kdf != p {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package celo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// writeVersion1 writes plaintext encrypted with phrase in the format of
+// version 1 (metadata | salt | nonce | ciphertext) and returns the file name.
+func writeVersion1(t *testing.T, phrase, plaintext []byte) string {
+	t.Helper()
+
+	m, err := NewMetadata(1, SaltSize, Aes256BlockSize, NonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := make([]byte, SaltSize)
+	if _, err = rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(Aes256BlockSize, NonceSize, GenerateKey(phrase, salt, Aes256BlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, ciphertext, err := c.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "v1."+Extension)
+	b := bytes.Join([][]byte{m.Bytes(), salt, nonce, ciphertext}, nil)
+	if err = os.WriteFile(name, b, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestConvertFile(t *testing.T) {
+	plaintext := randomPlaintext(1000)
+	name := writeVersion1(t, []byte("secret"), plaintext)
+
+	if err := ConvertFile([]byte("secret"), name, Version, SetPadding(PaddingPadme)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := Inspect(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != Version || info.Padding != PaddingPadme {
+		t.Errorf("converted to version %d with padding %v", info.Version, info.Padding)
+	}
+	if fi, _ := os.Stat(name); fi.Mode().Perm() != 0640 {
+		t.Errorf("converted file mode %v, want 0640", fi.Mode().Perm())
+	}
+
+	got, err := openFile(NewDecrypter(), []byte("secret"), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("converted file content differs")
+	}
+
+	// Files in the target version are left as they are.
+	if err = ConvertFile([]byte("secret"), name, Version); !errors.Is(errors.Skipped, err) {
+		t.Fatalf("got error %v, want kind Skipped", err)
+	}
+	if c, _ := os.ReadFile(name); !bytes.Equal(c, b) {
+		t.Error("file in the target version modified")
+	}
+}
+
+func TestConvertFileKDFParams(t *testing.T) {
+	p := KDFParams{Time: 2, Memory: MinKDFMemory, Threads: 1}
+	other, _ := NewPhraseRecipient([]byte("other"))
+	e := NewEncrypter()
+	e.Config(AddRecipient(other))
+	name := writeSealed(t, e, []byte("secret"), []byte("attack at dawn"))
+	before, _ := os.ReadFile(name)
+
+	if err := ConvertFile([]byte("secret"), name, Version, SetKDFParams(p)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the stanza of the phrase is replaced.
+	after, _ := os.ReadFile(name)
+	info, err := Inspect(bytes.NewReader(after))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.KDF != p.String() {
+		t.Errorf("got KDF %q, want %q", info.KDF, p.String())
+	}
+	if len(after) != len(before) || !bytes.Equal(after[info.HeaderSize:], before[info.HeaderSize:]) {
+		t.Error("payload changed")
+	}
+	for _, phrase := range []string{"secret", "other"} {
+		if got, err := readSealed(t, NewDecrypter(), []byte(phrase), name); err != nil || string(got) != "attack at dawn" {
+			t.Errorf("phrase %q: got %q, %v", phrase, got, err)
+		}
+	}
+
+	// The stanza of the phrase already uses the parameters.
+	if err = ConvertFile([]byte("secret"), name, Version, SetKDFParams(p)); !errors.Is(errors.Skipped, err) {
+		t.Errorf("got error %v, want kind Skipped", err)
+	}
+	if c, _ := os.ReadFile(name); !bytes.Equal(c, after) {
+		t.Error("up to date file modified")
+	}
+}
+
+func TestConvertFileErrors(t *testing.T) {
+	name := writeVersion1(t, []byte("secret"), randomPlaintext(100))
+	b, _ := os.ReadFile(name)
+
+	if err := ConvertFile([]byte("wrong"), name, Version); !errors.Is(errors.Decrypt, err) {
+		t.Errorf("wrong phrase: got error %v, want kind Decrypt", err)
+	}
+	if err := ConvertFile([]byte("secret"), name, 1); !errors.Is(errors.Incompatible, err) {
+		t.Errorf("version 1: got error %v, want kind Incompatible", err)
+	}
+	if err := ConvertFile([]byte("secret"), name, Version+1); !errors.Is(errors.Incompatible, err) {
+		t.Errorf("version %d: got error %v, want kind Incompatible", Version+1, err)
+	}
+	if c, _ := os.ReadFile(name); !bytes.Equal(c, b) {
+		t.Error("file modified after a failed conversion")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(name)); len(entries) != 1 {
+		t.Errorf("%d files in the directory, want 1", len(entries))
+	}
+}
@@ -0,0 +1,173 @@
+package celo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// DamagedRange consecutive chunks of a payload that failed authentication.
+type DamagedRange struct {
+	// FirstChunk and LastChunk indexes of the chunks of the range, inclusive.
+	FirstChunk, LastChunk int64
+	// Offset and Size of the chunks in the encrypted file.
+	Offset, Size int64
+	// PlaintextOffset and PlaintextSize of the content the chunks held. The
+	// padding, if any, is at the end of the content.
+	PlaintextOffset, PlaintextSize int64
+}
+
+// DamageReport locates the damage of a file with a chunked payload (See
+// LocateDamage).
+type DamageReport struct {
+	// Chunks number of chunks found in the payload.
+	Chunks int64
+	// ChunkSize size of the content of each chunk.
+	ChunkSize int
+	// Damaged chunks that failed authentication, in order.
+	Damaged []DamagedRange
+	// Truncated reports whether chunks are missing at the end of the payload.
+	Truncated bool
+}
+
+// Intact reports whether every chunk was authenticated and none is missing.
+func (r *DamageReport) Intact() bool {
+	return len(r.Damaged) == 0 && !r.Truncated
+}
+
+// IntactChunks returns the number of chunks that were authenticated.
+func (r *DamageReport) IntactChunks() int64 {
+	n := r.Chunks
+	for _, d := range r.Damaged {
+		n -= d.LastChunk - d.FirstChunk + 1
+	}
+	return n
+}
+
+// add records that the chunk i, found at offset of the file with size bytes
+// of which overhead aren't content, failed authentication. The last range is
+// extended if it ends with the previous chunk.
+func (r *DamageReport) add(i, offset, size, overhead int64) {
+	plaintextSize := size - overhead
+	if plaintextSize < 0 {
+		plaintextSize = 0
+	}
+	if n := len(r.Damaged); n > 0 && r.Damaged[n-1].LastChunk == i-1 {
+		last := &r.Damaged[n-1]
+		last.LastChunk = i
+		last.Size += size
+		last.PlaintextSize += plaintextSize
+		return
+	}
+	r.Damaged = append(r.Damaged, DamagedRange{
+		FirstChunk: i, LastChunk: i,
+		Offset: offset, Size: size,
+		PlaintextOffset: i * int64(r.ChunkSize), PlaintextSize: plaintextSize,
+	})
+}
+
+// LocateDamage authenticates each chunk of the payload of the file with the
+// specified name on its own, instead of stopping at the first one that fails
+// as VerifyFile does, and reports which ones failed, so the content that can
+// still be recovered from a partially damaged file is known. Chunks missing
+// at the end of the payload are reported as truncation.
+// The header must be intact and the data key must be unwrapped with the
+// secret phrase (or the identities added with AddIdentity), the checksum of
+// the trailer and the signature aren't checked.
+// It returns an error of kind errors.Incompatible if the payload of the file
+// isn't chunked (version 1).
+func (d *Decrypter) LocateDamage(secretPhrase []byte, name string) (*DamageReport, error) {
+	op := errors.Op("decrypter.LocateDamage")
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	// The ciphertext of the instance no longer matches the decoded metadata.
+	d.initialized = false
+	d.signer = nil
+	d.trailer = nil
+
+	size := fileSize(f)
+	hn, err := d.readHeader(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return nil, errors.E(op, errors.Entity(name), err)
+	}
+
+	chunkSize := d.metadata.chunkSize()
+	if chunkSize == 0 || !d.metadata.hasFlag(flagEnvelope) {
+		return nil, errors.E(errors.Incompatible, op, errors.Entity(name), errors.Errorf("the payload of the file isn't chunked"))
+	}
+
+	end := size
+	if d.metadata.hasFlag(flagSigned) {
+		end -= SignatureBlockSize
+	}
+	if d.metadata.hasFlag(flagTrailer) {
+		end -= TrailerSize
+	}
+	report := &DamageReport{ChunkSize: chunkSize}
+
+	if end < int64(hn) {
+		// Whatever is left of the payload is the last part of the file.
+		end = size
+		report.Truncated = true
+	} else if d.metadata.hasFlag(flagTrailer) {
+		trailer := make([]byte, TrailerSize)
+		if _, err = f.ReadAt(trailer, end); err == nil {
+			_, err = parseTrailer(trailer, end-int64(hn))
+		}
+		if err != nil {
+			// The trailer and the signature weren't found where they should
+			// be, they are part of what is left of the payload.
+			end = size
+			report.Truncated = true
+		}
+	}
+
+	dataKey, err := d.unwrap(context.Background(), secretPhrase)
+	if err != nil {
+		return nil, errors.E(op, errors.Entity(name), err)
+	}
+	defer ZeroBytes(dataKey)
+
+	dataCipher, err := NewCipher(d.blockSize, d.nonceSize, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ad := d.additionalData(d.metadata)
+	layout := newChunkLayout(end-int64(hn), chunkSize, dataCipher.NonceSize())
+	report.Chunks = layout.chunks
+	buf := make([]byte, layout.sealedSize)
+	defer ZeroBytes(buf)
+
+	for i := int64(0); i < layout.chunks; i++ {
+		start, stop := layout.bounds(i)
+		sealed := buf[:stop-start]
+		if _, err = f.ReadAt(sealed, int64(hn)+start); err != nil {
+			return nil, errors.E(errors.Open, op, errors.Entity(name), err)
+		}
+
+		last := i == layout.chunks-1
+		chunk, err := openChunk(dataCipher, sealed, ad, i, last)
+		if err != nil && last {
+			// The last chunk found might not be the last one of the file, the
+			// ones after it are missing.
+			if chunk, err = openChunk(dataCipher, sealed, ad, i, false); err == nil {
+				report.Truncated = true
+			}
+		}
+		if err != nil {
+			report.add(i, int64(hn)+start, stop-start, int64(dataCipher.NonceSize()+TagSize))
+			continue
+		}
+		ZeroBytes(chunk)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,104 @@
+package celo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// writeChunkedFile encrypts plaintext with the phrase "secret" into a file
+// and returns its name, its content and the offset of its payload.
+func writeChunkedFile(t *testing.T, plaintext []byte) (string, []byte, int64) {
+	t.Helper()
+
+	b, err := EncryptBytes([]byte("secret"), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Inspect(bytes.NewReader(b))
+	if err != nil || info.ChunkSize != testChunkSize {
+		t.Fatalf("got %+v, %v", info, err)
+	}
+
+	name := filepath.Join(t.TempDir(), "damaged.celo")
+	if err = os.WriteFile(name, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The payload ends with the chunks, followed by the trailer.
+	sealed := sealedSize(int64(len(plaintext)), testChunkSize, NonceSize)
+	return name, b, int64(len(b)) - TrailerSize - sealed
+}
+
+func TestLocateDamage(t *testing.T) {
+	name, b, payload := writeChunkedFile(t, randomPlaintext(5*testChunkSize+10))
+	sealedChunk := int64(NonceSize + testChunkSize + TagSize)
+
+	d := NewDecrypter()
+	r, err := d.LocateDamage([]byte("secret"), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Intact() || r.Chunks != 6 || r.IntactChunks() != 6 {
+		t.Fatalf("intact file: got %+v", r)
+	}
+
+	// Chunks 1, 2 and 4 are damaged.
+	for _, i := range []int64{1, 2, 4} {
+		b[payload+i*sealedChunk+NonceSize+10] ^= 1
+	}
+	if err = os.WriteFile(name, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err = d.LocateDamage([]byte("secret"), name); err != nil {
+		t.Fatal(err)
+	}
+	want := []DamagedRange{
+		{1, 2, payload + sealedChunk, 2 * sealedChunk, testChunkSize, 2 * testChunkSize},
+		{4, 4, payload + 4*sealedChunk, sealedChunk, 4 * testChunkSize, testChunkSize},
+	}
+	if r.Truncated || r.IntactChunks() != 3 || len(r.Damaged) != len(want) {
+		t.Fatalf("got %+v", r)
+	}
+	for i := range want {
+		if r.Damaged[i] != want[i] {
+			t.Errorf("range %d: got %+v, want %+v", i, r.Damaged[i], want[i])
+		}
+	}
+
+	if _, err = d.LocateDamage([]byte("wrong"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+func TestLocateDamageTruncated(t *testing.T) {
+	name, b, payload := writeChunkedFile(t, randomPlaintext(3*testChunkSize+10))
+	sealedChunk := int64(NonceSize + testChunkSize + TagSize)
+
+	// The copy stopped in the middle of the chunk 2.
+	if err := os.WriteFile(name, b[:payload+2*sealedChunk+100], 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewDecrypter().LocateDamage([]byte("secret"), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Truncated || r.Chunks != 3 || len(r.Damaged) != 1 || r.Damaged[0].FirstChunk != 2 {
+		t.Errorf("got %+v", r)
+	}
+
+	// The copy stopped right after the chunk 1.
+	if err = os.WriteFile(name, b[:payload+2*sealedChunk], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = NewDecrypter().LocateDamage([]byte("secret"), name); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Truncated || r.Chunks != 2 || len(r.Damaged) != 0 {
+		t.Errorf("got %+v", r)
+	}
+}
@@ -2,17 +2,27 @@ package celo
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"hash"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/rrivera/celo/errors"
 	"github.com/rrivera/celo/file"
 )
 
 // Decrypter decodes and decrypts files or sources created by Celo.
+// A Decrypter isn't safe for concurrent use since it keeps the values of the
+// last decoded file, use Clone to get an instance per goroutine.
 type Decrypter struct {
 	celo
+
+	// signer key that signed the last decoded file, nil if it wasn't signed.
+	signer *VerifyingKey
 }
 
 // NewDecrypter creates a Decrypter with package's default configuration.
@@ -22,11 +32,21 @@ func NewDecrypter() *Decrypter {
 			saltSize:  SaltSize,
 			blockSize: Aes256BlockSize,
 			nonceSize: NonceSize,
+			kdf:       DefaultKDFParams(),
 			ext:       Extension,
+			fileMode:  DecryptedFileMode,
+			keys:      NewKeyCache(0, 0),
 		},
 	}
 }
 
+// Clone returns a new Decrypter with the same configuration that can be used
+// concurrently with d. The keys generated from secret phrases are shared, so
+// they are reused for files encrypted with the same phrase and salt.
+func (d *Decrypter) Clone() *Decrypter {
+	return &Decrypter{celo: d.celo.clone()}
+}
+
 // Init initializes a Decrypter instance by specifying custom salt, phrase,
 // nonce, and ciphertext values.
 // It returns an error if any of the values have incorrect sizes.
@@ -43,22 +63,18 @@ func (d *Decrypter) Init(secretPhrase, salt, nonce, ciphertext []byte) error {
 		return errors.E(errors.NonceSize, op)
 	}
 
-	// Assign both salt and nonce once that the sizes were validated.
-	d.salt = salt
-	d.nonce = nonce
+	// Assign both salt and nonce once that the sizes were validated. They are
+	// copied since Wipe zeroes them.
+	d.salt = append([]byte(nil), salt...)
+	d.nonce = append([]byte(nil), nonce...)
+	// Files without envelope encryption don't record the key derivation
+	// parameters.
+	d.kdf = DefaultKDFParams()
 
-	cipher, err := NewCipher(
-		d.blockSize,
-		d.nonceSize,
-		GenerateKey(secretPhrase, d.salt, uint32(d.blockSize)),
-	)
-	if err != nil {
+	if err := d.initCipher(context.Background(), secretPhrase); err != nil {
 		return err
 	}
 
-	// Assign the cipher until error check has passed.
-	d.cipher = cipher
-
 	// Store the ciphertext in the current instance so it can be decrypted.
 	d.ciphertext = ciphertext
 
@@ -71,57 +87,202 @@ func (d *Decrypter) Init(secretPhrase, salt, nonce, ciphertext []byte) error {
 }
 
 // initCipher creates and references an AES GCM cipher. The cipher key is
-// generated from a argon2 derived key using the secret phrase passed.
-func (d *Decrypter) initCipher(secretPhrase []byte) (err error) {
-	cipher, err := NewCipher(
-		d.blockSize,
-		d.nonceSize,
-		GenerateKey(secretPhrase, d.salt, uint32(d.blockSize)),
-	)
+// generated from a argon2 derived key using the secret phrase passed, unless it
+// was generated before for the same phrase and salt.
+// The key generation is abandoned if ctx is done.
+func (d *Decrypter) initCipher(ctx context.Context, secretPhrase []byte) (err error) {
+	digest := keyDigest(secretPhrase, d.salt, d.kdf)
+	if cipher := d.keys.get(digest); cipher != nil {
+		d.cipher, d.keyDigest = cipher, digest
+		d.log(slog.LevelDebug, "key reused")
+		return nil
+	}
+
+	start := time.Now()
+	key, err := d.generateKey(ctx, secretPhrase, d.salt)
+	if err != nil {
+		return err
+	}
+	d.log(slog.LevelDebug, "key derived", "duration", time.Since(start))
+	d.keyDerived(start)
+
+	cipher, err := NewCipher(d.blockSize, d.nonceSize, key)
+	ZeroBytes(key)
 	if err != nil {
 		return err
 	}
 
 	// Assign the cipher until the error check has passed.
-	d.cipher = cipher
+	d.setCipher(cipher, secretPhrase)
+	d.keys.put(digest, d.salt, cipher)
 
 	return nil
 }
 
 // Decrypt decrypts ciphertext using previously stored salt and nonce values and
 // the provided phrase (that generates the AES GCM key).
+// When the file uses envelope encryption, the phrase unwraps the data key from
+// the first phrase stanza it matches.
 //
 // It returns an error if the Decrypter instance isn't initialized.
 // It returns the plaintext as an array of bytes or an error if the decryption
 // process failed.
 func (d *Decrypter) Decrypt(secretPhrase []byte) (plaintext []byte, err error) {
+	return d.decrypt(context.Background(), secretPhrase)
+}
+
+// decrypt is Decrypt, it stops as soon as ctx is done.
+func (d *Decrypter) decrypt(ctx context.Context, secretPhrase []byte) (plaintext []byte, err error) {
 
 	if !d.IsReady() {
 		// Make sure that the Decrypter instance has been initialized.
 		return nil, errors.E(errors.NotReady, errors.Op("decrypter.Decrypt"))
 	}
 
-	if d.cipher == nil {
-		// Initialize cipher hasn't been initialized (referenced to instance).
+	if d.metadata != nil && d.metadata.hasFlag(flagEnvelope) {
+		return d.decryptEnvelope(ctx, secretPhrase)
+	}
+
+	// Files without envelope encryption don't record the key derivation
+	// parameters.
+	d.kdf = DefaultKDFParams()
+	if !d.keyMatches(secretPhrase) {
+		// Initialize cipher hasn't been initialized (referenced to instance),
+		// or it was generated from a different phrase.
 		// This will generate the decryption key using the salt and the phrase.
-		err = d.initCipher(secretPhrase)
+		err = d.initCipher(ctx, secretPhrase)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// Decrypt the ciphertext using the previously generated Nonce.
-	plaintext, err = d.cipher.Decrypt(d.nonce, d.ciphertext)
+	plaintext, err = d.cipher.Decrypt(d.nonce, d.ciphertext, nil)
 	if err != nil {
 		// AES GCM failed to decrypt or validate the authenticity of the
-		// decrypted message.
+		// decrypted message. The cipher might have been generated from a
+		// different phrase, it can't be reused.
+		// Files that don't use envelope encryption can't tell a wrong phrase
+		// from a corrupt ciphertext, the error is of kind errors.Decrypt.
+		d.cipher = nil
 		return nil, err
 	}
 
+	if d.metadata != nil {
+		// Strip the padding recorded in the file signature.
+		plaintext, err = Unpad(plaintext, d.metadata.Padding())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// plaintext isn't stored in the instance to prevent leaking it anywhere.
 	return plaintext, nil
 }
 
+// decryptEnvelope unwraps the data key with the secret phrase and decrypts the
+// ciphertext with it.
+func (d *Decrypter) decryptEnvelope(ctx context.Context, secretPhrase []byte) (plaintext []byte, err error) {
+	dataKey, err := d.unwrap(ctx, secretPhrase)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(dataKey)
+
+	if d.metadata.hasFlag(flagTrailer) {
+		// A corrupt payload is detected before decrypting anything.
+		if err = checkTrailer(dataKey, d.trailer, d.nonce, d.ciphertext); err != nil {
+			return nil, err
+		}
+	}
+
+	dataCipher, err := NewCipher(d.blockSize, d.nonceSize, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file signature was authenticated along with the ciphertext.
+	start := time.Now()
+	if chunkSize := d.metadata.chunkSize(); chunkSize > 0 {
+		plaintext, err = openChunks(ctx, dataCipher, d.ciphertext, d.additionalData(d.metadata), chunkSize)
+	} else {
+		plaintext, err = dataCipher.Decrypt(d.nonce, d.ciphertext, d.additionalData(d.metadata))
+		if err != nil {
+			// The data key was already authenticated when it was unwrapped,
+			// the ciphertext is corrupt.
+			err = errors.E(errors.Ciphertext, errors.Op("decrypter.decryptEnvelope"), err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.ciphered(start, int64(len(plaintext)))
+
+	// Strip the padding recorded in the file signature.
+	return Unpad(plaintext, d.metadata.Padding())
+}
+
+// unwrap returns the data key wrapped in the first stanza that can be opened
+// by any of the identities added with AddIdentity, or in the first phrase
+// stanza that can be opened with the secret phrase.
+func (d *Decrypter) unwrap(ctx context.Context, secretPhrase []byte) (dataKey []byte, err error) {
+	for _, s := range d.stanzas {
+		for _, id := range d.identities {
+			if dataKey, err = id.Unwrap(s, d.metadata); err == nil {
+				return dataKey, nil
+			}
+		}
+	}
+
+	_, dataKey, err = d.unwrapPhrase(ctx, secretPhrase)
+	return dataKey, err
+}
+
+// unwrapPhrase returns the data key wrapped in the first phrase stanza that can
+// be opened with the secret phrase, along with the index of the stanza.
+// The key generated from the phrase is kept as the instance's cipher, so it is
+// reused while neither the phrase nor the salt of the matching stanza change.
+func (d *Decrypter) unwrapPhrase(ctx context.Context, secretPhrase []byte) (i int, dataKey []byte, err error) {
+	op := errors.Op("decrypter.unwrapPhrase")
+
+	for i, s := range d.stanzas {
+		if !s.Type.isPhrase() || len(secretPhrase) == 0 {
+			continue
+		}
+
+		ps, err := parsePhrase(s, d.metadata)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		// The key is derived with the parameters recorded in the stanza.
+		d.kdf = ps.kdf
+		if !bytes.Equal(ps.salt, d.salt) || !d.keyMatches(secretPhrase) {
+			// The salt is copied from the stanza since Wipe zeroes it.
+			d.salt = append([]byte(nil), ps.salt...)
+			if err = d.initCipher(ctx, secretPhrase); err != nil {
+				// The previous cipher doesn't match the new salt.
+				d.cipher = nil
+				return 0, nil, err
+			}
+		}
+
+		dataKey, err = d.cipher.Decrypt(ps.nonce, ps.wrapped, ps.ad)
+		if err == nil {
+			return i, dataKey, nil
+		}
+
+		// The cipher was generated from a different phrase, it can't be
+		// reused.
+		d.cipher = nil
+	}
+
+	// None of the stanzas could be opened with the phrase or identities. The
+	// wrapped keys are authenticated on their own, a corrupt payload doesn't
+	// cause this.
+	return 0, nil, errors.E(errors.WrongPassphrase, op)
+}
+
 // Decode decodes from a io.Reader everything that is necessary to initialize a
 // Decrypter instance, including metadata, salt, nonce and the ciphertext.
 // It returns an error if the source is not readable or any of the values aren't
@@ -132,12 +293,114 @@ func (d *Decrypter) Decode(r io.Reader) (n int, err error) {
 }
 
 // Read decodes from a io.Reader everything that is necessary to initialize a
-// Decrypter instance, including metadata, salt, nonce and the ciphertext.
+// Decrypter instance, including metadata, recipients, salt, nonce and the
+// ciphertext.
 // It returns an error if the source is not readable or any of the values aren't
 // found.
+// It returns an error if the file is signed and the signature is invalid, or
+// if it isn't signed by the key passed to VerifyWith.
 func (d *Decrypter) Read(r io.Reader) (n int, err error) {
 	op := errors.Op("decrypter.Read")
-	var sn, nn int
+	var nn int
+
+	// Everything that precedes the signature block is signed. The ciphertext
+	// is read from r directly and hashed once the signature block is split
+	// from it.
+	h := newSignatureHash()
+	tr := io.TeeReader(r, h)
+
+	if n, err = d.readHeader(tr); err != nil {
+		return n, err
+	}
+
+	d.nonce = nil
+	if !d.metadata.hasFlag(flagChunked) {
+		d.nonce = make([]byte, d.nonceSize)
+		// Nonce should be part of the reader source. Chunked payloads include
+		// a nonce per chunk instead.
+		nn, err = io.ReadFull(tr, d.nonce)
+		n += nn
+		if err != nil {
+			// Make sure that there are enough bytes to fill the desired nonce
+			// size.
+			return n, errors.E(errors.Nonce, op, err)
+		}
+	}
+
+	// Remaining bytes correspond to the ciphertext and the signature block.
+	d.ciphertext, err = ioutil.ReadAll(r)
+	n += len(d.ciphertext)
+	if err != nil {
+		return n, errors.E(errors.Ciphertext, op, err)
+	}
+
+	d.signer = nil
+	d.trailer = nil
+
+	signed := d.metadata.hasFlag(flagSigned)
+	hasTrailer := d.metadata.hasFlag(flagTrailer)
+
+	// The ciphertext is followed by the trailer and the signature block.
+	tail := 0
+	if signed {
+		tail += SignatureBlockSize
+	}
+	if hasTrailer {
+		tail += TrailerSize
+	}
+
+	if len(d.ciphertext) < tail {
+		if hasTrailer {
+			return n, errors.E(errors.Truncated, op)
+		}
+		return n, errors.E(errors.Sign, op)
+	}
+
+	payload := d.ciphertext[:len(d.ciphertext)-tail]
+
+	if hasTrailer {
+		// The trailer is checked first, a truncated file would fail the
+		// signature verification for the wrong reason.
+		t := d.ciphertext[len(payload) : len(payload)+TrailerSize]
+		if d.trailer, err = parseTrailer(t, int64(len(d.nonce)+len(payload))); err != nil {
+			return n, err
+		}
+	}
+
+	if signed {
+		signedLen := len(d.ciphertext) - SignatureBlockSize
+		h.Write(d.ciphertext[:signedLen])
+
+		if d.signer, err = verify(h.Sum(nil), d.ciphertext[signedLen:]); err != nil {
+			return n, err
+		}
+	}
+
+	d.ciphertext = payload
+
+	if d.verifyingKey != nil && !d.verifyingKey.Equal(d.signer) {
+		return n, errors.E(errors.Sign, op, errors.Errorf("file isn't signed by %s", d.verifyingKey))
+	}
+
+	// Mark the instance as initialized. Initialized flag will mark the instance
+	// as ready for decrypting.
+	d.initialized = true
+
+	return n, nil
+}
+
+// ReadFrom is Read for the io.ReaderFrom interface, so an encoded file can be
+// decoded from wherever an io.ReaderFrom is accepted.
+func (d *Decrypter) ReadFrom(r io.Reader) (n int64, err error) {
+	nn, err := d.Read(r)
+	return int64(nn), err
+}
+
+// readHeader decodes the metadata and either the recipients section or the
+// salt of files that don't use envelope encryption.
+// It returns the number of bytes read.
+func (d *Decrypter) readHeader(r io.Reader) (n int, err error) {
+	var sn int
 
 	// Get file's signature and metadata, validate that it corresponds to a file
 	// encrypted and encoded by Celo.
@@ -151,13 +414,31 @@ func (d *Decrypter) Read(r io.Reader) (n int, err error) {
 	// Reference metadata's instance until validation has passed.
 	d.metadata = metadata
 
+	// The sizes used to encrypt the file are recorded in the metadata.
+	saltSize := int(metadata.vsbn[saltSizeIndex])
+	blockSize := int(metadata.vsbn[blockSizeIndex])
+	nonceSize := int(metadata.vsbn[nonceSizeIndex])
+	if saltSize != d.saltSize || blockSize != d.blockSize || nonceSize != d.nonceSize {
+		d.saltSize, d.blockSize, d.nonceSize = saltSize, blockSize, nonceSize
+		// The key and cipher can't be reused.
+		d.salt = nil
+		d.cipher = nil
+	}
+
+	if metadata.hasFlag(flagEnvelope) {
+		// The salt is part of each phrase stanza of the recipients section.
+		d.stanzas, sn, err = readStanzas(r)
+		return n + sn, err
+	}
+
 	salt := make([]byte, d.saltSize)
 	// Salt should be part of the reader source.
-	if sn, err := io.ReadFull(r, salt); err != nil {
+	sn, err = io.ReadFull(r, salt)
+	n += sn
+	if err != nil {
 		// Make sure that there are enough bytes to fill the desired salt size.
-		return n + sn, errors.E(errors.Salt, op, err)
+		return n, errors.E(errors.Salt, errors.Op("decrypter.readHeader"), err)
 	}
-	n += sn
 
 	if d.salt == nil || !bytes.Equal(salt, d.salt) {
 		d.salt = salt
@@ -165,27 +446,164 @@ func (d *Decrypter) Read(r io.Reader) (n int, err error) {
 		// going to be different.
 		d.cipher = nil
 	}
+	d.stanzas = nil
+
+	return n, nil
+}
+
+// WriteHeader encodes the metadata and recipients section of the last decoded
+// file, everything that precedes the nonce and the ciphertext, which Rewrap
+// doesn't change.
+// It returns the number of bytes written.
+// It returns an error if the file doesn't use envelope encryption.
+func (d *Decrypter) WriteHeader(w io.Writer) (n int, err error) {
+	op := errors.Op("decrypter.WriteHeader")
 
-	d.nonce = make([]byte, d.nonceSize)
-	// Nonce should be part of the reader source.
-	if nn, err := io.ReadFull(r, d.nonce); err != nil {
-		// Make sure that there are enough bytes to fill the desired nonce size.
-		return n + nn, errors.E(errors.Nonce, op, err)
+	if d.metadata == nil || !d.metadata.hasFlag(flagEnvelope) {
+		return 0, errors.E(errors.Incompatible, op, errors.Errorf("the file doesn't have a wrapped data key"))
 	}
-	n += nn
 
-	// Remaining bytes correspond to the ciphertext.
-	d.ciphertext, err = ioutil.ReadAll(r)
-	n += len(d.ciphertext)
+	if n, err = w.Write(d.metadata.Bytes()); err != nil {
+		return n, errors.E(errors.Encode, op, err)
+	}
+
+	sn, err := writeStanzas(w, d.stanzas)
+	return n + sn, err
+}
+
+// Rewrap changes the phrase of the last decoded file. The data key is
+// unwrapped with oldPhrase and wrapped again with newPhrase, replacing the
+// stanza of oldPhrase. The new stanza keeps the key derivation parameters of
+// the one it replaces. The ciphertext isn't changed, use WriteHeader to encode
+// the new recipients section.
+// It returns an error if the file doesn't use envelope encryption, if it is
+// signed (rewrapping would invalidate the signature) or if oldPhrase doesn't
+// unwrap the data key.
+func (d *Decrypter) Rewrap(oldPhrase, newPhrase []byte) error {
+	op := errors.Op("decrypter.Rewrap")
+
+	if d.metadata == nil || !d.metadata.hasFlag(flagEnvelope) {
+		return errors.E(errors.Incompatible, op, errors.Errorf("the file doesn't have a wrapped data key"))
+	}
+
+	if d.metadata.hasFlag(flagSigned) {
+		return errors.E(errors.Sign, op, errors.Errorf("rewrapping would invalidate the signature"))
+	}
+
+	if len(newPhrase) == 0 {
+		return errors.E(errors.PhraseIsEmpty, op)
+	}
+
+	i, dataKey, err := d.unwrapPhrase(context.Background(), oldPhrase)
 	if err != nil {
-		return n, errors.E(errors.Ciphertext, op, err)
+		return err
 	}
+	defer ZeroBytes(dataKey)
 
-	// Mark the instance as initialized. Initialized flag will mark the instance
-	// as ready for decrypting.
-	d.initialized = true
+	// The stanza keeps its type and key derivation parameters, so its size
+	// doesn't change (See RewrapFile).
+	s, err := wrapWithPhrase(d.stanzas[i].Type, d.kdf, newPhrase, dataKey, d.metadata)
+	if err != nil {
+		return err
+	}
 
-	return n, nil
+	d.stanzas[i] = s
+
+	return nil
+}
+
+// RewrapFile changes the phrase of the file with the specified name without
+// re-encrypting its content (See Decrypter.Rewrap). Only the recipients
+// section is read and replaced in place, so the cost doesn't depend on the
+// size of the file.
+// The new recipients section is synced to disk before RewrapFile returns, but
+// writing it isn't atomic: if the system crashes while it is written, the
+// section might be left partially written and the file can't be decrypted.
+// Keep a backup of files that can't be lost, or use RekeyFile, which replaces
+// the file atomically at the cost of rewriting it.
+func (d *Decrypter) RewrapFile(oldPhrase, newPhrase []byte, name string) (err error) {
+	op := errors.Op("decrypter.RewrapFile")
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return errors.E(errors.Open, op, err)
+	}
+	defer f.Close()
+
+	// The ciphertext of the instance no longer matches the decoded metadata.
+	d.initialized = false
+
+	n, err := d.readHeader(f)
+	if err != nil {
+		return err
+	}
+
+	if err = d.Rewrap(oldPhrase, newPhrase); err != nil {
+		return err
+	}
+
+	b := new(bytes.Buffer)
+	if _, err = d.WriteHeader(b); err != nil {
+		return err
+	}
+
+	if b.Len() != n {
+		// Stanzas of the same type have the same size, this shouldn't happen.
+		return errors.E(errors.Internal, op, errors.Errorf("recipients section size changed"))
+	}
+
+	if _, err = f.WriteAt(b.Bytes(), 0); err != nil {
+		return errors.E(errors.Encode, op, err)
+	}
+
+	// Don't report success until the new phrase is the one on disk.
+	if err = f.Sync(); err != nil {
+		return errors.E(errors.Encode, op, err)
+	}
+
+	return nil
+}
+
+// Signer returns the key that signed the last decoded file. It returns nil if
+// the file wasn't signed.
+func (d *Decrypter) Signer() *VerifyingKey {
+	return d.signer
+}
+
+// VerifyFile decodes and decrypts the file with the specified name to check
+// that it is intact and that it can be decrypted with the secret phrase (or the
+// identities added with AddIdentity). The plaintext is discarded, nothing is
+// written to disk.
+// Errors of kind errors.WrongPassphrase mean that the data key couldn't be
+// unwrapped, while errors.Ciphertext means the file is corrupt. Files that
+// don't use envelope encryption can't tell them apart, errors.Decrypt is
+// returned instead.
+func (d *Decrypter) VerifyFile(secretPhrase []byte, name string) error {
+	op := errors.Op("decrypter.VerifyFile")
+
+	f, err := os.Open(name)
+	if err != nil {
+		return errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	if _, err = d.Read(d.reader(f, name, fileSize(f))); err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+
+	if _, err = d.Decrypt(secretPhrase); err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+
+	return nil
+}
+
+// OutputName returns the name of the file DecryptFile creates from the
+// source name, or the directory DecryptDir extracts an archive into: the name
+// without the extension, in the output directory if one was set (See
+// WithOutputDir). The output directory isn't created.
+func (d *Decrypter) OutputName(name string) string {
+	return d.outputPath(d.decryptedName(name))
 }
 
 // DecryptFile decrypts a file with the specified name. It requires the secret
@@ -193,59 +611,283 @@ func (d *Decrypter) Read(r io.Reader) (n int, err error) {
 // It returns the name of the decrypted file or an error.
 // If a file with the same name as the decrypted file exists, overwrite has to
 // be `true` in order to overwrite the content of the file.
+// The decrypted file is written to a temporary file in the same directory,
+// which only replaces it once the whole file was authenticated, so an
+// interrupted or failed decryption never leaves a partially written file
+// behind. It is created with DecryptedFileMode permissions unless SetFileMode
+// is used.
+// Files with a chunked payload are decrypted one chunk at a time, other files
+// are decrypted in memory.
 func (d *Decrypter) DecryptFile(secretPhrase []byte, name string, overwrite, removeSource bool) (decryptedFileName string, err error) {
+	return d.DecryptFileContext(context.Background(), secretPhrase, name, overwrite, removeSource)
+}
+
+// DecryptFileContext is like DecryptFile but it stops as soon as ctx is done,
+// returning an error of kind errors.Canceled. The decrypted file isn't created
+// if ctx is done before the decryption finishes.
+func (d *Decrypter) DecryptFileContext(ctx context.Context, secretPhrase []byte, name string, overwrite, removeSource bool) (decryptedFileName string, err error) {
+	decryptedFileName, _, err = d.decryptFile(ctx, secretPhrase, name, "", overwrite, removeSource)
+	return decryptedFileName, err
+}
+
+// DecryptFileTo is like DecryptFile but the decrypted file is created with the
+// name decryptedFileName, regardless of the extension and WithOutputDir.
+// It returns an error of kind errors.Invalid if decryptedFileName is the
+// source file.
+func (d *Decrypter) DecryptFileTo(secretPhrase []byte, name, decryptedFileName string, overwrite, removeSource bool) error {
+	return d.DecryptFileToContext(context.Background(), secretPhrase, name, decryptedFileName, overwrite, removeSource)
+}
+
+// DecryptFileToContext is like DecryptFileTo but it stops as soon as ctx is
+// done, returning an error of kind errors.Canceled.
+func (d *Decrypter) DecryptFileToContext(ctx context.Context, secretPhrase []byte, name, decryptedFileName string, overwrite, removeSource bool) error {
+	if decryptedFileName == "" {
+		return errors.E(errors.Invalid, errors.Op("decrypter.DecryptFileTo"), errors.Errorf("empty file name"))
+	}
+	_, _, err := d.decryptFile(ctx, secretPhrase, name, decryptedFileName, overwrite, removeSource)
+	return err
+}
+
+// decryptFile is DecryptFileContext, it also returns the number of bytes
+// written to the decrypted file. The name of the decrypted file is derived
+// from the name of the source if decryptedFileName is empty.
+func (d *Decrypter) decryptFile(ctx context.Context, secretPhrase []byte, name, decryptedFileName string, overwrite, removeSource bool) (_ string, n int64, err error) {
 	op := errors.Op("decrypter.DecryptFile")
+	defer func() { d.fileDone(false, n, err) }()
+
+	if err = checkContext(ctx, op); err != nil {
+		return "", 0, err
+	}
 	encryptedFile, err := os.Open(name)
 	if err != nil {
-		return "", errors.E(errors.Open, op, err)
+		return "", 0, errors.E(errors.Open, op, err)
 	}
 	defer encryptedFile.Close()
 
+	size := fileSize(encryptedFile)
+	d.log(slog.LevelDebug, "file opened", "file", name, "size", size)
+
+	if decryptedFileName == "" {
+		// Get the decrypted file name removing the .celo extension.
+		if decryptedFileName, err = d.outputName(d.GetDecryptedFileName(encryptedFile)); err != nil {
+			return "", 0, err
+		}
+	}
+
+	if decryptedFileName, overwrite, err = d.collide(op, decryptedFileName, overwrite); err != nil {
+		return "", 0, err
+	}
+
+	if err = checkOutput(op, encryptedFile, decryptedFileName); err != nil {
+		return "", 0, err
+	}
+
+	unlock, err := d.lockFiles(op, encryptedFile, decryptedFileName, removeSource)
+	if err != nil {
+		return "", 0, err
+	}
+	if chunked(encryptedFile, size) {
+		n, err = d.decryptFileStreamed(ctx, secretPhrase, encryptedFile, size, name, decryptedFileName, overwrite)
+	} else {
+		n, err = d.decryptFileInMemory(ctx, secretPhrase, encryptedFile, size, name, decryptedFileName, overwrite)
+	}
+	// The source is unlocked before it is removed, locks are mandatory on
+	// Windows.
+	unlock()
+	if err != nil {
+		return "", 0, err
+	}
+	d.log(slog.LevelInfo, "file decrypted", "file", name, "output", decryptedFileName, "bytes", n)
+	d.copyTimes(encryptedFile, decryptedFileName)
+
+	// Remove source file if the operation finishes successfully.
+	if removeSource {
+		d.removeSource(name)
+	}
+
+	return decryptedFileName, n, nil
+}
+
+// decryptFileInMemory decrypts the file f of the given size, which doesn't have
+// a chunked payload, in memory and writes the plaintext to decryptedFileName.
+// It returns the number of bytes of plaintext written.
+func (d *Decrypter) decryptFileInMemory(ctx context.Context, secretPhrase []byte, f *os.File, size int64, name, decryptedFileName string, overwrite bool) (n int64, err error) {
+	op := errors.Op("decrypter.DecryptFile")
+
 	// Read source file, verify metadata and initialize current instance with
 	// salt, nonce, ciphertext values.
-	_, err = d.Read(encryptedFile)
+	_, err = d.Read(d.reader(f, name, size))
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
 	// Decrypts the content of the ciphertext generating the cipher key with the
 	// provided phrase.
-	plaintext, err := d.Decrypt(secretPhrase)
+	plaintext, err := d.decrypt(ctx, secretPhrase)
+	if err != nil {
+		return 0, err
+	}
+
+	// file.WriteAtomic handles whether the file exists and it is writable, the
+	// decrypted file only replaces decryptedFileName once it is complete.
+	var wn int
+	err = file.WriteAtomic(decryptedFileName, overwrite, d.fileMode, func(f *os.File) (err error) {
+		wn, err = d.writer(f, decryptedFileName, int64(len(plaintext))).Write(plaintext)
+		if err != nil {
+			return errors.E(errors.Create, op, err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	// Get the decrypted file name removing the .celo extension.
-	decryptedFileName = d.GetDecryptedFileName(encryptedFile)
+	return int64(wn), nil
+}
 
-	// file.Create handles whether the file exists and it is writable and returns
-	// an os.File instance ready to write on it.
-	decryptedFile, exist, err := file.Create(decryptedFileName, overwrite)
+// decryptFileStreamed decrypts the chunked file f of the given size into a
+// temporary file that replaces decryptedFileName once the whole file was
+// authenticated, so a corrupt file never results in a partially decrypted one.
+// It returns the number of bytes of plaintext written.
+func (d *Decrypter) decryptFileStreamed(ctx context.Context, secretPhrase []byte, f *os.File, size int64, name, decryptedFileName string, overwrite bool) (n int64, err error) {
+	err = file.WriteAtomic(decryptedFileName, overwrite, d.fileMode, func(tmp *os.File) (err error) {
+		n, err = d.decryptTo(ctx, secretPhrase, f, size, name, tmp)
+		return err
+	})
 	if err != nil {
-		// An error returned means that the file couldn't be created due to lack
-		// of permissions or there was an existing file with the same name and
-		// the overwrite flag is false, therefore, it shouldn't overwrite it's
-		// content.
-		return "", err
+		return 0, err
 	}
-	defer decryptedFile.Close()
 
-	_, err = decryptedFile.Write(plaintext)
+	return n, nil
+}
+
+// decryptTo decrypts the chunked file of the given size read from r and writes
+// its plaintext to w, one chunk at a time. The trailer checksum and the
+// signature are verified once everything was read, the plaintext written to w
+// must be discarded if an error is returned.
+// The progress of reading the file is reported for entity.
+// It returns the number of bytes of plaintext written.
+func (d *Decrypter) decryptTo(ctx context.Context, secretPhrase []byte, r io.ReaderAt, size int64, entity string, w io.Writer) (n int64, err error) {
+	op := errors.Op("decrypter.decryptTo")
+
+	// The ciphertext of the instance no longer matches the decoded metadata.
+	d.initialized = false
+	d.signer = nil
+	d.trailer = nil
+
+	// Everything that precedes the signature block is signed.
+	h := newSignatureHash()
+	sr := io.TeeReader(d.reader(io.NewSectionReader(r, 0, size), entity, size), h)
+
+	hn, err := d.readHeader(sr)
 	if err != nil {
-		if !exist {
-			// Remove the file when it is not possible to write in it and it
-			// didn't existed before.
-			os.Remove(decryptedFile.Name())
+		return 0, err
+	}
+
+	chunkSize := d.metadata.chunkSize()
+	if chunkSize == 0 || !d.metadata.hasFlag(flagEnvelope) {
+		return 0, errors.E(errors.Incompatible, op, errors.Errorf("the payload of the file isn't chunked"))
+	}
+
+	signed := d.metadata.hasFlag(flagSigned)
+	if !signed && d.verifyingKey != nil {
+		return 0, errors.E(errors.Sign, op, errors.Errorf("file isn't signed by %s", d.verifyingKey))
+	}
+
+	// The payload is followed by the trailer and the signature block.
+	end := size
+	if signed {
+		end -= SignatureBlockSize
+	}
+
+	var trailer []byte
+	if d.metadata.hasFlag(flagTrailer) {
+		end -= TrailerSize
+		if end < int64(hn) {
+			return 0, errors.E(errors.Truncated, op)
+		}
+
+		// A truncated file is detected before decrypting anything.
+		trailer = make([]byte, TrailerSize)
+		if _, err = r.ReadAt(trailer, end); err != nil {
+			return 0, errors.E(errors.Truncated, op, err)
+		}
+		if d.trailer, err = parseTrailer(trailer, end-int64(hn)); err != nil {
+			return 0, err
 		}
-		return "", errors.E(errors.Create, op, err)
 	}
 
-	// Remove source file if the operation finishes successfully.
-	if removeSource {
-		os.Remove(name)
+	if end < int64(hn) {
+		return 0, errors.E(errors.Truncated, op)
 	}
+	payloadSize := end - int64(hn)
 
-	return decryptedFileName, nil
+	dataKey, err := d.unwrap(ctx, secretPhrase)
+	if err != nil {
+		return 0, err
+	}
+	defer ZeroBytes(dataKey)
+
+	dataCipher, err := NewCipher(d.blockSize, d.nonceSize, dataKey)
+	if err != nil {
+		return 0, err
+	}
+
+	payload := io.LimitReader(sr, payloadSize)
+	var trailerHash hash.Hash
+	if trailer != nil {
+		if trailerHash, err = newTrailerHash(dataKey, payloadSize); err != nil {
+			return 0, err
+		}
+		payload = io.TeeReader(payload, trailerHash)
+	}
+
+	cw := &countingWriter{w: w}
+	uw := &unpadWriter{w: cw, p: d.metadata.Padding()}
+	start := time.Now()
+	if err = openChunksTo(ctx, dataCipher, payload, payloadSize, d.additionalData(d.metadata), chunkSize, uw); err != nil {
+		return 0, err
+	}
+	d.ciphered(start, uw.n)
+
+	if trailerHash != nil && !hmac.Equal(trailerHash.Sum(nil), d.trailer) {
+		return 0, errors.E(errors.Ciphertext, op, errors.Errorf("checksum mismatch"))
+	}
+
+	// The trailer was already read, it is only hashed as part of the signed
+	// content.
+	if _, err = io.CopyN(io.Discard, sr, int64(len(trailer))); err != nil {
+		return 0, errors.E(errors.Truncated, op, err)
+	}
+
+	if signed {
+		digest := h.Sum(nil)
+		block := make([]byte, SignatureBlockSize)
+		if _, err = io.ReadFull(sr, block); err != nil {
+			return 0, errors.E(errors.Sign, op, err)
+		}
+		if d.signer, err = verify(digest, block); err != nil {
+			return 0, err
+		}
+	}
+
+	if d.verifyingKey != nil && !d.verifyingKey.Equal(d.signer) {
+		return 0, errors.E(errors.Sign, op, errors.Errorf("file isn't signed by %s", d.verifyingKey))
+	}
+
+	// The padding held back is discarded if the marker was found.
+	if err = uw.Close(); err != nil {
+		return 0, err
+	}
+
+	return cw.n, nil
+}
+
+// chunked reports whether the file of the given size read from r has a chunked
+// payload, which can be decrypted without reading it in memory.
+func chunked(r io.ReaderAt, size int64) bool {
+	m, _, err := DecodeMetadata(io.NewSectionReader(r, 0, size))
+	return err == nil && m.chunkSize() > 0 && m.hasFlag(flagEnvelope)
 }
 
 // DecryptMultipleFiles decrypts a list of files with the specified names.
@@ -255,15 +897,38 @@ func (d *Decrypter) DecryptFile(secretPhrase []byte, name string, overwrite, rem
 // It returns a list of file names that were successfully decrypted and a list
 // of errors, each for a file that couldn't be decrypted.
 func (d *Decrypter) DecryptMultipleFiles(secretPhrase []byte, fileNames []string, overwrite, removeSource bool) (decryptedFileNames []string, errs []error) {
-	errs = []error{}
-	decryptedFileNames = []string{}
-	for _, eFileName := range fileNames {
-		decryptedName, err := d.DecryptFile(secretPhrase, eFileName, overwrite, removeSource)
+	return d.DecryptMultipleFilesContext(context.Background(), secretPhrase, fileNames, overwrite, removeSource)
+}
+
+// DecryptMultipleFilesContext is like DecryptMultipleFiles but it stops as soon
+// as ctx is done. Files that weren't decrypted by then are reported as errors
+// wrapping an error of kind errors.Canceled.
+func (d *Decrypter) DecryptMultipleFilesContext(ctx context.Context, secretPhrase []byte, fileNames []string, overwrite, removeSource bool) (decryptedFileNames []string, errs []error) {
+	return splitResults(d.DecryptFilesContext(ctx, secretPhrase, fileNames, overwrite, removeSource))
+}
+
+// DecryptFiles decrypts a list of files with the specified names, like
+// DecryptMultipleFiles.
+// It returns a FileResult for each file, in the same order. The Err of the
+// files that couldn't be decrypted is of kind errors.Decrypt.
+func (d *Decrypter) DecryptFiles(secretPhrase []byte, fileNames []string, overwrite, removeSource bool) []FileResult {
+	return d.DecryptFilesContext(context.Background(), secretPhrase, fileNames, overwrite, removeSource)
+}
+
+// DecryptFilesContext is like DecryptFiles but it stops as soon as ctx is
+// done. Files that weren't decrypted by then have an Err wrapping an error of
+// kind errors.Canceled.
+func (d *Decrypter) DecryptFilesContext(ctx context.Context, secretPhrase []byte, fileNames []string, overwrite, removeSource bool) []FileResult {
+	op := errors.Op("decrypter.DecryptMultipleFiles")
+
+	workers := []*Decrypter{d}
+	addWorker := func() { workers = append(workers, d.Clone()) }
+
+	return d.batch(fileNames, addWorker, func(w int, r *FileResult) (err error) {
+		r.Output, r.Bytes, err = workers[w].decryptFile(ctx, secretPhrase, r.Source, "", overwrite, removeSource)
 		if err != nil {
-			errs = append(errs, errors.E(errors.Decrypt, errors.Op("decrypter.DecryptMultipleFiles"), errors.Entity(eFileName), err))
-		} else {
-			decryptedFileNames = append(decryptedFileNames, decryptedName)
+			return errors.E(errors.Decrypt, op, errors.Entity(r.Source), err)
 		}
-	}
-	return decryptedFileNames, errs
+		return nil
+	})
 }
@@ -0,0 +1,197 @@
+package celo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestDecryptRoundTrip(t *testing.T) {
+	phrase := []byte("secret")
+	sizes := []int{0, 1, 15, 16, 17, 1000, 64*1024 - 1, 64 * 1024, 64*1024 + 1, 200 * 1000}
+
+	for _, p := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		e := NewEncrypter()
+		if err := e.Config(SetPadding(p)); err != nil {
+			t.Fatal(err)
+		}
+		d := NewDecrypter()
+
+		for _, size := range sizes {
+			plaintext := bytes.Repeat([]byte{'a'}, size)
+
+			got, err := openFile(d, phrase, sealFile(t, e, phrase, plaintext))
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, size, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%v, %d bytes: plaintext mismatch", p, size)
+			}
+		}
+	}
+}
+
+func TestDecryptWrongPhrase(t *testing.T) {
+	file := sealFile(t, NewEncrypter(), []byte("secret"), []byte("attack at dawn"))
+
+	_, err := openFile(NewDecrypter(), []byte("garbage"), file)
+	if !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+// The key generated for a phrase must not be reused for another phrase.
+func TestDecryptKeyReuse(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.celo")
+	if err := os.WriteFile(name, sealFile(t, NewEncrypter(), []byte("new"), []byte("attack at dawn")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecrypter()
+	if err := d.VerifyFile([]byte("new"), name); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.VerifyFile([]byte("garbage"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+	if err := d.VerifyFile([]byte("new"), name); err != nil {
+		t.Errorf("phrase rejected after a wrong phrase: %v", err)
+	}
+
+	// Files without metadata initialized with Init.
+	e := NewEncrypter()
+	e.Init([]byte("new"))
+	nonce, ciphertext, err := e.cipher.Encrypt([]byte("attack at dawn"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d = NewDecrypter()
+	if err = d.Init([]byte("new"), e.Salt(), nonce, ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Decrypt([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Decrypt([]byte("garbage")); !errors.Is(errors.Decrypt, err) {
+		t.Errorf("Init: got error %v, want kind Decrypt", err)
+	}
+}
+
+func TestDecryptFileStreamed(t *testing.T) {
+	k, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	sizes := []int{0, 1, testChunkSize - 1, testChunkSize, testChunkSize + 1, 3*testChunkSize + 5}
+
+	for _, p := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		e := NewEncrypter()
+		if err = e.Config(SetPadding(p), SignWith(k)); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, size := range sizes {
+			// Plaintexts ending like the padding must be kept as is.
+			for _, plaintext := range [][]byte{
+				randomPlaintext(size),
+				make([]byte, size),
+				append(randomPlaintext(size), paddingMarker, 0, 0),
+			} {
+				name := filepath.Join(dir, "plain.celo")
+				if err = os.WriteFile(name, sealFile(t, e, []byte("secret"), plaintext), 0600); err != nil {
+					t.Fatal(err)
+				}
+
+				d := NewDecrypter()
+				d.Config(VerifyWith(k.Public()))
+				decryptedName, err := d.DecryptFile([]byte("secret"), name, true, false)
+				if err != nil {
+					t.Fatalf("%v, %d bytes: %v", p, len(plaintext), err)
+				}
+				got, err := os.ReadFile(decryptedName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, plaintext) {
+					t.Errorf("%v, %d bytes: round trip mismatch", p, len(plaintext))
+				}
+				if !d.Signer().Equal(k.Public()) {
+					t.Errorf("%v, %d bytes: signer %v, want %v", p, len(plaintext), d.Signer(), k.Public())
+				}
+			}
+		}
+	}
+}
+
+func TestDecryptFileStreamedErrors(t *testing.T) {
+	k, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	if err = e.Config(SignWith(k)); err != nil {
+		t.Fatal(err)
+	}
+	sealed := sealFile(t, e, []byte("secret"), randomPlaintext(3*testChunkSize+5))
+	signatureStart := len(sealed) - SignatureBlockSize
+	lastChunk := signatureStart - TrailerSize - 10
+
+	corrupt := func(i int) []byte {
+		b := bytes.Clone(sealed)
+		b[i] ^= 1
+		return b
+	}
+
+	tests := []struct {
+		name   string
+		file   []byte
+		phrase string
+		verify *VerifyingKey
+		kind   errors.Kind
+	}{
+		{"last chunk", corrupt(lastChunk), "secret", nil, errors.Ciphertext},
+		{"checksum", corrupt(signatureStart - 1), "secret", nil, errors.Ciphertext},
+		{"signature", corrupt(len(sealed) - 1), "secret", nil, errors.Sign},
+		{"truncated", sealed[:lastChunk], "secret", nil, errors.Truncated},
+		{"wrong phrase", sealed, "garbage", nil, errors.WrongPassphrase},
+		{"wrong signer", sealed, "secret", other.Public(), errors.Sign},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		name := filepath.Join(dir, "plain.celo")
+		if err = os.WriteFile(name, tt.file, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// The existing file must be kept as is.
+		decryptedName := filepath.Join(dir, "plain")
+		if err = os.WriteFile(decryptedName, []byte("existing"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewDecrypter()
+		if tt.verify != nil {
+			d.Config(VerifyWith(tt.verify))
+		}
+		if _, err = d.DecryptFile([]byte(tt.phrase), name, true, true); !errors.Is(tt.kind, err) {
+			t.Errorf("%s: got error %v, want kind %v", tt.name, err, tt.kind)
+		}
+
+		if b, _ := os.ReadFile(decryptedName); string(b) != "existing" {
+			t.Errorf("%s: existing file modified", tt.name)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+			t.Errorf("%s: %d files in the directory, want 2", tt.name, len(entries))
+		}
+	}
+}
@@ -7,7 +7,7 @@
 //
 // Celo uses argon2 for key generation from a phrase with a random salt on every
 // encryption. Even when the same phrase is used twice or more, a different key
-// is generated.
+// is generated. The argon2id parameters can be changed with SetKDFParams.
 //
 // Celo as library
 //
@@ -23,7 +23,9 @@
 //
 // book_draft.md.celo contains everything needed to decrypt it back, including:
 //  - Metadata such as version, sizes of salt, nonce, cipher block.
-//  - Salt used to generate the key.
+//  - Recipients: the random data key wrapped with the key generated from
+//    each phrase, along with the salt and the argon2id parameters used to
+//    generate it.
 //  - Nonce used at encryption.
 //
 // Example:
@@ -1,29 +1,59 @@
 package celo
 
 import (
+	"context"
+	"crypto/sha256"
+	"hash"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/rrivera/celo/errors"
 	"github.com/rrivera/celo/file"
 )
 
 // Encrypter encrypts and encodes files and sources.
+// An Encrypter isn't safe for concurrent use since it keeps the values of the
+// last encrypted file, use Clone to get an instance per goroutine.
 type Encrypter struct {
 	celo
+
+	// archive marks the files encrypted as archives (See EncryptDir).
+	archive bool
 }
 
 // NewEncrypter creates a Encrypter with package's default configurations.
 func NewEncrypter() *Encrypter {
-	return &Encrypter{
+	e := &Encrypter{
 		celo: celo{
-			metadata:  newCurrentMetadata(),
 			saltSize:  SaltSize,
 			blockSize: Aes256BlockSize,
 			nonceSize: NonceSize,
+			kdf:       DefaultKDFParams(),
 			ext:       Extension,
+			fileMode:  EncryptedFileMode,
 		},
 	}
+	e.metadata = newCurrentMetadata(PaddingNone, &e.celo)
+	return e
+}
+
+// PlaintextSHA256 returns the SHA-256 of the plaintext of the last file
+// encrypted by EncryptFile or EncryptFileTo, nil unless DigestPlaintext is
+// used or if the file couldn't be encrypted.
+func (e *Encrypter) PlaintextSHA256() []byte {
+	return e.plaintextSum
+}
+
+// Clone returns a new Encrypter with the same configuration that can be used
+// concurrently with e. Only the configuration is shared, every file encrypted
+// by a clone gets its own salt and key, unless PreserveKey is set: then the
+// last key generated by e is shared and reused for the same phrase.
+func (e *Encrypter) Clone() *Encrypter {
+	return &Encrypter{celo: e.celo.clone()}
 }
 
 // Init initialized an Encrypter instance by specifying a secret phrase that
@@ -31,68 +61,312 @@ func NewEncrypter() *Encrypter {
 // It returns an error the cipher is not created.
 // It marks the instance as initialized (Ready to encrypt).
 func (e *Encrypter) Init(secretPhrase []byte) (err error) {
-	if e.initialized && e.preserveKey {
-		// When the instance has been initialized before AND the preserveKey
-		// flag is on, there is no need to change the key, therefore, the cipher
-		// instance can be re-used.
+	return e.init(context.Background(), secretPhrase)
+}
+
+// init is Init, the key generation is abandoned if ctx is done.
+func (e *Encrypter) init(ctx context.Context, secretPhrase []byte) (err error) {
+	if e.preserveKey && e.keyMatches(secretPhrase) {
+		// When the key was generated before from the same phrase AND the
+		// preserveKey flag is on, there is no need to change the key,
+		// therefore, the cipher instance can be re-used.
+		e.log(slog.LevelDebug, "key reused")
 		return nil
 	}
 
-	// Mark the Encrypter as initialized.
-	e.initialized = true
+	if e.preserveKey {
+		// The key might have been generated by another instance that shares
+		// the cache.
+		salt, cipher := e.keys.preserved(secretPhrase, e.kdf)
+		if cipher != nil && len(salt) == e.saltSize && cipher.BlockSize() == e.blockSize && cipher.NonceSize() == e.nonceSize {
+			e.salt = salt
+			e.setCipher(cipher, secretPhrase)
+			e.initialized = true
+			e.log(slog.LevelDebug, "key reused")
+			return nil
+		}
+	}
 
 	// Salt should be randomized on every request unless preserveKey flag is on.
-	e.salt, _, err = NewSalt(e.saltSize)
+	salt, _, err := NewSalt(e.saltSize)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	key, err := e.generateKey(ctx, secretPhrase, salt)
 	if err != nil {
 		return err
 	}
+	e.log(slog.LevelDebug, "key derived", "duration", time.Since(start))
+	e.keyDerived(start)
 
 	// Cipher must be re-created every time the salt changes.
-	cipher, err := NewCipher(
-		e.blockSize,
-		e.nonceSize,
-		GenerateKey(secretPhrase, e.salt, uint32(e.blockSize)),
-	)
+	cipher, err := NewCipher(e.blockSize, e.nonceSize, key)
+	// The cipher keeps its own copy of the key.
+	ZeroBytes(key)
 	if err != nil {
 		return err
 	}
 
-	// Assign cipher once error validation has passed.
-	e.cipher = cipher
+	// Assign salt and cipher once error validation has passed, a canceled
+	// initialization doesn't leave a cipher that doesn't match the salt.
+	e.salt = salt
+	e.setCipher(cipher, secretPhrase)
+	e.keys.put(e.keyDigest, salt, cipher)
+	if e.preserveKey {
+		e.keys.preserve(secretPhrase, e.kdf, e.keyDigest)
+	}
 
-	return err
+	// Mark the Encrypter as initialized.
+	e.initialized = true
+
+	return nil
 }
 
-// Encrypt encrypts plaintext using previously stored salt and nonce values and
-// the provided phrase (that generates the AES GCM key).
+// Encrypt encrypts plaintext with a random data key, which is wrapped with the
+// key generated from the provided phrase and for every recipient added with
+// AddRecipient.
+//
+// The phrase can be empty only if at least one recipient was added, in which
+// case the data key is only wrapped for the recipients.
 //
 // It returns the ciphertext as an array of bytes if the encryption success.
 // It will initialize the instance with a new cipher.
-// It returns an error if the decryption process fails.
+// It returns an error if the encryption process fails.
 func (e *Encrypter) Encrypt(secretPhrase []byte, plaintext []byte) (ciphertext []byte, err error) {
-	// Initialize Encrypter by generating a Salt -> generate a key -> to create
-	// a cipher.
-	err = e.Init(secretPhrase)
+	return e.encrypt(context.Background(), secretPhrase, plaintext)
+}
+
+// encrypt is Encrypt, it stops as soon as ctx is done.
+func (e *Encrypter) encrypt(ctx context.Context, secretPhrase []byte, plaintext []byte) (ciphertext []byte, err error) {
+	metadata, stanzas, dataKey, err := e.newEnvelope(ctx, secretPhrase)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(dataKey)
+
+	dataCipher, err := NewCipher(e.blockSize, e.nonceSize, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err = Pad(plaintext, e.padding)
 	if err != nil {
 		return nil, err
 	}
 
-	var nonce []byte
-	nonce, e.ciphertext, err = e.cipher.Encrypt(plaintext, nil)
+	// The file signature is authenticated along with each chunk so any change
+	// to it (e.g. the padding scheme) is detected on decryption. Every chunk
+	// has its own nonce.
+	start := time.Now()
+	ciphertext, err = sealChunks(ctx, dataCipher, plaintext, e.additionalData(metadata), metadata.chunkSize())
 	if err != nil {
 		// AES GCM failed to encrypt the plaintext.
 		return nil, err
 	}
+	e.ciphered(start, int64(len(plaintext)))
+
+	trailer, err := newTrailer(dataKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
 
-	// Save the generated nonce to the Encrypter instance so it can be attached
-	// to the file in the encoding process.
-	e.nonce = nonce
+	// Save the generated values to the Encrypter instance so they can be
+	// attached to the file in the encoding process.
+	e.metadata = metadata
+	e.stanzas = stanzas
+	e.nonce = nil
+	e.ciphertext = ciphertext
+	e.trailer = trailer
+	e.initialized = true
 
 	return e.ciphertext, nil
 }
 
-// Encode encodes metadata, salt, nonce and the ciphertext to an io.Writer in a
-// way that it can be parsed back to a Decrypter instance.
+// newEnvelope generates the metadata and a random data key for a new file, and
+// wraps the data key with the key generated from the provided phrase and for
+// every recipient.
+func (e *Encrypter) newEnvelope(ctx context.Context, secretPhrase []byte) (metadata *Metadata, stanzas []*Stanza, dataKey []byte, err error) {
+	op := errors.Op("encrypter.Encrypt")
+
+	// The padding scheme is recorded in the file signature so that it can be
+	// stripped on decryption.
+	metadata = newCurrentMetadata(e.padding, &e.celo)
+	if e.signingKey != nil {
+		metadata.setFlag(flagSigned)
+	}
+	if e.archive {
+		metadata.setFlag(flagArchive)
+	}
+
+	dataKey, err = newDataKey(e.blockSize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The data key is zeroed if it isn't returned.
+	defer func() {
+		if err != nil {
+			ZeroBytes(dataKey)
+		}
+	}()
+
+	stanzas = []*Stanza{}
+
+	if len(secretPhrase) > 0 || len(e.recipients) == 0 {
+		// Initialize Encrypter by generating a Salt -> generate a key -> to
+		// create the cipher that wraps the data key.
+		err = e.init(ctx, secretPhrase)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		s, err := wrapPhrase(StanzaPhraseKDF, e.kdf, e.salt, e.cipher, dataKey, metadata)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		stanzas = append(stanzas, s)
+	}
+
+	for _, r := range e.recipients {
+		// Wrapping for a phrase recipient generates a key.
+		if err = checkContext(ctx, op); err != nil {
+			return nil, nil, nil, err
+		}
+
+		var s *Stanza
+		if pr, ok := r.(*PhraseRecipient); ok {
+			// Phrase recipients use the parameters of the instance.
+			s, err = wrapWithPhrase(StanzaPhraseKDF, e.kdf, pr.secretPhrase, dataKey, metadata)
+		} else {
+			s, err = r.Wrap(dataKey, metadata)
+		}
+		if err != nil {
+			return nil, nil, nil, errors.E(errors.Encrypt, op, err)
+		}
+		stanzas = append(stanzas, s)
+	}
+
+	if len(stanzas) > MaxRecipients {
+		return nil, nil, nil, errors.E(errors.Invalid, op, errors.Errorf("too many recipients"))
+	}
+
+	return metadata, stanzas, dataKey, nil
+}
+
+// encryptFrom encrypts the size bytes read from r and encodes the file to w as
+// Write does, one chunk at a time, so memory usage doesn't depend on size.
+// If size is negative, everything is read from r: the payload is sealed to a
+// temporary file before anything is written to w.
+// Progress of writing is reported for the file entity.
+// Nothing is kept to encode the file again: Write fails until the next
+// encryption.
+// It returns the number of bytes written.
+func (e *Encrypter) encryptFrom(ctx context.Context, secretPhrase []byte, r io.Reader, size int64, w io.Writer, entity string) (n int64, err error) {
+	op := errors.Op("encrypter.EncryptFile")
+
+	metadata, stanzas, dataKey, err := e.newEnvelope(ctx, secretPhrase)
+	if err != nil {
+		return 0, err
+	}
+	defer ZeroBytes(dataKey)
+
+	dataCipher, err := NewCipher(e.blockSize, e.nonceSize, dataKey)
+	if err != nil {
+		return 0, err
+	}
+
+	// The trailer checksum starts with the size of the payload, a plaintext
+	// of unknown size is sealed to a temporary file first.
+	var sealed *os.File
+	var paddedSize int64
+	if size >= 0 {
+		paddedSize = PaddedSize(size, e.padding)
+	} else {
+		var remove func()
+		if sealed, remove, err = createSpool(); err != nil {
+			return 0, err
+		}
+		defer remove()
+
+		start := time.Now()
+		if paddedSize, err = sealStreamTo(ctx, dataCipher, padStreamReader(r, e.padding), e.additionalData(metadata), metadata.chunkSize(), sealed); err != nil {
+			return 0, err
+		}
+		e.ciphered(start, paddedSize)
+
+		if _, err = sealed.Seek(0, io.SeekStart); err != nil {
+			return 0, errors.E(errors.Encode, op, err)
+		}
+	}
+	payloadSize := sealedSize(paddedSize, metadata.chunkSize(), dataCipher.NonceSize())
+
+	// The values of the previous file can't be encoded with the new metadata.
+	e.metadata = metadata
+	e.stanzas = nil
+	e.nonce = nil
+	e.ciphertext = nil
+	e.trailer = nil
+
+	total := encodedSize(metadata, stanzas, payloadSize)
+	cw := &countingWriter{w: e.writer(w, entity, total)}
+	w = cw
+
+	// Everything that precedes the signature block is signed.
+	out := w
+	h := newSignatureHash()
+	if metadata.hasFlag(flagSigned) {
+		w = io.MultiWriter(w, h)
+	}
+
+	if _, err = w.Write(metadata.Bytes()); err != nil {
+		return cw.n, errors.E(errors.Encode, op, err)
+	}
+	if _, err = writeStanzas(w, stanzas); err != nil {
+		return cw.n, err
+	}
+
+	th, err := newTrailerHash(dataKey, payloadSize)
+	if err != nil {
+		return cw.n, err
+	}
+
+	if sealed != nil {
+		if _, err = io.Copy(io.MultiWriter(w, th), sealed); err != nil {
+			return cw.n, errors.E(errors.Encode, op, err)
+		}
+	} else {
+		// The file signature is authenticated along with each chunk (See
+		// Encrypter.Encrypt).
+		plaintext := padReader(r, size, e.padding)
+		start := time.Now()
+		if err = sealChunksTo(ctx, dataCipher, plaintext, paddedSize, e.additionalData(metadata), metadata.chunkSize(), io.MultiWriter(w, th)); err != nil {
+			return cw.n, err
+		}
+		e.ciphered(start, paddedSize)
+	}
+
+	if _, err = w.Write(encodeTrailer(payloadSize, th.Sum(nil))); err != nil {
+		return cw.n, errors.E(errors.Encode, op, err)
+	}
+
+	if metadata.hasFlag(flagSigned) {
+		block, err := e.signingKey.sign(h.Sum(nil))
+		if err != nil {
+			return cw.n, err
+		}
+		if _, err = out.Write(block); err != nil {
+			return cw.n, errors.E(errors.Encode, op, err)
+		}
+	}
+
+	return cw.n, nil
+}
+
+// Encode encodes metadata, recipients, nonce, the ciphertext and the signature
+// (if any) to an io.Writer in a way that it can be parsed back to a Decrypter
+// instance.
 // It returns the number of bytes written.
 // It returns an error if the Encrypter is not ready (not initialized).
 // It returns an error if the source is not writeable.
@@ -101,49 +375,140 @@ func (e *Encrypter) Encode(w io.Writer) (n int, err error) {
 	return e.Write(w)
 }
 
-// Write encodes metadata, salt, nonce and the ciphertext to an io.Writer in a
-// way that it can be parsed back to a Decrypter instance.
+// Write encodes metadata, recipients, nonce, the ciphertext and the signature
+// (if any) to an io.Writer in a way that it can be parsed back to a Decrypter
+// instance.
 // It returns the number of bytes written.
 // It returns an error if the Encrypter is not ready (not initialized).
 // It returns an error if the source is not writeable.
 func (e *Encrypter) Write(w io.Writer) (n int, err error) {
 	op := errors.Op("encrypter.Write")
 
-	if !e.IsReady() {
-		// Encrypter needs to be initialized before, which means that the salt,
-		// cipher and nonce shouldn't be nil.
+	if !e.IsReady() || e.stanzas == nil {
+		// Encrypter needs to be initialized before, which means that the
+		// stanzas, cipher and nonce shouldn't be nil.
 		return 0, errors.E(errors.NotReady, op)
 	}
 
 	// Keep track of the number of bytes written at any point.
-	var sn, nn, cn int
+	var sn, rn, nn, cn, tn, gn int
 
-	if sn, err := w.Write(e.metadata.Bytes()); err != nil {
+	signed := e.metadata.hasFlag(flagSigned)
+	if signed && e.signingKey == nil {
+		// The signing key was removed after the encryption.
+		return 0, errors.E(errors.Sign, op)
+	}
+
+	// Everything that precedes the signature block is signed.
+	out := w
+	h := newSignatureHash()
+	if signed {
+		w = io.MultiWriter(w, h)
+	}
+
+	if sn, err = w.Write(e.metadata.Bytes()); err != nil {
 		// The metadata includes File Signutere along with version and sizes
 		// specified in the first 32 bytes.
 		return sn, errors.E(errors.Encode, op, err)
 	}
+	n += sn
 
-	// Salt is required to generate the key for decryption, it needs to be
-	// attached to the file.
-	if n, err := w.Write(e.salt); err != nil {
-		return n + sn, errors.E(errors.Encode, op, err)
+	// The recipients section contains the data key wrapped for each recipient,
+	// it is required to decrypt the ciphertext.
+	if rn, err = writeStanzas(w, e.stanzas); err != nil {
+		return n + rn, err
 	}
-	n += sn
+	n += rn
 
-	// Nonce is required to decrypt the ciphertext, it needs to be attached
-	// to the file.
-	if nn, err := w.Write(e.nonce); err != nil {
-		return n + nn, errors.E(errors.Encode, op, err)
+	if !e.metadata.hasFlag(flagChunked) {
+		// Nonce is required to decrypt the ciphertext, it needs to be attached
+		// to the file. Chunked payloads include a nonce per chunk instead.
+		if nn, err = w.Write(e.nonce); err != nil {
+			return n + nn, errors.E(errors.Encode, op, err)
+		}
+		n += nn
 	}
-	n += nn
 
-	// The ciphertext is the last chunk of bytes written to the file.
-	if cn, err := w.Write(e.ciphertext); err != nil {
+	if cn, err = w.Write(e.ciphertext); err != nil {
 		return n + cn, errors.E(errors.Encode, op, err)
 	}
+	n += cn
+
+	if e.metadata.hasFlag(flagTrailer) {
+		// The trailer allows detecting truncated files before decrypting them.
+		if tn, err = w.Write(e.trailer); err != nil {
+			return n + tn, errors.E(errors.Encode, op, err)
+		}
+		n += tn
+	}
+
+	if !signed {
+		return n, nil
+	}
+
+	block, err := e.signingKey.sign(h.Sum(nil))
+	if err != nil {
+		return n, err
+	}
+
+	if gn, err = out.Write(block); err != nil {
+		return n + gn, errors.E(errors.Encode, op, err)
+	}
+
+	return n + gn, nil
+}
+
+// WriteTo is Write for the io.WriterTo interface, so the encoded file can be
+// written wherever an io.WriterTo is accepted.
+func (e *Encrypter) WriteTo(w io.Writer) (n int64, err error) {
+	nn, err := e.Write(w)
+	return int64(nn), err
+}
+
+// encodedSize returns the number of bytes written by Write.
+func (e *Encrypter) encodedSize() int64 {
+	payloadSize := int64(len(e.ciphertext))
+	if !e.metadata.hasFlag(flagChunked) {
+		payloadSize += int64(len(e.nonce))
+	}
+	return encodedSize(e.metadata, e.stanzas, payloadSize)
+}
+
+// encodedSize returns the size of a file with the metadata m, the stanzas and
+// a payload of payloadSize bytes, including the nonce of payloads that aren't
+// chunked.
+func encodedSize(m *Metadata, stanzas []*Stanza, payloadSize int64) int64 {
+	n := int64(m.Size()) + 1
+	for _, s := range stanzas {
+		n += 3 + int64(len(s.Body))
+	}
+	n += payloadSize
+	if m.hasFlag(flagTrailer) {
+		n += TrailerSize
+	}
+	if m.hasFlag(flagSigned) {
+		n += SignatureBlockSize
+	}
+	return n
+}
 
-	return n + cn, nil
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// OutputName returns the name of the file EncryptFile creates from the
+// source name: the name with the extension, in the output directory if one
+// was set (See WithOutputDir). The output directory isn't created.
+func (e *Encrypter) OutputName(name string) string {
+	return e.outputPath(e.encryptedName(name))
 }
 
 // EncryptFile encrypts a file with the specified name. It requires the secret
@@ -151,60 +516,144 @@ func (e *Encrypter) Write(w io.Writer) (n int, err error) {
 // It returns the name of the encrypted file or an error.
 // If a file with the same name as the encrypted file exists, overwrite has
 // to be `true` in order to overwrite the content of the file.
+// The encrypted file is written to a temporary file in the same directory,
+// which replaces it once it is complete, so an interrupted encryption never
+// leaves a partially written file behind. It is created with
+// EncryptedFileMode permissions unless SetFileMode is used.
 func (e *Encrypter) EncryptFile(secretPhrase []byte, name string, overwrite, removeSource bool) (encryptedName string, err error) {
+	return e.EncryptFileContext(context.Background(), secretPhrase, name, overwrite, removeSource)
+}
+
+// EncryptFileContext is like EncryptFile but it stops as soon as ctx is done,
+// returning an error of kind errors.Canceled. The encrypted file isn't created
+// if ctx is done before the encryption finishes.
+func (e *Encrypter) EncryptFileContext(ctx context.Context, secretPhrase []byte, name string, overwrite, removeSource bool) (encryptedName string, err error) {
+	encryptedName, _, err = e.encryptFile(ctx, secretPhrase, name, "", overwrite, removeSource)
+	return encryptedName, err
+}
+
+// EncryptFileTo is like EncryptFile but the encrypted file is created with the
+// name encryptedName, regardless of the extension and WithOutputDir.
+// It returns an error of kind errors.Invalid if encryptedName is the source
+// file.
+func (e *Encrypter) EncryptFileTo(secretPhrase []byte, name, encryptedName string, overwrite, removeSource bool) error {
+	return e.EncryptFileToContext(context.Background(), secretPhrase, name, encryptedName, overwrite, removeSource)
+}
+
+// EncryptFileToContext is like EncryptFileTo but it stops as soon as ctx is
+// done, returning an error of kind errors.Canceled.
+func (e *Encrypter) EncryptFileToContext(ctx context.Context, secretPhrase []byte, name, encryptedName string, overwrite, removeSource bool) error {
+	if encryptedName == "" {
+		return errors.E(errors.Invalid, errors.Op("encrypter.EncryptFileTo"), errors.Errorf("empty file name"))
+	}
+	_, _, err := e.encryptFile(ctx, secretPhrase, name, encryptedName, overwrite, removeSource)
+	return err
+}
+
+// encryptFile is EncryptFileContext, it also returns the number of bytes
+// written to the encrypted file. The name of the encrypted file is derived from
+// the name of the source if encryptedName is empty.
+func (e *Encrypter) encryptFile(ctx context.Context, secretPhrase []byte, name, encryptedName string, overwrite, removeSource bool) (_ string, n int64, err error) {
 	op := errors.Op("encrypter.EncryptFile")
+	defer func() { e.fileDone(true, n, err) }()
+	e.plaintextSum = nil
+
+	if err = checkContext(ctx, op); err != nil {
+		return "", 0, err
+	}
 
 	sourceFile, err := os.Open(name)
 	if err != nil {
-		return "", errors.E(errors.Open, op, err)
+		return "", 0, errors.E(errors.Open, op, err)
 	}
 	defer sourceFile.Close()
 
-	// Read the content of the file that will be encrypted.
-	plaintext, err := io.ReadAll(sourceFile)
-	if err != nil {
-		return "", errors.E(errors.Plaintext, op, err)
+	size := fileSize(sourceFile)
+	e.log(slog.LevelDebug, "file opened", "file", name, "size", size)
+
+	if encryptedName == "" {
+		// Get the encrypted file name adding the .celo extension.
+		if encryptedName, err = e.outputName(e.GetEncryptedFileName(sourceFile)); err != nil {
+			return "", 0, err
+		}
 	}
 
-	// Encrypt the file using a secret phrase to generate the encryption key.
-	// Salt and Nonce will be randomly generated in the encryption process
-	// unless preserveKey flag is off and they were initialized before.
-	_, err = e.Encrypt(secretPhrase, plaintext)
-	if err != nil {
-		return "", err
+	if encryptedName, overwrite, err = e.collide(op, encryptedName, overwrite); err != nil {
+		return "", 0, err
 	}
 
-	// Get the encrypted file name adding the .celo extension.
-	encryptedName = e.GetEncryptedFileName(sourceFile)
+	if err = checkOutput(op, sourceFile, encryptedName); err != nil {
+		return "", 0, err
+	}
 
-	// file.Create handles whether the file exists and it is writable and returns
-	// an os.File instance ready to write on it.
-	encryptedFile, exist, err := file.Create(encryptedName, overwrite)
+	unlock, err := e.lockFiles(op, sourceFile, encryptedName, removeSource)
 	if err != nil {
-		// An error returned means that the file couldn't be created due to lack
-		// of permissions or there was an existing file with the same name and
-		// the overwrite flag is false, therefore, it shouldn't overwrite it's
-		// content.
-		return "", err
+		return "", 0, err
 	}
-	defer encryptedFile.Close()
-
-	_, err = e.Write(encryptedFile)
+	n, err = e.encryptTo(ctx, secretPhrase, sourceFile, name, size, encryptedName, overwrite)
+	// The source is unlocked before it is removed, locks are mandatory on
+	// Windows.
+	unlock()
 	if err != nil {
-		if !exist {
-			// Remove the file when it is not possible to write in it and it
-			// didn't existed before.
-			os.Remove(encryptedFile.Name())
-		}
-		return "", err
+		return "", 0, err
 	}
+	e.log(slog.LevelInfo, "file encrypted", "file", name, "output", encryptedName, "bytes", n)
+	e.copyTimes(sourceFile, encryptedName)
 
 	// Remove source file if the operation finishes successfully.
 	if removeSource {
-		os.Remove(name)
+		e.removeSource(name)
 	}
 
-	return encryptedName, nil
+	return encryptedName, n, nil
+}
+
+// encryptTo encrypts the content read from r, the file entity of size bytes,
+// to a file with the name encryptedName. The content is streamed through the
+// cipher one chunk at a time.
+// It returns the number of bytes written.
+// It returns an error of kind errors.Plaintext if r doesn't have size bytes,
+// e.g. the file changed while it was encrypted.
+func (e *Encrypter) encryptTo(
+	ctx context.Context,
+	secretPhrase []byte,
+	r io.Reader,
+	entity string,
+	size int64,
+	encryptedName string,
+	overwrite bool,
+) (n int64, err error) {
+	op := errors.Op("encrypter.EncryptFile")
+
+	// file.WriteAtomic handles whether the file exists and it is writable, the
+	// encrypted file only replaces encryptedName once it is complete.
+	err = file.WriteAtomic(encryptedName, overwrite, e.fileMode, func(f *os.File) error {
+		// Encrypt the file using a secret phrase to generate the encryption
+		// key. Salt and Nonce will be randomly generated in the encryption
+		// process unless preserveKey flag is on and the key was generated
+		// before.
+		source := e.reader(r, entity, size)
+		var h hash.Hash
+		if e.digestPlaintext {
+			h = sha256.New()
+			source = io.TeeReader(source, h)
+		}
+		if n, err = e.encryptFrom(ctx, secretPhrase, source, size, f, encryptedName); err != nil {
+			return err
+		}
+		if extra, _ := source.Read(make([]byte, 1)); extra > 0 {
+			return errors.E(errors.Plaintext, op, errors.Errorf("the file grew while it was encrypted"))
+		}
+		if h != nil {
+			e.plaintextSum = h.Sum(nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
 }
 
 // EncryptMultipleFiles encrypts a list of files with the specified names.
@@ -219,18 +668,166 @@ func (e *Encrypter) EncryptMultipleFiles(
 	overwrite,
 	removeSource bool,
 ) (encryptedFileNames []string, errs []error) {
+	return e.EncryptMultipleFilesContext(context.Background(), secretPhrase, fileNames, overwrite, removeSource)
+}
+
+// EncryptMultipleFilesContext is like EncryptMultipleFiles but it stops as soon
+// as ctx is done. Files that weren't encrypted by then are reported as errors
+// wrapping an error of kind errors.Canceled.
+func (e *Encrypter) EncryptMultipleFilesContext(
+	ctx context.Context,
+	secretPhrase []byte,
+	fileNames []string,
+	overwrite,
+	removeSource bool,
+) (encryptedFileNames []string, errs []error) {
+	return splitResults(e.EncryptFilesContext(ctx, secretPhrase, fileNames, overwrite, removeSource))
+}
+
+// EncryptFiles encrypts a list of files with the specified names, like
+// EncryptMultipleFiles.
+// It returns a FileResult for each file, in the same order. The Err of the
+// files that couldn't be encrypted is of kind errors.Encrypt.
+func (e *Encrypter) EncryptFiles(secretPhrase []byte, fileNames []string, overwrite, removeSource bool) []FileResult {
+	return e.EncryptFilesContext(context.Background(), secretPhrase, fileNames, overwrite, removeSource)
+}
+
+// EncryptFilesContext is like EncryptFiles but it stops as soon as ctx is
+// done. Files that weren't encrypted by then have an Err wrapping an error of
+// kind errors.Canceled.
+func (e *Encrypter) EncryptFilesContext(
+	ctx context.Context,
+	secretPhrase []byte,
+	fileNames []string,
+	overwrite,
+	removeSource bool,
+) []FileResult {
+	op := errors.Op("encrypter.EncryptMultipleFiles")
+
+	workers := []*Encrypter{e}
+	addWorker := func() { workers = append(workers, e.Clone()) }
+
+	return e.batch(fileNames, addWorker, func(w int, r *FileResult) (err error) {
+		r.Output, r.Bytes, err = workers[w].encryptFile(ctx, secretPhrase, r.Source, "", overwrite, removeSource)
+		if err != nil {
+			return errors.E(errors.Encrypt, op, errors.Entity(r.Source), err)
+		}
+		r.PlaintextSHA256 = workers[w].plaintextSum
+		return nil
+	})
+}
+
+// EncryptFS encrypts the files of fsys matching pattern (See fs.Glob), e.g.
+// the files of an embed.FS, a zip archive or an in-memory file system.
+// Directories are skipped.
+// Encrypted files are written to the directory dir of the OS file system,
+// keeping their path within fsys. Missing subdirectories are created.
+// If a file with the same name as the encrypted file exists, overwrite has
+// to be true in order to replace the content of the file.
+// It returns a list of file names that were successfully encrypted and a list
+// of errors, each for a file that couldn't be encrypted.
+func (e *Encrypter) EncryptFS(
+	secretPhrase []byte,
+	fsys fs.FS,
+	pattern,
+	dir string,
+	overwrite bool,
+) (encryptedFileNames []string, errs []error) {
+	return e.EncryptFSContext(context.Background(), secretPhrase, fsys, pattern, dir, overwrite)
+}
+
+// EncryptFSContext is like EncryptFS but it stops as soon as ctx is done.
+// Files that weren't encrypted by then are reported as errors wrapping an
+// error of kind errors.Canceled.
+func (e *Encrypter) EncryptFSContext(
+	ctx context.Context,
+	secretPhrase []byte,
+	fsys fs.FS,
+	pattern,
+	dir string,
+	overwrite bool,
+) (encryptedFileNames []string, errs []error) {
+	op := errors.Op("encrypter.EncryptFS")
+
 	errs = []error{}
 	encryptedFileNames = []string{}
-	for _, sourceFile := range fileNames {
-		encryptedName, err := e.EncryptFile(secretPhrase, sourceFile, overwrite, removeSource)
-		if err != nil {
-			errs = append(
-				errs,
-				errors.E(errors.Encrypt, errors.Op("encrypter.EncryptMultipleFiles"), errors.Entity(sourceFile), err))
-		} else {
-			encryptedFileNames = append(encryptedFileNames, encryptedName)
+
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return encryptedFileNames, append(errs, errors.E(errors.Pattern, op, err))
+	}
+
+	workers := []*Encrypter{e}
+	addWorker := func() { workers = append(workers, e.Clone()) }
+
+	results := e.batch(names, addWorker, func(w int, r *FileResult) (err error) {
+		r.Output, r.Bytes, err = workers[w].encryptFSFile(ctx, secretPhrase, fsys, r.Source, dir, overwrite)
+		return err
+	})
+
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			errs = append(errs, errors.E(errors.Encrypt, op, errors.Entity(r.Source), r.Err))
+		case r.Output != "":
+			encryptedFileNames = append(encryptedFileNames, r.Output)
 		}
 	}
 
 	return encryptedFileNames, errs
 }
+
+// encryptFSFile encrypts the file of fsys with the specified name to dir.
+// It returns the number of bytes written, and an empty name if the file is a
+// directory.
+func (e *Encrypter) encryptFSFile(
+	ctx context.Context,
+	secretPhrase []byte,
+	fsys fs.FS,
+	name,
+	dir string,
+	overwrite bool,
+) (encryptedName string, n int64, err error) {
+	op := errors.Op("encrypter.EncryptFS")
+	defer func() {
+		// Directories aren't counted.
+		if encryptedName != "" || err != nil {
+			e.fileDone(true, n, err)
+		}
+	}()
+
+	if err = checkContext(ctx, op); err != nil {
+		return "", 0, err
+	}
+
+	sourceFile, err := fsys.Open(name)
+	if err != nil {
+		return "", 0, errors.E(errors.Open, op, err)
+	}
+	defer sourceFile.Close()
+
+	fi, err := sourceFile.Stat()
+	if err != nil {
+		return "", 0, errors.E(errors.Open, op, err)
+	}
+	if fi.IsDir() {
+		return "", 0, nil
+	}
+
+	encryptedName = e.encryptedName(filepath.Join(dir, filepath.FromSlash(name)))
+	if err = os.MkdirAll(filepath.Dir(encryptedName), 0755); err != nil {
+		return "", 0, errors.E(errors.Create, op, err)
+	}
+
+	if encryptedName, overwrite, err = e.collide(op, encryptedName, overwrite); err != nil {
+		return "", 0, err
+	}
+
+	n, err = e.encryptTo(ctx, secretPhrase, sourceFile, name, fi.Size(), encryptedName, overwrite)
+	if err != nil {
+		return "", 0, err
+	}
+	e.log(slog.LevelInfo, "file encrypted", "file", name, "output", encryptedName, "bytes", n)
+
+	return encryptedName, n, nil
+}
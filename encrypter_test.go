@@ -0,0 +1,129 @@
+package celo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEncryptFileStreamed(t *testing.T) {
+	k, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	sizes := []int{0, 1, testChunkSize - 1, testChunkSize, testChunkSize + 1, 3*testChunkSize + 5}
+
+	for _, p := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		for _, size := range sizes {
+			plaintext := randomPlaintext(size)
+			name := filepath.Join(dir, "plain")
+			if err = os.WriteFile(name, plaintext, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			e := NewEncrypter()
+			if err = e.Config(SetPadding(p), SignWith(k)); err != nil {
+				t.Fatal(err)
+			}
+			encryptedName, err := e.EncryptFile([]byte("secret"), name, true, false)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, size, err)
+			}
+
+			// Files encrypted in memory have the same size.
+			m := NewEncrypter()
+			if err = m.Config(SetPadding(p), SignWith(k)); err != nil {
+				t.Fatal(err)
+			}
+			inMemory := sealFile(t, m, []byte("secret"), plaintext)
+			if fi, _ := os.Stat(encryptedName); fi.Size() != int64(len(inMemory)) {
+				t.Errorf("%v, %d bytes: file of %d bytes, want %d", p, size, fi.Size(), len(inMemory))
+			}
+
+			d := NewDecrypter()
+			d.Config(VerifyWith(k.Public()))
+			got, err := readSealed(t, d, []byte("secret"), encryptedName)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, size, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%v, %d bytes: round trip mismatch", p, size)
+			}
+
+			// The last encrypted file can't be encoded again.
+			if _, err = e.Write(new(bytes.Buffer)); !errors.Is(errors.NotReady, err) {
+				t.Errorf("%v, %d bytes: Write got error %v, want kind NotReady", p, size, err)
+			}
+		}
+	}
+}
+
+func TestEncryptFileSourceChanged(t *testing.T) {
+	dir := t.TempDir()
+	plaintext := randomPlaintext(testChunkSize + 10)
+
+	for _, size := range []int64{int64(len(plaintext)) + 1, int64(len(plaintext)) - 1} {
+		name := filepath.Join(dir, "plain.celo")
+
+		e := NewEncrypter()
+		_, err := e.encryptTo(context.Background(), []byte("secret"), bytes.NewReader(plaintext), "plain", size, name, false)
+		if !errors.Is(errors.Plaintext, err) {
+			t.Errorf("size %d of %d: got error %v, want kind Plaintext", size, len(plaintext), err)
+		}
+		if _, err = os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("size %d of %d: encrypted file left behind", size, len(plaintext))
+		}
+	}
+}
+
+func TestEncryptFileTo(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain")
+	plaintext := randomPlaintext(1000)
+	if err := os.WriteFile(name, plaintext, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedName := filepath.Join(t.TempDir(), "exported.bin")
+	e := NewEncrypter()
+	if err := e.EncryptFileTo([]byte("secret"), name, encryptedName, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.EncryptFileTo([]byte("secret"), name, encryptedName, false, false); !errors.Is(errors.Exist, err) {
+		t.Errorf("existing file: got error %v, want kind Exist", err)
+	}
+
+	decryptedName := filepath.Join(dir, "imported")
+	if err := NewDecrypter().DecryptFileTo([]byte("secret"), encryptedName, decryptedName, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(decryptedName); !bytes.Equal(got, plaintext) {
+		t.Error("round trip mismatch")
+	}
+	if _, err := os.Stat(encryptedName); !os.IsNotExist(err) {
+		t.Error("source not removed")
+	}
+
+	// The source can't be replaced.
+	if err := e.EncryptFileTo([]byte("secret"), name, filepath.Join(dir, ".", "plain"), true, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("EncryptFileTo the source: got error %v, want kind Invalid", err)
+	}
+	if err := NewDecrypter().DecryptFileTo([]byte("secret"), name, name, true, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("DecryptFileTo the source: got error %v, want kind Invalid", err)
+	}
+	if got, _ := os.ReadFile(name); !bytes.Equal(got, plaintext) {
+		t.Error("source modified")
+	}
+
+	if err := e.EncryptFileTo([]byte("secret"), name, "", false, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("empty name: got error %v, want kind Invalid", err)
+	}
+	if err := NewDecrypter().DecryptFileTo([]byte("secret"), name, "", false, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("empty name: got error %v, want kind Invalid", err)
+	}
+}
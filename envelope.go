@@ -0,0 +1,266 @@
+package celo
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// StanzaType identifies how the data key is wrapped inside a Stanza.
+type StanzaType byte
+
+// Supported stanza types.
+//
+// Do not reorder this list or remove any items since the values are encoded in
+// encrypted files. New items must be added only to the end.
+const (
+	// StanzaPhrase the data key is wrapped with a key derived from a secret
+	// phrase with the DefaultKDFParams.
+	StanzaPhrase StanzaType = iota + 1
+	// StanzaX25519 the data key is wrapped for an X25519 public key.
+	StanzaX25519
+	// StanzaPhraseKDF the data key is wrapped with a key derived from a
+	// secret phrase with the KDFParams recorded in the stanza.
+	StanzaPhraseKDF
+)
+
+func (t StanzaType) String() string {
+	switch t {
+	case StanzaPhrase, StanzaPhraseKDF:
+		return "phrase"
+	case StanzaX25519:
+		return "x25519"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(t))
+}
+
+// isPhrase reports whether the data key of stanzas of type t is wrapped with a
+// key derived from a secret phrase.
+func (t StanzaType) isPhrase() bool {
+	return t == StanzaPhrase || t == StanzaPhraseKDF
+}
+
+// MaxRecipients maximum number of recipients of a single encrypted file.
+const MaxRecipients = 255
+
+// Stanza is the data key of an encrypted file wrapped for a single recipient.
+// Encrypted files list one stanza per recipient (envelope encryption), so the
+// payload is encrypted only once and can be decrypted by any of them.
+type Stanza struct {
+	Type StanzaType
+	Body []byte
+}
+
+// Recipient wraps the data key of an encrypted file so it can only be
+// unwrapped by the matching Identity.
+type Recipient interface {
+	// Wrap wraps the data key of a file described by the metadata m.
+	Wrap(dataKey []byte, m *Metadata) (*Stanza, error)
+}
+
+// Identity unwraps data keys from the stanzas addressed to it.
+type Identity interface {
+	// Unwrap returns the data key wrapped in the stanza s of a file described
+	// by the metadata m.
+	// It returns an error if the stanza isn't addressed to the identity.
+	Unwrap(s *Stanza, m *Metadata) (dataKey []byte, err error)
+}
+
+// PhraseRecipient is a Recipient that wraps the data key with a key derived
+// from a secret phrase. A new salt is generated on every Wrap.
+type PhraseRecipient struct {
+	secretPhrase []byte
+}
+
+// NewPhraseRecipient creates a Recipient for the secret phrase.
+// It returns an error if the phrase is empty.
+func NewPhraseRecipient(secretPhrase []byte) (*PhraseRecipient, error) {
+	if len(secretPhrase) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, errors.Op("envelope.NewPhraseRecipient"))
+	}
+	return &PhraseRecipient{secretPhrase: secretPhrase}, nil
+}
+
+// Wrap wraps the data key with a key derived from the phrase and a random
+// salt with the DefaultKDFParams. An Encrypter wraps it with the parameters
+// set with SetKDFParams instead.
+func (r *PhraseRecipient) Wrap(dataKey []byte, m *Metadata) (*Stanza, error) {
+	return wrapWithPhrase(StanzaPhraseKDF, DefaultKDFParams(), r.secretPhrase, dataKey, m)
+}
+
+// wrapWithPhrase creates a phrase stanza of type t wrapping the data key with
+// a key derived from the secret phrase and a random salt with the parameters
+// p. Stanzas of type StanzaPhrase can only use the DefaultKDFParams.
+func wrapWithPhrase(t StanzaType, p KDFParams, secretPhrase, dataKey []byte, m *Metadata) (*Stanza, error) {
+	salt, _, err := NewSalt(int(m.vsbn[saltSizeIndex]))
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := int(m.vsbn[blockSizeIndex])
+	key := p.Key(secretPhrase, salt, uint32(blockSize))
+	kek, err := NewCipher(blockSize, int(m.vsbn[nonceSizeIndex]), key)
+	ZeroBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapPhrase(t, p, salt, kek, dataKey, m)
+}
+
+// wrapPhrase creates a phrase stanza of type t wrapping the data key with kek,
+// the key derived from a phrase and salt with the parameters p.
+//  salt | nonce | wrapped data key                          <- StanzaPhrase
+//  kdf parameters | salt | nonce | wrapped data key         <- StanzaPhraseKDF
+func wrapPhrase(t StanzaType, p KDFParams, salt []byte, kek *Cipher, dataKey []byte, m *Metadata) (*Stanza, error) {
+	var params []byte
+	if t == StanzaPhraseKDF {
+		params = p.encode()
+	}
+
+	// Binding the stanza to the file signature prevents it from being moved
+	// to a file with different metadata, and the parameters are authenticated
+	// along with it.
+	nonce, wrapped, err := kek.Encrypt(dataKey, phraseAD(m, params))
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, len(params)+len(salt)+len(nonce)+len(wrapped))
+	body = append(body, params...)
+	body = append(body, salt...)
+	body = append(body, nonce...)
+	body = append(body, wrapped...)
+
+	return &Stanza{Type: t, Body: body}, nil
+}
+
+// phraseStanza the parts of a phrase stanza (See wrapPhrase).
+type phraseStanza struct {
+	kdf     KDFParams
+	salt    []byte
+	nonce   []byte
+	wrapped []byte
+	// ad additional data the data key was wrapped with (See phraseAD).
+	ad []byte
+}
+
+// phraseAD returns the additional data of a phrase stanza of a file with the
+// metadata m: the file signature followed by the encoded parameters of the
+// stanza, which StanzaPhrase doesn't have.
+func phraseAD(m *Metadata, params []byte) []byte {
+	return append(m.Bytes(), params...)
+}
+
+// parsePhrase splits the body of a phrase stanza in its key derivation
+// parameters, salt, nonce and wrapped data key.
+// It returns an error of kind errors.Decode if s isn't a phrase stanza or its
+// parameters are out of bounds.
+func parsePhrase(s *Stanza, m *Metadata) (*phraseStanza, error) {
+	op := errors.Op("envelope.parsePhrase")
+
+	saltSize := int(m.vsbn[saltSizeIndex])
+	nonceSize := int(m.vsbn[nonceSizeIndex])
+
+	if !s.Type.isPhrase() {
+		return nil, errors.E(errors.Decode, op)
+	}
+
+	ps := &phraseStanza{kdf: DefaultKDFParams()}
+	body := s.Body
+	var params []byte
+	if s.Type == StanzaPhraseKDF {
+		kdf, err := decodeKDFParams(body)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		ps.kdf = kdf
+		params, body = body[:kdfParamsSize], body[kdfParamsSize:]
+	}
+
+	if len(body) <= saltSize+nonceSize {
+		return nil, errors.E(errors.Decode, op)
+	}
+
+	ps.salt = body[:saltSize]
+	ps.nonce = body[saltSize : saltSize+nonceSize]
+	ps.wrapped = body[saltSize+nonceSize:]
+	ps.ad = phraseAD(m, params)
+
+	return ps, nil
+}
+
+// newDataKey generates a random key used to encrypt the payload of a file.
+func newDataKey(size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.E(errors.Encrypt, errors.Op("envelope.newDataKey"), err)
+	}
+	return key, nil
+}
+
+// writeStanzas encodes the recipients section.
+//  count (1 byte)
+//  type (1 byte) | body length (2 bytes, big endian) | body   <- per stanza
+// It returns the number of bytes written.
+func writeStanzas(w io.Writer, stanzas []*Stanza) (n int, err error) {
+	op := errors.Op("envelope.writeStanzas")
+
+	if len(stanzas) == 0 || len(stanzas) > MaxRecipients {
+		return 0, errors.E(errors.Invalid, op, errors.Errorf("%d recipients", len(stanzas)))
+	}
+
+	b := []byte{byte(len(stanzas))}
+	for _, s := range stanzas {
+		if len(s.Body) > 0xFFFF {
+			return 0, errors.E(errors.Invalid, op, errors.Errorf("stanza is too large"))
+		}
+		b = append(b, byte(s.Type))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s.Body)))
+		b = append(b, s.Body...)
+	}
+
+	n, err = w.Write(b)
+	if err != nil {
+		return n, errors.E(errors.Encode, op, err)
+	}
+
+	return n, nil
+}
+
+// readStanzas decodes the recipients section written by writeStanzas.
+// It returns the number of bytes read.
+func readStanzas(r io.Reader) (stanzas []*Stanza, n int, err error) {
+	op := errors.Op("envelope.readStanzas")
+
+	var count [1]byte
+	if n, err = io.ReadFull(r, count[:]); err != nil {
+		return nil, n, errors.E(errors.Decode, op, err)
+	}
+	if count[0] == 0 {
+		return nil, n, errors.E(errors.Decode, op, errors.Errorf("no recipients"))
+	}
+
+	for i := 0; i < int(count[0]); i++ {
+		var head [3]byte
+		hn, err := io.ReadFull(r, head[:])
+		n += hn
+		if err != nil {
+			return nil, n, errors.E(errors.Decode, op, err)
+		}
+
+		body := make([]byte, binary.BigEndian.Uint16(head[1:]))
+		bn, err := io.ReadFull(r, body)
+		n += bn
+		if err != nil {
+			return nil, n, errors.E(errors.Decode, op, err)
+		}
+
+		stanzas = append(stanzas, &Stanza{Type: StanzaType(head[0]), Body: body})
+	}
+
+	return stanzas, n, nil
+}
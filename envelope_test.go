@@ -0,0 +1,211 @@
+package celo
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEnvelopeRecipients(t *testing.T) {
+	plaintext := []byte("attack at dawn")
+	phrases := []string{"first", "second", "third"}
+
+	e := NewEncrypter()
+	for _, phrase := range phrases[1:] {
+		r, err := NewPhraseRecipient([]byte(phrase))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = e.Config(AddRecipient(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := sealFile(t, e, []byte(phrases[0]), plaintext)
+
+	info, err := Inspect(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Recipients) != len(phrases) {
+		t.Errorf("got %d stanzas, want %d", len(info.Recipients), len(phrases))
+	}
+
+	for _, phrase := range phrases {
+		got, err := openFile(NewDecrypter(), []byte(phrase), file)
+		if err != nil {
+			t.Fatalf("phrase %q: %v", phrase, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("phrase %q: got %q, want %q", phrase, got, plaintext)
+		}
+	}
+}
+
+func TestEnvelopeOnlyRecipients(t *testing.T) {
+	r, _ := NewPhraseRecipient([]byte("recipient"))
+	e := NewEncrypter()
+	e.Config(AddRecipient(r))
+
+	// Without a phrase the data key is only wrapped for the recipients.
+	file := sealFile(t, e, nil, []byte("attack at dawn"))
+	if _, err := openFile(NewDecrypter(), []byte("recipient"), file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openFile(NewDecrypter(), nil, file); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("no phrase: got error %v, want kind WrongPassphrase", err)
+	}
+
+	if _, err := NewPhraseRecipient(nil); !errors.Is(errors.PhraseIsEmpty, err) {
+		t.Errorf("empty phrase: got error %v, want kind PhraseIsEmpty", err)
+	}
+}
+
+func TestEnvelopeTooManyRecipients(t *testing.T) {
+	e := NewEncrypter()
+	for i := 0; i < MaxRecipients; i++ {
+		id, _ := GenerateX25519Identity()
+		e.Config(AddRecipient(id.Recipient()))
+	}
+
+	// The phrase adds one stanza over the limit.
+	if _, err := e.Encrypt([]byte("secret"), []byte("attack at dawn")); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got error %v, want kind Invalid", err)
+	}
+}
+
+func TestEnvelopeStanzasRoundTrip(t *testing.T) {
+	stanzas := []*Stanza{
+		{Type: StanzaPhrase, Body: []byte("phrase stanza")},
+		{Type: StanzaX25519, Body: bytes.Repeat([]byte{1}, 300)},
+	}
+
+	b := new(bytes.Buffer)
+	n, err := writeStanzas(b, stanzas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, rn, err := readStanzas(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rn != n || len(got) != len(stanzas) {
+		t.Fatalf("read %d stanzas in %d bytes, want %d in %d", len(got), rn, len(stanzas), n)
+	}
+	for i := range got {
+		if got[i].Type != stanzas[i].Type || !bytes.Equal(got[i].Body, stanzas[i].Body) {
+			t.Errorf("stanza %d mismatch", i)
+		}
+	}
+
+	if _, err = writeStanzas(b, nil); !errors.Is(errors.Invalid, err) {
+		t.Errorf("no stanzas: got error %v, want kind Invalid", err)
+	}
+	if _, _, err = readStanzas(bytes.NewReader([]byte{2, byte(StanzaPhrase), 0, 4, 'a'})); !errors.Is(errors.Decode, err) {
+		t.Errorf("truncated section: got error %v, want kind Decode", err)
+	}
+}
+
+// Stanzas are bound to the metadata of the file they were created for.
+func TestEnvelopeMovedStanza(t *testing.T) {
+	phrase := []byte("secret")
+	a := sealFile(t, NewEncrypter(), phrase, []byte("attack at dawn"))
+
+	e := NewEncrypter()
+	e.Config(SetPadding(PaddingBlock))
+	b := sealFile(t, e, phrase, []byte("attack at dusk"))
+
+	info, err := Inspect(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recipients section of a, metadata and payload of b.
+	moved := append([]byte(nil), b...)
+	copy(moved[SignatureSize:info.HeaderSize], a[SignatureSize:info.HeaderSize])
+
+	if _, err = openFile(NewDecrypter(), phrase, moved); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+// Phrase stanzas record the key derivation parameters they were derived with.
+func TestEnvelopeKDFParams(t *testing.T) {
+	p := KDFParams{Time: 2, Memory: MinKDFMemory, Threads: 1}
+	other, _ := NewPhraseRecipient([]byte("other"))
+
+	e := NewEncrypter()
+	if err := e.Config(SetKDFParams(p), AddRecipient(other)); err != nil {
+		t.Fatal(err)
+	}
+	file := sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+
+	info, err := Inspect(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.KDF != p.String() {
+		t.Errorf("got KDF %q, want %q", info.KDF, p.String())
+	}
+
+	for _, phrase := range []string{"secret", "other"} {
+		d := NewDecrypter()
+		if got, err := openFile(d, []byte(phrase), file); err != nil || string(got) != "attack at dawn" {
+			t.Fatalf("phrase %q: got %q, %v", phrase, got, err)
+		}
+		if d.kdf != p {
+			t.Errorf("phrase %q: key derived with %v, want %v", phrase, d.kdf, p)
+		}
+	}
+
+	// The parameters are authenticated along with the data key.
+	tampered := append([]byte(nil), file...)
+	tampered[SignatureSize+1+3+3]++
+	if _, err = openFile(NewDecrypter(), []byte("secret"), tampered); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("tampered parameters: got error %v, want kind WrongPassphrase", err)
+	}
+
+	// Parameters out of bounds aren't used.
+	tampered = append([]byte(nil), file...)
+	tampered[SignatureSize+1+3] = 0xFF
+	if _, err = openFile(NewDecrypter(), []byte("secret"), tampered); !errors.Is(errors.Decode, err) {
+		t.Errorf("parameters out of bounds: got error %v, want kind Decode", err)
+	}
+}
+
+// Phrase stanzas that don't record the parameters use the defaults.
+func TestEnvelopeLegacyPhraseStanza(t *testing.T) {
+	file := sealFile(t, NewEncrypter(), []byte("secret"), []byte("attack at dawn"))
+	info, err := Inspect(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecrypter()
+	if _, err = d.Read(bytes.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	i, dataKey, err := d.unwrapPhrase(context.Background(), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.stanzas[i], err = wrapWithPhrase(StanzaPhrase, DefaultKDFParams(), []byte("secret"), dataKey, d.metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	b := new(bytes.Buffer)
+	if _, err = d.WriteHeader(b); err != nil {
+		t.Fatal(err)
+	}
+	b.Write(file[info.HeaderSize:])
+
+	legacy := NewDecrypter()
+	if got, err := openFile(legacy, []byte("secret"), b.Bytes()); err != nil || string(got) != "attack at dawn" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if legacy.kdf != DefaultKDFParams() {
+		t.Errorf("key derived with %v, want the defaults", legacy.kdf)
+	}
+}
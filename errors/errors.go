@@ -46,68 +46,86 @@ type Kind uint16
 // Do not reorder this list or remove any items since that will change their
 // values. New items must be added only to the end.
 const (
-	Other          Kind = iota // Unclassified error.
-	Invalid                    // Invalid operation.
-	PhraseIsEmpty              // Phrase is empty.
-	PhraseMismatch             // Phrase and confirmation mismatch.
-	PhraseOther                // Unable to read phrase from stdin.
-	Permissions                // File required permissions are missing.
-	Create                     // File couldn't be created.
-	Open                       // File couldn't be opened.
-	Exist                      // File already exist.
-	NotExist                   // File doesn't exist.
-	IsDir                      // Item is a directory.
-	Pattern                    // Invalid Glob Pattern
-	Signature                  // Signature mismatch
-	Metadata                   // Metadata's format is invalid.
-	NotReady                   // Cipher hasn't been intialized.
-	BlockSize                  // Block Size is invalid.
-	Nonce                      // Nonce is empty or invalid
-	NonceSize                  // Nonce Size is not compatible.
-	Salt                       // Salt is empty or invalid.
-	SaltSize                   // Salt Size is not compatible.
-	Ciphertext                 // Ciphertext is invalid
-	Cipher                     // Cipher wasn't created.
-	Plaintext                  // Plaintext is invalid
-	Encode                     // Encoding failed.
-	Decode                     // Decoding failed.
-	Incompatible               // Unsupported version.
-	Decrypt                    // Item already exists.
-	Encrypt                    // Item does not exist.
-	Internal                   // Internal error or inconsistency.
+	Other           Kind = iota // Unclassified error.
+	Invalid                     // Invalid operation.
+	PhraseIsEmpty               // Phrase is empty.
+	PhraseMismatch              // Phrase and confirmation mismatch.
+	PhraseOther                 // Unable to read phrase from stdin.
+	Permissions                 // File required permissions are missing.
+	Create                      // File couldn't be created.
+	Open                        // File couldn't be opened.
+	Exist                       // File already exist.
+	NotExist                    // File doesn't exist.
+	IsDir                       // Item is a directory.
+	Pattern                     // Invalid Glob Pattern
+	Signature                   // Signature mismatch
+	Metadata                    // Metadata's format is invalid.
+	NotReady                    // Cipher hasn't been intialized.
+	BlockSize                   // Block Size is invalid.
+	Nonce                       // Nonce is empty or invalid
+	NonceSize                   // Nonce Size is not compatible.
+	Salt                        // Salt is empty or invalid.
+	SaltSize                    // Salt Size is not compatible.
+	Ciphertext                  // Ciphertext is invalid
+	Cipher                      // Cipher wasn't created.
+	Plaintext                   // Plaintext is invalid
+	Encode                      // Encoding failed.
+	Decode                      // Decoding failed.
+	Incompatible                // Unsupported version.
+	Decrypt                     // Item already exists.
+	Encrypt                     // Item does not exist.
+	Internal                    // Internal error or inconsistency.
+	Padding                     // Padding is invalid or unsupported.
+	Key                         // Key is invalid or couldn't be generated.
+	Sign                        // Signature is missing, invalid or unexpected.
+	Truncated                   // File is truncated.
+	Canceled                    // Operation was canceled or its deadline exceeded.
+	WrongPassphrase             // Phrase (or identity) doesn't decrypt the file.
+	Skipped                     // File was skipped.
+	PhraseIsWeak                // Phrase is too easy to guess.
+	Locked                      // File is locked by another process.
 )
 
 // Messages map of errors.Kind messages.
 var Messages = map[Kind]string{
-	Other:          "Unknown error",
-	Invalid:        "Invalid operation",
-	PhraseIsEmpty:  "Empty phrase is not allowed",
-	PhraseMismatch: "Phrases don't match",
-	PhraseOther:    "Unable to get phrase",
-	Permissions:    "Insufficient permissions",
-	Create:         "File couldn't be created",
-	Open:           "File couldn't be opened",
-	Exist:          "File already exist",
-	NotExist:       "File doesn't exist",
-	IsDir:          "Directories are not supported",
-	Pattern:        "Invalid Glob Pattern",
-	Signature:      "File Signature is invalid",
-	Metadata:       "Metadata is invalid",
-	NotReady:       "Instance hasn't been initialized",
-	BlockSize:      "Block Size is invalid",
-	Nonce:          "Nonce is empty or invalid",
-	NonceSize:      "Nonce Size is invalid",
-	Salt:           "Salt is empty or invalid",
-	SaltSize:       "Salt Size is invalid",
-	Ciphertext:     "Ciphertext is invalid or corrupt",
-	Cipher:         "Cipher couldn't be created",
-	Plaintext:      "Plaintext is invalid or corrupt",
-	Encode:         "Unable to Encode content",
-	Decode:         "Unable to Decode content",
-	Incompatible:   "Incompatible version",
-	Decrypt:        "Unable to Decrypt content",
-	Encrypt:        "Unable to Encrypt content",
-	Internal:       "Internal error",
+	Other:           "Unknown error",
+	Invalid:         "Invalid operation",
+	PhraseIsEmpty:   "Empty phrase is not allowed",
+	PhraseMismatch:  "Phrases don't match",
+	PhraseOther:     "Unable to get phrase",
+	Permissions:     "Insufficient permissions",
+	Create:          "File couldn't be created",
+	Open:            "File couldn't be opened",
+	Exist:           "File already exist",
+	NotExist:        "File doesn't exist",
+	IsDir:           "Directories are not supported",
+	Pattern:         "Invalid Glob Pattern",
+	Signature:       "File Signature is invalid",
+	Metadata:        "Metadata is invalid",
+	NotReady:        "Instance hasn't been initialized",
+	BlockSize:       "Block Size is invalid",
+	Nonce:           "Nonce is empty or invalid",
+	NonceSize:       "Nonce Size is invalid",
+	Salt:            "Salt is empty or invalid",
+	SaltSize:        "Salt Size is invalid",
+	Ciphertext:      "Ciphertext is invalid or corrupt",
+	Cipher:          "Cipher couldn't be created",
+	Plaintext:       "Plaintext is invalid or corrupt",
+	Encode:          "Unable to Encode content",
+	Decode:          "Unable to Decode content",
+	Incompatible:    "Incompatible version",
+	Decrypt:         "Unable to Decrypt content",
+	Encrypt:         "Unable to Encrypt content",
+	Internal:        "Internal error",
+	Padding:         "Padding is invalid or unsupported",
+	Key:             "Key is invalid",
+	Sign:            "Signature verification failed",
+	Truncated:       "File is truncated",
+	Canceled:        "Operation canceled",
+	WrongPassphrase: "Phrase is incorrect",
+	Skipped:         "File was skipped",
+	PhraseIsWeak:    "Phrase is too easy to guess",
+	Locked:          "File is in use by another process",
 }
 
 func (k Kind) String() string {
@@ -189,19 +207,41 @@ func E(args ...interface{}) error {
 	return e
 }
 
-// errorString is a trivial implementation of error.
-type errorString struct {
-	s string
+// Errorf is equivalent to fmt.Errorf, but allows clients to import only this
+// package for all error handling. Errors wrapped with %w can be inspected with
+// the standard errors.Is and errors.As.
+func Errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format, args...)
 }
 
-func (e *errorString) Error() string {
-	return e.s
+// Unwrap returns the underlying error, so the standard errors.Is and errors.As
+// can inspect the chain of errors, e.g. to find an *os.PathError or
+// context.Canceled.
+func (e *Error) Unwrap() error {
+	return e.Err
 }
 
-// Errorf is equivalent to fmt.Errorf, but allows clients to import only this
-// package for all error handling.
-func Errorf(format string, args ...interface{}) error {
-	return &errorString{fmt.Sprintf(format, args...)}
+// Is reports whether target is an *Error whose non-zero Kind, Op and Entity
+// are equal to the ones of e. A target without any of them doesn't match, its
+// Err isn't compared. It is used by the standard errors.Is, which checks every
+// error of the chain:
+//
+//	errors.Is(err, &errors.Error{Kind: errors.Truncated})
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Kind != Other && t.Kind != e.Kind {
+		return false
+	}
+	if t.Op != "" && t.Op != e.Op {
+		return false
+	}
+	if t.Entity != "" && t.Entity != e.Entity {
+		return false
+	}
+	return t.Kind != Other || t.Op != "" || t.Entity != ""
 }
 
 // pad appends str to the buffer if the buffer already has some data.
@@ -0,0 +1,85 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	pathErr := &fs.PathError{Op: "open", Path: "a.celo", Err: fs.ErrNotExist}
+	err := E(Op("decrypter.DecryptFile"), Entity("a.celo"), E(Open, Op("file.Open"), pathErr))
+	canceled := E(Canceled, Op("celo.checkContext"), context.Canceled)
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"kind", err, &Error{Kind: Open}, true},
+		{"other kind", err, &Error{Kind: Decrypt}, false},
+		{"op", err, &Error{Op: "decrypter.DecryptFile"}, true},
+		{"inner op", err, &Error{Op: "file.Open"}, true},
+		{"other op", err, &Error{Op: "encrypter.EncryptFile"}, false},
+		{"entity", err, &Error{Entity: "a.celo"}, true},
+		{"other entity", err, &Error{Entity: "b.celo"}, false},
+		{"kind and entity", err, &Error{Kind: Open, Entity: "a.celo"}, true},
+		{"kind and other entity", err, &Error{Kind: Open, Entity: "b.celo"}, false},
+		{"zero target", err, &Error{}, false},
+		{"only Err", err, &Error{Err: pathErr}, false},
+		{"only other Err", err, &Error{Err: context.Canceled}, false},
+		{"standard error", err, fs.ErrNotExist, true},
+		{"other standard error", err, context.Canceled, false},
+		{"context", canceled, context.Canceled, true},
+		{"context kind", canceled, &Error{Kind: Canceled}, true},
+		{"formatted", Errorf("reading: %w", canceled), context.Canceled, true},
+	}
+
+	for _, tt := range tests {
+		if got := stderrors.Is(tt.err, tt.target); got != tt.want {
+			t.Errorf("%s: errors.Is = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestErrorAs(t *testing.T) {
+	_, openErr := os.Open("does-not-exist.celo")
+	err := E(Op("decrypter.DecryptFile"), E(Open, Op("file.Open"), openErr))
+
+	var pathErr *fs.PathError
+	if !stderrors.As(err, &pathErr) || pathErr.Path != "does-not-exist.celo" {
+		t.Errorf("errors.As(*fs.PathError) = %v, want the error of os.Open", pathErr)
+	}
+
+	var e *Error
+	if !stderrors.As(err, &e) || e.Op != "decrypter.DecryptFile" {
+		t.Errorf("errors.As(*Error) = %v, want the outer error", e)
+	}
+
+	if stderrors.As(Errorf("plain"), &e) {
+		t.Error("errors.As(*Error) matched an error that isn't an *Error")
+	}
+}
+
+func TestIsKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind Kind
+		want bool
+	}{
+		{E(Truncated), Truncated, true},
+		{E(Op("trailer.parseTrailer"), E(Truncated)), Truncated, true},
+		{E(Decrypt, E(Truncated)), Truncated, false},
+		{E(Op("a"), Errorf("plain")), Truncated, false},
+		{Errorf("plain"), Other, false},
+	}
+
+	for i, tt := range tests {
+		if got := Is(tt.kind, tt.err); got != tt.want {
+			t.Errorf("%d: Is(%v, %v) = %v, want %v", i, tt.kind, tt.err, got, tt.want)
+		}
+	}
+}
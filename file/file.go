@@ -1,9 +1,12 @@
 package file
 
 import (
+	"crypto/rand"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rrivera/celo/errors"
 )
@@ -12,6 +15,29 @@ import (
 // to be on.
 func Create(name string, overwrite bool) (f *os.File, exist bool, err error) {
 	op := errors.Op("file.Create")
+
+	if exist, err = check(op, name, overwrite); err != nil {
+		return nil, exist, err
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, exist, errors.E(errors.Create, op, err)
+	}
+
+	return file, exist, nil
+}
+
+// CanCreate returns the error that Create would return, without creating the
+// file. It is used before writing to a temporary file that replaces name
+// (See CreateTemp).
+func CanCreate(name string, overwrite bool) error {
+	_, err := check(errors.Op("file.CanCreate"), name, overwrite)
+	return err
+}
+
+// check verifies that a file with the provided name can be created.
+func check(op errors.Op, name string, overwrite bool) (exist bool, err error) {
 	fi, err := os.Stat(name)
 
 	exist = err != nil && !os.IsNotExist(err)
@@ -21,47 +47,146 @@ func Create(name string, overwrite bool) (f *os.File, exist bool, err error) {
 		// File doesn't exists, which is fine since it will be created.
 	case os.IsPermission(err):
 		// File exists, but isn't possible to open it due to lack of permissions.
-		return nil, exist, errors.E(errors.Permissions, op, err)
+		return exist, errors.E(errors.Permissions, op, err)
 	case err != nil:
 		// Other errors.
-		return nil, exist, errors.E(errors.Permissions, op, err)
+		return exist, errors.E(errors.Permissions, op, err)
 	case fi.IsDir():
 		// It is a directory. (Probably the name ends with "/")
-		return nil, exist, errors.E(errors.IsDir, op)
+		return exist, errors.E(errors.IsDir, op)
 	case !overwrite:
 		// At this point we know that the file exists, if the overwrite flag is
 		// of, it's content won't be replaced.
-		return nil, exist, errors.E(errors.Exist, op)
+		return exist, errors.E(errors.Exist, op)
 	}
 
-	file, err := os.Create(name)
-	if err != nil {
-		return nil, exist, errors.E(errors.Create, op, err)
-	}
-
-	return file, exist, nil
+	return exist, nil
 }
 
 // Glob returns the name of existing files matching the pattern, excluding the
-// ones that match ignorePattern. It ignores directories.
+// ones that match any of ignorePatterns (See Match). It ignores directories.
+// Empty ignore patterns are ignored.
 //        pattern:    "./*"
-//  ignorePattern:    "*.celo"
+//  ignorePatterns:   "*.celo", "*.bak"
 //
-//  Matches every file in "./" except the ones with ".celo" extension.
-// Glob return
-func Glob(pattern, ignorePattern string) (filepaths []string, err error) {
+//  Matches every file in "./" except the ones with ".celo" and ".bak"
+//  extensions.
+// It returns an error of kind errors.Pattern if any pattern is malformed.
+func Glob(pattern string, ignorePatterns ...string) (filepaths []string, err error) {
+	op := errors.Op("file.Glob")
 
 	f, err := filepath.Glob(pattern)
 	if err != nil {
-		return f, errors.E(errors.Pattern, errors.Op("file.Glob"), err)
+		return f, errors.E(errors.Pattern, op, err)
 	}
 
-	if ignorePattern != "" {
-		f = filterFilepaths(f, skipIgnored(ignorePattern))
-		f = filterFilepaths(f, isFile)
+	for _, ignorePattern := range ignorePatterns {
+		if ignorePattern != "" {
+			f = filterFilepaths(f, isFile)
+			break
+		}
 	}
 
-	return f, nil
+	return Exclude(f, ignorePatterns...)
+}
+
+// Exclude returns the files that don't match any of ignorePatterns (See
+// Match). Empty patterns are ignored.
+// It returns an error of kind errors.Pattern if any pattern is malformed.
+func Exclude(files []string, ignorePatterns ...string) ([]string, error) {
+	op := errors.Op("file.Exclude")
+
+	for _, ignorePattern := range ignorePatterns {
+		if ignorePattern == "" {
+			continue
+		}
+		// A malformed pattern would exclude every file.
+		if _, err := filepath.Match(ignorePattern, ""); err != nil {
+			return nil, errors.E(errors.Pattern, op, errors.Entity(ignorePattern), err)
+		}
+
+		files = filterFilepaths(files, skipIgnored(ignorePattern))
+	}
+
+	return files, nil
+}
+
+// Include returns the files that match any of includePatterns (See Match).
+// Empty patterns are ignored, files are returned as they are if there isn't
+// any other.
+// It returns an error of kind errors.Pattern if any pattern is malformed.
+func Include(files []string, includePatterns ...string) ([]string, error) {
+	op := errors.Op("file.Include")
+
+	var patterns []string
+	for _, pattern := range includePatterns {
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.E(errors.Pattern, op, errors.Entity(pattern), err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return files, nil
+	}
+
+	return filterFilepaths(files, func(file string) bool {
+		for _, pattern := range patterns {
+			if matches, _ := Match(pattern, file); matches {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// ModifiedAfter returns the files modified after t, or files as they are if t
+// is zero. Files that can't be read are kept, so the error is reported when
+// they are processed.
+func ModifiedAfter(files []string, t time.Time) []string {
+	if t.IsZero() {
+		return files
+	}
+	return filterFilepaths(files, func(file string) bool {
+		fi, err := os.Stat(file)
+		return err != nil || fi.ModTime().After(t)
+	})
+}
+
+// ExcludeHidden returns the matches of pattern (See Glob) that aren't hidden.
+// As in the shell, a file or directory whose name starts with a dot is hidden
+// unless the element of pattern that matched it starts with a dot too:
+//
+//	ExcludeHidden("./*", []string{"a.txt", ".env"})                // a.txt
+//	ExcludeHidden("./.*", []string{".env"})                        // .env
+//	ExcludeHidden("*/*.yml", []string{"ci/a.yml", ".github/a.yml"}) // ci/a.yml
+func ExcludeHidden(pattern string, matches []string) []string {
+	elems := splitPath(pattern)
+	return filterFilepaths(matches, func(name string) bool {
+		// Matches have the elements of the pattern, counted from the end,
+		// filepath.Glob cleans the leading ones.
+		names := splitPath(name)
+		for i, j := len(names)-1, len(elems)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+			if IsHidden(names[i]) && !strings.HasPrefix(elems[j], ".") {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// IsHidden reports whether the file or directory name is hidden, its base
+// name starts with a dot. "." and ".." aren't.
+func IsHidden(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(base, ".") && base != "." && base != ".."
+}
+
+// splitPath returns the elements of the cleaned path name.
+func splitPath(name string) []string {
+	return strings.Split(filepath.Clean(name), string(filepath.Separator))
 }
 
 // Match reports whether name matches the shell file name pattern.
@@ -135,3 +260,180 @@ func isFile(file string) bool {
 	fi, err := os.Stat(file)
 	return err == nil && !fi.IsDir()
 }
+
+// CreateTemp creates a temporary file in the directory of name, so it can
+// later be renamed to name atomically (same file system).
+func CreateTemp(name string) (f *os.File, err error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err = os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return nil, errors.E(errors.Create, errors.Op("file.CreateTemp"), err)
+	}
+
+	return f, nil
+}
+
+// WriteAtomic writes the file name with write through a temporary file in the
+// same directory (See CreateTemp), which replaces name with the given
+// permissions only if write succeeds. An interrupted write never leaves a
+// partially written file at name.
+// If the file exists, overwrite flag has to be on. Without it, a file created
+// at name while write runs isn't replaced either.
+func WriteAtomic(name string, overwrite bool, perm os.FileMode, write func(f *os.File) error) error {
+	if err := CanCreate(name, overwrite); err != nil {
+		return err
+	}
+
+	f, err := CreateTemp(name)
+	if err != nil {
+		return err
+	}
+
+	if err = f.Chmod(perm); err != nil {
+		err = errors.E(errors.Create, errors.Op("file.WriteAtomic"), err)
+	} else {
+		err = write(f)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if overwrite {
+		return Commit(f, name)
+	}
+	return commitNew(f, name)
+}
+
+// commitNew is Commit but name isn't replaced if it exists: the temporary
+// file is linked to name instead of renamed, which fails if name exists.
+func commitNew(f *os.File, name string) (err error) {
+	op := errors.Op("file.Commit")
+
+	defer os.Remove(f.Name())
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return errors.E(errors.Create, op, err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.E(errors.Create, op, err)
+	}
+
+	switch err = os.Link(f.Name(), name); {
+	case err == nil:
+		return nil
+	case os.IsExist(err):
+		return errors.E(errors.Exist, op)
+	}
+
+	// Hard links aren't supported by every file system, name is checked
+	// instead.
+	if err = CanCreate(name, false); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), name); err != nil {
+		return errors.E(errors.Create, op, err)
+	}
+	return nil
+}
+
+// Commit makes the content written to the temporary file f durable and
+// renames it to name, replacing it if it exists. f is closed.
+// If any step fails the temporary file is removed and name isn't modified.
+func Commit(f *os.File, name string) (err error) {
+	op := errors.Op("file.Commit")
+
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return errors.E(errors.Create, op, err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.E(errors.Create, op, err)
+	}
+	if err = os.Rename(f.Name(), name); err != nil {
+		return errors.E(errors.Create, op, err)
+	}
+
+	return nil
+}
+
+// Shred overwrites the content of the file name with random data passes
+// times, truncates it and removes it. Each pass is synced to the disk before
+// the next one.
+// It is a best effort: file systems that copy on write (btrfs, ZFS, APFS),
+// journals, snapshots and the wear leveling of SSDs can keep copies of the
+// original content.
+func Shred(name string, passes int) error {
+	op := errors.Op("file.Shred")
+
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.E(errors.Open, op, errors.Entity(name), err)
+	}
+	if err = overwriteRandom(f, passes); err != nil {
+		f.Close()
+		return errors.E(errors.Create, op, errors.Entity(name), err)
+	}
+	if err = f.Close(); err != nil {
+		return errors.E(errors.Create, op, errors.Entity(name), err)
+	}
+	if err = os.Remove(name); err != nil {
+		return errors.E(errors.Create, op, errors.Entity(name), err)
+	}
+	return nil
+}
+
+// overwriteRandom writes random data over the content of f passes times,
+// then truncates it.
+func overwriteRandom(f *os.File, passes int) error {
+	buf := make([]byte, 32*1024)
+	for i := 0; i < passes; i++ {
+		if err := overwriteRandomPass(f, buf); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// overwriteRandomPass writes random data, through buf, over the whole content
+// of f and syncs it.
+func overwriteRandomPass(f *os.File, buf []byte) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	for left := fi.Size(); left > 0; {
+		n := int64(len(buf))
+		if left < n {
+			n = left
+		}
+		if _, err = rand.Read(buf[:n]); err != nil {
+			return err
+		}
+		if _, err = f.Write(buf[:n]); err != nil {
+			return err
+		}
+		left -= n
+	}
+	return f.Sync()
+}
@@ -0,0 +1,225 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.bak", "c.celo", "d.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(files []string) []string {
+		var base []string
+		for _, f := range files {
+			base = append(base, filepath.Base(f))
+		}
+		return base
+	}
+
+	tests := []struct {
+		excludes []string
+		want     []string
+	}{
+		{[]string{"*.celo"}, []string{"a.txt", "b.bak", "d.md"}},
+		{[]string{"*.celo", "*.bak"}, []string{"a.txt", "d.md"}},
+		{[]string{"*.celo", "", "*.md", "a.*"}, []string{"b.bak"}},
+		{[]string{"*"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := Glob(filepath.Join(dir, "*"), tt.excludes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names(got), tt.want) {
+			t.Errorf("excludes %q: got %v, want %v", tt.excludes, names(got), tt.want)
+		}
+	}
+
+	if _, err := Glob(filepath.Join(dir, "*"), "*.celo", "[a-"); !errors.Is(errors.Pattern, err) {
+		t.Errorf("malformed exclude: got error %v, want kind Pattern", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	files := []string{"docs/a.md", "docs/b.txt", "notes/c.md", "d.go"}
+
+	tests := []struct {
+		includes []string
+		want     []string
+	}{
+		{nil, files},
+		{[]string{""}, files},
+		{[]string{"*.md"}, []string{"docs/a.md", "notes/c.md"}},
+		{[]string{"*.md", "*.go"}, []string{"docs/a.md", "notes/c.md", "d.go"}},
+		{[]string{filepath.Join("docs", "*")}, []string{"docs/a.md", "docs/b.txt"}},
+		{[]string{"*.pdf"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := Include(files, tt.includes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("includes %q: got %v, want %v", tt.includes, got, tt.want)
+		}
+	}
+
+	if _, err := Include(files, "[a-"); !errors.Is(errors.Pattern, err) {
+		t.Errorf("malformed include: got error %v, want kind Pattern", err)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	// Names don't have to exist.
+	files := []string{"docs/a.md", "docs/b.bak", "c.celo"}
+	got, err := Exclude(files, "*.celo", "", "*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"docs/a.md"}) {
+		t.Errorf("got %v", got)
+	}
+	if _, err = Exclude(files, "[a-"); !errors.Is(errors.Pattern, err) {
+		t.Errorf("malformed exclude: got error %v, want kind Pattern", err)
+	}
+}
+
+func TestModifiedAfter(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var files []string
+	for i, age := range []time.Duration{48 * time.Hour, time.Hour, 0} {
+		name := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(name, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, now, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	files = append(files, missing)
+
+	if got := ModifiedAfter(files, time.Time{}); !reflect.DeepEqual(got, files) {
+		t.Errorf("zero time: got %v", got)
+	}
+	want := []string{files[1], files[2], missing}
+	if got := ModifiedAfter(files, now.Add(-24*time.Hour)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestExcludeHidden(t *testing.T) {
+	sep := string(filepath.Separator)
+	tests := []struct {
+		pattern string
+		matches []string
+		want    []string
+	}{
+		{"./*", []string{"a.txt", ".env", ".git"}, []string{"a.txt"}},
+		{"./.*", []string{".env", ".git"}, []string{".env", ".git"}},
+		{".env", []string{".env"}, []string{".env"}},
+		{"*" + sep + "*.yml", []string{"ci" + sep + "a.yml", ".github" + sep + "a.yml"}, []string{"ci" + sep + "a.yml"}},
+		{".config" + sep + "*", []string{".config" + sep + "a.toml", ".config" + sep + ".b.toml"}, []string{".config" + sep + "a.toml"}},
+		{".." + sep + "*", []string{".." + sep + "a.txt"}, []string{".." + sep + "a.txt"}},
+		{"*", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := ExcludeHidden(tt.pattern, tt.matches); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExcludeHidden(%q, %q) = %q, want %q", tt.pattern, tt.matches, got, tt.want)
+		}
+	}
+}
+
+func TestIsHidden(t *testing.T) {
+	tests := map[string]bool{
+		".env":                          true,
+		filepath.Join("a", ".git"):      true,
+		filepath.Join(".git", "config"): false,
+		"a.txt":                         false,
+		".":                             false,
+		"..":                            false,
+	}
+	for name, want := range tests {
+		if got := IsHidden(name); got != want {
+			t.Errorf("IsHidden(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
+
+func TestShred(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The link keeps the content shredded reachable.
+	link := filepath.Join(dir, "link")
+	if err := os.Link(name, link); err != nil {
+		t.Skipf("hard links aren't supported: %v", err)
+	}
+
+	if err := Shred(name, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("the file wasn't removed: %v", err)
+	}
+	if b, err := os.ReadFile(link); err != nil || len(b) != 0 {
+		t.Errorf("got content %q, %v, want an empty file", b, err)
+	}
+
+	if err := Shred(name, 1); !errors.Is(errors.Open, err) {
+		t.Errorf("missing file: got error %v, want kind Open", err)
+	}
+}
+
+func TestOverwriteRandom(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plain.txt")
+	plaintext := []byte(strings.Repeat("attack at dawn ", 5000))
+	if err := os.WriteFile(name, plaintext, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Read what a pass wrote before the file is truncated.
+	if err = overwriteRandomPass(f, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != len(plaintext) || bytes.Contains(written, []byte("attack at dawn")) {
+		t.Errorf("the content wasn't overwritten: %d bytes", len(written))
+	}
+
+	if err = overwriteRandom(f, 2); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := f.Stat(); fi.Size() != 0 {
+		t.Errorf("size %d, want a truncated file", fi.Size())
+	}
+}
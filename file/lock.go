@@ -0,0 +1,71 @@
+package file
+
+import (
+	"os"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Lock takes an advisory lock on f, exclusive or shared, without waiting for
+// it, so other processes that lock the file, such as another celo, don't
+// write or remove it meanwhile. On Windows the lock is mandatory, only the
+// handle f can read (exclusive) or write the file.
+// It returns the function that releases the lock, or an error of kind
+// errors.Locked if another process holds a lock that conflicts with it. The
+// file isn't locked, and no error is returned, if its file system or the OS
+// doesn't support locks.
+func Lock(f *os.File, exclusive bool) (unlock func() error, err error) {
+	op := errors.Op("file.Lock")
+
+	switch err = lockFile(f, exclusive); {
+	case err == nil:
+		return func() error { return unlockFile(f) }, nil
+	case isLocked(err):
+		return nil, errors.E(errors.Locked, op, errors.Entity(f.Name()), errors.Errorf("the file is in use by another process"))
+	case lockUnsupported(err):
+		return func() error { return nil }, nil
+	}
+	return nil, errors.E(errors.Open, op, errors.Entity(f.Name()), err)
+}
+
+// LockName takes an exclusive lock on the existing file name (See Lock) and
+// holds it until unlock is called, e.g. until the file is replaced, so other
+// processes that lock the file don't read, write or replace it meanwhile. The
+// file can still be renamed over, on Windows too. Files that don't exist
+// aren't locked.
+func LockName(name string) (unlock func() error, err error) {
+	f, err := openLock(name)
+	if err != nil {
+		// Whether the file can be replaced is checked when it is.
+		return func() error { return nil }, nil
+	}
+
+	release, err := Lock(f, true)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		err := release()
+		f.Close()
+		return err
+	}, nil
+}
+
+// CheckUnlocked returns an error of kind errors.Locked if another process
+// holds a lock on the existing file name (See Lock), e.g. before it is
+// replaced. Files that don't exist aren't locked.
+func CheckUnlocked(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		// Whether the file can be replaced is checked when it is.
+		return nil
+	}
+	defer f.Close()
+
+	unlock, err := Lock(f, true)
+	if err != nil {
+		return err
+	}
+	return unlock()
+}
@@ -0,0 +1,31 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !windows
+
+package file
+
+import (
+	"errors"
+	"os"
+)
+
+// errLockUnsupported the OS doesn't support locking files.
+var errLockUnsupported = errors.New("file locks aren't supported")
+
+func openLock(name string) (*os.File, error) {
+	return os.Open(name)
+}
+
+func lockFile(f *os.File, exclusive bool) error {
+	return errLockUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+func isLocked(err error) bool {
+	return false
+}
+
+func lockUnsupported(err error) bool {
+	return err == errLockUnsupported
+}
@@ -0,0 +1,93 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly || windows
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Locks of other open files conflict, as the ones of other processes.
+	open := func() *os.File {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	unlock, err := Lock(open(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := Lock(open(), false)
+	if err != nil {
+		t.Fatalf("shared locks conflict: %v", err)
+	}
+	if _, err = Lock(open(), true); !errors.Is(errors.Locked, err) {
+		t.Errorf("got %v, want an error of kind errors.Locked", err)
+	}
+	if err = CheckUnlocked(name); !errors.Is(errors.Locked, err) {
+		t.Errorf("got %v, want an error of kind errors.Locked", err)
+	}
+
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err = shared(); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckUnlocked(name); err != nil {
+		t.Errorf("unlocked file: %v", err)
+	}
+	if err = CheckUnlocked(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestLockName(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := LockName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LockName(name); !errors.Is(errors.Locked, err) {
+		t.Errorf("got %v, want an error of kind errors.Locked", err)
+	}
+	// The locked file can still be replaced.
+	err = WriteAtomic(name, true, 0600, func(f *os.File) error {
+		_, err := f.WriteString("retreat")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckUnlocked(name); err != nil {
+		t.Errorf("unlocked file: %v", err)
+	}
+
+	unlock, err = LockName(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if err = unlock(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package file
+
+import (
+	"os"
+	"syscall"
+)
+
+func openLock(name string) (*os.File, error) {
+	return os.Open(name)
+}
+
+func lockFile(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	return flock(f, how|syscall.LOCK_NB)
+}
+
+func unlockFile(f *os.File) error {
+	return flock(f, syscall.LOCK_UN)
+}
+
+// flock applies the lock operation how to f, trying again if it is
+// interrupted by a signal.
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// isLocked reports whether err means another process holds a conflicting lock.
+func isLocked(err error) bool {
+	return err == syscall.EWOULDBLOCK
+}
+
+// lockUnsupported reports whether err means the file system doesn't support
+// locks, e.g. some network file systems.
+func lockUnsupported(err error) bool {
+	return err == syscall.ENOLCK || err == syscall.EOPNOTSUPP || err == syscall.ENOTSUP
+}
@@ -0,0 +1,75 @@
+package file
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// File locking API.
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorInvalidFunction = syscall.Errno(1)
+	errorLockViolation   = syscall.Errno(33)
+	errorNotSupported    = syscall.Errno(50)
+
+	// allBytes locks the whole file, whatever its size.
+	allBytes = ^uint32(0)
+)
+
+// openLock opens the file name to lock it. Unlike os.Open, the file can be
+// deleted or renamed over while it is open.
+func openLock(name string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(h), name), nil
+}
+
+func lockFile(f *os.File, exclusive bool) error {
+	flags := uintptr(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	ol := new(syscall.Overlapped)
+	r, _, err := procLockFileEx.Call(f.Fd(), flags, 0, uintptr(allBytes), uintptr(allBytes), uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	ol := new(syscall.Overlapped)
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, uintptr(allBytes), uintptr(allBytes), uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// isLocked reports whether err means another process holds a conflicting lock.
+func isLocked(err error) bool {
+	return err == errorLockViolation
+}
+
+// lockUnsupported reports whether err means the file system doesn't support
+// locks.
+func lockUnsupported(err error) bool {
+	return err == errorNotSupported || err == errorInvalidFunction
+}
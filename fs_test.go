@@ -0,0 +1,81 @@
+package celo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEncryptFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"notes.txt":       {Data: []byte("attack at dawn")},
+		"docs/draft.txt":  {Data: []byte("book draft")},
+		"docs/image.png":  {Data: []byte{0x89, 'P', 'N', 'G'}},
+		"docs/empty.txt":  {Data: []byte{}},
+		"docs/nested.txt": {Mode: os.ModeDir},
+	}
+	dir := t.TempDir()
+
+	names, errs := NewEncrypter().EncryptFS([]byte("secret"), fsys, "docs/*.txt", dir, false)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	want := []string{
+		filepath.Join(dir, "docs", "draft.txt.celo"),
+		filepath.Join(dir, "docs", "empty.txt.celo"),
+	}
+	if len(names) != len(want) {
+		t.Fatalf("got files %v, want %v", names, want)
+	}
+	for i, name := range names {
+		if name != want[i] {
+			t.Errorf("got file %q, want %q", name, want[i])
+		}
+
+		got, err := readSealed(t, NewDecrypter(), []byte("secret"), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := filepath.ToSlash(name[len(dir)+1 : len(name)-len(".celo")])
+		if !bytes.Equal(got, fsys[source].Data) {
+			t.Errorf("%s: got %q, want %q", source, got, fsys[source].Data)
+		}
+	}
+}
+
+func TestEncryptFSErrors(t *testing.T) {
+	fsys := fstest.MapFS{"notes.txt": {Data: []byte("attack at dawn")}}
+	dir := t.TempDir()
+
+	names, errs := NewEncrypter().EncryptFS([]byte("secret"), fsys, "*.md", dir, false)
+	if len(names) != 0 || len(errs) != 0 {
+		t.Errorf("no match: got files %v and errors %v", names, errs)
+	}
+
+	_, errs = NewEncrypter().EncryptFS([]byte("secret"), fsys, "[", dir, false)
+	if len(errs) != 1 || !errors.Is(errors.Pattern, errs[0]) {
+		t.Errorf("bad pattern: got errors %v, want kind Pattern", errs)
+	}
+
+	if _, errs = NewEncrypter().EncryptFS([]byte("secret"), fsys, "*.txt", dir, false); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// An existing file is only replaced with overwrite.
+	_, errs = NewEncrypter().EncryptFS([]byte("secret"), fsys, "*.txt", dir, false)
+	if len(errs) != 1 || !errors.Is(errors.Exist, errs[0].(*errors.Error).Err) {
+		t.Errorf("existing file: got errors %v, want kind Exist", errs)
+	}
+	names, errs = NewEncrypter().EncryptFS([]byte("other"), fsys, "*.txt", dir, true)
+	if len(names) != 1 || len(errs) != 0 {
+		t.Fatalf("overwrite: got files %v and errors %v", names, errs)
+	}
+	if _, err := readSealed(t, NewDecrypter(), []byte("other"), names[0]); err != nil {
+		t.Errorf("overwritten file: %v", err)
+	}
+}
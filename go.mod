@@ -2,9 +2,18 @@ module github.com/rrivera/celo
 
 go 1.21.5
 
-require golang.org/x/crypto v0.18.0
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/crypto v0.24.0
+	golang.org/x/term v0.21.0
+	google.golang.org/grpc v1.66.2
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/term v0.16.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240604185151-ef581f913117 // indirect
 )
@@ -0,0 +1,171 @@
+package celo
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Info describes an encrypted file without decrypting it (See Inspect).
+type Info struct {
+	// Version of the format of the file.
+	Version int
+	// Cipher name of the cipher that encrypted the payload, e.g. AES-256-GCM.
+	Cipher string
+
+	// KDF key derivation function that derives keys from secret phrases and
+	// its parameters, those of the first phrase stanza when there are more.
+	// Empty if the file can't be decrypted with a phrase.
+	KDF string
+
+	SaltSize  int
+	BlockSize int
+	NonceSize int
+
+	// Padding scheme applied to the plaintext.
+	Padding Padding
+
+	// Envelope reports whether the payload is encrypted with a data key
+	// wrapped for each of the Recipients.
+	Envelope bool
+	// Recipients type of each stanza of the recipients section.
+	Recipients []StanzaType
+
+	// ChunkSize size of the plaintext chunks, 0 if the payload isn't chunked.
+	ChunkSize int
+
+	// Signed reports whether the file ends with a signature block. The
+	// signature isn't verified.
+	Signed bool
+	// Trailer reports whether the payload is followed by a trailer with its
+	// size and checksum.
+	Trailer bool
+	// Archive reports whether the plaintext is a tar archive of a directory
+	// (See Encrypter.EncryptDir).
+	Archive bool
+
+	// HeaderSize size of the metadata and recipients section, or salt.
+	HeaderSize int
+	// PayloadSize size of the encrypted payload, including nonces and
+	// authentication tags.
+	PayloadSize int64
+	// Size total size of the file.
+	Size int64
+}
+
+// KeyDerivation describes the key derivation of GenerateKey, with the
+// DefaultKDFParams, as Info.KDF does for the files that use it.
+func KeyDerivation() string {
+	return DefaultKDFParams().String()
+}
+
+// Inspect decodes the metadata and recipients section of an encrypted file and
+// reads the rest of r to measure the payload. No phrase is required and
+// nothing is decrypted, so it can be used to triage files before attempting to
+// decrypt them.
+// If the file is truncated, the decoded Info is returned along with an error of
+// kind errors.Truncated.
+func Inspect(r io.Reader) (Info, error) {
+	op := errors.Op("inspect.Inspect")
+	info := Info{}
+
+	m, n, err := DecodeMetadata(r)
+	if err != nil {
+		return info, err
+	}
+
+	info.Version = int(m.Version())
+	info.SaltSize = m.SaltSize()
+	info.BlockSize = m.BlockSize()
+	info.NonceSize = m.NonceSize()
+	info.Cipher = fmt.Sprintf("AES-%d-GCM", info.BlockSize*8)
+	info.Padding = m.Padding()
+	info.Envelope = m.hasFlag(flagEnvelope)
+	info.ChunkSize = m.chunkSize()
+	info.Signed = m.hasFlag(flagSigned)
+	info.Trailer = m.hasFlag(flagTrailer)
+	info.Archive = m.hasFlag(flagArchive)
+
+	if info.Envelope {
+		stanzas, sn, err := readStanzas(r)
+		n += sn
+		if err != nil {
+			return info, err
+		}
+		for _, s := range stanzas {
+			info.Recipients = append(info.Recipients, s.Type)
+			if !s.Type.isPhrase() || info.KDF != "" {
+				continue
+			}
+			if ps, err := parsePhrase(s, m); err == nil {
+				info.KDF = ps.kdf.String()
+			}
+		}
+	} else {
+		info.KDF = KeyDerivation()
+		sn, err := io.ReadFull(r, make([]byte, info.SaltSize))
+		n += sn
+		if err != nil {
+			return info, errors.E(errors.Salt, op, err)
+		}
+	}
+	info.HeaderSize = n
+
+	tailSize := 0
+	if info.Signed {
+		tailSize += SignatureBlockSize
+	}
+	if info.Trailer {
+		tailSize += TrailerSize
+	}
+
+	size, tail, err := readTail(r, tailSize)
+	if err != nil {
+		return info, errors.E(errors.Ciphertext, op, err)
+	}
+	info.Size = int64(n) + size
+
+	if len(tail) < tailSize {
+		return info, errors.E(errors.Truncated, op)
+	}
+	info.PayloadSize = size - int64(tailSize)
+
+	if info.Trailer {
+		if _, err = parseTrailer(tail[:TrailerSize], info.PayloadSize); err != nil {
+			return info, err
+		}
+	}
+
+	return info, nil
+}
+
+// readTail reads r until EOF, keeping only the last n bytes.
+// It returns the number of bytes read and the last n bytes, or less if r is
+// shorter.
+func readTail(r io.Reader, n int) (size int64, tail []byte, err error) {
+	buf := make([]byte, 32*1024)
+	tail = make([]byte, 0, n)
+
+	for {
+		k, err := r.Read(buf)
+		size += int64(k)
+
+		if k >= n {
+			tail = append(tail[:0], buf[k-n:k]...)
+		} else if k > 0 {
+			// Keep the last n-k bytes of the previous tail.
+			if drop := len(tail) + k - n; drop > 0 {
+				tail = append(tail[:0], tail[drop:]...)
+			}
+			tail = append(tail, buf[:k]...)
+		}
+
+		if err == io.EOF {
+			return size, tail, nil
+		}
+		if err != nil {
+			return size, tail, err
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package celo
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	k, _ := GenerateSigningKey()
+	id, _ := GenerateX25519Identity()
+	plaintext := randomPlaintext(1000)
+
+	e := NewEncrypter()
+	e.Config(SetPadding(PaddingBlock), SetBlockSize(Aes128BlockSize), SignWith(k), AddRecipient(id.Recipient()))
+	file := sealFile(t, e, []byte("secret"), plaintext)
+
+	info, err := Inspect(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Info{
+		Version:    2,
+		Cipher:     "AES-128-GCM",
+		KDF:        "argon2id (time 1, memory 64 MiB, threads 4)",
+		SaltSize:   SaltSize,
+		BlockSize:  Aes128BlockSize,
+		NonceSize:  NonceSize,
+		Padding:    PaddingBlock,
+		Envelope:   true,
+		Recipients: []StanzaType{StanzaPhraseKDF, StanzaX25519},
+		ChunkSize:  testChunkSize,
+		Signed:     true,
+		Trailer:    true,
+		Size:       int64(len(file)),
+	}
+	// One chunk of the padded plaintext.
+	want.PayloadSize = int64(NonceSize) + PaddedSize(int64(len(plaintext)), PaddingBlock) + TagSize
+	want.HeaderSize = len(file) - int(want.PayloadSize) - TrailerSize - SignatureBlockSize
+
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
+
+func TestInspectKDF(t *testing.T) {
+	id, _ := GenerateX25519Identity()
+	e := NewEncrypter()
+	e.Config(AddRecipient(id.Recipient()))
+
+	// Files encrypted only for public keys don't derive keys from a phrase.
+	info, err := Inspect(bytes.NewReader(sealFile(t, e, nil, []byte("attack at dawn"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.KDF != "" {
+		t.Errorf("got KDF %q, want none", info.KDF)
+	}
+}
+
+func TestKeyDerivation(t *testing.T) {
+	e := NewEncrypter()
+	info, err := Inspect(bytes.NewReader(sealFile(t, e, []byte("secret"), []byte("attack at dawn"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := KeyDerivation(); got != info.KDF || !strings.HasPrefix(got, "argon2id") {
+		t.Errorf("KeyDerivation() = %q, want the KDF of the files, %q", got, info.KDF)
+	}
+}
+
+func TestInspectNotCelo(t *testing.T) {
+	for _, b := range [][]byte{nil, []byte("plain text"), bytes.Repeat([]byte{0}, 64)} {
+		if _, err := Inspect(bytes.NewReader(b)); err == nil {
+			t.Errorf("%q: no error", b)
+		}
+	}
+}
+
+func TestReadTail(t *testing.T) {
+	b := randomPlaintext(100 * 1024)
+
+	for _, n := range []int{0, 1, 48, 32 * 1024, 200 * 1024} {
+		size, tail, err := readTail(bytes.NewReader(b), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := b
+		if n < len(b) {
+			want = b[len(b)-n:]
+		}
+		if size != int64(len(b)) || !bytes.Equal(tail, want) {
+			t.Errorf("n %d: got size %d and %d bytes of tail", n, size, len(tail))
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package celo
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// maxCachedKeys default maximum number of keys kept by a KeyCache, the oldest
+// key is evicted first.
+const maxCachedKeys = 32
+
+// KeyCache keeps the ciphers created from keys generated from secret phrases,
+// by the digest of the phrase and the salt (See keyDigest), so files that
+// share a salt don't run the key derivation again.
+// Keys expire once they have been cached for longer than the TTL of the cache.
+// It is safe for concurrent use. Every Decrypter has its own cache, shared by
+// its clones, WithKeyCache shares one between Encrypter and Decrypter
+// instances, e.g. across the requests of a long-running service.
+type KeyCache struct {
+	mu sync.Mutex
+	// ttl how long keys are kept, forever if it is 0.
+	ttl time.Duration
+	// max number of keys kept.
+	max  int
+	keys map[string]*cachedKey
+	// digests in insertion order.
+	digests []string
+	// phrases digest of the last key generated by an Encrypter by the digest
+	// of its phrase (See preserved).
+	phrases map[string]string
+	// secret key of the digests of phrases.
+	secret []byte
+	// now returns the current time.
+	now func() time.Time
+}
+
+// cachedKey a key kept by a KeyCache.
+type cachedKey struct {
+	cipher *Cipher
+	// salt the key was generated with.
+	salt []byte
+	// expires time when the key expires, never if it is zero.
+	expires time.Time
+}
+
+// NewKeyCache creates a KeyCache that keeps up to maxEntries keys for ttl. Keys
+// don't expire if ttl is 0, and a default of 32 keys are kept if maxEntries
+// isn't positive.
+func NewKeyCache(ttl time.Duration, maxEntries int) *KeyCache {
+	if maxEntries <= 0 {
+		maxEntries = maxCachedKeys
+	}
+
+	secret := make([]byte, 32)
+	// The secret only prevents phrases from being guessed from their
+	// digests, which are never exposed.
+	rand.Read(secret)
+
+	return &KeyCache{
+		ttl:     ttl,
+		max:     maxEntries,
+		keys:    map[string]*cachedKey{},
+		phrases: map[string]string{},
+		secret:  secret,
+		now:     time.Now,
+	}
+}
+
+// Len returns the number of keys in the cache that haven't expired.
+func (k *KeyCache) Len() int {
+	if k == nil {
+		return 0
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.expire()
+	return len(k.digests)
+}
+
+// Clear removes every key.
+func (k *KeyCache) Clear() {
+	if k == nil {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = map[string]*cachedKey{}
+	k.phrases = map[string]string{}
+	k.digests = nil
+}
+
+// get returns the cipher of the key identified by digest, or nil.
+func (k *KeyCache) get(digest []byte) *Cipher {
+	if k == nil {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.expire()
+	if key, ok := k.keys[string(digest)]; ok {
+		return key.cipher
+	}
+	return nil
+}
+
+// put adds the cipher of the key identified by digest, generated with salt.
+// A nil KeyCache doesn't keep anything.
+func (k *KeyCache) put(digest, salt []byte, cipher *Cipher) {
+	if k == nil {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.expire()
+	if _, ok := k.keys[string(digest)]; ok {
+		return
+	}
+
+	if len(k.digests) == k.max {
+		k.remove(k.digests[0])
+	}
+
+	key := &cachedKey{cipher: cipher, salt: append([]byte(nil), salt...)}
+	if k.ttl > 0 {
+		key.expires = k.now().Add(k.ttl)
+	}
+	k.keys[string(digest)] = key
+	k.digests = append(k.digests, string(digest))
+}
+
+// preserve records the key identified by digest as the last key generated
+// from secretPhrase with the parameters p by an Encrypter, so it can be reused
+// with PreserveKey.
+func (k *KeyCache) preserve(secretPhrase []byte, p KDFParams, digest []byte) {
+	if k == nil {
+		return
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[string(digest)]; ok {
+		k.phrases[string(keyDigest(secretPhrase, k.secret, p))] = string(digest)
+	}
+}
+
+// preserved returns the salt and cipher of the last key generated from
+// secretPhrase with the parameters p by an Encrypter (See preserve), or nil if
+// there isn't one.
+func (k *KeyCache) preserved(secretPhrase []byte, p KDFParams) (salt []byte, cipher *Cipher) {
+	if k == nil {
+		return nil, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.expire()
+	key, ok := k.keys[k.phrases[string(keyDigest(secretPhrase, k.secret, p))]]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), key.salt...), key.cipher
+}
+
+// expire removes the keys that have expired. The caller must hold k.mu.
+func (k *KeyCache) expire() {
+	if k.ttl <= 0 {
+		return
+	}
+
+	now := k.now()
+	// Keys expire in insertion order.
+	for len(k.digests) > 0 && !now.Before(k.keys[k.digests[0]].expires) {
+		k.remove(k.digests[0])
+	}
+}
+
+// remove removes the key identified by digest. The caller must hold k.mu.
+func (k *KeyCache) remove(digest string) {
+	delete(k.keys, digest)
+	for i, d := range k.digests {
+		if d == digest {
+			k.digests = append(k.digests[:i], k.digests[i+1:]...)
+			break
+		}
+	}
+	for p, d := range k.phrases {
+		if d == digest {
+			delete(k.phrases, p)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package celo
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDecrypterKeyCache(t *testing.T) {
+	// Two batches of files, each batch shares a salt.
+	a, b := NewEncrypter(), NewEncrypter()
+	for _, e := range []*Encrypter{a, b} {
+		if err := e.Config(PreserveKey(true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a1 := sealFile(t, a, []byte("secret"), []byte("a1"))
+	b1 := sealFile(t, b, []byte("secret"), []byte("b1"))
+	a2 := sealFile(t, a, []byte("secret"), []byte("a2"))
+
+	d := NewDecrypter()
+	if _, err := openFile(d, []byte("secret"), a1); err != nil {
+		t.Fatal(err)
+	}
+	cipher := d.cipher
+	if _, err := openFile(d, []byte("secret"), b1); err != nil {
+		t.Fatal(err)
+	}
+	if d.cipher == cipher {
+		t.Fatal("files with different salts decrypted with the same key")
+	}
+
+	// The key of the first batch is reused even though it isn't the last one.
+	if _, err := openFile(d, []byte("secret"), a2); err != nil {
+		t.Fatal(err)
+	}
+	if d.cipher != cipher {
+		t.Error("key regenerated for a cached phrase and salt")
+	}
+
+	// Clones share the keys.
+	c := d.Clone()
+	if _, err := openFile(c, []byte("secret"), b1); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.keys.get(c.keyDigest); got == nil || got != c.cipher {
+		t.Error("key of a clone not cached")
+	}
+
+	// A different phrase doesn't match the cached key.
+	if _, err := openFile(d, []byte("other"), a2); err == nil {
+		t.Error("decrypted with the wrong phrase")
+	}
+
+	d.Wipe()
+	if c.keys.get(keyDigest([]byte("secret"), c.salt, c.kdf)) != nil {
+		t.Error("keys not forgotten by Wipe")
+	}
+}
+
+func TestKeyCacheEviction(t *testing.T) {
+	k := NewKeyCache(0, 0)
+	ciphers := make([]*Cipher, maxCachedKeys+1)
+	for i := range ciphers {
+		ciphers[i] = &Cipher{}
+		k.put([]byte(fmt.Sprint(i)), nil, ciphers[i])
+	}
+
+	if k.get([]byte("0")) != nil {
+		t.Error("oldest key not evicted")
+	}
+	for i := 1; i < len(ciphers); i++ {
+		if k.get([]byte(fmt.Sprint(i))) != ciphers[i] {
+			t.Errorf("key %d evicted", i)
+		}
+	}
+
+	// A nil cache doesn't keep anything.
+	var nilCache *KeyCache
+	nilCache.put([]byte("0"), nil, ciphers[0])
+	if nilCache.get([]byte("0")) != nil {
+		t.Error("nil cache returned a key")
+	}
+}
+
+func TestKeyCacheTTL(t *testing.T) {
+	now := time.Now()
+	k := NewKeyCache(time.Minute, 2)
+	k.now = func() time.Time { return now }
+
+	a, b, c := &Cipher{}, &Cipher{}, &Cipher{}
+	k.put([]byte("a"), nil, a)
+	now = now.Add(30 * time.Second)
+	k.put([]byte("b"), nil, b)
+
+	if k.get([]byte("a")) != a || k.get([]byte("b")) != b || k.Len() != 2 {
+		t.Fatal("keys not cached")
+	}
+
+	// The first key expires, the second one is still valid.
+	now = now.Add(30 * time.Second)
+	if k.get([]byte("a")) != nil {
+		t.Error("expired key returned")
+	}
+	if k.get([]byte("b")) != b || k.Len() != 1 {
+		t.Error("valid key expired")
+	}
+
+	// At most 2 keys are kept.
+	k.put([]byte("a"), nil, a)
+	k.put([]byte("c"), nil, c)
+	if k.get([]byte("b")) != nil || k.Len() != 2 {
+		t.Error("oldest key not evicted")
+	}
+
+	k.Clear()
+	if k.get([]byte("c")) != nil || k.Len() != 0 {
+		t.Error("keys not cleared")
+	}
+}
+
+func TestWithKeyCache(t *testing.T) {
+	k := NewKeyCache(time.Hour, 0)
+	m := &recordedMetrics{}
+
+	e := NewEncrypter()
+	if err := e.Config(WithKeyCache(k), PreserveKey(true), WithMetrics(m)); err != nil {
+		t.Fatal(err)
+	}
+	file := sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+
+	// Another Encrypter reuses the key generated for the same phrase.
+	other := NewEncrypter()
+	other.Config(WithKeyCache(k), PreserveKey(true), WithMetrics(m))
+	sealFile(t, other, []byte("secret"), []byte("attack at dusk"))
+	if !bytes.Equal(other.salt, e.salt) {
+		t.Error("key of another Encrypter not reused")
+	}
+
+	// A Decrypter decrypts the file with the cached key.
+	d := NewDecrypter()
+	d.Config(WithKeyCache(k), WithMetrics(m))
+	if _, err := openFile(d, []byte("secret"), file); err != nil {
+		t.Fatal(err)
+	}
+	if m.keys != 1 {
+		t.Errorf("%d keys derived, want 1", m.keys)
+	}
+
+	// A different phrase doesn't match the cached key.
+	sealFile(t, other, []byte("other"), []byte("attack at dusk"))
+	if bytes.Equal(other.salt, e.salt) || m.keys != 2 {
+		t.Error("key reused for a different phrase")
+	}
+
+	// Instances don't clear a shared cache.
+	d.Wipe()
+	if k.Len() != 2 {
+		t.Errorf("%d cached keys, want 2", k.Len())
+	}
+
+	// Without PreserveKey every file gets its own salt.
+	fresh := NewEncrypter()
+	fresh.Config(WithKeyCache(k))
+	sealFile(t, fresh, []byte("secret"), []byte("attack at dawn"))
+	if bytes.Equal(fresh.salt, e.salt) {
+		t.Error("key reused without PreserveKey")
+	}
+}
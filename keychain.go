@@ -0,0 +1,115 @@
+package celo
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// KeychainService service the phrases are stored under in the keychain, each
+// one with its own name as the account.
+const KeychainService = "celo"
+
+// KeychainPhrase is a PhraseProvider that reads the phrase stored with its
+// Name in the keychain of the OS: the macOS Keychain (security), the Windows
+// Credential Manager or a freedesktop Secret Service such as GNOME Keyring or
+// KWallet (secret-tool). The phrase is never written to a file in plaintext.
+// If it isn't stored yet, it is asked to Ask with confirmation and stored.
+type KeychainPhrase struct {
+	// Name of the phrase in the keychain.
+	Name string
+	// Ask provides the phrase when it isn't in the keychain.
+	Ask PhraseProvider
+}
+
+// Phrase returns the phrase stored in the keychain, or asks for it and stores
+// it if there isn't one.
+// It returns an error of kind errors.PhraseOther if the keychain can't be
+// used.
+func (k KeychainPhrase) Phrase(confirm bool) ([]byte, error) {
+	op := errors.Op("keychain.Phrase")
+
+	phrase, err := KeychainGet(k.Name)
+	switch {
+	case err == nil:
+		return phrase, nil
+	case !errors.Is(errors.NotExist, err) || k.Ask == nil:
+		return nil, errors.E(op, err)
+	}
+
+	// A phrase that is going to be reused is always confirmed.
+	if phrase, err = k.Ask.Phrase(true); err != nil {
+		return nil, errors.E(op, err)
+	}
+	if err = KeychainSet(k.Name, phrase); err != nil {
+		ZeroBytes(phrase)
+		return nil, errors.E(op, err)
+	}
+	return phrase, nil
+}
+
+// KeychainGet returns the phrase stored with name in the keychain of the OS
+// (See KeychainPhrase).
+// It returns an error of kind errors.NotExist if there isn't one and of kind
+// errors.PhraseOther if the keychain can't be used.
+func KeychainGet(name string) ([]byte, error) {
+	op := errors.Op("keychain.KeychainGet")
+	if err := checkKeychainName(name); err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	phrase, err := keychainGet(name)
+	if err != nil {
+		return nil, errors.E(op, errors.Entity(name), err)
+	}
+	if len(phrase) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, op, errors.Entity(name), errors.Errorf("the phrase in the keychain is empty"))
+	}
+	return phrase, nil
+}
+
+// KeychainSet stores phrase with name in the keychain of the OS, replacing the
+// one stored before (See KeychainPhrase).
+// It returns an error of kind errors.PhraseOther if the keychain can't be
+// used.
+func KeychainSet(name string, phrase []byte) error {
+	op := errors.Op("keychain.KeychainSet")
+	if err := checkKeychainName(name); err != nil {
+		return errors.E(op, err)
+	}
+	if len(phrase) == 0 {
+		return errors.E(errors.PhraseIsEmpty, op, errors.Entity(name))
+	}
+
+	if err := keychainSet(name, phrase); err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+	return nil
+}
+
+// KeychainDelete removes the phrase stored with name from the keychain of the
+// OS (See KeychainPhrase).
+// It returns an error of kind errors.NotExist if there isn't one and of kind
+// errors.PhraseOther if the keychain can't be used.
+func KeychainDelete(name string) error {
+	op := errors.Op("keychain.KeychainDelete")
+	if err := checkKeychainName(name); err != nil {
+		return errors.E(op, err)
+	}
+
+	if err := keychainDelete(name); err != nil {
+		return errors.E(op, errors.Entity(name), err)
+	}
+	return nil
+}
+
+// checkKeychainName returns an error of kind errors.Invalid if name is empty
+// or has characters the keychain tools can't be given, such as quotes or line
+// breaks.
+func checkKeychainName(name string) error {
+	if name == "" || strings.ContainsAny(name, `"'\`) || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return errors.E(errors.Invalid, errors.Errorf("invalid keychain name %q", name))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package celo
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// securityTool program that speaks to the macOS Keychain.
+var securityTool = "security"
+
+// errSecItemNotFound exit code of security when the phrase isn't stored.
+const errSecItemNotFound = 44
+
+// keychainMissing reports whether security exited with code because the
+// phrase isn't stored.
+func keychainMissing(code int, msg string) bool {
+	return code == errSecItemNotFound
+}
+
+func keychainGet(name string) ([]byte, error) {
+	phrase, _, err := runKeychain(nil, securityTool, "find-generic-password", "-s", KeychainService, "-a", name, "-w")
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(phrase, []byte("\n")), nil
+}
+
+func keychainSet(name string, phrase []byte) error {
+	// The command is written to an interactive session so the phrase never
+	// shows up in the arguments of a process; in hexadecimal, so it doesn't
+	// need quoting. checkKeychainName rejects names that need it.
+	prefix := `add-generic-password -U -s "` + KeychainService + `" -a "` + name + `" -X `
+	cmd := make([]byte, len(prefix)+hex.EncodedLen(len(phrase))+1)
+	n := copy(cmd, prefix)
+	n += hex.Encode(cmd[n:], phrase)
+	cmd[n] = '\n'
+	defer ZeroBytes(cmd)
+
+	// Interactive sessions exit successfully even if a command fails, only
+	// its message tells.
+	_, msg, err := runKeychain(cmd, securityTool, "-i")
+	if err == nil && msg != "" {
+		err = errors.E(errors.PhraseOther, errors.Errorf("%s: %s", securityTool, msg))
+	}
+	return err
+}
+
+func keychainDelete(name string) error {
+	_, _, err := runKeychain(nil, securityTool, "delete-generic-password", "-s", KeychainService, "-a", name)
+	return err
+}
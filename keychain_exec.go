@@ -0,0 +1,39 @@
+//go:build !windows
+
+package celo
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// runKeychain runs the keychain tool program with args, writing stdin to it,
+// and returns what it writes to Stdout and its message on Stderr, if any.
+// It returns an error of kind errors.NotExist if the tool reports that the
+// phrase isn't stored (See keychainMissing) and of kind errors.PhraseOther if
+// it fails otherwise.
+func runKeychain(stdin []byte, program string, args ...string) ([]byte, string, error) {
+	cmd := exec.Command(program, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err := cmd.Run()
+	msg := strings.TrimSpace(stderr.String())
+	if exit, ok := err.(*exec.ExitError); ok {
+		if keychainMissing(exit.ExitCode(), msg) {
+			return nil, "", errors.E(errors.NotExist, errors.Errorf("the phrase isn't in the keychain"))
+		}
+		if msg != "" {
+			err = errors.Errorf("%s: %s", program, msg)
+		}
+	}
+	if err != nil {
+		ZeroBytes(stdout.Bytes())
+		return nil, "", errors.E(errors.PhraseOther, err)
+	}
+	return stdout.Bytes(), msg, nil
+}
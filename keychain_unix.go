@@ -0,0 +1,36 @@
+//go:build !darwin && !windows
+
+package celo
+
+// secretTool program that speaks to the freedesktop Secret Service.
+var secretTool = "secret-tool"
+
+// keychainMissing reports whether secret-tool exited with code because the
+// phrase isn't stored: it fails without a message.
+func keychainMissing(code int, msg string) bool {
+	return code == 1 && msg == ""
+}
+
+func keychainGet(name string) ([]byte, error) {
+	// secret-tool prints the phrase as it was stored.
+	phrase, _, err := runKeychain(nil, secretTool, "lookup", "service", KeychainService, "account", name)
+	return phrase, err
+}
+
+func keychainSet(name string, phrase []byte) error {
+	// The phrase is read from Stdin, so it never shows up in the arguments
+	// of a process.
+	_, _, err := runKeychain(phrase, secretTool, "store", "--label="+KeychainService+": "+name, "service", KeychainService, "account", name)
+	return err
+}
+
+func keychainDelete(name string) error {
+	// secret-tool doesn't report missing phrases when clearing them.
+	phrase, err := keychainGet(name)
+	if err != nil {
+		return err
+	}
+	ZeroBytes(phrase)
+	_, _, err = runKeychain(nil, secretTool, "clear", "service", KeychainService, "account", name)
+	return err
+}
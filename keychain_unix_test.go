@@ -0,0 +1,126 @@
+//go:build !darwin && !windows
+
+package celo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// fakeSecretTool is a secret-tool that stores each phrase in a file named
+// after its account, next to it.
+const fakeSecretTool = `#!/bin/sh
+dir=$(dirname "$0")
+cmd=$1
+shift
+[ "$cmd" = store ] && shift
+[ "$1 $2 $3" = "service celo account" ] || { echo "bad attributes: $*" >&2; exit 2; }
+item="$dir/item-$4"
+case "$cmd" in
+lookup) [ -f "$item" ] || exit 1; cat "$item";;
+store) cat > "$item";;
+clear) rm -f "$item";;
+esac
+`
+
+// newFakeSecretTool makes the keychain functions use a fake secret-tool.
+func newFakeSecretTool(t *testing.T) {
+	t.Helper()
+	program := filepath.Join(t.TempDir(), "secret-tool")
+	if err := os.WriteFile(program, []byte(fakeSecretTool), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := secretTool
+	secretTool = program
+	t.Cleanup(func() { secretTool = old })
+}
+
+func TestKeychain(t *testing.T) {
+	newFakeSecretTool(t)
+
+	if _, err := KeychainGet("work"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("missing phrase: got error %v, want kind NotExist", err)
+	}
+	if err := KeychainSet("work", []byte("otter quilt\nlemon")); err != nil {
+		t.Fatal(err)
+	}
+	phrase, err := KeychainGet("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(phrase) != "otter quilt\nlemon" {
+		t.Errorf("got phrase %q", phrase)
+	}
+
+	if err = KeychainDelete("work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = KeychainGet("work"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("deleted phrase: got error %v, want kind NotExist", err)
+	}
+	if err = KeychainDelete("work"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("delete missing phrase: got error %v, want kind NotExist", err)
+	}
+}
+
+func TestKeychainPhrase(t *testing.T) {
+	newFakeSecretTool(t)
+
+	// The phrase is asked with confirmation the first time only.
+	asked := 0
+	k := KeychainPhrase{Name: "work", Ask: PhraseFunc(func(confirm bool) ([]byte, error) {
+		asked++
+		if !confirm {
+			t.Error("phrase asked without confirmation")
+		}
+		return []byte("otter-quilt-lemon-pylon"), nil
+	})}
+	for i := 0; i < 2; i++ {
+		phrase, err := k.Phrase(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(phrase) != "otter-quilt-lemon-pylon" {
+			t.Errorf("got phrase %q", phrase)
+		}
+	}
+	if asked != 1 {
+		t.Errorf("phrase asked %d times, want 1", asked)
+	}
+
+	// Errors asking for the phrase don't store anything.
+	k = KeychainPhrase{Name: "home", Ask: PhraseFunc(func(bool) ([]byte, error) {
+		return nil, errors.E(errors.Canceled)
+	})}
+	if _, err := k.Phrase(false); !errors.Is(errors.Canceled, err) {
+		t.Errorf("canceled: got error %v, want kind Canceled", err)
+	}
+	if _, err := KeychainGet("home"); !errors.Is(errors.NotExist, err) {
+		t.Errorf("canceled: got error %v, want kind NotExist", err)
+	}
+
+	if _, err := (KeychainPhrase{Name: "home"}).Phrase(false); !errors.Is(errors.NotExist, err) {
+		t.Errorf("without Ask: got error %v, want kind NotExist", err)
+	}
+}
+
+func TestKeychainErrors(t *testing.T) {
+	for _, name := range []string{"", `a"b`, "a\nb", `a\b`} {
+		if _, err := KeychainGet(name); !errors.Is(errors.Invalid, err) {
+			t.Errorf("name %q: got error %v, want kind Invalid", name, err)
+		}
+	}
+
+	newFakeSecretTool(t)
+	if err := KeychainSet("work", nil); !errors.Is(errors.PhraseIsEmpty, err) {
+		t.Errorf("empty phrase: got error %v, want kind PhraseIsEmpty", err)
+	}
+
+	secretTool = filepath.Join(t.TempDir(), "missing")
+	if _, err := KeychainGet("work"); !errors.Is(errors.PhraseOther, err) {
+		t.Errorf("missing tool: got error %v, want kind PhraseOther", err)
+	}
+}
@@ -0,0 +1,104 @@
+package celo
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Credential Manager API.
+var (
+	advapi32      = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead  = advapi32.NewProc("CredReadW")
+	procCredWrite = advapi32.NewProc("CredWriteW")
+	procCredDel   = advapi32.NewProc("CredDeleteW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// credential CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credentialTarget name of the credential of the phrase stored with name.
+func credentialTarget(name string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(KeychainService + ":" + name)
+}
+
+// credentialError returns err as an error of kind errors.NotExist if the
+// credential doesn't exist, of kind errors.PhraseOther otherwise.
+func credentialError(err error) error {
+	if err == errorNotFound {
+		return errors.E(errors.NotExist, errors.Errorf("the phrase isn't in the keychain"))
+	}
+	return errors.E(errors.PhraseOther, err)
+}
+
+func keychainGet(name string) ([]byte, error) {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+
+	var cred *credential
+	if r, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); r == 0 {
+		return nil, credentialError(err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	phrase := make([]byte, len(blob))
+	copy(phrase, blob)
+	ZeroBytes(blob)
+	return phrase, nil
+}
+
+func keychainSet(name string, phrase []byte) error {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return errors.E(errors.Invalid, err)
+	}
+	user, _ := syscall.UTF16PtrFromString(name)
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(phrase)),
+		CredentialBlob:     &phrase[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if r, _, err := procCredWrite.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return credentialError(err)
+	}
+	return nil
+}
+
+func keychainDelete(name string) error {
+	target, err := credentialTarget(name)
+	if err != nil {
+		return errors.E(errors.Invalid, err)
+	}
+	if r, _, err := procCredDel.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); r == 0 {
+		return credentialError(err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package celo
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/rrivera/celo/file"
+)
+
+// log records an event at the given level with the logger set with
+// WithLogger. Nothing is recorded if no logger was set.
+func (c *celo) log(level slog.Level, msg string, args ...any) {
+	if c.logger != nil {
+		c.logger.Log(context.Background(), level, msg, args...)
+	}
+}
+
+// copyTimes gives the file name the modification time of its source src if
+// PreserveTimes was used. The file is already complete, a failure is only
+// logged.
+func (c *celo) copyTimes(src *os.File, name string) {
+	if !c.preserveTimes {
+		return
+	}
+	fi, err := src.Stat()
+	if err == nil {
+		err = os.Chtimes(name, time.Now(), fi.ModTime())
+	}
+	if err != nil {
+		c.log(slog.LevelWarn, "modification time not preserved", "file", name, "error", err)
+	}
+}
+
+// removeSource removes the source file name once it was processed, shredding
+// it first if ShredSource was used.
+func (c *celo) removeSource(name string) {
+	var err error
+	if c.shredPasses > 0 {
+		err = file.Shred(name, c.shredPasses)
+	} else {
+		err = os.Remove(name)
+	}
+	if err != nil {
+		c.log(slog.LevelWarn, "source not removed", "file", name, "error", err)
+		return
+	}
+	c.log(slog.LevelInfo, "source removed", "file", name)
+}
@@ -0,0 +1,71 @@
+package celo
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plain")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := new(bytes.Buffer)
+	logger := WithLogger(slog.New(slog.NewTextHandler(b, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	e := NewEncrypter()
+	e.Config(logger)
+	encryptedName, err := e.EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clone reuses the key from the cache it shares with d.
+	d := NewDecrypter()
+	d.Config(logger)
+	for _, d := range []*Decrypter{d, d.Clone()} {
+		if _, err = d.DecryptFile([]byte("secret"), encryptedName, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		`level=DEBUG msg="file opened" file=` + name,
+		`level=DEBUG msg="key derived"`,
+		`level=INFO msg="file encrypted" file=` + name + ` output=` + encryptedName,
+		`level=INFO msg="source removed" file=` + name,
+		`level=DEBUG msg="file opened" file=` + encryptedName,
+		`level=DEBUG msg="key derived"`,
+		`level=INFO msg="file decrypted" file=` + encryptedName + ` output=` + name,
+		`level=DEBUG msg="file opened" file=` + encryptedName,
+		`level=DEBUG msg="key reused"`,
+		`level=INFO msg="file decrypted" file=` + encryptedName + ` output=` + name,
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d records, want %d:\n%s", len(lines), len(want), b)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, want[i]) {
+			t.Errorf("record %d: got %s, want %s", i, line, want[i])
+		}
+		if strings.Contains(line, "secret") || strings.Contains(line, "attack") {
+			t.Errorf("record %d leaks a secret: %s", i, line)
+		}
+	}
+
+	// A source that can't be removed is reported.
+	b.Reset()
+	d.removeSource(name + ".missing")
+	if !strings.Contains(b.String(), `level=WARN msg="source not removed"`) {
+		t.Errorf("got %q, want a warning", b)
+	}
+
+	// Nothing is recorded without a logger.
+	NewEncrypter().removeSource(name + ".missing")
+}
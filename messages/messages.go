@@ -8,6 +8,9 @@ const (
 	PhraseRead            Message = iota //
 	PhraseConfirm                        //
 	PhraseWarningMismatch                //
+	PhraseCurrent                        //
+	PhraseNew                            //
+	PhraseWarningWeak                    //
 )
 
 // Messages is a map with string values for a given Message key.
@@ -15,6 +18,9 @@ var Messages = map[Message]string{
 	PhraseRead:            "Enter Phrase:",
 	PhraseConfirm:         "Confirm Phrase:",
 	PhraseWarningMismatch: "Phrases don't match, please try again",
+	PhraseCurrent:         "Current Phrase",
+	PhraseNew:             "New Phrase",
+	PhraseWarningWeak:     "try a longer one, e.g. a few unrelated words",
 }
 
 // String returns the message string.
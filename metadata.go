@@ -2,14 +2,16 @@ package celo
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"os"
 
 	"github.com/rrivera/celo/errors"
 )
 
 // SignatureSize size of bytes used by the Celo file signature.
 //  ..CELO.. 8
-//  vsbn.... 8
+//  vsbnpfc. 8
 //  ........ 8
 //  ........ 8
 //         = 32
@@ -30,10 +32,44 @@ const (
 	nonceSizeIndex
 )
 
+// Indexes of the reserved bytes used since version 2.
+const (
+	// paddingIndex index of the reserved byte that contains the padding scheme
+	// applied to the plaintext.
+	paddingIndex = iota
+	// flagsIndex index of the reserved byte that contains the format flags.
+	flagsIndex
+	// chunkSizeIndex index of the reserved byte that contains the size of the
+	// plaintext chunks as a power of 2, when the payload is chunked.
+	chunkSizeIndex
+)
+
+// Format flags. Decoders reject files with unknown flags.
+const (
+	// flagEnvelope the payload is encrypted with a random data key, wrapped
+	// for each recipient in the recipients section that follows the signature.
+	flagEnvelope byte = 1 << iota
+	// flagSigned the file ends with an Ed25519 signature block of everything
+	// that precedes it.
+	flagSigned
+	// flagChunked the payload is split in chunks encrypted independently.
+	flagChunked
+	// flagTrailer the payload is followed by a trailer with its size and
+	// checksum (See TrailerSize).
+	flagTrailer
+	// flagArchive the plaintext is a tar archive of a directory (See
+	// Encrypter.EncryptDir).
+	flagArchive
+
+	// knownFlags flags supported by the running version of Celo.
+	knownFlags = flagEnvelope | flagSigned | flagChunked | flagTrailer | flagArchive
+)
+
 // SignatureHeader File Signature also known as Magic Bytes that identify a file
 // created by Celo.
 //  ..CELO.. <-- Signature Header
-//  vsbn.... v = version, s = saltSize, b = blockSize, n = nonceSize
+//  vsbnpfc. v = version, s = saltSize, b = blockSize, n = nonceSize,
+//           p = padding, f = flags, c = chunk size
 //  ........
 //  ........
 func SignatureHeader() [8]byte {
@@ -50,10 +86,11 @@ type Metadata struct {
 }
 
 // Bytes of the File Signature that includes metadata about the encrypted file.
-// This is how it should look using ISO 8859-1 encoding. "????" are placeholders
-// for version, saltSize, blockSize and nonceSize bytes in that order.
+// This is how it should look using ISO 8859-1 encoding. "???????" are
+// placeholders for version, saltSize, blockSize, nonceSize, padding, flags and
+// chunk size bytes in that order.
 //  ..CELO..
-//  ????....
+//  ???????.
 //  ........
 //  ........
 func (m *Metadata) Bytes() []byte {
@@ -65,10 +102,92 @@ func (m *Metadata) Bytes() []byte {
 	b[9] = m.vsbn[saltSizeIndex]
 	b[10] = m.vsbn[blockSizeIndex]
 	b[11] = m.vsbn[nonceSizeIndex]
+	copy(b[12:], m.reserved[:])
 
 	return b
 }
 
+// Version version of the format of the file.
+func (m *Metadata) Version() byte {
+	return m.vsbn[versionIndex]
+}
+
+// SaltSize size of the salt used to generate keys from phrases.
+func (m *Metadata) SaltSize() int {
+	return int(m.vsbn[saltSizeIndex])
+}
+
+// BlockSize size of the AES keys, Aes128BlockSize or Aes256BlockSize.
+func (m *Metadata) BlockSize() int {
+	return int(m.vsbn[blockSizeIndex])
+}
+
+// NonceSize size of the AES GCM nonces.
+func (m *Metadata) NonceSize() int {
+	return int(m.vsbn[nonceSizeIndex])
+}
+
+// Reserved reserved bytes of the file signature. Since version 2 they contain
+// the padding scheme, the format flags and the chunk size, the rest are 0.
+func (m *Metadata) Reserved() [20]byte {
+	return m.reserved
+}
+
+// String summary of the metadata, e.g.
+//  celo v2, AES-256-GCM, salt 32, nonce 12, padding none, envelope, chunked 65536, trailer
+func (m *Metadata) String() string {
+	s := fmt.Sprintf("celo v%d, AES-%d-GCM, salt %d, nonce %d", m.Version(), m.BlockSize()*8, m.SaltSize(), m.NonceSize())
+	if m.Version() < 2 {
+		return s
+	}
+
+	s += ", padding " + m.Padding().String()
+	if m.hasFlag(flagEnvelope) {
+		s += ", envelope"
+	}
+	if m.hasFlag(flagSigned) {
+		s += ", signed"
+	}
+	if m.hasFlag(flagChunked) {
+		s += fmt.Sprintf(", chunked %d", m.chunkSize())
+	}
+	if m.hasFlag(flagTrailer) {
+		s += ", trailer"
+	}
+	if m.hasFlag(flagArchive) {
+		s += ", archive"
+	}
+	return s
+}
+
+// Padding padding scheme applied to the plaintext.
+func (m *Metadata) Padding() Padding {
+	if m.vsbn[versionIndex] < 2 {
+		// Version 1 didn't support padding.
+		return PaddingNone
+	}
+	return Padding(m.reserved[paddingIndex])
+}
+
+// hasFlag reports whether the format flag f is set.
+func (m *Metadata) hasFlag(f byte) bool {
+	return m.vsbn[versionIndex] >= 2 && m.reserved[flagsIndex]&f != 0
+}
+
+// chunkSize size of the plaintext chunks. It returns 0 if the payload isn't
+// chunked.
+func (m *Metadata) chunkSize() int {
+	if !m.hasFlag(flagChunked) {
+		return 0
+	}
+	return 1 << m.reserved[chunkSizeIndex]
+}
+
+// setFlag sets the format flag f.
+func (m *Metadata) setFlag(f byte) {
+	m.reserved[flagsIndex] |= f
+}
+
 // Size size of the file signature.
 func (m *Metadata) Size() int {
 	return SignatureSize
@@ -91,23 +210,25 @@ func DecodeMetadata(r io.Reader) (m *Metadata, n int, err error) {
 	// First 8 bytes are the signature header used to identify a file created by
 	// celo.
 	signature := [8]byte{}
-	if n, err := io.ReadFull(r, signature[:]); err != nil {
+	if n, err = io.ReadFull(r, signature[:]); err != nil {
 		return nil, n, errors.E(errors.Metadata, op, err)
 	}
 
 	// Following 4 bytes contain the version, saltSize, blockSize, nonceSize in
 	// that order.
 	vsbn := [4]byte{}
-	if vn, err := io.ReadFull(r, vsbn[:]); err != nil {
-		return nil, n + vn, errors.E(errors.Metadata, op, err)
-	}
+	vn, err = io.ReadFull(r, vsbn[:])
 	n += vn
+	if err != nil {
+		return nil, n, errors.E(errors.Metadata, op, err)
+	}
 
 	reserved := [20]byte{}
-	if rn, err := io.ReadFull(r, reserved[:]); err != nil {
-		return nil, n + rn, errors.E(errors.Metadata, op, err)
-	}
+	rn, err = io.ReadFull(r, reserved[:])
 	n += rn
+	if err != nil {
+		return nil, n, errors.E(errors.Metadata, op, err)
+	}
 
 	// Validate that all the values present and correct;
 	// Version is supported by current Celo version and sizes are inside the
@@ -124,6 +245,43 @@ func DecodeMetadata(r io.Reader) (m *Metadata, n int, err error) {
 
 }
 
+// Sniff reports whether r starts with the signature header of a file created by
+// Celo, and the version of its format. Only the first 9 bytes are read, so
+// files that aren't encrypted by Celo can be skipped cheaply. The version isn't
+// validated, it might not be supported by the running version of Celo.
+// Readers shorter than the signature header aren't Celo files, any other read
+// error is returned with kind errors.Decode.
+func Sniff(r io.Reader) (ok bool, version byte, err error) {
+	b := [9]byte{}
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, 0, nil
+		}
+		return false, 0, errors.E(errors.Decode, errors.Op("metadata.Sniff"), err)
+	}
+
+	if !bytes.Equal(b[:8], signatureHeader[:]) {
+		return false, 0, nil
+	}
+	return true, b[8], nil
+}
+
+// IsCeloFile reports whether the file with the specified name was created by
+// Celo (See Sniff).
+func IsCeloFile(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, errors.E(errors.Open, errors.Op("metadata.IsCeloFile"), errors.Entity(name), err)
+	}
+	defer f.Close()
+
+	ok, _, err := Sniff(f)
+	if err != nil {
+		return false, errors.E(errors.Entity(name), err)
+	}
+	return ok, nil
+}
+
 // ValidateMetadata validates correctness of the signature header, version, salt
 // size, block size and nonce size.
 func ValidateMetadata(signature [8]byte, vsbn [4]byte, reserved [20]byte) error {
@@ -137,22 +295,40 @@ func ValidateMetadata(signature [8]byte, vsbn [4]byte, reserved [20]byte) error
 		return errors.E(errors.Incompatible, op)
 	}
 
-	if vsbn[blockSizeIndex] != 16 && vsbn[blockSizeIndex] != 32 {
-		return errors.E(errors.NonceSize, op)
+	if vsbn[blockSizeIndex] != Aes128BlockSize && vsbn[blockSizeIndex] != Aes256BlockSize {
+		return errors.E(errors.BlockSize, op)
+	}
+
+	if vsbn[saltSizeIndex] < MinSaltSize || vsbn[saltSizeIndex] > MaxSaltSize {
+		return errors.E(errors.SaltSize, op)
 	}
 
-	if vsbn[nonceSizeIndex] > 32 {
+	if vsbn[nonceSizeIndex] < MinNonceSize || vsbn[nonceSizeIndex] > MaxNonceSize {
 		return errors.E(errors.NonceSize, op)
 	}
 
-	// For future use. Prevent unused variable error.
-	_ = reserved
+	if vsbn[versionIndex] >= 2 && !Padding(reserved[paddingIndex]).IsValid() {
+		return errors.E(errors.Padding, op)
+	}
+
+	if vsbn[versionIndex] >= 2 && reserved[flagsIndex]&^knownFlags != 0 {
+		// The file uses features unknown to the running version of Celo.
+		return errors.E(errors.Incompatible, op)
+	}
+
+	if vsbn[versionIndex] >= 2 && reserved[flagsIndex]&flagChunked != 0 &&
+		(reserved[chunkSizeIndex] < minChunkSizeLog2 || reserved[chunkSizeIndex] > maxChunkSizeLog2) {
+		return errors.E(errors.Metadata, op, errors.Errorf("invalid chunk size"))
+	}
 
 	return nil
 }
 
-// newMetadata creates a Metadata if passed values are correct.
-func newMetadata(version, blockSize, saltSize, nonceSize byte) (m *Metadata, err error) {
+// NewMetadata creates a Metadata if passed values are correct. The reserved
+// bytes are 0, meaning no padding and no format flags for version 2 and
+// higher. Useful to produce valid headers from interoperability or migration
+// tools, most users don't need it.
+func NewMetadata(version, saltSize, blockSize, nonceSize byte) (m *Metadata, err error) {
 	vsbn := [4]byte{version, saltSize, blockSize, nonceSize}
 	reserved := [20]byte{}
 
@@ -167,13 +343,18 @@ func newMetadata(version, blockSize, saltSize, nonceSize byte) (m *Metadata, err
 	}, nil
 }
 
-// newCurrentMetadata creates a Metadata with the values of the current running
-// version of Celo (from constants).
-func newCurrentMetadata() (m *Metadata) {
-	vsbn := [4]byte{byte(Version), byte(SaltSize), byte(Aes256BlockSize), byte(NonceSize)}
+// newCurrentMetadata creates a Metadata with the version and format of the
+// current running version of Celo (from constants), the padding scheme p and
+// the sizes of c.
+func newCurrentMetadata(p Padding, c *celo) (m *Metadata) {
+	vsbn := [4]byte{byte(Version), byte(c.saltSize), byte(c.blockSize), byte(c.nonceSize)}
+	reserved := [20]byte{}
+	reserved[paddingIndex] = byte(p)
+	reserved[flagsIndex] = flagEnvelope | flagChunked | flagTrailer
+	reserved[chunkSizeIndex] = ChunkSizeLog2
 	return &Metadata{
 		signature: signatureHeader,
 		vsbn:      vsbn,
-		reserved:  [20]byte{},
+		reserved:  reserved,
 	}
 }
@@ -0,0 +1,134 @@
+package celo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestMetadataAccessors(t *testing.T) {
+	c := &celo{saltSize: SaltSize, blockSize: Aes256BlockSize, nonceSize: NonceSize}
+	m, _, err := DecodeMetadata(bytes.NewReader(newCurrentMetadata(PaddingPadme, c).Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Version() != Version || m.SaltSize() != SaltSize || m.BlockSize() != Aes256BlockSize || m.NonceSize() != NonceSize {
+		t.Errorf("got version %d, salt %d, block %d, nonce %d", m.Version(), m.SaltSize(), m.BlockSize(), m.NonceSize())
+	}
+	reserved := m.Reserved()
+	if Padding(reserved[paddingIndex]) != PaddingPadme || reserved[chunkSizeIndex] != ChunkSizeLog2 {
+		t.Errorf("unexpected reserved bytes %v", reserved)
+	}
+	want := "celo v2, AES-256-GCM, salt 32, nonce 12, padding padme, envelope, chunked 65536, trailer"
+	if s := m.String(); s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+
+	// Reserved returns a copy.
+	reserved[flagsIndex] = 0xFF
+	if m.Reserved()[flagsIndex] == 0xFF {
+		t.Error("Reserved exposes the underlying bytes")
+	}
+}
+
+func TestMetadataStringVersion1(t *testing.T) {
+	m, err := NewMetadata(1, SaltSize, Aes128BlockSize, NonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "celo v1, AES-128-GCM, salt 32, nonce 12"
+	if s := m.String(); s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+	if m.Reserved() != [20]byte{} {
+		t.Error("version 1 reserved bytes are not 0")
+	}
+}
+
+func TestNewMetadata(t *testing.T) {
+	m, err := NewMetadata(Version, MinSaltSize, Aes128BlockSize, MaxNonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, n, err := DecodeMetadata(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != SignatureSize || *decoded != *m {
+		t.Errorf("decoded %v, want %v", decoded, m)
+	}
+	if decoded.SaltSize() != MinSaltSize || decoded.BlockSize() != Aes128BlockSize || decoded.NonceSize() != MaxNonceSize {
+		t.Errorf("unexpected sizes %v", decoded)
+	}
+
+	for _, tc := range []struct {
+		version, saltSize, blockSize, nonceSize byte
+		kind                                    errors.Kind
+	}{
+		{MaxVersion + 1, SaltSize, Aes256BlockSize, NonceSize, errors.Incompatible},
+		{0, SaltSize, Aes256BlockSize, NonceSize, errors.Incompatible},
+		{Version, MinSaltSize - 1, Aes256BlockSize, NonceSize, errors.SaltSize},
+		{Version, SaltSize, 24, NonceSize, errors.BlockSize},
+		{Version, SaltSize, Aes256BlockSize, MaxNonceSize + 1, errors.NonceSize},
+	} {
+		if _, err := NewMetadata(tc.version, tc.saltSize, tc.blockSize, tc.nonceSize); !errors.Is(tc.kind, err) {
+			t.Errorf("NewMetadata(%d, %d, %d, %d): got error %v, want kind %v", tc.version, tc.saltSize, tc.blockSize, tc.nonceSize, err, tc.kind)
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	file := sealFile(t, NewEncrypter(), []byte("secret"), []byte("attack at dawn"))
+	r := bytes.NewReader(file)
+	ok, version, err := Sniff(r)
+	if err != nil || !ok || version != Version {
+		t.Errorf("got %v, %d, %v, want true, %d", ok, version, err, Version)
+	}
+	if read := len(file) - r.Len(); read != 9 {
+		t.Errorf("%d bytes read, want 9", read)
+	}
+
+	// Versions aren't validated.
+	future := append([]byte(nil), file[:9]...)
+	future[8] = MaxVersion + 1
+	if ok, version, _ = Sniff(bytes.NewReader(future)); !ok || version != MaxVersion+1 {
+		t.Errorf("got %v, %d, want true, %d", ok, version, MaxVersion+1)
+	}
+
+	for _, b := range [][]byte{nil, file[:8], []byte("attack at dawn")} {
+		if ok, _, err = Sniff(bytes.NewReader(b)); ok || err != nil {
+			t.Errorf("%q: got %v, %v, want false", b, ok, err)
+		}
+	}
+
+	if _, _, err = Sniff(iotest.ErrReader(io.ErrClosedPipe)); !errors.Is(errors.Decode, err) {
+		t.Errorf("got error %v, want kind Decode", err)
+	}
+}
+
+func TestIsCeloFile(t *testing.T) {
+	dir := t.TempDir()
+	plain, celo := filepath.Join(dir, "plain"), filepath.Join(dir, "plain."+Extension)
+	if err := os.WriteFile(plain, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(celo, sealFile(t, NewEncrypter(), []byte("secret"), []byte("attack at dawn")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := IsCeloFile(celo); !ok || err != nil {
+		t.Errorf("%s: got %v, %v, want true", celo, ok, err)
+	}
+	if ok, err := IsCeloFile(plain); ok || err != nil {
+		t.Errorf("%s: got %v, %v, want false", plain, ok, err)
+	}
+	if _, err := IsCeloFile(filepath.Join(dir, "missing")); !errors.Is(errors.Open, err) {
+		t.Errorf("got error %v, want kind Open", err)
+	}
+}
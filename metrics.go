@@ -0,0 +1,61 @@
+package celo
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Metrics receives the measurements of an Encrypter or Decrypter, so
+// applications can feed them to their monitoring system (See WithMetrics).
+// Implementations must be safe for concurrent use, batch methods share them
+// between workers.
+type Metrics interface {
+	// FileEncrypted counts a file encrypted by EncryptFile or its batch
+	// counterparts, bytes is the size of the encrypted file.
+	FileEncrypted(bytes int64)
+	// FileDecrypted counts a file decrypted by DecryptFile or its batch
+	// counterparts, bytes is the size of the decrypted file.
+	FileDecrypted(bytes int64)
+	// FileFailed counts a file that couldn't be encrypted or decrypted, err
+	// is the reason. Skipped files aren't counted (See CollisionSkip).
+	FileFailed(err error)
+	// KeyDerived observes the time spent deriving a key from a secret
+	// phrase. Reused keys aren't observed.
+	KeyDerived(d time.Duration)
+	// Ciphered observes the time spent encrypting or decrypting the content
+	// of a file, bytes is the size of the content.
+	Ciphered(d time.Duration, bytes int64)
+}
+
+// fileDone reports the outcome of encrypting (or decrypting) a file to the
+// Metrics set with WithMetrics.
+func (c *celo) fileDone(encrypt bool, n int64, err error) {
+	switch {
+	case c.metrics == nil:
+	case err != nil:
+		if !stderrors.Is(err, &errors.Error{Kind: errors.Skipped}) {
+			c.metrics.FileFailed(err)
+		}
+	case encrypt:
+		c.metrics.FileEncrypted(n)
+	default:
+		c.metrics.FileDecrypted(n)
+	}
+}
+
+// keyDerived reports the time spent deriving a key since start.
+func (c *celo) keyDerived(start time.Time) {
+	if c.metrics != nil {
+		c.metrics.KeyDerived(time.Since(start))
+	}
+}
+
+// ciphered reports the time spent encrypting or decrypting n bytes since
+// start.
+func (c *celo) ciphered(start time.Time, n int64) {
+	if c.metrics != nil {
+		c.metrics.Ciphered(time.Since(start), n)
+	}
+}
@@ -0,0 +1,111 @@
+package celo
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// recordedMetrics Metrics that records every measurement.
+type recordedMetrics struct {
+	mu                   sync.Mutex
+	encrypted, decrypted []int64
+	failed               []error
+	keys                 int
+	ciphered             []int64
+}
+
+func (m *recordedMetrics) FileEncrypted(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encrypted = append(m.encrypted, bytes)
+}
+
+func (m *recordedMetrics) FileDecrypted(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decrypted = append(m.decrypted, bytes)
+}
+
+func (m *recordedMetrics) FileFailed(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed = append(m.failed, err)
+}
+
+func (m *recordedMetrics) KeyDerived(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys++
+}
+
+func (m *recordedMetrics) Ciphered(d time.Duration, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ciphered = append(m.ciphered, bytes)
+}
+
+func TestWithMetrics(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "missing")}
+	for i, name := range names[:2] {
+		if err := os.WriteFile(name, randomPlaintext((i+1)*1000), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &recordedMetrics{}
+	e := NewEncrypter()
+	e.Config(WithMetrics(m), WithWorkers(2))
+	encrypted, _ := e.EncryptMultipleFiles([]byte("secret"), names, false, false)
+
+	if len(m.encrypted) != 2 || len(m.failed) != 1 || m.keys != 2 || len(m.ciphered) != 2 {
+		t.Errorf("got %d encrypted, %d failed, %d keys and %d ciphered, want 2, 1, 2 and 2",
+			len(m.encrypted), len(m.failed), m.keys, len(m.ciphered))
+	}
+	sizes := map[int64]bool{}
+	for _, name := range encrypted {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[fi.Size()] = true
+	}
+	for _, n := range m.encrypted {
+		if !sizes[n] {
+			t.Errorf("encrypted file of %d bytes, want one of %v", n, sizes)
+		}
+	}
+	if !errors.Is(errors.Open, m.failed[0]) {
+		t.Errorf("got error %v, want kind Open", m.failed[0])
+	}
+
+	// Skipped files aren't failures.
+	e.Config(OnCollision(CollisionSkip))
+	e.EncryptMultipleFiles([]byte("secret"), names[:2], false, false)
+	if len(m.encrypted) != 2 || len(m.failed) != 1 {
+		t.Errorf("skipped files counted: %d encrypted, %d failed", len(m.encrypted), len(m.failed))
+	}
+
+	m = &recordedMetrics{}
+	d := NewDecrypter()
+	d.Config(WithMetrics(m))
+	d.DecryptMultipleFiles([]byte("secret"), encrypted, true, false)
+	d.DecryptMultipleFiles([]byte("garbage"), encrypted[:1], true, false)
+
+	if len(m.decrypted) != 2 || len(m.failed) != 1 || len(m.ciphered) != 2 {
+		t.Errorf("got %d decrypted, %d failed and %d ciphered, want 2, 1 and 2", len(m.decrypted), len(m.failed), len(m.ciphered))
+	}
+	for i, n := range m.decrypted {
+		if n != 1000 && n != 2000 {
+			t.Errorf("%d: decrypted file of %d bytes", i, n)
+		}
+	}
+	if !errors.Is(errors.WrongPassphrase, m.failed[0]) {
+		t.Errorf("got error %v, want kind WrongPassphrase", m.failed[0])
+	}
+}
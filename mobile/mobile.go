@@ -0,0 +1,92 @@
+// Package mobile is a simplified API of celo meant to be bound with gomobile,
+// so Android and iOS apps can encrypt and decrypt local files and values.
+// It only uses types supported by gomobile: strings for file names, byte
+// slices for phrases and contents, and no variadic options. Files are
+// encrypted with the default configuration of celo.
+//
+// Build the bindings with:
+//  gomobile bind -target=android -o celo.aar github.com/rrivera/celo/mobile
+//  gomobile bind -target=ios -o Celo.xcframework github.com/rrivera/celo/mobile
+package mobile
+
+import (
+	"github.com/rrivera/celo"
+)
+
+// Version version of the format of the files encrypted by celo.
+func Version() int {
+	return celo.Version
+}
+
+// EncryptFile encrypts the file with the specified name and returns the name
+// of the encrypted file, the name of the source with the .celo extension.
+func EncryptFile(phrase []byte, name string, overwrite, removeSource bool) (string, error) {
+	e := celo.NewEncrypter()
+	defer e.Wipe()
+	return e.EncryptFile(phrase, name, overwrite, removeSource)
+}
+
+// DecryptFile decrypts the file with the specified name and returns the name
+// of the decrypted file, the name of the source without the .celo extension.
+func DecryptFile(phrase []byte, name string, overwrite, removeSource bool) (string, error) {
+	d := celo.NewDecrypter()
+	defer d.Wipe()
+	return d.DecryptFile(phrase, name, overwrite, removeSource)
+}
+
+// Encrypt encrypts plaintext and returns the encoded file.
+func Encrypt(phrase, plaintext []byte) ([]byte, error) {
+	return celo.EncryptBytes(phrase, plaintext)
+}
+
+// Decrypt decrypts an encoded file returned by Encrypt, or the content of any
+// file encrypted by celo.
+func Decrypt(phrase, blob []byte) ([]byte, error) {
+	return celo.DecryptBytes(phrase, blob)
+}
+
+// IsCeloFile reports whether the file with the specified name was encrypted by
+// celo.
+func IsCeloFile(name string) (bool, error) {
+	return celo.IsCeloFile(name)
+}
+
+// Session keeps a phrase to run many operations after it was asked once, the
+// key generated from it is reused. Close it once it is no longer needed.
+type Session struct {
+	s *celo.Session
+}
+
+// NewSession creates a Session for the phrase.
+func NewSession(phrase []byte) (*Session, error) {
+	s, err := celo.NewSession(phrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{s: s}, nil
+}
+
+// EncryptFile encrypts the file with the specified name (See EncryptFile).
+func (s *Session) EncryptFile(name string, overwrite, removeSource bool) (string, error) {
+	return s.s.EncryptFile(name, overwrite, removeSource)
+}
+
+// DecryptFile decrypts the file with the specified name (See DecryptFile).
+func (s *Session) DecryptFile(name string, overwrite, removeSource bool) (string, error) {
+	return s.s.DecryptFile(name, overwrite, removeSource)
+}
+
+// Encrypt encrypts plaintext and returns the encoded file.
+func (s *Session) Encrypt(plaintext []byte) ([]byte, error) {
+	return s.s.Encrypt(plaintext)
+}
+
+// Decrypt decrypts an encoded file.
+func (s *Session) Decrypt(blob []byte) ([]byte, error) {
+	return s.s.Decrypt(blob)
+}
+
+// Close zeroes the phrase and forgets the keys of the session.
+func (s *Session) Close() error {
+	return s.s.Close()
+}
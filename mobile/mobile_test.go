@@ -0,0 +1,66 @@
+package mobile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedName, err := EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := IsCeloFile(encryptedName); !ok || err != nil {
+		t.Errorf("IsCeloFile: got %v, %v, want true", ok, err)
+	}
+
+	if _, err = DecryptFile([]byte("wrong"), encryptedName, false, false); err == nil {
+		t.Error("decrypted with the wrong phrase")
+	}
+	decryptedName, err := DecryptFile([]byte("secret"), encryptedName, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(decryptedName); decryptedName != name || string(b) != "attack at dawn" {
+		t.Errorf("decrypted %q to %s", b, decryptedName)
+	}
+}
+
+func TestSession(t *testing.T) {
+	s, err := NewSession([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := s.Encrypt([]byte("attack at dawn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decrypt([]byte("secret"), blob)
+	if err != nil || !bytes.Equal(got, []byte("attack at dawn")) {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	if blob, err = Encrypt([]byte("secret"), []byte("attack at dusk")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.Decrypt(blob); err != nil || string(got) != "attack at dusk" {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	s.Close()
+	if _, err = s.Encrypt([]byte("attack at dawn")); err == nil {
+		t.Error("closed session encrypted")
+	}
+
+	if _, err = NewSession(nil); err == nil {
+		t.Error("session created without a phrase")
+	}
+}
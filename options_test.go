@@ -0,0 +1,561 @@
+package celo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+func TestSizeOptions(t *testing.T) {
+	tests := []struct {
+		opt  Option
+		kind errors.Kind
+	}{
+		{SetSaltSize(MinSaltSize - 1), errors.SaltSize},
+		{SetSaltSize(MaxSaltSize + 1), errors.SaltSize},
+		{SetNonceSize(MinNonceSize - 1), errors.NonceSize},
+		{SetNonceSize(MaxNonceSize + 1), errors.NonceSize},
+		{SetBlockSize(24), errors.BlockSize},
+		{SetPadding(Padding(42)), errors.Padding},
+	}
+
+	for i, tt := range tests {
+		e := NewEncrypter()
+		if err := e.Config(tt.opt); !errors.Is(tt.kind, err) {
+			t.Errorf("%d: got error %v, want kind %v", i, err, tt.kind)
+		}
+		// Invalid values aren't applied.
+		if e.SaltSize() != SaltSize || e.NonceSize() != NonceSize || e.BlockSize() != Aes256BlockSize {
+			t.Errorf("%d: sizes changed by an invalid option", i)
+		}
+	}
+
+	// Config stops at the first option that fails.
+	e := NewEncrypter()
+	err := e.Config(SetSaltSize(MaxSaltSize), SetNonceSize(0), SetBlockSize(Aes128BlockSize))
+	if !errors.Is(errors.NonceSize, err) {
+		t.Errorf("got error %v, want kind NonceSize", err)
+	}
+	if e.SaltSize() != MaxSaltSize || e.BlockSize() != Aes256BlockSize {
+		t.Error("Config didn't stop at the failing option")
+	}
+}
+
+func TestCustomSizesRoundTrip(t *testing.T) {
+	plaintext := []byte("attack at dawn")
+	configs := [][]Option{
+		{SetSaltSize(MinSaltSize), SetNonceSize(MinNonceSize), SetBlockSize(Aes128BlockSize)},
+		{SetSaltSize(MaxSaltSize), SetNonceSize(MaxNonceSize), SetBlockSize(Aes256BlockSize)},
+		{SetNonceSize(16), SetPadding(PaddingPadme)},
+	}
+
+	for i, opts := range configs {
+		e := NewEncrypter()
+		if err := e.Config(opts...); err != nil {
+			t.Fatal(err)
+		}
+
+		// The Decrypter adopts the sizes recorded in the file.
+		got, err := openFile(NewDecrypter(), []byte("secret"), sealFile(t, e, []byte("secret"), plaintext))
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("%d: got %q, want %q", i, got, plaintext)
+		}
+	}
+}
+
+func TestMalformedSizes(t *testing.T) {
+	file := sealFile(t, NewEncrypter(), []byte("secret"), []byte("attack at dawn"))
+
+	// salt, block and nonce sizes of the file signature.
+	tests := []struct {
+		index int
+		value byte
+	}{
+		{9, MinSaltSize - 1},
+		{9, 255},
+		{10, 24},
+		{11, MinNonceSize - 1},
+		{11, 255},
+	}
+
+	for _, tt := range tests {
+		malformed := append([]byte(nil), file...)
+		malformed[tt.index] = tt.value
+		if _, err := openFile(NewDecrypter(), []byte("secret"), malformed); err == nil {
+			t.Errorf("byte %d set to %d: file decrypted", tt.index, tt.value)
+		}
+		if _, err := Inspect(bytes.NewReader(malformed)); err == nil {
+			t.Errorf("byte %d set to %d: file inspected", tt.index, tt.value)
+		}
+	}
+}
+
+func TestPreserveKey(t *testing.T) {
+	e := NewEncrypter()
+	if err := e.Config(PreserveKey(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	first := sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+	salt, cipher := e.salt, e.cipher
+	second := sealFile(t, e, []byte("secret"), []byte("retreat at dusk"))
+	if !bytes.Equal(e.salt, salt) || e.cipher != cipher {
+		t.Error("key regenerated for the same phrase")
+	}
+	if bytes.Equal(first, second) {
+		t.Error("files encrypted with the same data key")
+	}
+
+	// Clones reuse the key.
+	c := e.Clone()
+	sealFile(t, c, []byte("secret"), []byte("attack at dawn"))
+	if c.cipher != cipher {
+		t.Error("key regenerated by a clone")
+	}
+
+	// Another phrase requires another key.
+	other := sealFile(t, e, []byte("other"), []byte("attack at dawn"))
+	if bytes.Equal(e.salt, salt) || e.cipher == cipher {
+		t.Error("key reused for another phrase")
+	}
+	if _, err := openFile(NewDecrypter(), []byte("secret"), other); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+
+	for i, file := range [][]byte{first, second} {
+		if _, err := openFile(NewDecrypter(), []byte("secret"), file); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+	}
+	if _, err := openFile(NewDecrypter(), []byte("other"), other); err != nil {
+		t.Error(err)
+	}
+
+	// Without the option every file gets its own key.
+	e = NewEncrypter()
+	sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+	salt = e.salt
+	sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+	if bytes.Equal(e.salt, salt) {
+		t.Error("salt reused without PreserveKey")
+	}
+}
+
+func TestWithKeyDeriver(t *testing.T) {
+	// The deriver is called for keys that aren't cached, with the salt of
+	// each file.
+	var salts [][]byte
+	derive := func(ctx context.Context, phrase, salt []byte, p KDFParams, size uint32) ([]byte, error) {
+		salts = append(salts, append([]byte(nil), salt...))
+		return p.KeyContext(ctx, phrase, salt, size)
+	}
+
+	blob, err := EncryptBytes([]byte("secret"), []byte("attack at dawn"), WithKeyDeriver(derive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files are decrypted with the default derivation.
+	if plaintext, err := DecryptBytes([]byte("secret"), blob); err != nil || string(plaintext) != "attack at dawn" {
+		t.Fatalf("got %q, %v", plaintext, err)
+	}
+
+	d := NewDecrypter()
+	if err = d.Config(WithKeyDeriver(derive)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = openFile(d, []byte("secret"), blob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(salts) != 2 || !bytes.Equal(salts[0], salts[1]) {
+		t.Errorf("keys derived for salts %x, want the file salt twice: once encrypting, once decrypting", salts)
+	}
+
+	// Errors of the deriver are returned.
+	fail := func(context.Context, []byte, []byte, KDFParams, uint32) ([]byte, error) {
+		return nil, errors.E(errors.Canceled)
+	}
+	if _, err = EncryptBytes([]byte("secret"), []byte("attack at dawn"), WithKeyDeriver(fail)); !errors.Is(errors.Canceled, err) {
+		t.Errorf("got error %v, want kind Canceled", err)
+	}
+}
+
+func TestSetFileMode(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plain")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	if err := e.Config(SetFileMode(0640)); err != nil {
+		t.Fatal(err)
+	}
+	encryptedName, err := e.EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(encryptedName); fi.Mode().Perm() != 0640 {
+		t.Errorf("encrypted file mode %v, want %v", fi.Mode().Perm(), os.FileMode(0640))
+	}
+
+	d := NewDecrypter()
+	if err = d.Config(SetFileMode(0400)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.DecryptFile([]byte("secret"), encryptedName, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(name); fi.Mode().Perm() != 0400 {
+		t.Errorf("decrypted file mode %v, want %v", fi.Mode().Perm(), os.FileMode(0400))
+	}
+
+	for _, mode := range []os.FileMode{os.ModeDir | 0700, os.ModeSetuid | 0755, 01000} {
+		if err = NewEncrypter().Config(SetFileMode(mode)); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%v: got error %v, want kind Invalid", mode, err)
+		}
+	}
+}
+
+func TestSetExtension(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plain.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	if err := e.Config(SetExtension("secret")); err != nil {
+		t.Fatal(err)
+	}
+	encryptedName, err := e.EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryptedName != name+".secret" {
+		t.Fatalf("encrypted file %s, want %s", encryptedName, name+".secret")
+	}
+
+	// Without the extension the decrypted file would replace the encrypted
+	// one.
+	if _, err = NewDecrypter().DecryptFile([]byte("secret"), encryptedName, false, false); !errors.Is(errors.Invalid, err) {
+		t.Errorf("default extension: got error %v, want kind Invalid", err)
+	}
+
+	d := NewDecrypter()
+	if err = d.Config(SetExtension(".secret")); err != nil {
+		t.Fatal(err)
+	}
+	decryptedName, err := d.DecryptFile([]byte("secret"), encryptedName, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decryptedName != name {
+		t.Errorf("decrypted file %s, want %s", decryptedName, name)
+	}
+	if b, err := os.ReadFile(name); err != nil || string(b) != "attack at dawn" {
+		t.Errorf("got %q, %v", b, err)
+	}
+}
+
+func TestShredSource(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The link keeps the content of the removed source reachable.
+	link := filepath.Join(dir, "link")
+	if err := os.Link(name, link); err != nil {
+		t.Skipf("hard links aren't supported: %v", err)
+	}
+
+	e := NewEncrypter()
+	if err := e.Config(ShredSource(2)); err != nil {
+		t.Fatal(err)
+	}
+	encryptedName, err := e.EncryptFile([]byte("secret"), name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("source not removed: %v", err)
+	}
+	if b, err := os.ReadFile(link); err != nil || len(b) != 0 {
+		t.Errorf("got source content %q, %v, want it shredded", b, err)
+	}
+
+	// Without it the source is only unlinked.
+	if _, err = NewDecrypter().DecryptFile([]byte("secret"), encryptedName, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Link(name, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewEncrypter().EncryptFile([]byte("secret"), name, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(link); err != nil || string(b) != "attack at dawn" {
+		t.Errorf("got source content %q, %v, want it intact", b, err)
+	}
+
+	if err = NewEncrypter().Config(ShredSource(-1)); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got error %v, want kind Invalid", err)
+	}
+}
+
+func TestDigestPlaintext(t *testing.T) {
+	dir := t.TempDir()
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file%d", i))
+		names = append(names, name)
+		if err := os.WriteFile(name, randomPlaintext(i*70000), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := NewEncrypter()
+	if _, err := e.EncryptFile([]byte("secret"), names[0], false, false); err != nil {
+		t.Fatal(err)
+	}
+	if sum := e.PlaintextSHA256(); sum != nil {
+		t.Errorf("got digest %x without DigestPlaintext", sum)
+	}
+
+	if err := e.Config(DigestPlaintext(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.EncryptFile([]byte("secret"), names[1], false, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256(randomPlaintext(70000)); !bytes.Equal(e.PlaintextSHA256(), want[:]) {
+		t.Errorf("got digest %x, want %x", e.PlaintextSHA256(), want)
+	}
+	// A file that couldn't be encrypted has no digest.
+	if _, err := e.EncryptFile([]byte("secret"), names[1], false, false); err == nil {
+		t.Fatal("encrypted a removed file")
+	}
+	if sum := e.PlaintextSHA256(); sum != nil {
+		t.Errorf("got digest %x for a failed file", sum)
+	}
+
+	if err := e.Config(WithWorkers(2)); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range e.EncryptFiles([]byte("secret"), names[2:], false, false) {
+		var i int
+		fmt.Sscanf(filepath.Base(r.Source), "file%d", &i)
+		if want := sha256.Sum256(randomPlaintext(i * 70000)); r.Err != nil || !bytes.Equal(r.PlaintextSHA256, want[:]) {
+			t.Errorf("%s: got digest %x, %v, want %x", r.Source, r.PlaintextSHA256, r.Err, want)
+		}
+	}
+}
+
+func TestPreserveTimes(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEncrypter()
+	encryptedName, err := e.EncryptFile([]byte("secret"), name, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(encryptedName); fi.ModTime().Equal(mtime) {
+		t.Errorf("got the time of the source without PreserveTimes")
+	}
+
+	if err = e.Config(PreserveTimes(true)); err != nil {
+		t.Fatal(err)
+	}
+	if encryptedName, err = e.EncryptFile([]byte("secret"), name, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(encryptedName); !fi.ModTime().Equal(mtime) {
+		t.Errorf("encrypted file time %v, want %v", fi.ModTime(), mtime)
+	}
+
+	d := NewDecrypter()
+	if err = d.Config(PreserveTimes(true), WithWorkers(2)); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range d.DecryptFiles([]byte("secret"), []string{encryptedName}, false, false) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if fi, _ := os.Stat(r.Output); !fi.ModTime().Equal(mtime) {
+			t.Errorf("decrypted file time %v, want %v", fi.ModTime(), mtime)
+		}
+	}
+}
+
+func TestWithOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, name := range names {
+		if err := os.WriteFile(name, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encryptedDir := filepath.Join(t.TempDir(), "encrypted", "nested")
+	e := NewEncrypter()
+	if err := e.Config(WithOutputDir(encryptedDir)); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, errs := e.EncryptMultipleFiles([]byte("secret"), names, false, false)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for i, name := range encrypted {
+		if want := filepath.Join(encryptedDir, filepath.Base(names[i])+"."+Extension); name != want {
+			t.Errorf("encrypted file %s, want %s", name, want)
+		}
+	}
+
+	decryptedDir := filepath.Join(t.TempDir(), "decrypted")
+	d := NewDecrypter()
+	if err := d.Config(WithOutputDir(decryptedDir)); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range encrypted {
+		decryptedName, err := d.DecryptFile([]byte("secret"), name, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(decryptedDir, filepath.Base(names[i])); decryptedName != want {
+			t.Errorf("decrypted file %s, want %s", decryptedName, want)
+		}
+		if b, _ := os.ReadFile(decryptedName); string(b) != names[i] {
+			t.Errorf("%s: round trip mismatch", decryptedName)
+		}
+	}
+
+	// Sources are kept in place.
+	if entries, _ := os.ReadDir(dir); len(entries) != len(names) {
+		t.Errorf("%d files in the source directory, want %d", len(entries), len(names))
+	}
+
+	// The output directory can't be created under a file.
+	e.Config(WithOutputDir(filepath.Join(names[0], "dir")))
+	if _, err := e.EncryptFile([]byte("secret"), names[1], false, false); !errors.Is(errors.Create, err) {
+		t.Errorf("got error %v, want kind Create", err)
+	}
+}
+
+func TestSkipLocks(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process is writing the source.
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	unlock, err := file.Lock(f, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.CheckUnlocked(name) == nil {
+		t.Skip("file locks aren't supported")
+	}
+
+	e := NewEncrypter()
+	if _, err = e.EncryptFile([]byte("secret"), name, false, false); !errors.Is(errors.Locked, err) {
+		t.Fatalf("got %v, want an error of kind errors.Locked", err)
+	}
+
+	e.Config(SkipLocks(true))
+	encrypted, err := e.EncryptFile([]byte("secret"), name, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	// The output is being read by another process, it isn't replaced.
+	out, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err = file.Lock(out, false); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecrypter()
+	if _, err = d.DecryptFile([]byte("secret"), encrypted, true, false); !errors.Is(errors.Locked, err) {
+		t.Errorf("got %v, want an error of kind errors.Locked", err)
+	}
+	out.Close()
+
+	// The output stays locked until it is replaced.
+	var checked bool
+	d.Config(SetProgress(func(string, int64, int64) {
+		if !checked {
+			checked = true
+			if err := file.CheckUnlocked(name); !errors.Is(errors.Locked, err) {
+				t.Errorf("output while it is written: got %v, want an error of kind errors.Locked", err)
+			}
+		}
+	}))
+	if _, err = d.DecryptFile([]byte("secret"), encrypted, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if !checked {
+		t.Error("the progress wasn't reported")
+	}
+	if err = file.CheckUnlocked(name); err != nil {
+		t.Errorf("output once it is written: %v", err)
+	}
+}
+
+func TestSetKDFParams(t *testing.T) {
+	for _, p := range []KDFParams{
+		{Time: 0, Memory: MinKDFMemory, Threads: 1},
+		{Time: MaxKDFTime + 1, Memory: MinKDFMemory, Threads: 1},
+		{Time: 1, Memory: MinKDFMemory - 1, Threads: 1},
+		{Time: 1, Memory: MaxKDFMemory + 1, Threads: 1},
+		{Time: 1, Memory: MinKDFMemory, Threads: 0},
+	} {
+		if err := NewEncrypter().Config(SetKDFParams(p)); !errors.Is(errors.Invalid, err) {
+			t.Errorf("%+v: got error %v, want kind Invalid", p, err)
+		}
+	}
+
+	// Keys preserved for other parameters aren't reused.
+	e := NewEncrypter()
+	if err := e.Config(PreserveKey(true), SetKDFParams(KDFParams{Time: 1, Memory: MinKDFMemory, Threads: 1})); err != nil {
+		t.Fatal(err)
+	}
+	sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+	cipher := e.cipher
+	if err := e.Config(SetKDFParams(KDFParams{Time: 2, Memory: MinKDFMemory, Threads: 1})); err != nil {
+		t.Fatal(err)
+	}
+	sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+	if e.cipher == cipher {
+		t.Error("key reused for other parameters")
+	}
+}
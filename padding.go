@@ -0,0 +1,316 @@
+package celo
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Padding identifies the scheme used to pad the plaintext before encryption
+// so that the ciphertext length doesn't leak the exact size of the plaintext.
+// The scheme is recorded in the file signature and stripped transparently on
+// decryption.
+type Padding byte
+
+// Supported padding schemes.
+//
+// Do not reorder this list or remove any items since the values are encoded in
+// encrypted files. New items must be added only to the end.
+const (
+	// PaddingNone the plaintext is encrypted as is.
+	PaddingNone Padding = iota
+	// PaddingBlock the plaintext is padded to a multiple of PaddingBlockSize.
+	PaddingBlock
+	// PaddingPadme the plaintext is padded using the Padmé scheme, which
+	// leaks at most O(log log L) bits of the plaintext length L with an
+	// overhead of at most 12%.
+	PaddingPadme
+)
+
+// PaddingBlockSize size in bytes of the blocks used by PaddingBlock.
+const PaddingBlockSize = 256
+
+// paddingMarker first byte of the padding. Every byte after the marker is 0,
+// which allows to strip the padding without storing its length
+// (ISO/IEC 7816-4).
+const paddingMarker = 0x80
+
+var paddingNames = map[Padding]string{
+	PaddingNone:  "none",
+	PaddingBlock: "block",
+	PaddingPadme: "padme",
+}
+
+// String returns the name of the padding scheme.
+func (p Padding) String() string {
+	name, ok := paddingNames[p]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// IsValid reports whether the padding scheme is supported by the running
+// version of Celo.
+func (p Padding) IsValid() bool {
+	_, ok := paddingNames[p]
+	return ok
+}
+
+// PaddedSize returns the size of a plaintext of n bytes once padded with the
+// scheme p.
+func PaddedSize(n int64, p Padding) int64 {
+	switch p {
+	case PaddingBlock:
+		// At least one byte is needed to store the marker.
+		return (n/PaddingBlockSize + 1) * PaddingBlockSize
+	case PaddingPadme:
+		return padme(n + 1)
+	}
+	return n
+}
+
+// padme returns the Padmé padded length of l.
+// See "Reducing Metadata Leakage from Encrypted Files and Communication with
+// PURBs" (Nikitin et al.).
+func padme(l int64) int64 {
+	if l < 2 {
+		return l
+	}
+	// e = floor(log2 l), s = floor(log2 e) + 1
+	e := bits.Len64(uint64(l)) - 1
+	s := bits.Len64(uint64(e))
+	mask := int64(1)<<uint(e-s) - 1
+	return (l + mask) &^ mask
+}
+
+// Pad pads the plaintext with the scheme p.
+// It returns the plaintext as is if p is PaddingNone.
+// It returns an error if the scheme isn't supported.
+func Pad(plaintext []byte, p Padding) ([]byte, error) {
+	if !p.IsValid() {
+		return nil, errors.E(errors.Padding, errors.Op("padding.Pad"))
+	}
+	if p == PaddingNone {
+		return plaintext, nil
+	}
+
+	padded := make([]byte, PaddedSize(int64(len(plaintext)), p))
+	copy(padded, plaintext)
+	// Remaining bytes are already 0.
+	padded[len(plaintext)] = paddingMarker
+
+	return padded, nil
+}
+
+// Unpad removes the padding added by Pad with the scheme p.
+// It returns an error if the scheme isn't supported or the padding marker is
+// missing.
+func Unpad(padded []byte, p Padding) ([]byte, error) {
+	op := errors.Op("padding.Unpad")
+
+	if !p.IsValid() {
+		return nil, errors.E(errors.Padding, op)
+	}
+	if p == PaddingNone {
+		return padded, nil
+	}
+
+	// Skip the zeros that follow the marker.
+	i := len(padded) - 1
+	for ; i >= 0 && padded[i] == 0; i-- {
+	}
+
+	if i < 0 || padded[i] != paddingMarker {
+		return nil, errors.E(errors.Padding, op)
+	}
+
+	return padded[:i], nil
+}
+
+// padReader returns a reader of the n bytes read from r padded with the scheme
+// p (See Pad), so a plaintext can be padded without reading it in memory.
+// Reading fails with io.ErrUnexpectedEOF if r has less than n bytes.
+func padReader(r io.Reader, n int64, p Padding) io.Reader {
+	plaintext := &exactReader{r: r, n: n}
+
+	padding := PaddedSize(n, p) - n
+	if padding == 0 {
+		return plaintext
+	}
+
+	return io.MultiReader(
+		plaintext,
+		bytes.NewReader([]byte{paddingMarker}),
+		io.LimitReader(zeroReader{}, padding-1),
+	)
+}
+
+// padStreamReader returns a reader of everything read from r padded with the
+// scheme p once r is exhausted, for plaintexts of unknown size (See
+// padReader).
+func padStreamReader(r io.Reader, p Padding) io.Reader {
+	if p == PaddingNone {
+		return r
+	}
+	return &streamPadder{r: r, p: p}
+}
+
+// streamPadder reads from r and then the padding of the bytes read.
+type streamPadder struct {
+	r io.Reader
+	p Padding
+	// n number of bytes read from r.
+	n int64
+	// padding reader of the padding, once r is exhausted.
+	padding io.Reader
+}
+
+func (s *streamPadder) Read(p []byte) (int, error) {
+	if s.padding != nil {
+		return s.padding.Read(p)
+	}
+
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if err != io.EOF {
+		return n, err
+	}
+
+	s.padding = io.MultiReader(
+		bytes.NewReader([]byte{paddingMarker}),
+		io.LimitReader(zeroReader{}, PaddedSize(s.n, s.p)-s.n-1),
+	)
+	if n > 0 {
+		return n, nil
+	}
+	return s.padding.Read(p)
+}
+
+// exactReader reads n bytes from r.
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.n {
+		p = p[:e.n]
+	}
+
+	n, err := e.r.Read(p)
+	e.n -= int64(n)
+	if err == io.EOF && e.n > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// zeroReader reads zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// unpadWriter writes to w the plaintext written to it without the padding
+// added with the scheme p (See Unpad), so a plaintext can be unpadded without
+// reading it in memory. The marker and the zeros that might be the padding are
+// held back until something else is written. Close must be called once
+// everything is written.
+type unpadWriter struct {
+	w io.Writer
+	p Padding
+
+	// marker whether a padding marker is held back.
+	marker bool
+	// zeros number of zeros held back, after the marker if any.
+	zeros int64
+
+	// n number of bytes written, padding included.
+	n int64
+}
+
+func (u *unpadWriter) Write(p []byte) (int, error) {
+	if u.p == PaddingNone {
+		n, err := u.w.Write(p)
+		u.n += int64(n)
+		return n, err
+	}
+
+	i := len(p) - 1
+	for ; i >= 0 && p[i] == 0; i-- {
+	}
+
+	if i < 0 {
+		u.zeros += int64(len(p))
+		u.n += int64(len(p))
+		return len(p), nil
+	}
+
+	// Everything held back is followed by p[i], it isn't padding.
+	if err := u.flush(); err != nil {
+		return 0, err
+	}
+
+	end := i + 1
+	if p[i] == paddingMarker {
+		end = i
+	}
+	if _, err := u.w.Write(p[:end]); err != nil {
+		return 0, err
+	}
+
+	u.marker = p[i] == paddingMarker
+	u.zeros = int64(len(p) - i - 1)
+	u.n += int64(len(p))
+
+	return len(p), nil
+}
+
+// flush writes the bytes held back.
+func (u *unpadWriter) flush() error {
+	if u.marker {
+		if _, err := u.w.Write([]byte{paddingMarker}); err != nil {
+			return err
+		}
+		u.marker = false
+	}
+
+	if u.zeros == 0 {
+		return nil
+	}
+
+	zeros := make([]byte, 4096)
+	for u.zeros > 0 {
+		n := int64(len(zeros))
+		if u.zeros < n {
+			n = u.zeros
+		}
+		if _, err := u.w.Write(zeros[:n]); err != nil {
+			return err
+		}
+		u.zeros -= n
+	}
+
+	return nil
+}
+
+// Close discards the padding held back. It doesn't close w.
+// It returns an error of kind errors.Padding if the padding marker is missing.
+func (u *unpadWriter) Close() error {
+	if !u.p.IsValid() || (u.p != PaddingNone && !u.marker) {
+		return errors.E(errors.Padding, errors.Op("padding.unpadWriter.Close"))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package celo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestPadUnpad(t *testing.T) {
+	for _, p := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		for _, n := range []int{0, 1, 255, 256, 257, 1000, 4096, 100000} {
+			plaintext := bytes.Repeat([]byte{0}, n)
+
+			padded, err := Pad(plaintext, p)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, n, err)
+			}
+			if int64(len(padded)) != PaddedSize(int64(n), p) {
+				t.Errorf("%v, %d bytes: padded to %d bytes, PaddedSize is %d", p, n, len(padded), PaddedSize(int64(n), p))
+			}
+			if p == PaddingBlock && len(padded)%PaddingBlockSize != 0 {
+				t.Errorf("%v, %d bytes: padded to %d bytes, not a multiple of the block", p, n, len(padded))
+			}
+			if p == PaddingPadme && n > 0 && len(padded)-n-1 > (n+1)*12/100 {
+				t.Errorf("%v, %d bytes: padded to %d bytes, overhead above 12%%", p, n, len(padded))
+			}
+
+			got, err := Unpad(padded, p)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, n, err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%v, %d bytes: round trip mismatch", p, n)
+			}
+		}
+	}
+}
+
+func TestUnpadErrors(t *testing.T) {
+	tests := []struct {
+		padded []byte
+		p      Padding
+	}{
+		{[]byte{}, PaddingBlock},
+		{[]byte{0, 0, 0}, PaddingBlock},
+		{[]byte{'a', 0, 0}, PaddingPadme},
+		{[]byte{'a', paddingMarker}, Padding(42)},
+	}
+
+	for i, tt := range tests {
+		if _, err := Unpad(tt.padded, tt.p); !errors.Is(errors.Padding, err) {
+			t.Errorf("%d: got error %v, want kind Padding", i, err)
+		}
+	}
+
+	if _, err := Pad([]byte("a"), Padding(42)); !errors.Is(errors.Padding, err) {
+		t.Errorf("Pad: got error %v, want kind Padding", err)
+	}
+}
+
+func TestPaddingHidesLength(t *testing.T) {
+	e := NewEncrypter()
+	if err := e.Config(SetPadding(PaddingBlock)); err != nil {
+		t.Fatal(err)
+	}
+
+	short := sealFile(t, e, []byte("secret"), []byte("yes"))
+	long := sealFile(t, e, []byte("secret"), []byte("no, definitely not"))
+	if len(short) != len(long) {
+		t.Errorf("files of %d and %d bytes, want the same size", len(short), len(long))
+	}
+}
+
+func TestPaddingTampered(t *testing.T) {
+	e := NewEncrypter()
+	if err := e.Config(SetPadding(PaddingPadme)); err != nil {
+		t.Fatal(err)
+	}
+	file := sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+
+	// The padding scheme is authenticated along with the payload, stripping
+	// the padding can't be skipped.
+	file[12+paddingIndex] = byte(PaddingNone)
+	if _, err := openFile(NewDecrypter(), []byte("secret"), file); err == nil {
+		t.Error("file with a modified padding scheme was decrypted")
+	}
+}
+
+func TestUnpadWriter(t *testing.T) {
+	plaintexts := [][]byte{
+		{},
+		{'a'},
+		{0, 0, 0},
+		{'a', paddingMarker, 0, 0, 'b', 0},
+		append(randomPlaintext(5000), paddingMarker, 0, 0),
+		make([]byte, 10000),
+	}
+
+	for _, p := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		for i, plaintext := range plaintexts {
+			padded, err := Pad(plaintext, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Written in parts of every size.
+			for _, part := range []int{1, 2, 7, 4096, len(padded) + 1} {
+				b := new(bytes.Buffer)
+				w := &unpadWriter{w: b, p: p}
+				for rest := padded; len(rest) > 0; {
+					n := part
+					if n > len(rest) {
+						n = len(rest)
+					}
+					if _, err = w.Write(rest[:n]); err != nil {
+						t.Fatal(err)
+					}
+					rest = rest[n:]
+				}
+				if err = w.Close(); err != nil {
+					t.Fatalf("%v, %d, parts of %d: %v", p, i, part, err)
+				}
+				if !bytes.Equal(b.Bytes(), plaintext) {
+					t.Errorf("%v, %d, parts of %d: round trip mismatch", p, i, part)
+				}
+			}
+		}
+	}
+
+	for i, tt := range []struct {
+		padded []byte
+		p      Padding
+	}{
+		{[]byte{}, PaddingBlock},
+		{[]byte{0, 0, 0}, PaddingBlock},
+		{[]byte{'a', paddingMarker, 'b', 0}, PaddingPadme},
+		{[]byte{'a', paddingMarker}, Padding(42)},
+	} {
+		w := &unpadWriter{w: new(bytes.Buffer), p: tt.p}
+		w.Write(tt.padded)
+		if err := w.Close(); !errors.Is(errors.Padding, err) {
+			t.Errorf("%d: got error %v, want kind Padding", i, err)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package celo
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"io"
-	"syscall"
+	"os"
 
 	"github.com/rrivera/celo/errors"
 	"github.com/rrivera/celo/messages"
@@ -13,17 +17,110 @@ import (
 	"golang.org/x/term"
 )
 
-// ReadPhrase read phrase from Stdin without echoing it.
+// PhraseProvider provides secret phrases, so the phrase can be asked in the
+// terminal, read from the environment or a file, or supplied by an application
+// (e.g. a GUI dialog) through a PhraseFunc.
+type PhraseProvider interface {
+	// Phrase returns a secret phrase. If confirm is true, providers that ask
+	// the user for it ask twice to prevent typos.
+	Phrase(confirm bool) ([]byte, error)
+}
+
+// TerminalPhrase is a PhraseProvider that reads the phrase from the terminal
+// (Stdin) without echoing it.
+// If Stdin isn't a terminal, e.g. echo "$PHRASE" | celo encrypt file, a single
+// line is read from it instead, without instructions or confirmation.
+type TerminalPhrase struct {
+	// Label printed before asking for the phrase, if it isn't empty.
+	Label string
+	// Retries number of attempts to type a confirmed phrase, 0 for unlimited
+	// attempts.
+	Retries uint32
+	// TTY reads the phrase from the controlling terminal (/dev/tty, or the
+	// console on Windows) and prints to it instead of Stdin and Stdout, so
+	// they can carry data, e.g. in a pipeline.
+	TTY bool
+	// MinStrength minimum strength of a confirmed phrase (See
+	// EstimateStrength). Weaker phrases count as a try, as empty ones.
+	MinStrength Strength
+
+	// tty controlling terminal, open while the phrase is read if TTY is set.
+	tty *tty
+}
+
+// readPassword reads a line from the terminal fd without echoing it.
+var readPassword = func(fd int) ([]byte, error) {
+	return term.ReadPassword(fd)
+}
+
+// isTerminal reports whether fd is a terminal.
+var isTerminal = func(fd int) bool {
+	return term.IsTerminal(fd)
+}
+
+// stdin the phrase is read from when it isn't a terminal.
+var stdin io.Reader = os.Stdin
+
+// Phrase reads the phrase from the terminal.
+// It returns an error of kind errors.PhraseOther if TTY is set and there is
+// no controlling terminal.
+func (t TerminalPhrase) Phrase(confirm bool) ([]byte, error) {
+	if t.TTY {
+		tty, err := openTTY()
+		if err != nil {
+			return nil, errors.E(errors.PhraseOther, errors.Op("phrase.TerminalPhrase"), err)
+		}
+		defer tty.Close()
+		t.tty = tty
+	}
+
+	if t.tty == nil && !isTerminal(t.input()) {
+		return t.readLine(confirm)
+	}
+
+	if t.Label != "" {
+		fmt.Fprintln(t.output(), t.Label)
+	}
+	if confirm {
+		return t.readAndConfirm()
+	}
+	return t.read(true)
+}
+
+// Interactive reports whether the phrase is typed in a terminal, so it can be
+// asked again, e.g. after a typo. It is false if Stdin isn't a terminal and TTY
+// isn't set.
+func (t TerminalPhrase) Interactive() bool {
+	return t.TTY || isTerminal(stdinFd())
+}
+
+// input returns the file descriptor of the terminal the phrase is read from.
+func (t TerminalPhrase) input() int {
+	if t.tty != nil {
+		return int(t.tty.in.Fd())
+	}
+	return stdinFd()
+}
+
+// output returns the writer of the terminal the instructions are printed to.
+func (t TerminalPhrase) output() io.Writer {
+	if t.tty != nil {
+		return t.tty.out
+	}
+	return os.Stdout
+}
+
+// read reads the phrase without echoing it.
 // It will print instructcions if true is passed.
-func ReadPhrase(printLabel bool) ([]byte, error) {
+func (t TerminalPhrase) read(printLabel bool) ([]byte, error) {
 	if printLabel {
 		// Print Instructions
-		fmt.Print(messages.PhraseRead.String() + " ")
+		fmt.Fprint(t.output(), messages.PhraseRead.String()+" ")
 	}
 
 	// Securely read the phrase without printing it.
-	phrase, err := term.ReadPassword(syscall.Stdin)
-	fmt.Println() // Prevent writing in the same line as the phrase input.
+	phrase, err := readPassword(t.input())
+	fmt.Fprintln(t.output()) // Prevent writing in the same line as the phrase input.
 	if err != nil {
 		return nil, errors.E(errors.PhraseOther, errors.Op("phrase.ReadPhrase"), err)
 	}
@@ -31,47 +128,108 @@ func ReadPhrase(printLabel bool) ([]byte, error) {
 	return phrase, nil
 }
 
-// ReadAndConfirmPhrase reads the phrase and ask for confirmation with a number
-// of retries. If the passed arguments for retries is 0, the number of retries
-// is unlimited.
-func ReadAndConfirmPhrase(retries uint32) (phrase []byte, err error) {
+// readLine reads the phrase from a line of stdin, when it isn't a terminal.
+// It is read one byte at a time, so nothing after the line is consumed.
+// There is no one to ask again, an empty phrase or, if confirm is true, one
+// weaker than MinStrength is an error.
+func (t TerminalPhrase) readLine(confirm bool) ([]byte, error) {
+	op := errors.Op("phrase.readLine")
+
+	var phrase []byte
+	b := make([]byte, 1)
+	for {
+		n, err := stdin.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			phrase = append(phrase, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ZeroBytes(phrase)
+			return nil, errors.E(errors.PhraseOther, op, err)
+		}
+	}
+
+	phrase = bytes.TrimSuffix(phrase, []byte("\r"))
+	if len(phrase) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, op)
+	}
+	if confirm {
+		if err := CheckStrength(phrase, t.MinStrength); err != nil {
+			ZeroBytes(phrase)
+			return nil, errors.E(op, err)
+		}
+	}
+	return phrase, nil
+}
+
+// readAndConfirm reads the phrase and ask for confirmation with a number of
+// retries. If the number of retries is 0, the number of retries is unlimited.
+// An empty phrase, a phrase weaker than MinStrength and a confirmation that
+// doesn't match count as a try, the phrase is asked again until the retries
+// are exhausted.
+func (t TerminalPhrase) readAndConfirm() (phrase []byte, err error) {
 	op := errors.Op("phrase.ReadAndConfirmPhrase")
+	retries := t.Retries
 	var i uint32 = 1
 	var first []byte
 
 	for ; retries == 0 || i <= retries; i++ {
 		// Either the number of retries has been reached or unlimited retries(0)
 
-		first, err = ReadPhrase(true)
+		first, err = t.read(true)
 
 		if err != nil {
 			// Stop inmediately if it wasn't possible to read from Stdin.
 			return nil, errors.E(errors.PhraseOther, op, err)
 		}
 		if len(first) == 0 {
-			if i < retries {
+			if retries == 0 || i < retries {
 				// Empty phrases aren't allowed. Count it as a try and continue.
-				fmt.Println(errors.PhraseIsEmpty.String())
+				fmt.Fprintln(t.output(), errors.PhraseIsEmpty.String())
 				continue
 			}
 			// If this is the last retry, err will be returned.
 			return nil, errors.E(errors.PhraseIsEmpty, op)
 		}
+		if err = CheckStrength(first, t.MinStrength); err != nil {
+			ZeroBytes(first)
+			if retries == 0 || i < retries {
+				// Weak phrases are rejected before they are confirmed.
+				fmt.Fprintf(t.output(), "%s, %s\n", errors.PhraseIsWeak.String(), messages.PhraseWarningWeak)
+				continue
+			}
+			return nil, errors.E(op, err)
+		}
 
-		fmt.Print(messages.PhraseConfirm.String() + " ")
-		second, err := ReadPhrase(false)
-		fmt.Println() // Prevent writing in the same line as the phrase input.
+		fmt.Fprint(t.output(), messages.PhraseConfirm.String()+" ")
+		second, err := t.read(false)
+		fmt.Fprintln(t.output()) // Prevent writing in the same line as the phrase input.
 		if err != nil {
 			// Stop inmediately if it wasn't possible to read from Stdin.
 			return nil, errors.E(errors.PhraseOther, op, err)
 		}
 
-		if bytes.Compare(first, second) == 0 {
+		match := bytes.Equal(first, second)
+		// The confirmation isn't needed anymore.
+		ZeroBytes(second)
+
+		if match {
 			// Phrases match, break the iteration and return phrase.
 			return first, nil
-		} else if i < retries {
+		}
+
+		// The phrase is discarded.
+		ZeroBytes(first)
+
+		if retries == 0 || i < retries {
 			// Phrases don't match, count it as a try and continue.
-			fmt.Println(errors.PhraseMismatch.String())
+			fmt.Fprintln(t.output(), errors.PhraseMismatch.String())
+			continue
 		}
 
 		// Maximum allowed retries reached and still mismatch.
@@ -81,6 +239,77 @@ func ReadAndConfirmPhrase(retries uint32) (phrase []byte, err error) {
 	return nil, errors.E(errors.PhraseMismatch, op)
 }
 
+// EnvPhrase is a PhraseProvider that returns the value of the environment
+// variable with its name.
+type EnvPhrase string
+
+// Phrase returns the value of the environment variable.
+// It returns an error if the variable is empty.
+func (e EnvPhrase) Phrase(confirm bool) ([]byte, error) {
+	phrase := os.Getenv(string(e))
+	if phrase == "" {
+		return nil, errors.E(errors.PhraseIsEmpty, errors.Op("phrase.EnvPhrase"),
+			errors.Errorf("Environment Variable %s is empty", string(e)))
+	}
+	return []byte(phrase), nil
+}
+
+// FilePhrase is a PhraseProvider that reads the phrase from the file with its
+// name. A single trailing line break is ignored.
+type FilePhrase string
+
+// Phrase reads the phrase from the file.
+// It returns an error if the file can't be read or the phrase is empty.
+func (f FilePhrase) Phrase(confirm bool) ([]byte, error) {
+	op := errors.Op("phrase.FilePhrase")
+
+	phrase, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, errors.E(errors.PhraseOther, op, errors.Entity(f), err)
+	}
+
+	phrase = bytes.TrimSuffix(phrase, []byte("\n"))
+	phrase = bytes.TrimSuffix(phrase, []byte("\r"))
+	if len(phrase) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, op, errors.Entity(f))
+	}
+
+	return phrase, nil
+}
+
+// PhraseFunc is an adapter to use a function as a PhraseProvider.
+type PhraseFunc func(confirm bool) ([]byte, error)
+
+// Phrase calls f(confirm).
+func (f PhraseFunc) Phrase(confirm bool) ([]byte, error) {
+	return f(confirm)
+}
+
+// ReadPhrase read phrase from Stdin without echoing it.
+// It will print instructcions if true is passed.
+// It is a shorthand for the TerminalPhrase provider.
+func ReadPhrase(printLabel bool) ([]byte, error) {
+	return TerminalPhrase{}.read(printLabel)
+}
+
+// ReadAndConfirmPhrase reads the phrase and ask for confirmation with a number
+// of retries. If the passed arguments for retries is 0, the number of retries
+// is unlimited.
+// It is a shorthand for the TerminalPhrase provider.
+func ReadAndConfirmPhrase(retries uint32) (phrase []byte, err error) {
+	return TerminalPhrase{Retries: retries}.readAndConfirm()
+}
+
+// keyDigest identifies the key generated from the secret phrase and salt with
+// the key derivation parameters p, without keeping the phrase. Generating the
+// key is slow, the digest is only used to tell whether a key can be reused.
+func keyDigest(secretPhrase, salt []byte, p KDFParams) []byte {
+	h := hmac.New(sha256.New, salt)
+	h.Write(p.encode())
+	h.Write(secretPhrase)
+	return h.Sum(nil)
+}
+
 // NewSalt generates a random salt.
 // It returns the salt and number of bytes readed.
 // It returns an error if it fails to read saltSize bytes.
@@ -93,9 +322,131 @@ func NewSalt(saltSize int) (salt []byte, n int, err error) {
 	return salt, n, nil
 }
 
+// Bounds of the key derivation parameters (See KDFParams.Validate). They also
+// bound the parameters read from encrypted files, so a file can't make the key
+// derivation use unbounded time or memory.
+const (
+	MaxKDFTime = 64
+	// MinKDFMemory and MaxKDFMemory in KiB.
+	MinKDFMemory = 8 * 1024
+	MaxKDFMemory = 4 * 1024 * 1024
+)
+
+// kdfParamsSize size of the encoded KDFParams.
+//  time (4 bytes) | memory (4 bytes) | threads (1 byte), big endian
+const kdfParamsSize = 9
+
+// KDFParams parameters of the argon2id key derivation of the keys generated
+// from secret phrases. They are recorded in the phrase stanzas of encrypted
+// files, so files encrypted with different parameters can still be decrypted.
+type KDFParams struct {
+	// Time number of passes over the memory.
+	Time uint32
+	// Memory in KiB.
+	Memory uint32
+	// Threads number of lanes.
+	Threads uint8
+}
+
+// DefaultKDFParams returns the parameters used unless SetKDFParams is used,
+// which are also the parameters of files whose phrase stanzas don't record
+// them.
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Time: 1, Memory: 64 * 1024, Threads: 4}
+}
+
+// Validate returns an error of kind errors.Invalid if the parameters are out
+// of bounds: Time between 1 and MaxKDFTime, Memory between MinKDFMemory and
+// MaxKDFMemory, and at least one thread.
+func (p KDFParams) Validate() error {
+	op := errors.Op("phrase.Validate")
+
+	switch {
+	case p.Time < 1 || p.Time > MaxKDFTime:
+		return errors.E(errors.Invalid, op, errors.Errorf("argon2id time %d, must be between 1 and %d", p.Time, MaxKDFTime))
+	case p.Memory < MinKDFMemory || p.Memory > MaxKDFMemory:
+		return errors.E(errors.Invalid, op, errors.Errorf("argon2id memory %d KiB, must be between %d and %d MiB", p.Memory, MinKDFMemory/1024, MaxKDFMemory/1024))
+	case p.Threads < 1:
+		return errors.E(errors.Invalid, op, errors.Errorf("argon2id needs at least 1 thread"))
+	}
+	return nil
+}
+
+func (p KDFParams) String() string {
+	return fmt.Sprintf("argon2id (time %d, memory %d MiB, threads %d)", p.Time, p.Memory/1024, p.Threads)
+}
+
+// encode encodes the parameters as recorded in phrase stanzas.
+func (p KDFParams) encode() []byte {
+	b := binary.BigEndian.AppendUint32(make([]byte, 0, kdfParamsSize), p.Time)
+	b = binary.BigEndian.AppendUint32(b, p.Memory)
+	return append(b, p.Threads)
+}
+
+// decodeKDFParams decodes the parameters encoded by KDFParams.encode.
+// It returns an error of kind errors.Decode if b is too short or the
+// parameters are out of bounds.
+func decodeKDFParams(b []byte) (KDFParams, error) {
+	op := errors.Op("phrase.decodeKDFParams")
+
+	if len(b) < kdfParamsSize {
+		return KDFParams{}, errors.E(errors.Decode, op)
+	}
+	p := KDFParams{
+		Time:    binary.BigEndian.Uint32(b),
+		Memory:  binary.BigEndian.Uint32(b[4:]),
+		Threads: b[8],
+	}
+	if err := p.Validate(); err != nil {
+		return KDFParams{}, errors.E(errors.Decode, op, err)
+	}
+	return p, nil
+}
+
+// Key generates a derived key of size blockSize using a phrase and a salt
+// with the argon2id parameters p.
+func (p KDFParams) Key(phrase, salt []byte, blockSize uint32) []byte {
+	return argon2.IDKey(phrase, salt, p.Time, p.Memory, p.Threads, blockSize)
+}
+
+// KeyContext is like Key but it returns as soon as ctx is done.
+// The argon2 derivation can't be interrupted, it finishes in the background and
+// its result is discarded.
+func (p KDFParams) KeyContext(ctx context.Context, phrase, salt []byte, blockSize uint32) ([]byte, error) {
+	op := errors.Op("phrase.KeyContext")
+
+	if err := checkContext(ctx, op); err != nil {
+		return nil, err
+	}
+
+	if ctx.Done() == nil {
+		// The context can't be canceled.
+		return p.Key(phrase, salt, blockSize), nil
+	}
+
+	key := make(chan []byte, 1)
+	go func() {
+		key <- p.Key(phrase, salt, blockSize)
+	}()
+
+	select {
+	case k := <-key:
+		return k, nil
+	case <-ctx.Done():
+		return nil, errors.E(errors.Canceled, op, ctx.Err())
+	}
+}
+
 // GenerateKey generates a derived key of size blockSize using a phrase and a
 // salt.
-// It uses argon2 key derivation algorithm.
+// It uses argon2 key derivation algorithm with the DefaultKDFParams.
 func GenerateKey(phrase, salt []byte, blockSize uint32) []byte {
-	return argon2.IDKey(phrase, salt, 1, 64*1024, 4, blockSize)
+	return DefaultKDFParams().Key(phrase, salt, blockSize)
+}
+
+// GenerateKeyContext is like GenerateKey but it returns as soon as ctx is done.
+// The argon2 derivation can't be interrupted, it finishes in the background and
+// its result is discarded.
+func GenerateKeyContext(ctx context.Context, phrase, salt []byte, blockSize uint32) ([]byte, error) {
+	return DefaultKDFParams().KeyContext(ctx, phrase, salt, blockSize)
 }
@@ -0,0 +1,254 @@
+package celo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// typePhrases replaces the terminal with the given lines for the duration of
+// the test.
+func typePhrases(t *testing.T, lines ...string) {
+	t.Helper()
+	original, terminal := readPassword, isTerminal
+	t.Cleanup(func() { readPassword, isTerminal = original, terminal })
+
+	isTerminal = func(fd int) bool { return true }
+	readPassword = func(fd int) ([]byte, error) {
+		if len(lines) == 0 {
+			t.Fatal("phrase read more times than expected")
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return []byte(line), nil
+	}
+}
+
+func TestEnvPhrase(t *testing.T) {
+	t.Setenv("CELO_TEST_PHRASE", "secret")
+
+	phrase, err := EnvPhrase("CELO_TEST_PHRASE").Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(phrase) != "secret" {
+		t.Errorf("got phrase %q, want %q", phrase, "secret")
+	}
+
+	t.Setenv("CELO_TEST_PHRASE", "")
+	if _, err = EnvPhrase("CELO_TEST_PHRASE").Phrase(false); !errors.Is(errors.PhraseIsEmpty, err) {
+		t.Errorf("empty variable: got error %v, want kind PhraseIsEmpty", err)
+	}
+}
+
+func TestFilePhrase(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		content string
+		want    string
+		kind    errors.Kind
+	}{
+		{"secret", "secret", errors.Other},
+		{"secret\n", "secret", errors.Other},
+		{"secret\r\n", "secret", errors.Other},
+		{"secret\n\n", "secret\n", errors.Other},
+		{" secret ", " secret ", errors.Other},
+		{"\n", "", errors.PhraseIsEmpty},
+		{"", "", errors.PhraseIsEmpty},
+	}
+
+	for i, tt := range tests {
+		name := filepath.Join(dir, "phrase")
+		if err := os.WriteFile(name, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		phrase, err := FilePhrase(name).Phrase(false)
+		if tt.kind != errors.Other {
+			if !errors.Is(tt.kind, err) {
+				t.Errorf("%d: got error %v, want kind %v", i, err, tt.kind)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error %v", i, err)
+			continue
+		}
+		if string(phrase) != tt.want {
+			t.Errorf("%d: got phrase %q, want %q", i, phrase, tt.want)
+		}
+	}
+
+	if _, err := FilePhrase(filepath.Join(dir, "missing")).Phrase(false); !errors.Is(errors.PhraseOther, err) {
+		t.Errorf("missing file: got error %v, want kind PhraseOther", err)
+	}
+}
+
+func TestPhraseFunc(t *testing.T) {
+	var confirmed bool
+	var p PhraseProvider = PhraseFunc(func(confirm bool) ([]byte, error) {
+		confirmed = confirm
+		return []byte("secret"), nil
+	})
+
+	phrase, err := p.Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !confirmed || string(phrase) != "secret" {
+		t.Errorf("got phrase %q and confirm %v, want %q and true", phrase, confirmed, "secret")
+	}
+}
+
+func TestTerminalPhrase(t *testing.T) {
+	typePhrases(t, "secret")
+	phrase, err := TerminalPhrase{}.Phrase(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(phrase, []byte("secret")) {
+		t.Errorf("got phrase %q, want %q", phrase, "secret")
+	}
+
+	typePhrases(t, "secret", "secret")
+	if phrase, err = (TerminalPhrase{Retries: 3}).Phrase(true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(phrase, []byte("secret")) {
+		t.Errorf("confirmed: got phrase %q, want %q", phrase, "secret")
+	}
+
+	typePhrases(t, "secret", "typo")
+	if _, err = (TerminalPhrase{Retries: 1}).Phrase(true); !errors.Is(errors.PhraseMismatch, err) {
+		t.Errorf("mismatch: got error %v, want kind PhraseMismatch", err)
+	}
+
+	typePhrases(t, "")
+	if _, err = (TerminalPhrase{Retries: 1}).Phrase(true); !errors.Is(errors.PhraseIsEmpty, err) {
+		t.Errorf("empty: got error %v, want kind PhraseIsEmpty", err)
+	}
+}
+
+func TestTerminalPhraseTTY(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "tty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	f.Close()
+	original := openTTY
+	t.Cleanup(func() { openTTY = original })
+	openTTY = func() (*tty, error) {
+		f, err := os.OpenFile(name, os.O_RDWR, 0)
+		return &tty{in: f, out: f}, err
+	}
+
+	typePhrases(t, "secret", "secret")
+	phrase, err := TerminalPhrase{Label: "Encrypting", TTY: true}.Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(phrase, []byte("secret")) {
+		t.Errorf("got phrase %q, want %q", phrase, "secret")
+	}
+	// The instructions are printed to the terminal, not to Stdout.
+	if b, _ := os.ReadFile(name); !bytes.HasPrefix(b, []byte("Encrypting\n")) {
+		t.Errorf("got terminal output %q", b)
+	}
+
+	openTTY = func() (*tty, error) {
+		return nil, os.ErrNotExist
+	}
+	if _, err = (TerminalPhrase{TTY: true}).Phrase(false); !errors.Is(errors.PhraseOther, err) {
+		t.Errorf("no terminal: got error %v, want kind PhraseOther", err)
+	}
+}
+
+func TestTerminalPhraseRetries(t *testing.T) {
+	// A mismatch and an empty phrase are retried.
+	typePhrases(t, "secret", "typo", "", "secret", "secret")
+	phrase, err := TerminalPhrase{Retries: 3}.Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(phrase, []byte("secret")) {
+		t.Errorf("got phrase %q, want %q", phrase, "secret")
+	}
+
+	// The last retry returns the error.
+	typePhrases(t, "secret", "typo", "secret", "other")
+	if _, err = (TerminalPhrase{Retries: 2}).Phrase(true); !errors.Is(errors.PhraseMismatch, err) {
+		t.Errorf("retries exhausted: got error %v, want kind PhraseMismatch", err)
+	}
+
+	// 0 retries means unlimited retries.
+	typePhrases(t, "", "a", "b", "", "c", "d", "secret", "secret")
+	if phrase, err = (TerminalPhrase{}).Phrase(true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(phrase, []byte("secret")) {
+		t.Errorf("unlimited retries: got phrase %q, want %q", phrase, "secret")
+	}
+}
+
+func TestTerminalPhraseStdin(t *testing.T) {
+	original, terminal := stdin, isTerminal
+	t.Cleanup(func() { stdin, isTerminal = original, terminal })
+	isTerminal = func(fd int) bool { return false }
+
+	// A piped phrase can't be asked again.
+	if (TerminalPhrase{}).Interactive() {
+		t.Error("Stdin isn't a terminal, got interactive")
+	}
+	if !(TerminalPhrase{TTY: true}).Interactive() {
+		t.Error("controlling terminal, got not interactive")
+	}
+
+	tests := []struct {
+		input   string
+		confirm bool
+		want    string
+		kind    errors.Kind
+	}{
+		{"secret\n", true, "secret", 0},
+		{"secret\r\n", false, "secret", 0},
+		{"secret", false, "secret", 0},
+		{"\n", false, "", errors.PhraseIsEmpty},
+		{"", false, "", errors.PhraseIsEmpty},
+	}
+	for _, tt := range tests {
+		stdin = strings.NewReader(tt.input)
+		phrase, err := TerminalPhrase{Retries: 3}.Phrase(tt.confirm)
+		if tt.kind != 0 {
+			if !errors.Is(tt.kind, err) {
+				t.Errorf("%q: got error %v, want kind %v", tt.input, err, tt.kind)
+			}
+			continue
+		}
+		if err != nil || string(phrase) != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.input, phrase, err, tt.want)
+		}
+	}
+
+	// Only the line of the phrase is consumed.
+	r := strings.NewReader("secret\nattack at dawn")
+	stdin = r
+	if _, err := (TerminalPhrase{}).Phrase(false); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "attack at dawn" {
+		t.Errorf("got the rest of Stdin %q", rest)
+	}
+
+	// Weak phrases can't be typed again.
+	stdin = strings.NewReader("password\n")
+	if _, err := (TerminalPhrase{MinStrength: MaxStrength}).Phrase(true); !errors.Is(errors.PhraseIsWeak, err) {
+		t.Errorf("weak phrase: got error %v, want kind PhraseIsWeak", err)
+	}
+}
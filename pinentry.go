@@ -0,0 +1,219 @@
+package celo
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/messages"
+)
+
+// PinentryProgram pinentry program used by PinentryPhrase by default.
+const PinentryProgram = "pinentry"
+
+// pinentryCanceled code of the errors of pinentry when the dialog is closed
+// (GPG_ERR_CANCELED), without its source.
+const pinentryCanceled = 99
+
+// PinentryPhrase is a PhraseProvider that asks for the phrase with pinentry,
+// the dialog of GnuPG, which grabs the keyboard while the phrase is typed. The
+// program is run for each phrase and spoken to through the Assuan protocol.
+type PinentryPhrase struct {
+	// Program name or path of the pinentry program, PinentryProgram if
+	// empty.
+	Program string
+	// Description shown in the dialog, if it isn't empty.
+	Description string
+	// Retries number of attempts to type a valid phrase, 0 for unlimited
+	// attempts.
+	Retries uint32
+	// MinStrength minimum strength of a confirmed phrase (See
+	// EstimateStrength).
+	MinStrength Strength
+}
+
+// Phrase asks for the phrase in the pinentry dialog. If confirm is true, the
+// dialog asks for it twice.
+// It returns an error of kind errors.PhraseOther if pinentry can't be run and
+// of kind errors.Canceled if the dialog is closed.
+func (p PinentryPhrase) Phrase(confirm bool) ([]byte, error) {
+	op := errors.Op("pinentry.Phrase")
+
+	program := p.Program
+	if program == "" {
+		program = PinentryProgram
+	}
+
+	cmd := exec.Command(program)
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.E(errors.PhraseOther, op, errors.Entity(program), err)
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.E(errors.PhraseOther, op, errors.Entity(program), err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, errors.E(errors.PhraseOther, op, errors.Entity(program), err)
+	}
+
+	c := &assuan{w: w, r: bufio.NewReader(r)}
+	defer func() {
+		c.command("BYE")
+		w.Close()
+		cmd.Wait()
+	}()
+
+	// Greeting.
+	if _, err = c.response(); err != nil {
+		return nil, errors.E(op, errors.Entity(program), err)
+	}
+
+	// Terminal based pinentry programs need to know where to draw.
+	if ttyName != "" {
+		c.command("OPTION ttyname=" + ttyName)
+	}
+	if t := os.Getenv("TERM"); t != "" {
+		c.command("OPTION ttytype=" + t)
+	}
+
+	c.command("SETTITLE celo")
+	if p.Description != "" {
+		c.command("SETDESC " + assuanEscape(p.Description))
+	}
+	if _, err = c.command("SETPROMPT " + assuanEscape(messages.PhraseRead.String())); err != nil {
+		return nil, errors.E(op, errors.Entity(program), err)
+	}
+	repeat := false
+	if confirm {
+		// Old versions of pinentry can't confirm the phrase themselves.
+		_, err = c.command("SETREPEAT " + assuanEscape(messages.PhraseConfirm.String()))
+		if repeat = err == nil; repeat {
+			c.command("SETREPEATERROR " + assuanEscape(errors.PhraseMismatch.String()))
+		}
+	}
+
+	for i := uint32(1); ; i++ {
+		last := p.Retries != 0 && i >= p.Retries
+
+		phrase, err := c.command("GETPIN")
+		if err != nil {
+			return nil, errors.E(op, errors.Entity(program), err)
+		}
+
+		// Empty and weak phrases are rejected before they are confirmed.
+		var msg string
+		switch {
+		case len(phrase) == 0:
+			msg, err = errors.PhraseIsEmpty.String(), errors.E(errors.PhraseIsEmpty, op)
+		case confirm:
+			if err = CheckStrength(phrase, p.MinStrength); err != nil {
+				msg = errors.PhraseIsWeak.String() + ", " + messages.PhraseWarningWeak.String()
+				err = errors.E(op, err)
+			}
+		}
+
+		if err == nil && confirm && !repeat {
+			c.command("SETPROMPT " + assuanEscape(messages.PhraseConfirm.String()))
+			second, cerr := c.command("GETPIN")
+			if cerr != nil {
+				ZeroBytes(phrase)
+				return nil, errors.E(op, errors.Entity(program), cerr)
+			}
+			match := bytes.Equal(phrase, second)
+			ZeroBytes(second)
+			c.command("SETPROMPT " + assuanEscape(messages.PhraseRead.String()))
+			if !match {
+				msg, err = errors.PhraseMismatch.String(), errors.E(errors.PhraseMismatch, op)
+			}
+		}
+
+		if err == nil {
+			return phrase, nil
+		}
+		ZeroBytes(phrase)
+		if last {
+			return nil, err
+		}
+		// The error is shown the next time the phrase is asked.
+		c.command("SETERROR " + assuanEscape(msg))
+	}
+}
+
+// Interactive reports whether the phrase is typed by the user, always true.
+func (p PinentryPhrase) Interactive() bool {
+	return true
+}
+
+// assuan client of the Assuan protocol, spoken by pinentry.
+type assuan struct {
+	w io.Writer
+	r *bufio.Reader
+}
+
+// command sends the command line and returns the data of its response.
+func (c *assuan) command(line string) ([]byte, error) {
+	if _, err := io.WriteString(c.w, line+"\n"); err != nil {
+		return nil, errors.E(errors.PhraseOther, err)
+	}
+	return c.response()
+}
+
+// response reads the lines of a response up to OK or ERR, and returns the data
+// of its D lines. An ERR response is returned as an error, of kind
+// errors.Canceled if the dialog was closed.
+func (c *assuan) response() ([]byte, error) {
+	var data []byte
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			ZeroBytes(data)
+			return nil, errors.E(errors.PhraseOther, errors.Errorf("pinentry: %v", err))
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data, nil
+		case strings.HasPrefix(line, "ERR "):
+			ZeroBytes(data)
+			code, msg, _ := strings.Cut(line[len("ERR "):], " ")
+			if n, err := strconv.ParseUint(code, 10, 32); err == nil && n&0xffff == pinentryCanceled {
+				return nil, errors.E(errors.Canceled, errors.Errorf("pinentry: %s", msg))
+			}
+			return nil, errors.E(errors.PhraseOther, errors.Errorf("pinentry: %s", msg))
+		case strings.HasPrefix(line, "D "):
+			data = append(data, assuanUnescape(line[len("D "):])...)
+		case strings.HasPrefix(line, "INQUIRE "):
+			// Nothing is provided.
+			io.WriteString(c.w, "END\n")
+		}
+		// Status (S) and comment (#) lines are ignored.
+	}
+}
+
+// assuanEscape percent-escapes the characters that can't be sent in a line.
+func assuanEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// assuanUnescape decodes the percent-escaped characters of s.
+func assuanUnescape(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(n))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return b
+}
@@ -0,0 +1,154 @@
+package celo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// fakePinentry is a pinentry program that answers GETPIN with the lines of the
+// file pins next to it, CANCEL closes the dialog. It logs the commands it
+// receives to the file log.
+const fakePinentry = `#!/bin/sh
+dir=$(dirname "$0")
+n=0
+echo "OK Pleased to meet you"
+while IFS= read -r line; do
+	echo "$line" >> "$dir/log"
+	case "$line" in
+	GETPIN)
+		n=$((n+1))
+		pin=$(sed -n "${n}p" "$dir/pins")
+		case "$pin" in
+		CANCEL) echo "ERR 83886179 Operation cancelled <Pinentry>";;
+		"") echo OK;;
+		*) echo "# comment"; echo "D $pin"; echo OK;;
+		esac;;
+	SETREPEAT*)
+		if [ -f "$dir/norepeat" ]; then echo "ERR 536871187 Unknown IPC command"; else echo OK; fi;;
+	BYE) echo "OK closing connection"; exit 0;;
+	*) echo OK;;
+	esac
+done
+`
+
+// newFakePinentry returns the name of a fake pinentry program answering with
+// pins, and a function returning the commands it received.
+func newFakePinentry(t *testing.T, repeat bool, pins ...string) (string, func() string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake pinentry is a shell script")
+	}
+
+	dir := t.TempDir()
+	program := filepath.Join(dir, "pinentry")
+	if err := os.WriteFile(program, []byte(fakePinentry), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pins"), []byte(strings.Join(pins, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !repeat {
+		if err := os.WriteFile(filepath.Join(dir, "norepeat"), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return program, func() string {
+		b, _ := os.ReadFile(filepath.Join(dir, "log"))
+		return string(b)
+	}
+}
+
+func TestPinentryPhrase(t *testing.T) {
+	program, log := newFakePinentry(t, true, "secret%25")
+	phrase, err := PinentryPhrase{Program: program, Description: "Current\nPhrase"}.Phrase(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(phrase) != "secret%" {
+		t.Errorf("got phrase %q, want %q", phrase, "secret%")
+	}
+	for _, want := range []string{"SETTITLE celo\n", "SETDESC Current%0APhrase\n", "GETPIN\n", "BYE\n"} {
+		if !strings.Contains(log(), want) {
+			t.Errorf("commands %q don't contain %q", log(), want)
+		}
+	}
+	if strings.Contains(log(), "SETREPEAT") {
+		t.Error("phrase confirmed without confirm")
+	}
+
+	// pinentry confirms the phrase itself.
+	program, log = newFakePinentry(t, true, "secret")
+	if phrase, err = (PinentryPhrase{Program: program}).Phrase(true); err != nil || string(phrase) != "secret" {
+		t.Errorf("confirmed: got %q, %v", phrase, err)
+	}
+	if !strings.Contains(log(), "SETREPEAT Confirm Phrase:\n") {
+		t.Errorf("commands %q don't confirm the phrase", log())
+	}
+}
+
+func TestPinentryPhraseRetries(t *testing.T) {
+	// Without SETREPEAT, the phrase is asked twice. A mismatch, an empty
+	// phrase and a weak one are retried.
+	program, log := newFakePinentry(t, false, "", "password", "otter-quilt-lemon-pylon", "typo", "otter-quilt-lemon-pylon", "otter-quilt-lemon-pylon")
+	phrase, err := PinentryPhrase{Program: program, Retries: 4, MinStrength: StrengthSafelyUnguessable}.Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(phrase) != "otter-quilt-lemon-pylon" {
+		t.Errorf("got phrase %q", phrase)
+	}
+	for _, want := range []string{
+		"SETERROR " + errors.PhraseMismatch.String(),
+		"SETERROR " + errors.PhraseIsEmpty.String(),
+		"SETERROR " + errors.PhraseIsWeak.String(),
+	} {
+		if !strings.Contains(log(), want) {
+			t.Errorf("commands %q don't contain %q", log(), want)
+		}
+	}
+}
+
+func TestPinentryPhraseErrors(t *testing.T) {
+	tests := []struct {
+		pins    []string
+		confirm bool
+		kind    errors.Kind
+	}{
+		{[]string{"CANCEL"}, false, errors.Canceled},
+		{[]string{""}, false, errors.PhraseIsEmpty},
+		{[]string{"password"}, true, errors.PhraseIsWeak},
+		{[]string{"otter-quilt-lemon-pylon", "typo"}, true, errors.PhraseMismatch},
+	}
+	for _, tt := range tests {
+		program, _ := newFakePinentry(t, false, tt.pins...)
+		p := PinentryPhrase{Program: program, Retries: 1, MinStrength: MaxStrength}
+		if _, err := p.Phrase(tt.confirm); !errors.Is(tt.kind, err) {
+			t.Errorf("%q: got error %v, want kind %v", tt.pins, err, tt.kind)
+		}
+	}
+
+	p := PinentryPhrase{Program: filepath.Join(t.TempDir(), "missing")}
+	if _, err := p.Phrase(false); !errors.Is(errors.PhraseOther, err) {
+		t.Errorf("missing program: got error %v, want kind PhraseOther", err)
+	}
+}
+
+func TestAssuanEscape(t *testing.T) {
+	s := "100%\r\nsure"
+	if got := assuanEscape(s); got != "100%25%0D%0Asure" {
+		t.Errorf("escape: got %q", got)
+	}
+	if got := string(assuanUnescape(assuanEscape(s))); got != s {
+		t.Errorf("round trip: got %q, want %q", got, s)
+	}
+	// Malformed escapes are kept as they are.
+	if got := string(assuanUnescape("50%%zz%4")); got != "50%%zz%4" {
+		t.Errorf("malformed: got %q", got)
+	}
+}
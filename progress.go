@@ -0,0 +1,89 @@
+package celo
+
+import (
+	"io"
+	"os"
+)
+
+// ProgressFunc is called while files are read or written, with the number of
+// bytes of the file entity processed so far (done) out of its size (total).
+// Between files, batch methods call it with an empty entity and the number of
+// files processed out of the number of files of the batch.
+// It is called from the goroutine that runs the operation, so it should return
+// quickly.
+type ProgressFunc func(entity string, done, total int64)
+
+// progressReader reports the bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	progress ProgressFunc
+	entity   string
+	done     int64
+	total    int64
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.entity, p.done, p.total)
+	}
+	return n, err
+}
+
+// progressWriter reports the bytes written to w.
+type progressWriter struct {
+	w        io.Writer
+	progress ProgressFunc
+	entity   string
+	done     int64
+	total    int64
+}
+
+func (p *progressWriter) Write(b []byte) (n int, err error) {
+	n, err = p.w.Write(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.entity, p.done, p.total)
+	}
+	return n, err
+}
+
+// reader returns r reporting the progress of reading total bytes of the file
+// entity, or r itself if no ProgressFunc was set. Reads are limited to the
+// rate set with LimitRate.
+func (c *celo) reader(r io.Reader, entity string, total int64) io.Reader {
+	r = c.limitReader(r)
+	if c.progress == nil {
+		return r
+	}
+	return &progressReader{r: r, progress: c.progress, entity: entity, total: total}
+}
+
+// writer returns w reporting the progress of writing total bytes of the file
+// entity, or w itself if no ProgressFunc was set. Writes are limited to the
+// rate set with LimitRate.
+func (c *celo) writer(w io.Writer, entity string, total int64) io.Writer {
+	w = c.limitWriter(w)
+	if c.progress == nil {
+		return w
+	}
+	return &progressWriter{w: w, progress: c.progress, entity: entity, total: total}
+}
+
+// batchProgress reports that done files of a batch of total files were
+// processed.
+func (c *celo) batchProgress(done, total int) {
+	if c.progress != nil {
+		c.progress("", int64(done), int64(total))
+	}
+}
+
+// fileSize returns the size of f, or 0 if it is unknown.
+func fileSize(f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
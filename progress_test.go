@@ -0,0 +1,82 @@
+package celo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// progressEvent a call to a ProgressFunc.
+type progressEvent struct {
+	entity      string
+	done, total int64
+}
+
+func TestProgress(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for i, name := range names {
+		if err := os.WriteFile(name, randomPlaintext((i+1)*100*1024), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var events []progressEvent
+	progress := SetProgress(func(entity string, done, total int64) {
+		events = append(events, progressEvent{entity, done, total})
+	})
+
+	e := NewEncrypter()
+	e.Config(progress)
+	encrypted, errs := e.EncryptMultipleFiles([]byte("secret"), names, false, false)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	checkProgress(t, events, append(names, encrypted...))
+
+	events = nil
+	d := NewDecrypter()
+	d.Config(progress)
+	if _, errs = d.DecryptMultipleFiles([]byte("secret"), encrypted, true, false); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	checkProgress(t, events, encrypted)
+}
+
+// checkProgress verifies that every file of names was reported until its
+// total size, and that the batch was reported from 0 to the number of files.
+func checkProgress(t *testing.T, events []progressEvent, names []string) {
+	t.Helper()
+
+	last := map[string]progressEvent{}
+	var batch []int64
+	for _, ev := range events {
+		if ev.entity == "" {
+			batch = append(batch, ev.done)
+			continue
+		}
+		if prev, ok := last[ev.entity]; ok && ev.done < prev.done {
+			t.Errorf("%s: progress went back from %d to %d", ev.entity, prev.done, ev.done)
+		}
+		last[ev.entity] = ev
+	}
+
+	for _, name := range names {
+		ev, ok := last[name]
+		if !ok {
+			t.Errorf("%s: no progress reported", name)
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.done != ev.total || ev.total != fi.Size() {
+			t.Errorf("%s: last progress %d/%d, want %d/%d", name, ev.done, ev.total, fi.Size(), fi.Size())
+		}
+	}
+
+	if len(batch) == 0 || batch[0] != 0 || batch[len(batch)-1] != int64(len(batch)-1) {
+		t.Errorf("batch progress %v", batch)
+	}
+}
@@ -0,0 +1,109 @@
+package celo
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateChunk maximum number of bytes read or written at once through a
+// rateLimiter, so transfers are spread instead of bursting.
+const rateChunk = 32 << 10
+
+// rateLimiter limits the throughput of the readers and writers it wraps, all
+// of them combined, to rate bytes per second. It is safe for concurrent use,
+// so clones and workers share it.
+type rateLimiter struct {
+	rate  int64
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mu sync.Mutex
+	// next is the time the bytes transferred so far fit in the rate.
+	next time.Time
+}
+
+// newRateLimiter creates a rateLimiter of rate bytes per second.
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, now: time.Now, sleep: time.Sleep}
+}
+
+// chunk returns the number of bytes of b transferred at once.
+func (l *rateLimiter) chunk(b []byte) int {
+	n := len(b)
+	if n > rateChunk {
+		n = rateChunk
+	}
+	if int64(n) > l.rate {
+		n = int(l.rate)
+	}
+	return n
+}
+
+// wait accounts n bytes transferred and sleeps until they fit in the rate.
+func (l *rateLimiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	d := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if d > 0 {
+		l.sleep(d)
+	}
+}
+
+// rateReader reads from r at the rate of l.
+type rateReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (r *rateReader) Read(b []byte) (n int, err error) {
+	n, err = r.r.Read(b[:r.l.chunk(b)])
+	r.l.wait(n)
+	return n, err
+}
+
+// rateWriter writes to w at the rate of l.
+type rateWriter struct {
+	w io.Writer
+	l *rateLimiter
+}
+
+func (w *rateWriter) Write(b []byte) (n int, err error) {
+	for n < len(b) {
+		var wn int
+		wn, err = w.w.Write(b[n : n+w.l.chunk(b[n:])])
+		n += wn
+		w.l.wait(wn)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// limitReader returns r limited to the rate set with LimitRate, or r itself
+// if there is none.
+func (c *celo) limitReader(r io.Reader) io.Reader {
+	if c.limiter == nil {
+		return r
+	}
+	return &rateReader{r: r, l: c.limiter}
+}
+
+// limitWriter returns w limited to the rate set with LimitRate, or w itself
+// if there is none.
+func (c *celo) limitWriter(w io.Writer) io.Writer {
+	if c.limiter == nil {
+		return w
+	}
+	return &rateWriter{w: w, l: c.limiter}
+}
@@ -0,0 +1,85 @@
+package celo
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// fakeClock a clock whose time only advances when something sleeps.
+type fakeClock struct {
+	t     time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.t = c.t.Add(d)
+	c.slept += d
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l := newRateLimiter(100 << 10)
+	l.now, l.sleep = clock.now, clock.sleep
+
+	data := randomPlaintext(300 << 10)
+	var buf bytes.Buffer
+	w := &rateWriter{w: &buf, l: l}
+	if n, err := io.Copy(w, &rateReader{r: bytes.NewReader(data), l: l}); err != nil || n != int64(len(data)) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("the data written doesn't match the data read")
+	}
+	// 300 KiB read and 300 KiB written at 100 KiB/s.
+	if want := 6 * time.Second; clock.slept != want {
+		t.Errorf("slept %v, want %v", clock.slept, want)
+	}
+
+	// Idle time isn't saved up for bursts.
+	clock.slept = 0
+	clock.t = clock.t.Add(time.Hour)
+	l.wait(50 << 10)
+	clock.t = clock.t.Add(time.Second)
+	l.wait(50 << 10)
+	if clock.slept != time.Second {
+		t.Errorf("slept %v, want 1s", clock.slept)
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	e := NewEncrypter()
+	if err := e.Config(LimitRate(-1)); !errors.Is(errors.Invalid, err) {
+		t.Errorf("got %v, want kind Invalid", err)
+	}
+	if err := e.Config(LimitRate(1 << 30)); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := randomPlaintext(1024)
+	var encrypted bytes.Buffer
+	if _, err := e.EncryptStream([]byte("secret"), bytes.NewReader(plaintext), &encrypted); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecrypter()
+	if err := d.Config(LimitRate(1 << 30)); err != nil {
+		t.Fatal(err)
+	}
+	var decrypted bytes.Buffer
+	if _, err := d.DecryptStream([]byte("secret"), &encrypted, &decrypted); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), plaintext) {
+		t.Error("the decrypted stream doesn't match the plaintext")
+	}
+
+	if err := d.Config(LimitRate(0)); err != nil || d.limiter != nil {
+		t.Errorf("LimitRate(0) didn't remove the limit: %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package celo
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// PlaintextReader provides random access to the plaintext of a chunked
+// encrypted file. Only the chunks that contain the requested ranges are read
+// and decrypted, so ranges of huge files can be read without decrypting
+// everything.
+// It implements io.ReaderAt, io.ReadSeeker and io.WriterTo. ReadAt can be
+// called concurrently.
+type PlaintextReader struct {
+	r io.ReaderAt
+
+	cipher *Cipher
+	// ad file signature authenticated along with each chunk.
+	ad []byte
+
+	// offset of the payload within r.
+	offset int64
+	layout chunkLayout
+
+	// size of the plaintext without padding.
+	size int64
+
+	// pos current offset used by Read and Seek.
+	pos int64
+
+	// mu guards the last decrypted chunk.
+	mu         sync.Mutex
+	chunkIndex int64
+	chunk      []byte
+}
+
+// OpenAt decodes the file of the given size from r and returns a reader over
+// its plaintext, decrypted with the secret phrase (or the identities added
+// with AddIdentity).
+// The signature of signed files is only verified if VerifyWith was used,
+// since it requires reading the whole file.
+// It returns an error if the payload of the file isn't chunked.
+func (d *Decrypter) OpenAt(secretPhrase []byte, r io.ReaderAt, size int64) (*PlaintextReader, error) {
+	op := errors.Op("decrypter.OpenAt")
+
+	// The ciphertext of the instance no longer matches the decoded metadata.
+	d.initialized = false
+	d.signer = nil
+
+	hn, err := d.readHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := d.metadata.chunkSize()
+	if chunkSize == 0 || !d.metadata.hasFlag(flagEnvelope) {
+		return nil, errors.E(errors.Incompatible, op, errors.Errorf("random access requires a chunked file"))
+	}
+
+	signed := d.metadata.hasFlag(flagSigned)
+	if !signed && d.verifyingKey != nil {
+		return nil, errors.E(errors.Sign, op, errors.Errorf("file isn't signed by %s", d.verifyingKey))
+	}
+
+	// The payload is followed by the trailer and the signature block.
+	end := size
+	if signed {
+		end -= SignatureBlockSize
+	}
+
+	if d.metadata.hasFlag(flagTrailer) {
+		end -= TrailerSize
+		if end < int64(hn) {
+			return nil, errors.E(errors.Truncated, op)
+		}
+
+		// Only the size is checked, verifying the checksum requires reading
+		// the whole payload. Chunks are authenticated as they are read.
+		t := make([]byte, TrailerSize)
+		if _, err = r.ReadAt(t, end); err != nil {
+			return nil, errors.E(errors.Truncated, op, err)
+		}
+		if _, err = parseTrailer(t, end-int64(hn)); err != nil {
+			return nil, err
+		}
+	}
+
+	if end < int64(hn) {
+		return nil, errors.E(errors.Truncated, op)
+	}
+
+	if signed && d.verifyingKey != nil {
+		if err = d.verifyAt(r, size-SignatureBlockSize); err != nil {
+			return nil, err
+		}
+	}
+
+	dataKey, err := d.unwrap(context.Background(), secretPhrase)
+	if err != nil {
+		return nil, err
+	}
+
+	dataCipher, err := NewCipher(d.blockSize, d.nonceSize, dataKey)
+	ZeroBytes(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PlaintextReader{
+		r:          r,
+		cipher:     dataCipher,
+		ad:         d.additionalData(d.metadata),
+		offset:     int64(hn),
+		layout:     newChunkLayout(end-int64(hn), chunkSize, dataCipher.NonceSize()),
+		chunkIndex: -1,
+	}
+
+	// Decrypting the last chunk detects truncated files and it is required to
+	// find the padding.
+	if pr.size, err = pr.unpaddedSize(d.metadata.Padding()); err != nil {
+		return nil, err
+	}
+
+	return pr, nil
+}
+
+// verifyAt verifies the signature block that follows the first end bytes of r
+// and that it was made by the key passed to VerifyWith.
+func (d *Decrypter) verifyAt(r io.ReaderAt, end int64) (err error) {
+	op := errors.Op("decrypter.verifyAt")
+
+	h := newSignatureHash()
+	if _, err = io.Copy(h, io.NewSectionReader(r, 0, end)); err != nil {
+		return errors.E(errors.Ciphertext, op, err)
+	}
+
+	block := make([]byte, SignatureBlockSize)
+	if _, err = r.ReadAt(block, end); err != nil {
+		return errors.E(errors.Sign, op, err)
+	}
+
+	if d.signer, err = verify(h.Sum(nil), block); err != nil {
+		return err
+	}
+
+	if !d.verifyingKey.Equal(d.signer) {
+		return errors.E(errors.Sign, op, errors.Errorf("file isn't signed by %s", d.verifyingKey))
+	}
+
+	return nil
+}
+
+// unpaddedSize returns the size of the plaintext once the padding is stripped.
+// Chunks are decrypted from the last one until the padding marker is found.
+func (pr *PlaintextReader) unpaddedSize(p Padding) (int64, error) {
+	last := pr.layout.chunks - 1
+
+	chunk, err := pr.readChunk(last)
+	if err != nil {
+		return 0, err
+	}
+
+	if p == PaddingNone {
+		return last*pr.layout.chunkSize + int64(len(chunk)), nil
+	}
+
+	for i := last; i >= 0; i-- {
+		if i != last {
+			if chunk, err = pr.readChunk(i); err != nil {
+				return 0, err
+			}
+		}
+
+		for j := len(chunk) - 1; j >= 0; j-- {
+			switch chunk[j] {
+			case 0:
+				continue
+			case paddingMarker:
+				return i*pr.layout.chunkSize + int64(j), nil
+			}
+			// A byte other than 0 was found before the marker.
+			return 0, errors.E(errors.Padding, errors.Op("reader.unpaddedSize"))
+		}
+	}
+
+	return 0, errors.E(errors.Padding, errors.Op("reader.unpaddedSize"))
+}
+
+// readChunk reads and decrypts the chunk i, keeping it as the last decrypted
+// chunk.
+func (pr *PlaintextReader) readChunk(i int64) ([]byte, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if i == pr.chunkIndex {
+		return pr.chunk, nil
+	}
+
+	start, end := pr.layout.bounds(i)
+	sealed := make([]byte, end-start)
+	if _, err := pr.r.ReadAt(sealed, pr.offset+start); err != nil {
+		return nil, errors.E(errors.Ciphertext, errors.Op("reader.readChunk"), err)
+	}
+
+	chunk, err := openChunk(pr.cipher, sealed, pr.ad, i, i == pr.layout.chunks-1)
+	if err != nil {
+		return nil, err
+	}
+
+	pr.chunkIndex = i
+	pr.chunk = chunk
+
+	return chunk, nil
+}
+
+// Size returns the size of the plaintext.
+func (pr *PlaintextReader) Size() int64 {
+	return pr.size
+}
+
+// ReadAt reads len(b) bytes of the plaintext starting at offset off.
+func (pr *PlaintextReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.E(errors.Invalid, errors.Op("reader.ReadAt"), errors.Errorf("negative offset"))
+	}
+
+	for n < len(b) && off < pr.size {
+		i := off / pr.layout.chunkSize
+
+		chunk, err := pr.readChunk(i)
+		if err != nil {
+			return n, err
+		}
+
+		// Padding isn't part of the plaintext.
+		start := off - i*pr.layout.chunkSize
+		end := int64(len(chunk))
+		if i*pr.layout.chunkSize+end > pr.size {
+			end = pr.size - i*pr.layout.chunkSize
+		}
+
+		c := copy(b[n:], chunk[start:end])
+		n += c
+		off += int64(c)
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Read reads up to len(b) bytes of the plaintext from the current offset.
+func (pr *PlaintextReader) Read(b []byte) (n int, err error) {
+	if pr.pos >= pr.size {
+		return 0, io.EOF
+	}
+
+	n, err = pr.ReadAt(b, pr.pos)
+	pr.pos += int64(n)
+
+	if err == io.EOF && n > 0 {
+		// Read doesn't report EOF along with data.
+		err = nil
+	}
+
+	return n, err
+}
+
+// WriteTo writes the plaintext from the current offset to w, one decrypted
+// chunk at a time, so io.Copy doesn't need an intermediate buffer.
+func (pr *PlaintextReader) WriteTo(w io.Writer) (n int64, err error) {
+	for pr.pos < pr.size {
+		i := pr.pos / pr.layout.chunkSize
+
+		chunk, err := pr.readChunk(i)
+		if err != nil {
+			return n, err
+		}
+
+		// Padding isn't part of the plaintext.
+		start := pr.pos - i*pr.layout.chunkSize
+		end := int64(len(chunk))
+		if i*pr.layout.chunkSize+end > pr.size {
+			end = pr.size - i*pr.layout.chunkSize
+		}
+
+		c, err := w.Write(chunk[start:end])
+		n += int64(c)
+		pr.pos += int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Seek sets the offset for the next Read, interpreted according to whence
+// (See io.Seeker).
+func (pr *PlaintextReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += pr.pos
+	case io.SeekEnd:
+		offset += pr.size
+	default:
+		return 0, errors.E(errors.Invalid, errors.Op("reader.Seek"), errors.Errorf("invalid whence"))
+	}
+
+	if offset < 0 {
+		return 0, errors.E(errors.Invalid, errors.Op("reader.Seek"), errors.Errorf("negative position"))
+	}
+
+	pr.pos = offset
+
+	return offset, nil
+}
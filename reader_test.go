@@ -0,0 +1,224 @@
+package celo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+const testChunkSize = 1 << ChunkSizeLog2
+
+// randomPlaintext returns n reproducible pseudo-random bytes.
+func randomPlaintext(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestOpenAt(t *testing.T) {
+	phrase := []byte("secret")
+	sizes := []int{0, 1, testChunkSize - 1, testChunkSize, testChunkSize + 1, 3*testChunkSize + 100}
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, p := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		e := NewEncrypter()
+		e.Config(SetPadding(p))
+
+		for _, size := range sizes {
+			plaintext := randomPlaintext(size)
+			file := sealFile(t, e, phrase, plaintext)
+
+			pr, err := NewDecrypter().OpenAt(phrase, bytes.NewReader(file), int64(len(file)))
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", p, size, err)
+			}
+			if pr.Size() != int64(size) {
+				t.Errorf("%v, %d bytes: got size %d", p, size, pr.Size())
+			}
+
+			// Random ranges, including ranges across chunks and past the end.
+			for i := 0; i < 20 && size > 0; i++ {
+				off := rnd.Intn(size)
+				b := make([]byte, rnd.Intn(2*testChunkSize))
+				n, err := pr.ReadAt(b, int64(off))
+
+				want := plaintext[off:]
+				if len(want) > len(b) {
+					want = want[:len(b)]
+				}
+				if !bytes.Equal(b[:n], want) {
+					t.Fatalf("%v, %d bytes: ReadAt(%d, %d) mismatch", p, size, len(b), off)
+				}
+				if n < len(b) && err != io.EOF {
+					t.Errorf("%v, %d bytes: short ReadAt returned error %v, want io.EOF", p, size, err)
+				}
+			}
+
+			// Sequential reads after a seek.
+			if _, err = pr.Seek(int64(size/2), io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(pr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rest, plaintext[size/2:]) {
+				t.Errorf("%v, %d bytes: Read after Seek mismatch", p, size)
+			}
+		}
+	}
+}
+
+func TestOpenAtWrongPhrase(t *testing.T) {
+	file := sealFile(t, NewEncrypter(), []byte("secret"), randomPlaintext(100))
+
+	_, err := NewDecrypter().OpenAt([]byte("garbage"), bytes.NewReader(file), int64(len(file)))
+	if !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+func TestChunksTampered(t *testing.T) {
+	phrase := []byte("secret")
+	plaintext := randomPlaintext(3 * testChunkSize)
+	file := sealFile(t, NewEncrypter(), phrase, plaintext)
+
+	info, err := Inspect(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedChunk := info.NonceSize + testChunkSize + TagSize
+	chunk := func(b []byte, i int) []byte {
+		start := info.HeaderSize + i*sealedChunk
+		return b[start : start+sealedChunk]
+	}
+
+	// A flipped bit only affects the chunk it belongs to.
+	tampered := append([]byte(nil), file...)
+	chunk(tampered, 1)[100] ^= 1
+
+	pr, err := NewDecrypter().OpenAt(phrase, bytes.NewReader(tampered), int64(len(tampered)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 10)
+	if _, err = pr.ReadAt(b, 0); err != nil {
+		t.Errorf("intact chunk: %v", err)
+	}
+	if _, err = pr.ReadAt(b, testChunkSize); !errors.Is(errors.Ciphertext, err) {
+		t.Errorf("tampered chunk: got error %v, want kind Ciphertext", err)
+	}
+
+	// Reordered chunks don't authenticate.
+	reordered := append([]byte(nil), file...)
+	copy(chunk(reordered, 0), chunk(file, 1))
+	copy(chunk(reordered, 1), chunk(file, 0))
+
+	for name, b := range map[string][]byte{"tampered": tampered, "reordered": reordered} {
+		d := NewDecrypter()
+		if _, err = d.Read(bytes.NewReader(b)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// The trailer doesn't match the payload anymore.
+		if _, err = d.Decrypt(phrase); !errors.Is(errors.Ciphertext, err) {
+			t.Errorf("%s: got error %v, want kind Ciphertext", name, err)
+		}
+	}
+}
+
+// Chunks are authenticated with their index and whether they are the last one,
+// regardless of the trailer.
+func TestOpenChunksOrder(t *testing.T) {
+	c, err := NewCipher(Aes256BlockSize, NonceSize, make([]byte, Aes256BlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("metadata")
+	chunkSize := 1 << minChunkSizeLog2
+	sealedChunk := NonceSize + chunkSize + TagSize
+
+	sealed, err := sealChunks(context.Background(), c, randomPlaintext(3*chunkSize), ad, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reordered := append([]byte(nil), sealed...)
+	copy(reordered, sealed[sealedChunk:2*sealedChunk])
+	copy(reordered[sealedChunk:], sealed[:sealedChunk])
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		ad     []byte
+	}{
+		{"reordered", reordered, ad},
+		{"last dropped", sealed[:2*sealedChunk], ad},
+		{"other metadata", sealed, []byte("metadatA")},
+	}
+	for _, tt := range tests {
+		if _, err = openChunks(context.Background(), c, tt.sealed, tt.ad, chunkSize); !errors.Is(errors.Ciphertext, err) {
+			t.Errorf("%s: got error %v, want kind Ciphertext", tt.name, err)
+		}
+	}
+}
+
+// Chunk nonces are a random prefix per payload followed by the chunk index.
+func TestChunkNonces(t *testing.T) {
+	c, err := NewCipher(Aes256BlockSize, NonceSize, make([]byte, Aes256BlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("metadata")
+	chunkSize := 1 << minChunkSizeLog2
+	sealedChunk := NonceSize + chunkSize + TagSize
+	plaintext := randomPlaintext(3*chunkSize - 1)
+
+	sealed, err := sealChunks(context.Background(), c, plaintext, ad, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed := new(bytes.Buffer)
+	if err = sealChunksTo(context.Background(), c, bytes.NewReader(plaintext), int64(len(plaintext)), ad, chunkSize, streamed); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range [][]byte{sealed, streamed.Bytes()} {
+		prefix := b[:NonceSize-8]
+		for i := 0; i < 3; i++ {
+			nonce := b[i*sealedChunk : i*sealedChunk+NonceSize]
+			if !bytes.Equal(nonce, chunkNonce(prefix, int64(i))) {
+				t.Errorf("chunk %d: nonce %x, want prefix %x and counter %d", i, nonce, prefix, i)
+			}
+		}
+	}
+	if bytes.Equal(sealed[:NonceSize], streamed.Bytes()[:NonceSize]) {
+		t.Error("payloads share the nonce prefix")
+	}
+
+	// Payloads with random nonces are still decrypted.
+	var random []byte
+	for i := 0; i < 3; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		nonce, ciphertext, err := c.Encrypt(plaintext[i*chunkSize:end], chunkAdditionalData(ad, int64(i), i == 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		random = append(append(random, nonce...), ciphertext...)
+	}
+	for _, b := range [][]byte{sealed, streamed.Bytes(), random} {
+		got, err := openChunks(context.Background(), c, b, ad, chunkSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Error("decrypted content differs")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package celo
+
+import (
+	"context"
+	"os"
+
+	"github.com/rrivera/celo/errors"
+	"github.com/rrivera/celo/file"
+)
+
+// RekeyFile decrypts the file with the specified name using oldPhrase and
+// encrypts it again for newPhrase. The padding scheme of the file is
+// preserved.
+// The file is replaced atomically, if any step fails it isn't modified.
+// Options are applied to both the Decrypter and the Encrypter used, e.g.
+// VerifyWith to require a signer or SignWith to sign the new file.
+//
+// For files that use envelope encryption, only the stanza of oldPhrase is
+// replaced, with a stanza derived with the parameters of SetKDFParams: the data
+// key and the payload don't change, so the rest of the
+// recipients of the file keep access to it. Signed files are signed again with
+// the key passed to SignWith, an error of kind errors.Sign is returned if it is
+// missing. Unlike Decrypter.RewrapFile, the whole file is authenticated before
+// it is replaced.
+// Files that don't use envelope encryption are re-encrypted in the current
+// format.
+func RekeyFile(oldPhrase, newPhrase []byte, name string, opts ...Option) error {
+	d := NewDecrypter()
+	if err := d.Config(opts...); err != nil {
+		return err
+	}
+
+	e := NewEncrypter()
+	if err := e.Config(opts...); err != nil {
+		return err
+	}
+
+	return rekeyFile(d, e, oldPhrase, newPhrase, name)
+}
+
+// RekeyMultipleFiles rekeys a list of files with the specified names (See
+// RekeyFile).
+// It returns a list of file names that were successfully rekeyed and a list of
+// errors, each for a file that couldn't be rekeyed.
+func RekeyMultipleFiles(oldPhrase, newPhrase []byte, fileNames []string, opts ...Option) (rekeyedFileNames []string, errs []error) {
+	errs = []error{}
+	rekeyedFileNames = []string{}
+
+	// Instances are shared so the keys generated from the phrases can be
+	// reused when possible.
+	d := NewDecrypter()
+	e := NewEncrypter()
+
+	cerr := d.Config(opts...)
+	if cerr == nil {
+		cerr = e.Config(opts...)
+	}
+
+	for _, name := range fileNames {
+		err := cerr
+		if err == nil {
+			err = rekeyFile(d, e, oldPhrase, newPhrase, name)
+		}
+		if err != nil {
+			errs = append(errs, errors.E(errors.Encrypt, errors.Op("rekey.RekeyMultipleFiles"), errors.Entity(name), err))
+		} else {
+			rekeyedFileNames = append(rekeyedFileNames, name)
+		}
+	}
+
+	return rekeyedFileNames, errs
+}
+
+func rekeyFile(d *Decrypter, e *Encrypter, oldPhrase, newPhrase []byte, name string) error {
+	op := errors.Op("rekey.rekeyFile")
+
+	source, err := os.Open(name)
+	if err != nil {
+		return errors.E(errors.Open, op, err)
+	}
+	defer source.Close()
+
+	fi, err := source.Stat()
+	if err != nil {
+		return errors.E(errors.Open, op, err)
+	}
+
+	if _, err = d.Read(source); err != nil {
+		return err
+	}
+
+	// The whole file is decrypted to authenticate it before it is replaced.
+	plaintext, err := d.Decrypt(oldPhrase)
+	if err != nil {
+		return err
+	}
+
+	if d.metadata.hasFlag(flagEnvelope) {
+		if e, err = rekeyEnvelope(d, e, oldPhrase, newPhrase); err != nil {
+			return err
+		}
+	} else {
+		e.padding = d.metadata.Padding()
+		if _, err = e.Encrypt(newPhrase, plaintext); err != nil {
+			return err
+		}
+	}
+
+	// The new content is written next to the file and renamed once it is
+	// complete.
+	tmp, err := file.CreateTemp(name)
+	if err != nil {
+		return err
+	}
+
+	if err = tmp.Chmod(fi.Mode().Perm()); err == nil {
+		_, err = e.Write(tmp)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.E(errors.Create, op, err)
+	}
+
+	return file.Commit(tmp, name)
+}
+
+// rekeyEnvelope returns an Encrypter that encodes the last file decoded by d,
+// with the stanza of oldPhrase replaced by a stanza for newPhrase. The rest of
+// the stanzas and the payload are kept, and the configuration of e is used to
+// derive the key of the new stanza and to sign it.
+func rekeyEnvelope(d *Decrypter, e *Encrypter, oldPhrase, newPhrase []byte) (*Encrypter, error) {
+	op := errors.Op("rekey.rekeyEnvelope")
+
+	if d.metadata.hasFlag(flagSigned) && e.signingKey == nil {
+		// Replacing the stanza invalidates the signature.
+		return nil, errors.E(errors.Sign, op, errors.Errorf("the file is signed, a signing key is required to rekey it"))
+	}
+
+	if len(newPhrase) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, op)
+	}
+
+	i, dataKey, err := d.unwrapPhrase(context.Background(), oldPhrase)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroBytes(dataKey)
+
+	// The new stanza records the key derivation parameters of e.
+	s, err := wrapWithPhrase(StanzaPhraseKDF, e.kdf, newPhrase, dataKey, d.metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Encrypter{celo: e.celo.clone()}
+	w.metadata = d.metadata
+	w.stanzas = append([]*Stanza(nil), d.stanzas...)
+	w.stanzas[i] = s
+	w.nonce = d.nonce
+	w.ciphertext = d.ciphertext
+	w.initialized = true
+
+	if d.metadata.hasFlag(flagTrailer) {
+		// The decoded trailer only keeps the checksum.
+		if w.trailer, err = newTrailer(dataKey, d.nonce, d.ciphertext); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
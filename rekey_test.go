@@ -0,0 +1,113 @@
+package celo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// writeSealed encrypts plaintext with e to a file in a temporary directory.
+func writeSealed(t *testing.T, e *Encrypter, secretPhrase, plaintext []byte) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "file.celo")
+	if err := os.WriteFile(name, sealFile(t, e, secretPhrase, plaintext), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// readSealed decrypts the file name with d.
+func readSealed(t *testing.T, d *Decrypter, secretPhrase []byte, name string) ([]byte, error) {
+	t.Helper()
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return openFile(d, secretPhrase, b)
+}
+
+func TestRekeyFile(t *testing.T) {
+	plaintext := []byte("attack at dawn")
+	name := writeSealed(t, NewEncrypter(), []byte("old"), plaintext)
+
+	if err := RekeyFile([]byte("old"), []byte("new"), name); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readSealed(t, NewDecrypter(), []byte("new"), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("got %q, want %q", got, plaintext)
+	}
+	if _, err = readSealed(t, NewDecrypter(), []byte("old"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("old phrase: got error %v, want kind WrongPassphrase", err)
+	}
+
+	// A wrong phrase doesn't modify the file.
+	before, _ := os.ReadFile(name)
+	if err = RekeyFile([]byte("old"), []byte("other"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got error %v, want kind WrongPassphrase", err)
+	}
+	if after, _ := os.ReadFile(name); !bytes.Equal(before, after) {
+		t.Error("file modified by a failed rekey")
+	}
+}
+
+func TestRekeyFileKeepsRecipients(t *testing.T) {
+	plaintext := []byte("attack at dawn")
+	id, _ := GenerateX25519Identity()
+	other, _ := NewPhraseRecipient([]byte("other"))
+
+	e := NewEncrypter()
+	e.Config(AddRecipient(id.Recipient()), AddRecipient(other))
+	name := writeSealed(t, e, []byte("old"), plaintext)
+
+	if err := RekeyFile([]byte("old"), []byte("new"), name); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecrypter()
+	d.Config(AddIdentity(id))
+	for _, phrase := range []string{"", "new", "other"} {
+		got, err := readSealed(t, d, []byte(phrase), name)
+		if err != nil {
+			t.Fatalf("phrase %q: %v", phrase, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("phrase %q: got %q, want %q", phrase, got, plaintext)
+		}
+	}
+
+	if _, err := readSealed(t, NewDecrypter(), []byte("old"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("old phrase: got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+func TestRekeyFileSigned(t *testing.T) {
+	k, _ := GenerateSigningKey()
+	e := NewEncrypter()
+	e.Config(SignWith(k))
+	name := writeSealed(t, e, []byte("old"), []byte("attack at dawn"))
+
+	// The signature can't be kept without the signing key.
+	if err := RekeyFile([]byte("old"), []byte("new"), name); !errors.Is(errors.Sign, err) {
+		t.Errorf("got error %v, want kind Sign", err)
+	}
+
+	if err := RekeyFile([]byte("old"), []byte("new"), name, SignWith(k)); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecrypter()
+	d.Config(VerifyWith(k.Public()))
+	if _, err := readSealed(t, d, []byte("new"), name); err != nil {
+		t.Fatal(err)
+	}
+}
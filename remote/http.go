@@ -0,0 +1,189 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+const (
+	// httpRetries number of times in a row a download is resumed when the
+	// connection breaks without receiving anything.
+	httpRetries = 5
+	// httpBackoff time waited before resuming a download, multiplied by the
+	// number of retries in a row.
+	httpBackoff = time.Second
+)
+
+// HTTP is the Remote of the files served at http:// and https:// URLs, such
+// as backups published by a web server. They can't be written. If the
+// connection breaks while a file is read, the download is resumed where it
+// stopped with a Range request, as long as the server supports them and the
+// file didn't change.
+type HTTP struct {
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewHTTP creates an HTTP remote with the default client.
+func NewHTTP() *HTTP {
+	return &HTTP{client: http.DefaultClient, retries: httpRetries, backoff: httpBackoff}
+}
+
+// get sends a GET request, or a HEAD request if head is true, for u with the
+// given headers and returns its response if its status is a success.
+func (h *HTTP) get(ctx context.Context, u string, head bool, header http.Header) (*http.Response, error) {
+	method := http.MethodGet
+	if head {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Errorf("HTTP: %v", err))
+	}
+	if res.StatusCode/100 == 2 {
+		return res, nil
+	}
+	res.Body.Close()
+
+	kind := errors.Open
+	switch res.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		kind = errors.NotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = errors.Permissions
+	}
+	return nil, errors.E(kind, errors.Errorf("HTTP: %s", res.Status))
+}
+
+// Open returns the body of the response to a GET request of u, which
+// resumes the download if the connection breaks.
+func (h *HTTP) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, errors.E(errors.Invalid, errors.Errorf("%s has no file name, expected %s://host/path/file", u, u.Scheme))
+	}
+	res, err := h.get(ctx, u.String(), false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &httpReader{ctx: ctx, remote: h, url: u.String(), body: res.Body}
+	// Downloads can only be resumed if the server identifies the version of
+	// the file, so a file that changed isn't mixed up with the previous one.
+	if res.Header.Get("Accept-Ranges") == "bytes" && res.Header.Get("Content-Encoding") == "" {
+		r.version = res.Header.Get("ETag")
+		if r.version == "" || strings.HasPrefix(r.version, "W/") {
+			r.version = res.Header.Get("Last-Modified")
+		}
+	}
+	return r, nil
+}
+
+// Exists sends a HEAD request of u.
+func (h *HTTP) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	res, err := h.get(ctx, u.String(), true, nil)
+	if errors.Is(errors.NotExist, err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	return true, nil
+}
+
+// Create returns an error of kind errors.Invalid, the files can only be read.
+func (h *HTTP) Create(ctx context.Context, u *url.URL, r io.Reader, perm os.FileMode) error {
+	return errors.E(errors.Invalid, errors.Errorf("%s URLs can only be read", u.Scheme))
+}
+
+// httpReader reads the body of the response to a GET request, resuming it
+// with Range requests when the connection breaks.
+type httpReader struct {
+	ctx    context.Context
+	remote *HTTP
+	url    string
+	body   io.ReadCloser
+	// version ETag or Last-Modified of the file, empty if the download can't
+	// be resumed.
+	version string
+	// offset number of bytes read so far.
+	offset int64
+	// retries number of times in a row the download was resumed.
+	retries int
+}
+
+func (r *httpReader) Read(b []byte) (int, error) {
+	for {
+		n, err := r.body.Read(b)
+		r.offset += int64(n)
+		if n > 0 {
+			r.retries = 0
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if r.version == "" || r.retries >= r.remote.retries || r.ctx.Err() != nil {
+			return n, errors.E(errors.Open, errors.Errorf("HTTP: %v", err))
+		}
+		if rerr := r.resume(); rerr != nil {
+			return n, rerr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the rest of the file from offset, once the backoff passed.
+// Requests that fail to connect, or with a server error, are retried.
+func (r *httpReader) resume() error {
+	r.body.Close()
+
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	header.Set("If-Range", r.version)
+	for {
+		r.retries++
+		select {
+		case <-r.ctx.Done():
+			return errors.E(errors.Canceled, r.ctx.Err())
+		case <-time.After(time.Duration(r.retries) * r.remote.backoff):
+		}
+
+		res, err := r.remote.get(r.ctx, r.url, false, header)
+		if err != nil {
+			if errors.Is(errors.Open, err) && r.retries < r.remote.retries {
+				continue
+			}
+			return err
+		}
+		// The whole file is sent instead of the range if it changed.
+		if res.StatusCode != http.StatusPartialContent || !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", r.offset)) {
+			res.Body.Close()
+			return errors.E(errors.Open, errors.Errorf("HTTP: the file changed while it was downloaded"))
+		}
+		r.body = res.Body
+		return nil
+	}
+}
+
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// fakeHTTP serves files by their path, with the Range requests of
+// http.ServeContent. The first breaks responses are cut after half of what
+// was requested.
+type fakeHTTP struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	etag   string
+	breaks int
+	ranges []string
+}
+
+func (f *fakeHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	b, ok := f.files[r.URL.Path]
+	etag := f.etag
+	cut := f.breaks > 0
+	if cut {
+		f.breaks--
+	}
+	f.ranges = append(f.ranges, r.Header.Get("Range"))
+	f.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if cut {
+		w = &cutWriter{ResponseWriter: w, n: len(b) / 4}
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+}
+
+// cutWriter breaks the connection once n bytes were written.
+type cutWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *cutWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		w.ResponseWriter.Write(b[:w.n])
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.n -= len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func TestHTTP(t *testing.T) {
+	content := bytes.Repeat([]byte("the backup "), 10000)
+	fake := &fakeHTTP{files: map[string][]byte{"/backup.celo": content}, etag: `"v1"`}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	h := NewHTTP()
+	h.backoff = time.Millisecond
+	ctx := context.Background()
+	parse := func(name string) *url.URL {
+		u, err := url.Parse(srv.URL + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	read := func(u *url.URL) ([]byte, error) {
+		r, err := h.Open(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	// Broken downloads are resumed where they stopped.
+	fake.breaks = 2
+	if got, err := read(parse("/backup.celo")); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("the resumed download doesn't match the file: %v", err)
+	}
+	if len(fake.ranges) != 3 || fake.ranges[0] != "" || !strings.HasPrefix(fake.ranges[1], "bytes=") {
+		t.Errorf("got ranges %q", fake.ranges)
+	}
+
+	// Nothing is resumed if the file changed, or if it can't be identified.
+	for _, etag := range []string{`"v2"`, ""} {
+		fake.breaks = 1
+		fake.etag = `"v1"`
+		r, err := h.Open(ctx, parse("/backup.celo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.etag = etag
+		if etag == "" {
+			r.(*httpReader).version = ""
+		}
+		_, err = io.ReadAll(r)
+		if !errors.Is(errors.Open, err) || (etag != "" && !strings.Contains(err.Error(), "changed")) {
+			t.Errorf("ETag %q: got %v, want kind Open", etag, err)
+		}
+		r.Close()
+	}
+	fake.etag = `"v1"`
+
+	if _, err := read(parse("/missing.celo")); !errors.Is(errors.NotExist, err) {
+		t.Errorf("missing file: got %v, want kind NotExist", err)
+	}
+	for name, ok := range map[string]bool{"/backup.celo": true, "/missing.celo": false} {
+		if exists, err := h.Exists(ctx, parse(name)); err != nil || exists != ok {
+			t.Errorf("%s exists: got %v, %v", name, exists, err)
+		}
+	}
+	if _, err := h.Open(ctx, parse("/")); !errors.Is(errors.Invalid, err) {
+		t.Errorf("URL without a file name: got %v, want kind Invalid", err)
+	}
+	if err := h.Create(ctx, parse("/backup.celo"), nil, 0600); !errors.Is(errors.Invalid, err) {
+		t.Errorf("create: got %v, want kind Invalid", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Package remote reads and writes files named by URLs, such as
+// s3://bucket/key, through the Remote registered for their scheme. The
+// schemes s3, ssh, http and https are registered by default; other storages
+// are plugged in with Register:
+//
+//	remote.Register("gs", myGCSRemote)
+//	u, r, ok := remote.Parse("gs://backups/report.pdf.celo")
+//
+// Content is streamed: nothing is kept in memory or in a local temporary
+// file, and a Remote doesn't write anything unless it reads its content
+// completely.
+package remote
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Remote reads and writes the objects named by the URLs of a scheme.
+// It must be safe for concurrent use.
+type Remote interface {
+	// Open returns the content of the object of u. It returns an error of
+	// kind errors.NotExist if there is none.
+	Open(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+	// Exists reports whether the object of u exists.
+	Exists(ctx context.Context, u *url.URL) (bool, error)
+	// Create writes the object of u with the content read from r until
+	// io.EOF, replacing it if it exists. Storages with permissions give it
+	// perm. If reading r fails, the object isn't written or replaced.
+	Create(ctx context.Context, u *url.URL, r io.Reader, perm os.FileMode) error
+}
+
+var (
+	mu      sync.RWMutex
+	remotes = map[string]Remote{}
+)
+
+func init() {
+	Register("s3", NewS3(os.Getenv))
+	Register("ssh", NewSSH(os.Getenv))
+	h := NewHTTP()
+	Register("http", h)
+	Register("https", h)
+}
+
+// Register makes r read and write the URLs of scheme, replacing the Remote
+// registered for it, if any. If r is nil, the scheme is unregistered.
+func Register(scheme string, r Remote) {
+	mu.Lock()
+	defer mu.Unlock()
+	if r == nil {
+		delete(remotes, scheme)
+		return
+	}
+	remotes[scheme] = r
+}
+
+// Lookup returns the Remote registered for scheme.
+func Lookup(scheme string) (Remote, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	r, ok := remotes[scheme]
+	return r, ok
+}
+
+// Schemes returns the sorted schemes registered.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	schemes := make([]string, 0, len(remotes))
+	for s := range remotes {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Parse returns the URL of name and the Remote of its scheme, if name is a
+// URL with a host, such as s3://bucket/key, of a registered scheme.
+func Parse(name string) (*url.URL, Remote, bool) {
+	u, err := url.Parse(name)
+	if err != nil || u.Opaque != "" || u.Host == "" {
+		return nil, nil, false
+	}
+	r, ok := Lookup(u.Scheme)
+	return u, r, ok
+}
@@ -0,0 +1,41 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// nopRemote a Remote that has no objects.
+type nopRemote struct{}
+
+func (nopRemote) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) { return nil, nil }
+func (nopRemote) Exists(ctx context.Context, u *url.URL) (bool, error)        { return false, nil }
+func (nopRemote) Create(ctx context.Context, u *url.URL, r io.Reader, perm os.FileMode) error {
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	if got := Schemes(); !reflect.DeepEqual(got, []string{"http", "https", "s3", "ssh"}) {
+		t.Errorf("got schemes %v", got)
+	}
+
+	for name, ok := range map[string]bool{"s3://backups/a": true, "ssh://me@host/a": true, "https://example.com/a": true, "s3:a": false, "gs://backups/a": false, "a.txt": false, "s3://": false} {
+		if _, _, got := Parse(name); got != ok {
+			t.Errorf("Parse(%s): got %v", name, got)
+		}
+	}
+
+	Register("gs", nopRemote{})
+	u, r, ok := Parse("gs://backups/a")
+	if !ok || r != (nopRemote{}) || u.Host != "backups" || u.Path != "/a" {
+		t.Errorf("got %v, %v, %v", u, r, ok)
+	}
+	Register("gs", nil)
+	if _, ok := Lookup("gs"); ok {
+		t.Error("the scheme wasn't unregistered")
+	}
+}
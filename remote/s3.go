@@ -0,0 +1,449 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// s3UnsignedPayload content hash of the requests whose body isn't signed,
+// it is protected by TLS.
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3PartSize size of the parts of the objects uploaded in parts, the only
+// content kept in memory while an object is written.
+const s3PartSize = 8 << 20
+
+// awsCredentials keys requests to AWS are signed with.
+type awsCredentials struct {
+	accessKey, secretKey string
+	// sessionToken of temporary credentials, empty otherwise.
+	sessionToken string
+}
+
+// S3 is the Remote of the objects of S3 buckets, or of a compatible storage
+// such as MinIO, named by s3://bucket/key URLs. It is configured as the AWS
+// CLI is: the credentials are $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY,
+// or the ones of the profile $AWS_PROFILE (default) in ~/.aws/credentials,
+// the region is $AWS_REGION and the endpoint $AWS_ENDPOINT_URL_S3 or
+// $AWS_ENDPOINT_URL.
+type S3 struct {
+	getenv   func(string) string
+	client   *http.Client
+	now      func() time.Time
+	partSize int
+}
+
+// NewS3 creates an S3 remote reading its configuration with getenv.
+func NewS3(getenv func(string) string) *S3 {
+	return &S3{getenv: getenv, client: http.DefaultClient, now: time.Now, partSize: s3PartSize}
+}
+
+// region returns the region of the buckets.
+func (s *S3) region() string {
+	for _, k := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := s.getenv(k); r != "" {
+			return r
+		}
+	}
+	return "us-east-1"
+}
+
+// credentials returns the credentials of the environment, or of the shared
+// credentials file. It returns an error of kind errors.Permissions if there
+// are none.
+func (s *S3) credentials() (awsCredentials, error) {
+	c := awsCredentials{accessKey: s.getenv("AWS_ACCESS_KEY_ID"), secretKey: s.getenv("AWS_SECRET_ACCESS_KEY"), sessionToken: s.getenv("AWS_SESSION_TOKEN")}
+	if c.accessKey != "" && c.secretKey != "" {
+		return c, nil
+	}
+
+	name := s.getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if name == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return c, errors.E(errors.Permissions, errors.Errorf("no AWS credentials, set $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY"))
+		}
+		name = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := s.getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return c, errors.E(errors.Permissions, errors.Errorf("no AWS credentials, set $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY: %v", err))
+	}
+	defer f.Close()
+	c, err = parseAWSCredentials(f, profile)
+	if err != nil {
+		return c, errors.E(errors.Entity(name), err)
+	}
+	return c, nil
+}
+
+// parseAWSCredentials returns the credentials of profile in the shared
+// credentials file read from r, an INI file with a section for each profile.
+// It returns an error of kind errors.Permissions if the profile has none.
+func parseAWSCredentials(r io.Reader, profile string) (awsCredentials, error) {
+	var c awsCredentials
+	section := ""
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		case section != profile:
+			continue
+		}
+		k, v, _ := strings.Cut(line, "=")
+		switch strings.TrimSpace(k) {
+		case "aws_access_key_id":
+			c.accessKey = strings.TrimSpace(v)
+		case "aws_secret_access_key":
+			c.secretKey = strings.TrimSpace(v)
+		case "aws_session_token":
+			c.sessionToken = strings.TrimSpace(v)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return c, errors.E(errors.Open, err)
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return c, errors.E(errors.Permissions, errors.Errorf("the profile %s has no AWS credentials", profile))
+	}
+	return c, nil
+}
+
+// objectURL returns the URL of the object of u: in the endpoint, if there is
+// one, or in the virtual host of the bucket.
+// It returns an error of kind errors.Invalid if u has no key.
+func (s *S3) objectURL(u *url.URL) (*url.URL, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		return nil, errors.E(errors.Invalid, errors.Errorf("%s has no object key, expected s3://bucket/key", u))
+	}
+
+	endpoint := s.getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = s.getenv("AWS_ENDPOINT_URL")
+	}
+	p := "/" + key
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", u.Host, s.region())
+	} else {
+		// Compatible storages address buckets by their path.
+		p = "/" + u.Host + p
+	}
+
+	o, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, errors.E(errors.Invalid, errors.Errorf("invalid S3 endpoint %s: %v", endpoint, err))
+	}
+	o.Path += p
+	o.RawPath = awsEscape(o.Path)
+	return o, nil
+}
+
+// do sends the request of method for the object of u, with the query
+// parameters and the body of size bytes, signed with the credentials, and
+// returns its response if its status is a success.
+func (s *S3) do(ctx context.Context, method string, u *url.URL, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	c, err := s.credentials()
+	if err != nil {
+		return nil, err
+	}
+	o, err := s.objectURL(u)
+	if err != nil {
+		return nil, err
+	}
+	o.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, o.String(), body)
+	if err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+	payload := emptySHA256
+	if body != nil {
+		req.ContentLength = size
+		payload = s3UnsignedPayload
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	signAWS(req, payload, c, s.region(), "s3", s.now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.E(errors.Open, errors.Errorf("S3: %v", err))
+	}
+	if res.StatusCode/100 == 2 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	return nil, s3Error(res)
+}
+
+// Open returns the content of the object of u.
+func (s *S3) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, u, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Exists sends a HEAD request of the object of u.
+func (s *S3) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	res, err := s.do(ctx, http.MethodHead, u, nil, nil, 0)
+	if errors.Is(errors.NotExist, err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	return true, nil
+}
+
+// Create puts the object of u. Objects that fit in a part are put at once,
+// larger ones are uploaded in parts as r is read, so only a part is kept in
+// memory; the upload is aborted if r fails. perm is ignored, access to the
+// objects is granted by the policies of the bucket.
+func (s *S3) Create(ctx context.Context, u *url.URL, r io.Reader, perm os.FileMode) error {
+	part := make([]byte, s.partSize)
+	// The part might hold plaintext.
+	defer clear(part)
+
+	n, err := io.ReadFull(r, part)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return s.put(ctx, u, part[:n])
+	case err != nil:
+		return errors.E(errors.Create, err)
+	}
+
+	res, err := s.do(ctx, http.MethodPost, u, url.Values{"uploads": {""}}, nil, 0)
+	if err != nil {
+		return createError(err)
+	}
+	var upload struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&upload)
+	res.Body.Close()
+	if err != nil || upload.UploadID == "" {
+		return errors.E(errors.Create, errors.Errorf("S3: malformed response to the upload of %s: %v", u, err))
+	}
+
+	if err = s.uploadParts(ctx, u, upload.UploadID, r, part, n); err != nil {
+		// The parts uploaded are discarded, the object isn't modified.
+		s.do(context.WithoutCancel(ctx), http.MethodDelete, u, url.Values{"uploadId": {upload.UploadID}}, nil, 0)
+		return err
+	}
+	return nil
+}
+
+// uploadParts uploads the parts of the object of u read from r, the first n
+// bytes of part being the first one, and completes the upload id.
+func (s *S3) uploadParts(ctx context.Context, u *url.URL, id string, r io.Reader, part []byte, n int) error {
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+
+	for number := 1; ; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {id}}
+		res, err := s.do(ctx, http.MethodPut, u, query, bytes.NewReader(part[:n]), int64(n))
+		if err != nil {
+			return createError(err)
+		}
+		res.Body.Close()
+		complete.Parts = append(complete.Parts, completedPart{number, res.Header.Get("ETag")})
+
+		n, err = io.ReadFull(r, part)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return errors.E(errors.Create, err)
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return errors.E(errors.Create, err)
+	}
+	res, err := s.do(ctx, http.MethodPost, u, url.Values{"uploadId": {id}}, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return createError(err)
+	}
+	defer res.Body.Close()
+	// Errors completing the upload can be sent once the status was, with
+	// 200 OK.
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err = xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return errors.E(errors.Create, errors.Errorf("S3: %s %s", result.Code, result.Message))
+	}
+	return nil
+}
+
+// put puts the object of u with the content b at once.
+func (s *S3) put(ctx context.Context, u *url.URL, b []byte) error {
+	res, err := s.do(ctx, http.MethodPut, u, nil, bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return createError(err)
+	}
+	res.Body.Close()
+	return nil
+}
+
+// createError returns err, of a request writing an object, with the kind
+// errors.Create if it failed to connect.
+func createError(err error) error {
+	if errors.Is(errors.Open, err) {
+		return errors.E(errors.Create, err)
+	}
+	return err
+}
+
+// s3Error returns the error of the response res of S3, with the kind of its
+// status.
+func s3Error(res *http.Response) error {
+	var body struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+	msg := res.Status
+	if body.Code != "" {
+		msg = fmt.Sprintf("%s: %s %s", res.Status, body.Code, body.Message)
+	}
+
+	kind := errors.Open
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		kind = errors.NotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = errors.Permissions
+	}
+	return errors.E(kind, errors.Errorf("S3: %s", strings.TrimSpace(msg)))
+}
+
+// emptySHA256 hash of the requests without a body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signAWS signs req with the credentials c for the service of region at now,
+// with the Signature Version 4 of AWS. The Host header and the X-Amz-*
+// headers are signed. payload is the hex SHA-256 hash of the body, or
+// UNSIGNED-PAYLOAD.
+func signAWS(req *http.Request, payload string, c awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, awsEscape(k)+"="+strings.ReplaceAll(awsEscape(v), "/", "%2F"))
+		}
+	}
+
+	p := req.URL.Path
+	if p == "" {
+		p = "/"
+	}
+	canonical := strings.Join([]string{req.Method, awsEscape(p), strings.Join(params, "&"), canonicalHeaders.String(), signed, payload}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date[:8], region, service)
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", date, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := []byte("AWS4" + c.secretKey)
+	for _, s := range []string{date[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.accessKey, scope, signed, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of s with key.
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// awsEscape escapes every byte of the path p but the unreserved characters of
+// RFC 3986 and the slashes, as AWS expects.
+func awsEscape(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
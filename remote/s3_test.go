@@ -0,0 +1,209 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// TestSignAWS checks the signature of the get-vanilla request of the
+// Signature Version 4 test suite of AWS.
+func TestSignAWS(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	c := awsCredentials{accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWS(req, emptySHA256, c, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("got X-Amz-Date %s", got)
+	}
+}
+
+func TestParseAWSCredentials(t *testing.T) {
+	const ini = `
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = secret
+
+; a comment
+[backups]
+aws_access_key_id=AKIDBACKUPS
+aws_secret_access_key=other
+aws_session_token=token
+`
+	c, err := parseAWSCredentials(strings.NewReader(ini), "backups")
+	if err != nil || c != (awsCredentials{"AKIDBACKUPS", "other", "token"}) {
+		t.Errorf("got %+v, %v", c, err)
+	}
+	if c, err = parseAWSCredentials(strings.NewReader(ini), "default"); err != nil || c.accessKey != "AKIDDEFAULT" {
+		t.Errorf("got %+v, %v", c, err)
+	}
+	if _, err = parseAWSCredentials(strings.NewReader(ini), "missing"); !errors.Is(errors.Permissions, err) {
+		t.Errorf("missing profile: got %v, want kind Permissions", err)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	env := map[string]string{"AWS_REGION": "eu-west-1"}
+	s := NewS3(func(k string) string { return env[k] })
+
+	for name, want := range map[string]string{
+		"s3://backups/report.pdf.celo": "https://backups.s3.eu-west-1.amazonaws.com/report.pdf.celo",
+		"s3://backups/2024/a+b c.celo": "https://backups.s3.eu-west-1.amazonaws.com/2024/a%2Bb%20c.celo",
+		"s3://backups/dir/":            "",
+		"s3://backups":                 "",
+	} {
+		u, _ := url.Parse(name)
+		o, err := s.objectURL(u)
+		switch {
+		case want == "" && !errors.Is(errors.Invalid, err):
+			t.Errorf("%s: got %v, %v, want kind Invalid", name, o, err)
+		case want != "" && (err != nil || o.String() != want):
+			t.Errorf("%s: got %v, %v, want %s", name, o, err, want)
+		}
+	}
+
+	// Compatible storages address buckets by their path.
+	env["AWS_ENDPOINT_URL"] = "http://localhost:9000/"
+	u, _ := url.Parse("s3://backups/report.pdf.celo")
+	if o, err := s.objectURL(u); err != nil || o.String() != "http://localhost:9000/backups/report.pdf.celo" {
+		t.Errorf("got %v, %v", o, err)
+	}
+}
+
+// fakeS3 keeps the objects put to it by their path, or uploaded in parts,
+// the requests must be signed.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// uploads parts of the uploads in progress, by their ID.
+	uploads map[string][][]byte
+	// aborted number of uploads aborted.
+	aborted int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	id := q.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id = fmt.Sprintf("upload/%d", len(f.uploads)+f.aborted+1)
+		f.uploads[id] = nil
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && id != "":
+		b, _ := io.ReadAll(r.Body)
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		if n != len(f.uploads[id])+1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.uploads[id] = append(f.uploads[id], b)
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && id != "":
+		f.objects[r.URL.Path] = bytes.Join(f.uploads[id], nil)
+		delete(f.uploads, id)
+		io.WriteString(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && id != "":
+		delete(f.uploads, id)
+		f.aborted++
+	case r.Method == http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = b
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	}
+}
+
+// failingReader reads r, then fails with err.
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(b []byte) (int, error) {
+	n, err := f.r.Read(b)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, uploads: map[string][][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	env := map[string]string{"AWS_ENDPOINT_URL": srv.URL, "AWS_ACCESS_KEY_ID": "AKIDEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret"}
+	s := NewS3(func(k string) string { return env[k] })
+	s.partSize = 1 << 10
+	ctx := context.Background()
+	u, _ := url.Parse("s3://backups/report.pdf.celo")
+
+	// Objects larger than a part are uploaded in parts.
+	for _, size := range []int{0, 100, 1 << 10, 3<<10 + 1} {
+		content := bytes.Repeat([]byte{'a'}, size)
+		if err := s.Create(ctx, u, bytes.NewReader(content), 0600); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		r, err := s.Open(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(got, content) {
+			t.Errorf("%d bytes: got %d bytes", size, len(got))
+		}
+	}
+
+	// The upload is aborted if the content can't be read.
+	fake.objects = map[string][]byte{}
+	broken := &failingReader{bytes.NewReader(make([]byte, 2<<10)), errors.Errorf("broken")}
+	if err := s.Create(ctx, u, broken, 0600); err == nil {
+		t.Error("created an object of a broken reader")
+	}
+	if _, ok := fake.objects["/backups/report.pdf.celo"]; ok || fake.aborted != 1 || len(fake.uploads) != 0 {
+		t.Errorf("the upload wasn't aborted: %d aborted, %d in progress", fake.aborted, len(fake.uploads))
+	}
+	broken = &failingReader{bytes.NewReader(make([]byte, 10)), errors.Errorf("broken")}
+	if err := s.Create(ctx, u, broken, 0600); err == nil || len(fake.objects) != 0 {
+		t.Errorf("created an object of a broken reader: %v", err)
+	}
+
+	if ok, err := s.Exists(ctx, u); ok || err != nil {
+		t.Errorf("missing object exists: %v, %v", ok, err)
+	}
+	if _, err := s.Open(ctx, u); !errors.Is(errors.NotExist, err) {
+		t.Errorf("missing object: got %v, want kind NotExist", err)
+	}
+	env["AWS_ACCESS_KEY_ID"] = "AKIDOTHER"
+	if _, err := s.Open(ctx, u); !errors.Is(errors.Permissions, err) || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("denied: got %v, want kind Permissions", err)
+	}
+}
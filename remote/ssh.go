@@ -0,0 +1,208 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// SSHCommandEnv environment variable with the command that connects to the
+// servers of ssh:// URLs, ssh if it isn't set, as GIT_SSH_COMMAND for git.
+const SSHCommandEnv = "CELO_SSH_COMMAND"
+
+// sshTempSuffix suffix of the temporary file a file is written to before it
+// replaces the file.
+const sshTempSuffix = ".celo-tmp"
+
+// SSH is the Remote of the files of servers named by
+// ssh://user@host:port/path URLs, read and written through ssh, so the
+// configuration, keys and known hosts of the user are the ones of ssh. Paths
+// are absolute, or relative to the home directory if they start with /~/.
+// The files aren't transferred with the SFTP protocol: the server must have a
+// POSIX shell, which runs cat, test, chmod and mv to stream and replace them.
+type SSH struct {
+	getenv func(string) string
+}
+
+// NewSSH creates an SSH remote reading its configuration, such as
+// $CELO_SSH_COMMAND, with getenv.
+func NewSSH(getenv func(string) string) *SSH {
+	return &SSH{getenv: getenv}
+}
+
+// command returns the command that runs the shell script returned by script,
+// given the path of the file of u, on its server, and the buffer its stderr
+// is written to. It returns an error of kind errors.Invalid if u has no path.
+func (s *SSH) command(ctx context.Context, u *url.URL, script func(p string) string) (*exec.Cmd, *bytes.Buffer, error) {
+	p := u.Path
+	if rest, ok := strings.CutPrefix(p, "/~/"); ok {
+		p = rest
+	}
+	if p == "" || p == "/" || strings.HasSuffix(p, "/") {
+		return nil, nil, errors.E(errors.Invalid, errors.Errorf("%s has no file path, expected ssh://user@host/path", u))
+	}
+
+	ssh := strings.Fields(s.getenv(SSHCommandEnv))
+	if len(ssh) == 0 {
+		ssh = []string{"ssh"}
+	}
+	args := append([]string(nil), ssh[1:]...)
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	dest := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		dest = u.User.Username() + "@" + dest
+	}
+	args = append(args, "--", dest, script(p))
+
+	cmd := exec.CommandContext(ctx, ssh[0], args...)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	return cmd, stderr, nil
+}
+
+// Open streams the file of u from the output of cat.
+func (s *SSH) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	cmd, stderr, err := s.command(ctx, u, func(p string) string { return "cat -- " + shellQuote(p) })
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.E(errors.Open, err)
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, errors.E(errors.Open, errors.Errorf("ssh: %v", err))
+	}
+
+	r := &sshReader{r: stdout, cmd: cmd, stderr: stderr}
+	br := bufio.NewReader(r)
+	// A file that can't be read fails before anything is sent.
+	if _, err = br.Peek(1); err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, r}, nil
+}
+
+// Exists runs test -e on the file of u.
+func (s *SSH) Exists(ctx context.Context, u *url.URL) (bool, error) {
+	cmd, stderr, err := s.command(ctx, u, func(p string) string { return "test -e " + shellQuote(p) })
+	if err != nil {
+		return false, err
+	}
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case stderrors.As(err, &exit) && exit.ExitCode() == 1:
+		return false, nil
+	}
+	return false, sshError(errors.Open, stderr, err)
+}
+
+// Create streams r to a temporary file next to the file of u, readable only
+// by its owner while it is written, through the input of cat. Once r was read
+// completely, the temporary file is given perm and replaces the file; if r
+// fails, it is removed.
+func (s *SSH) Create(ctx context.Context, u *url.URL, r io.Reader, perm os.FileMode) error {
+	cmd, stderr, err := s.command(ctx, u, func(p string) string {
+		return "umask 077 && cat > " + shellQuote(p+sshTempSuffix)
+	})
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = r
+	if err = cmd.Run(); err != nil {
+		// cat stops at the end of its input, whether r was read completely or
+		// failed, so the file is only replaced by another command.
+		s.run(context.WithoutCancel(ctx), u, func(p string) string { return "rm -f -- " + shellQuote(p+sshTempSuffix) })
+		return sshError(errors.Create, stderr, err)
+	}
+
+	return s.run(ctx, u, func(p string) string {
+		tmp := shellQuote(p + sshTempSuffix)
+		return fmt.Sprintf("chmod %04o %s && mv -f -- %s %s || { rm -f -- %s; exit 1; }", perm.Perm(), tmp, tmp, shellQuote(p), tmp)
+	})
+}
+
+// run runs the shell script returned by script on the server of u (See
+// command).
+func (s *SSH) run(ctx context.Context, u *url.URL, script func(p string) string) error {
+	cmd, stderr, err := s.command(ctx, u, script)
+	if err != nil {
+		return err
+	}
+	if err = cmd.Run(); err != nil {
+		return sshError(errors.Create, stderr, err)
+	}
+	return nil
+}
+
+// sshReader reads the output of cmd. Once it is read completely, the error of
+// cmd is returned instead of io.EOF if it failed.
+type sshReader struct {
+	r      io.Reader
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	done   bool
+}
+
+func (r *sshReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if err == io.EOF && !r.done {
+		r.done = true
+		if werr := r.cmd.Wait(); werr != nil {
+			return n, sshError(errors.Open, r.stderr, werr)
+		}
+	}
+	return n, err
+}
+
+// Close stops cmd if its output wasn't read completely.
+func (r *sshReader) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+// sshError returns the error of a command run through ssh that failed with
+// err, with what it wrote to stderr. Files that don't exist, or can't be
+// accessed, are reported with the kinds errors.NotExist and
+// errors.Permissions, other errors with kind.
+func sshError(kind errors.Kind, stderr *bytes.Buffer, err error) error {
+	msg := strings.TrimSpace(stderr.String())
+	if msg == "" {
+		msg = err.Error()
+	}
+	switch {
+	case strings.Contains(msg, "No such file"):
+		kind = errors.NotExist
+	case strings.Contains(msg, "Permission denied"):
+		kind = errors.Permissions
+	}
+	return errors.E(kind, errors.Errorf("ssh: %s", msg))
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
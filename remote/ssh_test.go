@@ -0,0 +1,120 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// fakeSSH writes a script that runs the commands sent to the server locally,
+// and records its arguments to the file args.
+func fakeSSH(t *testing.T) (command, args string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	dir := t.TempDir()
+	args = filepath.Join(dir, "args")
+	command = filepath.Join(dir, "ssh")
+	script := "#!/bin/sh\necho \"$@\" > " + args + "\nwhile [ \"$1\" != -- ]; do shift; done\nshift 2\nexec sh -c \"$1\"\n"
+	if err := os.WriteFile(command, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return command, args
+}
+
+func TestSSH(t *testing.T) {
+	command, args := fakeSSH(t)
+	env := map[string]string{SSHCommandEnv: command + " -o BatchMode=yes"}
+	s := NewSSH(func(k string) string { return env[k] })
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "it's a report.pdf.celo")
+	ctx := context.Background()
+	u, err := url.Parse("ssh://me@example.com:2222" + filepath.ToSlash(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Create(ctx, u, strings.NewReader("the report"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(readFile(t, args)); !strings.HasPrefix(got, "-o BatchMode=yes -p 2222 -- me@example.com chmod 0640 ") {
+		t.Errorf("got ssh arguments %s", got)
+	}
+	if got := readFile(t, name); got != "the report" {
+		t.Errorf("got %q", got)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("got mode %v, %v, want 0640", fi.Mode(), err)
+	}
+	if _, err = os.Stat(name + sshTempSuffix); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind: %v", err)
+	}
+
+	// The file isn't replaced if the content can't be read completely.
+	broken := io.MultiReader(strings.NewReader("half of"), iotest.ErrReader(errors.Errorf("broken")))
+	if err = s.Create(ctx, u, broken, 0600); err == nil {
+		t.Error("created a file of a broken reader")
+	}
+	if got := readFile(t, name); got != "the report" {
+		t.Errorf("the file was replaced by %q", got)
+	}
+	if _, err = os.Stat(name + sshTempSuffix); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind: %v", err)
+	}
+
+	r, err := s.Open(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "the report" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if ok, err := s.Exists(ctx, u); !ok || err != nil {
+		t.Errorf("file exists: %v, %v", ok, err)
+	}
+
+	u, _ = url.Parse("ssh://example.com" + filepath.ToSlash(dir) + "/missing.celo")
+	if _, err := s.Open(ctx, u); !errors.Is(errors.NotExist, err) {
+		t.Errorf("missing file: got %v, want kind NotExist", err)
+	}
+	if ok, err := s.Exists(ctx, u); ok || err != nil {
+		t.Errorf("missing file exists: %v, %v", ok, err)
+	}
+	u, _ = url.Parse("ssh://example.com/")
+	if _, err := s.Open(ctx, u); !errors.Is(errors.Invalid, err) {
+		t.Errorf("no path: got %v, want kind Invalid", err)
+	}
+}
+
+// readFile returns the content of the file name.
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestShellQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"report.pdf":    "'report.pdf'",
+		"it's $HOME":    `'it'\''s $HOME'`,
+		"a b; rm -rf /": "'a b; rm -rf /'",
+	} {
+		if got := shellQuote(s); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
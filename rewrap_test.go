@@ -0,0 +1,70 @@
+package celo
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestRewrapFile(t *testing.T) {
+	plaintext := []byte("attack at dawn")
+	other, _ := NewPhraseRecipient([]byte("other"))
+
+	e := NewEncrypter()
+	e.Config(AddRecipient(other))
+	name := writeSealed(t, e, []byte("old"), plaintext)
+	before, _ := os.ReadFile(name)
+
+	if err := NewDecrypter().RewrapFile([]byte("old"), []byte("new"), name); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the recipients section changes.
+	after, _ := os.ReadFile(name)
+	if len(after) != len(before) {
+		t.Fatalf("size changed from %d to %d bytes", len(before), len(after))
+	}
+	info, err := Inspect(bytes.NewReader(before))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after[info.HeaderSize:], before[info.HeaderSize:]) {
+		t.Error("payload changed")
+	}
+
+	for _, phrase := range []string{"new", "other"} {
+		got, err := readSealed(t, NewDecrypter(), []byte(phrase), name)
+		if err != nil {
+			t.Fatalf("phrase %q: %v", phrase, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("phrase %q: got %q, want %q", phrase, got, plaintext)
+		}
+	}
+
+	if _, err := readSealed(t, NewDecrypter(), []byte("old"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("old phrase: got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+func TestRewrapFileErrors(t *testing.T) {
+	name := writeSealed(t, NewEncrypter(), []byte("old"), []byte("attack at dawn"))
+	before, _ := os.ReadFile(name)
+
+	if err := NewDecrypter().RewrapFile([]byte("wrong"), []byte("new"), name); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got error %v, want kind WrongPassphrase", err)
+	}
+	if after, _ := os.ReadFile(name); !bytes.Equal(before, after) {
+		t.Error("file modified by a failed rewrap")
+	}
+
+	k, _ := GenerateSigningKey()
+	e := NewEncrypter()
+	e.Config(SignWith(k))
+	name = writeSealed(t, e, []byte("old"), []byte("attack at dawn"))
+	if err := NewDecrypter().RewrapFile([]byte("old"), []byte("new"), name); !errors.Is(errors.Sign, err) {
+		t.Errorf("signed file: got error %v, want kind Sign", err)
+	}
+}
@@ -0,0 +1,178 @@
+package celo
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Known answers of SelfTest. They were produced by this package, a build or
+// platform that doesn't reproduce them can't decrypt the files of others.
+const (
+	selftestPhrase    = "celo selftest"
+	selftestPlaintext = "attack at dawn"
+	selftestAAD       = "celo"
+
+	// selftestKey argon2id key derived from selftestPhrase and the salt
+	// 0x00, 0x01, ..., 0x1f.
+	selftestKey = "8df2631a483e6389578b25f8ff8e9e72ce2673495f59c45511102c4c47bbef3b"
+	// selftestSealed selftestPlaintext sealed by AES-256-GCM with selftestKey,
+	// the nonce 0xa0, 0xa1, ..., 0xab and selftestAAD.
+	selftestSealed = "351146ffef9735654912c27f651a1ec75d5d56b3ae488a38b899fd2ee801"
+
+	// selftestV1 selftestPlaintext encrypted with selftestPhrase in a file of
+	// version 1.
+	selftestV1 = "0a1a43454c4f0a1a0120200c0000000000000000000000000000000000000000000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f688fced19d06b89f352e98e7e984fd68e6746e6d47c462324062d0da6899fe6eb081855dda65ece6b51f"
+	// selftestV2 selftestPlaintext encrypted with selftestPhrase in a file of
+	// version 2, with a trailer.
+	selftestV2 = "0a1a43454c4f0a1a0220200c000d1000000000000000000000000000000000000101005cc2853eb29ea21bed228b972d2f5d631def428df9ac0e8639ee2c9081eb37b6f948f65618fbb58da6aa01e0976df0a7c017a16ba7ffae2fd6592d591f12874d50736a1198cb6c28657a45804955410c7e2dda04bb3b67d9d4ca588034b6b656da000000000000000073662f280f79e1fe95a8088c99dd12cac7b61299fe735ddd318073b1546763656c6f2d656e64000000000000002aa177e1e42f55c7ebb0a5c052a6dac329abb8ad2a713f88053919cbdc9e680022"
+)
+
+// SelfTestResult is the outcome of one of the checks of SelfTest.
+type SelfTestResult struct {
+	// Name of the check, e.g. "argon2id key derivation".
+	Name string
+	// Err why the check failed, nil if it passed.
+	Err error
+}
+
+// SelfTest runs known-answer tests of the key derivation and the cipher,
+// decrypts files of every supported version and encrypts and decrypts files
+// of the current one, so a build or a platform can be validated before it is
+// trusted with data. It returns the result of each check, in the order they
+// run; a check failing doesn't stop the others.
+func SelfTest() []SelfTestResult {
+	checks := []struct {
+		name string
+		f    func() error
+	}{
+		{KeyDerivation() + " key derivation", selftestKDF},
+		{"AES-256-GCM cipher", selftestCipher},
+		{"format version 1 decoding", func() error { return selftestDecodeHex(selftestV1) }},
+		{"format version 2 decoding", func() error { return selftestDecodeHex(selftestV2) }},
+		{"format round trip", func() error { return selftestRoundTrip() }},
+		{"format round trip with padding", func() error { return selftestRoundTrip(SetPadding(PaddingPadme)) }},
+	}
+
+	results := make([]SelfTestResult, len(checks))
+	for i, c := range checks {
+		results[i] = SelfTestResult{Name: c.name, Err: c.f()}
+	}
+	return results
+}
+
+// selftestSalt returns the salt of the known answers.
+func selftestSalt() []byte {
+	salt := make([]byte, SaltSize)
+	for i := range salt {
+		salt[i] = byte(i)
+	}
+	return salt
+}
+
+// selftestMismatch returns an error of kind errors.Internal reporting that
+// got isn't the known answer want, in hex.
+func selftestMismatch(op errors.Op, got []byte, want string) error {
+	return errors.E(errors.Internal, op, errors.Errorf("got %x, want %s", got, want))
+}
+
+func selftestKDF() error {
+	op := errors.Op("selftest.KDF")
+
+	key := GenerateKey([]byte(selftestPhrase), selftestSalt(), Aes256BlockSize)
+	defer ZeroBytes(key)
+	if hex.EncodeToString(key) != selftestKey {
+		return selftestMismatch(op, key, selftestKey)
+	}
+	return nil
+}
+
+func selftestCipher() error {
+	op := errors.Op("selftest.Cipher")
+
+	key, _ := hex.DecodeString(selftestKey)
+	c, err := NewCipher(Aes256BlockSize, NonceSize, key)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	nonce := make([]byte, NonceSize)
+	for i := range nonce {
+		nonce[i] = byte(0xa0 + i)
+	}
+	sealed := c.seal(nonce, []byte(selftestPlaintext), []byte(selftestAAD))
+	if hex.EncodeToString(sealed) != selftestSealed {
+		return selftestMismatch(op, sealed, selftestSealed)
+	}
+
+	plaintext, err := c.Decrypt(nonce, sealed, []byte(selftestAAD))
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if string(plaintext) != selftestPlaintext {
+		return errors.E(errors.Internal, op, errors.Errorf("decrypted %q, want %q", plaintext, selftestPlaintext))
+	}
+
+	// A modified ciphertext must not be authenticated.
+	sealed[0] ^= 1
+	if _, err = c.Decrypt(nonce, sealed, []byte(selftestAAD)); err == nil {
+		return errors.E(errors.Internal, op, errors.Errorf("a modified ciphertext was authenticated"))
+	}
+	return nil
+}
+
+// selftestDecodeHex is like selftestDecode for a file encoded in hex.
+func selftestDecodeHex(file string) error {
+	b, _ := hex.DecodeString(file)
+	return selftestDecode(b)
+}
+
+// selftestDecode decrypts the file with selftestPhrase and compares its
+// content to selftestPlaintext.
+func selftestDecode(file []byte) error {
+	op := errors.Op("selftest.Decode")
+
+	d := NewDecrypter()
+	defer d.Wipe()
+	if _, err := d.Read(bytes.NewReader(file)); err != nil {
+		return errors.E(op, err)
+	}
+	plaintext, err := d.Decrypt([]byte(selftestPhrase))
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if string(plaintext) != selftestPlaintext {
+		return errors.E(errors.Internal, op, errors.Errorf("decrypted %q, want %q", plaintext, selftestPlaintext))
+	}
+	return nil
+}
+
+// selftestRoundTrip encrypts selftestPlaintext in a file of the current
+// version configured with opts, and decrypts it.
+func selftestRoundTrip(opts ...Option) error {
+	op := errors.Op("selftest.RoundTrip")
+
+	e := NewEncrypter()
+	defer e.Wipe()
+	if err := e.Config(opts...); err != nil {
+		return errors.E(op, err)
+	}
+	if _, err := e.Encrypt([]byte(selftestPhrase), []byte(selftestPlaintext)); err != nil {
+		return errors.E(op, err)
+	}
+	b := new(bytes.Buffer)
+	if _, err := e.Write(b); err != nil {
+		return errors.E(op, err)
+	}
+
+	m, _, err := DecodeMetadata(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if m.Version() != Version {
+		return errors.E(errors.Internal, op, errors.Errorf("encoded version %d, want %d", m.Version(), Version))
+	}
+
+	return selftestDecode(b.Bytes())
+}
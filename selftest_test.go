@@ -0,0 +1,31 @@
+package celo
+
+import (
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestSelfTest(t *testing.T) {
+	results := SelfTest()
+	if len(results) == 0 {
+		t.Fatal("no checks were run")
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Name, r.Err)
+		}
+	}
+}
+
+func TestSelfTestDecodeWrongFile(t *testing.T) {
+	b := sealFile(t, NewEncrypter(), []byte(selftestPhrase), []byte("retreat at dusk"))
+	if err := selftestDecode(b); !errors.Is(errors.Internal, err) {
+		t.Errorf("got %v, want an error of kind errors.Internal", err)
+	}
+
+	b = sealFile(t, NewEncrypter(), []byte("other phrase"), []byte(selftestPlaintext))
+	if err := selftestDecode(b); err == nil {
+		t.Error("a file encrypted with another phrase was decrypted")
+	}
+}
@@ -0,0 +1,124 @@
+package celo
+
+import (
+	"sync"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Session keeps a secret phrase, and the keys generated from it, to encrypt
+// and decrypt many files and values after the phrase was asked once, e.g. by
+// an agent, a GUI or a server. The key is generated the first time it is
+// needed and reused by every file encrypted by the session. Keys of files
+// encrypted with other salts are generated once too.
+// A Session is safe for concurrent use, operations run one at a time. Close
+// zeroes the phrase and forgets the keys once the session is no longer needed.
+type Session struct {
+	mu     sync.Mutex
+	phrase []byte
+	e      *Encrypter
+	d      *Decrypter
+	keys   *KeyCache
+}
+
+// NewSession creates a Session for a copy of secretPhrase. Options are applied
+// to both the Encrypter and the Decrypter used by the session, except the key
+// cache, which is owned by the session, and PreserveKey, which is always on.
+// It returns an error of kind errors.PhraseIsEmpty if the phrase is empty.
+func NewSession(secretPhrase []byte, opts ...Option) (*Session, error) {
+	if len(secretPhrase) == 0 {
+		return nil, errors.E(errors.PhraseIsEmpty, errors.Op("session.NewSession"))
+	}
+
+	s := &Session{
+		phrase: append([]byte(nil), secretPhrase...),
+		e:      NewEncrypter(),
+		d:      NewDecrypter(),
+		keys:   NewKeyCache(0, 0),
+	}
+
+	opts = append(opts[:len(opts):len(opts)], WithKeyCache(s.keys), PreserveKey(true))
+	err := s.e.Config(opts...)
+	if err == nil {
+		err = s.d.Config(opts...)
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Encrypt encrypts plaintext and returns the encoded file (See EncryptBytes).
+func (s *Session) Encrypt(plaintext []byte) (blob []byte, err error) {
+	err = s.run(errors.Op("session.Encrypt"), func() error {
+		blob, err = encryptBytes(s.e, s.phrase, plaintext)
+		return err
+	})
+	return blob, err
+}
+
+// Decrypt decrypts an encoded file returned by Encrypt or EncryptBytes.
+func (s *Session) Decrypt(blob []byte) (plaintext []byte, err error) {
+	err = s.run(errors.Op("session.Decrypt"), func() error {
+		plaintext, err = decryptBytes(s.d, s.phrase, blob)
+		return err
+	})
+	return plaintext, err
+}
+
+// EncryptFile encrypts the file with the specified name (See
+// Encrypter.EncryptFile).
+func (s *Session) EncryptFile(name string, overwrite, removeSource bool) (encryptedName string, err error) {
+	err = s.run(errors.Op("session.EncryptFile"), func() error {
+		encryptedName, err = s.e.EncryptFile(s.phrase, name, overwrite, removeSource)
+		return err
+	})
+	return encryptedName, err
+}
+
+// DecryptFile decrypts the file with the specified name (See
+// Decrypter.DecryptFile).
+func (s *Session) DecryptFile(name string, overwrite, removeSource bool) (decryptedFileName string, err error) {
+	err = s.run(errors.Op("session.DecryptFile"), func() error {
+		decryptedFileName, err = s.d.DecryptFile(s.phrase, name, overwrite, removeSource)
+		return err
+	})
+	return decryptedFileName, err
+}
+
+// VerifyFile checks that the file with the specified name is intact and that
+// it can be decrypted with the phrase of the session (See
+// Decrypter.VerifyFile), e.g. to verify a phrase before the session is used.
+func (s *Session) VerifyFile(name string) error {
+	return s.run(errors.Op("session.VerifyFile"), func() error {
+		return s.d.VerifyFile(s.phrase, name)
+	})
+}
+
+// Close zeroes the phrase and forgets the keys of the session. Operations
+// called after Close return an error of kind errors.NotReady.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ZeroBytes(s.phrase)
+	s.phrase = nil
+	s.e.Wipe()
+	s.d.Wipe()
+	s.keys.Clear()
+
+	return nil
+}
+
+// run runs fn unless the session was closed.
+func (s *Session) run(op errors.Op, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.phrase == nil {
+		return errors.E(errors.NotReady, op, errors.Errorf("session is closed"))
+	}
+	return fn()
+}
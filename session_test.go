@@ -0,0 +1,107 @@
+package celo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestSession(t *testing.T) {
+	m := &recordedMetrics{}
+	s, err := NewSession([]byte("secret"), WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Operations run concurrently with a single key derivation.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			plaintext := randomPlaintext(100 * (i + 1))
+			blob, err := s.Encrypt(plaintext)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got, err := s.Decrypt(blob)
+			if err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("got %d bytes, %v, want %d", len(got), err, len(plaintext))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if m.keys != 1 {
+		t.Errorf("%d keys derived, want 1", m.keys)
+	}
+
+	// Files of the session and values of other instances.
+	name := filepath.Join(t.TempDir(), "plain")
+	if err = os.WriteFile(name, []byte("attack at dawn"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encryptedName, err := s.EncryptFile(name, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.VerifyFile(encryptedName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.DecryptFile(encryptedName, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "attack at dawn" {
+		t.Errorf("decrypted %q", b)
+	}
+
+	blob, err := EncryptBytes([]byte("secret"), []byte("attack at dusk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Decrypt(blob); err != nil || string(got) != "attack at dusk" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	if _, err := NewSession(nil); !errors.Is(errors.PhraseIsEmpty, err) {
+		t.Errorf("got error %v, want kind PhraseIsEmpty", err)
+	}
+	if _, err := NewSession([]byte("secret"), SetBlockSize(24)); err == nil {
+		t.Error("invalid option accepted")
+	}
+
+	blob, err := EncryptBytes([]byte("other"), []byte("attack at dawn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phrase := []byte("secret")
+	s, err := NewSession(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Decrypt(blob); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+
+	// The session keeps its own copy of the phrase.
+	ZeroBytes(phrase)
+	if _, err = s.Encrypt([]byte("attack at dawn")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+	if _, err = s.Encrypt([]byte("attack at dawn")); !errors.Is(errors.NotReady, err) {
+		t.Errorf("closed session: got error %v, want kind NotReady", err)
+	}
+	if s.keys.Len() != 0 {
+		t.Error("keys not forgotten by Close")
+	}
+}
@@ -0,0 +1,178 @@
+package celo
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Textual encoding of Ed25519 keys.
+//  celosig1...           <- public key (verifying key)
+//  CELO-SIGN-KEY-1...    <- private key seed (signing key)
+const (
+	verifyingKeyPrefix = "celosig1"
+	signingKeyPrefix   = "CELO-SIGN-KEY-1"
+)
+
+// SignatureBlockSize size of the block appended to signed files.
+//  public key (32 bytes) | signature (64 bytes)
+const SignatureBlockSize = ed25519.PublicKeySize + ed25519.SignatureSize
+
+// signatureContext binds the signatures to encrypted files created by Celo.
+const signatureContext = "celo/ed25519"
+
+// signatureOptions Ed25519ph is used so the container can be hashed while it
+// is written or read, instead of holding all of it in memory.
+var signatureOptions = &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext}
+
+// SigningKey is an Ed25519 private key used to sign encrypted files, so
+// recipients can confirm who produced them.
+type SigningKey struct {
+	privateKey ed25519.PrivateKey
+}
+
+// GenerateSigningKey generates a random Ed25519 key pair.
+func GenerateSigningKey() (*SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.E(errors.Key, errors.Op("sign.GenerateSigningKey"), err)
+	}
+	return &SigningKey{privateKey: privateKey}, nil
+}
+
+// ParseSigningKey parses a private key encoded by SigningKey.String.
+func ParseSigningKey(s string) (*SigningKey, error) {
+	op := errors.Op("sign.ParseSigningKey")
+
+	if !strings.HasPrefix(s, signingKeyPrefix) {
+		return nil, errors.E(errors.Key, op, errors.Errorf("missing %s prefix", signingKeyPrefix))
+	}
+
+	seed, err := x25519Encoding.DecodeString(s[len(signingKeyPrefix):])
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.E(errors.Key, op, errors.Errorf("invalid key size"))
+	}
+
+	return &SigningKey{privateKey: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// ReadSigningKey parses a key file containing a signing key, empty lines and
+// lines starting with "#" are ignored.
+func ReadSigningKey(r io.Reader) (*SigningKey, error) {
+	line, err := readKeyLine(r)
+	if err != nil {
+		return nil, errors.E(errors.Op("sign.ReadSigningKey"), err)
+	}
+	return ParseSigningKey(line)
+}
+
+// String returns the textual encoding of the private key.
+func (k *SigningKey) String() string {
+	return signingKeyPrefix + x25519Encoding.EncodeToString(k.privateKey.Seed())
+}
+
+// Public returns the key used to verify the signatures made by k.
+func (k *SigningKey) Public() *VerifyingKey {
+	return &VerifyingKey{publicKey: k.privateKey.Public().(ed25519.PublicKey)}
+}
+
+// sign signs the digest of a container hashed with newSignatureHash.
+// It returns the signature block.
+func (k *SigningKey) sign(digest []byte) ([]byte, error) {
+	signature, err := k.privateKey.Sign(nil, digest, signatureOptions)
+	if err != nil {
+		return nil, errors.E(errors.Sign, errors.Op("sign.sign"), err)
+	}
+
+	block := make([]byte, 0, SignatureBlockSize)
+	block = append(block, k.privateKey.Public().(ed25519.PublicKey)...)
+	block = append(block, signature...)
+
+	return block, nil
+}
+
+// VerifyingKey is an Ed25519 public key used to verify who produced an
+// encrypted file.
+type VerifyingKey struct {
+	publicKey ed25519.PublicKey
+}
+
+// ParseVerifyingKey parses a public key encoded by VerifyingKey.String.
+func ParseVerifyingKey(s string) (*VerifyingKey, error) {
+	op := errors.Op("sign.ParseVerifyingKey")
+
+	if !strings.HasPrefix(s, verifyingKeyPrefix) {
+		return nil, errors.E(errors.Key, op, errors.Errorf("missing %s prefix", verifyingKeyPrefix))
+	}
+
+	b, err := x25519Encoding.DecodeString(strings.ToUpper(s[len(verifyingKeyPrefix):]))
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errors.E(errors.Key, op, errors.Errorf("invalid key size"))
+	}
+
+	return &VerifyingKey{publicKey: b}, nil
+}
+
+// String returns the textual encoding of the public key.
+func (k *VerifyingKey) String() string {
+	return verifyingKeyPrefix + strings.ToLower(x25519Encoding.EncodeToString(k.publicKey))
+}
+
+// Equal reports whether k and o are the same key.
+func (k *VerifyingKey) Equal(o *VerifyingKey) bool {
+	return o != nil && k.publicKey.Equal(o.publicKey)
+}
+
+// verify verifies the signature block of a container whose digest was
+// computed with newSignatureHash.
+// It returns the key that produced the signature.
+func verify(digest, block []byte) (*VerifyingKey, error) {
+	op := errors.Op("sign.verify")
+
+	if len(block) != SignatureBlockSize {
+		return nil, errors.E(errors.Sign, op)
+	}
+
+	key := &VerifyingKey{publicKey: block[:ed25519.PublicKeySize]}
+	signature := block[ed25519.PublicKeySize:]
+
+	if err := ed25519.VerifyWithOptions(key.publicKey, digest, signature, signatureOptions); err != nil {
+		return nil, errors.E(errors.Sign, op, err)
+	}
+
+	return key, nil
+}
+
+// newSignatureHash returns the hash used to compute the digest of the signed
+// container, everything that precedes the signature block.
+func newSignatureHash() hash.Hash {
+	return sha512.New()
+}
+
+// readKeyLine returns the first line of r that isn't empty or a comment.
+func readKeyLine(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.E(errors.Key, err)
+	}
+	return "", errors.E(errors.Key, errors.Errorf("no key found"))
+}
@@ -0,0 +1,150 @@
+package celo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// sealSigned encrypts plaintext signed with a new key.
+func sealSigned(t *testing.T, plaintext []byte) (*SigningKey, []byte) {
+	t.Helper()
+
+	k, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEncrypter()
+	if err = e.Config(SignWith(k)); err != nil {
+		t.Fatal(err)
+	}
+	return k, sealFile(t, e, []byte("secret"), plaintext)
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	plaintext := []byte("attack at dawn")
+	k, file := sealSigned(t, plaintext)
+
+	d := NewDecrypter()
+	d.Config(VerifyWith(k.Public()))
+	got, err := openFile(d, []byte("secret"), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("got %q, want %q", got, plaintext)
+	}
+	if !k.Public().Equal(d.Signer()) {
+		t.Errorf("got signer %v, want %v", d.Signer(), k.Public())
+	}
+
+	// Any signer is accepted without VerifyWith.
+	d = NewDecrypter()
+	if _, err = openFile(d, []byte("secret"), file); err != nil {
+		t.Fatal(err)
+	}
+	if !k.Public().Equal(d.Signer()) {
+		t.Errorf("got signer %v, want %v", d.Signer(), k.Public())
+	}
+
+	// Unsigned files have no signer.
+	if _, err = openFile(d, []byte("secret"), sealFile(t, NewEncrypter(), []byte("secret"), plaintext)); err != nil {
+		t.Fatal(err)
+	}
+	if d.Signer() != nil {
+		t.Errorf("unsigned file: got signer %v", d.Signer())
+	}
+}
+
+func TestSignBadSignature(t *testing.T) {
+	k, file := sealSigned(t, []byte("attack at dawn"))
+	other, _ := GenerateSigningKey()
+
+	tests := []struct {
+		name string
+		file func() []byte
+		d    func() *Decrypter
+	}{
+		{"other signer", func() []byte { return file }, func() *Decrypter {
+			d := NewDecrypter()
+			d.Config(VerifyWith(other.Public()))
+			return d
+		}},
+		{"tampered signature", func() []byte {
+			b := append([]byte(nil), file...)
+			b[len(b)-1] ^= 1
+			return b
+		}, NewDecrypter},
+		{"tampered payload", func() []byte {
+			b := append([]byte(nil), file...)
+			b[len(b)-SignatureBlockSize-TrailerSize-1] ^= 1
+			return b
+		}, NewDecrypter},
+		{"replaced signer", func() []byte {
+			// A valid signature by another key over the same content.
+			b := append([]byte(nil), file...)
+			h := newSignatureHash()
+			h.Write(b[:len(b)-SignatureBlockSize])
+			block, _ := other.sign(h.Sum(nil))
+			copy(b[len(b)-SignatureBlockSize:], block)
+			return b
+		}, func() *Decrypter {
+			d := NewDecrypter()
+			d.Config(VerifyWith(k.Public()))
+			return d
+		}},
+	}
+
+	for _, tt := range tests {
+		_, err := openFile(tt.d(), []byte("secret"), tt.file())
+		if !errors.Is(errors.Sign, err) {
+			t.Errorf("%s: got error %v, want kind Sign", tt.name, err)
+		}
+	}
+
+	// VerifyWith rejects unsigned files.
+	d := NewDecrypter()
+	d.Config(VerifyWith(other.Public()))
+	if _, err := openFile(d, []byte("secret"), sealFile(t, NewEncrypter(), []byte("secret"), []byte("a"))); !errors.Is(errors.Sign, err) {
+		t.Errorf("unsigned file: got error %v, want kind Sign", err)
+	}
+}
+
+func TestSignKeyEncoding(t *testing.T) {
+	k, _ := GenerateSigningKey()
+
+	parsed, err := ParseSigningKey(k.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Public().Equal(k.Public()) {
+		t.Error("signing key round trip mismatch")
+	}
+
+	read, err := ReadSigningKey(strings.NewReader("# comment\n\n" + k.String() + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !read.Public().Equal(k.Public()) {
+		t.Error("ReadSigningKey mismatch")
+	}
+
+	public, err := ParseVerifyingKey(k.Public().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !public.Equal(k.Public()) {
+		t.Error("verifying key round trip mismatch")
+	}
+
+	for _, s := range []string{"", "celosig1aaaa", k.String()} {
+		if _, err = ParseVerifyingKey(s); !errors.Is(errors.Key, err) {
+			t.Errorf("verifying key %q: got error %v, want kind Key", s, err)
+		}
+	}
+	if _, err = ParseSigningKey(k.Public().String()); !errors.Is(errors.Key, err) {
+		t.Errorf("signing key: got error %v, want kind Key", err)
+	}
+}
@@ -0,0 +1,57 @@
+package celo
+
+import (
+	"github.com/rrivera/celo/errors"
+)
+
+// EncryptedSize returns the size of the file that results from encrypting a
+// plaintext of plaintextLen bytes with the default configuration of an
+// Encrypter and a secret phrase: the metadata, the phrase stanza, the chunks
+// with their nonces and tags, and the trailer.
+// Padding is accounted for with EncryptedSize(PaddedSize(n, p)), and signed
+// files are SignatureBlockSize bytes larger.
+func EncryptedSize(plaintextLen int64) int64 {
+	if plaintextLen < 0 {
+		return 0
+	}
+
+	headerSize, chunkSize := defaultLayout()
+	return headerSize + sealedSize(plaintextLen, chunkSize, NonceSize) + TrailerSize
+}
+
+// PlaintextSize is the inverse of EncryptedSize, it returns the size of the
+// plaintext (padding included) of a file of encryptedLen bytes encrypted with
+// the default configuration.
+// It returns an error of kind errors.Invalid if no plaintext results in a file
+// of that size.
+func PlaintextSize(encryptedLen int64) (int64, error) {
+	op := errors.Op("size.PlaintextSize")
+
+	headerSize, chunkSize := defaultLayout()
+	payloadSize := encryptedLen - headerSize - TrailerSize
+
+	// Every chunk is nonce | ciphertext | tag, the last one might be shorter
+	// but it is always present.
+	overhead := int64(NonceSize + TagSize)
+	sealedChunk := int64(chunkSize) + overhead
+	full, rest := payloadSize/sealedChunk, payloadSize%sealedChunk
+
+	switch {
+	case payloadSize < overhead:
+		return 0, errors.E(errors.Invalid, op, errors.Errorf("%d bytes is smaller than an empty file", encryptedLen))
+	case rest == 0:
+		return full * int64(chunkSize), nil
+	case rest <= overhead && !(rest == overhead && full == 0):
+		return 0, errors.E(errors.Invalid, op, errors.Errorf("no plaintext is encrypted in %d bytes", encryptedLen))
+	}
+
+	return full*int64(chunkSize) + rest - overhead, nil
+}
+
+// defaultLayout returns the size of the header (metadata and a phrase stanza)
+// and the chunk size of files encrypted with the default configuration.
+func defaultLayout() (headerSize int64, chunkSize int) {
+	e := NewEncrypter()
+	stanza := &Stanza{Type: StanzaPhraseKDF, Body: make([]byte, kdfParamsSize+e.saltSize+e.nonceSize+e.blockSize+TagSize)}
+	return encodedSize(e.metadata, []*Stanza{stanza}, 0) - TrailerSize, e.metadata.chunkSize()
+}
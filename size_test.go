@@ -0,0 +1,58 @@
+package celo
+
+import (
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEncryptedSize(t *testing.T) {
+	k, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{0, 1, testChunkSize - 1, testChunkSize, testChunkSize + 1, 3 * testChunkSize} {
+		blob, err := EncryptBytes([]byte("secret"), randomPlaintext(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := EncryptedSize(int64(n)); size != int64(len(blob)) {
+			t.Errorf("EncryptedSize(%d) = %d, want %d", n, size, len(blob))
+		}
+		if size, err := PlaintextSize(int64(len(blob))); err != nil || size != int64(n) {
+			t.Errorf("PlaintextSize(%d) = %d, %v, want %d", len(blob), size, err, n)
+		}
+
+		padded, err := EncryptBytes([]byte("secret"), randomPlaintext(n), SetPadding(PaddingPadme))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := EncryptedSize(PaddedSize(int64(n), PaddingPadme)); size != int64(len(padded)) {
+			t.Errorf("padded EncryptedSize(%d) = %d, want %d", n, size, len(padded))
+		}
+
+		signed, err := EncryptBytes([]byte("secret"), randomPlaintext(n), SignWith(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := EncryptedSize(int64(n)) + SignatureBlockSize; size != int64(len(signed)) {
+			t.Errorf("signed EncryptedSize(%d) = %d, want %d", n, size, len(signed))
+		}
+	}
+}
+
+func TestPlaintextSizeInvalid(t *testing.T) {
+	empty := EncryptedSize(0)
+	overhead := int64(NonceSize + TagSize)
+	full := EncryptedSize(testChunkSize)
+
+	for _, size := range []int64{0, empty - 1, full + 1, full + overhead} {
+		if _, err := PlaintextSize(size); !errors.Is(errors.Invalid, err) {
+			t.Errorf("PlaintextSize(%d): got error %v, want kind Invalid", size, err)
+		}
+	}
+	if size, err := PlaintextSize(full + overhead + 1); err != nil || size != testChunkSize+1 {
+		t.Errorf("got %d, %v, want %d", size, err, testChunkSize+1)
+	}
+}
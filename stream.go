@@ -0,0 +1,106 @@
+package celo
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// EncryptStream encrypts everything read from src and writes the encoded file
+// to dst, so data can flow between arbitrary endpoints such as network
+// connections or pipes. Progress isn't reported, the size of src is unknown.
+// The plaintext is encrypted one chunk at a time, the encrypted payload is
+// kept in a temporary file until src is exhausted since its size precedes it
+// in the trailer checksum.
+// It returns the number of bytes written to dst.
+func (e *Encrypter) EncryptStream(secretPhrase []byte, src io.Reader, dst io.Writer) (n int64, err error) {
+	return e.EncryptStreamContext(context.Background(), secretPhrase, src, dst)
+}
+
+// EncryptStreamContext is like EncryptStream but it stops as soon as ctx is
+// done, returning an error of kind errors.Canceled. Nothing is written to dst
+// if ctx is done before the encryption finishes.
+func (e *Encrypter) EncryptStreamContext(ctx context.Context, secretPhrase []byte, src io.Reader, dst io.Writer) (n int64, err error) {
+	op := errors.Op("stream.EncryptStream")
+
+	if err = checkContext(ctx, op); err != nil {
+		return 0, err
+	}
+
+	return e.encryptFrom(ctx, secretPhrase, e.limitReader(src), -1, dst, "")
+}
+
+// DecryptStream decodes an encrypted file read from src and writes the
+// decrypted content to dst.
+// The file is kept in a temporary file, still encrypted, until src is
+// exhausted. Files with a chunked payload are then decrypted one chunk at a
+// time: each chunk is authenticated before it is written to dst, the trailer
+// and the signature (if any) after the last one. Older files are decrypted in
+// memory and authenticated before anything is written.
+// If an error is returned, what was written to dst must be discarded.
+// It returns the number of bytes written to dst.
+func (d *Decrypter) DecryptStream(secretPhrase []byte, src io.Reader, dst io.Writer) (n int64, err error) {
+	return d.DecryptStreamContext(context.Background(), secretPhrase, src, dst)
+}
+
+// DecryptStreamContext is like DecryptStream but it stops as soon as ctx is
+// done, returning an error of kind errors.Canceled.
+func (d *Decrypter) DecryptStreamContext(ctx context.Context, secretPhrase []byte, src io.Reader, dst io.Writer) (n int64, err error) {
+	op := errors.Op("stream.DecryptStream")
+
+	if err = checkContext(ctx, op); err != nil {
+		return 0, err
+	}
+
+	f, remove, err := createSpool()
+	if err != nil {
+		return 0, err
+	}
+	defer remove()
+
+	size, err := io.Copy(f, d.limitReader(src))
+	if err != nil {
+		return 0, errors.E(errors.Ciphertext, op, err)
+	}
+
+	if err = checkContext(ctx, op); err != nil {
+		return 0, err
+	}
+
+	if chunked(f, size) {
+		return d.decryptTo(ctx, secretPhrase, f, size, "", d.limitWriter(dst))
+	}
+
+	if _, err = d.Read(io.NewSectionReader(f, 0, size)); err != nil {
+		return 0, err
+	}
+
+	plaintext, err := d.decrypt(ctx, secretPhrase)
+	if err != nil {
+		return 0, err
+	}
+	defer ZeroBytes(plaintext)
+
+	wn, err := d.limitWriter(dst).Write(plaintext)
+	if err != nil {
+		return int64(wn), errors.E(op, err)
+	}
+
+	return int64(wn), nil
+}
+
+// createSpool creates a temporary file, only readable by its owner, for the
+// encrypted content of a stream. It returns the function that closes and
+// removes it.
+func createSpool() (f *os.File, remove func(), err error) {
+	if f, err = os.CreateTemp("", "celo-stream-*.tmp"); err != nil {
+		return nil, nil, errors.E(errors.Create, errors.Op("stream.createSpool"), err)
+	}
+
+	return f, func() {
+		f.Close()
+		os.Remove(f.Name())
+	}, nil
+}
@@ -0,0 +1,173 @@
+package celo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestStream(t *testing.T) {
+	for _, padding := range []Padding{PaddingNone, PaddingBlock, PaddingPadme} {
+		for _, size := range []int{0, 1, testChunkSize, 3*testChunkSize + 7} {
+			plaintext := randomPlaintext(size)
+
+			// The stream is read in small pieces, as from a network connection.
+			e := NewEncrypter()
+			e.Config(SetPadding(padding))
+			var sealed bytes.Buffer
+			n, err := e.EncryptStream([]byte("secret"), iotest.HalfReader(bytes.NewReader(plaintext)), &sealed)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", padding, size, err)
+			}
+			if n != int64(sealed.Len()) {
+				t.Errorf("%v, %d bytes: got n = %d, wrote %d bytes", padding, size, n, sealed.Len())
+			}
+
+			// The payload is the same as if the size was known.
+			var file bytes.Buffer
+			if _, err = e.encryptFrom(context.Background(), []byte("secret"), bytes.NewReader(plaintext), int64(size), &file, ""); err != nil {
+				t.Fatal(err)
+			}
+			if file.Len() != sealed.Len() {
+				t.Errorf("%v, %d bytes: got %d bytes, want %d", padding, size, sealed.Len(), file.Len())
+			}
+
+			var got bytes.Buffer
+			n, err = NewDecrypter().DecryptStream([]byte("secret"), iotest.OneByteReader(&sealed), &got)
+			if err != nil {
+				t.Fatalf("%v, %d bytes: %v", padding, size, err)
+			}
+			if n != int64(size) || !bytes.Equal(got.Bytes(), plaintext) {
+				t.Errorf("%v, %d bytes: round trip mismatch, got %d bytes", padding, size, n)
+			}
+		}
+	}
+
+	// Files encoded by Write are decrypted too.
+	e := NewEncrypter()
+	if _, err := e.Encrypt([]byte("secret"), []byte("attack at dawn")); err != nil {
+		t.Fatal(err)
+	}
+	var sealed, got bytes.Buffer
+	if _, err := e.Write(&sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDecrypter().DecryptStream([]byte("secret"), &sealed, &got); err != nil || got.String() != "attack at dawn" {
+		t.Errorf("got %q, %v", got.String(), err)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	var sealed bytes.Buffer
+	if _, err := NewEncrypter().EncryptStream([]byte("secret"), bytes.NewReader([]byte("attack at dawn")), &sealed); err != nil {
+		t.Fatal(err)
+	}
+	file := sealed.Bytes()
+
+	var got bytes.Buffer
+	if _, err := NewDecrypter().DecryptStream([]byte("other"), bytes.NewReader(file), &got); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("wrong phrase: got error %v, want kind WrongPassphrase", err)
+	}
+	if _, err := NewDecrypter().DecryptStream([]byte("secret"), bytes.NewReader(file[:len(file)-1]), &got); !errors.Is(errors.Truncated, err) {
+		t.Errorf("truncated: got error %v, want kind Truncated", err)
+	}
+	if got.Len() != 0 {
+		t.Errorf("failed decryptions wrote %d bytes", got.Len())
+	}
+
+	// Errors of the endpoints are returned.
+	readErr := errors.Errorf("connection reset")
+	if _, err := NewEncrypter().EncryptStream([]byte("secret"), iotest.ErrReader(readErr), &sealed); !errors.Is(errors.Plaintext, err) {
+		t.Errorf("read error: got %v, want kind Plaintext", err)
+	}
+	if _, err := NewDecrypter().DecryptStream([]byte("secret"), bytes.NewReader(file), failingWriter{}); err == nil {
+		t.Error("write error: got no error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewEncrypter().EncryptStreamContext(ctx, []byte("secret"), bytes.NewReader(file), io.Discard); !errors.Is(errors.Canceled, err) {
+		t.Errorf("canceled: got error %v, want kind Canceled", err)
+	}
+	if _, err := NewDecrypter().DecryptStreamContext(ctx, []byte("secret"), bytes.NewReader(file), io.Discard); !errors.Is(errors.Canceled, err) {
+		t.Errorf("canceled: got error %v, want kind Canceled", err)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestWriterToReaderFrom(t *testing.T) {
+	plaintext := randomPlaintext(2*testChunkSize + 100)
+
+	e := NewEncrypter()
+	e.Config(SetPadding(PaddingPadme))
+	if _, err := e.Encrypt([]byte("secret"), plaintext); err != nil {
+		t.Fatal(err)
+	}
+	var wt io.WriterTo = e
+	b := new(bytes.Buffer)
+	n, err := wt.WriteTo(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, b.Len())
+	}
+
+	d := NewDecrypter()
+	var rf io.ReaderFrom = d
+	if n, err = rf.ReadFrom(bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("ReadFrom returned %d, want %d", n, b.Len())
+	}
+	got, err := d.Decrypt([]byte("secret"))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+
+	// io.Copy writes the chunks of a PlaintextReader from its offset.
+	pr, err := NewDecrypter().OpenAt([]byte("secret"), bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pr.Seek(testChunkSize-10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if n, err = io.Copy(out, pr); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(plaintext)-testChunkSize+10) || !bytes.Equal(out.Bytes(), plaintext[testChunkSize-10:]) {
+		t.Errorf("copied %d bytes, want %d", n, len(plaintext)-testChunkSize+10)
+	}
+	if n, err = io.Copy(out, pr); n != 0 || err != nil {
+		t.Errorf("second copy: %d, %v, want 0", n, err)
+	}
+
+	// Short writes are reported.
+	pr.Seek(0, io.SeekStart)
+	if _, err = pr.WriteTo(shortWriter(10)); err == nil {
+		t.Error("short write not reported")
+	}
+}
+
+// shortWriter fails writes of more than n bytes.
+type shortWriter int
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	if len(p) > int(w) {
+		return int(w), io.ErrShortWrite
+	}
+	return len(p), nil
+}
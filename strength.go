@@ -0,0 +1,356 @@
+package celo
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/rrivera/celo/errors"
+)
+
+// Strength of a phrase: how hard it is to guess, from StrengthTooGuessable to
+// StrengthVeryUnguessable (See EstimateStrength).
+type Strength uint8
+
+// Strengths, as the scores of zxcvbn.
+const (
+	// StrengthTooGuessable less than 10^3 guesses, e.g. common passwords.
+	StrengthTooGuessable Strength = iota
+	// StrengthVeryGuessable less than 10^6 guesses.
+	StrengthVeryGuessable
+	// StrengthSomewhatGuessable less than 10^8 guesses.
+	StrengthSomewhatGuessable
+	// StrengthSafelyUnguessable less than 10^10 guesses.
+	StrengthSafelyUnguessable
+	// StrengthVeryUnguessable 10^10 guesses or more.
+	StrengthVeryUnguessable
+)
+
+// MaxStrength the strongest Strength.
+const MaxStrength = StrengthVeryUnguessable
+
+var strengthNames = [...]string{"too guessable", "very guessable", "somewhat guessable", "safely unguessable", "very unguessable"}
+
+func (s Strength) String() string {
+	if s > MaxStrength {
+		return "unknown"
+	}
+	return strengthNames[s]
+}
+
+// maxEstimatedRunes characters of a phrase matched against patterns by
+// EstimateGuesses, longer phrases are estimated by brute force from there.
+const maxEstimatedRunes = 100
+
+// bruteforceLog10 log10 of the guesses per character of the parts of a phrase
+// that don't match any pattern.
+const bruteforceLog10 = 1
+
+// Keyboard rows matched by EstimateGuesses.
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "!@#$%^&*()", "1qaz2wsx3edc4rfv5tgb"}
+
+// l33t substitutions undone before matching common passwords.
+var l33t = strings.NewReplacer("4", "a", "@", "a", "8", "b", "(", "c", "3", "e", "6", "g", "1", "i", "!", "i", "|", "i", "0", "o", "$", "s", "5", "s", "7", "t", "+", "t", "2", "z")
+
+// commonPasswords ranked by popularity, the most guessed first.
+var commonPasswords = rankPasswords(
+	"password", "123456", "qwerty", "123456789", "12345678", "12345", "1234567", "111111", "1234567890", "123123",
+	"abc123", "1234", "password1", "iloveyou", "1q2w3e4r", "000000", "qwerty123", "zaq12wsx", "dragon", "sunshine",
+	"princess", "letmein", "654321", "monkey", "1qaz2wsx", "123321", "qwertyuiop", "superman", "asdfghjkl", "trustno1",
+	"football", "baseball", "welcome", "admin", "login", "master", "hello", "freedom", "whatever", "qazwsx",
+	"shadow", "michael", "jennifer", "jordan", "hunter", "ranger", "buster", "soccer", "harley", "batman",
+	"andrew", "tigger", "charlie", "robert", "thomas", "hockey", "killer", "george", "daniel", "starwars",
+	"112233", "computer", "michelle", "jessica", "pepper", "zxcvbnm", "ashley", "mustang", "summer", "love",
+	"secret", "access", "flower", "cheese", "matrix", "hannah", "maggie", "ginger", "joshua", "amanda",
+	"cookie", "chocolate", "butterfly", "purple", "orange", "angel", "nicole", "jasmine", "samsung", "google",
+	"internet", "pokemon", "blink182", "liverpool", "chelsea", "arsenal", "yankees", "dallas", "austin", "test",
+	"guest", "changeme", "default", "root", "toor", "administrator", "pass", "passphrase", "private", "mypassword",
+	"qwer", "asdf", "zxcv", "abcdef", "abcd1234", "1q2w3e", "qweasd", "123qwe", "987654321", "lovely",
+	"family", "friends", "forever", "baby", "money", "winter", "spring", "autumn", "monday", "january",
+	"blue", "red", "green", "black", "white", "dog", "cat", "sex", "god", "jesus",
+	"celo", "encrypt", "backup", "secure", "hello123", "welcome1", "admin123", "letmein1", "iloveu", "loveme",
+)
+
+// rankPasswords returns the rank of each password, starting at 1.
+func rankPasswords(passwords ...string) map[string]int {
+	ranks := make(map[string]int, len(passwords))
+	for i, p := range passwords {
+		if _, ok := ranks[p]; !ok {
+			ranks[p] = i + 1
+		}
+	}
+	return ranks
+}
+
+// EstimateStrength estimates how hard phrase is to guess, in the manner of
+// zxcvbn (See EstimateGuesses).
+func EstimateStrength(phrase []byte) Strength {
+	g := EstimateGuesses(phrase)
+	switch {
+	case g < 3:
+		return StrengthTooGuessable
+	case g < 6:
+		return StrengthVeryGuessable
+	case g < 8:
+		return StrengthSomewhatGuessable
+	case g < 10:
+		return StrengthSafelyUnguessable
+	}
+	return StrengthVeryUnguessable
+}
+
+// EstimateGuesses estimates the log10 of the number of guesses needed to find
+// phrase. The phrase is split in the parts that need the fewest guesses
+// overall: common passwords (even capitalized, reversed or with l33t
+// substitutions), repeated characters, sequences such as "abc" or "321",
+// keyboard rows, years and, the characters that don't match anything, by brute
+// force. It is an estimate, it doesn't know the words of any language.
+func EstimateGuesses(phrase []byte) float64 {
+	p := []rune(string(phrase))
+	extra := 0
+	if len(p) > maxEstimatedRunes {
+		extra, p = len(p)-maxEstimatedRunes, p[:maxEstimatedRunes]
+	}
+	return estimateGuesses(p, true) + float64(extra)*bruteforceLog10
+}
+
+// estimateGuesses returns the log10 of the guesses of p, split in the parts
+// that need the fewest guesses. The parts are guessed in any order, the
+// number of parts counts as well. whole is false for parts of a phrase.
+func estimateGuesses(p []rune, whole bool) float64 {
+	n := len(p)
+	if n == 0 {
+		return 0
+	}
+
+	// best[j][k] log10 of the fewest guesses of p[:j] split in k parts.
+	best := make([][]float64, n+1)
+	for j := range best {
+		best[j] = make([]float64, n+1)
+		for k := range best[j] {
+			best[j][k] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+
+	for j := 1; j <= n; j++ {
+		for i := 0; i < j; i++ {
+			g := partGuesses(p[i:j], whole && i == 0 && j == n)
+			for k := 0; k <= i; k++ {
+				if v := best[i][k] + g; v < best[j][k+1] {
+					best[j][k+1] = v
+				}
+			}
+		}
+	}
+
+	min := math.Inf(1)
+	for k := 1; k <= n; k++ {
+		if v := best[n][k] + log10Factorial(k); v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// partGuesses returns the log10 of the fewest guesses of the part s of a
+// phrase, whole if it is the whole phrase.
+func partGuesses(s []rune, whole bool) float64 {
+	g := float64(len(s)) * bruteforceLog10
+	for _, match := range []func([]rune) (float64, bool){dictionaryGuesses, repeatGuesses, sequenceGuesses, keyboardGuesses, yearGuesses} {
+		if m, ok := match(s); ok && m < g {
+			g = m
+		}
+	}
+
+	// Parts are never trivial to guess, otherwise splitting a phrase in
+	// many of them would be cheap.
+	if !whole {
+		min := math.Log10(50)
+		if len(s) == 1 {
+			min = 1
+		}
+		g = math.Max(g, min)
+	}
+	return g
+}
+
+// dictionaryGuesses matches s against the common passwords, capitalized,
+// reversed or with l33t substitutions.
+func dictionaryGuesses(s []rune) (float64, bool) {
+	word := strings.ToLower(string(s))
+	variations := upperVariations(s)
+
+	rank, ok := commonPasswords[word]
+	if !ok {
+		if rank, ok = commonPasswords[reverse(word)]; ok {
+			variations *= 2
+		}
+	}
+	if !ok {
+		// "1" stands for both "i" and "l".
+		unleet := l33t.Replace(word)
+		if rank, ok = commonPasswords[unleet]; !ok {
+			rank, ok = commonPasswords[strings.ReplaceAll(unleet, "i", "l")]
+		}
+		if ok && unleet != word {
+			variations *= 2
+		}
+	}
+	if !ok {
+		return 0, false
+	}
+	return math.Log10(float64(rank) * variations), true
+}
+
+// upperVariations number of ways s could have been capitalized.
+func upperVariations(s []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && (unicode.IsUpper(s[0]) || unicode.IsUpper(s[len(s)-1])):
+		return 2
+	}
+	v := 0.0
+	for k := 1; k <= upper && k <= lower; k++ {
+		v += binomial(upper+lower, k)
+	}
+	return v
+}
+
+// repeatGuesses matches a character or a group of characters repeated, such as
+// "aaa" or "abab".
+func repeatGuesses(s []rune) (float64, bool) {
+	n := len(s)
+	for unit := 1; unit <= n/2; unit++ {
+		if n%unit != 0 || (unit == 1 && n < 3) {
+			continue
+		}
+		repeated := true
+		for i := unit; i < n && repeated; i++ {
+			repeated = s[i] == s[i-unit]
+		}
+		if !repeated {
+			continue
+		}
+		if unit == 1 {
+			return math.Log10(float64(cardinality(s[0]) * n)), true
+		}
+		return estimateGuesses(s[:unit], false) + math.Log10(float64(n/unit)), true
+	}
+	return 0, false
+}
+
+// sequenceGuesses matches sequences of at least 3 characters, such as "abc",
+// "321" or "xyz".
+func sequenceGuesses(s []rune) (float64, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	delta := s[1] - s[0]
+	if delta != 1 && delta != -1 {
+		return 0, false
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i]-s[i-1] != delta {
+			return 0, false
+		}
+	}
+
+	// Obvious starts are guessed first.
+	base := float64(cardinality(s[0]))
+	if strings.ContainsRune("aAzZ019", s[0]) {
+		base = 4
+	}
+	g := base * float64(len(s))
+	if delta < 0 {
+		g *= 2
+	}
+	return math.Log10(g), true
+}
+
+// keyboardGuesses matches at least 3 adjacent keys of a keyboard row, in
+// either direction.
+func keyboardGuesses(s []rune) (float64, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	keys := strings.ToLower(string(s))
+	for _, row := range keyboardRows {
+		switch {
+		case strings.Contains(row, keys):
+			return math.Log10(float64(len(keyboardRows) * len(row) * len(s))), true
+		case strings.Contains(row, reverse(keys)):
+			return math.Log10(float64(2 * len(keyboardRows) * len(row) * len(s))), true
+		}
+	}
+	return 0, false
+}
+
+// yearGuesses matches years from 1900 to 2099.
+func yearGuesses(s []rune) (float64, bool) {
+	if len(s) != 4 || (string(s[:2]) != "19" && string(s[:2]) != "20") {
+		return 0, false
+	}
+	for _, r := range s[2:] {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	return 2, true
+}
+
+// cardinality number of characters of the class of r.
+func cardinality(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return 10
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return 26
+	}
+	return 33
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func binomial(n, k int) float64 {
+	v := 1.0
+	for i := 1; i <= k; i++ {
+		v = v * float64(n-k+i) / float64(i)
+	}
+	return v
+}
+
+func log10Factorial(n int) float64 {
+	v := 0.0
+	for i := 2; i <= n; i++ {
+		v += math.Log10(float64(i))
+	}
+	return v
+}
+
+// CheckStrength returns an error of kind errors.PhraseIsWeak if phrase is
+// weaker than min.
+func CheckStrength(phrase []byte, min Strength) error {
+	if s := EstimateStrength(phrase); s < min {
+		return errors.E(errors.PhraseIsWeak, errors.Op("strength.CheckStrength"),
+			errors.Errorf("the phrase is %s (%d/%d), at least %d is required", s, s, MaxStrength, min))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package celo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		phrase string
+		want   Strength
+	}{
+		{"", StrengthTooGuessable},
+		{"password", StrengthTooGuessable},
+		{"Password", StrengthTooGuessable},
+		{"P@ssw0rd", StrengthTooGuessable},
+		{"drowssap", StrengthTooGuessable},
+		{"qwerty", StrengthTooGuessable},
+		{"aaaaaaaaaa", StrengthTooGuessable},
+		{"abcdefgh", StrengthTooGuessable},
+		{"987654321", StrengthTooGuessable},
+		{"password123", StrengthVeryGuessable},
+		{"letmein2024", StrengthVeryGuessable},
+		{"zxcvbnmasdf", StrengthVeryGuessable},
+		{"monkeydragon", StrengthVeryGuessable},
+		{"x7#Qp9!z", StrengthSafelyUnguessable},
+		{"correct horse battery staple", StrengthVeryUnguessable},
+		{"otter-quilt-lemon-pylon-brisk-cedar", StrengthVeryUnguessable},
+	}
+
+	for _, tt := range tests {
+		if got := EstimateStrength([]byte(tt.phrase)); got != tt.want {
+			t.Errorf("EstimateStrength(%q) = %v (%.1f), want %v", tt.phrase, got, EstimateGuesses([]byte(tt.phrase)), tt.want)
+		}
+	}
+}
+
+func TestEstimateGuesses(t *testing.T) {
+	// Patterns take fewer guesses than random characters of the same length.
+	if p, r := EstimateGuesses([]byte("abcabcabcabc")), EstimateGuesses([]byte("a8#kQ2z!mP0w")); p >= r {
+		t.Errorf("repeated pattern %.1f, random %.1f", p, r)
+	}
+
+	// Characters past the ones matched against patterns add brute force
+	// guesses.
+	long := []byte(strings.Repeat("a", maxEstimatedRunes+10))
+	if got, want := EstimateGuesses(long), EstimateGuesses(long[:maxEstimatedRunes])+10*bruteforceLog10; got != want {
+		t.Errorf("long phrase: got %.1f, want %.1f", got, want)
+	}
+}
+
+func TestCheckStrength(t *testing.T) {
+	if err := CheckStrength([]byte("password"), StrengthTooGuessable); err != nil {
+		t.Errorf("no minimum: got %v", err)
+	}
+	if err := CheckStrength([]byte("password"), StrengthSomewhatGuessable); !errors.Is(errors.PhraseIsWeak, err) {
+		t.Errorf("weak phrase: got %v, want kind PhraseIsWeak", err)
+	}
+	if err := CheckStrength([]byte("correct horse battery staple"), MaxStrength); err != nil {
+		t.Errorf("strong phrase: got %v", err)
+	}
+}
+
+func TestTerminalPhraseMinStrength(t *testing.T) {
+	// The weak phrase counts as a try, the strong one is confirmed.
+	typePhrases(t, "password", "correct horse battery staple", "correct horse battery staple")
+	phrase, err := (TerminalPhrase{Retries: 2, MinStrength: StrengthSafelyUnguessable}).Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(phrase) != "correct horse battery staple" {
+		t.Errorf("got phrase %q", phrase)
+	}
+
+	typePhrases(t, "password")
+	if _, err = (TerminalPhrase{Retries: 1, MinStrength: StrengthSafelyUnguessable}).Phrase(true); !errors.Is(errors.PhraseIsWeak, err) {
+		t.Errorf("weak phrase: got error %v, want kind PhraseIsWeak", err)
+	}
+
+	// The strength of phrases that aren't confirmed isn't checked.
+	typePhrases(t, "password")
+	if _, err = (TerminalPhrase{MinStrength: MaxStrength}).Phrase(false); err != nil {
+		t.Errorf("unconfirmed phrase: got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package celo
+
+import (
+	"os"
+)
+
+// tty terminal the phrase is typed in when TerminalPhrase.TTY is set: it is
+// read from in without echoing it and the instructions are printed to out.
+// Both are the same file on Unix systems, Windows has a handle for the input
+// of the console and another one for its output.
+type tty struct {
+	in  *os.File
+	out *os.File
+}
+
+// Close closes the files of the terminal.
+func (t *tty) Close() error {
+	err := t.in.Close()
+	if t.out != t.in {
+		if oerr := t.out.Close(); err == nil {
+			err = oerr
+		}
+	}
+	return err
+}
+
+// stdinFd returns the file descriptor of Stdin, a handle on Windows, as the
+// terminal package expects it.
+func stdinFd() int {
+	return int(os.Stdin.Fd())
+}
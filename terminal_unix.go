@@ -0,0 +1,17 @@
+//go:build !windows
+
+package celo
+
+import "os"
+
+// ttyName name of the controlling terminal.
+const ttyName = "/dev/tty"
+
+// openTTY opens the controlling terminal.
+var openTTY = func() (*tty, error) {
+	f, err := os.OpenFile(ttyName, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &tty{in: f, out: f}, nil
+}
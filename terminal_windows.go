@@ -0,0 +1,23 @@
+package celo
+
+import "os"
+
+// ttyName name of the controlling terminal, Windows doesn't have one. The
+// console is opened through CONIN$ and CONOUT$ instead.
+const ttyName = ""
+
+// openTTY opens the console of the process, even if Stdin and Stdout are
+// redirected. The input must be opened for writing as well, echo is disabled
+// by changing its mode.
+var openTTY = func() (*tty, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return &tty{in: in, out: out}, nil
+}
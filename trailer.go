@@ -0,0 +1,127 @@
+package celo
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+
+	"github.com/rrivera/celo/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Trailer appended to the payload of files with the flagTrailer, before the
+// signature block (if any).
+//  marker (8 bytes) | payload size (8 bytes, big endian) | checksum (32 bytes)
+// The marker and the size are checked before anything is decrypted, so a
+// truncated file (e.g. an interrupted copy) is reported as such instead of as a
+// generic authentication failure.
+// The checksum is a BLAKE2b-256 of the payload keyed with a key derived from the
+// data key, only the recipients of the file can compute it.
+const TrailerSize = 8 + 8 + blake2b.Size256
+
+// trailerMarker identifies the beginning of the trailer.
+var trailerMarker = []byte("celo-end")
+
+// trailerInfo binds the checksum key derived from the data key to its usage.
+const trailerInfo = "celo/trailer"
+
+// trailerChecksum computes the checksum of the payload, made of all the parts,
+// keyed with dataKey.
+func trailerChecksum(dataKey []byte, payload ...[]byte) ([]byte, error) {
+	h, err := newTrailerHash(dataKey, int64(payloadSize(payload)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range payload {
+		h.Write(p)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// newTrailerHash returns a hash that computes the checksum of a payload of size
+// bytes written to it (See trailerChecksum), keyed with dataKey.
+func newTrailerHash(dataKey []byte, size int64) (hash.Hash, error) {
+	op := errors.Op("trailer.newTrailerHash")
+
+	key := make([]byte, blake2b.Size256)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte(trailerInfo)), key); err != nil {
+		return nil, errors.E(errors.Internal, op, err)
+	}
+
+	h, err := blake2b.New256(key)
+	ZeroBytes(key)
+	if err != nil {
+		return nil, errors.E(errors.Internal, op, err)
+	}
+
+	binary.Write(h, binary.BigEndian, uint64(size))
+
+	return h, nil
+}
+
+// newTrailer creates the trailer of the payload, made of all the parts.
+func newTrailer(dataKey []byte, payload ...[]byte) ([]byte, error) {
+	checksum, err := trailerChecksum(dataKey, payload...)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeTrailer(int64(payloadSize(payload)), checksum), nil
+}
+
+// encodeTrailer encodes the trailer of a payload of size bytes.
+func encodeTrailer(size int64, checksum []byte) []byte {
+	b := make([]byte, 0, TrailerSize)
+	b = append(b, trailerMarker...)
+	b = binary.BigEndian.AppendUint64(b, uint64(size))
+	b = append(b, checksum...)
+
+	return b
+}
+
+// parseTrailer verifies that the trailer b belongs to a payload of the given
+// size and returns its checksum.
+// It returns an error of kind errors.Truncated if the marker is missing or the
+// size doesn't match.
+func parseTrailer(b []byte, size int64) (checksum []byte, err error) {
+	op := errors.Op("trailer.parseTrailer")
+
+	if len(b) != TrailerSize || !bytes.Equal(b[:len(trailerMarker)], trailerMarker) {
+		return nil, errors.E(errors.Truncated, op)
+	}
+
+	recorded := binary.BigEndian.Uint64(b[len(trailerMarker):])
+	if size < 0 || recorded != uint64(size) {
+		return nil, errors.E(errors.Truncated, op, errors.Errorf("expected %d bytes of payload, found %d", recorded, size))
+	}
+
+	return b[len(trailerMarker)+8:], nil
+}
+
+// checkTrailer verifies the checksum of the payload, made of all the parts.
+func checkTrailer(dataKey, checksum []byte, payload ...[]byte) error {
+	expected, err := trailerChecksum(dataKey, payload...)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(expected, checksum) {
+		return errors.E(errors.Ciphertext, errors.Op("trailer.checkTrailer"), errors.Errorf("checksum mismatch"))
+	}
+
+	return nil
+}
+
+// payloadSize returns the total size of the parts of a payload.
+func payloadSize(payload [][]byte) (n int) {
+	for _, p := range payload {
+		n += len(p)
+	}
+	return n
+}
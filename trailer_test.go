@@ -0,0 +1,63 @@
+package celo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestTrailerTruncated(t *testing.T) {
+	phrase := []byte("secret")
+	file := sealFile(t, NewEncrypter(), phrase, randomPlaintext(2*testChunkSize))
+
+	info, err := Inspect(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cuts := []int{1, TrailerSize - 1, TrailerSize, TrailerSize + 1, testChunkSize, len(file) - info.HeaderSize}
+	for _, cut := range cuts {
+		truncated := file[:len(file)-cut]
+
+		if _, err = openFile(NewDecrypter(), phrase, truncated); !errors.Is(errors.Truncated, err) {
+			t.Errorf("cut %d: Decrypt error %v, want kind Truncated", cut, err)
+		}
+		if _, err = NewDecrypter().OpenAt(phrase, bytes.NewReader(truncated), int64(len(truncated))); !errors.Is(errors.Truncated, err) {
+			t.Errorf("cut %d: OpenAt error %v, want kind Truncated", cut, err)
+		}
+		if _, err = Inspect(bytes.NewReader(truncated)); !errors.Is(errors.Truncated, err) {
+			t.Errorf("cut %d: Inspect error %v, want kind Truncated", cut, err)
+		}
+	}
+
+	// Extra bytes move the trailer.
+	appended := append(append([]byte(nil), file...), 0)
+	if _, err = openFile(NewDecrypter(), phrase, appended); !errors.Is(errors.Truncated, err) {
+		t.Errorf("appended byte: got error %v, want kind Truncated", err)
+	}
+}
+
+func TestTrailerChecksum(t *testing.T) {
+	phrase := []byte("secret")
+	file := sealFile(t, NewEncrypter(), phrase, randomPlaintext(100))
+
+	tampered := append([]byte(nil), file...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := openFile(NewDecrypter(), phrase, tampered); !errors.Is(errors.Ciphertext, err) {
+		t.Errorf("got error %v, want kind Ciphertext", err)
+	}
+
+	// The checksum is keyed, it can't be computed without the data key.
+	sum, err := trailerChecksum([]byte("key"), []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := trailerChecksum([]byte("other key"), []byte("payload"))
+	if bytes.Equal(sum, other) {
+		t.Error("checksums of different keys are equal")
+	}
+	if err = checkTrailer([]byte("key"), sum, []byte("pay"), []byte("load")); err != nil {
+		t.Errorf("payload split in parts: %v", err)
+	}
+}
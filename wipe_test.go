@@ -0,0 +1,105 @@
+package celo
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestZeroBytes(t *testing.T) {
+	a, b := []byte("secret"), []byte("key")
+	ZeroBytes(a, nil, b)
+
+	if !bytes.Equal(a, make([]byte, 6)) || !bytes.Equal(b, make([]byte, 3)) {
+		t.Errorf("got %v and %v, want zeros", a, b)
+	}
+}
+
+func TestWipe(t *testing.T) {
+	e := NewEncrypter()
+	sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+
+	salt := e.salt
+	clone := e.Clone()
+	e.Wipe()
+
+	if !bytes.Equal(salt, make([]byte, len(salt))) {
+		t.Errorf("salt %x not zeroed", salt)
+	}
+	if e.IsReady() || e.cipher != nil || e.keyDigest != nil {
+		t.Error("wiped Encrypter still initialized")
+	}
+
+	// Clones don't share the zeroed values.
+	if bytes.Equal(clone.salt, make([]byte, len(clone.salt))) {
+		t.Error("salt of the clone zeroed")
+	}
+
+	// A wiped instance can be used again.
+	file := sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+	if _, err := openFile(NewDecrypter(), []byte("secret"), file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWipeDecrypter(t *testing.T) {
+	e := NewEncrypter()
+	file := sealFile(t, e, []byte("secret"), []byte("attack at dawn"))
+
+	d := NewDecrypter()
+	if _, err := openFile(d, []byte("secret"), file); err != nil {
+		t.Fatal(err)
+	}
+	stanza, metadata := d.stanzas[0], d.metadata
+	d.Wipe()
+
+	// The salt is zeroed without modifying the stanza it was read from.
+	ps, err := parsePhrase(stanza, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ps.salt, make([]byte, len(ps.salt))) {
+		t.Error("salt of the stanza zeroed")
+	}
+
+	salt, nonce := bytes.Repeat([]byte{1}, SaltSize), make([]byte, NonceSize)
+	original := append([]byte(nil), salt...)
+	if err = d.Init([]byte("secret"), salt, nonce, []byte("ciphertext")); err != nil {
+		t.Fatal(err)
+	}
+	d.Wipe()
+	if !bytes.Equal(salt, original) {
+		t.Error("salt passed to Init zeroed")
+	}
+}
+
+func TestReadAndConfirmZeroes(t *testing.T) {
+	var read [][]byte
+	original, terminal := readPassword, isTerminal
+	t.Cleanup(func() { readPassword, isTerminal = original, terminal })
+	isTerminal = func(fd int) bool { return true }
+
+	lines := []string{"secret", "typo", "secret", "secret"}
+	readPassword = func(fd int) ([]byte, error) {
+		b := []byte(lines[len(read)])
+		read = append(read, b)
+		return b, nil
+	}
+
+	phrase, err := TerminalPhrase{Retries: 2}.Phrase(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(phrase) != "secret" {
+		t.Errorf("got phrase %q, want %q", phrase, "secret")
+	}
+
+	// Everything but the returned phrase is zeroed.
+	for i, b := range read[:2] {
+		if !bytes.Equal(b, make([]byte, len(b))) {
+			t.Errorf("%d: discarded phrase %q not zeroed", i, b)
+		}
+	}
+	if !bytes.Equal(read[3], make([]byte, len(read[3]))) {
+		t.Errorf("confirmation %q not zeroed", read[3])
+	}
+}
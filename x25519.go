@@ -0,0 +1,225 @@
+package celo
+
+import (
+	"bufio"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"io"
+	"strings"
+
+	"github.com/rrivera/celo/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Textual encoding of X25519 keys.
+//  celo1...              <- public key (recipient)
+//  CELO-SECRET-KEY-1...  <- private key (identity)
+const (
+	x25519RecipientPrefix = "celo1"
+	x25519IdentityPrefix  = "CELO-SECRET-KEY-1"
+)
+
+// x25519Info binds the keys derived from the shared secret to their use.
+const x25519Info = "celo/x25519"
+
+var x25519Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// X25519Recipient is a public key Recipient. The data key is wrapped with a
+// key derived from the shared secret of an ephemeral key and the public key,
+// so only the owner of the matching X25519Identity can unwrap it.
+type X25519Recipient struct {
+	publicKey *ecdh.PublicKey
+}
+
+// ParseX25519Recipient parses a public key encoded by X25519Recipient.String.
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	op := errors.Op("x25519.ParseX25519Recipient")
+
+	if !strings.HasPrefix(s, x25519RecipientPrefix) {
+		return nil, errors.E(errors.Key, op, errors.Errorf("missing %s prefix", x25519RecipientPrefix))
+	}
+
+	b, err := x25519Encoding.DecodeString(strings.ToUpper(s[len(x25519RecipientPrefix):]))
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	publicKey, err := ecdh.X25519().NewPublicKey(b)
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	return &X25519Recipient{publicKey: publicKey}, nil
+}
+
+// String returns the textual encoding of the public key.
+func (r *X25519Recipient) String() string {
+	return x25519RecipientPrefix + strings.ToLower(x25519Encoding.EncodeToString(r.publicKey.Bytes()))
+}
+
+// Wrap wraps the data key for the public key.
+//  ephemeral public key | nonce | wrapped data key
+// The nonce is always NonceSize bytes, regardless of the nonce size of the
+// file.
+func (r *X25519Recipient) Wrap(dataKey []byte, m *Metadata) (*Stanza, error) {
+	op := errors.Op("x25519.Wrap")
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	shared, err := ephemeral.ECDH(r.publicKey)
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	ephemeralKey := ephemeral.PublicKey().Bytes()
+
+	kek, err := x25519Cipher(shared, ephemeralKey, r.publicKey.Bytes())
+	ZeroBytes(shared)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, wrapped, err := kek.Encrypt(dataKey, m.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, len(ephemeralKey)+len(nonce)+len(wrapped))
+	body = append(body, ephemeralKey...)
+	body = append(body, nonce...)
+	body = append(body, wrapped...)
+
+	return &Stanza{Type: StanzaX25519, Body: body}, nil
+}
+
+// X25519Identity is the private key counterpart of X25519Recipient.
+type X25519Identity struct {
+	privateKey *ecdh.PrivateKey
+}
+
+// GenerateX25519Identity generates a random X25519 key pair.
+func GenerateX25519Identity() (*X25519Identity, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.E(errors.Key, errors.Op("x25519.GenerateX25519Identity"), err)
+	}
+	return &X25519Identity{privateKey: privateKey}, nil
+}
+
+// ParseX25519Identity parses a private key encoded by X25519Identity.String.
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	op := errors.Op("x25519.ParseX25519Identity")
+
+	if !strings.HasPrefix(s, x25519IdentityPrefix) {
+		return nil, errors.E(errors.Key, op, errors.Errorf("missing %s prefix", x25519IdentityPrefix))
+	}
+
+	b, err := x25519Encoding.DecodeString(s[len(x25519IdentityPrefix):])
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	privateKey, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	return &X25519Identity{privateKey: privateKey}, nil
+}
+
+// ReadX25519Identities parses an identity file: one private key per line,
+// empty lines and lines starting with "#" are ignored.
+func ReadX25519Identities(r io.Reader) (ids []*X25519Identity, err error) {
+	op := errors.Op("x25519.ReadX25519Identities")
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, err := ParseX25519Identity(line)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		ids = append(ids, id)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.E(errors.Key, op, err)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.E(errors.Key, op, errors.Errorf("no identities found"))
+	}
+
+	return ids, nil
+}
+
+// String returns the textual encoding of the private key.
+func (i *X25519Identity) String() string {
+	return x25519IdentityPrefix + x25519Encoding.EncodeToString(i.privateKey.Bytes())
+}
+
+// Recipient returns the public key of the identity.
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{publicKey: i.privateKey.PublicKey()}
+}
+
+// Unwrap unwraps the data key of a stanza created by X25519Recipient.Wrap.
+func (i *X25519Identity) Unwrap(s *Stanza, m *Metadata) (dataKey []byte, err error) {
+	op := errors.Op("x25519.Unwrap")
+
+	// The key wrapping cipher doesn't use the nonce size of the file (See
+	// x25519Cipher).
+	keySize := len(i.privateKey.PublicKey().Bytes())
+	nonceSize := NonceSize
+
+	if s.Type != StanzaX25519 || len(s.Body) <= keySize+nonceSize {
+		return nil, errors.E(errors.Decode, op)
+	}
+
+	ephemeralKey := s.Body[:keySize]
+	nonce := s.Body[keySize : keySize+nonceSize]
+	wrapped := s.Body[keySize+nonceSize:]
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, errors.E(errors.Decode, op, err)
+	}
+
+	shared, err := i.privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, errors.E(errors.Decrypt, op, err)
+	}
+
+	kek, err := x25519Cipher(shared, ephemeralKey, i.privateKey.PublicKey().Bytes())
+	ZeroBytes(shared)
+	if err != nil {
+		return nil, err
+	}
+
+	return kek.Decrypt(nonce, wrapped, m.Bytes())
+}
+
+// x25519Cipher creates the cipher that wraps the data key from the shared
+// secret. Both public keys are used as salt to bind the key to them.
+// Its nonce size is fixed, the key is only used once.
+func x25519Cipher(shared, ephemeralKey, publicKey []byte) (*Cipher, error) {
+	salt := make([]byte, 0, len(ephemeralKey)+len(publicKey))
+	salt = append(salt, ephemeralKey...)
+	salt = append(salt, publicKey...)
+
+	key := make([]byte, Aes256BlockSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(x25519Info)), key); err != nil {
+		return nil, errors.E(errors.Key, errors.Op("x25519.x25519Cipher"), err)
+	}
+
+	defer ZeroBytes(key)
+	return NewCipher(Aes256BlockSize, NonceSize, key)
+}
@@ -0,0 +1,116 @@
+package celo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rrivera/celo/errors"
+)
+
+func TestX25519RoundTrip(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("attack at dawn")
+
+	for _, nonceSize := range []int{MinNonceSize, 16, MaxNonceSize} {
+		e := NewEncrypter()
+		if err = e.Config(SetNonceSize(nonceSize), AddRecipient(id.Recipient())); err != nil {
+			t.Fatal(err)
+		}
+		file := sealFile(t, e, nil, plaintext)
+
+		d := NewDecrypter()
+		d.Config(AddIdentity(id))
+		got, err := openFile(d, nil, file)
+		if err != nil {
+			t.Fatalf("nonce size %d: %v", nonceSize, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("nonce size %d: got %q, want %q", nonceSize, got, plaintext)
+		}
+	}
+}
+
+func TestX25519WrongIdentity(t *testing.T) {
+	id, _ := GenerateX25519Identity()
+	other, _ := GenerateX25519Identity()
+
+	e := NewEncrypter()
+	e.Config(AddRecipient(id.Recipient()))
+	file := sealFile(t, e, nil, []byte("attack at dawn"))
+
+	d := NewDecrypter()
+	d.Config(AddIdentity(other))
+	if _, err := openFile(d, nil, file); !errors.Is(errors.WrongPassphrase, err) {
+		t.Errorf("got error %v, want kind WrongPassphrase", err)
+	}
+}
+
+func TestX25519MalformedNonceSize(t *testing.T) {
+	id, _ := GenerateX25519Identity()
+
+	e := NewEncrypter()
+	e.Config(AddRecipient(id.Recipient()))
+	file := sealFile(t, e, nil, []byte("attack at dawn"))
+
+	// The nonce size of the file signature is changed to the maximum, which
+	// is longer than the body of the stanza allows.
+	file[11] = MaxNonceSize
+
+	d := NewDecrypter()
+	d.Config(AddIdentity(id))
+	if _, err := openFile(d, nil, file); err == nil {
+		t.Error("file with a modified nonce size was decrypted")
+	}
+
+	// A stanza shorter than the nonce is rejected instead of panicking.
+	m := newCurrentMetadata(PaddingNone, &e.celo)
+	m.vsbn[nonceSizeIndex] = 255
+	s := &Stanza{Type: StanzaX25519, Body: make([]byte, 40)}
+	if _, err := id.Unwrap(s, m); !errors.Is(errors.Decode, err) {
+		t.Errorf("got error %v, want kind Decode", err)
+	}
+}
+
+func TestX25519KeyEncoding(t *testing.T) {
+	id, _ := GenerateX25519Identity()
+
+	r, err := ParseX25519Recipient(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.String() != id.Recipient().String() {
+		t.Errorf("recipient round trip: got %s, want %s", r, id.Recipient())
+	}
+
+	file := "# created by celo keygen\n\n" + id.String() + "\n"
+	ids, err := ReadX25519Identities(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0].String() != id.String() {
+		t.Errorf("identity round trip: got %v, want %s", ids, id)
+	}
+
+	invalid := []string{
+		"",
+		"age1" + id.Recipient().String()[len(x25519RecipientPrefix):],
+		x25519RecipientPrefix + "not base32!",
+		x25519RecipientPrefix + "aaaa",
+	}
+	for _, s := range invalid {
+		if _, err = ParseX25519Recipient(s); !errors.Is(errors.Key, err) {
+			t.Errorf("recipient %q: got error %v, want kind Key", s, err)
+		}
+	}
+
+	if _, err = ReadX25519Identities(strings.NewReader("# no keys\n")); !errors.Is(errors.Key, err) {
+		t.Errorf("empty identity file: got error %v, want kind Key", err)
+	}
+	if _, err = ReadX25519Identities(strings.NewReader(x25519IdentityPrefix + "AAAA\n")); !errors.Is(errors.Key, err) {
+		t.Errorf("invalid identity: got error %v, want kind Key", err)
+	}
+}